@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/abkawan/banking-ledger/internal/storage"
+)
+
+func main() {
+	key := flag.String("verify", "", "key of the stored blob to check against its manifest, e.g. exports/<tenant>/<id>/<file>")
+	out := flag.String("out", "", "also write the verified, decrypted content to this file")
+	flag.Parse()
+
+	storageURL := getEnv("STORAGE_URL", "")
+	if storageURL == "" || *key == "" {
+		log.Fatal("usage: STORAGE_URL=... archive -verify <key> [-out file]")
+	}
+
+	store, err := storage.Open(storageURL, storage.Config{
+		SigningKey:      []byte(getEnv("STORAGE_SIGNING_KEY", "")),
+		AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		SessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		Region:          getEnv("AWS_REGION", ""),
+		Endpoint:        getEnv("STORAGE_ENDPOINT", ""),
+		GCSAccessID:     getEnv("GCS_HMAC_ACCESS_ID", ""),
+		GCSSecret:       getEnv("GCS_HMAC_SECRET", ""),
+		EncryptionKeys:  getEnv("STORAGE_ENCRYPTION_KEYS", ""),
+		KMSKeyID:        getEnv("STORAGE_KMS_KEY_ID", ""),
+		AllowUnsealed:   getEnv("STORAGE_ALLOW_UNSEALED", "false") == "true",
+	})
+	if err != nil {
+		log.Fatalf("invalid STORAGE_URL: %v", err)
+	}
+
+	// a failed check exits non-zero, so scheduled audits can alert on it
+	data, manifest, err := store.Verify(context.Background(), *key)
+	if err != nil {
+		log.Fatalf("verification failed: %v", err)
+	}
+	if manifest == nil {
+		log.Fatalf("%s has no manifest; it was stored before manifests were kept and can't be verified", *key)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		log.Fatalf("failed to write manifest: %v", err)
+	}
+	log.Printf("%s matches its manifest: %d bytes, sha256 %s", *key, manifest.Size, manifest.SHA256)
+
+	if *out != "" {
+		if err := os.WriteFile(*out, data, 0o600); err != nil {
+			log.Fatalf("failed to write %s: %v", *out, err)
+		}
+	}
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher ships catalog events to the analytics pipeline
+type Publisher interface {
+	// Publish hands the event off for delivery; key selects the partition so one account's events stay ordered
+	Publish(ctx context.Context, key string, event *events.Envelope) error
+	Close() error
+}
+
+// KafkaPublisher writes events as JSON to a Kafka topic
+// writes are asynchronous: the processor never waits on the analytics cluster
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// creates a new KafkaPublisher for the given brokers and topic
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 100 * time.Millisecond,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Printf("Failed to publish %d analytics events to %s: %v", len(messages), topic, err)
+				}
+			},
+		},
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, key string, event *events.Envelope) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(key),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte(event.Type)},
+			{Key: "event-version", Value: []byte(fmt.Sprint(event.Version))},
+		},
+	})
+}
+
+// flushes buffered events and closes the connection
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
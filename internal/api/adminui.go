@@ -0,0 +1,123 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// AdminUIPath is where the operator UI is served; its pages are public, the admin API calls they make are not
+const AdminUIPath = "/admin/ui/"
+
+// most messages a queue inspection reads
+const maxPeekLimit = 100
+
+//go:embed adminui
+var adminUIFiles embed.FS
+
+// AdminUI serves the embedded operator UI, which talks to the admin API with the token the operator enters
+func (h *Handler) AdminUI() http.Handler {
+	files, err := fs.Sub(adminUIFiles, "adminui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix(AdminUIPath, http.FileServer(http.FS(files)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.config.AdminToken == "" {
+			respondError(w, r, http.StatusNotFound, errAdminDisabled)
+			return
+		}
+		if r.URL.Path == "/admin/ui" {
+			http.Redirect(w, r, AdminUIPath, http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// GetAdminAccounts handles browsing a tenant's accounts, optionally by external reference
+func (h *Handler) GetAdminAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := tenant.WithTenant(r.Context(), mux.Vars(r)["tenantId"])
+	limit, offset := pageParams(r, 50)
+	accounts, err := h.accountService.FindAccounts(ctx, r.URL.Query().Get("external_reference"), nil, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(accounts))
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+	}
+	response := make([]models.AccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response = append(response, newAccountResponse(account))
+	}
+
+	respondPage(w, r, response, page)
+}
+
+// GetAdminAccount handles the operator view of an account
+func (h *Handler) GetAdminAccount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	account, err := h.accountService.GetAccount(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newAccountResponse(account))
+}
+
+// GetAdminTransactionTimeline handles the operator view of a transaction's timeline
+func (h *Handler) GetAdminTransactionTimeline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	timeline, err := h.transactionService.GetTimeline(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errTransactionNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, timeline)
+}
+
+// GetQueueMessages handles inspecting the messages waiting in the dead-letter or quarantine queue
+func (h *Handler) GetQueueMessages(w http.ResponseWriter, r *http.Request) {
+	limit, _ := pageParams(r, 20)
+	if limit > maxPeekLimit {
+		limit = maxPeekLimit
+	}
+
+	contents, err := h.transactionService.PeekQueue(r.Context(), mux.Vars(r)["name"], limit)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, contents)
+}
+
+// GetReconciliation handles checking a tenant's balances across Postgres and MongoDB, without repairs
+func (h *Handler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	if tenantID == "" {
+		respondError(w, r, http.StatusBadRequest, errTenantIDRequired)
+		return
+	}
+
+	report, err := h.transactionService.Reconcile(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
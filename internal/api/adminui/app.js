@@ -0,0 +1,223 @@
+// Operator UI for the admin API. Everything is read with the admin token kept in session storage, and rendered
+// as text nodes only, so nothing a tenant stored can run as markup.
+"use strict";
+
+const view = document.getElementById("view");
+const status = document.getElementById("status");
+const signin = document.getElementById("signin");
+const signout = document.getElementById("signout");
+
+function token() {
+  return sessionStorage.getItem("adminToken");
+}
+
+async function api(path) {
+  const resp = await fetch("/admin" + path, { headers: { "X-Admin-Token": token() } });
+  const body = await resp.json().catch(() => ({}));
+  if (resp.status === 403) {
+    sessionStorage.removeItem("adminToken");
+    route();
+  }
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+// el builds an element; strings among the children become text nodes
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (value !== undefined && value !== null) {
+      node.setAttribute(key, value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== undefined && child !== null) {
+      node.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return node;
+}
+
+function link(hash, text) {
+  return el("a", { href: "#" + hash }, text);
+}
+
+function table(headings, rows) {
+  return el("table", {},
+    el("thead", {}, el("tr", {}, headings.map((h) => el("th", {}, h)))),
+    el("tbody", {}, rows.length ? rows : [el("tr", {}, el("td", { colspan: headings.length }, "Nothing here"))]));
+}
+
+function amount(value) {
+  return el("td", { class: "number" }, value === undefined ? "" : Number(value).toFixed(2));
+}
+
+function when(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+function json(value) {
+  return el("pre", {}, JSON.stringify(value, null, 2));
+}
+
+function enc(value) {
+  return encodeURIComponent(value);
+}
+
+// a form of named text inputs, prefilled from the current query, that navigates to hash with them
+function searchForm(hash, fields, params) {
+  const inputs = fields.map(([name, label]) => el("input", { name, placeholder: label, value: params.get(name) || "" }));
+  const form = el("form", {}, inputs, el("button", { type: "submit" }, "Show"));
+  form.addEventListener("submit", (event) => {
+    event.preventDefault();
+    const query = new URLSearchParams();
+    inputs.forEach((input) => input.value && query.set(input.name, input.value.trim()));
+    location.hash = hash + "?" + query;
+  });
+  return form;
+}
+
+async function accounts(params) {
+  const form = searchForm("/accounts", [["tenant", "Tenant ID"], ["external_reference", "External reference"]], params);
+  const tenant = params.get("tenant");
+  if (!tenant) {
+    return [el("h2", {}, "Accounts"), form];
+  }
+  let query = "?limit=100";
+  if (params.get("external_reference")) {
+    query += "&external_reference=" + enc(params.get("external_reference"));
+  }
+  const page = await api("/tenants/" + enc(tenant) + "/accounts" + query);
+  return [
+    el("h2", {}, "Accounts of ", tenant), form,
+    table(["Account", "Kind", "Currency", "Balance", "KYC", "External reference", "Created"],
+      page.data.map((a) => el("tr", {},
+        el("td", {}, link("/tenants/" + enc(tenant) + "/accounts/" + enc(a.id), a.id)),
+        el("td", {}, a.kind), el("td", {}, a.currency), amount(a.balance), el("td", {}, a.kyc_status),
+        el("td", {}, a.external_reference || ""), el("td", {}, when(a.created_at))))),
+  ];
+}
+
+async function account(tenant, id) {
+  const [acct, txs] = await Promise.all([
+    api("/tenants/" + enc(tenant) + "/accounts/" + enc(id)),
+    api("/transactions?limit=100&tenant_id=" + enc(tenant) + "&account_id=" + enc(id)),
+  ]);
+  return [
+    el("h2", {}, "Account ", id),
+    el("p", {}, link("/accounts?tenant=" + enc(tenant), "All accounts of " + tenant)),
+    json(acct),
+    el("h3", {}, "Latest transactions"),
+    table(["Transaction", "Type", "Status", "Amount", "Balance after", "Reference", "Created"],
+      txs.data.map((tx) => el("tr", {},
+        el("td", {}, link("/tenants/" + enc(tenant) + "/transactions/" + enc(tx.id), tx.id)),
+        el("td", {}, tx.type), el("td", { class: tx.status }, tx.status), amount(tx.amount), amount(tx.balance_after),
+        el("td", {}, tx.reference), el("td", {}, when(tx.created_at))))),
+  ];
+}
+
+async function transaction(tenant, id) {
+  const [tx, timeline] = await Promise.all([
+    api("/tenants/" + enc(tenant) + "/transactions/" + enc(id)),
+    api("/tenants/" + enc(tenant) + "/transactions/" + enc(id) + "/timeline"),
+  ]);
+  return [
+    el("h2", {}, "Transaction ", id),
+    el("p", {}, link("/tenants/" + enc(tenant) + "/accounts/" + enc(tx.account_id), "Account " + tx.account_id)),
+    el("h3", {}, "Timeline"),
+    table(["At", "Event", "Status", "Component", "Actor", "Detail"],
+      timeline.events.map((e) => el("tr", {},
+        el("td", {}, when(e.at)), el("td", {}, e.event), el("td", { class: e.status }, e.status),
+        el("td", {}, e.component || ""), el("td", {}, e.actor || ""), el("td", {}, e.detail || "")))),
+    el("h3", {}, "Transaction"),
+    json(tx),
+  ];
+}
+
+async function queue(name) {
+  const contents = await api("/queues/" + enc(name) + "/messages?limit=50");
+  return [
+    el("h2", {}, contents.queue),
+    el("p", {}, contents.depth + " messages waiting; the first " + contents.messages.length + " are shown and stay in the queue."),
+    table(["Message", "Reason", "From", "Tenant", "Transaction", "Amount", "Body"],
+      contents.messages.map((m) => {
+        const tx = m.transaction;
+        return el("tr", {},
+          el("td", {}, m.message_id || m.correlation_id || ""), el("td", {}, m.reason || ""), el("td", {}, m.from || ""),
+          el("td", {}, tx ? tx.tenant_id || "" : ""),
+          el("td", {}, tx && tx.tenant_id ? link("/tenants/" + enc(tx.tenant_id) + "/transactions/" + enc(tx.id), tx.id) : (tx ? tx.id : "")),
+          tx ? amount(tx.amount) : el("td", {}),
+          el("td", {}, m.body ? el("pre", {}, m.body) : ""));
+      })),
+  ];
+}
+
+async function reconciliation(params) {
+  const form = searchForm("/reconciliation", [["tenant", "Tenant ID"]], params);
+  const tenant = params.get("tenant");
+  if (!tenant) {
+    return [el("h2", {}, "Reconciliation"), form];
+  }
+  const report = await api("/reconciliation?tenant_id=" + enc(tenant));
+  return [
+    el("h2", {}, "Reconciliation of ", tenant), form,
+    el("p", { class: report.findings.length ? "diverged" : "consistent" },
+      "Checked " + report.accounts_checked + " accounts at " + when(report.checked_at) + ": " +
+      report.accounts_failed + " diverge, " + report.orphaned_accounts + " missing accounts referenced by transactions."),
+    table(["Finding", "Account", "Detail", "Suggested repairs"],
+      report.findings.map((f) => el("tr", {},
+        el("td", {}, f.kind),
+        el("td", {}, f.account_id ? link("/tenants/" + enc(f.tenant_id) + "/accounts/" + enc(f.account_id), f.account_id) : ""),
+        el("td", {}, f.detail),
+        el("td", {}, f.repairs.map((r) => el("div", {}, r.action + (r.safe ? " (safe)" : "") + ": " + r.detail)))))),
+    el("p", {}, "Repairs are applied with cmd/consistency -apply."),
+  ];
+}
+
+async function route() {
+  status.textContent = "";
+  signin.hidden = !!token();
+  signout.hidden = !token();
+  view.replaceChildren();
+  if (!token()) {
+    return;
+  }
+
+  const [path, query] = (location.hash.slice(1) || "/accounts").split("?");
+  const params = new URLSearchParams(query);
+  const parts = path.split("/").filter(Boolean).map(decodeURIComponent);
+  try {
+    let content;
+    if (parts[0] === "tenants" && parts[2] === "accounts") {
+      content = await account(parts[1], parts[3]);
+    } else if (parts[0] === "tenants" && parts[2] === "transactions") {
+      content = await transaction(parts[1], parts[3]);
+    } else if (parts[0] === "queues") {
+      content = await queue(parts[1]);
+    } else if (parts[0] === "reconciliation") {
+      content = await reconciliation(params);
+    } else {
+      content = await accounts(params);
+    }
+    view.replaceChildren(...content);
+  } catch (err) {
+    status.textContent = err.message;
+  }
+}
+
+signin.addEventListener("submit", (event) => {
+  event.preventDefault();
+  sessionStorage.setItem("adminToken", document.getElementById("token").value);
+  document.getElementById("token").value = "";
+  route();
+});
+
+signout.addEventListener("click", () => {
+  sessionStorage.removeItem("adminToken");
+  route();
+});
+
+window.addEventListener("hashchange", route);
+route();
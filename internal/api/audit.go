@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// most audit events one page returns
+const maxAuditPage = 500
+
+// auditEvent describes the request for the audit log; the credential is a fingerprint, and empty when the
+// request presented none
+func (h *Handler) auditEvent(r *http.Request, status int, reason string) *models.AuditEvent {
+	event := &models.AuditEvent{
+		Actor:     reqctx.FromContext(r.Context()).Actor,
+		Source:    h.clientIP(r),
+		Method:    r.Method,
+		Route:     strings.TrimPrefix(routeName(r), r.Method+" "),
+		Status:    status,
+		Reason:    reason,
+		RequestID: reqctx.FromContext(r.Context()).RequestID,
+	}
+	event.TenantID, _ = tenant.FromContext(r.Context())
+	if credentials(r) != "" || r.Header.Get("X-Admin-Token") != "" {
+		event.Credential = clientKey(r)
+	}
+	return event
+}
+
+// auditAuthFailure records a request refused for its credentials
+func (h *Handler) auditAuthFailure(r *http.Request, status int, reason string) {
+	if h.audit != nil {
+		h.audit.AuthFailed(r.Context(), h.auditEvent(r, status, reason))
+	}
+}
+
+// auditAddressDenied records credentials that authenticated but were used from outside their tenant's allowlist
+func (h *Handler) auditAddressDenied(r *http.Request, c *caller) {
+	if h.audit == nil {
+		return
+	}
+	event := h.auditEvent(r, http.StatusForbidden, errAddressNotAllowed.Error())
+	event.TenantID, event.Actor, event.Credential = c.tenantID, c.actor, clientKey(r)
+	h.audit.Denied(r.Context(), event)
+}
+
+// clientIP is the address a request came from: the last X-Forwarded-For hop when the API sits behind a proxy
+// trusted to append one, the connection's peer otherwise
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.config.TrustForwardedFor {
+		if hops := r.Header.Values("X-Forwarded-For"); len(hops) > 0 {
+			last := hops[len(hops)-1]
+			if ip := strings.TrimSpace(last[strings.LastIndex(last, ",")+1:]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// the error code a request was answered with, noted by errorBody for auditMiddleware
+type errorCodeKey struct{}
+
+// notes the code of the error a request is answered with, when auditMiddleware is watching it
+func noteErrorCode(r *http.Request, code string) {
+	if noted, ok := r.Context().Value(errorCodeKey{}).(*string); ok {
+		*noted = code
+	}
+}
+
+// auditMiddleware records the tenant requests refused with 403, and counts those for accounts the caller
+// doesn't have towards account probing, as well as 404s for the route's account itself; a 404 for something
+// under an account that exists, like one of its transactions, is no probe
+func (h *Handler) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.audit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var code string
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), errorCodeKey{}, &code)))
+
+		if sw.status != http.StatusForbidden && sw.status != http.StatusNotFound {
+			return
+		}
+		event := h.auditEvent(r, sw.status, "")
+		event.Credential = clientKey(r)
+		if sw.status == http.StatusForbidden {
+			h.audit.Denied(r.Context(), event)
+		}
+		if accountID := routeAccountID(r); accountID != "" && missedAccount(sw.status, code) {
+			h.audit.MissedAccount(r.Context(), event, accountID)
+		}
+	})
+}
+
+// missedAccount reports whether a refusal means the caller doesn't have the route's account
+func missedAccount(status int, code string) bool {
+	return status == http.StatusForbidden || code == db.ErrAccountNotFound.Code()
+}
+
+// routeAccountID is the account a request's route addresses, empty for routes that aren't an account's
+func routeAccountID(r *http.Request) string {
+	vars := mux.Vars(r)
+	if id := vars["accountId"]; id != "" {
+		return id
+	}
+	if strings.HasPrefix(strings.TrimPrefix(routeName(r), r.Method+" "), "/accounts/{id}") {
+		return vars["id"]
+	}
+	return ""
+}
+
+// statusWriter remembers the status a handler responded with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// GetAuditEvents handles listing recorded authentication failures, denials, account probes and alerts, most
+// recent first
+func (h *Handler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Kind:       models.AuditKind(query.Get("kind")),
+		TenantID:   query.Get("tenant_id"),
+		Credential: query.Get("credential"),
+		Source:     query.Get("source"),
+	}
+	if filter.Kind != "" && !filter.Kind.Valid() {
+		respondError(w, r, http.StatusBadRequest, errInvalidAuditKind)
+		return
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidSince)
+			return
+		}
+		filter.Since = t
+	}
+
+	limit, offset := pageParams(r, 100)
+	if limit > maxAuditPage {
+		limit = maxAuditPage
+	}
+	events, err := h.audit.List(r.Context(), filter, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(events))
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	respondPage(w, r, events, page)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateAuthorization handles a card processor's authorization request
+// approvals answer 201; declines and holds that missed the budget answer 402 with the authorization and its reason
+func (h *Handler) CreateAuthorization(w http.ResponseWriter, r *http.Request) {
+	var req models.AuthorizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	authorization, err := h.authorizations.Authorize(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	switch authorization.Status {
+	case models.AuthorizationDeclined, models.AuthorizationTimedOut:
+		respondJSON(w, http.StatusPaymentRequired, authorization)
+	default:
+		respondJSON(w, http.StatusCreated, authorization)
+	}
+}
+
+// GetAuthorization handles authorization retrieval
+func (h *Handler) GetAuthorization(w http.ResponseWriter, r *http.Request) {
+	authorization, err := h.authorizations.GetAuthorization(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, authorization)
+}
+
+// CaptureAuthorization handles capturing all or part of an approved authorization
+func (h *Handler) CaptureAuthorization(w http.ResponseWriter, r *http.Request) {
+	var req models.CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	authorization, err := h.authorizations.Capture(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, authorization)
+}
+
+// ReleaseAuthorization handles voiding an approved authorization before capture
+func (h *Handler) ReleaseAuthorization(w http.ResponseWriter, r *http.Request) {
+	authorization, err := h.authorizations.Release(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, authorization)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// GetCalendars handles listing the calendars with holidays of their own
+func (h *Handler) GetCalendars(w http.ResponseWriter, r *http.Request) {
+	calendars, err := h.calendars.GetCalendars(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, calendars)
+}
+
+// GetCalendar handles retrieving a calendar's holidays
+func (h *Handler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	calendar, err := h.calendars.GetCalendar(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, calendar)
+}
+
+// ReplaceCalendar handles replacing a calendar's holidays
+func (h *Handler) ReplaceCalendar(w http.ResponseWriter, r *http.Request) {
+	var req models.CalendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	calendar, err := h.calendars.ReplaceCalendar(r.Context(), mux.Vars(r)["code"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, calendar)
+}
+
+// CheckBusinessDay handles checking whether a date is a business day in a calendar
+func (h *Handler) CheckBusinessDay(w http.ResponseWriter, r *http.Request) {
+	day, err := h.calendars.CheckDay(r.Context(), mux.Vars(r)["code"], r.URL.Query().Get("date"))
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, day)
+}
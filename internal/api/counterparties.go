@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateCounterparty handles adding a counterparty to the tenant's directory
+func (h *Handler) CreateCounterparty(w http.ResponseWriter, r *http.Request) {
+	var req models.CounterpartyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	counterparty, err := h.counterparties.CreateCounterparty(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, counterparty)
+}
+
+// ListCounterparties handles directory listing, filtered by identifier.<key>=value parameters
+func (h *Handler) ListCounterparties(w http.ResponseWriter, r *http.Request) {
+	identifiers := make(map[string]string)
+	for param, values := range r.URL.Query() {
+		if key := strings.TrimPrefix(param, "identifier."); key != param && key != "" && len(values) > 0 {
+			identifiers[key] = values[0]
+		}
+	}
+
+	limit, offset := pageParams(r, 50)
+	counterparties, err := h.counterparties.FindCounterparties(r.Context(), identifiers, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(counterparties))
+	if len(counterparties) > limit {
+		counterparties = counterparties[:limit]
+	}
+
+	respondPage(w, r, counterparties, page)
+}
+
+// GetCounterparty handles counterparty retrieval
+func (h *Handler) GetCounterparty(w http.ResponseWriter, r *http.Request) {
+	counterparty, err := h.counterparties.GetCounterparty(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, counterparty)
+}
+
+// UpdateCounterparty handles renaming a counterparty, replacing its identifiers or changing its risk rating
+func (h *Handler) UpdateCounterparty(w http.ResponseWriter, r *http.Request) {
+	var req models.CounterpartyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	counterparty, err := h.counterparties.UpdateCounterparty(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, counterparty)
+}
+
+// GetCounterpartyReport handles the completed activity per counterparty for an inclusive date range
+func (h *Handler) GetCounterpartyReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidFromDate)
+		return
+	}
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidToDate)
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+
+	report, err := h.counterparties.GetActivity(r.Context(), query.Get("counterparty_id"), from, to)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
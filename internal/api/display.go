@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// displayer fills in the display objects of responses when the client asked for them with display=true
+type displayer struct {
+	h       *Handler
+	r       *http.Request
+	enabled bool
+	locale  string
+	// currencies caches account currencies by account id for transaction responses
+	currencies map[string]string
+}
+
+// returns the displayer for a request; it does nothing unless display=true was sent
+func (h *Handler) displayer(r *http.Request) *displayer {
+	enabled, _ := strconv.ParseBool(r.URL.Query().Get("display"))
+	return &displayer{
+		h:          h,
+		r:          r,
+		enabled:    enabled,
+		locale:     i18n.Negotiate(r.Header.Get("Accept-Language")),
+		currencies: map[string]string{},
+	}
+}
+
+// adds display objects for an account's balance, breakdown and activity totals
+func (d *displayer) account(response *models.AccountResponse) {
+	if !d.enabled {
+		return
+	}
+	display := map[string]models.MoneyDisplay{"balance": d.format(response.Balance, response.Currency)}
+	if b := response.BalanceBreakdown; b != nil {
+		display["balance_breakdown.cash"] = d.format(b.Cash, response.Currency)
+		display["balance_breakdown.credits"] = d.format(b.Credits, response.Currency)
+	}
+	if a := response.Activity; a != nil {
+		display["activity.total_deposits"] = d.format(a.TotalDeposits, response.Currency)
+		display["activity.total_withdrawals"] = d.format(a.TotalWithdrawals, response.Currency)
+	}
+	response.Display = display
+}
+
+// adds display objects for a transaction's amounts in its account's currency
+// transactions whose account can't be read are left without them
+func (d *displayer) transaction(response *models.TransactionResponse) {
+	if !d.enabled {
+		return
+	}
+	currency, ok := d.currencies[response.AccountID]
+	if !ok {
+		account, err := d.h.accountService.GetAccount(d.r.Context(), response.AccountID)
+		if err == nil {
+			currency = account.Currency
+		}
+		d.currencies[response.AccountID] = currency
+	}
+	if currency == "" {
+		return
+	}
+
+	display := map[string]models.MoneyDisplay{"amount": d.format(response.Amount, currency)}
+	if response.Fee != 0 {
+		display["fee"] = d.format(response.Fee, currency)
+	}
+	if response.BalanceBefore != 0 || response.BalanceAfter != 0 {
+		display["balance_before"] = d.format(response.BalanceBefore, currency)
+		display["balance_after"] = d.format(response.BalanceAfter, currency)
+	}
+	response.Display = display
+}
+
+// adds display objects to every transaction of a list
+func (d *displayer) transactions(responses []models.TransactionResponse) {
+	for i := range responses {
+		d.transaction(&responses[i])
+	}
+}
+
+func (d *displayer) format(amount float64, currency string) models.MoneyDisplay {
+	return models.MoneyDisplay{
+		Formatted: money.Format(amount, currency, d.locale),
+		Symbol:    money.Symbol(currency),
+		Currency:  currency,
+		Exponent:  money.Exponent(currency),
+	}
+}
+
+// converts a transaction to its API representation, with display objects when asked for
+func (h *Handler) transactionResponse(r *http.Request, tx *models.Transaction) models.TransactionResponse {
+	response := newTransactionResponse(tx)
+	h.displayer(r).transaction(&response)
+	return response
+}
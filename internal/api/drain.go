@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Drain coordinates a graceful API shutdown: readiness flips as soon as draining starts,
+// in-flight requests are tracked so they can finish, and requests arriving past the deadline are refused
+type Drain struct {
+	draining int32
+	refusing int32
+
+	mu       sync.Mutex
+	inFlight int
+	idle     chan struct{}
+}
+
+// creates a new Drain in the serving state
+func NewDrain() *Drain {
+	return &Drain{}
+}
+
+// Start marks the API not ready; requests are still served but connections are closed after each response
+func (d *Drain) Start() {
+	atomic.StoreInt32(&d.draining, 1)
+}
+
+// Refuse answers every new request with 503, for use once the drain deadline has passed
+func (d *Drain) Refuse() {
+	atomic.StoreInt32(&d.draining, 1)
+	atomic.StoreInt32(&d.refusing, 1)
+}
+
+// Draining reports whether Start has been called
+func (d *Drain) Draining() bool {
+	return atomic.LoadInt32(&d.draining) == 1
+}
+
+// Wait blocks until no request is in flight or ctx is done
+func (d *Drain) Wait(ctx context.Context) error {
+	d.mu.Lock()
+	if d.inFlight == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight returns the number of requests being served
+func (d *Drain) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inFlight
+}
+
+func (d *Drain) begin() {
+	d.mu.Lock()
+	d.inFlight++
+	d.mu.Unlock()
+}
+
+func (d *Drain) end() {
+	d.mu.Lock()
+	d.inFlight--
+	if d.inFlight == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+	d.mu.Unlock()
+}
+
+// Middleware tracks in-flight requests and applies the drain state to new ones
+func (d *Drain) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Draining() {
+			w.Header().Set("Connection", "close")
+		}
+		if atomic.LoadInt32(&d.refusing) == 1 {
+			w.Header().Set("Retry-After", "5")
+			respondError(w, r, http.StatusServiceUnavailable, errShuttingDown)
+			return
+		}
+
+		d.begin()
+		defer d.end()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Ready serves the readiness check load balancers route on
+func (d *Drain) Ready(w http.ResponseWriter, r *http.Request) {
+	if d.Draining() {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// Shutdown drains server: readiness flips immediately, requests keep being served for delay so load
+// balancers can stop routing here, then new requests are refused while in-flight ones get up to timeout to
+// finish before the server itself is shut down
+func (d *Drain) Shutdown(server *http.Server, delay, timeout time.Duration) error {
+	d.Start()
+	time.Sleep(delay)
+
+	d.Refuse()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// an unfinished drain still shuts down; Shutdown below waits out what's left within the same deadline
+	_ = d.Wait(ctx)
+
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,42 @@
+package api
+
+import "github.com/abkawan/banking-ledger/internal/i18n"
+
+// the errors handlers respond with themselves; each has a catalog key, so its code and translations never depend
+// on its English text
+var (
+	errInvalidPayload           = i18n.NewError("error.invalid_request_payload", "invalid request payload")
+	errAccountNotFound          = i18n.NewError("error.account_not_found", "Account not found")
+	errCounterpartyNotFound     = i18n.NewError("error.counterparty_not_found", "Counterparty account not found")
+	errTransactionNotFound      = i18n.NewError("error.transaction_not_found", "Transaction not found")
+	errSweepRuleNotFound        = i18n.NewError("error.sweep_rule_not_found", "Sweep rule not found")
+	errEscrowNotFound           = i18n.NewError("error.escrow_not_found", "Escrow not found")
+	errAccountNotPaused         = i18n.NewError("error.account_not_paused", "Account is not paused")
+	errInvalidFromDate          = i18n.NewError("error.invalid_from_date", "from must be a date in YYYY-MM-DD format")
+	errInvalidToDate            = i18n.NewError("error.invalid_to_date", "to must be a date in YYYY-MM-DD format")
+	errSystemAccount            = i18n.NewError("error.system_account", "system accounts cannot be used directly")
+	errSameCounterparty         = i18n.NewError("error.same_counterparty", "transfer requires a different counterparty_account_id")
+	errCurrencyMismatch         = i18n.NewError("error.currency_mismatch", "transfer accounts must share a currency")
+	errAccountFilterRequired    = i18n.NewError("error.account_filter_required", "external_reference or a metadata.<key> filter is required")
+	errInvalidWindow            = i18n.NewError("error.invalid_window", "invalid window")
+	errInvalidGracePeriod       = i18n.NewError("error.invalid_grace_period", "invalid grace_period")
+	errInvalidStep              = i18n.NewError("error.invalid_step", "invalid step")
+	errKYCCallbackFields        = i18n.NewError("error.kyc_callback_fields_required", "tenant_id and account_id are required")
+	errKYCCallbackDisabled      = i18n.NewError("error.kyc_callback_disabled", "kyc callback disabled")
+	errMissingCredentials       = i18n.NewError("error.missing_credentials", "missing credentials")
+	errInvalidToken             = i18n.NewError("error.invalid_token", "invalid token")
+	errInvalidAdminToken        = i18n.NewError("error.invalid_admin_token", "invalid admin token")
+	errAdminDisabled            = i18n.NewError("error.admin_disabled", "admin api disabled")
+	errShuttingDown             = i18n.NewError("error.shutting_down", "server is shutting down")
+	errRateLimited              = i18n.NewError("error.rate_limited", "rate limit exceeded")
+	errRateLimitsDisabled       = i18n.NewError("error.rate_limits_disabled", "rate limiting disabled")
+	errTenantIDRequired         = i18n.NewError("error.tenant_id_required", "tenant_id is required")
+	errWebsocketUpgradeRequired = i18n.NewError("error.websocket_upgrade_required", "websocket upgrade required")
+	errInvalidMessage           = i18n.NewError("error.invalid_message", "invalid message")
+	errAlreadyAuthenticated     = i18n.NewError("error.already_authenticated", "already authenticated")
+	errUnknownMessageType       = i18n.NewError("error.unknown_message_type", "unknown message type")
+	errPlatformRequiresAdmin    = i18n.NewError("error.platform_requires_admin", "platform updates require the admin token")
+	errInvalidAuditKind         = i18n.NewError("error.invalid_audit_kind", "invalid audit kind")
+	errInvalidSince             = i18n.NewError("error.invalid_since", "since must be an RFC 3339 timestamp")
+	errReplicationNotConfigured = i18n.NewError("error.replication_not_configured", "replication not configured")
+)
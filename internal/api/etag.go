@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+)
+
+// etag derives a weak entity tag from a resource's id and last update, and the request options that change how
+// it is rendered; every change to a resource bumps its updated_at, so the tag changes with it
+func etag(r *http.Request, id string, updatedAt time.Time) string {
+	display, _ := strconv.ParseBool(r.URL.Query().Get("display"))
+	parts := []string{id, strconv.FormatInt(updatedAt.UnixNano(), 10)}
+	if display {
+		parts = append(parts, "display", i18n.Negotiate(r.Header.Get("Accept-Language")))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// notModified sets the response's ETag and Last-Modified and, when the client's If-None-Match already names the
+// tag, answers 304 and reports true so the handler can skip building the body
+func notModified(w http.ResponseWriter, r *http.Request, tag string, updatedAt time.Time) bool {
+	setVersion(w, tag, updatedAt)
+	if matchesTag(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// setVersion sets the headers a client sends back to make a later read or write conditional
+func setVersion(w http.ResponseWriter, tag string, updatedAt time.Time) {
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+}
+
+// matchesTag reports whether a list of entity tags, such as an If-None-Match header, names tag or is "*"
+// tags compare weakly, so W/"x" and "x" are the same tag
+func matchesTag(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// conditional reports whether an update carries If-Match or If-Unmodified-Since
+func conditional(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != ""
+}
+
+// ifUnmodified checks an update's If-Match, or else its If-Unmodified-Since, against the resource's current version
+// and answers 412 when the resource changed since; otherwise it returns ctx with the version the write must still
+// find, so an edit that races another one fails the same way
+func ifUnmodified(ctx context.Context, w http.ResponseWriter, r *http.Request, tag string, updatedAt time.Time) (context.Context, bool) {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !matchesTag(match, tag) {
+			setVersion(w, tag, updatedAt)
+			respondError(w, r, http.StatusPreconditionFailed, db.ErrModified)
+			return nil, false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil {
+		// HTTP dates have whole seconds, so a change within the same second as the date still counts as unmodified
+		if updatedAt.Truncate(time.Second).After(since) {
+			setVersion(w, tag, updatedAt)
+			respondError(w, r, http.StatusPreconditionFailed, db.ErrModified)
+			return nil, false
+		}
+	}
+	return db.IfVersion(ctx, updatedAt), true
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// GetExceptions handles listing a tenant's deposits parked in the suspense account, optionally by status
+func (h *Handler) GetExceptions(w http.ResponseWriter, r *http.Request) {
+	status := models.ExceptionStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.ExceptionOpen, models.ExceptionReassigned, models.ExceptionRefunded:
+	default:
+		respondError(w, r, http.StatusBadRequest, errors.New("invalid status"))
+		return
+	}
+	limit, offset := pageParams(r, 50)
+
+	exceptions, err := h.exceptions.GetExceptions(tenant.WithTenant(r.Context(), mux.Vars(r)["tenantId"]), status, limit+1, offset)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(exceptions))
+	if len(exceptions) > limit {
+		exceptions = exceptions[:limit]
+	}
+
+	respondPage(w, r, exceptions, page)
+}
+
+// GetException handles exception retrieval
+func (h *Handler) GetException(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	exception, err := h.exceptions.GetException(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, exception)
+}
+
+// ReassignException handles crediting an exception's funds to another account
+func (h *Handler) ReassignException(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.ReassignExceptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AccountID == "" {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	exception, err := h.exceptions.Reassign(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, exception)
+}
+
+// RefundException handles paying an exception's funds back to the sender
+func (h *Handler) RefundException(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	exception, err := h.exceptions.Refund(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, exception)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateExport handles queueing an export to be built in the background
+func (h *Handler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	job, err := h.exports.CreateExport(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	w.Header().Set("Location", "/exports/"+job.ID)
+	respondJSON(w, http.StatusAccepted, job)
+}
+
+// GetExport handles checking an export's progress
+func (h *Handler) GetExport(w http.ResponseWriter, r *http.Request) {
+	job, err := h.exports.GetExport(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
+
+// DownloadExport handles downloading a completed export, redirecting to a signed URL when it is in object storage
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	artifact, err := h.exports.GetArtifact(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	if artifact.URL != "" {
+		http.Redirect(w, r, artifact.URL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", artifact.Filename))
+	setContentDigest(w, artifact.Checksum)
+	w.WriteHeader(http.StatusOK)
+	w.Write(artifact.Content)
+}
+
+// setContentDigest sends the SHA-256 of a download (RFC 9530), for clients to check what they received
+func setContentDigest(w http.ResponseWriter, checksum string) {
+	sum, err := hex.DecodeString(checksum)
+	if err != nil || len(sum) != sha256.Size {
+		return
+	}
+	w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateTransactionGroup handles creating a multi-leg transaction whose legs are applied together
+func (h *Handler) CreateTransactionGroup(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+	for _, leg := range req.Legs {
+		if !h.checkTransactionAccounts(w, r, &models.TransactionRequest{
+			AccountID:             leg.AccountID,
+			Type:                  leg.Type,
+			CounterpartyAccountID: leg.CounterpartyAccountID,
+		}) {
+			return
+		}
+	}
+
+	legs, err := h.transactionService.CreateTransactionGroup(r.Context(), &req)
+	if err != nil {
+		respondTransactionError(w, r, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, h.transactionGroup(r, legs))
+}
+
+// GetTransactionGroup handles retrieving a multi-leg transaction with its legs rolled up
+func (h *Handler) GetTransactionGroup(w http.ResponseWriter, r *http.Request) {
+	legs, err := h.transactionService.GetTransactionGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.transactionGroup(r, legs))
+}
+
+// rolls up the legs of a multi-leg transaction, which come first leg first
+func (h *Handler) transactionGroup(r *http.Request, legs []*models.Transaction) models.TransactionGroup {
+	head := legs[0]
+	group := models.TransactionGroup{
+		ID:          head.GroupID,
+		Reference:   strings.TrimSuffix(head.Reference, ".1"),
+		Status:      head.Status,
+		NetChanges:  make(map[string]float64),
+		Totals:      make(map[models.LegRole]float64),
+		CreatedAt:   head.CreatedAt,
+		CompletedAt: head.CompletedAt,
+	}
+
+	completed := 0
+	for _, leg := range legs {
+		switch leg.Status {
+		case models.Completed:
+			completed++
+		case models.Failed:
+			group.Status, group.FailureReason = models.Failed, leg.FailureReason
+		}
+
+		group.Fees += leg.Fee
+		switch leg.Type {
+		case models.Deposit:
+			group.NetChanges[leg.AccountID] += leg.Amount - leg.Fee
+		case models.Transfer:
+			group.NetChanges[leg.AccountID] -= leg.Amount + leg.Fee
+			group.NetChanges[leg.CounterpartyAccountID] += leg.Amount
+		default:
+			group.NetChanges[leg.AccountID] -= leg.Amount + leg.Fee
+		}
+		group.Totals[leg.LegRole] += leg.Amount
+		group.Legs = append(group.Legs, h.transactionResponse(r, leg))
+	}
+	group.Relationships = legRelationships(legs)
+	if completed == len(legs) {
+		group.Status = models.Completed
+	}
+
+	group.Fees = roundSum(group.Fees)
+	for id, change := range group.NetChanges {
+		group.NetChanges[id] = roundSum(change)
+	}
+	for role, total := range group.Totals {
+		group.Totals[role] = roundSum(total)
+	}
+	return group
+}
+
+// lists, for each leg other legs relate to, those legs by role, in leg order
+func legRelationships(legs []*models.Transaction) []models.LegRelationship {
+	var relationships []models.LegRelationship
+	index := make(map[int]int)
+	for _, leg := range legs {
+		if leg.RelatedLeg == 0 {
+			continue
+		}
+		i, ok := index[leg.RelatedLeg]
+		if !ok {
+			i = len(relationships)
+			index[leg.RelatedLeg] = i
+			relationships = append(relationships, models.LegRelationship{Leg: leg.RelatedLeg, Related: make(map[models.LegRole][]int)})
+		}
+		relationships[i].Related[leg.LegRole] = append(relationships[i].Related[leg.LegRole], leg.Leg)
+	}
+	sort.Slice(relationships, func(a, b int) bool { return relationships[a].Leg < relationships[b].Leg })
+	return relationships
+}
+
+// amounts have at most four decimal places, ISO 4217's largest minor unit, so sums are rounded back to them
+func roundSum(sum float64) float64 {
+	return math.Round(sum*1e4) / 1e4
+}
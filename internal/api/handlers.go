@@ -1,26 +1,134 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/compliance"
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/export"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/metrics"
 	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/notify"
+	"github.com/abkawan/banking-ledger/internal/openbanking"
+	"github.com/abkawan/banking-ledger/internal/ratelimit"
 	"github.com/abkawan/banking-ledger/internal/service"
+	"github.com/abkawan/banking-ledger/internal/tenant"
 	"github.com/gorilla/mux"
 )
 
+// Services bundles the business services exposed by the API
+type Services struct {
+	Accounts       *service.AccountService
+	Transactions   *service.TransactionService
+	Reports        *service.ReportService
+	Compliance     *service.ComplianceService
+	Notifications  *service.NotificationService
+	Sweeps         *service.SweepService
+	Tenants        *service.TenantService
+	Escrows        *service.EscrowService
+	Credits        *service.CreditService
+	Statements     *service.StatementService
+	Documents      *service.DocumentService
+	Maintenance    *service.MaintenanceService
+	Sandbox        *service.SandboxService
+	PlatformStats  *service.PlatformStatsService
+	Authorizations *service.AuthorizationService
+	Counterparties *service.CounterpartyService
+	Rules          *service.RuleService
+	Exceptions     *service.ExceptionService
+	Calendars      *service.CalendarService
+	Periods        *service.PeriodService
+	Templates      *service.TemplateService
+	Exports        *service.ExportService
+	Live           *service.LiveService
+	Audit          *service.AuditService
+
+	// Replication is the region's part in active-passive replication, when configured
+	Replication *service.ReplicationService
+
+	// RateLimiter limits tenant requests when set
+	RateLimiter *ratelimit.Limiter
+
+	// OpenBanking is mounted alongside the native API when set
+	OpenBanking *openbanking.Handler
+}
+
 // Handler is for handling api requests
 type Handler struct {
-	accountService     *service.AccountService
-	transactionService *service.TransactionService
+	accountService      *service.AccountService
+	transactionService  *service.TransactionService
+	reportService       *service.ReportService
+	complianceService   *service.ComplianceService
+	notificationService *service.NotificationService
+	sweepService        *service.SweepService
+	tenantService       *service.TenantService
+	escrowService       *service.EscrowService
+	creditService       *service.CreditService
+	statementService    *service.StatementService
+	documentService     *service.DocumentService
+	maintenanceService  *service.MaintenanceService
+	sandboxService      *service.SandboxService
+	platformStats       *service.PlatformStatsService
+	authorizations      *service.AuthorizationService
+	counterparties      *service.CounterpartyService
+	rules               *service.RuleService
+	exceptions          *service.ExceptionService
+	calendars           *service.CalendarService
+	periods             *service.PeriodService
+	templates           *service.TemplateService
+	exports             *service.ExportService
+	live                *service.LiveService
+	audit               *service.AuditService
+	replication         *service.ReplicationService
+	rateLimiter         *ratelimit.Limiter
+	recentWriters       *recentWriters
+	config              Config
 }
 
-func NewHandler(accountService *service.AccountService, transactionService *service.TransactionService) *Handler {
-	return &Handler{
-		accountService:     accountService,
-		transactionService: transactionService,
+func NewHandler(services Services, config Config) *Handler {
+	h := &Handler{
+		accountService:      services.Accounts,
+		transactionService:  services.Transactions,
+		reportService:       services.Reports,
+		complianceService:   services.Compliance,
+		notificationService: services.Notifications,
+		sweepService:        services.Sweeps,
+		tenantService:       services.Tenants,
+		escrowService:       services.Escrows,
+		creditService:       services.Credits,
+		statementService:    services.Statements,
+		documentService:     services.Documents,
+		maintenanceService:  services.Maintenance,
+		sandboxService:      services.Sandbox,
+		platformStats:       services.PlatformStats,
+		authorizations:      services.Authorizations,
+		counterparties:      services.Counterparties,
+		rules:               services.Rules,
+		exceptions:          services.Exceptions,
+		calendars:           services.Calendars,
+		periods:             services.Periods,
+		templates:           services.Templates,
+		exports:             services.Exports,
+		live:                services.Live,
+		audit:               services.Audit,
+		replication:         services.Replication,
+		rateLimiter:         services.RateLimiter,
+		config:              config,
+	}
+	if config.ReplicaStickiness > 0 {
+		h.recentWriters = newRecentWriters(config.ReplicaStickiness)
 	}
+	return h
 }
 
 // respondJSON sends a JSON response
@@ -30,32 +138,215 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// for error response
-func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+// respondPDF sends a rendered document inline
+func respondPDF(w http.ResponseWriter, filename string, pdf []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// wantsPDF reports whether the client asked for a PDF rendering of the resource
+func wantsPDF(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == "application/pdf" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// for error response; the message is translated for Accept-Language and paired with a code that never changes
+func respondError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	respondJSON(w, status, errorBody(w, r, status, err))
+}
+
+// errorBody is the translated error payload, for handlers that add fields before responding
+func errorBody(w http.ResponseWriter, r *http.Request, status int, err error) map[string]string {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	code, text, ok := i18n.Translate(locale, err)
+	if !ok {
+		code = codeForStatus(status)
+	}
+	noteErrorCode(r, code)
+	w.Header().Set("Content-Language", locale)
+	return map[string]string{"error": text, "code": code}
+}
+
+// codeForStatus is the code of errors whose message isn't in the catalog
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusNotAcceptable:
+		return "not_acceptable"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusPreconditionFailed:
+		return "precondition_failed"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "internal_error"
+	}
+}
+
+// maps service errors that describe a rejected request rather than a failure
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, service.ErrLimitExceeded), errors.Is(err, service.ErrResolutionFailed):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrNotAllowed), errors.Is(err, service.ErrKYCRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrInvalidReference), errors.Is(err, service.ErrInvalidMetadata),
+		errors.Is(err, service.ErrInvalidRule), errors.Is(err, service.ErrInvalidCalendar), errors.Is(err, service.ErrInvalidPostingDate),
+		errors.Is(err, service.ErrInvalidPeriod), errors.Is(err, service.ErrInvalidTemplate), errors.Is(err, service.ErrInvalidQuote),
+		errors.Is(err, service.ErrInvalidTransactionGroup), errors.Is(err, service.ErrInvalidLookup),
+		errors.Is(err, service.ErrInvalidExport), errors.Is(err, service.ErrInvalidFundingDeadline), errors.Is(err, service.ErrInvalidAuthorization),
+		errors.Is(err, service.ErrInvalidReport), errors.Is(err, service.ErrInvalidCounterparty), errors.Is(err, service.ErrInvalidEscrow),
+		errors.Is(err, service.ErrInvalidCreditGrant), errors.Is(err, service.ErrInvalidClockAdvance), errors.Is(err, service.ErrInvalidStatementPreferences):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNotFlagged), errors.Is(err, service.ErrNotInReview), errors.Is(err, service.ErrEscrowNotFunded), errors.Is(err, service.ErrEscrowClosed),
+		errors.Is(err, service.ErrAuthorizationClosed), errors.Is(err, service.ErrDuplicateReference), errors.Is(err, service.ErrReferenceConflict),
+		errors.Is(err, service.ErrExceptionResolved), errors.Is(err, service.ErrPeriodClosed), errors.Is(err, service.ErrQuoteExpired),
+		errors.Is(err, service.ErrQuoteUsed), errors.Is(err, service.ErrExportNotReady), errors.Is(err, service.ErrResolutionPending):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrAccountNotFound), errors.Is(err, service.ErrAuthorizationNotFound), errors.Is(err, service.ErrCounterpartyNotFound),
+		errors.Is(err, service.ErrWebhookSubscriptionNotFound), errors.Is(err, service.ErrRuleNotFound),
+		errors.Is(err, service.ErrExceptionNotFound), errors.Is(err, service.ErrTemplateNotFound), errors.Is(err, service.ErrQuoteNotFound),
+		errors.Is(err, service.ErrTransactionGroupNotFound), errors.Is(err, service.ErrExportNotFound),
+		errors.Is(err, service.ErrStatementNotArchived),
+		errors.Is(err, service.ErrQueueNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrModified):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrIngestionUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, service.ErrRenderUnavailable):
+		return http.StatusNotAcceptable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// converts an account to its API representation
+func newAccountResponse(account *models.Account) models.AccountResponse {
+	return models.AccountResponse{
+		ID:        account.ID,
+		Kind:      account.Kind,
+		Currency:  account.Currency,
+		Balance:   account.Balance,
+		KYCStatus: account.KYCStatus,
+		CreatedAt: account.CreatedAt,
+
+		ExternalReference: account.ExternalReference,
+		Metadata:          account.Metadata,
+	}
+}
+
+// converts a transaction to its API representation
+func newTransactionResponse(tx *models.Transaction) models.TransactionResponse {
+	response := models.TransactionResponse{
+		ID:                    tx.ID,
+		AccountID:             tx.AccountID,
+		Type:                  tx.Type,
+		Amount:                tx.Amount,
+		Fee:                   tx.Fee,
+		Status:                tx.Status,
+		FailureReason:         tx.FailureReason,
+		CounterpartyAccountID: tx.CounterpartyAccountID,
+		CounterpartyID:        tx.CounterpartyID,
+		Metadata:              tx.Metadata,
+		DuplicateOf:           tx.DuplicateOf,
+		CreditExpiresAt:       tx.CreditExpiresAt,
+		BackDated:             tx.BackDated,
+		QuoteID:               tx.QuoteID,
+		GroupID:               tx.GroupID,
+		Leg:                   tx.Leg,
+		LegRole:               tx.LegRole,
+		RelatedLeg:            tx.RelatedLeg,
+		BalanceBefore:         tx.BalanceBefore,
+		BalanceAfter:          tx.BalanceAfter,
+		Enrichment:            tx.Enrichment,
+		CreatedAt:             tx.CreatedAt,
+		CompletedAt:           tx.CompletedAt,
+		FundingMode:           tx.FundingMode,
+		FundingDeadline:       tx.FundingDeadline,
+		RetryOnFunding:        tx.RetryOnFunding,
+	}
+	if tx.ValueDate != nil {
+		response.ValueDate = tx.ValueDate.Format(calendar.DateLayout)
+	}
+	return response
 }
 
 // account creation
 func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateAccountRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid request payload")
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
 		return
 	}
 
-	account, err := h.accountService.CreateAccount(r.Context(), req.InitialBalance)
+	account, err := h.accountService.CreateAccount(r.Context(), req)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, r, statusForError(err), err)
 		return
 	}
 
-	response := models.AccountResponse{
-		ID:        account.ID,
-		Balance:   account.Balance,
-		CreatedAt: account.CreatedAt,
+	response := newAccountResponse(account)
+	h.displayer(r).account(&response)
+	respondJSON(w, http.StatusCreated, response)
+}
+
+// FindAccounts handles looking accounts up by external_reference and metadata.<key>=<value> query parameters
+func (h *Handler) FindAccounts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	externalReference := query.Get("external_reference")
+	metadata := make(map[string]string)
+	for param, values := range query {
+		if key := strings.TrimPrefix(param, "metadata."); key != param && key != "" && len(values) > 0 {
+			metadata[key] = values[0]
+		}
+	}
+	if externalReference == "" && len(metadata) == 0 {
+		respondError(w, r, http.StatusBadRequest, errAccountFilterRequired)
+		return
 	}
 
-	respondJSON(w, http.StatusCreated, response)
+	limit, offset := pageParams(r, 50)
+	accounts, err := h.accountService.FindAccounts(r.Context(), externalReference, metadata, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(accounts))
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+	}
+
+	d := h.displayer(r)
+	response := make([]models.AccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		item := newAccountResponse(account)
+		d.account(&item)
+		response = append(response, item)
+	}
+
+	respondPage(w, r, response, page)
 }
 
 // handles account retrieval
@@ -65,146 +356,1570 @@ func (h *Handler) GetAccount(w http.ResponseWriter, r *http.Request) {
 
 	account, err := h.accountService.GetAccount(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Account not found")
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+	// balance, activity and credit changes all bump the account's updated_at
+	if notModified(w, r, etag(r, account.ID, account.UpdatedAt), account.UpdatedAt) {
 		return
 	}
 
-	response := models.AccountResponse{
-		ID:        account.ID,
-		Balance:   account.Balance,
-		CreatedAt: account.CreatedAt,
+	response := newAccountResponse(account)
+	breakdown, err := h.creditService.GetBreakdown(r.Context(), account)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if len(breakdown.Buckets) > 0 {
+		response.BalanceBreakdown = breakdown
+	}
+
+	if response.Activity, err = h.accountService.GetSummary(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
 	}
 
+	h.displayer(r).account(&response)
 	respondJSON(w, http.StatusOK, response)
 }
 
-// handles transaction creation
-func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
-	var req models.TransactionRequest
+// GrantCredit handles granting a promotional credit to an account
+func (h *Handler) GrantCredit(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.CreditGrantRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
 		return
 	}
 
-	// Validation for account existance.
-	_, err := h.accountService.GetAccount(r.Context(), req.AccountID)
+	account, err := h.accountService.GetAccount(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Account not found")
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+	if account.Kind != models.CustomerAccount {
+		respondError(w, r, http.StatusForbidden, errSystemAccount)
 		return
 	}
 
-	tx, err := h.transactionService.CreateTransaction(r.Context(), &req)
+	tx, err := h.creditService.GrantCredit(r.Context(), id, &req)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, r, statusForError(err), err)
 		return
 	}
 
-	response := models.TransactionResponse{
-		ID:        tx.ID,
-		AccountID: tx.AccountID,
-		Type:      tx.Type,
-		Amount:    tx.Amount,
-		Status:    tx.Status,
-		CreatedAt: tx.CreatedAt,
+	respondJSON(w, http.StatusCreated, h.transactionResponse(r, tx))
+}
+
+// GetNotificationPreferences handles notification preference retrieval
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	prefs, err := h.notificationService.GetPreferences(r.Context(), id)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
 	}
 
-	respondJSON(w, http.StatusCreated, response)
+	respondJSON(w, http.StatusOK, prefs)
 }
 
-// GetTransaction handles transaction retrieval
-func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+// UpdateNotificationPreferences handles notification preference updates
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	tx, err := h.transactionService.GetTransaction(r.Context(), id)
+	var req models.NotificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	if _, err := h.accountService.GetAccount(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	prefs, err := h.notificationService.UpdatePreferences(r.Context(), id, &req)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Transaction not found")
+		respondError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	response := models.TransactionResponse{
-		ID:            tx.ID,
-		AccountID:     tx.AccountID,
-		Type:          tx.Type,
-		Amount:        tx.Amount,
-		Status:        tx.Status,
-		BalanceBefore: tx.BalanceBefore,
-		BalanceAfter:  tx.BalanceAfter,
-		CreatedAt:     tx.CreatedAt,
+	respondJSON(w, http.StatusOK, prefs)
+}
+
+// CreateWebhookSubscription handles subscribing a URL to the tenant's or one account's notification events
+func (h *Handler) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var req models.WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
 	}
 
-	respondJSON(w, http.StatusOK, response)
+	if req.AccountID != "" {
+		if _, err := h.accountService.GetAccount(r.Context(), req.AccountID); err != nil {
+			respondError(w, r, http.StatusNotFound, errAccountNotFound)
+			return
+		}
+	}
+
+	sub, err := h.notificationService.CreateSubscription(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, sub)
 }
 
-// GetTransactions handles transaction list retrieval
-func (h *Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	accountID := vars["accountId"]
+// GetWebhookSubscriptions handles webhook subscription listing, optionally for one account
+func (h *Handler) GetWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.notificationService.GetSubscriptions(r.Context(), r.URL.Query().Get("account_id"))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, subs)
+}
+
+// DeleteWebhookSubscription handles webhook subscription removal
+func (h *Handler) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.notificationService.DeleteSubscription(r.Context(), mux.Vars(r)["id"]); err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStatementPreferences handles statement preference retrieval
+func (h *Handler) GetStatementPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.statementService.GetPreferences(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, prefs)
+}
+
+// UpdateStatementPreferences handles statement preference updates
+func (h *Handler) UpdateStatementPreferences(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.StatementPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	if _, err := h.accountService.GetAccount(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	prefs, err := h.statementService.UpdatePreferences(r.Context(), id, &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, prefs)
+}
+
+// GetFundingPolicy handles retrieval of the insufficient funds policy applied to an account
+func (h *Handler) GetFundingPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.transactionService.GetFundingPolicy(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// UpdateFundingPolicy handles setting an account's own insufficient funds policy
+func (h *Handler) UpdateFundingPolicy(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.InsufficientFundsPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	if _, err := h.accountService.GetAccount(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	policy, err := h.transactionService.UpdateFundingPolicy(r.Context(), id, &req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// DeleteFundingPolicy handles removing an account's own insufficient funds policy
+func (h *Handler) DeleteFundingPolicy(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := h.accountService.GetAccount(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	policy, err := h.transactionService.DeleteFundingPolicy(r.Context(), id)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// GetStatement handles statement retrieval for a date range, rendered as PDF when requested
+func (h *Handler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidFromDate)
+		return
+	}
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidToDate)
+		return
+	}
+	to = to.AddDate(0, 0, 1)
 
-	// Parsing the query parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	account, err := h.accountService.GetAccount(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
 
-	// default limit is set to 10
-	limit := 10
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
+	if wantsPDF(r) {
+		pdf, err := h.documentService.StatementPDF(r.Context(), account, from, to)
+		if err != nil {
+			respondError(w, r, statusForError(err), err)
+			return
 		}
+		respondPDF(w, fmt.Sprintf("statement-%s-%s-%s.pdf", account.ID, query.Get("from"), query.Get("to")), pdf)
+		return
+	}
+
+	statement, err := h.statementService.BuildStatement(r.Context(), account, from, to)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, statement)
+}
+
+// GetStatementDeliveries handles statement delivery history retrieval
+func (h *Handler) GetStatementDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	limit, offset := pageParams(r, 24)
+
+	deliveries, err := h.statementService.GetDeliveries(r.Context(), id, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
 	}
 
-	//default offset is set to 0
-	offset := 0
-	if offsetStr != "" {
-		parsedOffset, err := strconv.Atoi(offsetStr)
-		if err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
+	page := newPagination(limit, offset, len(deliveries))
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	if deliveries == nil {
+		deliveries = []*models.StatementDelivery{}
+	}
+	if includeTotal(r) {
+		count, err := h.statementService.CountDeliveries(r.Context(), id)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
 		}
+		page.SetTotal(count)
+	}
+
+	respondPage(w, r, deliveries, page)
+}
+
+// GetStatementDocument handles downloading the statement a delivery sent, from object storage
+func (h *Handler) GetStatementDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	document, err := h.statementService.Document(r.Context(), vars["id"], vars["deliveryId"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	if document.URL != "" {
+		http.Redirect(w, r, document.URL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.Filename))
+	setContentDigest(w, document.Checksum)
+	w.WriteHeader(http.StatusOK)
+	w.Write(document.Content)
+}
+
+// CreateSweepRule handles sweep rule creation
+func (h *Handler) CreateSweepRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.SweepRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
 	}
 
-	txs, err := h.transactionService.GetTransactionsByAccountID(r.Context(), accountID, limit, offset)
+	if _, err := h.accountService.GetAccount(r.Context(), id); err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	rule, err := h.sweepService.CreateRule(r.Context(), id, &req)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	// Convert to response objects
-	response := make([]models.TransactionResponse, 0, len(txs))
-	for _, tx := range txs {
-		response = append(response, models.TransactionResponse{
-			ID:            tx.ID,
-			AccountID:     tx.AccountID,
-			Type:          tx.Type,
-			Amount:        tx.Amount,
-			Status:        tx.Status,
-			BalanceBefore: tx.BalanceBefore,
-			BalanceAfter:  tx.BalanceAfter,
-			CreatedAt:     tx.CreatedAt,
-		})
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+// GetSweepRules handles sweep rule listing
+func (h *Handler) GetSweepRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.sweepService.GetRules(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
 	}
 
-	respondJSON(w, http.StatusOK, response)
+	respondJSON(w, http.StatusOK, rules)
 }
 
-// handles health check
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+// DeleteSweepRule handles sweep rule removal
+func (h *Handler) DeleteSweepRule(w http.ResponseWriter, r *http.Request) {
+	if err := h.sweepService.DeleteRule(r.Context(), mux.Vars(r)["id"]); err != nil {
+		respondError(w, r, http.StatusNotFound, errSweepRuleNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// sets up the API routes
-func SetupRoutes(r *mux.Router, accountService *service.AccountService, transactionService *service.TransactionService) {
-	h := NewHandler(accountService, transactionService)
+// handles transaction creation
+func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
 
-	// Health check (check if API is working)
-	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	h.createTransaction(w, r, &req)
+}
 
-	// Account routes
-	r.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
-	r.HandleFunc("/accounts/{id}", h.GetAccount).Methods("GET")
+// SimulateTransaction handles working out what a transaction request would do without creating it
+func (h *Handler) SimulateTransaction(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+	if !h.checkTransactionAccounts(w, r, &req) {
+		return
+	}
 
-	// Transaction routes
-	r.HandleFunc("/transactions", h.CreateTransaction).Methods("POST")
-	r.HandleFunc("/transactions/{id}", h.GetTransaction).Methods("GET")
-	r.HandleFunc("/accounts/{accountId}/transactions", h.GetTransactions).Methods("GET")
+	simulation, err := h.transactionService.SimulateTransaction(r.Context(), &req)
+	if err != nil {
+		respondTransactionError(w, r, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, simulation)
+}
+
+// CreateQuote handles quoting and locking the fee of a prospective transaction
+func (h *Handler) CreateQuote(w http.ResponseWriter, r *http.Request) {
+	var req models.QuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+	if !h.checkTransactionAccounts(w, r, req.TransactionRequest()) {
+		return
+	}
+
+	quote, err := h.transactionService.CreateQuote(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, quote)
+}
+
+// GetQuote handles quote retrieval
+func (h *Handler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	quote, err := h.transactionService.GetQuote(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, quote)
+}
+
+// checks the accounts of a transaction request, responding with the error when they can't be used
+func (h *Handler) checkTransactionAccounts(w http.ResponseWriter, r *http.Request, req *models.TransactionRequest) bool {
+	// Validation for account existance.
+	account, err := h.accountService.GetAccount(r.Context(), req.AccountID)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return false
+	}
+
+	// System accounts only move money through the services that own them
+	if account.Kind != models.CustomerAccount {
+		respondError(w, r, http.StatusForbidden, errSystemAccount)
+		return false
+	}
+
+	// Transfers also need a distinct, existing receiving account
+	if req.Type == models.Transfer {
+		if req.CounterpartyAccountID == "" || req.CounterpartyAccountID == req.AccountID {
+			respondError(w, r, http.StatusBadRequest, errSameCounterparty)
+			return false
+		}
+		counterparty, err := h.accountService.GetAccount(r.Context(), req.CounterpartyAccountID)
+		if err != nil {
+			respondError(w, r, http.StatusNotFound, errCounterpartyNotFound)
+			return false
+		}
+		if counterparty.Kind != models.CustomerAccount {
+			respondError(w, r, http.StatusForbidden, errSystemAccount)
+			return false
+		}
+		if counterparty.Currency != account.Currency {
+			respondError(w, r, http.StatusBadRequest, errCurrencyMismatch)
+			return false
+		}
+	}
+	return true
+}
+
+// responds with an error refusing a transaction request
+func respondTransactionError(w http.ResponseWriter, r *http.Request, err error) {
+	var conflict *service.ReferenceConflictError
+	if errors.As(err, &conflict) {
+		body := errorBody(w, r, http.StatusConflict, err)
+		body["reference"] = conflict.Reference
+		body["stored_digest"] = conflict.StoredDigest
+		body["request_digest"] = conflict.RequestDigest
+		respondJSON(w, http.StatusConflict, body)
+		return
+	}
+	if errors.Is(err, service.ErrIngestionUnavailable) {
+		// the details name broker internals; clients only need to know to come back shortly
+		w.Header().Set("Retry-After", "30")
+		respondError(w, r, http.StatusServiceUnavailable, service.ErrIngestionUnavailable)
+		return
+	}
+	respondError(w, r, statusForError(err), err)
+}
+
+// checks the accounts of a transaction request, creates it and responds with it, waiting for processing
+// when the client asked to
+func (h *Handler) createTransaction(w http.ResponseWriter, r *http.Request, req *models.TransactionRequest) {
+	if !h.checkTransactionAccounts(w, r, req) {
+		return
+	}
+
+	tx, err := h.transactionService.CreateTransaction(r.Context(), req)
+	if err != nil {
+		respondTransactionError(w, r, err)
+		return
+	}
+
+	if wait, ok := h.syncWait(r); ok {
+		final, err := h.transactionService.WaitForTransaction(r.Context(), tx.ID, wait)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		// still queued when the wait ran out: the client falls back to polling
+		if final.Status == models.Pending {
+			respondJSON(w, http.StatusAccepted, h.transactionResponse(r, final))
+			return
+		}
+		tx = final
+	}
+
+	respondJSON(w, http.StatusCreated, h.transactionResponse(r, tx))
+}
+
+// syncWait reports whether the client asked to wait for processing (?wait=true or ?sync=true)
+// and for how long; wait_timeout shortens the configured maximum
+func (h *Handler) syncWait(r *http.Request) (time.Duration, bool) {
+	query := r.URL.Query()
+	if h.config.MaxSyncWait <= 0 || (query.Get("wait") != "true" && query.Get("sync") != "true") {
+		return 0, false
+	}
+
+	wait := h.config.MaxSyncWait
+	if v, err := time.ParseDuration(query.Get("wait_timeout")); err == nil && v > 0 && v < wait {
+		wait = v
+	}
+	return wait, true
+}
+
+// GetTransaction handles transaction retrieval
+func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	tx, err := h.transactionService.GetTransaction(r.Context(), id)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errTransactionNotFound)
+		return
+	}
+
+	if wantsPDF(r) {
+		pdf, err := h.documentService.ReceiptPDF(r.Context(), tx)
+		if err != nil {
+			respondError(w, r, statusForError(err), err)
+			return
+		}
+		respondPDF(w, fmt.Sprintf("receipt-%s.pdf", tx.ID), pdf)
+		return
+	}
+	if notModified(w, r, etag(r, tx.ID, tx.UpdatedAt), tx.UpdatedAt) {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.transactionResponse(r, tx))
+}
+
+// GetTransactionTimeline handles retrieval of a transaction's recorded lifecycle
+func (h *Handler) GetTransactionTimeline(w http.ResponseWriter, r *http.Request) {
+	timeline, err := h.transactionService.GetTimeline(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errTransactionNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, timeline)
+}
+
+// VerifyAccount handles checking an account's stored balance against its transaction chain
+func (h *Handler) VerifyAccount(w http.ResponseWriter, r *http.Request) {
+	report, err := h.transactionService.VerifyAccount(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// CreateEscrow handles opening an escrow
+func (h *Handler) CreateEscrow(w http.ResponseWriter, r *http.Request) {
+	var req models.EscrowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	escrow, err := h.escrowService.CreateEscrow(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, escrow)
+}
+
+// GetEscrow handles escrow retrieval
+func (h *Handler) GetEscrow(w http.ResponseWriter, r *http.Request) {
+	escrow, err := h.escrowService.GetEscrow(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errEscrowNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, escrow)
+}
+
+// ReleaseEscrow handles paying an escrow out to the payee
+func (h *Handler) ReleaseEscrow(w http.ResponseWriter, r *http.Request) {
+	escrow, err := h.escrowService.Release(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, escrow)
+}
+
+// RefundEscrow handles returning an escrow to the payer
+func (h *Handler) RefundEscrow(w http.ResponseWriter, r *http.Request) {
+	escrow, err := h.escrowService.Refund(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, escrow)
+}
+
+// GetFlaggedTransactions handles listing transactions held as suspected duplicates
+func (h *Handler) GetFlaggedTransactions(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r, 50)
+
+	txs, err := h.transactionService.GetFlaggedTransactions(r.Context(), limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(txs))
+	if len(txs) > limit {
+		txs = txs[:limit]
+	}
+	if includeTotal(r) {
+		count, err := h.transactionService.CountFlaggedTransactions(r.Context())
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		page.SetTotal(count)
+	}
+
+	response := make([]models.TransactionResponse, 0, len(txs))
+	for _, tx := range txs {
+		response = append(response, newTransactionResponse(tx))
+	}
+	h.displayer(r).transactions(response)
+
+	respondPage(w, r, response, page)
+}
+
+// ApproveTransaction handles releasing a flagged transaction for processing
+func (h *Handler) ApproveTransaction(w http.ResponseWriter, r *http.Request) {
+	tx, err := h.transactionService.ApproveTransaction(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.transactionResponse(r, tx))
+}
+
+// RejectTransaction handles rejecting a flagged transaction as a duplicate
+func (h *Handler) RejectTransaction(w http.ResponseWriter, r *http.Request) {
+	tx, err := h.transactionService.RejectTransaction(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.transactionResponse(r, tx))
+}
+
+// GetTransactions handles transaction list retrieval
+func (h *Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID := vars["accountId"]
+
+	// default limit is set to 10; one extra row tells us whether there is a next page
+	limit, offset := pageParams(r, 10)
+
+	sort, err := transactionSort(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	txs, err := h.transactionService.GetTransactionsByAccountID(r.Context(), accountID, sort, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(txs))
+	if len(txs) > limit {
+		txs = txs[:limit]
+	}
+	if includeTotal(r) {
+		count, err := h.transactionService.CountTransactionsByAccountID(r.Context(), accountID)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		page.SetTotal(count)
+	}
+
+	// Convert to response objects
+	response := make([]models.TransactionResponse, 0, len(txs))
+	for _, tx := range txs {
+		response = append(response, newTransactionResponse(tx))
+	}
+	h.displayer(r).transactions(response)
+
+	respondPage(w, r, response, page)
+}
+
+// GetAccountStats handles an account's activity statistics for a date range
+// from and to are inclusive calendar dates (YYYY-MM-DD) in timezone, which defaults to UTC
+func (h *Handler) GetAccountStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	timezone := query.Get("timezone")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", service.ErrUnknownTimezone, timezone))
+		return
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", query.Get("from"), location)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidFromDate)
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", query.Get("to"), location)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidToDate)
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+
+	bucket := models.StatsBucket(query.Get("bucket"))
+	if bucket == "" {
+		bucket = models.BucketDay
+	}
+
+	account, err := h.accountService.GetAccount(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return
+	}
+
+	stats, err := h.reportService.GetAccountStats(r.Context(), account, from, to, bucket, location)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// ExportJournal handles journal export for a date range
+// from and to are inclusive calendar dates (YYYY-MM-DD, UTC)
+func (h *Handler) ExportJournal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	exporter, err := export.New(export.Format(query.Get("format")))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidFromDate)
+		return
+	}
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidToDate)
+		return
+	}
+	if to.Before(from) {
+		respondError(w, r, http.StatusBadRequest, errors.New("from must not be after to"))
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+
+	txs, err := h.reportService.GetJournalEntries(r.Context(), query.Get("account_id"), from, to)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("journal-%s-%s.%s", query.Get("from"), query.Get("to"), exporter.FileExtension())
+	w.Header().Set("Content-Type", exporter.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	exporter.Write(w, txs)
+}
+
+// ExportComplianceFindings handles the CTR/SAR support extract as JSON or CSV
+func (h *Handler) ExportComplianceFindings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidFromDate)
+		return
+	}
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidToDate)
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+
+	findings, err := h.complianceService.GetFindings(r.Context(), from, to)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch strings.ToLower(query.Get("format")) {
+	case "", "json":
+		respondJSON(w, http.StatusOK, findings)
+	case "csv":
+		filename := fmt.Sprintf("compliance-%s-%s.csv", query.Get("from"), query.Get("to"))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		compliance.WriteCSV(w, findings)
+	default:
+		respondError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", export.ErrUnsupportedFormat, query.Get("format")))
+	}
+}
+
+// CreateAPIKey handles API key issuance for a tenant
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+			return
+		}
+	}
+
+	key, err := h.tenantService.CreateAPIKey(r.Context(), mux.Vars(r)["tenantId"], &req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, key)
+}
+
+// GetTenantSettings handles tenant settings retrieval
+func (h *Handler) GetTenantSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.tenantService.GetSettings(r.Context(), mux.Vars(r)["tenantId"])
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	setVersion(w, etag(r, settings.TenantID, settings.UpdatedAt), settings.UpdatedAt)
+	respondJSON(w, http.StatusOK, settings)
+}
+
+// UpdateTenantSettings handles tenant settings replacement
+func (h *Handler) UpdateTenantSettings(w http.ResponseWriter, r *http.Request) {
+	tenantID := mux.Vars(r)["tenantId"]
+
+	var req models.TenantSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	ctx := r.Context()
+	if conditional(r) {
+		current, err := h.tenantService.ReloadSettings(ctx, tenantID)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		var ok bool
+		if ctx, ok = ifUnmodified(ctx, w, r, etag(r, current.TenantID, current.UpdatedAt), current.UpdatedAt); !ok {
+			return
+		}
+	}
+
+	settings, err := h.tenantService.UpdateSettings(ctx, tenantID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrModified) {
+			respondError(w, r, http.StatusPreconditionFailed, service.ErrModified)
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	setVersion(w, etag(r, settings.TenantID, settings.UpdatedAt), settings.UpdatedAt)
+	respondJSON(w, http.StatusOK, settings)
+}
+
+// GetMaintenance handles reading the maintenance switch
+func (h *Handler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.maintenanceService.Status(r.Context()))
+}
+
+// SetMaintenance handles toggling maintenance mode
+func (h *Handler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req models.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	status, err := h.maintenanceService.Set(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// GetReplication handles reading the region's replication role, epoch and progress
+func (h *Handler) GetReplication(w http.ResponseWriter, r *http.Request) {
+	if h.replication == nil {
+		respondError(w, r, http.StatusNotFound, errReplicationNotConfigured)
+		return
+	}
+	respondJSON(w, http.StatusOK, h.replication.Status(r.Context()))
+}
+
+// PauseAccount handles pausing processing for an account
+func (h *Handler) PauseAccount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ctx := tenant.WithTenant(r.Context(), vars["tenantId"])
+
+	var req models.PauseAccountRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+			return
+		}
+	}
+
+	ctx, ok := h.ifAccountUnmodified(ctx, w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	pause, version, err := h.transactionService.PauseAccount(ctx, vars["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	setVersion(w, etag(r, vars["id"], version), version)
+	respondJSON(w, http.StatusOK, pause)
+}
+
+// GetAccountPause handles checking whether an account is paused
+func (h *Handler) GetAccountPause(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pause, err := h.transactionService.GetAccountPause(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+	if pause == nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotPaused)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, pause)
+}
+
+// ResumeAccount handles resuming processing for an account
+func (h *Handler) ResumeAccount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ctx, ok := h.ifAccountUnmodified(tenant.WithTenant(r.Context(), vars["tenantId"]), w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	result, version, err := h.transactionService.ResumeAccount(ctx, vars["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	setVersion(w, etag(r, vars["id"], version), version)
+	respondJSON(w, http.StatusOK, result)
+}
+
+// ifAccountUnmodified applies an admin change's If-Match or If-Unmodified-Since to the account's current version
+// it answers the request itself and reports false when the account is missing or changed since
+func (h *Handler) ifAccountUnmodified(ctx context.Context, w http.ResponseWriter, r *http.Request, accountID string) (context.Context, bool) {
+	if !conditional(r) {
+		return ctx, true
+	}
+	current, err := h.accountService.GetAccount(ctx, accountID)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errAccountNotFound)
+		return nil, false
+	}
+	return ifUnmodified(ctx, w, r, etag(r, current.ID, current.UpdatedAt), current.UpdatedAt)
+}
+
+// GetSystemAccounts handles listing a tenant's system accounts and their balances
+func (h *Handler) GetSystemAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.accountService.GetSystemAccounts(tenant.WithTenant(r.Context(), mux.Vars(r)["tenantId"]))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := make([]models.AccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response = append(response, newAccountResponse(account))
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// UpdateKYCStatus handles an admin override of an account's KYC status
+func (h *Handler) UpdateKYCStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.KYCUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	ctx := tenant.WithTenant(r.Context(), vars["tenantId"])
+	if conditional(r) {
+		current, err := h.accountService.GetAccount(ctx, vars["id"])
+		if err != nil {
+			respondError(w, r, http.StatusNotFound, errAccountNotFound)
+			return
+		}
+		var ok bool
+		if ctx, ok = ifUnmodified(ctx, w, r, etag(r, current.ID, current.UpdatedAt), current.UpdatedAt); !ok {
+			return
+		}
+	}
+
+	account, err := h.accountService.UpdateKYC(ctx, vars["id"], &req)
+	if err != nil {
+		if errors.Is(err, service.ErrModified) {
+			respondError(w, r, http.StatusPreconditionFailed, service.ErrModified)
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	setVersion(w, etag(r, account.ID, account.UpdatedAt), account.UpdatedAt)
+	respondJSON(w, http.StatusOK, newAccountResponse(account))
+}
+
+// KYCCallback handles KYC status updates pushed by the KYC provider
+// the body must be signed with the shared KYC secret, using the same scheme as outgoing webhooks
+func (h *Handler) KYCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.config.KYCWebhookSecret == "" {
+		respondError(w, r, http.StatusNotFound, errKYCCallbackDisabled)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+	if err := notify.VerifySignature(r.Header.Get(notify.SignatureHeader), body, h.config.KYCWebhookSecret, notify.DefaultTolerance, time.Now()); err != nil {
+		respondError(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	var req models.KYCUpdateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+	if req.TenantID == "" || req.AccountID == "" {
+		respondError(w, r, http.StatusBadRequest, errKYCCallbackFields)
+		return
+	}
+
+	account, err := h.accountService.UpdateKYC(tenant.WithTenant(r.Context(), req.TenantID), req.AccountID, &req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newAccountResponse(account))
+}
+
+// GetProcessors handles listing transaction processor replicas and their heartbeats
+func (h *Handler) GetProcessors(w http.ResponseWriter, r *http.Request) {
+	processors, err := h.transactionService.GetProcessors(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, processors)
+}
+
+// GetConsumerCheckpoints handles listing how far each queue and feed consumer got, with its lag
+func (h *Handler) GetConsumerCheckpoints(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := h.transactionService.GetConsumerCheckpoints(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, checkpoints)
+}
+
+// GetAdminTransaction handles the operator view of a transaction, including retry and screening bookkeeping
+func (h *Handler) GetAdminTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tx, err := h.transactionService.GetTransaction(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["id"])
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errTransactionNotFound)
+		return
+	}
+	if notModified(w, r, etag(r, tx.ID, tx.UpdatedAt), tx.UpdatedAt) {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tx)
+}
+
+// GetReviewTransactions handles listing transactions parked by sanctions/AML screening
+func (h *Handler) GetReviewTransactions(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	limit, offset := pageParams(r, 50)
+
+	txs, err := h.transactionService.GetReviewTransactions(r.Context(), tenantID, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(txs))
+	if len(txs) > limit {
+		txs = txs[:limit]
+	}
+	if txs == nil {
+		txs = []*models.Transaction{}
+	}
+	if includeTotal(r) {
+		count, err := h.transactionService.CountReviewTransactions(r.Context(), tenantID)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		page.SetTotal(count)
+	}
+
+	respondPage(w, r, txs, page)
+}
+
+// ClearTransaction handles compliance clearing a screened transaction for processing
+func (h *Handler) ClearTransaction(w http.ResponseWriter, r *http.Request) {
+	h.resolveReview(w, r, h.transactionService.ClearTransaction)
+}
+
+// BlockTransaction handles compliance blocking a screened transaction
+func (h *Handler) BlockTransaction(w http.ResponseWriter, r *http.Request) {
+	h.resolveReview(w, r, h.transactionService.BlockTransaction)
+}
+
+func (h *Handler) resolveReview(w http.ResponseWriter, r *http.Request, resolve func(context.Context, string, *models.ScreeningReviewRequest) (*models.Transaction, error)) {
+	vars := mux.Vars(r)
+
+	var req models.ScreeningReviewRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+			return
+		}
+	}
+
+	ctx := tenant.WithTenant(r.Context(), vars["tenantId"])
+	if conditional(r) {
+		current, err := h.transactionService.GetTransaction(ctx, vars["id"])
+		if err != nil {
+			respondError(w, r, http.StatusNotFound, errTransactionNotFound)
+			return
+		}
+		var ok bool
+		if ctx, ok = ifUnmodified(ctx, w, r, etag(r, current.ID, current.UpdatedAt), current.UpdatedAt); !ok {
+			return
+		}
+	}
+
+	tx, err := resolve(ctx, vars["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	setVersion(w, etag(r, tx.ID, tx.UpdatedAt), tx.UpdatedAt)
+	respondJSON(w, http.StatusOK, tx)
+}
+
+// GetWebhookSecrets handles listing a tenant's active webhook secrets
+func (h *Handler) GetWebhookSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets, err := h.tenantService.GetWebhookSecrets(r.Context(), mux.Vars(r)["tenantId"])
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, secrets)
+}
+
+// RotateWebhookSecret handles issuing a new webhook secret for a tenant
+func (h *Handler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	var req models.RotateWebhookSecretRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+			return
+		}
+	}
+
+	grace := 24 * time.Hour
+	if req.GracePeriod != "" {
+		parsed, err := time.ParseDuration(req.GracePeriod)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidGracePeriod)
+			return
+		}
+		grace = parsed
+	}
+
+	secret, err := h.tenantService.RotateWebhookSecret(r.Context(), mux.Vars(r)["tenantId"], grace)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, secret)
+}
+
+// RevokeWebhookSecret handles revoking a webhook secret immediately
+func (h *Handler) RevokeWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.tenantService.RevokeWebhookSecret(r.Context(), vars["tenantId"], vars["id"]); err != nil {
+		respondError(w, r, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTenantBranding handles tenant branding retrieval
+func (h *Handler) GetTenantBranding(w http.ResponseWriter, r *http.Request) {
+	branding, err := h.documentService.GetBranding(r.Context(), mux.Vars(r)["tenantId"])
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, branding)
+}
+
+// UpdateTenantBranding handles tenant branding replacement
+func (h *Handler) UpdateTenantBranding(w http.ResponseWriter, r *http.Request) {
+	var req models.TenantBrandingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	branding, err := h.documentService.UpdateBranding(r.Context(), mux.Vars(r)["tenantId"], &req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, branding)
+}
+
+// GetEventCatalog handles listing the published event schemas
+func (h *Handler) GetEventCatalog(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, events.Catalog())
+}
+
+// GetSLOReport handles the processing latency SLO report
+func (h *Handler) GetSLOReport(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			respondError(w, r, http.StatusBadRequest, errInvalidWindow)
+			return
+		}
+		window = parsed
+	}
+
+	report, err := h.transactionService.GetSLOReport(r.Context(), r.URL.Query().Get("tenant_id"), window)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// GetPlatformStatsHistory handles the recorded per-minute platform throughput, rolled up into steps
+// from and to default to the last 24 hours and step to 5m
+func (h *Handler) GetPlatformStatsHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to, err := timeParam(query.Get("to"), "to", true)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if to == nil {
+		now := time.Now().UTC()
+		to = &now
+	}
+	from, err := timeParam(query.Get("from"), "from", false)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if from == nil {
+		start := to.Add(-24 * time.Hour)
+		from = &start
+	}
+	step := 5 * time.Minute
+	if v := query.Get("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil {
+			respondError(w, r, http.StatusBadRequest, errInvalidStep)
+			return
+		}
+	}
+
+	history, err := h.platformStats.GetHistory(r.Context(), *from, *to, step)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, history)
+}
+
+// GetSandboxClock handles reading a sandbox tenant's simulated time
+func (h *Handler) GetSandboxClock(w http.ResponseWriter, r *http.Request) {
+	clock, err := h.sandboxService.GetClock(r.Context())
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, clock)
+}
+
+// AdvanceSandboxClock handles moving a sandbox tenant's simulated time forward
+func (h *Handler) AdvanceSandboxClock(w http.ResponseWriter, r *http.Request) {
+	var req models.AdvanceClockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	clock, err := h.sandboxService.AdvanceClock(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, clock)
+}
+
+// handles health check; ingestion is reported without failing the check, since reads still work without the broker
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	ingestion := "available"
+	if !h.transactionService.IngestionAvailable() {
+		ingestion = "unavailable"
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok", "ingestion": ingestion})
+}
+
+// sets up the API routes
+func SetupRoutes(r *mux.Router, services Services, config Config) {
+	h := NewHandler(services, config)
+	r.Use(requestMiddleware)
+	r.Use(h.timeoutMiddleware)
+	r.Use(h.readRoutingMiddleware)
+
+	// Health check (check if API is working)
+	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/events/catalog", h.GetEventCatalog).Methods("GET")
+
+	// KYC provider callbacks authenticate with a signature rather than tenant credentials
+	r.HandleFunc("/kyc/callback", h.KYCCallback).Methods("POST")
+
+	// Live dashboards authenticate over the websocket, with tenant credentials or the admin token
+	r.HandleFunc("/ws", h.LiveUpdates).Methods("GET")
+
+	// The operator UI's pages are public; the admin API calls they make carry the token
+	r.PathPrefix("/admin/ui").Handler(h.AdminUI()).Methods("GET")
+
+	// Admin routes operate across tenants and use their own credential
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(h.adminMiddleware)
+	admin.HandleFunc("/tenants/{tenantId}/api-keys", h.CreateAPIKey).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/settings", h.GetTenantSettings).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/settings", h.UpdateTenantSettings).Methods("PUT")
+	admin.HandleFunc("/tenants/{tenantId}/accounts", h.GetAdminAccounts).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/accounts/{id}", h.GetAdminAccount).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/accounts/{id}/pause", h.PauseAccount).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/accounts/{id}/pause", h.GetAccountPause).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/accounts/{id}/resume", h.ResumeAccount).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/accounts/{id}/kyc", h.UpdateKYCStatus).Methods("PUT")
+	admin.HandleFunc("/tenants/{tenantId}/system-accounts", h.GetSystemAccounts).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/exceptions", h.GetExceptions).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/exceptions/{id}", h.GetException).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/exceptions/{id}/reassign", h.ReassignException).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/exceptions/{id}/refund", h.RefundException).Methods("POST")
+	admin.HandleFunc("/calendars", h.GetCalendars).Methods("GET")
+	admin.HandleFunc("/calendars/{code}", h.GetCalendar).Methods("GET")
+	admin.HandleFunc("/calendars/{code}", h.ReplaceCalendar).Methods("PUT")
+	admin.HandleFunc("/calendars/{code}/business-days", h.CheckBusinessDay).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/accounting-periods", h.GetClosedPeriods).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/accounting-periods/{period}/close", h.ClosePeriod).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/accounting-periods/{period}/reopen", h.ReopenPeriod).Methods("POST")
+	admin.HandleFunc("/screening/reviews", h.GetReviewTransactions).Methods("GET")
+	admin.HandleFunc("/transactions", h.SearchTransactions).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/transactions/{id}", h.GetAdminTransaction).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/transactions/{id}/timeline", h.GetAdminTransactionTimeline).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/transactions/{id}/clear", h.ClearTransaction).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/transactions/{id}/block", h.BlockTransaction).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/webhook-secrets", h.GetWebhookSecrets).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/webhook-secrets/rotate", h.RotateWebhookSecret).Methods("POST")
+	admin.HandleFunc("/tenants/{tenantId}/webhook-secrets/{id}", h.RevokeWebhookSecret).Methods("DELETE")
+	admin.HandleFunc("/tenants/{tenantId}/branding", h.GetTenantBranding).Methods("GET")
+	admin.HandleFunc("/tenants/{tenantId}/branding", h.UpdateTenantBranding).Methods("PUT")
+	admin.HandleFunc("/maintenance", h.GetMaintenance).Methods("GET")
+	admin.HandleFunc("/maintenance", h.SetMaintenance).Methods("PUT")
+	admin.HandleFunc("/replication", h.GetReplication).Methods("GET")
+	admin.HandleFunc("/slo", h.GetSLOReport).Methods("GET")
+	admin.HandleFunc("/stats/history", h.GetPlatformStatsHistory).Methods("GET")
+	admin.HandleFunc("/processors", h.GetProcessors).Methods("GET")
+	admin.HandleFunc("/consumer-checkpoints", h.GetConsumerCheckpoints).Methods("GET")
+	admin.HandleFunc("/rate-limits", h.GetRateLimits).Methods("GET")
+	admin.HandleFunc("/rate-limits", h.ResetRateLimit).Methods("DELETE")
+	admin.HandleFunc("/queues/{name}/messages", h.GetQueueMessages).Methods("GET")
+	admin.HandleFunc("/reconciliation", h.GetReconciliation).Methods("GET")
+	admin.HandleFunc("/audit-events", h.GetAuditEvents).Methods("GET")
+
+	// Everything else is scoped to the tenant resolved from the caller's credentials
+	r = r.NewRoute().Subrouter()
+	r.Use(h.tenantMiddleware)
+	r.Use(h.auditMiddleware)
+	r.Use(h.rateLimitMiddleware)
+	r.Use(h.maintenanceMiddleware)
+
+	// Account routes
+	r.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
+	r.HandleFunc("/accounts", h.FindAccounts).Methods("GET")
+	r.HandleFunc("/accounts/lookup", h.LookupAccounts).Methods("POST")
+	r.HandleFunc("/accounts/{id}", h.GetAccount).Methods("GET")
+	r.HandleFunc("/accounts/{id}/credits", h.GrantCredit).Methods("POST")
+	r.HandleFunc("/accounts/{id}/verify", h.VerifyAccount).Methods("GET")
+	r.HandleFunc("/accounts/{id}/notifications", h.GetNotificationPreferences).Methods("GET")
+	r.HandleFunc("/accounts/{id}/notifications", h.UpdateNotificationPreferences).Methods("PUT")
+	r.HandleFunc("/webhook-subscriptions", h.CreateWebhookSubscription).Methods("POST")
+	r.HandleFunc("/webhook-subscriptions", h.GetWebhookSubscriptions).Methods("GET")
+	r.HandleFunc("/webhook-subscriptions/{id}", h.DeleteWebhookSubscription).Methods("DELETE")
+	r.HandleFunc("/accounts/{id}/statement", h.GetStatement).Methods("GET")
+	r.HandleFunc("/accounts/{id}/stats", h.GetAccountStats).Methods("GET")
+	r.HandleFunc("/accounts/{id}/statement-preferences", h.GetStatementPreferences).Methods("GET")
+	r.HandleFunc("/accounts/{id}/statement-preferences", h.UpdateStatementPreferences).Methods("PUT")
+	r.HandleFunc("/accounts/{id}/insufficient-funds-policy", h.GetFundingPolicy).Methods("GET")
+	r.HandleFunc("/accounts/{id}/insufficient-funds-policy", h.UpdateFundingPolicy).Methods("PUT")
+	r.HandleFunc("/accounts/{id}/insufficient-funds-policy", h.DeleteFundingPolicy).Methods("DELETE")
+	r.HandleFunc("/accounts/{id}/statement-deliveries", h.GetStatementDeliveries).Methods("GET")
+	r.HandleFunc("/accounts/{id}/statement-deliveries/{deliveryId}/document", h.GetStatementDocument).Methods("GET")
+	r.HandleFunc("/accounts/{id}/sweep-rules", h.CreateSweepRule).Methods("POST")
+	r.HandleFunc("/accounts/{id}/sweep-rules", h.GetSweepRules).Methods("GET")
+	r.HandleFunc("/sweep-rules/{id}", h.DeleteSweepRule).Methods("DELETE")
+	r.HandleFunc("/accounts/{id}/templates", h.CreateTemplate).Methods("POST")
+	r.HandleFunc("/accounts/{id}/templates", h.GetTemplates).Methods("GET")
+	r.HandleFunc("/templates/{id}", h.GetTemplate).Methods("GET")
+	r.HandleFunc("/templates/{id}", h.DeleteTemplate).Methods("DELETE")
+	r.HandleFunc("/templates/{id}/execute", h.ExecuteTemplate).Methods("POST")
+
+	// Transaction routes
+	r.HandleFunc("/transactions", h.CreateTransaction).Methods("POST")
+	r.HandleFunc("/transactions/simulate", h.SimulateTransaction).Methods("POST")
+	r.HandleFunc("/transactions/lookup", h.LookupTransactions).Methods("POST")
+	r.HandleFunc("/quotes", h.CreateQuote).Methods("POST")
+	r.HandleFunc("/quotes/{id}", h.GetQuote).Methods("GET")
+	r.HandleFunc("/transaction-groups", h.CreateTransactionGroup).Methods("POST")
+	r.HandleFunc("/transaction-groups/{id}", h.GetTransactionGroup).Methods("GET")
+	r.HandleFunc("/transactions/flagged", h.GetFlaggedTransactions).Methods("GET")
+	r.HandleFunc("/transactions/{id}", h.GetTransaction).Methods("GET")
+	r.HandleFunc("/transactions/{id}/timeline", h.GetTransactionTimeline).Methods("GET")
+	r.HandleFunc("/transactions/{id}/approve", h.ApproveTransaction).Methods("POST")
+	r.HandleFunc("/transactions/{id}/reject", h.RejectTransaction).Methods("POST")
+	r.HandleFunc("/accounts/{accountId}/transactions", h.GetTransactions).Methods("GET")
+
+	// Escrow routes
+	r.HandleFunc("/escrows", h.CreateEscrow).Methods("POST")
+	r.HandleFunc("/escrows/{id}", h.GetEscrow).Methods("GET")
+	r.HandleFunc("/escrows/{id}/release", h.ReleaseEscrow).Methods("POST")
+	r.HandleFunc("/escrows/{id}/refund", h.RefundEscrow).Methods("POST")
+
+	// Card authorization routes
+	r.HandleFunc("/authorizations", h.CreateAuthorization).Methods("POST")
+	r.HandleFunc("/authorizations/settlements", h.IngestSettlement).Methods("POST")
+	r.HandleFunc("/authorizations/{id}", h.GetAuthorization).Methods("GET")
+	r.HandleFunc("/authorizations/{id}/capture", h.CaptureAuthorization).Methods("POST")
+	r.HandleFunc("/authorizations/{id}/release", h.ReleaseAuthorization).Methods("POST")
+
+	// Counterparty directory routes
+	r.HandleFunc("/counterparties", h.CreateCounterparty).Methods("POST")
+	r.HandleFunc("/counterparties", h.ListCounterparties).Methods("GET")
+	r.HandleFunc("/counterparties/{id}", h.GetCounterparty).Methods("GET")
+	r.HandleFunc("/counterparties/{id}", h.UpdateCounterparty).Methods("PATCH")
+
+	// Scripted limit, fraud and fee rules
+	r.HandleFunc("/rules", h.CreateRule).Methods("POST")
+	r.HandleFunc("/rules", h.ListRules).Methods("GET")
+	r.HandleFunc("/rules/{id}", h.GetRule).Methods("GET")
+	r.HandleFunc("/rules/{id}", h.UpdateRule).Methods("PATCH")
+	r.HandleFunc("/rules/{id}", h.DeleteRule).Methods("DELETE")
+
+	// Reporting routes
+	r.HandleFunc("/reports/journal", h.ExportJournal).Methods("GET")
+	r.HandleFunc("/reports/compliance", h.ExportComplianceFindings).Methods("GET")
+	r.HandleFunc("/reports/counterparties", h.GetCounterpartyReport).Methods("GET")
+	r.HandleFunc("/exports", h.CreateExport).Methods("POST")
+	r.HandleFunc("/exports/{id}", h.GetExport).Methods("GET")
+	r.HandleFunc("/exports/{id}/download", h.DownloadExport).Methods("GET")
+
+	// Sandbox routes
+	r.HandleFunc("/sandbox/clock", h.GetSandboxClock).Methods("GET")
+	r.HandleFunc("/sandbox/clock/advance", h.AdvanceSandboxClock).Methods("POST")
+
+	// Optional Open Banking read facade
+	if services.OpenBanking != nil {
+		openbanking.SetupRoutes(r, services.OpenBanking)
+	}
 }
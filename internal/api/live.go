@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/service"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/abkawan/banking-ledger/internal/ws"
+)
+
+const (
+	// how long a live connection may stay silent, pongs included, before it is dropped
+	liveIdleTimeout = 75 * time.Second
+
+	// how often live connections are pinged, so idle ones survive proxies and dead ones are noticed
+	livePingInterval = 30 * time.Second
+
+	// how long a connection that brought no credentials to the handshake has to send them
+	liveAuthTimeout = 10 * time.Second
+
+	// how long authenticating or subscribing may take
+	liveRequestTimeout = 5 * time.Second
+
+	// largest message a dashboard may send
+	maxLiveRequest = 4 << 10
+)
+
+// liveCaller is who a live connection authenticated as: an operator, or a tenant
+type liveCaller struct {
+	admin    bool
+	tenantID string
+}
+
+// LiveUpdates handles /ws, the websocket dashboards subscribe to platform snapshots and account balance updates
+// over. Credentials come with the handshake as on any other route or, since browsers can't set headers on a
+// websocket, in an "auth" message first
+func (h *Handler) LiveUpdates(w http.ResponseWriter, r *http.Request) {
+	if !ws.IsUpgrade(r) {
+		respondError(w, r, http.StatusBadRequest, errWebsocketUpgradeRequired)
+		return
+	}
+
+	var who *liveCaller
+	adminToken, token := r.Header.Get("X-Admin-Token"), credentials(r)
+	if adminToken != "" || token != "" {
+		var err error
+		if who, err = h.liveCaller(r.Context(), h.clientIP(r), adminToken, token); err != nil {
+			if errors.Is(err, errAddressNotAllowed) {
+				if h.audit != nil {
+					h.audit.Denied(r.Context(), h.auditEvent(r, http.StatusForbidden, err.Error()))
+				}
+				respondError(w, r, http.StatusForbidden, err)
+				return
+			}
+			h.auditAuthFailure(r, http.StatusUnauthorized, err.Error())
+			respondError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	conn, err := ws.Upgrade(w, r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	// the request's context ends with this handler, and shutdown doesn't wait for the connection: it is served
+	// until either side closes it or the live service stops
+	go h.serveLive(conn, who, i18n.Negotiate(r.Header.Get("Accept-Language")), h.auditEvent(r, http.StatusUnauthorized, ""))
+}
+
+// serveLive reads a connection's requests until it closes, while its messages are written alongside; failure
+// describes the handshake, for auditing a failed "auth" message
+func (h *Handler) serveLive(conn *ws.Conn, who *liveCaller, locale string, failure *models.AuditEvent) {
+	client := h.live.Connect()
+	defer h.live.Disconnect(client)
+	go writeLive(conn, client)
+
+	conn.SetReadLimit(maxLiveRequest)
+	if who == nil {
+		conn.SetIdleTimeout(liveAuthTimeout)
+	} else {
+		conn.SetIdleTimeout(liveIdleTimeout)
+		h.live.Send(client, &models.LiveMessage{Type: "ready"})
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req models.LiveRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			h.live.Send(client, liveError(locale, "", errInvalidMessage))
+			continue
+		}
+
+		if req.Type == "auth" {
+			if who != nil {
+				h.live.Send(client, liveError(locale, "", errAlreadyAuthenticated))
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), liveRequestTimeout)
+			who, err = h.liveCaller(ctx, failure.Source, req.AdminToken, req.Token)
+			if err != nil && h.audit != nil {
+				failure.Reason = err.Error()
+				if req.Token != "" || req.AdminToken != "" {
+					failure.Credential = credentialKey(req.Token, req.AdminToken)
+				}
+				if errors.Is(err, errAddressNotAllowed) {
+					failure.Status = http.StatusForbidden
+					h.audit.Denied(ctx, failure)
+				} else {
+					h.audit.AuthFailed(ctx, failure)
+				}
+			}
+			cancel()
+			if err != nil {
+				conn.WriteJSON(liveError(locale, "", err))
+				conn.Close(ws.ClosePolicyViolation, "authentication failed")
+				return
+			}
+			conn.SetIdleTimeout(liveIdleTimeout)
+			h.live.Send(client, &models.LiveMessage{Type: "ready"})
+			continue
+		}
+		if who == nil {
+			conn.WriteJSON(liveError(locale, req.ID, errMissingCredentials))
+			conn.Close(ws.ClosePolicyViolation, "authentication required")
+			return
+		}
+
+		switch req.Type {
+		case "subscribe":
+			err = h.liveSubscribe(client, who, &req)
+		case "unsubscribe":
+			err = h.live.Unsubscribe(client, req.ID)
+		default:
+			err = errUnknownMessageType
+		}
+		if err != nil {
+			h.live.Send(client, liveError(locale, req.ID, err))
+		}
+	}
+}
+
+// writeLive writes the client's messages and the keepalive pings until either the connection or the client is done
+func writeLive(conn *ws.Conn, client *service.LiveClient) {
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-client.Messages():
+			if err := conn.WriteMessage(ws.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		case <-client.Done():
+			conn.Close(ws.CloseGoingAway, "")
+			return
+		}
+	}
+}
+
+// liveCaller authenticates a live connection from source with the admin token, or else with tenant credentials
+// its tenant's allowlist covers source for
+func (h *Handler) liveCaller(ctx context.Context, source, adminToken, token string) (*liveCaller, error) {
+	if adminToken != "" {
+		if h.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(adminToken), []byte(h.config.AdminToken)) != 1 {
+			return nil, errInvalidAdminToken
+		}
+		return &liveCaller{admin: true}, nil
+	}
+	c, err := h.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.checkAddress(ctx, c.tenantID, source); err != nil {
+		return nil, err
+	}
+	return &liveCaller{tenantID: c.tenantID}, nil
+}
+
+// liveSubscribe opens a subscription: the platform for operators, and accounts of the caller's tenant, or of
+// the tenant an operator names
+func (h *Handler) liveSubscribe(client *service.LiveClient, who *liveCaller, req *models.LiveRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), liveRequestTimeout)
+	defer cancel()
+
+	switch req.Topic {
+	case models.LivePlatform:
+		if !who.admin {
+			return errPlatformRequiresAdmin
+		}
+	case models.LiveAccount:
+		tenantID := who.tenantID
+		if who.admin {
+			if req.TenantID == "" {
+				return errTenantIDRequired
+			}
+			tenantID = req.TenantID
+		}
+		ctx = tenant.WithTenant(ctx, tenantID)
+	}
+	return h.live.Subscribe(ctx, client, req.ID, req.Topic, req.AccountID)
+}
+
+// liveError is the translated error message for a request, like respondError's body
+func liveError(locale, id string, err error) *models.LiveMessage {
+	code, text, ok := i18n.Translate(locale, err)
+	if !ok {
+		code = "invalid_request"
+	}
+	return &models.LiveMessage{Type: "error", ID: id, Code: code, Error: text}
+}
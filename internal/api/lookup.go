@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// LookupAccounts handles retrieving many accounts by id in one call, each as GET /accounts/{id} returns it
+func (h *Handler) LookupAccounts(w http.ResponseWriter, r *http.Request) {
+	var req models.LookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	accounts, summaries, notFound, err := h.accountService.LookupAccounts(r.Context(), req.IDs)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+	breakdowns, err := h.creditService.GetBreakdowns(r.Context(), accounts)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := models.AccountLookupResponse{Accounts: make([]models.AccountResponse, 0, len(accounts)), NotFound: notFound}
+	display := h.displayer(r)
+	for _, account := range accounts {
+		item := newAccountResponse(account)
+		item.BalanceBreakdown = breakdowns[account.ID]
+		item.Activity = summaries[account.ID]
+		display.account(&item)
+		response.Accounts = append(response.Accounts, item)
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// LookupTransactions handles retrieving many transactions by id in one call
+func (h *Handler) LookupTransactions(w http.ResponseWriter, r *http.Request) {
+	var req models.LookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	txs, notFound, err := h.transactionService.LookupTransactions(r.Context(), req.IDs)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	response := models.TransactionLookupResponse{Transactions: make([]models.TransactionResponse, 0, len(txs)), NotFound: notFound}
+	for _, tx := range txs {
+		response.Transactions = append(response.Transactions, h.transactionResponse(r, tx))
+	}
+	respondJSON(w, http.StatusOK, response)
+}
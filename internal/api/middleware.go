@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/auth"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/service"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/google/uuid"
+)
+
+// Config holds API behaviour that is set per deployment
+type Config struct {
+	// AnonymousTenant, when set, is used for requests that carry no credentials
+	AnonymousTenant string
+
+	// JWTSecret verifies HS256 bearer tokens carrying a tenant_id claim
+	JWTSecret []byte
+
+	// AdminToken guards /admin routes; admin routes are disabled when empty
+	AdminToken string
+
+	// KYCWebhookSecret verifies KYC provider callbacks; the callback is disabled when empty
+	KYCWebhookSecret string
+
+	// Timeouts are the per-route time budgets, enforced as context deadlines
+	Timeouts RouteTimeouts
+
+	// MaxSyncWait bounds how long POST /transactions?wait=true may block; zero disables synchronous mode
+	MaxSyncWait time.Duration
+
+	// TrustForwardedFor takes the caller's address from the last X-Forwarded-For hop, for APIs behind a proxy
+	// that appends it; otherwise the connection's peer is the caller
+	TrustForwardedFor bool
+
+	// ReplicaStickiness is how long after a write a client's reads skip the read replica; zero only sends the
+	// writing request itself to the primary
+	ReplicaStickiness time.Duration
+}
+
+// credentials extracts an API key or bearer token from the request
+func credentials(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+		return strings.TrimPrefix(authz, "Bearer ")
+	}
+	return ""
+}
+
+// requestMiddleware attaches a request ID and the caller's trace context to every request
+// an incoming X-Request-ID is honoured so IDs can be correlated with upstream systems
+func requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := reqctx.WithMetadata(r.Context(), reqctx.Metadata{
+			RequestID:   requestID,
+			TraceParent: r.Header.Get("traceparent"),
+		})
+		ctx = i18n.WithLocale(ctx, i18n.Negotiate(r.Header.Get("Accept-Language")))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantMiddleware resolves the calling tenant and scopes the request context to it
+func (h *Handler) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := h.authenticate(r.Context(), credentials(r))
+		if err != nil {
+			h.auditAuthFailure(r, http.StatusUnauthorized, err.Error())
+			respondError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		if err := h.checkAddress(r.Context(), caller.tenantID, h.clientIP(r)); err != nil {
+			if !errors.Is(err, errAddressNotAllowed) {
+				respondError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			h.auditAddressDenied(r, caller)
+			respondError(w, r, http.StatusForbidden, err)
+			return
+		}
+		if tenant.IsSandbox(caller.tenantID) {
+			w.Header().Set("X-Ledger-Mode", "sandbox")
+		}
+
+		ctx := tenant.WithTenant(r.Context(), caller.tenantID)
+		ctx = reqctx.WithActor(ctx, caller.actor)
+		ctx = reqctx.WithReferenceNamespace(ctx, caller.namespace)
+		ctx = reqctx.WithBackDating(ctx, caller.backDating)
+		ctx = reqctx.WithLimits(ctx, caller.limits)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// caller is the tenant a set of credentials belongs to, and what they allow
+type caller struct {
+	tenantID   string
+	actor      string
+	namespace  string
+	backDating bool
+	limits     reqctx.Limits
+}
+
+// errAddressNotAllowed refuses credentials used from outside their tenant's IP allowlist
+var errAddressNotAllowed = i18n.NewError("error.address_not_allowed", "client address not allowed")
+
+// checkAddress refuses a tenant's credentials when they are used from an address its allowlist doesn't cover
+func (h *Handler) checkAddress(ctx context.Context, tenantID, ip string) error {
+	settings, err := h.tenantService.GetSettings(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if !settings.AllowsAddress(ip) {
+		return errAddressNotAllowed
+	}
+	return nil
+}
+
+// authenticate resolves an API key or JWT to its caller; no token at all is the anonymous tenant, when one
+// is configured
+func (h *Handler) authenticate(ctx context.Context, token string) (*caller, error) {
+	switch {
+	case token == "":
+		if h.config.AnonymousTenant == "" {
+			return nil, errMissingCredentials
+		}
+		return &caller{tenantID: h.config.AnonymousTenant, actor: "anonymous"}, nil
+	case len(h.config.JWTSecret) > 0 && auth.LooksLikeJWT(token):
+		claims, err := auth.VerifyHS256(token, h.config.JWTSecret)
+		if err != nil || claims.TenantID == "" {
+			return nil, errInvalidToken
+		}
+		c := &caller{
+			tenantID:   claims.TenantID,
+			actor:      "jwt:" + claims.Subject,
+			namespace:  claims.ReferenceNamespace,
+			backDating: claims.BackDating,
+		}
+		if claims.Sandbox {
+			// keys are refused a sandbox when they are issued; a token is only checked here
+			if len(c.tenantID) > tenant.MaxSandboxable {
+				return nil, errInvalidToken
+			}
+			c.tenantID = tenant.Sandbox(c.tenantID)
+		}
+		return c, nil
+	default:
+		key, err := h.tenantService.Authenticate(ctx, token)
+		if err != nil {
+			return nil, service.ErrInvalidAPIKey
+		}
+		c := &caller{
+			tenantID:   key.TenantID,
+			actor:      "api_key:" + key.Name,
+			namespace:  key.ReferenceNamespace,
+			backDating: key.BackDating,
+			limits: reqctx.Limits{
+				Key:                  key.KeyHash,
+				MaxTransactionAmount: key.MaxTransactionAmount,
+				MaxDailyAmount:       key.MaxDailyAmount,
+			},
+		}
+		if key.Sandbox {
+			c.tenantID = tenant.Sandbox(c.tenantID)
+		}
+		return c, nil
+	}
+}
+
+// maintenanceMiddleware rejects writes with 503 while maintenance mode is on; reads keep working
+func (h *Handler) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if err := h.maintenanceService.Refusal(r.Context()); err != nil {
+				w.Header().Set("Retry-After", "60")
+				respondError(w, r, http.StatusServiceUnavailable, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminMiddleware only lets through requests carrying the configured admin token
+func (h *Handler) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.config.AdminToken == "" {
+			respondError(w, r, http.StatusNotFound, errAdminDisabled)
+			return
+		}
+		given := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(h.config.AdminToken)) != 1 {
+			h.auditAuthFailure(r, http.StatusForbidden, "invalid admin token")
+			respondError(w, r, http.StatusForbidden, errInvalidAdminToken)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(reqctx.WithActor(r.Context(), "admin")))
+	})
+}
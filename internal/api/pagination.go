@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// pageParams parses limit and offset from the query string
+func pageParams(r *http.Request, defaultLimit int) (limit, offset int) {
+	query := r.URL.Query()
+
+	limit = defaultLimit
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+	return limit, offset
+}
+
+// includeTotal reports whether the client asked for the list total
+func includeTotal(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("include_total"))
+	return v
+}
+
+// newPagination describes a page that was fetched with one row of lookahead;
+// fetched is the number of rows returned for a limit+1 query
+func newPagination(limit, offset, fetched int) models.Pagination {
+	p := models.Pagination{Limit: limit, Offset: offset}
+	if fetched > limit {
+		next := offset + limit
+		p.NextOffset = &next
+	}
+	return p
+}
+
+// respondPage sends a page in the list envelope with RFC 5988 Link headers for the neighbouring pages
+func respondPage(w http.ResponseWriter, r *http.Request, data interface{}, p models.Pagination) {
+	if links := pageLinks(r.URL, p); len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	respondJSON(w, http.StatusOK, models.Page{Data: data, Pagination: p})
+}
+
+// pageLinks builds first, prev, next and, when the total is exact, last links
+func pageLinks(u *url.URL, p models.Pagination) []string {
+	link := func(offset int, rel string) string {
+		query := u.Query()
+		query.Set("limit", strconv.Itoa(p.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf("<%s?%s>; rel=%q", u.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(0, "first")}
+	if p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if p.NextOffset != nil {
+		links = append(links, link(*p.NextOffset, "next"))
+	}
+	if p.Total != nil && !p.TotalEstimated && *p.Total > 0 {
+		last := int((*p.Total - 1) / int64(p.Limit) * int64(p.Limit))
+		links = append(links, link(last, "last"))
+	}
+	return links
+}
+
+// transactionSort parses sort (created_at or amount) and order (asc or desc, default desc) from the query string
+func transactionSort(r *http.Request) (models.TransactionSort, error) {
+	query := r.URL.Query()
+
+	sort := models.TransactionSort{Field: models.SortByCreatedAt}
+	if v := query.Get("sort"); v != "" {
+		sort.Field = models.TransactionSortField(v)
+		if !sort.Field.Valid() {
+			return sort, fmt.Errorf("sort must be %s or %s", models.SortByCreatedAt, models.SortByAmount)
+		}
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		sort.Ascending = true
+	default:
+		return sort, fmt.Errorf("order must be asc or desc")
+	}
+	return sort, nil
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// GetClosedPeriods handles listing a tenant's closed accounting periods
+func (h *Handler) GetClosedPeriods(w http.ResponseWriter, r *http.Request) {
+	periods, err := h.periods.GetClosedPeriods(tenant.WithTenant(r.Context(), mux.Vars(r)["tenantId"]))
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, periods)
+}
+
+// ClosePeriod handles closing one of a tenant's accounting periods
+func (h *Handler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	period, err := h.periods.ClosePeriod(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["period"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, period)
+}
+
+// ReopenPeriod handles reopening one of a tenant's accounting periods
+func (h *Handler) ReopenPeriod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.periods.ReopenPeriod(tenant.WithTenant(r.Context(), vars["tenantId"]), vars["period"]); err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
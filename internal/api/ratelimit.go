@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/gorilla/mux"
+)
+
+// most counters the admin listing returns
+const maxRateLimitCounters = 1000
+
+var (
+	rateLimitedRequests = metrics.NewCounter(
+		"ledger_rate_limited_requests_total",
+		"Tenant requests refused with 429 because a rate limit bucket was full.",
+	)
+	rateLimitErrors = metrics.NewCounter(
+		"ledger_rate_limit_errors_total",
+		"Tenant requests let through without a rate limit check because the counter store couldn't be reached.",
+	)
+)
+
+// rateLimitMiddleware counts tenant requests against the caller's key, endpoint and tenant buckets and refuses them
+// with 429 once one is full; when the counter store can't be reached requests are let through rather than refused
+func (h *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		endpoint := r.Method + " " + r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				endpoint = r.Method + " " + template
+			}
+		}
+		tenantID, _ := tenant.FromContext(r.Context())
+
+		decision, err := h.rateLimiter.Allow(r.Context(), tenantID, reqctx.FromContext(r.Context()).Actor, endpoint)
+		if err != nil {
+			log.Printf("%sRate limit check failed, letting the request through: %v", reqctx.LogPrefix(r.Context()), err)
+			rateLimitErrors.Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+		if decision.Bucket != "" {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(decision.ResetsAt.Unix(), 10))
+		}
+		if !decision.Allowed {
+			wait := math.Ceil(time.Until(decision.ResetsAt).Seconds())
+			if wait < 1 {
+				wait = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait)))
+			rateLimitedRequests.Inc()
+			respondError(w, r, http.StatusTooManyRequests, errRateLimited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetRateLimits handles listing the rate limit counters in a window, optionally those whose bucket starts with prefix
+func (h *Handler) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	if h.rateLimiter == nil {
+		respondError(w, r, http.StatusNotFound, errRateLimitsDisabled)
+		return
+	}
+
+	counters, err := h.rateLimiter.Counters(r.Context(), r.URL.Query().Get("prefix"), maxRateLimitCounters)
+	if err != nil {
+		respondError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	limits := h.rateLimiter.Limits()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"window_seconds": limits.Window.Seconds(),
+		"per_key":        limits.PerKey,
+		"per_endpoint":   limits.PerEndpoint,
+		"per_tenant":     limits.PerTenant,
+		"counters":       counters,
+	})
+}
+
+// ResetRateLimit handles dropping a bucket's counter so its caller can make requests again straight away
+func (h *Handler) ResetRateLimit(w http.ResponseWriter, r *http.Request) {
+	if h.rateLimiter == nil {
+		respondError(w, r, http.StatusNotFound, errRateLimitsDisabled)
+		return
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		respondError(w, r, http.StatusBadRequest, errors.New("bucket is required"))
+		return
+	}
+
+	reset, err := h.rateLimiter.Reset(r.Context(), bucket)
+	if err != nil {
+		respondError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !reset {
+		respondError(w, r, http.StatusNotFound, errors.New("no counter for bucket"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
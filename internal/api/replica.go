@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/gorilla/mux"
+)
+
+// past this many clients, ended stickiness windows are swept on the next write
+const recentWritersSweepSize = 10000
+
+// readOnlyRoutes take a POST body but change nothing, so they are routed like reads
+var readOnlyRoutes = map[string]bool{
+	"POST /accounts/lookup":       true,
+	"POST /transactions/lookup":   true,
+	"POST /transactions/simulate": true,
+}
+
+// recentWriters remembers which clients wrote recently, so their reads can skip the replica until it caught up
+type recentWriters struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newRecentWriters(window time.Duration) *recentWriters {
+	return &recentWriters{window: window, until: make(map[string]time.Time)}
+}
+
+func (w *recentWriters) wrote(client string) {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.until) > recentWritersSweepSize {
+		for name, until := range w.until {
+			if !now.Before(until) {
+				delete(w.until, name)
+			}
+		}
+	}
+	w.until[client] = now.Add(w.window)
+}
+
+func (w *recentWriters) recent(client string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	until, ok := w.until[client]
+	return ok && time.Now().Before(until)
+}
+
+// clientKey identifies the caller by a digest of its credentials, so stickiness holds across routes and tenants
+func clientKey(r *http.Request) string {
+	return credentialKey(credentials(r), r.Header.Get("X-Admin-Token"))
+}
+
+// credentialKey fingerprints a token and admin token, for telling callers apart without keeping their credentials
+func credentialKey(token, adminToken string) string {
+	sum := sha256.Sum256([]byte(token + "\x00" + adminToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// routeName is the request's method and route template, e.g. "GET /accounts/{id}"
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+// readRoutingMiddleware sends requests that change something to the primary, and so do a client's reads within
+// the stickiness window after one of its writes, so a caller always reads its own writes
+// other reads may be served by the read replica
+func (h *Handler) readRoutingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !readOnlyRoutes[routeName(r)] {
+			if h.recentWriters != nil {
+				h.recentWriters.wrote(clientKey(r))
+			}
+			next.ServeHTTP(w, r.WithContext(db.WithPrimary(r.Context())))
+			return
+		}
+		if h.recentWriters != nil && h.recentWriters.recent(clientKey(r)) {
+			r = r.WithContext(db.WithPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
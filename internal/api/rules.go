@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateRule handles adding a scripted limit, fraud or fee rule
+func (h *Handler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var req models.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	rule, err := h.rules.CreateRule(r.Context(), &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+// ListRules handles rule listing
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r, 50)
+	rules, err := h.rules.GetRules(r.Context(), limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(rules))
+	if len(rules) > limit {
+		rules = rules[:limit]
+	}
+
+	respondPage(w, r, rules, page)
+}
+
+// GetRule handles rule retrieval
+func (h *Handler) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := h.rules.GetRule(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rule)
+}
+
+// UpdateRule handles changing a rule's name, kind or expression, or switching it on or off
+func (h *Handler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	var req models.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	rule, err := h.rules.UpdateRule(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rule)
+}
+
+// DeleteRule handles rule removal
+func (h *Handler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	if err := h.rules.DeleteRule(r.Context(), mux.Vars(r)["id"]); err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/export"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// maxSearchExport caps the rows an admin search export writes; narrower filters get the rest
+const maxSearchExport = 10000
+
+// SearchTransactions handles the admin transaction search across accounts and tenants
+// with a format parameter the matches are downloaded in that export format instead of paged
+func (h *Handler) SearchTransactions(w http.ResponseWriter, r *http.Request) {
+	search, err := transactionSearch(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		h.exportSearch(w, r, search, format)
+		return
+	}
+
+	limit, offset := pageParams(r, 50)
+	txs, err := h.transactionService.SearchTransactions(r.Context(), search, limit+1, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := newPagination(limit, offset, len(txs))
+	if len(txs) > limit {
+		txs = txs[:limit]
+	}
+	if includeTotal(r) {
+		count, err := h.transactionService.CountSearchTransactions(r.Context(), search)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		page.SetTotal(count)
+	}
+
+	respondPage(w, r, txs, page)
+}
+
+// exportSearch writes up to maxSearchExport matches as a download, flagging truncated exports in a header
+func (h *Handler) exportSearch(w http.ResponseWriter, r *http.Request, search *models.TransactionSearch, format string) {
+	exporter, err := export.New(export.Format(format))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	txs, err := h.transactionService.SearchTransactions(r.Context(), search, maxSearchExport+1, 0)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if len(txs) > maxSearchExport {
+		txs = txs[:maxSearchExport]
+		w.Header().Set("X-Export-Truncated", "true")
+	}
+
+	filename := fmt.Sprintf("transactions-%s.%s", time.Now().UTC().Format("20060102T150405Z"), exporter.FileExtension())
+	w.Header().Set("Content-Type", exporter.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	exporter.Write(w, txs)
+}
+
+// transactionSearch parses the admin search filters from the query string
+// status and type take comma-separated lists; from and to are dates (to inclusive) or RFC 3339 times (to exclusive)
+func transactionSearch(r *http.Request) (*models.TransactionSearch, error) {
+	query := r.URL.Query()
+	search := &models.TransactionSearch{
+		TenantID:        query.Get("tenant_id"),
+		AccountID:       query.Get("account_id"),
+		CounterpartyID:  query.Get("counterparty_id"),
+		ReferencePrefix: query.Get("reference_prefix"),
+		BackDated:       query.Get("back_dated") == "true",
+	}
+
+	for _, v := range splitList(query.Get("status")) {
+		status := models.TransactionStatus(v)
+		switch status {
+		case models.Pending, models.Completed, models.Failed, models.Flagged, models.Held, models.InReview, models.Suspended, models.AwaitingFunds:
+		default:
+			return nil, fmt.Errorf("unknown status %q", v)
+		}
+		search.Statuses = append(search.Statuses, status)
+	}
+	for _, v := range splitList(query.Get("type")) {
+		kind := models.TransactionType(v)
+		switch kind {
+		case models.Deposit, models.Withdrawal, models.Transfer, models.Opening:
+		default:
+			return nil, fmt.Errorf("unknown type %q", v)
+		}
+		search.Types = append(search.Types, kind)
+	}
+
+	var err error
+	if search.MinAmount, err = amountParam(query.Get("min_amount"), "min_amount"); err != nil {
+		return nil, err
+	}
+	if search.MaxAmount, err = amountParam(query.Get("max_amount"), "max_amount"); err != nil {
+		return nil, err
+	}
+	if search.MinAmount != nil && search.MaxAmount != nil && *search.MinAmount > *search.MaxAmount {
+		return nil, fmt.Errorf("min_amount is above max_amount")
+	}
+
+	if search.From, err = timeParam(query.Get("from"), "from", false); err != nil {
+		return nil, err
+	}
+	if search.To, err = timeParam(query.Get("to"), "to", true); err != nil {
+		return nil, err
+	}
+	return search, nil
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func amountParam(s, name string) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return &v, nil
+}
+
+// timeParam parses an RFC 3339 time or a YYYY-MM-DD date; an end date covers the whole day
+func timeParam(s, name string, end bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format or an RFC 3339 time", name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const (
+	// largest settlement file accepted in one request
+	maxSettlementBytes = 10 << 20
+
+	// most items accepted in one settlement file
+	maxSettlementItems = 10000
+)
+
+// IngestSettlement handles a card processor's settlement file: a CSV with an auth_code, amount and optional tip
+// header, or JSON lines of the same fields. Matched items are posted and the report lists every item's outcome
+func (h *Handler) IngestSettlement(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxSettlementBytes)
+
+	var items []models.SettlementItem
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		items, err = readSettlementCSV(body)
+	} else {
+		items, err = readSettlementJSONLines(body)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, fmt.Errorf("invalid settlement file: %w", err))
+		return
+	}
+	if len(items) == 0 {
+		respondError(w, r, http.StatusBadRequest, errors.New("invalid settlement file: no items"))
+		return
+	}
+
+	report, err := h.authorizations.Settle(r.Context(), items)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+func readSettlementCSV(body io.Reader) ([]models.SettlementItem, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header row")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"auth_code", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var items []models.SettlementItem
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == maxSettlementItems {
+			return nil, fmt.Errorf("at most %d items per file", maxSettlementItems)
+		}
+
+		item := models.SettlementItem{Line: line, AuthCode: field(record, "auth_code")}
+		if item.Amount, err = strconv.ParseFloat(field(record, "amount"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", line, field(record, "amount"))
+		}
+		if v := field(record, "tip"); v != "" {
+			if item.Tip, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid tip %q", line, v)
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+func readSettlementJSONLines(body io.Reader) ([]models.SettlementItem, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxSettlementBytes)
+
+	var items []models.SettlementItem
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if len(items) == maxSettlementItems {
+			return nil, fmt.Errorf("at most %d items per file", maxSettlementItems)
+		}
+
+		item := models.SettlementItem{Line: line}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CreateTemplate handles saving a transaction template on an account
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	template, err := h.templates.CreateTemplate(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, template)
+}
+
+// GetTemplates handles listing an account's transaction templates
+func (h *Handler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.templates.GetTemplates(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, templates)
+}
+
+// GetTemplate handles transaction template retrieval
+func (h *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := h.templates.GetTemplate(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, template)
+}
+
+// DeleteTemplate handles transaction template removal
+func (h *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := h.templates.DeleteTemplate(r.Context(), mux.Vars(r)["id"]); err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExecuteTemplate handles creating a transaction from a template; the body is optional
+func (h *Handler) ExecuteTemplate(w http.ResponseWriter, r *http.Request) {
+	var req models.ExecuteTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, r, http.StatusBadRequest, errInvalidPayload)
+		return
+	}
+
+	txReq, err := h.templates.TransactionRequest(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		respondError(w, r, statusForError(err), err)
+		return
+	}
+
+	h.createTransaction(w, r, txReq)
+}
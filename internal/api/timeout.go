@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/ws"
+	"github.com/gorilla/mux"
+)
+
+// RouteTimeouts are the time budgets requests get, keyed by "METHOD /route/template"
+type RouteTimeouts struct {
+	// Default applies to routes without their own budget; zero leaves them unbounded
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// ParseRouteTimeouts reads a list such as "GET /accounts/{id}=2s,GET /accounts/{accountId}/transactions=5s"
+func ParseRouteTimeouts(s string, defaultTimeout time.Duration) (RouteTimeouts, error) {
+	t := RouteTimeouts{Default: defaultTimeout, Routes: map[string]time.Duration{}}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, "=")
+		if i < 0 {
+			return t, fmt.Errorf("invalid route timeout %q, expected \"METHOD /path=duration\"", part)
+		}
+		method, path, ok := strings.Cut(strings.TrimSpace(part[:i]), " ")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return t, fmt.Errorf("invalid route %q, expected \"METHOD /path\"", part[:i])
+		}
+		budget, err := time.ParseDuration(part[i+1:])
+		if err != nil || budget <= 0 {
+			return t, fmt.Errorf("invalid timeout for %s: %s", part[:i], part[i+1:])
+		}
+		t.Routes[strings.ToUpper(method)+" "+path] = budget
+	}
+	return t, nil
+}
+
+// For returns the budget of the route that matched r
+func (t RouteTimeouts) For(r *http.Request) time.Duration {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if budget, ok := t.Routes[r.Method+" "+template]; ok {
+				return budget
+			}
+		}
+	}
+	return t.Default
+}
+
+// timeoutMiddleware gives each request its route's budget as a context deadline, so database calls
+// give up with it, and answers 504 when the budget runs out before the handler does
+func (h *Handler) timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := h.config.Timeouts.For(r)
+		// websocket streams outlive any budget, and take the connection over from the buffered writer below
+		if budget <= 0 || ws.IsUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		tw := &timeoutWriter{header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			// a handler that failed because the budget ran out reports it as a timeout too
+			if tw.status >= http.StatusInternalServerError && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				respondTimeout(w, r, budget)
+				return
+			}
+			tw.flushTo(w)
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				respondTimeout(w, r, budget)
+			}
+		}
+	})
+}
+
+// respondTimeout sends the structured 504 for an exhausted budget
+func respondTimeout(w http.ResponseWriter, r *http.Request, budget time.Duration) {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	respondJSON(w, http.StatusGatewayTimeout, map[string]interface{}{
+		"error":     i18n.T(locale, "error.deadline_exceeded"),
+		"code":      "deadline_exceeded",
+		"budget_ms": budget.Milliseconds(),
+	})
+}
+
+// timeoutWriter buffers a response so it can be dropped when the budget runs out first
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// flushTo copies the buffered response to w; the caller holds tw.mu
+func (tw *timeoutWriter) flushTo(w http.ResponseWriter) {
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	w.Write(tw.body.Bytes())
+}
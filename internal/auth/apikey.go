@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// apiKeyPrefix makes ledger keys recognisable in logs and secret scanners
+const (
+	apiKeyPrefix        = "lk_"
+	webhookSecretPrefix = "whsec_"
+)
+
+// reference namespaces are short labels for one integration within a tenant
+var referenceNamespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidReferenceNamespace reports whether a key's or token's reference namespace is up to 32 lowercase letters,
+// digits, _ or -, starting with a letter or digit
+func ValidReferenceNamespace(namespace string) bool {
+	return referenceNamespacePattern.MatchString(namespace)
+}
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// GenerateWebhookSecret returns a new random webhook signing secret
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey returns the digest stored in place of the raw key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the JWT claims the ledger understands
+type Claims struct {
+	Subject   string `json:"sub"`
+	TenantID  string `json:"tenant_id"`
+	Sandbox   bool   `json:"sandbox,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+
+	// ReferenceNamespace scopes the caller's transaction references like an API key's namespace does
+	ReferenceNamespace string `json:"reference_namespace,omitempty"`
+
+	// BackDating allows the caller to post transactions with a past posting_date
+	BackDating bool `json:"back_dating,omitempty"`
+}
+
+// LooksLikeJWT reports whether a bearer token has the three-segment JWT shape
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// VerifyHS256 checks an HS256-signed JWT and returns its claims
+func VerifyHS256(token string, secret []byte) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.ReferenceNamespace != "" && !ValidReferenceNamespace(claims.ReferenceNamespace) {
+		return nil, fmt.Errorf("invalid reference namespace")
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Version is the backup file format; restores refuse files of another version
+const Version = 1
+
+// record kinds, one JSON object per line: a checkpoint header, the data, then an end trailer
+const (
+	kindCheckpoint  = "checkpoint"
+	kindAccount     = "account"
+	kindTransaction = "transaction"
+	kindEnd         = "end"
+)
+
+// Checkpoint identifies the moment a backup is consistent at
+// accounts come from a Postgres snapshot taken at At and transactions are those created up to At
+type Checkpoint struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	At        time.Time `json:"at"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Quiesced  bool      `json:"quiesced"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Totals is written last so a truncated backup is detected on restore
+// Drifted counts transactions that changed after the checkpoint, which is only possible without quiescing
+// Queued and Unsettled are the queue checkpoint: the pending transactions still waiting in the queue, and those
+// a processor had already started on, whose balance update may or may not be in the snapshot
+type Totals struct {
+	Accounts     int `json:"accounts"`
+	Transactions int `json:"transactions"`
+	Drifted      int `json:"drifted,omitempty"`
+	Queued       int `json:"queued,omitempty"`
+	Unsettled    int `json:"unsettled,omitempty"`
+}
+
+type record struct {
+	Kind       string                 `json:"kind"`
+	Checkpoint *Checkpoint            `json:"checkpoint,omitempty"`
+	Account    *models.Account        `json:"account,omitempty"`
+	Summary    *models.AccountSummary `json:"summary,omitempty"`
+	// Transaction is MongoDB extended JSON so every stored field, including the timeline, survives
+	Transaction json.RawMessage `json:"transaction,omitempty"`
+	Totals      *Totals         `json:"totals,omitempty"`
+}
+
+// Write exports accounts and transactions to w keyed to a checkpoint taken now
+// quiesced records that writes were paused, which is what makes both stores line up exactly
+func Write(ctx context.Context, w io.Writer, postgres *db.Postgres, mongodb *db.MongoDB, tenantID string, quiesced bool) (*Checkpoint, *Totals, error) {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	// accounts are buffered until the snapshot time is known, because the header carries it
+	type accountRecord struct {
+		account *models.Account
+		summary *models.AccountSummary
+	}
+	var accounts []accountRecord
+	at, err := postgres.ExportAccounts(ctx, tenantID, func(account *models.Account, summary *models.AccountSummary) error {
+		accounts = append(accounts, accountRecord{account, summary})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkpoint := &Checkpoint{
+		ID:        "ckpt-" + at.UTC().Format("20060102T150405.000000Z"),
+		Version:   Version,
+		At:        at,
+		TenantID:  tenantID,
+		Quiesced:  quiesced,
+		CreatedAt: time.Now(),
+	}
+	if err := enc.Encode(record{Kind: kindCheckpoint, Checkpoint: checkpoint}); err != nil {
+		return nil, nil, fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	totals := &Totals{}
+	for _, a := range accounts {
+		if err := enc.Encode(record{Kind: kindAccount, Account: a.account, Summary: a.summary}); err != nil {
+			return nil, nil, fmt.Errorf("failed to write account %s: %w", a.account.ID, err)
+		}
+		totals.Accounts++
+	}
+
+	err = mongodb.ExportTransactions(ctx, tenantID, at, func(tx *models.Transaction) error {
+		raw, err := bson.MarshalExtJSON(tx, true, false)
+		if err != nil {
+			return fmt.Errorf("failed to encode transaction %s: %w", tx.ID, err)
+		}
+		if err := enc.Encode(record{Kind: kindTransaction, Transaction: raw}); err != nil {
+			return fmt.Errorf("failed to write transaction %s: %w", tx.ID, err)
+		}
+		totals.Transactions++
+		if tx.UpdatedAt.After(at) {
+			totals.Drifted++
+		}
+		countQueued(totals, tx)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := enc.Encode(record{Kind: kindEnd, Totals: totals}); err != nil {
+		return nil, nil, fmt.Errorf("failed to write totals: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return checkpoint, totals, nil
+}
+
+// ReadCheckpoint returns the checkpoint a backup is keyed to
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	var checkpoint *Checkpoint
+	err := read(r, func(rec *record) error {
+		checkpoint = rec.Checkpoint
+		return io.EOF
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if checkpoint == nil {
+		return nil, fmt.Errorf("backup has no checkpoint")
+	}
+	return checkpoint, nil
+}
+
+// countQueued counts a transaction towards the queue checkpoint
+func countQueued(totals *Totals, tx *models.Transaction) {
+	if tx.Status != models.Pending {
+		return
+	}
+	if tx.ProcessingStartedAt != nil {
+		totals.Unsettled++
+	} else {
+		totals.Queued++
+	}
+}
+
+// Restore writes every account and transaction of a backup back, replacing what is stored under the same ids
+// the caller is expected to have checked the target holds nothing newer than the checkpoint. With a non-zero
+// requeueAt the transactions queued at the checkpoint are due for the retry job from then, which queues them
+// again: a fresh environment's queue doesn't have them, and in the same one the processor's claim keeps a
+// second message from applying them twice. They count as queued at requeueAt for the processing SLA
+func Restore(ctx context.Context, r io.Reader, postgres *db.Postgres, mongodb *db.MongoDB, requeueAt time.Time) (*Totals, error) {
+	restored := &Totals{}
+	var expected *Totals
+	err := read(r, func(rec *record) error {
+		switch rec.Kind {
+		case kindAccount:
+			if err := postgres.RestoreAccount(ctx, rec.Account, rec.Summary); err != nil {
+				return fmt.Errorf("account %s: %w", rec.Account.ID, err)
+			}
+			restored.Accounts++
+		case kindTransaction:
+			var tx models.Transaction
+			if err := bson.UnmarshalExtJSON(rec.Transaction, true, &tx); err != nil {
+				return fmt.Errorf("failed to decode transaction: %w", err)
+			}
+			if !requeueAt.IsZero() && tx.Status == models.Pending && tx.ProcessingStartedAt == nil {
+				due := requeueAt
+				tx.NextRetryAt = &due
+				tx.UpdatedAt = requeueAt
+			}
+			if err := mongodb.RestoreTransaction(ctx, &tx); err != nil {
+				return fmt.Errorf("transaction %s: %w", tx.ID, err)
+			}
+			restored.Transactions++
+			countQueued(restored, &tx)
+		case kindEnd:
+			expected = rec.Totals
+		}
+		return nil
+	})
+	if err != nil {
+		return restored, err
+	}
+
+	if expected == nil {
+		return restored, fmt.Errorf("backup is truncated: restored %d accounts and %d transactions before it ended", restored.Accounts, restored.Transactions)
+	}
+	if expected.Accounts != restored.Accounts || expected.Transactions != restored.Transactions {
+		return restored, fmt.Errorf("backup is inconsistent: it lists %d accounts and %d transactions but holds %d and %d",
+			expected.Accounts, expected.Transactions, restored.Accounts, restored.Transactions)
+	}
+	return restored, nil
+}
+
+// read calls fn for every record after checking the header; fn may stop early by returning io.EOF
+func read(r io.Reader, fn func(*record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if line == 1 {
+			if rec.Kind != kindCheckpoint || rec.Checkpoint == nil {
+				return fmt.Errorf("not a ledger backup: missing checkpoint header")
+			}
+			if rec.Checkpoint.Version != Version {
+				return fmt.Errorf("unsupported backup version %d", rec.Checkpoint.Version)
+			}
+		}
+		if err := fn(&rec); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	return nil
+}
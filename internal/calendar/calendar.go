@@ -0,0 +1,106 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateLayout is how dates are written in holiday lists and value dates
+const DateLayout = "2006-01-02"
+
+// Calendar knows which days are business days: weekdays that aren't holidays
+// days are dates; only their year, month and day are looked at
+type Calendar struct {
+	holidays map[string]bool
+}
+
+// New returns a calendar with the given holidays
+func New(holidays ...time.Time) *Calendar {
+	c := &Calendar{holidays: make(map[string]bool, len(holidays))}
+	for _, h := range holidays {
+		c.holidays[h.Format(DateLayout)] = true
+	}
+	return c
+}
+
+// Parse reads a comma-separated list of YYYY-MM-DD holidays, as set in the environment
+func Parse(list string) (*Calendar, error) {
+	var holidays []time.Time
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		day, err := time.Parse(DateLayout, field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: dates are YYYY-MM-DD", field)
+		}
+		holidays = append(holidays, day)
+	}
+	return New(holidays...), nil
+}
+
+// IsBusinessDay reports whether day is a weekday and not a holiday
+func (c *Calendar) IsBusinessDay(day time.Time) bool {
+	switch day.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return !c.holidays[day.Format(DateLayout)]
+}
+
+// NextBusinessDay returns the first business day after day
+func (c *Calendar) NextBusinessDay(day time.Time) time.Time {
+	next := day.AddDate(0, 0, 1)
+	for !c.IsBusinessDay(next) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// PreviousBusinessDay returns the last business day before day
+func (c *Calendar) PreviousBusinessDay(day time.Time) time.Time {
+	prev := day.AddDate(0, 0, -1)
+	for !c.IsBusinessDay(prev) {
+		prev = prev.AddDate(0, 0, -1)
+	}
+	return prev
+}
+
+// Holidays returns the calendar's holidays in date order
+func (c *Calendar) Holidays() []string {
+	days := make([]string, 0, len(c.holidays))
+	for day := range c.holidays {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// ParseCutoff reads a cut-off time of day written HH:MM; the empty string is no cut-off
+func ParseCutoff(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cut-off %q: times are HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ValueDate returns the date, at midnight UTC, a transaction booked at t takes effect: the day it was booked in loc
+// if that is a business day and t is before the cut-off, otherwise the next business day. A zero cutoff has none
+func (c *Calendar) ValueDate(t time.Time, loc *time.Location, cutoff time.Duration) time.Time {
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	// the wall clock, not the time since midnight, which is off by an hour on daylight saving days
+	timeOfDay := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	if !c.IsBusinessDay(day) || (cutoff > 0 && timeOfDay >= cutoff) {
+		return c.NextBusinessDay(day)
+	}
+	return day
+}
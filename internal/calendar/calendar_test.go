@@ -0,0 +1,106 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestBusinessDays(t *testing.T) {
+	c, err := Parse("2026-12-25, 2026-12-28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		day            string
+		business       bool
+		previous, next string
+	}{
+		{"2026-12-23", true, "2026-12-22", "2026-12-24"},
+		{"2026-12-24", true, "2026-12-23", "2026-12-29"}, // Christmas, the weekend and a substitute holiday
+		{"2026-12-25", false, "2026-12-24", "2026-12-29"},
+		{"2026-12-26", false, "2026-12-24", "2026-12-29"},
+		{"2026-12-29", true, "2026-12-24", "2026-12-30"},
+		{"2027-01-04", true, "2027-01-01", "2027-01-05"}, // a Monday
+	}
+	for _, tt := range tests {
+		day := date(tt.day)
+		if got := c.IsBusinessDay(day); got != tt.business {
+			t.Errorf("%s: business day %v, want %v", tt.day, got, tt.business)
+		}
+		if got := c.PreviousBusinessDay(day).Format(DateLayout); got != tt.previous {
+			t.Errorf("%s: previous business day %s, want %s", tt.day, got, tt.previous)
+		}
+		if got := c.NextBusinessDay(day).Format(DateLayout); got != tt.next {
+			t.Errorf("%s: next business day %s, want %s", tt.day, got, tt.next)
+		}
+	}
+
+	if got := c.Holidays(); len(got) != 2 || got[0] != "2026-12-25" || got[1] != "2026-12-28" {
+		t.Errorf("holidays %v", got)
+	}
+	if _, err := Parse("2026-12-25,25/12/2026"); err == nil {
+		t.Error("accepted a date that isn't YYYY-MM-DD")
+	}
+}
+
+func TestParseCutoff(t *testing.T) {
+	if got, err := ParseCutoff("17:30"); err != nil || got != 17*time.Hour+30*time.Minute {
+		t.Errorf("17:30 is %s, %v", got, err)
+	}
+	if got, err := ParseCutoff(""); err != nil || got != 0 {
+		t.Errorf("no cut-off is %s, %v", got, err)
+	}
+	for _, bad := range []string{"5pm", "25:00", "17"} {
+		if _, err := ParseCutoff(bad); err == nil {
+			t.Errorf("accepted cut-off %q", bad)
+		}
+	}
+}
+
+func TestValueDate(t *testing.T) {
+	c := New(date("2026-12-25"))
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	cutoff := 17 * time.Hour
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		loc    *time.Location
+		cutoff time.Duration
+		want   string
+	}{
+		{"before the cut-off", time.Date(2026, 3, 4, 16, 59, 0, 0, time.UTC), time.UTC, cutoff, "2026-03-04"},
+		{"at the cut-off", time.Date(2026, 3, 4, 17, 0, 0, 0, time.UTC), time.UTC, cutoff, "2026-03-05"},
+		{"after the cut-off on a Friday", time.Date(2026, 3, 6, 18, 0, 0, 0, time.UTC), time.UTC, cutoff, "2026-03-09"},
+		{"weekend without a cut-off", time.Date(2026, 3, 7, 9, 0, 0, 0, time.UTC), time.UTC, 0, "2026-03-09"},
+		{"late without a cut-off", time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC), time.UTC, 0, "2026-03-04"},
+		{"holiday", time.Date(2026, 12, 25, 9, 0, 0, 0, time.UTC), time.UTC, cutoff, "2026-12-28"},
+		{"after the cut-off before a holiday", time.Date(2026, 12, 24, 17, 30, 0, 0, time.UTC), time.UTC, cutoff, "2026-12-28"},
+		// 20:30 UTC is still the afternoon in New York
+		{"the tenant's day", time.Date(2026, 3, 4, 20, 30, 0, 0, time.UTC), newYork, cutoff, "2026-03-04"},
+		{"the tenant's day, not UTC's", time.Date(2026, 3, 5, 2, 0, 0, 0, time.UTC), newYork, 0, "2026-03-04"},
+		// 16:30 UTC is 17:30 in London once the clocks have gone forward
+		{"summer time", time.Date(2026, 3, 30, 16, 30, 0, 0, time.UTC), london, cutoff, "2026-03-31"},
+		{"before the clocks go forward", time.Date(2026, 3, 27, 16, 30, 0, 0, time.UTC), london, cutoff, "2026-03-27"},
+	}
+	for _, tt := range tests {
+		if got := c.ValueDate(tt.at, tt.loc, tt.cutoff).Format(DateLayout); got != tt.want {
+			t.Errorf("%s: value date %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time as seen by the tenant in ctx
+type Clock interface {
+	Now(ctx context.Context) time.Time
+}
+
+// System is the real clock
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now(context.Context) time.Time { return time.Now() }
+
+// Advancer is a Clock that can run some tenants ahead of real time
+type Advancer interface {
+	Clock
+	// Ahead returns the current time of every tenant whose clock runs ahead
+	Ahead(ctx context.Context) map[string]time.Time
+}
+
+// Ahead returns the tenants c runs ahead of real time and their current time; nil for clocks that can't
+func Ahead(ctx context.Context, c Clock) map[string]time.Time {
+	if a, ok := c.(Advancer); ok {
+		return a.Ahead(ctx)
+	}
+	return nil
+}
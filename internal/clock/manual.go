@@ -0,0 +1,39 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Manual is a clock that only moves when told to, for deterministic tests
+type Manual struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// creates a new Manual clock stopped at now
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+// Now returns the time the clock is stopped at, for every tenant
+func (c *Manual) Now(context.Context) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set stops the clock at t
+func (c *Manual) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d
+func (c *Manual) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
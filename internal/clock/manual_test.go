@@ -0,0 +1,38 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	c := NewManual(start)
+	ctx := context.Background()
+
+	if got := c.Now(ctx); !got.Equal(start) {
+		t.Fatalf("started at %s, want %s", got, start)
+	}
+	if got := c.Now(ctx); !got.Equal(start) {
+		t.Fatalf("moved on its own to %s", got)
+	}
+
+	c.Advance(90 * time.Minute)
+	if got, want := c.Now(ctx), start.Add(90*time.Minute); !got.Equal(want) {
+		t.Fatalf("advanced to %s, want %s", got, want)
+	}
+
+	// every tenant sees the same time
+	if got, want := c.Now(tenant.WithTenant(ctx, "acme~sandbox")), start.Add(90*time.Minute); !got.Equal(want) {
+		t.Fatalf("sandbox sees %s, want %s", got, want)
+	}
+
+	earlier := start.Add(-time.Hour)
+	c.Set(earlier)
+	if got := c.Now(ctx); !got.Equal(earlier) {
+		t.Fatalf("set to %s, want %s", got, earlier)
+	}
+}
@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// how long offsets are served from memory before they are read again
+const refreshInterval = 2 * time.Second
+
+// OffsetSource loads how far each sandbox tenant's clock has been advanced
+type OffsetSource func(ctx context.Context) (map[string]time.Duration, error)
+
+// Simulated runs each sandbox tenant's clock ahead of real time by the offset it has advanced it by
+// live tenants always see real time
+type Simulated struct {
+	source OffsetSource
+
+	mu        sync.Mutex
+	offsets   map[string]time.Duration
+	checkedAt time.Time
+}
+
+// creates a new Simulated clock
+func NewSimulated(source OffsetSource) *Simulated {
+	return &Simulated{source: source, offsets: map[string]time.Duration{}}
+}
+
+// Now returns real time moved on by the offset of the sandbox tenant in ctx
+func (c *Simulated) Now(ctx context.Context) time.Time {
+	now := time.Now()
+	id, _ := tenant.FromContext(ctx)
+	if !tenant.IsSandbox(id) {
+		return now
+	}
+	return now.Add(c.load(ctx)[id])
+}
+
+// Ahead returns the current time of every sandbox tenant that has advanced its clock
+func (c *Simulated) Ahead(ctx context.Context) map[string]time.Time {
+	now := time.Now()
+	ahead := make(map[string]time.Time)
+	for id, offset := range c.load(ctx) {
+		if offset > 0 && tenant.IsSandbox(id) {
+			ahead[id] = now.Add(offset)
+		}
+	}
+	return ahead
+}
+
+// Set records a tenant's new offset locally, so this replica sees it before the next refresh
+func (c *Simulated) Set(tenantID string, offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offsets := make(map[string]time.Duration, len(c.offsets)+1)
+	for id, o := range c.offsets {
+		offsets[id] = o
+	}
+	offsets[tenantID] = offset
+	c.offsets = offsets
+}
+
+// load returns the offsets, re-reading them at most every refreshInterval
+// when the read fails the last known offsets are kept
+func (c *Simulated) load(ctx context.Context) map[string]time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checkedAt) < refreshInterval {
+		return c.offsets
+	}
+	c.checkedAt = time.Now()
+
+	offsets, err := c.source(ctx)
+	if err != nil {
+		log.Printf("Failed to read sandbox clocks, keeping the last known offsets: %v", err)
+		return c.offsets
+	}
+	c.offsets = offsets
+	return c.offsets
+}
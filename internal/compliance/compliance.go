@@ -0,0 +1,197 @@
+package compliance
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// Thresholds are the reporting thresholds per currency, in major units
+type Thresholds struct {
+	// Default applies to currencies without their own threshold
+	Default    float64
+	ByCurrency map[string]float64
+}
+
+// ParseThresholds reads a list such as "USD=10000,EUR=10000,GBP=8000"
+func ParseThresholds(s string, defaultThreshold float64) (Thresholds, error) {
+	t := Thresholds{Default: defaultThreshold, ByCurrency: map[string]float64{}}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return t, fmt.Errorf("invalid threshold %q, expected CURRENCY=amount", part)
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if _, known := money.Lookup(code); !known {
+			return t, fmt.Errorf("invalid currency code: %s", code)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || amount <= 0 {
+			return t, fmt.Errorf("invalid threshold amount for %s: %s", code, value)
+		}
+		t.ByCurrency[code] = amount
+	}
+	return t, nil
+}
+
+// For returns the reporting threshold of a currency
+func (t Thresholds) For(currency string) float64 {
+	if v, ok := t.ByCurrency[strings.ToUpper(currency)]; ok {
+		return v
+	}
+	return t.Default
+}
+
+// Rules configures the extract
+type Rules struct {
+	Thresholds Thresholds
+
+	// StructuringMargin is how far below the threshold, as a fraction of it, an amount counts as just below
+	StructuringMargin float64
+
+	// StructuringCount is how many just-below amounts in a day are flagged as possible structuring
+	StructuringCount int
+}
+
+const (
+	// DirectionIn covers deposits and transfers received
+	DirectionIn = "in"
+
+	// DirectionOut covers withdrawals and transfers sent
+	DirectionOut = "out"
+)
+
+type bucketKey struct {
+	date, accountID, direction string
+}
+
+type bucket struct {
+	total     float64
+	ids       []string
+	near      []string
+	nearTotal float64
+}
+
+// Analyze groups completed transactions per account, UTC day and direction and returns the
+// days over the threshold and the days with possible structuring, ordered by date and account
+// currencyOf returns the currency of an account; accounts with an empty currency are skipped
+func Analyze(txs []*models.Transaction, currencyOf func(accountID string) string, rules Rules) []models.ComplianceFinding {
+	buckets := map[bucketKey]*bucket{}
+	add := func(key bucketKey, tx *models.Transaction, threshold float64) {
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{}
+			buckets[key] = b
+		}
+		b.total += tx.Amount
+		b.ids = append(b.ids, tx.ID)
+		if tx.Amount < threshold && tx.Amount >= threshold*(1-rules.StructuringMargin) {
+			b.near = append(b.near, tx.ID)
+			b.nearTotal += tx.Amount
+		}
+	}
+
+	for _, tx := range txs {
+		date := tx.CreatedAt.UTC().Format("2006-01-02")
+		switch tx.Type {
+		case models.Deposit:
+			if currency := currencyOf(tx.AccountID); currency != "" {
+				add(bucketKey{date, tx.AccountID, DirectionIn}, tx, rules.Thresholds.For(currency))
+			}
+		case models.Withdrawal:
+			if currency := currencyOf(tx.AccountID); currency != "" {
+				add(bucketKey{date, tx.AccountID, DirectionOut}, tx, rules.Thresholds.For(currency))
+			}
+		case models.Transfer:
+			if currency := currencyOf(tx.AccountID); currency != "" {
+				add(bucketKey{date, tx.AccountID, DirectionOut}, tx, rules.Thresholds.For(currency))
+			}
+			if currency := currencyOf(tx.CounterpartyAccountID); currency != "" && tx.CounterpartyAccountID != "" {
+				add(bucketKey{date, tx.CounterpartyAccountID, DirectionIn}, tx, rules.Thresholds.For(currency))
+			}
+		}
+	}
+
+	findings := []models.ComplianceFinding{}
+	for key, b := range buckets {
+		currency := currencyOf(key.accountID)
+		threshold := rules.Thresholds.For(currency)
+		finding := models.ComplianceFinding{
+			Date:      key.date,
+			AccountID: key.accountID,
+			Direction: key.direction,
+			Currency:  currency,
+			Threshold: threshold,
+		}
+		// sums of floats drift, so compare and report totals at the currency's precision
+		var rounding money.Policy
+		total := rounding.Round(b.total, currency)
+		if total > threshold {
+			ctr := finding
+			ctr.Kind = models.FindingCTR
+			ctr.Total, ctr.Count, ctr.TransactionIDs = total, len(b.ids), b.ids
+			findings = append(findings, ctr)
+		}
+		if rules.StructuringCount > 0 && len(b.near) >= rules.StructuringCount {
+			structuring := finding
+			structuring.Kind = models.FindingStructuring
+			structuring.Total, structuring.Count, structuring.TransactionIDs = rounding.Round(b.nearTotal, currency), len(b.near), b.near
+			findings = append(findings, structuring)
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return a.Kind < b.Kind
+	})
+	return findings
+}
+
+// WriteCSV writes findings as a CSV file for filing workflows; amounts use the currency's minor unit
+func WriteCSV(w io.Writer, findings []models.ComplianceFinding) error {
+	cw := csv.NewWriter(w)
+	header := []string{"kind", "date", "account_id", "direction", "currency", "threshold", "total", "count", "transaction_ids"}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write compliance header: %w", err)
+	}
+
+	for _, f := range findings {
+		exp := money.Exponent(f.Currency)
+		row := []string{
+			f.Kind,
+			f.Date,
+			f.AccountID,
+			f.Direction,
+			f.Currency,
+			strconv.FormatFloat(f.Threshold, 'f', exp, 64),
+			strconv.FormatFloat(f.Total, 'f', exp, 64),
+			strconv.Itoa(f.Count),
+			strings.Join(f.TransactionIDs, ";"),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write compliance finding: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
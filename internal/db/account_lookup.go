@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// retrieves the tenant's accounts among ids, keyed by id; ids the tenant has no account for are left out
+func (p *Postgres) GetAccounts(ctx context.Context, ids []string) (map[string]*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader(ctx).QueryContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE id = ANY($1) AND tenant_id = $2",
+		pq.Array(ids), tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]*models.Account, len(ids))
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts[account.ID] = account
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// retrieves the activity summaries of the given accounts, keyed by account id; accounts without applied
+// transactions get an empty summary
+func (p *Postgres) GetAccountSummaries(ctx context.Context, ids []string) (map[string]*models.AccountSummary, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader(ctx).QueryContext(ctx, `
+	SELECT account_id, total_deposits, total_withdrawals, transaction_count, last_transaction_at
+	FROM account_summaries
+	WHERE account_id = ANY($1) AND tenant_id = $2`,
+		pq.Array(ids), tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account summaries: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]*models.AccountSummary, len(ids))
+	for _, id := range ids {
+		summaries[id] = &models.AccountSummary{}
+	}
+	for rows.Next() {
+		var id string
+		var summary models.AccountSummary
+		var lastTransactionAt sql.NullTime
+		if err := rows.Scan(&id, &summary.TotalDeposits, &summary.TotalWithdrawals, &summary.TransactionCount, &lastTransactionAt); err != nil {
+			return nil, fmt.Errorf("failed to scan account summary: %w", err)
+		}
+		if lastTransactionAt.Valid {
+			summary.LastTransactionAt = &lastTransactionAt.Time
+		}
+		summaries[id] = &summary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get account summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// retrieves the promotional credits with a remaining amount of the given accounts, soonest expiry first, keyed by
+// account id; accounts without any are left out
+func (p *Postgres) GetCreditBucketsByAccounts(ctx context.Context, ids []string) (map[string][]*models.CreditBucket, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets, err := p.queryCreditBuckets(ctx,
+		"SELECT "+creditBucketColumns+" FROM credit_buckets WHERE account_id = ANY($1) AND tenant_id = $2 AND remaining > 0 ORDER BY expires_at, id",
+		pq.Array(ids), tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	byAccount := make(map[string][]*models.CreditBucket)
+	for _, bucket := range buckets {
+		byAccount[bucket.AccountID] = append(byAccount[bucket.AccountID], bucket)
+	}
+	return byAccount, nil
+}
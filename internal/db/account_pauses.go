@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// pauses processing for an account; pausing a paused account keeps the original pause
+// a new pause bumps the account's updated_at, and with IfVersion in ctx it only applies while the account is unchanged.
+// Returns the account's updated_at afterwards
+func (p *Postgres) PauseAccount(ctx context.Context, pause *models.AccountPause) (time.Time, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	pause.TenantID = tenantID
+	pause.PausedAt = p.clock.Now(ctx)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updatedAt, err := lockAccountVersion(ctx, tx, pause.AccountID, tenantID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	INSERT INTO account_pauses (account_id, tenant_id, reason, paused_by, paused_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (account_id) DO NOTHING`,
+		pause.AccountID, tenantID, pause.Reason, pause.PausedBy, pause.PausedAt,
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to pause account: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if updatedAt, err = touchAccount(ctx, tx, pause.AccountID, pause.PausedAt); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to pause account: %w", err)
+	}
+	return updatedAt, nil
+}
+
+// retrieves an account's pause, nil when the account isn't paused
+func (p *Postgres) GetAccountPause(ctx context.Context, accountID string) (*models.AccountPause, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pause models.AccountPause
+	err = p.db.QueryRowContext(ctx,
+		"SELECT account_id, tenant_id, reason, paused_by, paused_at FROM account_pauses WHERE account_id = $1 AND tenant_id = $2",
+		accountID, tenantID,
+	).Scan(&pause.AccountID, &pause.TenantID, &pause.Reason, &pause.PausedBy, &pause.PausedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get account pause: %w", err)
+	}
+
+	return &pause, nil
+}
+
+// returns the first of the given accounts that is paused, or "" when none is
+func (p *Postgres) FindPausedAccount(ctx context.Context, accountIDs ...string) (string, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = p.db.QueryRowContext(ctx,
+		"SELECT account_id FROM account_pauses WHERE account_id = ANY($1) AND tenant_id = $2 ORDER BY account_id LIMIT 1",
+		pq.Array(accountIDs), tenantID,
+	).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to check account pauses: %w", err)
+	}
+
+	return id, nil
+}
+
+// lifts an account's pause; lifting one bumps the account's updated_at, and with IfVersion in ctx it only applies
+// while the account is unchanged. Returns the account's updated_at afterwards
+func (p *Postgres) ResumeAccount(ctx context.Context, accountID string) (time.Time, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updatedAt, err := lockAccountVersion(ctx, tx, accountID, tenantID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM account_pauses WHERE account_id = $1 AND tenant_id = $2", accountID, tenantID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to resume account: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if updatedAt, err = touchAccount(ctx, tx, accountID, p.clock.Now(ctx)); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to resume account: %w", err)
+	}
+	return updatedAt, nil
+}
+
+// locks an account row for a change that isn't a balance update and returns its updated_at; fails with
+// ErrModified when the IfVersion in ctx is no longer the account's
+func lockAccountVersion(ctx context.Context, tx *sql.Tx, accountID, tenantID string) (time.Time, error) {
+	var updatedAt time.Time
+	err := tx.QueryRowContext(ctx,
+		"SELECT updated_at FROM accounts WHERE id = $1 AND tenant_id = $2 FOR UPDATE", accountID, tenantID,
+	).Scan(&updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, ErrAccountNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to lock account: %w", err)
+	}
+	if version, ok := expectedVersion(ctx); ok && !updatedAt.Equal(version) {
+		return time.Time{}, ErrModified
+	}
+	return updatedAt, nil
+}
+
+// bumps a locked account's updated_at so its version reflects a change to it
+func touchAccount(ctx context.Context, tx *sql.Tx, accountID string, now time.Time) (time.Time, error) {
+	var updatedAt time.Time
+	// updated_at never goes backwards, even when a balance update stamped it after now
+	err := tx.QueryRowContext(ctx,
+		"UPDATE accounts SET updated_at = GREATEST(updated_at + INTERVAL '1 microsecond', $2) WHERE id = $1 RETURNING updated_at",
+		accountID, now,
+	).Scan(&updatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to update account: %w", err)
+	}
+	return updatedAt, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// finds the tenant's accounts matching an external reference and/or every given metadata pair, oldest first
+// an empty externalReference or metadata is not filtered on
+func (p *Postgres) FindAccounts(ctx context.Context, externalReference string, metadata map[string]string, limit, offset int) ([]*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	contains, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata filter: %w", err)
+	}
+
+	// metadata @> '{}' matches every account, so a missing filter falls through to the reference
+	rows, err := p.reader(ctx).QueryContext(ctx, `
+	SELECT `+accountColumns+`
+	FROM accounts
+	WHERE tenant_id = $1 AND ($2 = '' OR external_reference = $2) AND metadata @> $3
+	ORDER BY created_at, id
+	LIMIT $4 OFFSET $5`,
+		tenantID, externalReference, contains, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []*models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find accounts: %w", err)
+	}
+
+	return accounts, nil
+}
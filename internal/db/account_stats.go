@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// bucketFormats are the $dateToString formats that key each kind of bucket
+var bucketFormats = map[models.StatsBucket]string{
+	models.BucketHour:    "%H",
+	models.BucketDay:     "%Y-%m-%d",
+	models.BucketWeekday: "%u",
+}
+
+// sums an account's completed activity created within [from, to) per bucket, in the given IANA timezone
+// weekday buckets are keyed 1 (Monday) to 7 (Sunday); buckets without activity are left out
+func (m *MongoDB) GetAccountActivityBuckets(ctx context.Context, accountID string, from, to time.Time, bucket models.StatsBucket, timezone string) ([]models.ActivityBucket, error) {
+	format, ok := bucketFormats[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket: %s", bucket)
+	}
+	filter, err := scoped(ctx, accountFilter(accountID))
+	if err != nil {
+		return nil, err
+	}
+	filter["status"] = models.Completed
+	filter["created_at"] = bson.M{"$gte": from, "$lt": to}
+
+	// money comes in on deposits, the opening balance and transfers where the account is the counterparty
+	incoming := bson.M{"$or": bson.A{
+		bson.M{"$in": bson.A{"$type", bson.A{models.Deposit, models.Opening}}},
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$type", models.Transfer}},
+			bson.M{"$eq": bson.A{"$counterparty_account_id", accountID}},
+		}},
+	}}
+	fee := bson.M{"$ifNull": bson.A{"$fee", 0}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$project", Value: bson.M{
+			"key":      bson.M{"$dateToString": bson.M{"date": "$created_at", "format": format, "timezone": timezone}},
+			"incoming": incoming,
+			"amount":   "$amount",
+			// the sender pays the fee; a deposit's fee comes out of what it credits
+			"fee": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$type", models.Transfer}}, incoming}}, 0, fee,
+			}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":            "$key",
+			"count":          bson.M{"$sum": 1},
+			"incoming_count": bson.M{"$sum": bson.M{"$cond": bson.A{"$incoming", 1, 0}}},
+			"outgoing_count": bson.M{"$sum": bson.M{"$cond": bson.A{"$incoming", 0, 1}}},
+			"incoming":       bson.M{"$sum": bson.M{"$cond": bson.A{"$incoming", "$amount", 0}}},
+			"outgoing": bson.M{"$sum": bson.M{"$cond": bson.A{
+				"$incoming", "$fee", bson.M{"$add": bson.A{"$amount", "$fee"}},
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate account activity: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []models.ActivityBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, fmt.Errorf("failed to decode account activity: %w", err)
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// adds one applied transaction to an account's activity summary, inside the transaction that moved the balance
+// credited and debited are the amounts that entered and left the account (fees count as debited)
+func recordActivity(ctx context.Context, tx *sql.Tx, tenantID, accountID string, credited, debited float64, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO account_summaries (account_id, tenant_id, total_deposits, total_withdrawals, transaction_count, last_transaction_at, updated_at)
+	VALUES ($1, $2, $3, $4, 1, $5, $5)
+	ON CONFLICT (account_id) DO UPDATE SET
+		total_deposits = account_summaries.total_deposits + EXCLUDED.total_deposits,
+		total_withdrawals = account_summaries.total_withdrawals + EXCLUDED.total_withdrawals,
+		transaction_count = account_summaries.transaction_count + 1,
+		last_transaction_at = GREATEST(account_summaries.last_transaction_at, EXCLUDED.last_transaction_at),
+		updated_at = EXCLUDED.updated_at`,
+		accountID, tenantID, credited, debited, at,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update account summary: %w", err)
+	}
+	return nil
+}
+
+// retrieves an account's activity summary; accounts without applied transactions get an empty summary
+func (p *Postgres) GetAccountSummary(ctx context.Context, accountID string) (*models.AccountSummary, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary models.AccountSummary
+	var lastTransactionAt sql.NullTime
+	err = p.reader(ctx).QueryRowContext(ctx, `
+	SELECT total_deposits, total_withdrawals, transaction_count, last_transaction_at
+	FROM account_summaries
+	WHERE account_id = $1 AND tenant_id = $2`,
+		accountID, tenantID,
+	).Scan(&summary.TotalDeposits, &summary.TotalWithdrawals, &summary.TransactionCount, &lastTransactionAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AccountSummary{}, nil
+		}
+		return nil, fmt.Errorf("failed to get account summary: %w", err)
+	}
+	if lastTransactionAt.Valid {
+		summary.LastTransactionAt = &lastTransactionAt.Time
+	}
+
+	return &summary, nil
+}
+
+// replaces an account's activity summary, e.g. with totals recomputed from its transaction history
+func (p *Postgres) SetAccountSummary(ctx context.Context, accountID string, summary *models.AccountSummary) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+	INSERT INTO account_summaries (account_id, tenant_id, total_deposits, total_withdrawals, transaction_count, last_transaction_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (account_id) DO UPDATE SET
+		total_deposits = EXCLUDED.total_deposits,
+		total_withdrawals = EXCLUDED.total_withdrawals,
+		transaction_count = EXCLUDED.transaction_count,
+		last_transaction_at = EXCLUDED.last_transaction_at,
+		updated_at = EXCLUDED.updated_at`,
+		accountID, tenantID, summary.TotalDeposits, summary.TotalWithdrawals, summary.TransactionCount, summary.LastTransactionAt, p.clock.Now(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set account summary: %w", err)
+	}
+	return nil
+}
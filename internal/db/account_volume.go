@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// returns what an account has sent on day
+func (p *Postgres) GetAccountVolume(ctx context.Context, accountID string, day time.Time) (float64, error) {
+	var amount float64
+	err := p.db.QueryRowContext(ctx, "SELECT amount FROM account_volume WHERE account_id = $1 AND day = $2", accountID, day).Scan(&amount)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get account volume: %w", err)
+	}
+	return amount, nil
+}
+
+// ReserveAccountVolume adds amount to what an account sent on day, unless that would take it past limit; reserved
+// is false, and nothing added, when it would. Concurrent reservations for one account can't overshoot the limit
+// together
+func (p *Postgres) ReserveAccountVolume(ctx context.Context, accountID string, day time.Time, amount, limit float64) (reserved bool, err error) {
+	if amount > limit {
+		return false, nil
+	}
+	query := `
+	INSERT INTO account_volume (account_id, day, amount)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (account_id, day) DO UPDATE SET amount = account_volume.amount + EXCLUDED.amount
+	WHERE account_volume.amount + EXCLUDED.amount <= $4`
+
+	result, err := p.db.ExecContext(ctx, query, accountID, day, amount, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve account volume: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve account volume: %w", err)
+	}
+	return n == 1, nil
+}
+
+// gives back volume reserved for an account on day, for a transaction that wasn't stored after all
+func (p *Postgres) ReleaseAccountVolume(ctx context.Context, accountID string, day time.Time, amount float64) error {
+	_, err := p.db.ExecContext(ctx,
+		"UPDATE account_volume SET amount = GREATEST(amount - $3, 0) WHERE account_id = $1 AND day = $2",
+		accountID, day, amount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release account volume: %w", err)
+	}
+	return nil
+}
+
+// deletes the daily account volumes of days before day
+func (p *Postgres) DeleteAccountVolumeBefore(ctx context.Context, day time.Time) (int64, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM account_volume WHERE day < $1", day)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete account volume: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveAccountVolumeConcurrently(t *testing.T) {
+	p := testPostgres(t)
+	ctx := context.Background()
+	account := fmt.Sprintf("account-%x", time.Now().UnixNano())
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := p.ReserveAccountVolume(ctx, account, day, 10, 100)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 10 {
+		t.Fatalf("%d reservations of 10 succeeded against a limit of 100, want 10", reserved)
+	}
+
+	// released volume can be sent again the same day
+	if err := p.ReleaseAccountVolume(ctx, account, day, 10); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.ReserveAccountVolume(ctx, account, day, 10, 100); err != nil || !ok {
+		t.Fatalf("after release: reserved %v, err %v", ok, err)
+	}
+}
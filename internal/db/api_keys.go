@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// stores a new API key for a tenant
+func (p *Postgres) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.CreatedAt = p.clock.Now(ctx)
+
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO api_keys (key_hash, tenant_id, name, sandbox, reference_namespace, back_dating, max_transaction_amount, max_daily_amount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		key.KeyHash, key.TenantID, key.Name, key.Sandbox, key.ReferenceNamespace, key.BackDating,
+		key.MaxTransactionAmount, key.MaxDailyAmount, key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// looks up the API key with the given hash; this is the one query that runs before
+// a tenant is known, so it is deliberately not tenant scoped
+func (p *Postgres) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := p.db.QueryRowContext(ctx,
+		`SELECT key_hash, tenant_id, name, sandbox, reference_namespace, back_dating, max_transaction_amount, max_daily_amount, created_at
+		FROM api_keys WHERE key_hash = $1`,
+		keyHash,
+	).Scan(&key.KeyHash, &key.TenantID, &key.Name, &key.Sandbox, &key.ReferenceNamespace, &key.BackDating,
+		&key.MaxTransactionAmount, &key.MaxDailyAmount, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// returns what a key has moved on day
+func (p *Postgres) GetAPIKeyVolume(ctx context.Context, keyHash string, day time.Time) (float64, error) {
+	var amount float64
+	err := p.db.QueryRowContext(ctx, "SELECT amount FROM api_key_volume WHERE key_hash = $1 AND day = $2", keyHash, day).Scan(&amount)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get api key volume: %w", err)
+	}
+	return amount, nil
+}
+
+// ReserveAPIKeyVolume adds amount to what a key moved on day, unless that would take it past limit; reserved is
+// false, and nothing added, when it would. Concurrent reservations for one key can't overshoot the limit together
+func (p *Postgres) ReserveAPIKeyVolume(ctx context.Context, keyHash string, day time.Time, amount, limit float64) (reserved bool, err error) {
+	if amount > limit {
+		return false, nil
+	}
+	query := `
+	INSERT INTO api_key_volume (key_hash, day, amount)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (key_hash, day) DO UPDATE SET amount = api_key_volume.amount + EXCLUDED.amount
+	WHERE api_key_volume.amount + EXCLUDED.amount <= $4`
+
+	result, err := p.db.ExecContext(ctx, query, keyHash, day, amount, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve api key volume: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve api key volume: %w", err)
+	}
+	return n == 1, nil
+}
+
+// gives back volume reserved for a key on day, for a transaction that wasn't stored after all
+func (p *Postgres) ReleaseAPIKeyVolume(ctx context.Context, keyHash string, day time.Time, amount float64) error {
+	_, err := p.db.ExecContext(ctx,
+		"UPDATE api_key_volume SET amount = GREATEST(amount - $3, 0) WHERE key_hash = $1 AND day = $2",
+		keyHash, day, amount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release api key volume: %w", err)
+	}
+	return nil
+}
+
+// deletes the daily key volumes of days before day
+func (p *Postgres) DeleteAPIKeyVolumeBefore(ctx context.Context, day time.Time) (int64, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM api_key_volume WHERE day < $1", day)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete api key volume: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connects to the database in TEST_POSTGRES_URL with the schema applied, skipping the test without one
+func testPostgres(t *testing.T) *Postgres {
+	t.Helper()
+
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	p, err := NewPostgres(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	if err := p.InitSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// a key hash no other run has used
+func testKeyHash(t *testing.T) string {
+	return fmt.Sprintf("%s-%x", t.Name(), time.Now().UnixNano())
+}
+
+func TestReserveAPIKeyVolumeAboveLimit(t *testing.T) {
+	// a single amount over the limit is refused before the database is asked
+	var p Postgres
+	reserved, err := p.ReserveAPIKeyVolume(context.Background(), "key", time.Now(), 150, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved {
+		t.Fatal("reserved an amount above the limit")
+	}
+}
+
+func TestReserveAPIKeyVolume(t *testing.T) {
+	p := testPostgres(t)
+	ctx := context.Background()
+	key := testKeyHash(t)
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		amount float64
+		want   bool
+	}{
+		{60, true},
+		{40, true},
+		{0.01, false},
+	}
+	for i, step := range steps {
+		reserved, err := p.ReserveAPIKeyVolume(ctx, key, day, step.amount, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserved != step.want {
+			t.Fatalf("step %d: reserved %v, want %v", i, reserved, step.want)
+		}
+	}
+
+	// another day starts from nothing
+	if reserved, err := p.ReserveAPIKeyVolume(ctx, key, day.AddDate(0, 0, 1), 100, 100); err != nil || !reserved {
+		t.Fatalf("next day: reserved %v, err %v", reserved, err)
+	}
+
+	// released volume can be reserved again, and releasing never goes below zero
+	if err := p.ReleaseAPIKeyVolume(ctx, key, day, 40); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, err := p.ReserveAPIKeyVolume(ctx, key, day, 40, 100); err != nil || !reserved {
+		t.Fatalf("after release: reserved %v, err %v", reserved, err)
+	}
+	if err := p.ReleaseAPIKeyVolume(ctx, key, day, 500); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, err := p.ReserveAPIKeyVolume(ctx, key, day, 100, 100); err != nil || !reserved {
+		t.Fatalf("after over-release: reserved %v, err %v", reserved, err)
+	}
+}
+
+func TestReserveAPIKeyVolumeConcurrently(t *testing.T) {
+	p := testPostgres(t)
+	ctx := context.Background()
+	key := testKeyHash(t)
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := p.ReserveAPIKeyVolume(ctx, key, day, 10, 100)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 10 {
+		t.Fatalf("%d reservations of 10 succeeded against a limit of 100, want 10", reserved)
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// every balance change records the transaction it applied in the same database transaction, so a transaction
+// processed again after its processor stopped part-way, or redelivered, never moves a balance twice
+
+// returns the balances recorded when the transaction was applied; ok is false when it hasn't been
+// must run inside a transaction that already holds the row lock of the transaction's account
+func appliedBalance(ctx context.Context, tx *sql.Tx, tenantID, transactionID string) (before, after float64, ok bool, err error) {
+	err = tx.QueryRowContext(ctx,
+		"SELECT balance_before, balance_after FROM applied_transactions WHERE transaction_id = $1 AND tenant_id = $2",
+		transactionID, tenantID,
+	).Scan(&before, &after)
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to check whether transaction was applied: %w", err)
+	}
+	return before, after, true, nil
+}
+
+// records that the transaction moved its account's balance from before to after
+func recordApplied(ctx context.Context, tx *sql.Tx, tenantID, transactionID string, before, after float64, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO applied_transactions (transaction_id, tenant_id, balance_before, balance_after, applied_at)
+	VALUES ($1, $2, $3, $4, $5)`,
+		transactionID, tenantID, before, after, now,
+	); err != nil {
+		return fmt.Errorf("failed to record applied transaction: %w", err)
+	}
+	return nil
+}
+
+// returns the balances a transaction moved its account between; ok is false when its balance change never
+// committed
+func (p *Postgres) GetAppliedBalance(ctx context.Context, transactionID string) (before, after float64, ok bool, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	err = p.db.QueryRowContext(ctx,
+		"SELECT balance_before, balance_after FROM applied_transactions WHERE transaction_id = $1 AND tenant_id = $2",
+		transactionID, tenantID,
+	).Scan(&before, &after)
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to get applied transaction: %w", err)
+	}
+	return before, after, true, nil
+}
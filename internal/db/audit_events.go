@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// records an audit event; events cover callers that never authenticated, so they are not tenant scoped
+func (p *Postgres) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	event.ID = p.ids.NewID()
+	event.CreatedAt = p.clock.Now(ctx)
+
+	_, err := p.db.ExecContext(ctx, `
+	INSERT INTO audit_events (id, kind, tenant_id, actor, credential, source, method, route, status, reason, request_id, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		event.ID, event.Kind, event.TenantID, event.Actor, event.Credential, event.Source, event.Method, event.Route,
+		event.Status, event.Reason, event.RequestID, event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves the audit events matching filter, most recent first
+func (p *Postgres) GetAuditEvents(ctx context.Context, filter models.AuditFilter, limit, offset int) ([]*models.AuditEvent, error) {
+	rows, err := p.reader(ctx).QueryContext(ctx, `
+	SELECT id, kind, tenant_id, actor, credential, source, method, route, status, reason, request_id, created_at
+	FROM audit_events
+	WHERE ($1 = '' OR kind = $1) AND ($2 = '' OR tenant_id = $2) AND ($3 = '' OR credential = $3)
+		AND ($4 = '' OR source = $4) AND created_at >= $5
+	ORDER BY created_at DESC, id
+	LIMIT $6 OFFSET $7`,
+		filter.Kind, filter.TenantID, filter.Credential, filter.Source, filter.Since, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Kind, &e.TenantID, &e.Actor, &e.Credential, &e.Source, &e.Method, &e.Route,
+			&e.Status, &e.Reason, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+// deletes audit events recorded before cutoff and returns how many were deleted
+func (p *Postgres) DeleteAuditEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM audit_events WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit events: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
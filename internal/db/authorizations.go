@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateAuthCode is returned when the tenant already has an authorization with the same auth code
+var ErrDuplicateAuthCode = errors.New("auth code already in use")
+
+// ErrAuthorizationNotFound is returned when the tenant has no authorization with the given ID
+var ErrAuthorizationNotFound = i18n.NewError("error.authorization_not_found", "authorization not found")
+
+const authorizationColumns = "id, tenant_id, account_id, hold_account_id, auth_code, merchant, amount, captured_amount, currency, status, decline_reason, expires_at, created_at, updated_at"
+
+func scanAuthorization(row rowScanner) (*models.Authorization, error) {
+	var a models.Authorization
+	if err := row.Scan(
+		&a.ID, &a.TenantID, &a.AccountID, &a.HoldAccountID, &a.AuthCode, &a.Merchant, &a.Amount, &a.CapturedAmount,
+		&a.Currency, &a.Status, &a.DeclineReason, &a.ExpiresAt, &a.CreatedAt, &a.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// creates a new authorization in the pending state
+func (p *Postgres) CreateAuthorization(ctx context.Context, a *models.Authorization) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.ID = p.ids.NewID()
+	a.TenantID = tenantID
+	a.Status = models.AuthorizationPending
+	now := p.clock.Now(ctx)
+	a.CreatedAt = now
+	a.UpdatedAt = now
+
+	query := `
+	INSERT INTO authorizations (` + authorizationColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		a.ID, a.TenantID, a.AccountID, a.HoldAccountID, a.AuthCode, a.Merchant, a.Amount, a.CapturedAmount,
+		a.Currency, a.Status, a.DeclineReason, a.ExpiresAt, a.CreatedAt, a.UpdatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("%w: %s", ErrDuplicateAuthCode, a.AuthCode)
+		}
+		return fmt.Errorf("failed to create authorization: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves an authorization by ID
+func (p *Postgres) GetAuthorization(ctx context.Context, id string) (*models.Authorization, error) {
+	return p.getAuthorization(ctx, "id", id)
+}
+
+// retrieves an authorization by the card processor's auth code, nil when there is none
+func (p *Postgres) GetAuthorizationByAuthCode(ctx context.Context, authCode string) (*models.Authorization, error) {
+	a, err := p.getAuthorization(ctx, "auth_code", authCode)
+	if err == ErrAuthorizationNotFound {
+		return nil, nil
+	}
+	return a, err
+}
+
+func (p *Postgres) getAuthorization(ctx context.Context, column, value string) (*models.Authorization, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := scanAuthorization(p.db.QueryRowContext(ctx,
+		"SELECT "+authorizationColumns+" FROM authorizations WHERE "+column+" = $1 AND tenant_id = $2", value, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAuthorizationNotFound
+		}
+		return nil, fmt.Errorf("failed to get authorization: %w", err)
+	}
+
+	return a, nil
+}
+
+// moves an authorization from one status to another, recording the decline reason and captured amount
+// that come with the new status; returns false if it was no longer in the from status
+func (p *Postgres) UpdateAuthorizationStatus(ctx context.Context, id string, from, to models.AuthorizationStatus, declineReason string, capturedAmount float64) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE authorizations SET status = $1, decline_reason = $2, captured_amount = $3, updated_at = $4 WHERE id = $5 AND tenant_id = $6 AND status = $7",
+		to, declineReason, capturedAmount, p.clock.Now(ctx), id, tenantID, from,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update authorization: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// retrieves approved authorizations past their expiry and timed-out ones still to be cleaned up, across all
+// tenants or only tenantID when set, for the scheduler; callers must scope further work to each TenantID
+func (p *Postgres) GetDueAuthorizations(ctx context.Context, tenantID string, now time.Time) ([]*models.Authorization, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT "+authorizationColumns+" FROM authorizations WHERE ((status = $1 AND expires_at <= $2) OR status = $3) AND ($4 = '' OR tenant_id = $4) ORDER BY created_at",
+		models.AuthorizationApproved, now, models.AuthorizationTimedOut, tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query authorizations: %w", err)
+	}
+	defer rows.Close()
+
+	authorizations := []*models.Authorization{}
+	for rows.Next() {
+		a, err := scanAuthorization(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan authorization: %w", err)
+		}
+		authorizations = append(authorizations, a)
+	}
+
+	return authorizations, rows.Err()
+}
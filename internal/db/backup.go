@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// an account with its activity summary, read from accounts a left joined with account_summaries s
+const exportedAccountColumns = `a.id, a.tenant_id, a.kind, a.currency, a.balance, a.kyc_status, a.kyc_reference, a.external_reference,
+		a.metadata, a.created_at, a.updated_at, s.total_deposits, s.total_withdrawals, s.transaction_count, s.last_transaction_at`
+
+// streams every account and its activity summary from one consistent snapshot and returns the snapshot time
+// not tenant scoped: it is only used by the backup command; an empty tenantID covers the whole platform
+func (p *Postgres) ExportAccounts(ctx context.Context, tenantID string, fn func(*models.Account, *models.AccountSummary) error) (time.Time, error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	// inside a repeatable read transaction now() is the moment the snapshot was taken
+	var snapshotAt time.Time
+	if err := tx.QueryRowContext(ctx, "SELECT now()").Scan(&snapshotAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read snapshot time: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT `+exportedAccountColumns+`
+	FROM accounts a
+	LEFT JOIN account_summaries s ON s.account_id = a.id
+	WHERE $1 = '' OR a.tenant_id = $1
+	ORDER BY a.tenant_id, a.created_at, a.id`,
+		tenantID,
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to export accounts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account, summary, err := scanExportedAccount(rows)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if err := fn(account, summary); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to export accounts: %w", err)
+	}
+
+	return snapshotAt, nil
+}
+
+// scans a row of exportedAccountColumns
+func scanExportedAccount(rows *sql.Rows) (*models.Account, *models.AccountSummary, error) {
+	var account models.Account
+	var metadata []byte
+	var deposits, withdrawals sql.NullFloat64
+	var count sql.NullInt64
+	var lastTransactionAt sql.NullTime
+	if err := rows.Scan(
+		&account.ID, &account.TenantID, &account.Kind, &account.Currency, &account.Balance,
+		&account.KYCStatus, &account.KYCReference, &account.ExternalReference, &metadata,
+		&account.CreatedAt, &account.UpdatedAt,
+		&deposits, &withdrawals, &count, &lastTransactionAt,
+	); err != nil {
+		return nil, nil, fmt.Errorf("failed to scan account: %w", err)
+	}
+	if err := json.Unmarshal(metadata, &account.Metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode account metadata: %w", err)
+	}
+
+	var summary *models.AccountSummary
+	if count.Valid {
+		summary = &models.AccountSummary{
+			TotalDeposits:    deposits.Float64,
+			TotalWithdrawals: withdrawals.Float64,
+			TransactionCount: count.Int64,
+		}
+		if lastTransactionAt.Valid {
+			summary.LastTransactionAt = &lastTransactionAt.Time
+		}
+	}
+	return &account, summary, nil
+}
+
+// writes an account and its activity summary from a backup, replacing whatever is stored under its id
+// not tenant scoped: it is only used by the backup command, which restores each account into its own tenant
+func (p *Postgres) RestoreAccount(ctx context.Context, account *models.Account, summary *models.AccountSummary) (err error) {
+	metadata := account.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode account metadata: %w", err)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO accounts (id, tenant_id, kind, currency, balance, kyc_status, kyc_reference, external_reference, metadata, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (id) DO UPDATE SET
+		tenant_id = EXCLUDED.tenant_id,
+		kind = EXCLUDED.kind,
+		currency = EXCLUDED.currency,
+		balance = EXCLUDED.balance,
+		kyc_status = EXCLUDED.kyc_status,
+		kyc_reference = EXCLUDED.kyc_reference,
+		external_reference = EXCLUDED.external_reference,
+		metadata = EXCLUDED.metadata,
+		created_at = EXCLUDED.created_at,
+		updated_at = EXCLUDED.updated_at`,
+		account.ID, account.TenantID, account.Kind, account.Currency, account.Balance, account.KYCStatus,
+		account.KYCReference, account.ExternalReference, encoded, account.CreatedAt, account.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+
+	if summary == nil {
+		_, err = tx.ExecContext(ctx, "DELETE FROM account_summaries WHERE account_id = $1", account.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO account_summaries (account_id, tenant_id, total_deposits, total_withdrawals, transaction_count, last_transaction_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (account_id) DO UPDATE SET
+			tenant_id = EXCLUDED.tenant_id,
+			total_deposits = EXCLUDED.total_deposits,
+			total_withdrawals = EXCLUDED.total_withdrawals,
+			transaction_count = EXCLUDED.transaction_count,
+			last_transaction_at = EXCLUDED.last_transaction_at,
+			updated_at = EXCLUDED.updated_at`,
+			account.ID, account.TenantID, summary.TotalDeposits, summary.TotalWithdrawals, summary.TransactionCount,
+			summary.LastTransactionAt, p.clock.Now(ctx),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore account summary: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
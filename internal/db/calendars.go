@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// lists the calendars with holidays stored, by code
+// calendars are platform settings: a currency's holidays are the same for every tenant, so not tenant scoped
+func (p *Postgres) GetCalendars(ctx context.Context) ([]*models.CalendarSummary, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT calendar_code, COUNT(*) FROM holidays GROUP BY calendar_code ORDER BY calendar_code",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calendars: %w", err)
+	}
+	defer rows.Close()
+
+	calendars := []*models.CalendarSummary{}
+	for rows.Next() {
+		var c models.CalendarSummary
+		if err := rows.Scan(&c.Code, &c.Holidays); err != nil {
+			return nil, fmt.Errorf("failed to scan calendar: %w", err)
+		}
+		calendars = append(calendars, &c)
+	}
+
+	return calendars, rows.Err()
+}
+
+// retrieves a calendar's holidays in date order; empty when it has none stored
+func (p *Postgres) GetHolidays(ctx context.Context, code string) ([]models.Holiday, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT date, name FROM holidays WHERE calendar_code = $1 ORDER BY date", code,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holidays: %w", err)
+	}
+	defer rows.Close()
+
+	holidays := []models.Holiday{}
+	for rows.Next() {
+		var date time.Time
+		var h models.Holiday
+		if err := rows.Scan(&date, &h.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan holiday: %w", err)
+		}
+		h.Date = date.Format("2006-01-02")
+		holidays = append(holidays, h)
+	}
+
+	return holidays, rows.Err()
+}
+
+// replaces a calendar's holidays; an empty list removes the calendar
+func (p *Postgres) ReplaceHolidays(ctx context.Context, code string, holidays []models.Holiday) (err error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM holidays WHERE calendar_code = $1", code); err != nil {
+		return fmt.Errorf("failed to clear holidays: %w", err)
+	}
+	for _, h := range holidays {
+		if _, err = tx.ExecContext(ctx,
+			"INSERT INTO holidays (calendar_code, date, name) VALUES ($1, $2, $3)", code, h.Date, h.Name,
+		); err != nil {
+			return fmt.Errorf("failed to save holiday %s: %w", h.Date, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit holidays: %w", err)
+	}
+	return nil
+}
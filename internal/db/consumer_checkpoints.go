@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// saves a consumer's checkpoint, replacing the one it saved before; consumers are platform wide, so not tenant
+// scoped
+func (p *Postgres) UpsertConsumerCheckpoint(ctx context.Context, cp *models.ConsumerCheckpoint) error {
+	cp.UpdatedAt = p.clock.Now(ctx)
+
+	_, err := p.db.ExecContext(ctx, `
+	INSERT INTO consumer_checkpoints (consumer, source, partition, last_offset, high_watermark, delivered, processed,
+		redelivered, last_message_id, last_queued_at, processed_at, started_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (consumer, source, partition) DO UPDATE SET
+		last_offset = EXCLUDED.last_offset,
+		high_watermark = EXCLUDED.high_watermark,
+		delivered = EXCLUDED.delivered,
+		processed = EXCLUDED.processed,
+		redelivered = EXCLUDED.redelivered,
+		last_message_id = EXCLUDED.last_message_id,
+		last_queued_at = EXCLUDED.last_queued_at,
+		processed_at = EXCLUDED.processed_at,
+		started_at = EXCLUDED.started_at,
+		updated_at = EXCLUDED.updated_at`,
+		cp.Consumer, cp.Source, cp.Partition, cp.Offset, cp.HighWatermark, cp.Delivered, cp.Processed,
+		cp.Redelivered, cp.LastMessageID, cp.LastQueuedAt, cp.ProcessedAt, cp.StartedAt, cp.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save consumer checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves the checkpoints saved since the given time, by source and partition, most recent first
+func (p *Postgres) GetConsumerCheckpoints(ctx context.Context, since time.Time) ([]*models.ConsumerCheckpoint, error) {
+	rows, err := p.db.QueryContext(ctx, `
+	SELECT consumer, source, partition, last_offset, high_watermark, delivered, processed, redelivered,
+		last_message_id, last_queued_at, processed_at, started_at, updated_at
+	FROM consumer_checkpoints
+	WHERE updated_at >= $1
+	ORDER BY source, partition, updated_at DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	checkpoints := []*models.ConsumerCheckpoint{}
+	for rows.Next() {
+		var cp models.ConsumerCheckpoint
+		var lastQueuedAt, processedAt sql.NullTime
+		if err := rows.Scan(
+			&cp.Consumer, &cp.Source, &cp.Partition, &cp.Offset, &cp.HighWatermark, &cp.Delivered, &cp.Processed,
+			&cp.Redelivered, &cp.LastMessageID, &lastQueuedAt, &processedAt, &cp.StartedAt, &cp.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan consumer checkpoint: %w", err)
+		}
+		if lastQueuedAt.Valid {
+			cp.LastQueuedAt = &lastQueuedAt.Time
+		}
+		if processedAt.Valid {
+			cp.ProcessedAt = &processedAt.Time
+		}
+		checkpoints = append(checkpoints, &cp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get consumer checkpoints: %w", err)
+	}
+
+	return checkpoints, nil
+}
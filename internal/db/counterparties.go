@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrCounterpartyNotFound is returned when the tenant has no counterparty with the given ID
+var ErrCounterpartyNotFound = i18n.NewError("error.unknown_counterparty", "counterparty not found")
+
+const counterpartyColumns = "id, tenant_id, name, identifiers, risk_rating, created_at, updated_at"
+
+func scanCounterparty(row rowScanner) (*models.Counterparty, error) {
+	var c models.Counterparty
+	var identifiers []byte
+	if err := row.Scan(&c.ID, &c.TenantID, &c.Name, &identifiers, &c.RiskRating, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(identifiers, &c.Identifiers); err != nil {
+		return nil, fmt.Errorf("failed to decode counterparty identifiers: %w", err)
+	}
+	return &c, nil
+}
+
+// creates a new counterparty
+func (p *Postgres) CreateCounterparty(ctx context.Context, c *models.Counterparty) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.ID = p.ids.NewID()
+	c.TenantID = tenantID
+	now := p.clock.Now(ctx)
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	if c.Identifiers == nil {
+		c.Identifiers = map[string]string{}
+	}
+	identifiers, err := json.Marshal(c.Identifiers)
+	if err != nil {
+		return fmt.Errorf("failed to encode counterparty identifiers: %w", err)
+	}
+
+	query := `
+	INSERT INTO counterparties (` + counterpartyColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		c.ID, c.TenantID, c.Name, identifiers, c.RiskRating, c.CreatedAt, c.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create counterparty: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves a counterparty by ID
+func (p *Postgres) GetCounterparty(ctx context.Context, id string) (*models.Counterparty, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := scanCounterparty(p.db.QueryRowContext(ctx,
+		"SELECT "+counterpartyColumns+" FROM counterparties WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCounterpartyNotFound
+		}
+		return nil, fmt.Errorf("failed to get counterparty: %w", err)
+	}
+
+	return c, nil
+}
+
+// retrieves the tenant's counterparties by ID, keyed by ID; unknown IDs are left out
+func (p *Postgres) GetCounterparties(ctx context.Context, ids []string) (map[string]*models.Counterparty, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := p.queryCounterparties(ctx,
+		"SELECT "+counterpartyColumns+" FROM counterparties WHERE id = ANY($1) AND tenant_id = $2",
+		pq.Array(ids), tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	counterparties := make(map[string]*models.Counterparty, len(found))
+	for _, c := range found {
+		counterparties[c.ID] = c
+	}
+	return counterparties, nil
+}
+
+// lists the tenant's counterparties by name, optionally only those with every given identifier
+func (p *Postgres) FindCounterparties(ctx context.Context, identifiers map[string]string, limit, offset int) ([]*models.Counterparty, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if identifiers == nil {
+		identifiers = map[string]string{}
+	}
+	contains, err := json.Marshal(identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode identifier filter: %w", err)
+	}
+
+	return p.queryCounterparties(ctx, `
+	SELECT `+counterpartyColumns+`
+	FROM counterparties
+	WHERE tenant_id = $1 AND identifiers @> $2
+	ORDER BY name, id
+	LIMIT $3 OFFSET $4`,
+		tenantID, contains, limit, offset,
+	)
+}
+
+func (p *Postgres) queryCounterparties(ctx context.Context, query string, args ...interface{}) ([]*models.Counterparty, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query counterparties: %w", err)
+	}
+	defer rows.Close()
+
+	counterparties := []*models.Counterparty{}
+	for rows.Next() {
+		c, err := scanCounterparty(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan counterparty: %w", err)
+		}
+		counterparties = append(counterparties, c)
+	}
+
+	return counterparties, rows.Err()
+}
+
+// saves a counterparty's name, identifiers and risk rating
+func (p *Postgres) UpdateCounterparty(ctx context.Context, c *models.Counterparty) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	identifiers, err := json.Marshal(c.Identifiers)
+	if err != nil {
+		return fmt.Errorf("failed to encode counterparty identifiers: %w", err)
+	}
+	c.UpdatedAt = p.clock.Now(ctx)
+
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE counterparties SET name = $1, identifiers = $2, risk_rating = $3, updated_at = $4 WHERE id = $5 AND tenant_id = $6",
+		c.Name, identifiers, c.RiskRating, c.UpdatedAt, c.ID, tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update counterparty: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCounterpartyNotFound
+	}
+	return nil
+}
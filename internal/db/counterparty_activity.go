@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sums the completed activity created within [from, to) per counterparty and account, optionally for one counterparty
+// deposits count as received from the counterparty, withdrawals and transfers as paid to it
+func (m *MongoDB) GetCounterpartyTotals(ctx context.Context, counterpartyID string, from, to time.Time) ([]models.CounterpartyAccountTotal, error) {
+	filter, err := scoped(ctx, bson.M{
+		"status":          models.Completed,
+		"created_at":      bson.M{"$gte": from, "$lt": to},
+		"counterparty_id": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if counterpartyID != "" {
+		filter["counterparty_id"] = counterpartyID
+	}
+
+	incoming := bson.M{"$in": bson.A{"$type", bson.A{models.Deposit, models.Opening}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"counterparty_id": "$counterparty_id", "account_id": "$account_id"},
+			"count":    bson.M{"$sum": 1},
+			"incoming": bson.M{"$sum": bson.M{"$cond": bson.A{incoming, "$amount", 0}}},
+			"outgoing": bson.M{"$sum": bson.M{"$cond": bson.A{incoming, 0, "$amount"}}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":             0,
+			"counterparty_id": "$_id.counterparty_id",
+			"account_id":      "$_id.account_id",
+			"count":           1,
+			"incoming":        1,
+			"outgoing":        1,
+		}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate counterparty activity: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	totals := []models.CounterpartyAccountTotal{}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, fmt.Errorf("failed to decode counterparty activity: %w", err)
+	}
+
+	return totals, nil
+}
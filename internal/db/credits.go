@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const creditBucketColumns = "id, tenant_id, account_id, transaction_id, amount, remaining, expires_at, created_at"
+
+func scanCreditBucket(row rowScanner) (*models.CreditBucket, error) {
+	var bucket models.CreditBucket
+	if err := row.Scan(
+		&bucket.ID, &bucket.TenantID, &bucket.AccountID, &bucket.TransactionID,
+		&bucket.Amount, &bucket.Remaining, &bucket.ExpiresAt, &bucket.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+// credits an account with amount less fee and records that as a promotional credit expiring at expiresAt;
+// the credit is funded from the interest expense account and the fee goes to fee income
+// granting is idempotent per transaction
+func (p *Postgres) GrantCredit(ctx context.Context, accountID, transactionID string, amount, fee float64, expiresAt time.Time) (balanceBefore, balanceAfter float64, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var balance float64
+	var currency string
+	err = tx.QueryRowContext(ctx,
+		"SELECT balance, currency FROM accounts WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		accountID, tenantID,
+	).Scan(&balance, &currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get current balance: %w", err)
+	}
+	if before, after, applied, checkErr := appliedBalance(ctx, tx, tenantID, transactionID); checkErr != nil {
+		err = checkErr
+		return 0, 0, err
+	} else if applied {
+		err = tx.Rollback()
+		return before, after, err
+	}
+
+	funded := amount
+	amount -= fee
+	now := p.clock.Now(ctx)
+	result, err := tx.ExecContext(ctx, `
+	INSERT INTO credit_buckets (`+creditBucketColumns+`, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $7)
+	ON CONFLICT (transaction_id) DO NOTHING`,
+		p.ids.NewID(), tenantID, accountID, transactionID, amount, expiresAt, now,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record credit: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// already granted; leave the balance alone
+		err = tx.Rollback()
+		return balance, balance, err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		"UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3",
+		balance+amount, now, accountID,
+	); err != nil {
+		return 0, 0, fmt.Errorf("failed to update balance: %w", err)
+	}
+	if err = recordActivity(ctx, tx, tenantID, accountID, amount, 0, now); err != nil {
+		return 0, 0, err
+	}
+	if err = p.postContra(ctx, tx, tenantID, models.InterestExpenseAccount, currency, -funded, now); err != nil {
+		return 0, 0, err
+	}
+	if err = p.postContra(ctx, tx, tenantID, models.FeeIncomeAccount, currency, fee, now); err != nil {
+		return 0, 0, err
+	}
+	if err = recordApplied(ctx, tx, tenantID, transactionID, balance, balance+amount, now); err != nil {
+		return 0, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return balance, balance + amount, nil
+}
+
+// spends up to amount of an account's promotional credit, soonest expiry first
+// must run inside a transaction that already holds the account's row lock
+func (p *Postgres) consumeCredits(ctx context.Context, tx *sql.Tx, accountID string, amount float64) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, remaining FROM credit_buckets WHERE account_id = $1 AND remaining > 0 ORDER BY expires_at, id FOR UPDATE",
+		accountID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock credits: %w", err)
+	}
+
+	type spend struct {
+		id        string
+		remaining float64
+	}
+	var spends []spend
+	for rows.Next() && amount > 0 {
+		var id string
+		var remaining float64
+		if err := rows.Scan(&id, &remaining); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read credit: %w", err)
+		}
+		used := math.Min(remaining, amount)
+		amount -= used
+		spends = append(spends, spend{id: id, remaining: remaining - used})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read credits: %w", err)
+	}
+
+	now := p.clock.Now(ctx)
+	for _, s := range spends {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE credit_buckets SET remaining = $1, updated_at = $2 WHERE id = $3",
+			s.remaining, now, s.id,
+		); err != nil {
+			return fmt.Errorf("failed to spend credit: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// retrieves an account's promotional credits that still have a remaining amount, soonest expiry first
+func (p *Postgres) GetCreditBuckets(ctx context.Context, accountID string) ([]*models.CreditBucket, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryCreditBuckets(ctx,
+		"SELECT "+creditBucketColumns+" FROM credit_buckets WHERE account_id = $1 AND tenant_id = $2 AND remaining > 0 ORDER BY expires_at, id",
+		accountID, tenantID,
+	)
+}
+
+// retrieves expired credits with an unspent remainder across all tenants or only tenantID when set, for the scheduler;
+// callers must scope further work to each bucket's TenantID
+func (p *Postgres) GetExpiredCreditBuckets(ctx context.Context, tenantID string, now time.Time, limit int) ([]*models.CreditBucket, error) {
+	return p.queryCreditBuckets(ctx,
+		"SELECT "+creditBucketColumns+" FROM credit_buckets WHERE remaining > 0 AND expires_at <= $1 AND ($3 = '' OR tenant_id = $3) ORDER BY expires_at LIMIT $2",
+		now, limit, tenantID,
+	)
+}
+
+func (p *Postgres) queryCreditBuckets(ctx context.Context, query string, args ...interface{}) ([]*models.CreditBucket, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credits: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []*models.CreditBucket{}
+	for rows.Next() {
+		bucket, err := scanCreditBucket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// removes a credit's unspent remainder from the account balance once it has expired by now, returning it to the
+// interest expense account
+// returns the amount reclaimed, which is zero when the credit was spent or reclaimed in the meantime
+func (p *Postgres) ReclaimCredit(ctx context.Context, bucket *models.CreditBucket, now time.Time) (reclaimed, balanceBefore, balanceAfter float64, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// account first, then credit: the same order withdrawals take the locks in
+	var balance float64
+	var currency string
+	err = tx.QueryRowContext(ctx,
+		"SELECT balance, currency FROM accounts WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		bucket.AccountID, tenantID,
+	).Scan(&balance, &currency)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to get current balance: %w", err)
+	}
+
+	var remaining float64
+	err = tx.QueryRowContext(ctx,
+		"SELECT remaining FROM credit_buckets WHERE id = $1 AND tenant_id = $2 AND expires_at <= $3 FOR UPDATE",
+		bucket.ID, tenantID, now,
+	).Scan(&remaining)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to lock credit: %w", err)
+	}
+
+	reclaimed = math.Min(remaining, balance)
+	if reclaimed <= 0 {
+		err = tx.Rollback()
+		return 0, balance, balance, err
+	}
+
+	updatedAt := p.clock.Now(ctx)
+	if _, err = tx.ExecContext(ctx, "UPDATE credit_buckets SET remaining = 0, updated_at = $1 WHERE id = $2", updatedAt, bucket.ID); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to reclaim credit: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3", balance-reclaimed, updatedAt, bucket.AccountID); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to update balance: %w", err)
+	}
+	if err = recordActivity(ctx, tx, tenantID, bucket.AccountID, 0, reclaimed, updatedAt); err != nil {
+		return 0, 0, 0, err
+	}
+	if err = p.postContra(ctx, tx, tenantID, models.InterestExpenseAccount, currency, reclaimed, updatedAt); err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return reclaimed, balance, balance - reclaimed, nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const escrowColumns = "id, tenant_id, payer_account_id, payee_account_id, escrow_account_id, amount, currency, reference, status, release_at, expires_at, created_at, updated_at"
+
+func scanEscrow(row rowScanner) (*models.Escrow, error) {
+	var escrow models.Escrow
+	var releaseAt sql.NullTime
+	if err := row.Scan(
+		&escrow.ID, &escrow.TenantID, &escrow.PayerAccountID, &escrow.PayeeAccountID, &escrow.EscrowAccountID,
+		&escrow.Amount, &escrow.Currency, &escrow.Reference, &escrow.Status, &releaseAt, &escrow.ExpiresAt,
+		&escrow.CreatedAt, &escrow.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if releaseAt.Valid {
+		escrow.ReleaseAt = &releaseAt.Time
+	}
+	return &escrow, nil
+}
+
+// creates a new escrow in the held state
+func (p *Postgres) CreateEscrow(ctx context.Context, escrow *models.Escrow) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	escrow.ID = p.ids.NewID()
+	escrow.TenantID = tenantID
+	escrow.Status = models.EscrowHeld
+	now := p.clock.Now(ctx)
+	escrow.CreatedAt = now
+	escrow.UpdatedAt = now
+
+	query := `
+	INSERT INTO escrows (` + escrowColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		escrow.ID, escrow.TenantID, escrow.PayerAccountID, escrow.PayeeAccountID, escrow.EscrowAccountID,
+		escrow.Amount, escrow.Currency, escrow.Reference, escrow.Status, escrow.ReleaseAt, escrow.ExpiresAt,
+		escrow.CreatedAt, escrow.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create escrow: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves an escrow by ID
+func (p *Postgres) GetEscrow(ctx context.Context, id string) (*models.Escrow, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	escrow, err := scanEscrow(p.db.QueryRowContext(ctx,
+		"SELECT "+escrowColumns+" FROM escrows WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrEscrowNotFound
+		}
+		return nil, fmt.Errorf("failed to get escrow: %w", err)
+	}
+
+	return escrow, nil
+}
+
+// moves an escrow from one status to another; returns false if it was no longer in the from status
+func (p *Postgres) UpdateEscrowStatus(ctx context.Context, id string, from, to models.EscrowStatus) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE escrows SET status = $1, updated_at = $2 WHERE id = $3 AND tenant_id = $4 AND status = $5",
+		to, p.clock.Now(ctx), id, tenantID, from,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update escrow: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// retrieves held escrows whose release time or expiry has passed, across all tenants or only tenantID when set,
+// for the scheduler; callers must scope further work to each escrow's TenantID
+func (p *Postgres) GetDueEscrows(ctx context.Context, tenantID string, now time.Time) ([]*models.Escrow, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT "+escrowColumns+" FROM escrows WHERE status = $1 AND (release_at <= $2 OR expires_at <= $2) AND ($3 = '' OR tenant_id = $3) ORDER BY created_at",
+		models.EscrowHeld, now, tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query escrows: %w", err)
+	}
+	defer rows.Close()
+
+	escrows := []*models.Escrow{}
+	for rows.Next() {
+		escrow, err := scanEscrow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan escrow: %w", err)
+		}
+		escrows = append(escrows, escrow)
+	}
+
+	return escrows, rows.Err()
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrExceptionNotFound is returned when the tenant has no exception with the given ID
+var ErrExceptionNotFound = i18n.NewError("error.exception_not_found", "exception not found")
+
+const exceptionColumns = "id, tenant_id, transaction_id, account_id, amount, currency, reason, status, reassigned_to, resolution_transaction_id, resolved_by, created_at, resolved_at"
+
+func scanException(row rowScanner) (*models.TransactionException, error) {
+	var e models.TransactionException
+	var resolvedAt sql.NullTime
+	if err := row.Scan(
+		&e.ID, &e.TenantID, &e.TransactionID, &e.AccountID, &e.Amount, &e.Currency, &e.Reason, &e.Status,
+		&e.ReassignedTo, &e.ResolutionTransactionID, &e.ResolvedBy, &e.CreatedAt, &resolvedAt,
+	); err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		e.ResolvedAt = &resolvedAt.Time
+	}
+	return &e, nil
+}
+
+// opens an exception for a deposit and posts its amount to the suspense account of its currency in the same
+// transaction; when a currency isn't known nothing is posted. A transaction gets at most one exception, so a
+// redelivered deposit doesn't post twice
+func (p *Postgres) OpenException(ctx context.Context, e *models.TransactionException) (err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.ID = p.ids.NewID()
+	e.TenantID = tenantID
+	e.Status = models.ExceptionOpen
+	now := p.clock.Now(ctx)
+	e.CreatedAt = now
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `
+	INSERT INTO transaction_exceptions (id, tenant_id, transaction_id, account_id, amount, currency, reason, status, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (tenant_id, transaction_id) DO NOTHING`,
+		e.ID, e.TenantID, e.TransactionID, e.AccountID, e.Amount, e.Currency, e.Reason, e.Status, e.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create exception: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 1 && e.Currency != "" {
+		if err = p.postContra(ctx, tx, tenantID, models.SuspenseAccount, e.Currency, e.Amount, now); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit exception: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves an exception by ID
+func (p *Postgres) GetException(ctx context.Context, id string) (*models.TransactionException, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := scanException(p.db.QueryRowContext(ctx,
+		"SELECT "+exceptionColumns+" FROM transaction_exceptions WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExceptionNotFound
+		}
+		return nil, fmt.Errorf("failed to get exception: %w", err)
+	}
+
+	return e, nil
+}
+
+// lists the tenant's exceptions, oldest first; an empty status lists them all
+func (p *Postgres) GetExceptions(ctx context.Context, status models.ExceptionStatus, limit, offset int) ([]*models.TransactionException, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader(ctx).QueryContext(ctx,
+		"SELECT "+exceptionColumns+" FROM transaction_exceptions WHERE tenant_id = $1 AND ($2 = '' OR status = $2) ORDER BY created_at, id LIMIT $3 OFFSET $4",
+		tenantID, status, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exceptions: %w", err)
+	}
+	defer rows.Close()
+
+	exceptions := []*models.TransactionException{}
+	for rows.Next() {
+		e, err := scanException(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exception: %w", err)
+		}
+		exceptions = append(exceptions, e)
+	}
+
+	return exceptions, rows.Err()
+}
+
+// records how an open exception was resolved; returns false if it was no longer open
+func (p *Postgres) ResolveException(ctx context.Context, e *models.TransactionException) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	now := p.clock.Now(ctx)
+	result, err := p.db.ExecContext(ctx, `
+	UPDATE transaction_exceptions
+	SET status = $1, reassigned_to = $2, resolution_transaction_id = $3, resolved_by = $4, resolved_at = $5
+	WHERE id = $6 AND tenant_id = $7 AND status = $8`,
+		e.Status, e.ReassignedTo, e.ResolutionTransactionID, e.ResolvedBy, now, e.ID, tenantID, models.ExceptionOpen,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve exception: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n == 1 {
+		e.ResolvedAt = &now
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrExportNotFound is returned when the tenant has no export with the given ID
+var ErrExportNotFound = i18n.NewError("error.export_not_found", "export not found")
+
+// ErrExportLost is returned when a worker updates an export another worker has claimed since
+var ErrExportLost = errors.New("export was claimed by another worker")
+
+const exportJobColumns = "id, tenant_id, kind, format, account_id, period_from, period_to, status, done, total, error, filename, content_type, size, checksum, created_at, updated_at, started_at, completed_at, expires_at"
+
+func scanExportJob(row rowScanner) (*models.ExportJob, error) {
+	var job models.ExportJob
+	var startedAt, completedAt, expiresAt sql.NullTime
+	if err := row.Scan(
+		&job.ID, &job.TenantID, &job.Kind, &job.Format, &job.AccountID, &job.From, &job.To, &job.Status, &job.Done, &job.Total,
+		&job.Error, &job.Filename, &job.ContentType, &job.Size, &job.Checksum, &job.CreatedAt, &job.UpdatedAt, &startedAt, &completedAt, &expiresAt,
+	); err != nil {
+		return nil, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	return &job, nil
+}
+
+// queues an export for the tenant
+func (p *Postgres) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	job.ID = p.ids.NewID()
+	job.TenantID = tenantID
+	job.Status = models.ExportQueued
+	job.CreatedAt = p.clock.Now(ctx)
+	job.UpdatedAt = job.CreatedAt
+
+	_, err = p.db.ExecContext(ctx, `
+	INSERT INTO export_jobs (id, tenant_id, kind, format, account_id, period_from, period_to, status, total, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		job.ID, job.TenantID, job.Kind, job.Format, job.AccountID, job.From, job.To, job.Status, job.Total, job.CreatedAt, job.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves an export by ID
+func (p *Postgres) GetExportJob(ctx context.Context, id string) (*models.ExportJob, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := scanExportJob(p.db.QueryRowContext(ctx,
+		"SELECT "+exportJobColumns+" FROM export_jobs WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExportNotFound
+		}
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+
+	return job, nil
+}
+
+// retrieves the artifact of a completed export, nil while it isn't completed
+func (p *Postgres) GetExportArtifact(ctx context.Context, id string) (*models.ExportArtifact, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var artifact models.ExportArtifact
+	var status models.ExportStatus
+	err = p.db.QueryRowContext(ctx,
+		"SELECT status, filename, content_type, COALESCE(artifact, ''), checksum, artifact_key FROM export_jobs WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	).Scan(&status, &artifact.Filename, &artifact.ContentType, &artifact.Content, &artifact.Checksum, &artifact.Key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrExportNotFound
+		}
+		return nil, fmt.Errorf("failed to get export artifact: %w", err)
+	}
+	if status != models.ExportCompleted {
+		return nil, nil
+	}
+
+	return &artifact, nil
+}
+
+// claims the oldest queued export of any tenant for a worker, or a running one whose worker reported no progress
+// for staleAfter, judged by the clock progress is stamped with; returns nil when there is none. The claim is the
+// new started_at, which the worker's later updates must still find
+func (p *Postgres) ClaimExportJob(ctx context.Context, staleAfter time.Duration) (*models.ExportJob, error) {
+	now := p.clock.Now(ctx)
+	staleBefore := now.Add(-staleAfter)
+	job, err := scanExportJob(p.db.QueryRowContext(ctx, `
+	UPDATE export_jobs SET status = $1, done = 0, started_at = $2, updated_at = $2
+	WHERE id = (
+		SELECT id FROM export_jobs
+		WHERE status = $3 OR (status = $1 AND updated_at < $4)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+exportJobColumns,
+		models.ExportRunning, now, models.ExportQueued, staleBefore,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim export: %w", err)
+	}
+
+	return job, nil
+}
+
+// records how far a claimed export got, which also tells other workers it is still being worked on
+func (p *Postgres) UpdateExportProgress(ctx context.Context, job *models.ExportJob) error {
+	return p.updateClaimedExport(ctx, job, "done = $3, total = $4, updated_at = $5",
+		job.Done, job.Total, p.clock.Now(ctx),
+	)
+}
+
+// completes a claimed export with its artifact, kept until expiresAt: the content itself, or the key of the blob
+// it was stored as with the content left out
+func (p *Postgres) CompleteExportJob(ctx context.Context, job *models.ExportJob, artifact *models.ExportArtifact, expiresAt time.Time) error {
+	now := p.clock.Now(ctx)
+	var content []byte
+	if artifact.Key == "" {
+		content = artifact.Content
+	}
+	return p.updateClaimedExport(ctx, job, `status = $3, done = total, filename = $4, content_type = $5, size = $6, artifact = $7,
+		artifact_key = $8, completed_at = $9, updated_at = $9, expires_at = $10, checksum = $11`,
+		models.ExportCompleted, artifact.Filename, artifact.ContentType, job.Size, content, artifact.Key, now, expiresAt, job.Checksum,
+	)
+}
+
+// fails a claimed export; the failure is kept until expiresAt so callers polling it learn why
+func (p *Postgres) FailExportJob(ctx context.Context, job *models.ExportJob, reason string, expiresAt time.Time) error {
+	now := p.clock.Now(ctx)
+	return p.updateClaimedExport(ctx, job, "status = $3, error = $4, completed_at = $5, updated_at = $5, expires_at = $6",
+		models.ExportFailed, reason, now, expiresAt,
+	)
+}
+
+// hands a claimed export back to the queue, e.g. when its worker shuts down
+func (p *Postgres) RequeueExportJob(ctx context.Context, job *models.ExportJob) error {
+	return p.updateClaimedExport(ctx, job, "status = $3, done = 0, started_at = NULL, updated_at = $4",
+		models.ExportQueued, p.clock.Now(ctx),
+	)
+}
+
+// updates an export only while the worker's claim on it stands; set uses arguments from $3
+func (p *Postgres) updateClaimedExport(ctx context.Context, job *models.ExportJob, set string, args ...interface{}) error {
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE export_jobs SET "+set+" WHERE id = $1 AND started_at = $2 AND status = '"+string(models.ExportRunning)+"'",
+		append([]interface{}{job.ID, job.StartedAt}, args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update export: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrExportLost
+	}
+	return nil
+}
+
+// deletes exports that expired before now, returning the keys of the stored blobs their artifacts leave behind
+func (p *Postgres) DeleteExpiredExports(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "DELETE FROM export_jobs WHERE expires_at < $1 RETURNING artifact_key", now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired exports: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan expired export: %w", err)
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
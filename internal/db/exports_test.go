@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// claims exports until it gets the one with id, reporting whether it did; other runs' jobs may be queued too
+func claimExport(t *testing.T, p *Postgres, id string, staleAfter time.Duration) bool {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		job, err := p.ClaimExportJob(context.Background(), staleAfter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil {
+			return false
+		}
+		if job.ID == id {
+			return true
+		}
+	}
+	t.Fatal("too many exports queued")
+	return false
+}
+
+func TestClaimExportJobJudgesStalenessByItsClock(t *testing.T) {
+	p := testPostgres(t)
+	// well behind real time, so real time would find every claim stale
+	manual := clock.NewManual(time.Date(2020, 3, 2, 9, 0, 0, 0, time.UTC))
+	p.SetClock(manual)
+
+	ctx := tenant.WithTenant(context.Background(), fmt.Sprintf("%s-%x", t.Name(), time.Now().UnixNano()))
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	job := &models.ExportJob{Kind: models.ExportJournal, Format: "json", From: day, To: day, Total: 1}
+	if err := p.CreateExportJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	if !claimExport(t, p, job.ID, 5*time.Minute) {
+		t.Fatal("the queued export was not claimed")
+	}
+	manual.Advance(4 * time.Minute)
+	if claimExport(t, p, job.ID, 5*time.Minute) {
+		t.Fatal("an export with recent progress was taken over")
+	}
+	manual.Advance(2 * time.Minute)
+	if !claimExport(t, p, job.ID, 5*time.Minute) {
+		t.Fatal("a stale export was not taken over")
+	}
+}
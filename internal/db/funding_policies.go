@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// retrieves the insufficient funds policy set on an account, nil when it has none of its own
+func (p *Postgres) GetAccountFundingPolicy(ctx context.Context, accountID string) (*models.AccountFundingPolicy, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy models.AccountFundingPolicy
+	var updatedAt sql.NullTime
+	err = p.db.QueryRowContext(ctx, `
+	SELECT account_id, tenant_id, mode, wait_hours, retry_interval_minutes, updated_at
+	FROM account_funding_policies
+	WHERE account_id = $1 AND tenant_id = $2`, accountID, tenantID).Scan(
+		&policy.AccountID, &policy.TenantID, &policy.InsufficientFunds.Mode, &policy.InsufficientFunds.WaitHours,
+		&policy.InsufficientFunds.RetryIntervalMinutes, &updatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get account funding policy: %w", err)
+	}
+	if updatedAt.Valid {
+		policy.UpdatedAt = &updatedAt.Time
+	}
+	policy.Source = models.FundingPolicyFromAccount
+
+	return &policy, nil
+}
+
+// creates or replaces the insufficient funds policy of an account
+func (p *Postgres) UpsertAccountFundingPolicy(ctx context.Context, policy *models.AccountFundingPolicy) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+	now := p.clock.Now(ctx)
+	policy.TenantID = tenantID
+	policy.UpdatedAt = &now
+
+	_, err = p.db.ExecContext(ctx, `
+	INSERT INTO account_funding_policies (account_id, tenant_id, mode, wait_hours, retry_interval_minutes, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (account_id) DO UPDATE SET
+		mode = EXCLUDED.mode,
+		wait_hours = EXCLUDED.wait_hours,
+		retry_interval_minutes = EXCLUDED.retry_interval_minutes,
+		updated_at = EXCLUDED.updated_at
+	WHERE account_funding_policies.tenant_id = EXCLUDED.tenant_id`,
+		policy.AccountID, policy.TenantID, policy.InsufficientFunds.Mode, policy.InsufficientFunds.WaitHours,
+		policy.InsufficientFunds.RetryIntervalMinutes, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save account funding policy: %w", err)
+	}
+
+	return nil
+}
+
+// removes the insufficient funds policy of an account, so the tenant's applies again
+func (p *Postgres) DeleteAccountFundingPolicy(ctx context.Context, accountID string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.db.ExecContext(ctx,
+		"DELETE FROM account_funding_policies WHERE account_id = $1 AND tenant_id = $2", accountID, tenantID,
+	); err != nil {
+		return fmt.Errorf("failed to delete account funding policy: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// LegBalance is the balance of a leg's account before and after the leg was applied
+type LegBalance struct {
+	Before float64
+	After  float64
+}
+
+// applies the legs of a transaction group in order in a single database transaction, so they all post or none do,
+// and returns each leg's account balances. As for single transactions, fees are taken from the leg's account on
+// top of its amount and credited to the fee income account, and a leg that would overdraw its account fails them all
+func (p *Postgres) ApplyLegs(ctx context.Context, legs []*models.Transaction) (balances []LegBalance, err error) {
+	err = conflictRetry.Do(ctx, func(ctx context.Context) (err error) {
+		balances, err = p.applyLegs(ctx, legs)
+		return err
+	})
+	return balances, err
+}
+
+func (p *Postgres) applyLegs(ctx context.Context, legs []*models.Transaction) (balances []LegBalance, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accountIDs := make([]string, 0, len(legs))
+	seen := make(map[string]bool, len(legs))
+	for _, leg := range legs {
+		for _, id := range []string{leg.AccountID, leg.CounterpartyAccountID} {
+			if id != "" && !seen[id] {
+				seen[id] = true
+				accountIDs = append(accountIDs, id)
+			}
+		}
+	}
+	sort.Strings(accountIDs)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Lock every row in a stable order so groups and transfers over the same accounts can't deadlock
+	current := make(map[string]float64, len(accountIDs))
+	currencies := make(map[string]string, len(accountIDs))
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id, balance, currency FROM accounts WHERE id = ANY($1) AND tenant_id = $2 ORDER BY id FOR UPDATE",
+		pq.Array(accountIDs), tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock accounts: %w", err)
+	}
+	for rows.Next() {
+		var id, currency string
+		var balance float64
+		if err = rows.Scan(&id, &balance, &currency); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read balance: %w", err)
+		}
+		current[id] = balance
+		currencies[id] = currency
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+
+	// the legs post together, so the first one having been applied means they all were
+	if len(legs) > 0 {
+		_, _, applied, checkErr := appliedBalance(ctx, tx, tenantID, legs[0].ID)
+		if checkErr != nil {
+			err = checkErr
+			return nil, err
+		}
+		if applied {
+			balances = make([]LegBalance, 0, len(legs))
+			for _, leg := range legs {
+				before, after, _, checkErr := appliedBalance(ctx, tx, tenantID, leg.ID)
+				if checkErr != nil {
+					err = checkErr
+					return nil, err
+				}
+				balances = append(balances, LegBalance{Before: before, After: after})
+			}
+			err = tx.Rollback()
+			return balances, err
+		}
+	}
+
+	now := p.clock.Now(ctx)
+	balances = make([]LegBalance, 0, len(legs))
+	for _, leg := range legs {
+		before, ok := current[leg.AccountID]
+		if !ok {
+			err = fmt.Errorf("leg %d: %w", leg.Leg, ErrAccountNotFound)
+			return nil, err
+		}
+
+		// deposits add to the account, withdrawals and transfers take from it, fees always reduce it
+		change := -leg.Amount - leg.Fee
+		if leg.Type == models.Deposit {
+			change = leg.Amount - leg.Fee
+		}
+		after := before + change
+		if after < 0 {
+			err = fmt.Errorf("leg %d: %w", leg.Leg, ErrInsufficientFunds)
+			return nil, err
+		}
+
+		// Debits spend promotional credit before cash
+		credited, debited := change, 0.0
+		if change < 0 {
+			credited, debited = 0, -change
+			if err = p.consumeCredits(ctx, tx, leg.AccountID, debited); err != nil {
+				return nil, err
+			}
+		}
+		current[leg.AccountID] = after
+		if err = recordActivity(ctx, tx, tenantID, leg.AccountID, credited, debited, now); err != nil {
+			return nil, err
+		}
+
+		if leg.Type == models.Transfer {
+			if _, ok := current[leg.CounterpartyAccountID]; !ok {
+				err = fmt.Errorf("leg %d: %w", leg.Leg, ErrCounterpartyAccountNotFound)
+				return nil, err
+			}
+			current[leg.CounterpartyAccountID] += leg.Amount
+			if err = recordActivity(ctx, tx, tenantID, leg.CounterpartyAccountID, leg.Amount, 0, now); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = p.postContra(ctx, tx, tenantID, models.FeeIncomeAccount, currencies[leg.AccountID], leg.Fee, now); err != nil {
+			return nil, err
+		}
+		if err = recordApplied(ctx, tx, tenantID, leg.ID, before, after, now); err != nil {
+			return nil, err
+		}
+		balances = append(balances, LegBalance{Before: before, After: after})
+	}
+
+	for _, id := range accountIDs {
+		if _, err = tx.ExecContext(ctx, "UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3", current[id], now, id); err != nil {
+			return nil, fmt.Errorf("failed to update balance: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, commitError(err)
+	}
+
+	return balances, nil
+}
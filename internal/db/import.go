@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// inserts an account migrated from a legacy system, keeping its original creation time, with a zero balance
+// an account already imported under the same external reference is returned instead, with created false
+func (p *Postgres) ImportAccount(ctx context.Context, externalReference, currency string, metadata map[string]string, openedAt time.Time) (account *models.Account, created bool, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode account metadata: %w", err)
+	}
+
+	account, err = scanAccount(p.db.QueryRowContext(ctx, `
+	INSERT INTO accounts (id, tenant_id, kind, currency, balance, external_reference, metadata, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8)
+	ON CONFLICT (tenant_id, external_reference) WHERE external_reference <> '' DO NOTHING
+	RETURNING `+accountColumns,
+		p.ids.NewID(), tenantID, models.CustomerAccount, currency, externalReference, encoded, openedAt, p.clock.Now(ctx),
+	))
+	if err == nil {
+		return account, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to import account: %w", err)
+	}
+
+	account, err = p.GetAccountByExternalReference(ctx, externalReference)
+	if err != nil {
+		return nil, false, err
+	}
+	return account, false, nil
+}
+
+// retrieves the tenant's account with the given external reference; returns nil when there is none
+func (p *Postgres) GetAccountByExternalReference(ctx context.Context, externalReference string) (*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := scanAccount(p.db.QueryRowContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE tenant_id = $1 AND external_reference = $2",
+		tenantID, externalReference,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get account by external reference: %w", err)
+	}
+
+	return account, nil
+}
+
+// sets an imported account's balance and activity summary to the totals of its replayed history
+// values are replaced rather than added, so importing the same history again is harmless
+func (p *Postgres) SetImportedBalance(ctx context.Context, accountID string, balance float64, summary models.AccountSummary) (err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := p.clock.Now(ctx)
+	res, err := tx.ExecContext(ctx,
+		"UPDATE accounts SET balance = $3, updated_at = $4 WHERE id = $1 AND tenant_id = $2",
+		accountID, tenantID, balance, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set account balance: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("account not found")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO account_summaries (account_id, tenant_id, total_deposits, total_withdrawals, transaction_count, last_transaction_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (account_id) DO UPDATE SET
+		total_deposits = EXCLUDED.total_deposits,
+		total_withdrawals = EXCLUDED.total_withdrawals,
+		transaction_count = EXCLUDED.transaction_count,
+		last_transaction_at = EXCLUDED.last_transaction_at,
+		updated_at = EXCLUDED.updated_at`,
+		accountID, tenantID, summary.TotalDeposits, summary.TotalWithdrawals, summary.TransactionCount, summary.LastTransactionAt, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set account summary: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// DefaultSlowQueryThreshold is how long a database operation may take before it is logged as slow
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// longest statement text a slow query log line carries
+const maxLoggedStatement = 500
+
+var (
+	postgresDuration = metrics.NewHistogramVec(
+		"ledger_postgres_query_duration_seconds",
+		"Time taken by Postgres statements, by operation (the statement kind and the table it works on).",
+		"operation", metrics.QueryBuckets,
+	)
+	mongoDuration = metrics.NewHistogramVec(
+		"ledger_mongo_command_duration_seconds",
+		"Time taken by MongoDB commands, by operation (the command and the collection it works on).",
+		"operation", metrics.QueryBuckets,
+	)
+	slowQueries = metrics.NewCounter(
+		"ledger_slow_queries_total",
+		"Postgres statements and MongoDB commands that took longer than the slow query threshold.",
+	)
+)
+
+// slowQueryThreshold is in nanoseconds; zero turns slow query logging off
+var slowQueryThreshold = int64(DefaultSlowQueryThreshold)
+
+// sets how long a database operation may take before it is logged as slow, for every connection; zero turns the
+// logging off but keeps the metrics
+func SetSlowQueryThreshold(d time.Duration) {
+	atomic.StoreInt64(&slowQueryThreshold, int64(d))
+}
+
+// observe records an operation's duration and logs it when it was slow; detail must not carry parameter values
+func observe(ctx context.Context, histogram *metrics.HistogramVec, operation string, took time.Duration, detail func() string) {
+	histogram.With(operation).Observe(took.Seconds())
+	if threshold := time.Duration(atomic.LoadInt64(&slowQueryThreshold)); threshold > 0 && took >= threshold {
+		slowQueries.Inc()
+		log.Printf("%sSlow query: %s took %s: %s", reqctx.LogPrefix(ctx), operation, took.Round(time.Millisecond), detail())
+	}
+}
+
+// opens a Postgres pool whose statements are timed
+func openInstrumented(connStr string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(connStr)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&timedConnector{connector: connector}), nil
+}
+
+// timedConnector hands out pq connections wrapped so every statement is timed
+type timedConnector struct {
+	connector driver.Connector
+}
+
+func (c *timedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: conn}, nil
+}
+
+func (c *timedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// timedConn times the statements and commits sent over a pq connection; errors are passed on untouched, so
+// callers can still inspect *pq.Error
+type timedConn struct {
+	driver.Conn
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	observeStatement(ctx, query, len(args), time.Since(start))
+	return rows, err
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	observeStatement(ctx, query, len(args), time.Since(start))
+	return result, err
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *timedConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+// timedTx times commits, where a transaction's deferred constraint checks and fsync happen
+type timedTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *timedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	observe(t.ctx, postgresDuration, "commit", time.Since(start), func() string { return "COMMIT" })
+	return err
+}
+
+func observeStatement(ctx context.Context, query string, args int, took time.Duration) {
+	observe(ctx, postgresDuration, statementOperation(query), took, func() string {
+		statement := strings.Join(strings.Fields(query), " ")
+		if len(statement) > maxLoggedStatement {
+			statement = statement[:maxLoggedStatement] + "..."
+		}
+		// the statement only carries placeholders; the values bound to them are left out
+		if args > 0 {
+			statement += fmt.Sprintf(" (%d parameters redacted)", args)
+		}
+		return statement
+	})
+}
+
+var (
+	statementTable = regexp.MustCompile(`(?is)\b(?:FROM|INTO|UPDATE|TABLE(?:\s+IF\s+(?:NOT\s+)?EXISTS)?|ON)\s+([a-z_][a-z0-9_]*)`)
+	operations     sync.Map
+)
+
+// statementOperation names a statement by its kind and the first table it names, e.g. "select accounts";
+// names are cached, since the ledger's statements are a fixed set
+func statementOperation(query string) string {
+	if name, ok := operations.Load(query); ok {
+		return name.(string)
+	}
+
+	fields := strings.Fields(query)
+	name := "unknown"
+	if len(fields) > 0 {
+		name = strings.ToLower(fields[0])
+		if match := statementTable.FindStringSubmatch(query); match != nil {
+			name += " " + strings.ToLower(match[1])
+		}
+	}
+	operations.Store(query, name)
+	return name
+}
+
+// returns a MongoDB command monitor that times every command
+func commandMonitor() *event.CommandMonitor {
+	type started struct {
+		operation string
+		shape     string
+		ctx       context.Context
+	}
+	var inFlight sync.Map
+
+	finished := func(e event.CommandFinishedEvent) {
+		value, ok := inFlight.LoadAndDelete(e.RequestID)
+		if !ok {
+			return
+		}
+		s := value.(started)
+		observe(s.ctx, mongoDuration, s.operation, e.Duration, func() string { return s.shape })
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			inFlight.Store(e.RequestID, started{
+				operation: commandOperation(e.CommandName, e.Command),
+				shape:     commandShape(e.Command),
+				ctx:       ctx,
+			})
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) { finished(e.CommandFinishedEvent) },
+		Failed:    func(_ context.Context, e *event.CommandFailedEvent) { finished(e.CommandFinishedEvent) },
+	}
+}
+
+// commandOperation names a command by its name and the collection it works on, e.g. "find transactions"
+func commandOperation(name string, command bson.Raw) string {
+	if collection, ok := command.Lookup(name).StringValueOK(); ok {
+		return name + " " + collection
+	}
+	return name
+}
+
+// command fields that say nothing about the query
+var commandPlumbing = map[string]bool{"lsid": true, "$db": true, "$clusterTime": true, "txnNumber": true, "$readPreference": true}
+
+// commandShape describes a command by its fields and the fields its filter matches on, leaving out every value
+func commandShape(command bson.Raw) string {
+	elements, err := command.Elements()
+	if err != nil {
+		return ""
+	}
+	var fields []string
+	for _, element := range elements {
+		key := element.Key()
+		if commandPlumbing[key] {
+			continue
+		}
+		if filter, ok := element.Value().DocumentOK(); ok && (key == "filter" || key == "query") {
+			var matched []string
+			if keys, err := filter.Elements(); err == nil {
+				for _, k := range keys {
+					matched = append(matched, k.Key())
+				}
+			}
+			key += "(" + strings.Join(matched, ", ") + ")"
+		}
+		fields = append(fields, key)
+	}
+	return strings.Join(fields, " ")
+}
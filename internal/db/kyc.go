@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// sets an account's KYC status and provider reference; with IfVersion in ctx, only while the account is unchanged
+func (p *Postgres) UpdateKYCStatus(ctx context.Context, accountID string, status models.KYCStatus, reference string) (*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE accounts SET kyc_status = $3, kyc_reference = $4, updated_at = $5
+	WHERE id = $1 AND tenant_id = $2`
+	args := []interface{}{accountID, tenantID, status, reference, p.clock.Now(ctx)}
+	version, conditional := expectedVersion(ctx)
+	if conditional {
+		query += " AND updated_at = $6"
+		args = append(args, version)
+	}
+	query += " RETURNING " + accountColumns
+
+	account, err := scanAccount(p.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if conditional {
+				return nil, p.conflictOrMissing(ctx, accountID, tenantID)
+			}
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to update kyc status: %w", err)
+	}
+
+	return account, nil
+}
+
+// explains why a conditional account update matched nothing: the account changed, or it doesn't exist
+func (p *Postgres) conflictOrMissing(ctx context.Context, accountID, tenantID string) error {
+	var exists bool
+	err := p.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND tenant_id = $2)",
+		accountID, tenantID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check account: %w", err)
+	}
+	if exists {
+		return ErrModified
+	}
+	return fmt.Errorf("account not found")
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// runs fn while holding a session-level advisory lock derived from key
+// returns ran=false without calling fn when another session holds the lock
+func (p *Postgres) RunExclusive(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error) {
+	// advisory locks belong to a session, so pin a single connection for lock and unlock
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key)
+
+	return true, fn(ctx)
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// retrieves the maintenance switch; it is a platform setting, so not tenant scoped
+func (p *Postgres) GetMaintenanceStatus(ctx context.Context) (*models.MaintenanceStatus, error) {
+	var status models.MaintenanceStatus
+	var startedAt sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		"SELECT enabled, message, started_at, updated_by, updated_at FROM maintenance_mode WHERE id",
+	).Scan(&status.Enabled, &status.Message, &startedAt, &status.UpdatedBy, &status.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &models.MaintenanceStatus{}, nil
+		}
+		return nil, fmt.Errorf("failed to get maintenance status: %w", err)
+	}
+	if startedAt.Valid {
+		status.StartedAt = &startedAt.Time
+	}
+
+	return &status, nil
+}
+
+// turns the maintenance switch on or off; started_at is kept while it stays on
+func (p *Postgres) SetMaintenanceStatus(ctx context.Context, status *models.MaintenanceStatus) error {
+	status.UpdatedAt = p.clock.Now(ctx)
+
+	err := p.db.QueryRowContext(ctx, `
+	INSERT INTO maintenance_mode (id, enabled, message, started_at, updated_by, updated_at)
+	VALUES (TRUE, $1, $2, CASE WHEN $1 THEN $4::TIMESTAMP END, $3, $4)
+	ON CONFLICT (id) DO UPDATE SET
+		enabled = EXCLUDED.enabled,
+		message = EXCLUDED.message,
+		started_at = CASE
+			WHEN NOT EXCLUDED.enabled THEN NULL
+			WHEN maintenance_mode.enabled THEN maintenance_mode.started_at
+			ELSE EXCLUDED.started_at
+		END,
+		updated_by = EXCLUDED.updated_by,
+		updated_at = EXCLUDED.updated_at
+	RETURNING started_at`,
+		status.Enabled, status.Message, status.UpdatedBy, status.UpdatedAt,
+	).Scan(&status.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set maintenance status: %w", err)
+	}
+
+	return nil
+}
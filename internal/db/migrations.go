@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SchemaVersion is the schema version this build needs: the number of statements in schema
+var SchemaVersion = len(schema)
+
+// ErrSchemaTooOld is returned when the database hasn't been migrated to the version this build needs
+var ErrSchemaTooOld = errors.New("database schema is too old")
+
+// migrationLock is the advisory lock held while migrating, so replicas starting together apply each step once
+const migrationLock = "ledger:schema-migrations"
+
+// how long a migration waits for a table lock before giving up, so it never queues traffic behind it for long
+const migrationLockTimeout = "5s"
+
+// the schema version is kept apart from the migrations so it exists before the first one runs
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+	id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+	version INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);`
+
+// statements that break replicas still running the previous build during a rolling deploy
+var incompatibleMigrations = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`(?is)\bDROP\s+(TABLE|COLUMN)\b`), "drops a table or column the previous build still reads"},
+	{regexp.MustCompile(`(?is)\bRENAME\b`), "renames something the previous build still uses"},
+	{regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\b`), "changes a column type in place"},
+	{regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+SET\s+NOT\s+NULL\b`), "makes a column the previous build doesn't write required"},
+}
+
+// widening a money column to NUMERIC(24, 4) keeps every value the previous build wrote and reads back, so the
+// type change rule lets it through
+var widenMoneyColumn = regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\s+NUMERIC\s*\(\s*24\s*,\s*4\s*\)`)
+
+// a NOT NULL column without a default fails the previous build's inserts, which don't name it
+var (
+	notNullColumn = regexp.MustCompile(`(?is)\bADD\s+COLUMN\b.*\bNOT\s+NULL\b`)
+	columnDefault = regexp.MustCompile(`(?is)\bDEFAULT\b`)
+)
+
+// checkCompatible refuses a migration the previous build couldn't keep running against
+func checkCompatible(version int, statement string) error {
+	checked := widenMoneyColumn.ReplaceAllString(statement, "")
+	for _, rule := range incompatibleMigrations {
+		if rule.pattern.MatchString(checked) {
+			return fmt.Errorf("migration %d is not backward compatible: it %s", version, rule.reason)
+		}
+	}
+	if notNullColumn.MatchString(statement) && !columnDefault.MatchString(statement) {
+		return fmt.Errorf("migration %d is not backward compatible: it adds a NOT NULL column without a default", version)
+	}
+	return nil
+}
+
+// applies the schema migrations the database hasn't had yet, in order, each in its own transaction
+// together with the version bump; an advisory lock makes replicas starting together wait for each other
+func (p *Postgres) InitSchema(ctx context.Context) error {
+	// advisory locks belong to a session, so pin a single connection for lock, migrations and unlock
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLock); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", migrationLock)
+
+	if _, err := conn.ExecContext(ctx, schemaVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		// a newer build has migrated already; its changes are additive, so this one keeps working
+		log.Printf("Database schema is at version %d, ahead of this build's %d; leaving it as it is", current, SchemaVersion)
+		return nil
+	}
+
+	for version := current + 1; version <= SchemaVersion; version++ {
+		statement := schema[version-1]
+		if err := checkCompatible(version, statement); err != nil {
+			return err
+		}
+		if err := applyMigration(ctx, conn, version, statement, p.clock.Now(ctx)); err != nil {
+			return err
+		}
+	}
+	if current < SchemaVersion {
+		log.Printf("Migrated database schema from version %d to %d", current, SchemaVersion)
+	}
+	return nil
+}
+
+// applies one migration and records it, or neither
+func applyMigration(ctx context.Context, conn *sql.Conn, version int, statement string, now time.Time) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", version, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, "SET LOCAL lock_timeout = '"+migrationLockTimeout+"'"); err != nil {
+		return fmt.Errorf("failed to set lock timeout for migration %d: %w", version, err)
+	}
+	if _, err = tx.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to apply migration %d: %w", version, err)
+	}
+	if _, err = tx.ExecContext(ctx, `
+	INSERT INTO schema_version (id, version, updated_at) VALUES (TRUE, $1, $2)
+	ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version, updated_at = EXCLUDED.updated_at`, version, now); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", version, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", version, err)
+	}
+	return nil
+}
+
+// CheckSchema refuses to run this build against a database that hasn't been migrated to its schema version
+func (p *Postgres) CheckSchema(ctx context.Context) error {
+	current, err := schemaVersion(ctx, p.db)
+	if err != nil {
+		return err
+	}
+	if current < SchemaVersion {
+		return fmt.Errorf("%w: database is at version %d but this build needs %d; let the api apply the migrations before starting this build",
+			ErrSchemaTooOld, current, SchemaVersion)
+	}
+	return nil
+}
+
+// queryRower is a *sql.DB or a pinned *sql.Conn
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// returns the recorded schema version, 0 for a database that has never been migrated
+func schemaVersion(ctx context.Context, q queryRower) (int, error) {
+	var version int
+	err := q.QueryRowContext(ctx, `SELECT version FROM schema_version WHERE id`).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows || isUndefinedTable(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// reports whether err is Postgres refusing a query on a table that doesn't exist
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
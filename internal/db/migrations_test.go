@@ -0,0 +1,44 @@
+package db
+
+import "testing"
+
+func TestSchemaIsBackwardCompatible(t *testing.T) {
+	for i, statement := range schema {
+		if err := checkCompatible(i+1, statement); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCheckCompatible(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		ok        bool
+	}{
+		{"add nullable column", `ALTER TABLE accounts ADD COLUMN nickname TEXT;`, true},
+		{"add not null column with default", `ALTER TABLE accounts ADD COLUMN tier INTEGER NOT NULL DEFAULT 0;`, true},
+		{"add not null column without default", `ALTER TABLE accounts ADD COLUMN tier INTEGER NOT NULL;`, false},
+		{"drop column", `ALTER TABLE accounts DROP COLUMN kyc_reference;`, false},
+		{"rename column", `ALTER TABLE accounts RENAME COLUMN balance TO amount;`, false},
+		{"retype column", `ALTER TABLE accounts ALTER COLUMN balance TYPE TEXT;`, false},
+		{"set not null", `ALTER TABLE accounts ALTER COLUMN kyc_reference SET NOT NULL;`, false},
+		{"widen money column", `ALTER TABLE accounts ALTER COLUMN balance TYPE NUMERIC(24, 4);`, true},
+		{"widen with set data type", `ALTER TABLE accounts ALTER COLUMN balance SET DATA TYPE numeric(24,4);`, true},
+		{"widen next to a retype", `ALTER TABLE escrows
+			ALTER COLUMN amount TYPE NUMERIC(24, 4),
+			ALTER COLUMN status TYPE TEXT;`, false},
+		{"narrow money column", `ALTER TABLE accounts ALTER COLUMN balance TYPE NUMERIC(20, 2);`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCompatible(1, tt.statement)
+			if tt.ok && err != nil {
+				t.Errorf("expected compatible, got %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("expected the migration to be refused")
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package db
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"time"
 
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/ids"
 	"github.com/abkawan/banking-ledger/internal/models"
-	"github.com/google/uuid"
+	"github.com/abkawan/banking-ledger/internal/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -16,6 +19,11 @@ import (
 type MongoDB struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	clock      clock.Clock
+	ids        ids.Generator
+
+	// stats holds the per-minute platform counters
+	stats *mongo.Collection
 }
 
 // creates a new MongoDB instance
@@ -23,7 +31,7 @@ func NewMongoDB(uri, dbName string) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(commandMonitor()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to Mongodb: %w", err)
 	}
@@ -35,15 +43,98 @@ func NewMongoDB(uri, dbName string) (*MongoDB, error) {
 
 	collection := client.Database(dbName).Collection("transactions")
 
+	// transactions written before multi-tenancy belong to the default tenant
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"tenant_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tenant_id": tenant.Default}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to backfill tenant ids: %w", err)
+	}
+
+	// references used to be unique across the whole ledger, then per tenant and namespace; they are now unique per account
+	_, _ = collection.Indexes().DropOne(ctx, "reference_1")
+	_, _ = collection.Indexes().DropOne(ctx, "tenant_id_1_reference_1")
+	_, _ = collection.Indexes().DropOne(ctx, "tenant_id_1_reference_namespace_1_reference_1")
+
+	// account lookups are now covered by the sortable history indexes below
+	_, _ = collection.Indexes().DropOne(ctx, "tenant_id_1_account_id_1")
+	_, _ = collection.Indexes().DropOne(ctx, "tenant_id_1_counterparty_account_id_1")
+
+	// replication reads the change stream now, not what was updated since it last looked
+	_, _ = collection.Indexes().DropOne(ctx, "updated_at_1")
+
 	indexModels := []mongo.IndexModel{
+		// transaction history is read from both sides of an account, ordered by date or amount
 		{
-			Keys:    bson.D{{Key: "account_id", Value: 1}},
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "created_at", Value: 1}},
 			Options: options.Index().SetBackground(true),
 		},
 		{
-			Keys:    bson.D{{Key: "reference", Value: 1}},
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "amount", Value: 1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "reference_namespace", Value: 1}, {Key: "account_id", Value: 1}, {Key: "reference", Value: 1}},
 			Options: options.Index().SetUnique(true).SetBackground(true),
 		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "counterparty_account_id", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "counterparty_account_id", Value: 1}, {Key: "amount", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		// statements select an account's activity by value date
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "value_date", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "counterparty_account_id", Value: 1}, {Key: "value_date", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		// counterparty reporting groups a tenant's activity by the counterparty it was with
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "counterparty_id", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		// the legs of a multi-leg transaction are read together
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "group_id", Value: 1}, {Key: "leg", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "completed_at", Value: 1}, {Key: "latency_ms", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		// the reclaim job looks for claims held too long
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "processing_started_at", Value: 1}},
+			Options: options.Index().SetSparse(true).SetBackground(true),
+		},
+		// admin search runs newest first within a tenant or across the platform, optionally by status or reference
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: -1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "reference", Value: 1}},
+			Options: options.Index().SetBackground(true),
+		},
 	}
 
 	_, err = collection.Indexes().CreateMany(ctx, indexModels)
@@ -54,9 +145,35 @@ func NewMongoDB(uri, dbName string) (*MongoDB, error) {
 	return &MongoDB{
 		client:     client,
 		collection: collection,
+		stats:      client.Database(dbName).Collection("platform_stats"),
+		clock:      clock.System,
+		ids:        ids.UUID,
 	}, nil
 }
 
+// sets the clock records are timestamped with
+func (m *MongoDB) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// sets the generator new transaction ids come from
+func (m *MongoDB) SetIDGenerator(g ids.Generator) {
+	m.ids = g
+}
+
+// maxCount is the most documents a list total will count exactly
+const maxCount = 10000
+
+// scoped restricts a filter to the caller's tenant
+func scoped(ctx context.Context, filter bson.M) (bson.M, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter["tenant_id"] = tenantID
+	return filter, nil
+}
+
 // closes the mongoDB connection
 func (m *MongoDB) Close(ctx context.Context) error {
 	return m.client.Disconnect(ctx)
@@ -64,15 +181,21 @@ func (m *MongoDB) Close(ctx context.Context) error {
 
 // creates a new transaction
 func (m *MongoDB) CreateTransaction(ctx context.Context, tx *models.Transaction) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+	tx.TenantID = tenantID
+
 	if tx.ID == "" {
-		tx.ID = uuid.New().String()
+		tx.ID = m.ids.NewID()
 	}
 
-	now := time.Now()
+	now := m.clock.Now(ctx)
 	tx.CreatedAt = now
 	tx.UpdatedAt = now
 
-	_, err := m.collection.InsertOne(ctx, tx)
+	_, err = m.collection.InsertOne(ctx, tx)
 	if err != nil {
 		return fmt.Errorf("failed to insert transaction: %w", err)
 	}
@@ -82,11 +205,16 @@ func (m *MongoDB) CreateTransaction(ctx context.Context, tx *models.Transaction)
 
 // GetTransactionByID: retrieves the transaction by ID
 func (m *MongoDB) GetTransactionByID(ctx context.Context, id string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
 	var transaction models.Transaction
-	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&transaction)
+	err = m.collection.FindOne(ctx, filter).Decode(&transaction)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("transaction not found")
+			return nil, ErrTransactionNotFound
 		}
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
@@ -94,10 +222,42 @@ func (m *MongoDB) GetTransactionByID(ctx context.Context, id string) (*models.Tr
 	return &transaction, nil
 }
 
-// retrieves a transaction by reference
-func (m *MongoDB) GetTransactionByReference(ctx context.Context, reference string) (*models.Transaction, error) {
+// inserts a transaction replayed from a legacy system as is, keeping its original timestamps
+// returns false when the tenant already has a transaction with the same reference
+func (m *MongoDB) ImportTransaction(ctx context.Context, tx *models.Transaction) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+	tx.TenantID = tenantID
+
+	if tx.ID == "" {
+		tx.ID = m.ids.NewID()
+	}
+
+	if _, err := m.collection.InsertOne(ctx, tx); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to import transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// retrieves an account's transaction by reference within a reference namespace; the empty namespace is the tenant's shared one
+func (m *MongoDB) GetTransactionByReference(ctx context.Context, namespace, accountID, reference string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{
+		"reference":           reference,
+		"reference_namespace": namespaceValue(namespace),
+		"account_id":          accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	var transaction models.Transaction
-	err := m.collection.FindOne(ctx, bson.M{"reference": reference}).Decode(&transaction)
+	err = m.collection.FindOne(ctx, filter).Decode(&transaction)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil // Not found, but not an error
@@ -108,18 +268,33 @@ func (m *MongoDB) GetTransactionByReference(ctx context.Context, reference strin
 	return &transaction, nil
 }
 
-// updates a transaction's status
-func (m *MongoDB) UpdateTransactionStatus(ctx context.Context, id string, status models.TransactionStatus, balanceBefore, balanceAfter float64) error {
+// namespaceValue matches the shared namespace, which is stored as a missing field, or a named one
+func namespaceValue(namespace string) interface{} {
+	if namespace == "" {
+		return nil
+	}
+	return namespace
+}
+
+// marks a transaction as completed and records its latency since it was last queued
+func (m *MongoDB) CompleteTransaction(ctx context.Context, id string, balanceBefore, balanceAfter float64, completedAt time.Time, latency time.Duration) error {
 	update := bson.M{
 		"$set": bson.M{
-			"status":         status,
+			"status":         models.Completed,
 			"balance_before": balanceBefore,
 			"balance_after":  balanceAfter,
-			"updated_at":     time.Now(),
+			"completed_at":   completedAt,
+			"latency_ms":     latency.Milliseconds(),
+			"updated_at":     completedAt,
 		},
 	}
 
-	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	filter, err := scoped(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
@@ -127,16 +302,289 @@ func (m *MongoDB) UpdateTransactionStatus(ctx context.Context, id string, status
 	return nil
 }
 
-// retrieves transactions for an account
-func (m *MongoDB) GetTransactionsByAccountID(ctx context.Context, accountID string, limit, offset int) ([]*models.Transaction, error) {
+// claims a pending transaction for processing so it is applied at most once
+// returns false when it was already claimed, is no longer pending or was queued before queuedAfter
+// a pending transaction's updated_at is the time it was queued
+func (m *MongoDB) ClaimTransaction(ctx context.Context, id string, queuedAfter time.Time) (bool, error) {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": false},
+		"updated_at":            bson.M{"$gte": queuedAfter},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"processing_started_at": m.clock.Now(ctx)}})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim transaction: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// gives up the claim on a pending transaction whose balance didn't move, so it can be claimed and applied
+// again; reports whether it was released
+func (m *MongoDB) ReleaseClaim(ctx context.Context, id string) (bool, error) {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"processing_started_at": ""}})
+	if err != nil {
+		return false, fmt.Errorf("failed to release transaction claim: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// retrieves pending transactions claimed before claimedBefore, oldest claim first: their processor stopped
+// holding the claim
+// not tenant scoped: it is only used by the reclaim job, which acts on every tenant
+func (m *MongoDB) GetStaleClaims(ctx context.Context, claimedBefore time.Time, limit int) ([]*models.Transaction, error) {
+	filter := bson.M{
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$lt": claimedBefore},
+	}
 	options := options.Find().
-		SetSort(bson.D{{Key: "created_at", Value: -1}}).
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset))
+		SetSort(bson.D{{Key: "processing_started_at", Value: 1}}).
+		SetLimit(int64(limit))
 
-	cursor, err := m.collection.Find(ctx, bson.M{"account_id": accountID}, options)
+	cursor, err := m.collection.Find(ctx, filter, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find transactions: %w", err)
+		return nil, fmt.Errorf("failed to find stale claims: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// gives up a claim taken before claimedBefore on a pending transaction whose balance never moved, recording the
+// abandoned attempt, and returns the transaction; nil when it was finished or claimed again in the meantime
+// any scheduled retry is cleared, the caller decides whether to schedule another one
+func (m *MongoDB) ReclaimTransaction(ctx context.Context, id string, claimedBefore time.Time, lastError string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$lt": claimedBefore},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc":   bson.M{"attempts": 1},
+		"$set":   bson.M{"last_error": lastError, "last_attempt_at": m.clock.Now(ctx)},
+		"$unset": bson.M{"processing_started_at": "", "next_retry_at": ""},
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to reclaim transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// parks a pending, unclaimed transaction while its account is paused; reports whether it was parked
+func (m *MongoDB) HoldTransaction(ctx context.Context, id string) (bool, error) {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": models.Held, "updated_at": m.clock.Now(ctx)}})
+	if err != nil {
+		return false, fmt.Errorf("failed to hold transaction: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// retrieves an account's held transactions, oldest first
+func (m *MongoDB) GetHeldTransactions(ctx context.Context, accountID string, limit int) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"account_id": accountID, "status": models.Held})
+	if err != nil {
+		return nil, err
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find held transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// returns a held transaction to pending, restarting its SLA clock; nil when it isn't held
+func (m *MongoDB) ReleaseHeldTransaction(ctx context.Context, id string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Held})
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": models.Pending, "updated_at": m.clock.Now(ctx)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to release held transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// parks a pending transaction until funds cover it or the deadline passes, giving up its claim; next schedules
+// another attempt, nil waits for a credit. Reports whether it was parked
+func (m *MongoDB) AwaitFunds(ctx context.Context, id string, mode models.InsufficientFundsMode, deadline time.Time, next *time.Time) (bool, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending})
+	if err != nil {
+		return false, err
+	}
+
+	set := bson.M{
+		"status":           models.AwaitingFunds,
+		"funding_mode":     mode,
+		"funding_deadline": deadline,
+		"updated_at":       m.clock.Now(ctx),
+	}
+	unset := bson.M{"processing_started_at": ""}
+	if next != nil {
+		set["next_retry_at"] = *next
+	} else {
+		unset["next_retry_at"] = ""
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		return false, fmt.Errorf("failed to park transaction awaiting funds: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// returns a transaction awaiting funds to pending, restarting its SLA clock; nil when it isn't awaiting funds
+func (m *MongoDB) ReleaseAwaitingFunds(ctx context.Context, id string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.AwaitingFunds})
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter,
+		bson.M{
+			"$set":   bson.M{"status": models.Pending, "updated_at": m.clock.Now(ctx)},
+			"$unset": bson.M{"next_retry_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to release transaction awaiting funds: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// fails a transaction awaiting funds with the given reason; reports whether it was still awaiting them
+func (m *MongoDB) FailAwaitingFunds(ctx context.Context, id, reason string) (bool, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.AwaitingFunds})
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{
+		"$set":   bson.M{"status": models.Failed, "failure_reason": reason, "updated_at": m.clock.Now(ctx)},
+		"$unset": bson.M{"next_retry_at": ""},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to fail transaction awaiting funds: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// retrieves an account's transactions waiting for a credit to cover them, oldest first
+func (m *MongoDB) GetAwaitingFunds(ctx context.Context, accountID string, limit int) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{
+		"account_id":   accountID,
+		"status":       models.AwaitingFunds,
+		"funding_mode": models.ProcessWhenFunded,
+	})
+	if err != nil {
+		return nil, err
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transactions awaiting funds: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// retrieves transactions awaiting funds whose retry is due or whose funding deadline has passed, oldest first
+// not tenant scoped: it is only used by the funding job, which acts on every tenant
+func (m *MongoDB) GetDueAwaitingFunds(ctx context.Context, now time.Time, limit int) ([]*models.Transaction, error) {
+	filter := bson.M{
+		"status": models.AwaitingFunds,
+		"$or": bson.A{
+			bson.M{"next_retry_at": bson.M{"$lte": now}},
+			bson.M{"funding_deadline": bson.M{"$lte": now}},
+		},
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due transactions awaiting funds: %w", err)
 	}
 	defer cursor.Close(ctx)
 
@@ -147,3 +595,986 @@ func (m *MongoDB) GetTransactionsByAccountID(ctx context.Context, accountID stri
 
 	return transactions, nil
 }
+
+// marks a pending transaction as failed with the given reason
+func (m *MongoDB) FailTransaction(ctx context.Context, id, reason string) error {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending})
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":         models.Failed,
+			"failure_reason": reason,
+			"updated_at":     m.clock.Now(ctx),
+		},
+	}
+
+	_, err = m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to fail transaction: %w", err)
+	}
+
+	return nil
+}
+
+// moves a claimed deposit that couldn't be applied to suspended, keeping why as its failure reason
+func (m *MongoDB) SuspendTransaction(ctx context.Context, id, reason string) error {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending})
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":         models.Suspended,
+			"failure_reason": reason,
+			"updated_at":     m.clock.Now(ctx),
+		},
+	}
+
+	if _, err := m.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to suspend transaction: %w", err)
+	}
+
+	return nil
+}
+
+// fails a suspended transaction once its exception is resolved, replacing the failure reason with the resolution
+// returns nil when the transaction isn't suspended
+func (m *MongoDB) ResolveSuspendedTransaction(ctx context.Context, id, reason string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Suspended})
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": models.Failed, "failure_reason": reason, "updated_at": m.clock.Now(ctx)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to resolve suspended transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// expires a pending transaction queued before cutoff that no processor has claimed
+// returns false when the transaction was claimed or finished in the meantime
+func (m *MongoDB) ExpireTransaction(ctx context.Context, id string, cutoff time.Time) (bool, error) {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": false},
+		"updated_at":            bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":         models.Failed,
+			"failure_reason": models.ReasonExpired,
+			"updated_at":     m.clock.Now(ctx),
+		},
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire transaction: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// retrieves unclaimed pending transactions queued before cutoff, oldest first; the later legs of a group wait on
+// its first one and are left out
+// not tenant scoped: it is only used by the expiry job, which acts on every tenant
+func (m *MongoDB) GetUnclaimedPendingBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.Transaction, error) {
+	filter := bson.M{
+		"status":                models.Pending,
+		"type":                  bson.M{"$ne": models.Opening},
+		"processing_started_at": bson.M{"$exists": false},
+		"updated_at":            bson.M{"$lt": cutoff},
+		"leg":                   bson.M{"$not": bson.M{"$gt": 1}},
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// returns the opening transactions left pending since before cutoff, oldest first
+// not tenant scoped: the reconciliation job covers every tenant
+func (m *MongoDB) GetPendingOpeningsBefore(ctx context.Context, cutoff time.Time, limit int) ([]*models.Transaction, error) {
+	filter := bson.M{
+		"status":     models.Pending,
+		"type":       models.Opening,
+		"updated_at": bson.M{"$lt": cutoff},
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending opening transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// records a failed processing attempt on a pending transaction and returns it; nil when it is no longer pending
+// any scheduled retry is cleared, the caller decides whether to schedule another one
+func (m *MongoDB) RecordProcessingError(ctx context.Context, id, lastError string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending})
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc":   bson.M{"attempts": 1},
+		"$set":   bson.M{"last_error": lastError, "last_attempt_at": m.clock.Now(ctx)},
+		"$unset": bson.M{"next_retry_at": ""},
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to record processing error: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// schedules the next processing attempt of an unclaimed pending transaction
+func (m *MongoDB) ScheduleRetry(ctx context.Context, id string, at time.Time) error {
+	filter, err := scoped(ctx, bson.M{
+		"_id":                   id,
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"next_retry_at": at}}); err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves unclaimed pending transactions whose retry is due, oldest first
+// not tenant scoped: it is only used by the retry job, which acts on every tenant
+func (m *MongoDB) GetDueRetries(ctx context.Context, now time.Time, limit int) ([]*models.Transaction, error) {
+	filter := bson.M{
+		"status":                models.Pending,
+		"processing_started_at": bson.M{"$exists": false},
+		"next_retry_at":         bson.M{"$lte": now},
+	}
+	options := options.Find().
+		SetSort(bson.D{{Key: "next_retry_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due retries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// takes a due retry so only one replica requeues it; reports whether it was taken
+func (m *MongoDB) ClaimRetry(ctx context.Context, id string, now time.Time) (bool, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending, "next_retry_at": bson.M{"$lte": now}})
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"next_retry_at": ""}})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim retry: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// finds a recent transaction on the same account with the same type, amount and counterparty
+// but a different reference; failed transactions are ignored
+func (m *MongoDB) FindSimilarTransaction(ctx context.Context, req *models.TransactionRequest, reference string, since time.Time) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{
+		"account_id": req.AccountID,
+		"type":       req.Type,
+		"amount":     req.Amount,
+		"reference":  bson.M{"$ne": reference},
+		"status":     bson.M{"$ne": models.Failed},
+		"created_at": bson.M{"$gte": since},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.CounterpartyAccountID != "" {
+		filter["counterparty_account_id"] = req.CounterpartyAccountID
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look for similar transactions: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// retrieves the tenant's transactions awaiting duplicate review, oldest first
+func (m *MongoDB) GetFlaggedTransactions(ctx context.Context, limit, offset int) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"status": models.Flagged})
+	if err != nil {
+		return nil, err
+	}
+
+	options := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find flagged transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// moves a flagged transaction to pending (approved) or failed (rejected) and returns it
+// returns nil when the transaction isn't flagged
+func (m *MongoDB) ResolveFlaggedTransaction(ctx context.Context, id string, status models.TransactionStatus, reason string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Flagged})
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{
+		"status":     status,
+		"updated_at": m.clock.Now(ctx),
+	}
+	if reason != "" {
+		set["failure_reason"] = reason
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to resolve flagged transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// parks a claimed transaction for compliance review with its screening result; reports whether it was parked
+func (m *MongoDB) ReviewTransaction(ctx context.Context, id string, result *models.ScreeningResult) (bool, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.Pending})
+	if err != nil {
+		return false, err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.InReview,
+			"screening":  result,
+			"updated_at": m.clock.Now(ctx),
+		},
+		// cleared transactions are claimed again when they are requeued
+		"$unset": bson.M{"processing_started_at": ""},
+	}
+
+	res, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to park transaction for review: %w", err)
+	}
+
+	return res.ModifiedCount == 1, nil
+}
+
+// lists transactions awaiting compliance review, oldest first
+// not tenant scoped: an empty tenantID covers the whole platform
+func (m *MongoDB) GetReviewTransactions(ctx context.Context, tenantID string, limit, offset int) ([]*models.Transaction, error) {
+	options := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := m.collection.Find(ctx, platformFilter(tenantID, bson.M{"status": models.InReview}), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transactions in review: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// records the compliance decision on a transaction in review, moving it to pending (cleared) or failed (blocked)
+// returns nil when the transaction isn't in review, and ErrModified when it changed after the IfVersion in ctx
+func (m *MongoDB) ResolveReview(ctx context.Context, id, decision, reviewer, note string) (*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": id, "status": models.InReview})
+	if err != nil {
+		return nil, err
+	}
+	version, conditional := expectedVersion(ctx)
+	if conditional {
+		filter["updated_at"] = version
+	}
+
+	now := m.clock.Now(ctx)
+	set := bson.M{
+		"status":                models.Pending,
+		"updated_at":            now,
+		"screening.decision":    decision,
+		"screening.reviewed_by": reviewer,
+		"screening.reviewed_at": now,
+		"screening.note":        note,
+	}
+	if decision == models.ScreeningBlocked {
+		set["status"] = models.Failed
+		set["failure_reason"] = models.ReasonScreeningBlocked
+	}
+
+	var transaction models.Transaction
+	err = m.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&transaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			if conditional {
+				return nil, m.modifiedSince(ctx, id, version)
+			}
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to resolve review: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// returns ErrModified when the transaction exists with an updated_at other than version
+func (m *MongoDB) modifiedSince(ctx context.Context, id string, version time.Time) error {
+	filter, err := scoped(ctx, bson.M{"_id": id, "updated_at": bson.M{"$ne": version}})
+	if err != nil {
+		return err
+	}
+	count, err := m.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("failed to check transaction: %w", err)
+	}
+	if count > 0 {
+		return ErrModified
+	}
+	return nil
+}
+
+// attaches enrichment data to a transaction
+func (m *MongoDB) UpdateTransactionEnrichment(ctx context.Context, id string, enrichment *models.Enrichment) error {
+	update := bson.M{
+		"$set": bson.M{
+			"enrichment": enrichment,
+			"updated_at": m.clock.Now(ctx),
+		},
+	}
+
+	filter, err := scoped(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction enrichment: %w", err)
+	}
+
+	return nil
+}
+
+// appends lifecycle steps to a transaction's timeline; it doesn't touch updated_at, which drives the SLA
+func (m *MongoDB) AppendTimeline(ctx context.Context, id string, events ...models.TimelineEvent) error {
+	filter, err := scoped(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"timeline": bson.M{"$each": events}}})
+	if err != nil {
+		return fmt.Errorf("failed to append transaction timeline: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves transactions for an account, including transfers it received
+func (m *MongoDB) GetTransactionsByAccountID(ctx context.Context, accountID string, sort models.TransactionSort, limit, offset int) ([]*models.Transaction, error) {
+	field := sort.Field
+	if field == "" {
+		field = models.SortByCreatedAt
+	}
+	direction := -1
+	if sort.Ascending {
+		direction = 1
+	}
+
+	// the id breaks ties so equal amounts page in a stable order
+	options := options.Find().
+		SetSort(bson.D{{Key: string(field), Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	filter, err := scoped(ctx, accountFilter(accountID))
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// accountFilter matches transactions on either side of an account
+func accountFilter(accountID string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"account_id": accountID},
+		bson.M{"counterparty_account_id": accountID},
+	}}
+}
+
+// counts the transactions involving an account
+func (m *MongoDB) CountTransactionsByAccountID(ctx context.Context, accountID string) (models.Count, error) {
+	filter, err := scoped(ctx, accountFilter(accountID))
+	if err != nil {
+		return models.Count{}, err
+	}
+	return m.countCapped(ctx, filter)
+}
+
+// counts the caller's transactions held as suspected duplicates
+func (m *MongoDB) CountFlaggedTransactions(ctx context.Context) (models.Count, error) {
+	filter, err := scoped(ctx, bson.M{"status": models.Flagged})
+	if err != nil {
+		return models.Count{}, err
+	}
+	return m.countCapped(ctx, filter)
+}
+
+// counts transactions in review, across all tenants unless tenantID is set
+func (m *MongoDB) CountReviewTransactions(ctx context.Context, tenantID string) (models.Count, error) {
+	return m.countCapped(ctx, platformFilter(tenantID, bson.M{"status": models.InReview}))
+}
+
+// countCapped stops counting at maxCount so totals over large histories stay cheap;
+// anything beyond it is reported as an estimated lower bound
+func (m *MongoDB) countCapped(ctx context.Context, filter bson.M) (models.Count, error) {
+	n, err := m.collection.CountDocuments(ctx, filter, options.Count().SetLimit(maxCount+1))
+	if err != nil {
+		return models.Count{}, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	if n > maxCount {
+		return models.Count{Total: maxCount, Estimated: true}, nil
+	}
+	return models.Count{Total: n}, nil
+}
+
+// retrieves completed transactions created within [from, to), oldest first
+// an empty accountID matches every account
+func (m *MongoDB) GetCompletedTransactionsInRange(ctx context.Context, accountID string, from, to time.Time) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{
+		"status":     models.Completed,
+		"created_at": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if accountID != "" {
+		filter["account_id"] = accountID
+	}
+
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// retrieves the completed transactions that touched an account, including transfers it received, with a value
+// date within [from, to), by value date; a zero to leaves the range open. Transactions from before value dating
+// have none and are selected by when they were created
+func (m *MongoDB) GetAccountActivityInRange(ctx context.Context, accountID string, from, to time.Time) ([]*models.Transaction, error) {
+	inRange := bson.M{"$gte": from}
+	if !to.IsZero() {
+		inRange["$lt"] = to
+	}
+	filter, err := scoped(ctx, bson.M{
+		"status": models.Completed,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"account_id": accountID},
+				bson.M{"counterparty_account_id": accountID},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"value_date": inRange},
+				bson.M{"value_date": bson.M{"$exists": false}, "created_at": inRange},
+			}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := options.Find().SetSort(bson.D{{Key: "value_date", Value: 1}, {Key: "created_at", Value: 1}})
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// reports whether any pending transaction's reference starts with prefix
+func (m *MongoDB) HasPendingWithReferencePrefix(ctx context.Context, prefix string) (bool, error) {
+	filter, err := scoped(ctx, bson.M{
+		"status":    models.Pending,
+		"reference": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	count, err := m.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count pending transactions: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// sums the amounts of non-failed withdrawals and outgoing transfers created on an account since the given time
+func (m *MongoDB) SumOutgoingSince(ctx context.Context, accountID string, since time.Time) (float64, error) {
+	match, err := scoped(ctx, bson.M{
+		"account_id": accountID,
+		"type":       bson.M{"$in": bson.A{models.Withdrawal, models.Transfer}},
+		"status":     bson.M{"$ne": models.Failed},
+		"created_at": bson.M{"$gte": since},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$amount"}}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate outgoing amounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total float64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, fmt.Errorf("failed to decode outgoing amounts: %w", err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].Total, nil
+}
+
+// sums the amounts and fees of an account's withdrawals and outgoing transfers that are queued or awaiting funds,
+// which its balance doesn't reflect yet
+func (m *MongoDB) SumPendingDebits(ctx context.Context, accountID string) (float64, error) {
+	match, err := scoped(ctx, bson.M{
+		"account_id": accountID,
+		"type":       bson.M{"$in": bson.A{models.Withdrawal, models.Transfer}},
+		"status":     bson.M{"$in": bson.A{models.Pending, models.AwaitingFunds}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$add": bson.A{"$amount", bson.M{"$ifNull": bson.A{"$fee", 0}}}}}}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate pending debits: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total float64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, fmt.Errorf("failed to decode pending debits: %w", err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].Total, nil
+}
+
+// streams every transaction created up to the given time, oldest first
+// not tenant scoped: it is only used by the backup command; an empty tenantID covers the whole platform
+func (m *MongoDB) ExportTransactions(ctx context.Context, tenantID string, until time.Time, fn func(*models.Transaction) error) error {
+	filter := platformFilter(tenantID, bson.M{"created_at": bson.M{"$lte": until}})
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return fmt.Errorf("failed to export transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var tx models.Transaction
+		if err := cursor.Decode(&tx); err != nil {
+			return fmt.Errorf("failed to decode transaction: %w", err)
+		}
+		if err := fn(&tx); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to export transactions: %w", err)
+	}
+
+	return nil
+}
+
+// counts transactions created after the given time
+// not tenant scoped: it is only used by the backup command; an empty tenantID covers the whole platform
+func (m *MongoDB) CountTransactionsCreatedAfter(ctx context.Context, tenantID string, after time.Time) (int64, error) {
+	n, err := m.collection.CountDocuments(ctx, platformFilter(tenantID, bson.M{"created_at": bson.M{"$gt": after}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	return n, nil
+}
+
+// how long reading the change stream waits for more changes before reporting it has none for now
+const changeStreamWait = 100 * time.Millisecond
+
+// returns the change stream token that capture starting now resumes from
+// not tenant scoped: it is only used by replication, which carries every tenant
+func (m *MongoDB) TransactionChangesHead(ctx context.Context) ([]byte, error) {
+	stream, err := m.collection.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction change stream: %w", err)
+	}
+	defer stream.Close(ctx)
+	return stream.ResumeToken(), nil
+}
+
+// streams the transactions changed after the change stream token resumeAfter, in the order MongoDB applied the
+// changes, each in its current state, until there are none for now or limit were read. Returns the token to
+// resume from; a write stamped early or by a skewed clock is still read in its place. Needs MongoDB to run as a
+// replica set, and the token to still be within its oplog
+// not tenant scoped: it is only used by replication, which carries every tenant
+func (m *MongoDB) ExportTransactionChanges(ctx context.Context, resumeAfter []byte, limit int, fn func(*models.Transaction) error) ([]byte, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace"}}}}}}
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(changeStreamWait).
+		SetResumeAfter(bson.Raw(resumeAfter))
+
+	stream, err := m.collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction change stream: %w", err)
+	}
+	defer stream.Close(ctx)
+
+	for n := 0; n < limit && stream.TryNext(ctx); n++ {
+		var change struct {
+			FullDocument *models.Transaction `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			return nil, fmt.Errorf("failed to decode transaction change: %w", err)
+		}
+		// nil when the transaction was removed since, as by a restore; there is nothing left to carry
+		if change.FullDocument == nil {
+			continue
+		}
+		if err := fn(change.FullDocument); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transaction change stream: %w", err)
+	}
+
+	return stream.ResumeToken(), nil
+}
+
+// makes every unclaimed pending transaction due for the retry job at at, counting as queued then for the
+// processing SLA; for a store whose queue doesn't hold them, such as a promoted replica's
+// not tenant scoped: it acts on every tenant
+func (m *MongoDB) RequeuePending(ctx context.Context, at time.Time) (int64, error) {
+	result, err := m.collection.UpdateMany(ctx,
+		bson.M{"status": models.Pending, "type": bson.M{"$ne": models.Opening}, "processing_started_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"next_retry_at": at, "updated_at": at}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue pending transactions: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// writes a transaction from a backup, replacing whatever is stored under its id
+// not tenant scoped: it is only used by the backup command, which restores each transaction into its own tenant
+func (m *MongoDB) RestoreTransaction(ctx context.Context, tx *models.Transaction) error {
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": tx.ID}, tx, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to restore transaction: %w", err)
+	}
+	return nil
+}
+
+// retrieves every completed transaction on either side of an account, in completion order
+func (m *MongoDB) GetCompletedTransactionsByAccountID(ctx context.Context, accountID string) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, accountFilter(accountID))
+	if err != nil {
+		return nil, err
+	}
+	filter["status"] = models.Completed
+
+	options := options.Find().SetSort(bson.D{{Key: "completed_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := m.collection.Find(ctx, filter, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find completed transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// returns every account id transactions point at, on either side, with how many transactions do
+// not tenant scoped: it is only used by the consistency checker; an empty tenantID covers the whole platform
+func (m *MongoDB) GetAccountReferences(ctx context.Context, tenantID string) ([]models.AccountReference, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: platformFilter(tenantID, bson.M{})}},
+		{{Key: "$project", Value: bson.M{
+			"tenant_id": 1,
+			"status":    1,
+			"ids":       bson.A{"$account_id", "$counterparty_account_id"},
+		}}},
+		{{Key: "$unwind", Value: "$ids"}},
+		{{Key: "$match", Value: bson.M{"ids": bson.M{"$nin": bson.A{nil, ""}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          bson.M{"tenant_id": "$tenant_id", "account_id": "$ids"},
+			"transactions": bson.M{"$sum": 1},
+			"pending":      bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", models.Pending}}, 1, 0}}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"tenant_id":    "$_id.tenant_id",
+			"account_id":   "$_id.account_id",
+			"transactions": 1,
+			"pending":      1,
+		}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate account references: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var refs []models.AccountReference
+	if err := cursor.All(ctx, &refs); err != nil {
+		return nil, fmt.Errorf("failed to decode account references: %w", err)
+	}
+
+	return refs, nil
+}
+
+// fails the unclaimed pending transactions on either side of an account that doesn't exist; returns how many
+func (m *MongoDB) FailOrphanedTransactions(ctx context.Context, accountID, reason string) (int64, error) {
+	filter, err := scoped(ctx, accountFilter(accountID))
+	if err != nil {
+		return 0, err
+	}
+	filter["status"] = models.Pending
+	filter["processing_started_at"] = bson.M{"$exists": false}
+
+	result, err := m.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"status":         models.Failed,
+		"failure_reason": reason,
+		"updated_at":     m.clock.Now(ctx),
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail orphaned transactions: %w", err)
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// platformFilter narrows an admin query to one tenant when tenantID is set
+func platformFilter(tenantID string, filter bson.M) bson.M {
+	if tenantID != "" {
+		filter["tenant_id"] = tenantID
+	}
+	return filter
+}
+
+// returns the number of transactions completed since the given time and the latency at each quantile
+// not tenant scoped: an empty tenantID covers the whole platform
+func (m *MongoDB) GetLatencyQuantiles(ctx context.Context, tenantID string, since time.Time, quantiles []float64) (int64, []time.Duration, error) {
+	filter := platformFilter(tenantID, bson.M{
+		"status":       models.Completed,
+		"completed_at": bson.M{"$gte": since},
+		"latency_ms":   bson.M{"$exists": true},
+	})
+
+	count, err := m.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count completed transactions: %w", err)
+	}
+
+	values := make([]time.Duration, len(quantiles))
+	if count == 0 {
+		return 0, values, nil
+	}
+
+	for i, q := range quantiles {
+		rank := int64(q * float64(count))
+		if rank >= count {
+			rank = count - 1
+		}
+
+		options := options.FindOne().
+			SetSort(bson.D{{Key: "latency_ms", Value: 1}}).
+			SetSkip(rank).
+			SetProjection(bson.M{"latency_ms": 1})
+
+		var result struct {
+			LatencyMs int64 `bson:"latency_ms"`
+		}
+		if err := m.collection.FindOne(ctx, filter, options).Decode(&result); err != nil {
+			return 0, nil, fmt.Errorf("failed to read latency quantile: %w", err)
+		}
+		values[i] = time.Duration(result.LatencyMs) * time.Millisecond
+	}
+
+	return count, values, nil
+}
+
+// counts transactions since the given time that completed later than sla, and those that expired
+// not tenant scoped: an empty tenantID covers the whole platform
+func (m *MongoDB) CountSLABreaches(ctx context.Context, tenantID string, since time.Time, sla time.Duration) (late, expired int64, err error) {
+	late, err = m.collection.CountDocuments(ctx, platformFilter(tenantID, bson.M{
+		"status":       models.Completed,
+		"completed_at": bson.M{"$gte": since},
+		"latency_ms":   bson.M{"$gt": sla.Milliseconds()},
+	}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count late transactions: %w", err)
+	}
+
+	expired, err = m.collection.CountDocuments(ctx, platformFilter(tenantID, bson.M{
+		"status":         models.Failed,
+		"failure_reason": models.ReasonExpired,
+		"updated_at":     bson.M{"$gte": since},
+	}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count expired transactions: %w", err)
+	}
+
+	return late, expired, nil
+}
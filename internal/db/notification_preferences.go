@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// retrieves an account's notification preferences, nil when none are stored
+func (p *Postgres) GetNotificationPreferences(ctx context.Context, accountID string) (*models.NotificationPreferences, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT account_id, email, phone, webhook_url, events, large_withdrawal_threshold, low_balance_threshold, updated_at
+	FROM notification_preferences
+	WHERE account_id = $1 AND tenant_id = $2`
+
+	var prefs models.NotificationPreferences
+	var events []string
+	err = p.db.QueryRowContext(ctx, query, accountID, tenantID).Scan(
+		&prefs.AccountID, &prefs.Email, &prefs.Phone, &prefs.WebhookURL, pq.Array(&events),
+		&prefs.LargeWithdrawalThreshold, &prefs.LowBalanceThreshold, &prefs.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	prefs.Events = make([]models.NotificationEvent, 0, len(events))
+	for _, e := range events {
+		prefs.Events = append(prefs.Events, models.NotificationEvent(e))
+	}
+
+	return &prefs, nil
+}
+
+// creates or replaces an account's notification preferences
+func (p *Postgres) UpsertNotificationPreferences(ctx context.Context, prefs *models.NotificationPreferences) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	events := make([]string, 0, len(prefs.Events))
+	for _, e := range prefs.Events {
+		events = append(events, string(e))
+	}
+	prefs.UpdatedAt = p.clock.Now(ctx)
+
+	query := `
+	INSERT INTO notification_preferences (account_id, email, phone, webhook_url, events, large_withdrawal_threshold, low_balance_threshold, updated_at, tenant_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (account_id) DO UPDATE SET
+		email = EXCLUDED.email,
+		phone = EXCLUDED.phone,
+		webhook_url = EXCLUDED.webhook_url,
+		events = EXCLUDED.events,
+		large_withdrawal_threshold = EXCLUDED.large_withdrawal_threshold,
+		low_balance_threshold = EXCLUDED.low_balance_threshold,
+		updated_at = EXCLUDED.updated_at
+	WHERE notification_preferences.tenant_id = EXCLUDED.tenant_id`
+
+	_, err = p.db.ExecContext(ctx, query,
+		prefs.AccountID, prefs.Email, prefs.Phone, prefs.WebhookURL, pq.Array(events),
+		prefs.LargeWithdrawalThreshold, prefs.LowBalanceThreshold, prefs.UpdatedAt, tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// closes an accounting period of the tenant; closing a closed period keeps its original close
+func (p *Postgres) ClosePeriod(ctx context.Context, period *models.AccountingPeriod) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+	period.TenantID = tenantID
+	period.ClosedAt = p.clock.Now(ctx)
+
+	_, err = p.db.ExecContext(ctx, `
+	INSERT INTO accounting_periods (tenant_id, period, closed_by, closed_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (tenant_id, period) DO NOTHING`,
+		period.TenantID, period.Period, period.ClosedBy, period.ClosedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to close accounting period: %w", err)
+	}
+
+	return nil
+}
+
+// reopens an accounting period of the tenant; reopening an open period does nothing
+func (p *Postgres) ReopenPeriod(ctx context.Context, period string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx,
+		"DELETE FROM accounting_periods WHERE tenant_id = $1 AND period = $2",
+		tenantID, period,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reopen accounting period: %w", err)
+	}
+
+	return nil
+}
+
+// lists the tenant's closed accounting periods, latest first
+func (p *Postgres) GetClosedPeriods(ctx context.Context) ([]*models.AccountingPeriod, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT tenant_id, period, closed_by, closed_at FROM accounting_periods WHERE tenant_id = $1 ORDER BY period DESC",
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounting periods: %w", err)
+	}
+	defer rows.Close()
+
+	periods := []*models.AccountingPeriod{}
+	for rows.Next() {
+		var period models.AccountingPeriod
+		if err := rows.Scan(&period.TenantID, &period.Period, &period.ClosedBy, &period.ClosedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan accounting period: %w", err)
+		}
+		periods = append(periods, &period)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get accounting periods: %w", err)
+	}
+
+	return periods, nil
+}
+
+// reports whether an accounting period of the tenant is closed
+func (p *Postgres) IsPeriodClosed(ctx context.Context, period string) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var closed bool
+	err = p.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM accounting_periods WHERE tenant_id = $1 AND period = $2)",
+		tenantID, period,
+	).Scan(&closed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check accounting period: %w", err)
+	}
+
+	return closed, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// counts the platform's transactions created, completed and failed within the minute starting at minute
+// not tenant scoped: it covers the whole platform
+func (m *MongoDB) CountPlatformMinute(ctx context.Context, minute time.Time) (*models.PlatformMinute, error) {
+	return m.CountPlatformWindow(ctx, minute, minute.Add(time.Minute))
+}
+
+// counts the platform's transactions created, completed and failed from from until to, like CountPlatformMinute
+// does for whole minutes; the counts' Minute is from
+func (m *MongoDB) CountPlatformWindow(ctx context.Context, from, to time.Time) (*models.PlatformMinute, error) {
+	window := bson.M{"$gte": from, "$lt": to}
+	counts := &models.PlatformMinute{Minute: from}
+
+	var err error
+	if counts.Created, err = m.collection.CountDocuments(ctx, bson.M{"created_at": window}); err != nil {
+		return nil, fmt.Errorf("failed to count created transactions: %w", err)
+	}
+	if counts.Failed, err = m.collection.CountDocuments(ctx, bson.M{"status": models.Failed, "updated_at": window}); err != nil {
+		return nil, fmt.Errorf("failed to count failed transactions: %w", err)
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": models.Completed, "completed_at": window}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":              nil,
+			"completed":        bson.M{"$sum": 1},
+			"latency_ms_total": bson.M{"$sum": bson.M{"$ifNull": bson.A{"$latency_ms", 0}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate completed transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var completed []struct {
+		Completed      int64 `bson:"completed"`
+		LatencyMsTotal int64 `bson:"latency_ms_total"`
+	}
+	if err := cursor.All(ctx, &completed); err != nil {
+		return nil, fmt.Errorf("failed to decode completed transactions: %w", err)
+	}
+	if len(completed) > 0 {
+		counts.Completed = completed[0].Completed
+		counts.LatencyMsTotal = completed[0].LatencyMsTotal
+	}
+
+	return counts, nil
+}
+
+// records a minute's counters, replacing any recorded before for the same minute
+func (m *MongoDB) SavePlatformMinute(ctx context.Context, counts *models.PlatformMinute) error {
+	counts.RecordedAt = m.clock.Now(ctx)
+	_, err := m.stats.ReplaceOne(ctx, bson.M{"_id": counts.Minute}, counts, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save platform stats: %w", err)
+	}
+	return nil
+}
+
+// retrieves the latest recorded minute, nil when nothing has been recorded
+func (m *MongoDB) GetLastPlatformMinute(ctx context.Context) (*time.Time, error) {
+	var last models.PlatformMinute
+	err := m.stats.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last platform stats: %w", err)
+	}
+	minute := last.Minute
+	return &minute, nil
+}
+
+// deletes the minutes recorded before the given time; returns how many
+func (m *MongoDB) DeletePlatformMinutesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := m.stats.DeleteMany(ctx, bson.M{"_id": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune platform stats: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// rolls the minutes recorded within [from, to) up into steps aligned to the Unix epoch, oldest first
+// steps without any recorded minute are left out
+func (m *MongoDB) GetPlatformStatsHistory(ctx context.Context, from, to time.Time, step time.Duration) ([]models.PlatformStatsPoint, error) {
+	stepMs := step.Milliseconds()
+	epochMs := bson.M{"$toLong": "$_id"}
+
+	cursor, err := m.stats.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$toDate": bson.M{"$subtract": bson.A{
+				epochMs, bson.M{"$mod": bson.A{epochMs, stepMs}},
+			}}},
+			"minutes":          bson.M{"$sum": 1},
+			"created":          bson.M{"$sum": "$created"},
+			"completed":        bson.M{"$sum": "$completed"},
+			"failed":           bson.M{"$sum": "$failed"},
+			"latency_ms_total": bson.M{"$sum": "$latency_ms_total"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate platform stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	points := []models.PlatformStatsPoint{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, fmt.Errorf("failed to decode platform stats: %w", err)
+	}
+
+	return points, nil
+}
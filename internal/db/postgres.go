@@ -3,22 +3,64 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
 
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/ids"
 	"github.com/abkawan/banking-ledger/internal/models"
-	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+	"github.com/lib/pq"
 )
 
+// ErrNoTenant is returned when a tenant-owned query is attempted on an unscoped context
+var ErrNoTenant = errors.New("no tenant in context")
+
+// ErrAccountNotFound is returned for accounts the tenant doesn't have
+var ErrAccountNotFound = i18n.NewError("error.account_not_found", "account not found")
+
+// ErrCounterpartyAccountNotFound is returned when the account a transfer credits isn't the tenant's
+var ErrCounterpartyAccountNotFound = i18n.NewError("error.counterparty_not_found", "counterparty account not found")
+
+// ErrInsufficientFunds is returned when a debit would take an account's balance below zero
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrTransactionNotFound is returned for transactions the tenant doesn't have
+var ErrTransactionNotFound = i18n.NewError("error.transaction_not_found", "transaction not found")
+
+// ErrSweepRuleNotFound is returned for sweep rules the tenant doesn't have
+var ErrSweepRuleNotFound = i18n.NewError("error.sweep_rule_not_found", "sweep rule not found")
+
+// ErrEscrowNotFound is returned for escrows the tenant doesn't have
+var ErrEscrowNotFound = i18n.NewError("error.escrow_not_found", "escrow not found")
+
+// ErrDuplicateReference is returned when an account's external reference is already used within the tenant
+var ErrDuplicateReference = i18n.NewError("error.duplicate_reference", "external reference already in use")
+
+// tenantFrom returns the tenant the caller acts for; every tenant-owned query filters on it
+func tenantFrom(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return id, nil
+}
+
 // Postgres.go handles PostgreSQL database operations
 type Postgres struct {
-	db *sql.DB
+	db    *sql.DB
+	clock clock.Clock
+	ids   ids.Generator
+
+	// replica serves reads that tolerate replication lag when set; see reader
+	replica *sql.DB
 }
 
 // creates a new Postgres instance
 func NewPostgres(connStr string) (*Postgres, error) {
-	db, err := sql.Open("postgres", connStr)
+	db, err := openInstrumented(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
 	}
@@ -26,76 +68,627 @@ func NewPostgres(connStr string) (*Postgres, error) {
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
 	}
-	return &Postgres{db: db}, nil
+	return &Postgres{db: db, clock: clock.System, ids: ids.UUID}, nil
+}
+
+// sets the clock records are timestamped with
+func (p *Postgres) SetClock(c clock.Clock) {
+	p.clock = c
+}
+
+// sets the generator new record ids come from
+func (p *Postgres) SetIDGenerator(g ids.Generator) {
+	p.ids = g
 }
 
 // closes the database connection
 func (p *Postgres) Close() error {
+	if p.replica != nil {
+		p.replica.Close()
+	}
 	return p.db.Close()
 }
 
-// initialize the database schema
-func (p *Postgres) InitSchema(ctx context.Context) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS accounts (
+// schema statements, applied in order by InitSchema; append only, a statement's position is its schema version
+// and every statement must leave the previous build working (see checkCompatible)
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS accounts (
 		id VARCHAR(36) PRIMARY KEY,
 		balance DECIMAL(20, 2) NOT NULL,
 		created_at TIMESTAMP NOT NULL,
 		updated_at TIMESTAMP NOT NULL
-	);`
+	);`,
+	`CREATE TABLE IF NOT EXISTS notification_preferences (
+		account_id VARCHAR(36) PRIMARY KEY REFERENCES accounts(id),
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		phone VARCHAR(32) NOT NULL DEFAULT '',
+		webhook_url TEXT NOT NULL DEFAULT '',
+		events TEXT[] NOT NULL DEFAULT '{}',
+		large_withdrawal_threshold DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		low_balance_threshold DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS sweep_rules (
+		id VARCHAR(36) PRIMARY KEY,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		target_account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		target_balance DECIMAL(20, 2) NOT NULL,
+		floor_balance DECIMAL(20, 2),
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_sweep_rules_account_id ON sweep_rules (account_id);`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		key_hash VARCHAR(64) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';`,
+	`CREATE INDEX IF NOT EXISTS idx_accounts_tenant_id ON accounts (tenant_id, id);`,
+	`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';`,
+	`ALTER TABLE sweep_rules ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';`,
+	`CREATE INDEX IF NOT EXISTS idx_sweep_rules_tenant_id ON sweep_rules (tenant_id);`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';`,
+	`CREATE TABLE IF NOT EXISTS tenant_settings (
+		tenant_id VARCHAR(64) PRIMARY KEY,
+		allowed_currencies TEXT[] NOT NULL DEFAULT '{}',
+		max_transaction_amount DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		max_daily_amount DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		fees JSONB NOT NULL DEFAULT '{}',
+		webhook_endpoints TEXT[] NOT NULL DEFAULT '{}',
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'customer';`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS kyc_status VARCHAR(16) NOT NULL DEFAULT 'unverified';`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS kyc_reference VARCHAR(255) NOT NULL DEFAULT '';`,
+	`ALTER TABLE tenant_settings ADD COLUMN IF NOT EXISTS kyc_required TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS external_reference VARCHAR(255) NOT NULL DEFAULT '';`,
+	`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_external_reference ON accounts (tenant_id, external_reference) WHERE external_reference <> '';`,
+	`CREATE INDEX IF NOT EXISTS idx_accounts_metadata ON accounts USING GIN (metadata jsonb_path_ops);`,
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS sandbox BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_system ON accounts (tenant_id, kind, currency) WHERE kind <> 'customer';`,
+	`CREATE TABLE IF NOT EXISTS escrows (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		payer_account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		payee_account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		escrow_account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		amount DECIMAL(20, 2) NOT NULL,
+		currency VARCHAR(3) NOT NULL,
+		reference VARCHAR(255) NOT NULL DEFAULT '',
+		status VARCHAR(16) NOT NULL,
+		release_at TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_escrows_held ON escrows (status, expires_at);`,
+	`CREATE TABLE IF NOT EXISTS credit_buckets (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		transaction_id VARCHAR(36) NOT NULL UNIQUE,
+		amount DECIMAL(20, 2) NOT NULL,
+		remaining DECIMAL(20, 2) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_credit_buckets_active ON credit_buckets (account_id, expires_at) WHERE remaining > 0;`,
+	`CREATE INDEX IF NOT EXISTS idx_credit_buckets_expiry ON credit_buckets (expires_at) WHERE remaining > 0;`,
+	`CREATE TABLE IF NOT EXISTS statement_preferences (
+		account_id VARCHAR(36) PRIMARY KEY REFERENCES accounts(id),
+		tenant_id VARCHAR(64) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		frequency VARCHAR(16) NOT NULL DEFAULT 'monthly',
+		next_run_at TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_statement_preferences_due ON statement_preferences (next_run_at) WHERE enabled;`,
+	`CREATE TABLE IF NOT EXISTS statement_deliveries (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		email VARCHAR(255) NOT NULL,
+		period_start TIMESTAMP NOT NULL,
+		period_end TIMESTAMP NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		UNIQUE (account_id, period_start)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_statement_deliveries_ready ON statement_deliveries (status, next_attempt_at);`,
+	`ALTER TABLE statement_preferences ADD COLUMN IF NOT EXISTS locale VARCHAR(16) NOT NULL DEFAULT 'en';`,
+	`ALTER TABLE statement_deliveries ADD COLUMN IF NOT EXISTS locale VARCHAR(16) NOT NULL DEFAULT 'en';`,
+	`CREATE TABLE IF NOT EXISTS account_summaries (
+		account_id VARCHAR(36) PRIMARY KEY REFERENCES accounts(id),
+		tenant_id VARCHAR(64) NOT NULL,
+		total_deposits DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		total_withdrawals DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		transaction_count BIGINT NOT NULL DEFAULT 0,
+		last_transaction_at TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS maintenance_mode (
+		id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		message TEXT NOT NULL DEFAULT '',
+		started_at TIMESTAMP,
+		updated_by VARCHAR(255) NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS account_pauses (
+		account_id VARCHAR(36) PRIMARY KEY REFERENCES accounts(id),
+		tenant_id VARCHAR(64) NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		paused_by VARCHAR(255) NOT NULL DEFAULT '',
+		paused_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS webhook_secrets (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		secret VARCHAR(128) NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_secrets_tenant ON webhook_secrets (tenant_id);`,
+	`CREATE TABLE IF NOT EXISTS tenant_branding (
+		tenant_id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		logo_url TEXT NOT NULL DEFAULT '',
+		color VARCHAR(16) NOT NULL DEFAULT '',
+		footer TEXT NOT NULL DEFAULT '',
+		statement_template TEXT NOT NULL DEFAULT '',
+		receipt_template TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS processor_heartbeats (
+		id VARCHAR(36) PRIMARY KEY,
+		hostname VARCHAR(255) NOT NULL,
+		pid INTEGER NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		last_seen_at TIMESTAMP NOT NULL,
+		in_flight INTEGER NOT NULL DEFAULT 0,
+		processed BIGINT NOT NULL DEFAULT 0,
+		stopped_at TIMESTAMP
+	);`,
+	`CREATE TABLE IF NOT EXISTS sandbox_clocks (
+		tenant_id VARCHAR(64) PRIMARY KEY,
+		offset_seconds BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS reference_namespace VARCHAR(32) NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS authorizations (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		hold_account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		auth_code VARCHAR(64) NOT NULL,
+		merchant VARCHAR(255) NOT NULL DEFAULT '',
+		amount DECIMAL(20, 2) NOT NULL,
+		captured_amount DECIMAL(20, 2) NOT NULL DEFAULT 0,
+		currency VARCHAR(3) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		decline_reason TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_authorizations_auth_code ON authorizations (tenant_id, auth_code);`,
+	`CREATE INDEX IF NOT EXISTS idx_authorizations_due ON authorizations (status, expires_at);`,
+	`CREATE TABLE IF NOT EXISTS counterparties (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		identifiers JSONB NOT NULL DEFAULT '{}',
+		risk_rating VARCHAR(16) NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_counterparties_tenant_id ON counterparties (tenant_id, name);`,
+	`CREATE INDEX IF NOT EXISTS idx_counterparties_identifiers ON counterparties USING GIN (identifiers jsonb_path_ops);`,
+	`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		event_types TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_account_id ON webhook_subscriptions (tenant_id, account_id);`,
+	`CREATE TABLE IF NOT EXISTS rules (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		expression TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_rules_tenant_id ON rules (tenant_id, name);`,
+	`CREATE TABLE IF NOT EXISTS transaction_exceptions (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		transaction_id VARCHAR(36) NOT NULL,
+		account_id VARCHAR(36) NOT NULL,
+		amount DECIMAL(20, 2) NOT NULL,
+		currency VARCHAR(3) NOT NULL DEFAULT '',
+		reason TEXT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		reassigned_to VARCHAR(36) NOT NULL DEFAULT '',
+		resolution_transaction_id VARCHAR(36) NOT NULL DEFAULT '',
+		resolved_by VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		resolved_at TIMESTAMP,
+		UNIQUE (tenant_id, transaction_id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_transaction_exceptions_status ON transaction_exceptions (tenant_id, status, created_at);`,
+	`ALTER TABLE tenant_settings ADD COLUMN IF NOT EXISTS value_date_cutoff VARCHAR(5) NOT NULL DEFAULT '';`,
+	`ALTER TABLE tenant_settings ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS holidays (
+		calendar_code VARCHAR(16) NOT NULL,
+		date DATE NOT NULL,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		PRIMARY KEY (calendar_code, date)
+	);`,
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS back_dating BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`CREATE TABLE IF NOT EXISTS accounting_periods (
+		tenant_id VARCHAR(64) NOT NULL,
+		period CHAR(7) NOT NULL,
+		closed_by VARCHAR(255) NOT NULL DEFAULT '',
+		closed_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (tenant_id, period)
+	);`,
+	`CREATE TABLE IF NOT EXISTS transaction_templates (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		name VARCHAR(255) NOT NULL,
+		type VARCHAR(20) NOT NULL,
+		amount DECIMAL(20, 2) NOT NULL,
+		memo VARCHAR(500) NOT NULL DEFAULT '',
+		category VARCHAR(64) NOT NULL DEFAULT '',
+		counterparty_account_id VARCHAR(36) NOT NULL DEFAULT '',
+		counterparty_id VARCHAR(36) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_transaction_templates_account_id ON transaction_templates (account_id);`,
+	`CREATE TABLE IF NOT EXISTS quotes (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+		type VARCHAR(20) NOT NULL,
+		amount DECIMAL(20, 2) NOT NULL,
+		counterparty_account_id VARCHAR(36) NOT NULL DEFAULT '',
+		counterparty_id VARCHAR(36) NOT NULL DEFAULT '',
+		fee DECIMAL(20, 2) NOT NULL,
+		currency VARCHAR(3) NOT NULL,
+		used_by_reference VARCHAR(128) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS export_jobs (
+		id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		format VARCHAR(20) NOT NULL,
+		account_id VARCHAR(36) NOT NULL DEFAULT '',
+		period_from DATE NOT NULL,
+		period_to DATE NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		done INTEGER NOT NULL DEFAULT 0,
+		total INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		filename VARCHAR(255) NOT NULL DEFAULT '',
+		content_type VARCHAR(100) NOT NULL DEFAULT '',
+		size BIGINT NOT NULL DEFAULT 0,
+		artifact BYTEA,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		started_at TIMESTAMP,
+		completed_at TIMESTAMP,
+		expires_at TIMESTAMP
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_export_jobs_status ON export_jobs (status, created_at);`,
+	`ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS artifact_key TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE statement_deliveries ADD COLUMN IF NOT EXISTS document_key TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id VARCHAR(36) PRIMARY KEY,
+		kind VARCHAR(20) NOT NULL,
+		tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+		actor VARCHAR(255) NOT NULL DEFAULT '',
+		credential VARCHAR(32) NOT NULL DEFAULT '',
+		source VARCHAR(64) NOT NULL DEFAULT '',
+		method VARCHAR(10) NOT NULL DEFAULT '',
+		route VARCHAR(255) NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		request_id VARCHAR(128) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events (created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_kind ON audit_events (kind, created_at);`,
+	`ALTER TABLE tenant_settings ADD COLUMN IF NOT EXISTS ip_allowlist TEXT[] NOT NULL DEFAULT '{}';`,
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS max_transaction_amount DECIMAL(20, 2) NOT NULL DEFAULT 0;`,
+	`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS max_daily_amount DECIMAL(20, 2) NOT NULL DEFAULT 0;`,
+	`CREATE TABLE IF NOT EXISTS api_key_volume (
+		key_hash VARCHAR(64) NOT NULL,
+		day DATE NOT NULL,
+		amount DECIMAL(20, 2) NOT NULL,
+		PRIMARY KEY (key_hash, day)
+	);`,
+	`CREATE TABLE IF NOT EXISTS replication_state (
+		id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+		region VARCHAR(64) NOT NULL,
+		role VARCHAR(16) NOT NULL,
+		epoch BIGINT NOT NULL DEFAULT 0,
+		active_region VARCHAR(64) NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		captured_through TIMESTAMP,
+		last_heartbeat_at TIMESTAMP,
+		last_applied_at TIMESTAMP,
+		updated_by VARCHAR(255) NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_accounts_updated_at ON accounts (updated_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_account_summaries_updated_at ON account_summaries (updated_at);`,
+	`CREATE TABLE IF NOT EXISTS consumer_checkpoints (
+		consumer VARCHAR(255) NOT NULL,
+		source VARCHAR(255) NOT NULL,
+		partition INTEGER NOT NULL DEFAULT 0,
+		last_offset BIGINT NOT NULL DEFAULT 0,
+		high_watermark BIGINT NOT NULL DEFAULT 0,
+		delivered BIGINT NOT NULL DEFAULT 0,
+		processed BIGINT NOT NULL DEFAULT 0,
+		redelivered BIGINT NOT NULL DEFAULT 0,
+		last_message_id VARCHAR(64) NOT NULL DEFAULT '',
+		last_queued_at TIMESTAMP,
+		processed_at TIMESTAMP,
+		started_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (consumer, source, partition)
+	);`,
+	`ALTER TABLE tenant_settings ADD COLUMN IF NOT EXISTS insufficient_funds JSONB NOT NULL DEFAULT '{}';`,
+	`CREATE TABLE IF NOT EXISTS account_funding_policies (
+		account_id VARCHAR(36) PRIMARY KEY REFERENCES accounts(id),
+		tenant_id VARCHAR(64) NOT NULL,
+		mode VARCHAR(16) NOT NULL,
+		wait_hours INTEGER NOT NULL DEFAULT 0,
+		retry_interval_minutes INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	// the replication outbox: every write to an account or its summary adds a row in the same transaction,
+	// stamped with that transaction's id so capture can follow commits rather than the clock
+	`CREATE TABLE IF NOT EXISTS account_changes (
+		seq BIGSERIAL PRIMARY KEY,
+		txid BIGINT NOT NULL DEFAULT txid_current(),
+		account_id VARCHAR(36) NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_account_changes_txid ON account_changes (txid);`,
+	`CREATE OR REPLACE FUNCTION record_account_change() RETURNS trigger AS $$
+	BEGIN
+		INSERT INTO account_changes (account_id) VALUES (to_jsonb(NEW) ->> TG_ARGV[0]);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`CREATE TRIGGER accounts_record_change AFTER INSERT OR UPDATE ON accounts
+		FOR EACH ROW EXECUTE FUNCTION record_account_change('id');`,
+	`CREATE TRIGGER account_summaries_record_change AFTER INSERT OR UPDATE ON account_summaries
+		FOR EACH ROW EXECUTE FUNCTION record_account_change('account_id');`,
+	`ALTER TABLE replication_state ADD COLUMN IF NOT EXISTS captured_txid BIGINT;`,
+	// money columns were DECIMAL(20, 2), which rounded amounts in 3 and 4 decimal currencies; NUMERIC(24, 4)
+	// holds every ISO 4217 minor unit and two more integer digits
+	`ALTER TABLE accounts ALTER COLUMN balance TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE notification_preferences
+		ALTER COLUMN large_withdrawal_threshold TYPE NUMERIC(24, 4),
+		ALTER COLUMN low_balance_threshold TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE sweep_rules
+		ALTER COLUMN target_balance TYPE NUMERIC(24, 4),
+		ALTER COLUMN floor_balance TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE tenant_settings
+		ALTER COLUMN max_transaction_amount TYPE NUMERIC(24, 4),
+		ALTER COLUMN max_daily_amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE escrows ALTER COLUMN amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE credit_buckets
+		ALTER COLUMN amount TYPE NUMERIC(24, 4),
+		ALTER COLUMN remaining TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE account_summaries
+		ALTER COLUMN total_deposits TYPE NUMERIC(24, 4),
+		ALTER COLUMN total_withdrawals TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE authorizations
+		ALTER COLUMN amount TYPE NUMERIC(24, 4),
+		ALTER COLUMN captured_amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE transaction_exceptions ALTER COLUMN amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE transaction_templates ALTER COLUMN amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE quotes
+		ALTER COLUMN amount TYPE NUMERIC(24, 4),
+		ALTER COLUMN fee TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE api_keys
+		ALTER COLUMN max_transaction_amount TYPE NUMERIC(24, 4),
+		ALTER COLUMN max_daily_amount TYPE NUMERIC(24, 4);`,
+	`ALTER TABLE api_key_volume ALTER COLUMN amount TYPE NUMERIC(24, 4);`,
+	`CREATE TABLE IF NOT EXISTS applied_transactions (
+		transaction_id VARCHAR(36) PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL,
+		balance_before NUMERIC(24, 4) NOT NULL,
+		balance_after NUMERIC(24, 4) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE replication_state ADD COLUMN IF NOT EXISTS capture_token BYTEA;`,
+	`CREATE TABLE IF NOT EXISTS account_volume (
+		account_id VARCHAR(36) NOT NULL,
+		day DATE NOT NULL,
+		amount NUMERIC(24, 4) NOT NULL,
+		PRIMARY KEY (account_id, day)
+	);`,
+}
 
-	_, err := p.db.ExecContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("failed to create accounts table: %w", err)
+const accountColumns = "id, tenant_id, kind, currency, balance, kyc_status, kyc_reference, external_reference, metadata, created_at, updated_at"
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var account models.Account
+	var metadata []byte
+	if err := row.Scan(
+		&account.ID, &account.TenantID, &account.Kind, &account.Currency, &account.Balance,
+		&account.KYCStatus, &account.KYCReference, &account.ExternalReference, &metadata,
+		&account.CreatedAt, &account.UpdatedAt,
+	); err != nil {
+		return nil, err
 	}
-	return nil
+	if err := json.Unmarshal(metadata, &account.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode account metadata: %w", err)
+	}
+	return &account, nil
 }
 
-// creates a new account
-func (p *Postgres) CreateAccount(ctx context.Context, initialBalance float64) (*models.Account, error) {
-	id := uuid.New().String()
-	now := time.Now()
+// returns the id for a new account, so records of it can be written before the account itself
+func (p *Postgres) NewAccountID() string {
+	return p.ids.NewID()
+}
 
-	query := `
-	INSERT INTO accounts (id, balance, created_at, updated_at)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, balance, created_at, updated_at`
+// creates a new account with an id from NewAccountID
+func (p *Postgres) CreateAccount(ctx context.Context, id string, initialBalance float64, currency, externalReference string, metadata map[string]string) (*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	var account models.Account
-	err := p.db.QueryRowContext(
-		ctx, query, id, initialBalance, now, now,
-	).Scan(&account.ID, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	now := p.clock.Now(ctx)
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode account metadata: %w", err)
+	}
+
+	query := `
+	INSERT INTO accounts (id, tenant_id, kind, currency, balance, external_reference, metadata, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING ` + accountColumns
 
+	account, err := scanAccount(p.db.QueryRowContext(
+		ctx, query, id, tenantID, models.CustomerAccount, currency, initialBalance, externalReference, encoded, now, now,
+	))
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && externalReference != "" {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateReference, externalReference)
+		}
 		return nil, fmt.Errorf("failed to create account: %w", err)
 	}
 
-	return &account, nil
+	return account, nil
+}
+
+// returns the currency of each of the given accounts that belongs to the tenant, keyed by account id
+func (p *Postgres) GetAccountCurrencies(ctx context.Context, ids []string) (map[string]string, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT id, currency FROM accounts WHERE id = ANY($1) AND tenant_id = $2",
+		pq.Array(ids), tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account currencies: %w", err)
+	}
+	defer rows.Close()
+
+	currencies := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, currency string
+		if err := rows.Scan(&id, &currency); err != nil {
+			return nil, fmt.Errorf("failed to scan account currency: %w", err)
+		}
+		currencies[id] = currency
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get account currencies: %w", err)
+	}
+
+	return currencies, nil
+}
+
+// returns the tenant's system account of the given kind and currency, creating it on first use
+func (p *Postgres) GetOrCreateSystemAccount(ctx context.Context, kind models.AccountKind, currency string) (*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.clock.Now(ctx)
+	_, err = p.db.ExecContext(ctx, `
+	INSERT INTO accounts (id, tenant_id, kind, currency, balance, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, 0, $5, $5)
+	ON CONFLICT (tenant_id, kind, currency) WHERE kind <> 'customer' DO NOTHING`,
+		p.ids.NewID(), tenantID, kind, currency, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create system account: %w", err)
+	}
+
+	account, err := scanAccount(p.db.QueryRowContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE tenant_id = $1 AND kind = $2 AND currency = $3",
+		tenantID, kind, currency,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system account: %w", err)
+	}
+
+	return account, nil
 }
 
 // retrieves an account by ID
 func (p *Postgres) GetAccount(ctx context.Context, id string) (*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-	SELECT id, balance, created_at, updated_at
+	SELECT ` + accountColumns + `
 	FROM accounts
-	WHERE id = $1`
+	WHERE id = $1 AND tenant_id = $2`
 
-	var account models.Account
-	err := p.db.QueryRowContext(ctx, query, id).Scan(
-		&account.ID, &account.Balance, &account.CreatedAt, &account.UpdatedAt,
-	)
+	account, err := scanAccount(p.reader(ctx).QueryRowContext(ctx, query, id, tenantID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("account not found")
+			return nil, ErrAccountNotFound
 		}
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
-	return &account, nil
+	return account, nil
 }
 
-// updates the account balance
-func (p *Postgres) UpdateAccountBalance(ctx context.Context, id string, amount float64) (balanceBefore, balanceAfter float64, err error) {
+// updates the account balance by amount and takes fee on top, crediting it to the fee income account
+func (p *Postgres) UpdateAccountBalance(ctx context.Context, id, transactionID string, amount, fee float64) (balanceBefore, balanceAfter float64, err error) {
+	err = conflictRetry.Do(ctx, func(ctx context.Context) (err error) {
+		balanceBefore, balanceAfter, err = p.updateAccountBalance(ctx, id, transactionID, amount, fee)
+		return err
+	})
+	return balanceBefore, balanceAfter, err
+}
+
+func (p *Postgres) updateAccountBalance(ctx context.Context, id, transactionID string, amount, fee float64) (balanceBefore, balanceAfter float64, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	// Start a transaction
 	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -109,38 +702,176 @@ func (p *Postgres) UpdateAccountBalance(ctx context.Context, id string, amount f
 
 	// Get current balance with row lock
 	var currentBalance float64
+	var currency string
 	err = tx.QueryRowContext(
 		ctx,
-		"SELECT balance FROM accounts WHERE id = $1 FOR UPDATE",
-		id,
-	).Scan(&currentBalance)
+		"SELECT balance, currency FROM accounts WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		id, tenantID,
+	).Scan(&currentBalance, &currency)
 
 	if err != nil {
 		return 0, 0, fmt.Errorf("Failed to get current balance: %w", err)
 	}
+	if before, after, applied, checkErr := appliedBalance(ctx, tx, tenantID, transactionID); checkErr != nil {
+		err = checkErr
+		return 0, 0, err
+	} else if applied {
+		err = tx.Rollback()
+		return before, after, err
+	}
 
 	// Calculate new balance
+	amount -= fee
 	newBalance := currentBalance + amount
 
 	// Check for negative balance
 	if newBalance < 0 {
-		return 0, 0, fmt.Errorf("insufficient funds")
+		return 0, 0, ErrInsufficientFunds
+	}
+
+	// Debits spend promotional credit before cash
+	if amount < 0 {
+		if err = p.consumeCredits(ctx, tx, id, -amount); err != nil {
+			return 0, 0, err
+		}
 	}
 
 	// Update balance
+	now := p.clock.Now(ctx)
 	_, err = tx.ExecContext(
 		ctx,
 		"UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3",
-		newBalance, time.Now(), id,
+		newBalance, now, id,
 	)
 
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to update balance: %w", err)
 	}
 
+	credited, debited := amount, 0.0
+	if amount < 0 {
+		credited, debited = 0, -amount
+	}
+	if err = recordActivity(ctx, tx, tenantID, id, credited, debited, now); err != nil {
+		return 0, 0, err
+	}
+	if err = p.postContra(ctx, tx, tenantID, models.FeeIncomeAccount, currency, fee, now); err != nil {
+		return 0, 0, err
+	}
+	if err = recordApplied(ctx, tx, tenantID, transactionID, currentBalance, newBalance, now); err != nil {
+		return 0, 0, err
+	}
+
 	if err = tx.Commit(); err != nil {
-		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+		return 0, 0, commitError(err)
 	}
 
 	return currentBalance, newBalance, nil
 }
+
+// moves amount from one account to another in a single database transaction
+// and returns the source account's balance before and after
+// fee is taken from the source account on top of amount and credited to the fee income account
+func (p *Postgres) TransferBalance(ctx context.Context, fromID, toID, transactionID string, amount, fee float64) (balanceBefore, balanceAfter float64, err error) {
+	err = conflictRetry.Do(ctx, func(ctx context.Context) (err error) {
+		balanceBefore, balanceAfter, err = p.transferBalance(ctx, fromID, toID, transactionID, amount, fee)
+		return err
+	})
+	return balanceBefore, balanceAfter, err
+}
+
+func (p *Postgres) transferBalance(ctx context.Context, fromID, toID, transactionID string, amount, fee float64) (balanceBefore, balanceAfter float64, err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Lock both rows in a stable order so concurrent opposite transfers can't deadlock
+	balances := make(map[string]float64, 2)
+	var currency string
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id, balance, currency FROM accounts WHERE id = ANY($1) AND tenant_id = $2 ORDER BY id FOR UPDATE",
+		pq.Array([]string{fromID, toID}), tenantID,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lock accounts: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var balance float64
+		if err = rows.Scan(&id, &balance, &currency); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to read balance: %w", err)
+		}
+		balances[id] = balance
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read balances: %w", err)
+	}
+
+	fromBalance, ok := balances[fromID]
+	if !ok {
+		err = ErrAccountNotFound
+		return 0, 0, err
+	}
+	toBalance, ok := balances[toID]
+	if !ok {
+		err = ErrCounterpartyAccountNotFound
+		return 0, 0, err
+	}
+	if before, after, applied, checkErr := appliedBalance(ctx, tx, tenantID, transactionID); checkErr != nil {
+		err = checkErr
+		return 0, 0, err
+	} else if applied {
+		err = tx.Rollback()
+		return before, after, err
+	}
+
+	newFromBalance := fromBalance - amount - fee
+	if newFromBalance < 0 {
+		err = ErrInsufficientFunds
+		return 0, 0, err
+	}
+	if err = p.consumeCredits(ctx, tx, fromID, amount+fee); err != nil {
+		return 0, 0, err
+	}
+
+	now := p.clock.Now(ctx)
+	if _, err = tx.ExecContext(ctx, "UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3", newFromBalance, now, fromID); err != nil {
+		return 0, 0, fmt.Errorf("failed to debit account: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3", toBalance+amount, now, toID); err != nil {
+		return 0, 0, fmt.Errorf("failed to credit account: %w", err)
+	}
+	if err = recordActivity(ctx, tx, tenantID, fromID, 0, amount+fee, now); err != nil {
+		return 0, 0, err
+	}
+	if err = recordActivity(ctx, tx, tenantID, toID, amount, 0, now); err != nil {
+		return 0, 0, err
+	}
+	// transfers are between accounts of one currency
+	if err = p.postContra(ctx, tx, tenantID, models.FeeIncomeAccount, currency, fee, now); err != nil {
+		return 0, 0, err
+	}
+	if err = recordApplied(ctx, tx, tenantID, transactionID, fromBalance, newFromBalance, now); err != nil {
+		return 0, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, commitError(err)
+	}
+
+	return fromBalance, newFromBalance, nil
+}
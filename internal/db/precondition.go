@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+)
+
+// ErrModified is returned by conditional writes when the record changed after the version the caller based them on
+var ErrModified = i18n.NewError("error.resource_modified", "resource was modified")
+
+type versionKey struct{}
+
+// IfVersion returns a copy of ctx whose conditional writes only apply while the record's updated_at is still
+// version, so an edit based on a stale read fails with ErrModified instead of overwriting a concurrent one
+func IfVersion(ctx context.Context, version time.Time) context.Context {
+	return context.WithValue(ctx, versionKey{}, version)
+}
+
+// returns the updated_at a conditional write expects, if the caller set one
+func expectedVersion(ctx context.Context) (time.Time, bool) {
+	version, ok := ctx.Value(versionKey{}).(time.Time)
+	return version, ok
+}
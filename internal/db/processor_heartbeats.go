@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// records a processor replica's heartbeat; processors are platform wide, so not tenant scoped
+func (p *Postgres) UpsertProcessorHeartbeat(ctx context.Context, hb *models.ProcessorHeartbeat) error {
+	_, err := p.db.ExecContext(ctx, `
+	INSERT INTO processor_heartbeats (id, hostname, pid, started_at, last_seen_at, in_flight, processed, stopped_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (id) DO UPDATE SET
+		last_seen_at = EXCLUDED.last_seen_at,
+		in_flight = EXCLUDED.in_flight,
+		processed = EXCLUDED.processed,
+		stopped_at = EXCLUDED.stopped_at`,
+		hb.ID, hb.Hostname, hb.PID, hb.StartedAt, hb.LastSeenAt, hb.InFlight, hb.Processed, hb.StoppedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record processor heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves the processors that reported since the given time, most recent first
+func (p *Postgres) GetProcessorHeartbeats(ctx context.Context, since time.Time) ([]*models.ProcessorHeartbeat, error) {
+	rows, err := p.db.QueryContext(ctx, `
+	SELECT id, hostname, pid, started_at, last_seen_at, in_flight, processed, stopped_at
+	FROM processor_heartbeats
+	WHERE last_seen_at >= $1
+	ORDER BY last_seen_at DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processor heartbeats: %w", err)
+	}
+	defer rows.Close()
+
+	heartbeats := []*models.ProcessorHeartbeat{}
+	for rows.Next() {
+		var hb models.ProcessorHeartbeat
+		var stoppedAt sql.NullTime
+		if err := rows.Scan(&hb.ID, &hb.Hostname, &hb.PID, &hb.StartedAt, &hb.LastSeenAt, &hb.InFlight, &hb.Processed, &stoppedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan processor heartbeat: %w", err)
+		}
+		if stoppedAt.Valid {
+			hb.StoppedAt = &stoppedAt.Time
+		}
+		heartbeats = append(heartbeats, &hb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get processor heartbeats: %w", err)
+	}
+
+	return heartbeats, nil
+}
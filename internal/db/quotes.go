@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrQuoteNotFound is returned when the tenant has no quote with the given ID
+var ErrQuoteNotFound = i18n.NewError("error.quote_not_found", "quote not found")
+
+const quoteColumns = "id, tenant_id, account_id, type, amount, counterparty_account_id, counterparty_id, fee, currency, used_by_reference, created_at, expires_at"
+
+// creates a new quote
+func (p *Postgres) CreateQuote(ctx context.Context, q *models.Quote) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	q.ID = p.ids.NewID()
+	q.TenantID = tenantID
+
+	query := `
+	INSERT INTO quotes (` + quoteColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		q.ID, q.TenantID, q.AccountID, q.Type, q.Amount, q.CounterpartyAccountID, q.CounterpartyID,
+		q.Fee, q.Currency, q.UsedByReference, q.CreatedAt, q.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create quote: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves a quote by ID
+func (p *Postgres) GetQuote(ctx context.Context, id string) (*models.Quote, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var q models.Quote
+	err = p.db.QueryRowContext(ctx,
+		"SELECT "+quoteColumns+" FROM quotes WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	).Scan(
+		&q.ID, &q.TenantID, &q.AccountID, &q.Type, &q.Amount, &q.CounterpartyAccountID, &q.CounterpartyID,
+		&q.Fee, &q.Currency, &q.UsedByReference, &q.CreatedAt, &q.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrQuoteNotFound
+		}
+		return nil, fmt.Errorf("failed to get quote: %w", err)
+	}
+
+	return &q, nil
+}
+
+// marks a quote used by the transaction with the given reference, reporting whether it could be: it must be
+// unused or already used by the same reference, and not expired at the time given
+func (p *Postgres) UseQuote(ctx context.Context, id, reference string, now time.Time) (bool, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := p.db.ExecContext(ctx, `
+	UPDATE quotes SET used_by_reference = $1
+	WHERE id = $2 AND tenant_id = $3 AND used_by_reference IN ('', $1) AND expires_at > $4`,
+		reference, id, tenantID, now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to use quote: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
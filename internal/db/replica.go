@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type primaryKey struct{}
+
+// WithPrimary returns a copy of ctx whose reads go to the primary even when a read replica is connected,
+// for callers that must see their own recent writes
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// connects the read replica that lag-tolerant reads (account lookups and listings) are sent to;
+// balance updates and every other write, and reads inside them, always use the primary
+func (p *Postgres) SetReplica(connStr string) error {
+	replica, err := openInstrumented(connStr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres replica: %w", err)
+	}
+	if err := replica.Ping(); err != nil {
+		replica.Close()
+		return fmt.Errorf("failed to ping postgres replica: %w", err)
+	}
+	p.replica = replica
+	return nil
+}
+
+// returns the pool for a read that may lag behind the primary
+func (p *Postgres) reader(ctx context.Context) *sql.DB {
+	if p.replica == nil {
+		return p.db
+	}
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return p.db
+	}
+	return p.replica
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrReplicationStateNotFound is returned when the database has no replication state yet
+var ErrReplicationStateNotFound = errors.New("replication state not found")
+
+// retrieves the region's replication state; like the maintenance switch it is a platform setting, so not
+// tenant scoped
+func (p *Postgres) GetReplicationState(ctx context.Context) (*models.ReplicationStatus, error) {
+	var status models.ReplicationStatus
+	var capturedThrough, lastHeartbeatAt, lastAppliedAt sql.NullTime
+	var capturedTxID sql.NullInt64
+	err := p.db.QueryRowContext(ctx, `
+	SELECT region, role, epoch, active_region, reason, captured_through, captured_txid, capture_token,
+		last_heartbeat_at, last_applied_at, updated_by, updated_at
+	FROM replication_state WHERE id`,
+	).Scan(
+		&status.Region, &status.Role, &status.Epoch, &status.ActiveRegion, &status.Reason,
+		&capturedThrough, &capturedTxID, &status.CaptureToken, &lastHeartbeatAt, &lastAppliedAt,
+		&status.UpdatedBy, &status.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReplicationStateNotFound
+		}
+		return nil, fmt.Errorf("failed to get replication state: %w", err)
+	}
+	if capturedThrough.Valid {
+		status.CapturedThrough = &capturedThrough.Time
+	}
+	if capturedTxID.Valid {
+		status.CapturedTxID = &capturedTxID.Int64
+	}
+	if lastHeartbeatAt.Valid {
+		status.LastHeartbeatAt = &lastHeartbeatAt.Time
+	}
+	if lastAppliedAt.Valid {
+		status.LastAppliedAt = &lastAppliedAt.Time
+	}
+
+	return &status, nil
+}
+
+// records the state a region starts out in, unless it has one already
+func (p *Postgres) InitReplicationState(ctx context.Context, status *models.ReplicationStatus) error {
+	status.UpdatedAt = p.clock.Now(ctx)
+
+	_, err := p.db.ExecContext(ctx, `
+	INSERT INTO replication_state (id, region, role, epoch, active_region, reason, updated_by, updated_at)
+	VALUES (TRUE, $1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO NOTHING`,
+		status.Region, status.Role, status.Epoch, status.ActiveRegion, status.Reason, status.UpdatedBy, status.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to init replication state: %w", err)
+	}
+
+	return nil
+}
+
+// changes the region's role and epoch, provided its epoch is still expectEpoch
+// returns false when another promotion or fence got there first
+func (p *Postgres) SetReplicationRole(ctx context.Context, status *models.ReplicationStatus, expectEpoch int64) (bool, error) {
+	status.UpdatedAt = p.clock.Now(ctx)
+
+	result, err := p.db.ExecContext(ctx, `
+	UPDATE replication_state SET
+		role = $1, epoch = $2, active_region = $3, reason = $4, updated_by = $5, updated_at = $6
+	WHERE id AND epoch = $7`,
+		status.Role, status.Epoch, status.ActiveRegion, status.Reason, status.UpdatedBy, status.UpdatedAt, expectEpoch,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to set replication role: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to set replication role: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// records a promotion newer than any the region knew of; an active region it supersedes is fenced in the same
+// statement, so the two can't both go on taking writes. Returns false for an epoch that isn't newer
+func (p *Postgres) ObserveReplicationEpoch(ctx context.Context, epoch int64, activeRegion string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, `
+	UPDATE replication_state SET
+		epoch = $1,
+		active_region = $2,
+		role = CASE WHEN role = $3 THEN $4 ELSE role END,
+		reason = CASE WHEN role = $3 THEN 'superseded by ' || $2 ELSE reason END,
+		updated_by = 'replication',
+		updated_at = $5
+	WHERE id AND epoch < $1`,
+		epoch, activeRegion, models.RoleActive, models.RoleFenced, p.clock.Now(ctx),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record replication epoch: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record replication epoch: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// records how far replication got; nil values are left as they are, and updated_at, which is only about role
+// changes, isn't touched
+func (p *Postgres) SaveReplicationProgress(ctx context.Context, capturedThrough *time.Time, capturedTxID *int64, captureToken []byte, lastHeartbeatAt, lastAppliedAt *time.Time) error {
+	_, err := p.db.ExecContext(ctx, `
+	UPDATE replication_state SET
+		captured_through = COALESCE($1, captured_through),
+		captured_txid = COALESCE($2, captured_txid),
+		capture_token = COALESCE($3, capture_token),
+		last_heartbeat_at = COALESCE($4, last_heartbeat_at),
+		last_applied_at = COALESCE($5, last_applied_at)
+	WHERE id`,
+		capturedThrough, capturedTxID, captureToken, lastHeartbeatAt, lastAppliedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save replication progress: %w", err)
+	}
+
+	return nil
+}
+
+// returns the oldest transaction id that may still be running; every change in account_changes from an older
+// transaction has committed or never will, so it is where capture can safely read up to
+func (p *Postgres) AccountChangesHead(ctx context.Context) (int64, error) {
+	var head int64
+	if err := p.db.QueryRowContext(ctx, "SELECT txid_snapshot_xmin(txid_current_snapshot())").Scan(&head); err != nil {
+		return 0, fmt.Errorf("failed to read account changes head: %w", err)
+	}
+	return head, nil
+}
+
+// streams the accounts changed by transactions from after up to the head, each once in the order of its latest
+// change, and returns that head for the next call to start from. Changes are recorded in the same transaction as
+// the write, so one that commits late is still captured, however long after it was stamped
+// not tenant scoped: it is only used by replication, which carries every tenant
+func (p *Postgres) ExportAccountChanges(ctx context.Context, after int64, fn func(*models.Account, *models.AccountSummary) error) (int64, error) {
+	head, err := p.AccountChangesHead(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if head <= after {
+		return after, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+	SELECT `+exportedAccountColumns+`
+	FROM (
+		SELECT account_id, MAX(seq) AS seq FROM account_changes WHERE txid >= $1 AND txid < $2 GROUP BY account_id
+	) c
+	JOIN accounts a ON a.id = c.account_id
+	LEFT JOIN account_summaries s ON s.account_id = a.id
+	ORDER BY c.seq`,
+		after, head,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export changed accounts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account, summary, err := scanExportedAccount(rows)
+		if err != nil {
+			return 0, err
+		}
+		if err := fn(account, summary); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to export changed accounts: %w", err)
+	}
+
+	return head, nil
+}
+
+// removes the recorded account changes of transactions older than before that have finished; captured ones
+// aren't needed again, and a region that isn't active has nothing to capture
+func (p *Postgres) PruneAccountChanges(ctx context.Context, before int64) error {
+	if _, err := p.db.ExecContext(ctx,
+		"DELETE FROM account_changes WHERE txid < LEAST($1, txid_snapshot_xmin(txid_current_snapshot()))", before,
+	); err != nil {
+		return fmt.Errorf("failed to prune account changes: %w", err)
+	}
+	return nil
+}
+
+// removes every recorded account change of a finished transaction, for a deployment that doesn't replicate and
+// so never captures them
+// intended to be run by the scheduler
+func (p *Postgres) DiscardAccountChanges(ctx context.Context) error {
+	return p.PruneAccountChanges(ctx, math.MaxInt64)
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrCommitUnknown is returned when the connection failed while a balance change was committing: Postgres may
+// have committed it all the same, so it must be neither failed nor run again without finding out
+var ErrCommitUnknown = errors.New("outcome of the commit is unknown")
+
+// how a balance change is run again after Postgres aborted its transaction over a conflict with a concurrent
+// one; nothing of an aborted transaction was applied, so running it again is safe
+var conflictRetry = retry.Policy{
+	MaxAttempts: 3,
+	BaseDelay:   20 * time.Millisecond,
+	MaxDelay:    200 * time.Millisecond,
+	Jitter:      0.5,
+	Retryable:   isConflict,
+}
+
+// reports whether err is Postgres aborting a transaction as a serialization failure or to break a deadlock
+func isConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// IsTransient reports whether err is the database being unreachable or overloaded for now rather than refusing
+// the operation: dropped connections, timeouts, Postgres shutting down or out of resources, MongoDB network and
+// server selection errors, and conflicts with concurrent transactions. The same operation may succeed later
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrCommitUnknown) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		// connection exception, insufficient resources, operator intervention (shutdown, statement timeout)
+		case "08", "53", "57":
+			return true
+		}
+		return isConflict(err)
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// commitError reports a failed commit of a balance change. Postgres rolled back a conflict, but a connection that
+// failed while committing leaves the outcome unknown
+func commitError(err error) error {
+	if IsTransient(err) && !isConflict(err) {
+		return fmt.Errorf("failed to commit transaction: %w: %v", ErrCommitUnknown, err)
+	}
+	return fmt.Errorf("failed to commit transaction: %w", err)
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"too many connections", &pq.Error{Code: "53300"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"statement timeout", &pq.Error{Code: "57014"}, true},
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"undefined table", &pq.Error{Code: "42P01"}, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection done", sql.ErrConnDone, true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"wrapped deadline", fmt.Errorf("failed to get account: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"net error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"mongo network error", mongo.CommandError{Labels: []string{"NetworkError"}}, true},
+		{"mongo command error", mongo.CommandError{Code: 11000}, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"account not found", ErrAccountNotFound, false},
+		{"commit unknown", fmt.Errorf("failed to commit transaction: %w: %v", ErrCommitUnknown, driver.ErrBadConn), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitError(t *testing.T) {
+	if err := commitError(driver.ErrBadConn); !errors.Is(err, ErrCommitUnknown) {
+		t.Errorf("a connection lost while committing should leave the outcome unknown, got %v", err)
+	}
+	if err := commitError(&pq.Error{Code: "40001"}); errors.Is(err, ErrCommitUnknown) || !IsTransient(err) {
+		t.Errorf("a conflict was rolled back and should be retried, got %v", err)
+	}
+}
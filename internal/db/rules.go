@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrRuleNotFound is returned when the tenant has no rule with the given ID
+var ErrRuleNotFound = i18n.NewError("error.rule_not_found", "rule not found")
+
+const ruleColumns = "id, tenant_id, name, kind, expression, enabled, created_at, updated_at"
+
+func scanRule(row rowScanner) (*models.Rule, error) {
+	var rule models.Rule
+	if err := row.Scan(&rule.ID, &rule.TenantID, &rule.Name, &rule.Kind, &rule.Expression, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// creates a new rule
+func (p *Postgres) CreateRule(ctx context.Context, rule *models.Rule) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	rule.ID = p.ids.NewID()
+	rule.TenantID = tenantID
+	now := p.clock.Now(ctx)
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	query := `
+	INSERT INTO rules (` + ruleColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		rule.ID, rule.TenantID, rule.Name, rule.Kind, rule.Expression, rule.Enabled, rule.CreatedAt, rule.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create rule: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves a rule by ID
+func (p *Postgres) GetRule(ctx context.Context, id string) (*models.Rule, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := scanRule(p.db.QueryRowContext(ctx,
+		"SELECT "+ruleColumns+" FROM rules WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// lists the tenant's rules by name
+func (p *Postgres) GetRules(ctx context.Context, limit, offset int) ([]*models.Rule, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.queryRules(ctx,
+		"SELECT "+ruleColumns+" FROM rules WHERE tenant_id = $1 ORDER BY name, id LIMIT $2 OFFSET $3",
+		tenantID, limit, offset,
+	)
+}
+
+// lists every enabled rule of the tenant, by name
+func (p *Postgres) GetEnabledRules(ctx context.Context) ([]*models.Rule, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.queryRules(ctx,
+		"SELECT "+ruleColumns+" FROM rules WHERE tenant_id = $1 AND enabled ORDER BY name, id",
+		tenantID,
+	)
+}
+
+func (p *Postgres) queryRules(ctx context.Context, query string, args ...interface{}) ([]*models.Rule, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*models.Rule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// saves a rule's name, kind, expression and whether it is enabled
+func (p *Postgres) UpdateRule(ctx context.Context, rule *models.Rule) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+	rule.UpdatedAt = p.clock.Now(ctx)
+
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE rules SET name = $1, kind = $2, expression = $3, enabled = $4, updated_at = $5 WHERE id = $6 AND tenant_id = $7",
+		rule.Name, rule.Kind, rule.Expression, rule.Enabled, rule.UpdatedAt, rule.ID, tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// deletes a rule
+func (p *Postgres) DeleteRule(ctx context.Context, id string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, "DELETE FROM rules WHERE id = $1 AND tenant_id = $2", id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// retrieves how far every sandbox clock has been advanced
+// not tenant scoped: it feeds the simulated clock shared by every tenant on a replica
+func (p *Postgres) GetSandboxClockOffsets(ctx context.Context) (map[string]time.Duration, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT tenant_id, offset_seconds FROM sandbox_clocks")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sandbox clocks: %w", err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[string]time.Duration)
+	for rows.Next() {
+		var tenantID string
+		var seconds int64
+		if err := rows.Scan(&tenantID, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan sandbox clock: %w", err)
+		}
+		offsets[tenantID] = time.Duration(seconds) * time.Second
+	}
+
+	return offsets, rows.Err()
+}
+
+// retrieves how far the tenant's sandbox clock has been advanced; zero when it never was
+func (p *Postgres) GetSandboxClockOffset(ctx context.Context) (time.Duration, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var seconds int64
+	err = p.db.QueryRowContext(ctx, "SELECT offset_seconds FROM sandbox_clocks WHERE tenant_id = $1", tenantID).Scan(&seconds)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get sandbox clock: %w", err)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// moves the tenant's sandbox clock forward by d and returns the new offset
+func (p *Postgres) AdvanceSandboxClock(ctx context.Context, d time.Duration) (time.Duration, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var seconds int64
+	err = p.db.QueryRowContext(ctx, `
+	INSERT INTO sandbox_clocks (tenant_id, offset_seconds, updated_at) VALUES ($1, $2, $3)
+	ON CONFLICT (tenant_id) DO UPDATE SET
+		offset_seconds = sandbox_clocks.offset_seconds + EXCLUDED.offset_seconds,
+		updated_at = EXCLUDED.updated_at
+	RETURNING offset_seconds`,
+		tenantID, int64(d/time.Second), p.clock.Now(ctx),
+	).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance sandbox clock: %w", err)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,257 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const statementPreferencesColumns = "account_id, enabled, email, frequency, next_run_at, tenant_id, updated_at, locale"
+
+func scanStatementPreferences(row rowScanner) (*models.StatementPreferences, error) {
+	var prefs models.StatementPreferences
+	var nextRunAt sql.NullTime
+	if err := row.Scan(
+		&prefs.AccountID, &prefs.Enabled, &prefs.Email, &prefs.Frequency, &nextRunAt, &prefs.TenantID, &prefs.UpdatedAt, &prefs.Locale,
+	); err != nil {
+		return nil, err
+	}
+	if nextRunAt.Valid {
+		prefs.NextRunAt = &nextRunAt.Time
+	}
+	return &prefs, nil
+}
+
+// retrieves an account's statement preferences, nil when none are stored
+func (p *Postgres) GetStatementPreferences(ctx context.Context, accountID string) (*models.StatementPreferences, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := scanStatementPreferences(p.db.QueryRowContext(ctx,
+		"SELECT "+statementPreferencesColumns+" FROM statement_preferences WHERE account_id = $1 AND tenant_id = $2",
+		accountID, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get statement preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+// creates or replaces an account's statement preferences
+func (p *Postgres) UpsertStatementPreferences(ctx context.Context, prefs *models.StatementPreferences) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+	prefs.TenantID = tenantID
+	prefs.UpdatedAt = p.clock.Now(ctx)
+
+	query := `
+	INSERT INTO statement_preferences (` + statementPreferencesColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (account_id) DO UPDATE SET
+		enabled = EXCLUDED.enabled,
+		email = EXCLUDED.email,
+		locale = EXCLUDED.locale,
+		frequency = EXCLUDED.frequency,
+		next_run_at = EXCLUDED.next_run_at,
+		updated_at = EXCLUDED.updated_at
+	WHERE statement_preferences.tenant_id = EXCLUDED.tenant_id`
+
+	_, err = p.db.ExecContext(ctx, query,
+		prefs.AccountID, prefs.Enabled, prefs.Email, prefs.Frequency, prefs.NextRunAt, prefs.TenantID, prefs.UpdatedAt, prefs.Locale,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save statement preferences: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves enabled statement preferences whose next run is due, across all tenants or only tenantID when set,
+// for the scheduler; callers must scope further work to each preference's TenantID
+func (p *Postgres) GetDueStatementPreferences(ctx context.Context, tenantID string, now time.Time) ([]*models.StatementPreferences, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT "+statementPreferencesColumns+" FROM statement_preferences WHERE enabled AND next_run_at <= $1 AND ($2 = '' OR tenant_id = $2) ORDER BY next_run_at",
+		now, tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statement preferences: %w", err)
+	}
+	defer rows.Close()
+
+	var due []*models.StatementPreferences
+	for rows.Next() {
+		prefs, err := scanStatementPreferences(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan statement preferences: %w", err)
+		}
+		due = append(due, prefs)
+	}
+
+	return due, rows.Err()
+}
+
+// records a statement delivery for the period and moves the account's next run forward in one step
+// a period that already has a delivery is not scheduled twice
+func (p *Postgres) ScheduleStatementDelivery(ctx context.Context, delivery *models.StatementDelivery, nextRunAt time.Time) (err error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	delivery.ID = p.ids.NewID()
+	delivery.TenantID = tenantID
+	delivery.Status = models.DeliveryPending
+	now := p.clock.Now(ctx)
+	delivery.CreatedAt = now
+	delivery.NextAttemptAt = now
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO statement_deliveries (id, tenant_id, account_id, email, period_start, period_end, status, attempts, last_error, next_attempt_at, created_at, updated_at, locale)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, 0, '', $8, $9, $9, $10)
+	ON CONFLICT (account_id, period_start) DO NOTHING`,
+		delivery.ID, delivery.TenantID, delivery.AccountID, delivery.Email, delivery.PeriodStart, delivery.PeriodEnd,
+		delivery.Status, delivery.NextAttemptAt, delivery.CreatedAt, delivery.Locale,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule statement delivery: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		"UPDATE statement_preferences SET next_run_at = $1 WHERE account_id = $2 AND tenant_id = $3",
+		nextRunAt, delivery.AccountID, tenantID,
+	); err != nil {
+		return fmt.Errorf("failed to advance statement schedule: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+const statementDeliveryColumns = "id, tenant_id, account_id, email, period_start, period_end, status, attempts, last_error, next_attempt_at, sent_at, created_at, locale, document_key"
+
+func (p *Postgres) queryStatementDeliveries(ctx context.Context, query string, args ...interface{}) ([]*models.StatementDelivery, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statement deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*models.StatementDelivery{}
+	for rows.Next() {
+		var d models.StatementDelivery
+		var sentAt sql.NullTime
+		if err := rows.Scan(
+			&d.ID, &d.TenantID, &d.AccountID, &d.Email, &d.PeriodStart, &d.PeriodEnd, &d.Status,
+			&d.Attempts, &d.LastError, &d.NextAttemptAt, &sentAt, &d.CreatedAt, &d.Locale, &d.DocumentKey,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan statement delivery: %w", err)
+		}
+		if sentAt.Valid {
+			d.SentAt = &sentAt.Time
+		}
+		d.Archived = d.DocumentKey != ""
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// retrieves an account's statement deliveries, newest first
+func (p *Postgres) GetStatementDeliveries(ctx context.Context, accountID string, limit, offset int) ([]*models.StatementDelivery, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryStatementDeliveries(ctx,
+		"SELECT "+statementDeliveryColumns+" FROM statement_deliveries WHERE account_id = $1 AND tenant_id = $2 ORDER BY period_start DESC LIMIT $3 OFFSET $4",
+		accountID, tenantID, limit, offset,
+	)
+}
+
+// retrieves one of an account's statement deliveries, nil when it has none with the ID
+func (p *Postgres) GetStatementDelivery(ctx context.Context, accountID, id string) (*models.StatementDelivery, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := p.queryStatementDeliveries(ctx,
+		"SELECT "+statementDeliveryColumns+" FROM statement_deliveries WHERE id = $1 AND account_id = $2 AND tenant_id = $3",
+		id, accountID, tenantID,
+	)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return deliveries[0], nil
+}
+
+// counts an account's statement deliveries
+func (p *Postgres) CountStatementDeliveries(ctx context.Context, accountID string) (models.Count, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return models.Count{}, err
+	}
+
+	var count models.Count
+	err = p.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM statement_deliveries WHERE account_id = $1 AND tenant_id = $2",
+		accountID, tenantID,
+	).Scan(&count.Total)
+	if err != nil {
+		return models.Count{}, fmt.Errorf("failed to count statement deliveries: %w", err)
+	}
+
+	return count, nil
+}
+
+// retrieves pending deliveries ready for an attempt, across all tenants or only tenantID when set, for the scheduler;
+// callers must scope further work to each delivery's TenantID
+func (p *Postgres) GetReadyStatementDeliveries(ctx context.Context, tenantID string, now time.Time, limit int) ([]*models.StatementDelivery, error) {
+	return p.queryStatementDeliveries(ctx,
+		"SELECT "+statementDeliveryColumns+" FROM statement_deliveries WHERE status = $1 AND next_attempt_at <= $2 AND ($4 = '' OR tenant_id = $4) ORDER BY next_attempt_at LIMIT $3",
+		models.DeliveryPending, now, limit, tenantID,
+	)
+}
+
+// records the outcome of a delivery attempt
+func (p *Postgres) UpdateStatementDelivery(ctx context.Context, delivery *models.StatementDelivery) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+	UPDATE statement_deliveries
+	SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4, sent_at = $5, updated_at = $6, document_key = $9
+	WHERE id = $7 AND tenant_id = $8`,
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.NextAttemptAt, delivery.SentAt, p.clock.Now(ctx),
+		delivery.ID, tenantID, delivery.DocumentKey,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update statement delivery: %w", err)
+	}
+
+	return nil
+}
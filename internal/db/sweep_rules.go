@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const sweepRuleColumns = "id, tenant_id, account_id, target_account_id, target_balance, floor_balance, enabled, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSweepRule(row rowScanner) (*models.SweepRule, error) {
+	var rule models.SweepRule
+	var floor sql.NullFloat64
+	if err := row.Scan(
+		&rule.ID, &rule.TenantID, &rule.AccountID, &rule.TargetAccountID, &rule.TargetBalance,
+		&floor, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if floor.Valid {
+		rule.FloorBalance = &floor.Float64
+	}
+	return &rule, nil
+}
+
+// creates a new sweep rule
+func (p *Postgres) CreateSweepRule(ctx context.Context, rule *models.SweepRule) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	rule.ID = p.ids.NewID()
+	rule.TenantID = tenantID
+	now := p.clock.Now(ctx)
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	rule.Enabled = true
+
+	query := `
+	INSERT INTO sweep_rules (` + sweepRuleColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		rule.ID, rule.TenantID, rule.AccountID, rule.TargetAccountID, rule.TargetBalance,
+		rule.FloorBalance, rule.Enabled, rule.CreatedAt, rule.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create sweep rule: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves the sweep rules configured on an account
+func (p *Postgres) GetSweepRulesByAccountID(ctx context.Context, accountID string) ([]*models.SweepRule, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.querySweepRules(ctx, "SELECT "+sweepRuleColumns+" FROM sweep_rules WHERE account_id = $1 AND tenant_id = $2 ORDER BY created_at", accountID, tenantID)
+}
+
+// retrieves every enabled sweep rule across all tenants, for the scheduler;
+// callers must scope further work to each rule's TenantID
+func (p *Postgres) GetEnabledSweepRules(ctx context.Context) ([]*models.SweepRule, error) {
+	return p.querySweepRules(ctx, "SELECT "+sweepRuleColumns+" FROM sweep_rules WHERE enabled ORDER BY created_at")
+}
+
+func (p *Postgres) querySweepRules(ctx context.Context, query string, args ...interface{}) ([]*models.SweepRule, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sweep rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*models.SweepRule{}
+	for rows.Next() {
+		rule, err := scanSweepRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sweep rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// deletes a sweep rule
+func (p *Postgres) DeleteSweepRule(ctx context.Context, id string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, "DELETE FROM sweep_rules WHERE id = $1 AND tenant_id = $2", id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sweep rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSweepRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// postContra moves amount into the tenant's contra account of the given kind and currency, creating it on first
+// use; a negative amount is taken out. Must run inside the transaction that posts the other side, after it has
+// locked the customer accounts, so the contra row is always locked last
+func (p *Postgres) postContra(ctx context.Context, tx *sql.Tx, tenantID string, kind models.AccountKind, currency string, amount float64, now time.Time) error {
+	if amount == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO accounts (id, tenant_id, kind, currency, balance, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, 0, $5, $5)
+	ON CONFLICT (tenant_id, kind, currency) WHERE kind <> 'customer' DO NOTHING`,
+		p.ids.NewID(), tenantID, kind, currency, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create %s account: %w", kind, err)
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx,
+		"UPDATE accounts SET balance = balance + $1, updated_at = $2 WHERE tenant_id = $3 AND kind = $4 AND currency = $5 RETURNING id",
+		amount, now, tenantID, kind, currency,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s account: %w", kind, err)
+	}
+
+	credited, debited := amount, 0.0
+	if amount < 0 {
+		credited, debited = 0, -amount
+	}
+	return recordActivity(ctx, tx, tenantID, id, credited, debited, now)
+}
+
+// lists the tenant's system accounts, by kind and currency
+func (p *Postgres) GetSystemAccounts(ctx context.Context) ([]*models.Account, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader(ctx).QueryContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE tenant_id = $1 AND kind <> $2 ORDER BY kind, currency",
+		tenantID, models.CustomerAccount,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query system accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []*models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrTemplateNotFound is returned when the tenant has no transaction template with the given ID
+var ErrTemplateNotFound = i18n.NewError("error.template_not_found", "transaction template not found")
+
+const templateColumns = "id, tenant_id, account_id, name, type, amount, memo, category, counterparty_account_id, counterparty_id, created_at"
+
+func scanTemplate(row rowScanner) (*models.TransactionTemplate, error) {
+	var t models.TransactionTemplate
+	if err := row.Scan(
+		&t.ID, &t.TenantID, &t.AccountID, &t.Name, &t.Type, &t.Amount, &t.Memo, &t.Category,
+		&t.CounterpartyAccountID, &t.CounterpartyID, &t.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// creates a new transaction template
+func (p *Postgres) CreateTemplate(ctx context.Context, t *models.TransactionTemplate) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.ID = p.ids.NewID()
+	t.TenantID = tenantID
+	t.CreatedAt = p.clock.Now(ctx)
+
+	query := `
+	INSERT INTO transaction_templates (` + templateColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		t.ID, t.TenantID, t.AccountID, t.Name, t.Type, t.Amount, t.Memo, t.Category,
+		t.CounterpartyAccountID, t.CounterpartyID, t.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction template: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves a transaction template by ID
+func (p *Postgres) GetTemplate(ctx context.Context, id string) (*models.TransactionTemplate, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := scanTemplate(p.db.QueryRowContext(ctx,
+		"SELECT "+templateColumns+" FROM transaction_templates WHERE id = $1 AND tenant_id = $2", id, tenantID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to get transaction template: %w", err)
+	}
+
+	return t, nil
+}
+
+// lists an account's transaction templates by name
+func (p *Postgres) GetTemplatesByAccountID(ctx context.Context, accountID string) ([]*models.TransactionTemplate, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader(ctx).QueryContext(ctx,
+		"SELECT "+templateColumns+" FROM transaction_templates WHERE account_id = $1 AND tenant_id = $2 ORDER BY name, id",
+		accountID, tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []*models.TransactionTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction template: %w", err)
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// deletes a transaction template
+func (p *Postgres) DeleteTemplate(ctx context.Context, id string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, "DELETE FROM transaction_templates WHERE id = $1 AND tenant_id = $2", id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete transaction template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
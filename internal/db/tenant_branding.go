@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// retrieves a tenant's branding, nil when the tenant has none stored
+// takes the tenant explicitly because it is read by admin routes as well as tenant-scoped ones
+func (p *Postgres) GetTenantBranding(ctx context.Context, tenantID string) (*models.TenantBranding, error) {
+	query := `
+	SELECT tenant_id, name, logo_url, color, footer, statement_template, receipt_template, updated_at
+	FROM tenant_branding
+	WHERE tenant_id = $1`
+
+	var b models.TenantBranding
+	err := p.db.QueryRowContext(ctx, query, tenantID).Scan(
+		&b.TenantID, &b.Name, &b.LogoURL, &b.Color, &b.Footer, &b.StatementTemplate, &b.ReceiptTemplate, &b.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tenant branding: %w", err)
+	}
+
+	return &b, nil
+}
+
+// creates or replaces a tenant's branding
+func (p *Postgres) UpsertTenantBranding(ctx context.Context, b *models.TenantBranding) error {
+	b.UpdatedAt = p.clock.Now(ctx)
+
+	query := `
+	INSERT INTO tenant_branding (tenant_id, name, logo_url, color, footer, statement_template, receipt_template, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (tenant_id) DO UPDATE SET
+		name = EXCLUDED.name,
+		logo_url = EXCLUDED.logo_url,
+		color = EXCLUDED.color,
+		footer = EXCLUDED.footer,
+		statement_template = EXCLUDED.statement_template,
+		receipt_template = EXCLUDED.receipt_template,
+		updated_at = EXCLUDED.updated_at`
+
+	_, err := p.db.ExecContext(ctx, query,
+		b.TenantID, b.Name, b.LogoURL, b.Color, b.Footer, b.StatementTemplate, b.ReceiptTemplate, b.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant branding: %w", err)
+	}
+
+	return nil
+}
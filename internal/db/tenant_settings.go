@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// retrieves a tenant's settings, nil when the tenant has none stored
+// takes the tenant explicitly because it is read by admin routes as well as tenant-scoped ones
+func (p *Postgres) GetTenantSettings(ctx context.Context, tenantID string) (*models.TenantSettings, error) {
+	query := `
+	SELECT tenant_id, allowed_currencies, max_transaction_amount, max_daily_amount, fees, webhook_endpoints, kyc_required,
+		value_date_cutoff, timezone, ip_allowlist, insufficient_funds, updated_at
+	FROM tenant_settings
+	WHERE tenant_id = $1`
+
+	var settings models.TenantSettings
+	var fees, insufficientFunds []byte
+	var kycRequired []string
+	err := p.db.QueryRowContext(ctx, query, tenantID).Scan(
+		&settings.TenantID, pq.Array(&settings.AllowedCurrencies), &settings.MaxTransactionAmount,
+		&settings.MaxDailyAmount, &fees, pq.Array(&settings.WebhookEndpoints), pq.Array(&kycRequired),
+		&settings.ValueDateCutoff, &settings.Timezone, pq.Array(&settings.IPAllowlist), &insufficientFunds, &settings.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tenant settings: %w", err)
+	}
+
+	if err := json.Unmarshal(fees, &settings.Fees); err != nil {
+		return nil, fmt.Errorf("failed to decode fee schedule: %w", err)
+	}
+	if err := json.Unmarshal(insufficientFunds, &settings.InsufficientFunds); err != nil {
+		return nil, fmt.Errorf("failed to decode insufficient funds policy: %w", err)
+	}
+	if settings.InsufficientFunds.Mode == "" {
+		settings.InsufficientFunds.Mode = models.FailOnInsufficientFunds
+	}
+	settings.KYCRequired = make([]models.TransactionType, 0, len(kycRequired))
+	for _, t := range kycRequired {
+		settings.KYCRequired = append(settings.KYCRequired, models.TransactionType(t))
+	}
+
+	return &settings, nil
+}
+
+// creates or replaces a tenant's settings; with IfVersion in ctx, existing settings are only replaced while unchanged
+func (p *Postgres) UpsertTenantSettings(ctx context.Context, settings *models.TenantSettings) error {
+	fees, err := json.Marshal(settings.Fees)
+	if err != nil {
+		return fmt.Errorf("failed to encode fee schedule: %w", err)
+	}
+	insufficientFunds, err := json.Marshal(settings.InsufficientFunds)
+	if err != nil {
+		return fmt.Errorf("failed to encode insufficient funds policy: %w", err)
+	}
+	kycRequired := make([]string, 0, len(settings.KYCRequired))
+	for _, t := range settings.KYCRequired {
+		kycRequired = append(kycRequired, string(t))
+	}
+	// the column keeps microseconds, so the version returned matches the one read back later
+	settings.UpdatedAt = p.clock.Now(ctx).Truncate(time.Microsecond)
+
+	query := `
+	INSERT INTO tenant_settings (tenant_id, allowed_currencies, max_transaction_amount, max_daily_amount, fees, webhook_endpoints, kyc_required,
+		value_date_cutoff, timezone, ip_allowlist, insufficient_funds, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	ON CONFLICT (tenant_id) DO UPDATE SET
+		allowed_currencies = EXCLUDED.allowed_currencies,
+		max_transaction_amount = EXCLUDED.max_transaction_amount,
+		max_daily_amount = EXCLUDED.max_daily_amount,
+		fees = EXCLUDED.fees,
+		webhook_endpoints = EXCLUDED.webhook_endpoints,
+		kyc_required = EXCLUDED.kyc_required,
+		value_date_cutoff = EXCLUDED.value_date_cutoff,
+		timezone = EXCLUDED.timezone,
+		ip_allowlist = EXCLUDED.ip_allowlist,
+		insufficient_funds = EXCLUDED.insufficient_funds,
+		updated_at = EXCLUDED.updated_at`
+	args := []interface{}{
+		settings.TenantID, pq.Array(settings.AllowedCurrencies), settings.MaxTransactionAmount,
+		settings.MaxDailyAmount, fees, pq.Array(settings.WebhookEndpoints), pq.Array(kycRequired),
+		settings.ValueDateCutoff, settings.Timezone, pq.Array(settings.IPAllowlist), insufficientFunds, settings.UpdatedAt,
+	}
+	// a tenant without stored settings has nothing to overwrite, so only a replacement is conditional
+	version, conditional := expectedVersion(ctx)
+	if conditional {
+		query += " WHERE tenant_settings.updated_at = $13"
+		args = append(args, version)
+	}
+
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant settings: %w", err)
+	}
+	if n, _ := res.RowsAffected(); conditional && n == 0 {
+		return ErrModified
+	}
+
+	return nil
+}
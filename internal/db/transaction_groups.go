@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// creates the legs of a transaction group with the same creation time, so they list together in history
+func (m *MongoDB) CreateTransactions(ctx context.Context, txs []*models.Transaction) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := m.clock.Now(ctx)
+	documents := make([]interface{}, 0, len(txs))
+	for _, tx := range txs {
+		tx.TenantID = tenantID
+		if tx.ID == "" {
+			tx.ID = m.ids.NewID()
+		}
+		tx.CreatedAt = now
+		tx.UpdatedAt = now
+		documents = append(documents, tx)
+	}
+
+	if _, err := m.collection.InsertMany(ctx, documents); err != nil {
+		return fmt.Errorf("failed to insert transactions: %w", err)
+	}
+
+	return nil
+}
+
+// retrieves the legs of a transaction group in order; empty when the tenant has no such group
+func (m *MongoDB) GetTransactionsByGroup(ctx context.Context, groupID string) ([]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"group_id": groupID})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "leg", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transaction group: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// retrieves the tenant's transactions among ids, keyed by id; ids the tenant has no transaction for are left out
+func (m *MongoDB) GetTransactionsByIDs(ctx context.Context, ids []string) (map[string]*models.Transaction, error) {
+	filter, err := scoped(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := m.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []*models.Transaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	byID := make(map[string]*models.Transaction, len(txs))
+	for _, tx := range txs {
+		byID[tx.ID] = tx
+	}
+	return byID, nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// searchFilter builds the query for a transaction search; an empty TenantID covers the whole platform
+func searchFilter(search *models.TransactionSearch) bson.M {
+	filter := platformFilter(search.TenantID, bson.M{})
+	if search.AccountID != "" {
+		filter["$or"] = bson.A{
+			bson.M{"account_id": search.AccountID},
+			bson.M{"counterparty_account_id": search.AccountID},
+		}
+	}
+	if search.CounterpartyID != "" {
+		filter["counterparty_id"] = search.CounterpartyID
+	}
+	if len(search.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": search.Statuses}
+	}
+	if len(search.Types) > 0 {
+		filter["type"] = bson.M{"$in": search.Types}
+	}
+
+	amount := bson.M{}
+	if search.MinAmount != nil {
+		amount["$gte"] = *search.MinAmount
+	}
+	if search.MaxAmount != nil {
+		amount["$lte"] = *search.MaxAmount
+	}
+	if len(amount) > 0 {
+		filter["amount"] = amount
+	}
+
+	created := bson.M{}
+	if search.From != nil {
+		created["$gte"] = *search.From
+	}
+	if search.To != nil {
+		created["$lt"] = *search.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	if search.BackDated {
+		filter["back_dated"] = true
+	}
+
+	// an anchored, case-sensitive prefix can use the reference indexes
+	if search.ReferencePrefix != "" {
+		filter["reference"] = bson.M{"$regex": "^" + regexp.QuoteMeta(search.ReferencePrefix)}
+	}
+	return filter
+}
+
+// finds transactions matching a search across accounts, newest first, for support investigations
+// not tenant scoped: an empty search.TenantID covers the whole platform
+func (m *MongoDB) SearchTransactions(ctx context.Context, search *models.TransactionSearch, limit, offset int) ([]*models.Transaction, error) {
+	options := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := m.collection.Find(ctx, searchFilter(search), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []*models.Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// counts transactions matching a search
+func (m *MongoDB) CountSearchTransactions(ctx context.Context, search *models.TransactionSearch) (models.Count, error) {
+	return m.countCapped(ctx, searchFilter(search))
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// stores a new webhook secret for a tenant and limits every secret that is still active
+// to the grace period, so deliveries are signed with both until the old ones lapse
+// takes the tenant explicitly because secrets are managed through admin routes
+func (p *Postgres) RotateWebhookSecret(ctx context.Context, secret *models.WebhookSecret, grace time.Duration) (err error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := p.clock.Now(ctx)
+	graceEnd := now.Add(grace)
+	if _, err = tx.ExecContext(ctx,
+		"UPDATE webhook_secrets SET expires_at = $1 WHERE tenant_id = $2 AND (expires_at IS NULL OR expires_at > $1)",
+		graceEnd, secret.TenantID,
+	); err != nil {
+		return fmt.Errorf("failed to expire webhook secrets: %w", err)
+	}
+
+	secret.ID = p.ids.NewID()
+	secret.CreatedAt = now
+	if _, err = tx.ExecContext(ctx,
+		"INSERT INTO webhook_secrets (id, tenant_id, secret, created_at) VALUES ($1, $2, $3, $4)",
+		secret.ID, secret.TenantID, secret.Secret, secret.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create webhook secret: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// retrieves a tenant's unexpired webhook secrets without their values, newest first
+func (p *Postgres) GetWebhookSecrets(ctx context.Context, tenantID string) ([]*models.WebhookSecret, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT id, tenant_id, created_at, expires_at FROM webhook_secrets WHERE tenant_id = $1 AND (expires_at IS NULL OR expires_at > $2) ORDER BY created_at DESC",
+		tenantID, p.clock.Now(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := []*models.WebhookSecret{}
+	for rows.Next() {
+		var s models.WebhookSecret
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.TenantID, &s.CreatedAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook secret: %w", err)
+		}
+		if expiresAt.Valid {
+			s.ExpiresAt = &expiresAt.Time
+		}
+		secrets = append(secrets, &s)
+	}
+
+	return secrets, rows.Err()
+}
+
+// retrieves the values of the scoped tenant's unexpired webhook secrets, newest first
+func (p *Postgres) GetActiveWebhookSecretValues(ctx context.Context) ([]string, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT secret FROM webhook_secrets WHERE tenant_id = $1 AND (expires_at IS NULL OR expires_at > $2) ORDER BY created_at DESC",
+		tenantID, p.clock.Now(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []string
+	for rows.Next() {
+		var secret string
+		if err := rows.Scan(&secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook secret: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, rows.Err()
+}
+
+// immediately stops a webhook secret from signing deliveries
+func (p *Postgres) RevokeWebhookSecret(ctx context.Context, tenantID, id string) error {
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE webhook_secrets SET expires_at = $1 WHERE id = $2 AND tenant_id = $3 AND (expires_at IS NULL OR expires_at > $1)",
+		p.clock.Now(ctx), id, tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke webhook secret: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("webhook secret not found")
+	}
+
+	return nil
+}
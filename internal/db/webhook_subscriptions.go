@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrWebhookSubscriptionNotFound is returned when the tenant has no webhook subscription with the given ID
+var ErrWebhookSubscriptionNotFound = i18n.NewError("error.webhook_subscription_not_found", "webhook subscription not found")
+
+const webhookSubscriptionColumns = "id, tenant_id, account_id, url, event_types, created_at"
+
+// creates a new webhook subscription
+func (p *Postgres) CreateWebhookSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	sub.ID = p.ids.NewID()
+	sub.TenantID = tenantID
+	sub.CreatedAt = p.clock.Now(ctx)
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+
+	query := `
+	INSERT INTO webhook_subscriptions (` + webhookSubscriptionColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err = p.db.ExecContext(ctx, query,
+		sub.ID, sub.TenantID, sub.AccountID, sub.URL, pq.Array(sub.EventTypes), sub.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// lists the tenant's webhook subscriptions, oldest first; a non-empty accountID lists only that account's
+func (p *Postgres) GetWebhookSubscriptions(ctx context.Context, accountID string) ([]*models.WebhookSubscription, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryWebhookSubscriptions(ctx,
+		"SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE tenant_id = $1 AND ($2 = '' OR account_id = $2) ORDER BY created_at, id",
+		tenantID, accountID,
+	)
+}
+
+// retrieves the subscriptions an account's events go to: the tenant-wide ones and the account's own
+func (p *Postgres) GetWebhookSubscriptionsForAccount(ctx context.Context, accountID string) ([]*models.WebhookSubscription, error) {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryWebhookSubscriptions(ctx,
+		"SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE tenant_id = $1 AND (account_id = '' OR account_id = $2) ORDER BY created_at, id",
+		tenantID, accountID,
+	)
+}
+
+func (p *Postgres) queryWebhookSubscriptions(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookSubscription, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []*models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.TenantID, &sub.AccountID, &sub.URL, pq.Array(&sub.EventTypes), &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		if sub.EventTypes == nil {
+			sub.EventTypes = []string{}
+		}
+		subs = append(subs, &sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// deletes a webhook subscription
+func (p *Postgres) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	tenantID, err := tenantFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2", id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
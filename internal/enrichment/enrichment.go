@@ -0,0 +1,76 @@
+package enrichment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// Provider annotates a transaction with merchant, category and location data
+// a nil result with a nil error means the provider had nothing to add
+type Provider interface {
+	Enrich(ctx context.Context, tx *models.Transaction) (*models.Enrichment, error)
+}
+
+// ProviderFunc adapts an in-process function to the Provider interface
+type ProviderFunc func(ctx context.Context, tx *models.Transaction) (*models.Enrichment, error)
+
+// Enrich calls f(ctx, tx)
+func (f ProviderFunc) Enrich(ctx context.Context, tx *models.Transaction) (*models.Enrichment, error) {
+	return f(ctx, tx)
+}
+
+// HTTPProvider posts the transaction to an external enrichment endpoint
+// and expects an Enrichment JSON document back
+type HTTPProvider struct {
+	url    string
+	client *http.Client
+}
+
+// creates a new HTTPProvider with a bounded per-call timeout so slow
+// enrichment can never hold up balance processing for long
+func NewHTTPProvider(url string, timeout time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Enrich sends the transaction to the provider
+func (p *HTTPProvider) Enrich(ctx context.Context, tx *models.Transaction) (*models.Enrichment, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build enrichment request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call enrichment provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrichment provider returned status %d", resp.StatusCode)
+	}
+
+	var result models.Enrichment
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode enrichment response: %w", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,297 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is the JSON type of a payload field
+type Kind string
+
+const (
+	String  Kind = "string"
+	Number  Kind = "number"
+	Boolean Kind = "boolean"
+	Object  Kind = "object"
+	Array   Kind = "array"
+)
+
+// Schema is one published version of an event
+// Fields is frozen once the version ships: adding, removing or retyping a field needs a new version
+type Schema struct {
+	Type        Type            `json:"type"`
+	Version     int             `json:"version"`
+	Description string          `json:"description"`
+	Fields      map[string]Kind `json:"fields"`
+
+	payload reflect.Type
+}
+
+var notificationV1Fields = map[string]Kind{
+	"account_id":     String,
+	"transaction_id": String,
+	"subject":        String,
+	"message":        String,
+}
+
+// catalog lists every event version the service emits or accepts; entries are never removed
+var catalog = []Schema{
+	{
+		Type:        TransactionCreated,
+		Version:     1,
+		Description: "Transaction queued for processing; body of the transactions queue message",
+		Fields: map[string]Kind{
+			"id":                      String,
+			"tenant_id":               String,
+			"account_id":              String,
+			"type":                    String,
+			"amount":                  Number,
+			"fee":                     Number,
+			"status":                  String,
+			"reference":               String,
+			"counterparty_account_id": String,
+			"request_id":              String,
+			"created_at":              String,
+			"updated_at":              String,
+		},
+		payload: reflect.TypeOf(TransactionCreatedV2{}),
+	},
+	{
+		Type:        TransactionCreated,
+		Version:     2,
+		Description: "Transaction queued for processing, with its counterparty and metadata; body of the transactions queue message",
+		Fields: map[string]Kind{
+			"id":                      String,
+			"tenant_id":               String,
+			"account_id":              String,
+			"type":                    String,
+			"amount":                  Number,
+			"fee":                     Number,
+			"status":                  String,
+			"reference":               String,
+			"counterparty_account_id": String,
+			"counterparty_id":         String,
+			"metadata":                Object,
+			"request_id":              String,
+			"created_at":              String,
+			"updated_at":              String,
+		},
+		payload: reflect.TypeOf(TransactionCreatedV2{}),
+	},
+	{
+		Type:        TransactionCompleted,
+		Version:     1,
+		Description: "Transaction applied to the account balance",
+		Fields: map[string]Kind{
+			"id":                      String,
+			"account_id":              String,
+			"type":                    String,
+			"amount":                  Number,
+			"fee":                     Number,
+			"currency":                String,
+			"status":                  String,
+			"reference":               String,
+			"counterparty_account_id": String,
+			"balance_after":           Number,
+			"created_at":              String,
+			"completed_at":            String,
+		},
+		payload: reflect.TypeOf(TransactionV1{}),
+	},
+	{
+		Type:        TransactionCompleted,
+		Version:     2,
+		Description: "Transaction applied to the account balance, with its counterparty and metadata",
+		Fields: map[string]Kind{
+			"id":                      String,
+			"account_id":              String,
+			"type":                    String,
+			"amount":                  Number,
+			"fee":                     Number,
+			"currency":                String,
+			"status":                  String,
+			"reference":               String,
+			"counterparty_account_id": String,
+			"counterparty_id":         String,
+			"metadata":                Object,
+			"balance_after":           Number,
+			"created_at":              String,
+			"completed_at":            String,
+		},
+		payload: reflect.TypeOf(TransactionV2{}),
+	},
+	{
+		Type:        TransactionFailed,
+		Version:     1,
+		Description: "Transaction could not be processed; webhook notification",
+		Fields:      notificationV1Fields,
+		payload:     reflect.TypeOf(NotificationV1{}),
+	},
+	{
+		Type:        TransactionLargeWithdrawal,
+		Version:     1,
+		Description: "Completed withdrawal at or above the account's threshold; webhook notification",
+		Fields:      notificationV1Fields,
+		payload:     reflect.TypeOf(NotificationV1{}),
+	},
+	{
+		Type:        AccountLowBalance,
+		Version:     1,
+		Description: "Balance dropped below the account's threshold; webhook notification",
+		Fields:      notificationV1Fields,
+		payload:     reflect.TypeOf(NotificationV1{}),
+	},
+	{
+		Type:        StatementReady,
+		Version:     1,
+		Description: "Periodic statement issued",
+		Fields:      notificationV1Fields,
+		payload:     reflect.TypeOf(NotificationV1{}),
+	},
+	{
+		Type:        AccountBalanceUpdated,
+		Version:     1,
+		Description: "Account balance moved by a completed transaction; published on the balance pub/sub channel",
+		Fields: map[string]Kind{
+			"account_id":     String,
+			"transaction_id": String,
+			"currency":       String,
+			"balance":        Number,
+			"change":         Number,
+			"updated_at":     String,
+		},
+		payload: reflect.TypeOf(BalanceV1{}),
+	},
+}
+
+// Catalog returns every published event version, ordered by type then version
+func Catalog() []Schema {
+	out := append([]Schema(nil), catalog...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
+
+// Lookup returns a specific version of an event type
+func Lookup(t Type, version int) (Schema, bool) {
+	for _, s := range catalog {
+		if s.Type == t && s.Version == version {
+			return s, true
+		}
+	}
+	return Schema{}, false
+}
+
+// Latest returns the newest version of an event type
+func Latest(t Type) (Schema, bool) {
+	var latest Schema
+	found := false
+	for _, s := range catalog {
+		if s.Type == t && (!found || s.Version > latest.Version) {
+			latest, found = s, true
+		}
+	}
+	return latest, found
+}
+
+// CheckCompatibility verifies that every payload type still serialises all the fields its published
+// schemas promise, with the same JSON types, and that versions of a type are numbered without gaps
+// the service refuses to start when it fails, so a breaking payload change can't ship unnoticed
+func CheckCompatibility() error {
+	var problems []string
+	versions := map[Type][]int{}
+
+	for _, s := range catalog {
+		versions[s.Type] = append(versions[s.Type], s.Version)
+
+		actual := jsonFields(s.payload)
+		for name, kind := range s.Fields {
+			got, ok := actual[name]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s v%d: field %q was removed", s.Type, s.Version, name))
+			case got != kind:
+				problems = append(problems, fmt.Sprintf("%s v%d: field %q changed from %s to %s", s.Type, s.Version, name, kind, got))
+			}
+		}
+	}
+
+	for t, vs := range versions {
+		sort.Ints(vs)
+		for i, v := range vs {
+			if v != i+1 {
+				problems = append(problems, fmt.Sprintf("%s: versions must run 1..n, found %v", t, vs))
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("incompatible event schemas: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonFields maps the JSON names of a struct's exported fields to their JSON kinds
+func jsonFields(t reflect.Type) map[string]Kind {
+	fields := map[string]Kind{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		fields[name] = kindOf(f.Type)
+	}
+	return fields
+}
+
+func kindOf(t reflect.Type) Kind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return String
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return String
+	case reflect.Bool:
+		return Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return Number
+	case reflect.Slice, reflect.Array:
+		return Array
+	default:
+		return Object
+	}
+}
+
+// payloadType is the struct type New compares against a schema's payload
+func payloadType(data interface{}) reflect.Type {
+	t := reflect.TypeOf(data)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
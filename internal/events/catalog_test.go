@@ -0,0 +1,84 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// testdata holds the schema of every published event version as it shipped; a fixture is only ever added
+func goldenSchemas(t *testing.T) map[string]Schema {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := map[string]Schema{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s Schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		golden[fmt.Sprintf("%s.v%d", s.Type, s.Version)] = s
+	}
+	return golden
+}
+
+func TestCatalogKeepsGoldenSchemas(t *testing.T) {
+	for key, want := range goldenSchemas(t) {
+		got, ok := Lookup(want.Type, want.Version)
+		if !ok {
+			t.Errorf("%s was published but is no longer in the catalog", key)
+			continue
+		}
+		for name, kind := range want.Fields {
+			gotKind, ok := got.Fields[name]
+			switch {
+			case !ok:
+				t.Errorf("%s: field %q was removed", key, name)
+			case gotKind != kind:
+				t.Errorf("%s: field %q changed from %s to %s", key, name, kind, gotKind)
+			}
+		}
+	}
+}
+
+func TestCatalogVersionsHaveGoldenSchemas(t *testing.T) {
+	golden := goldenSchemas(t)
+	for _, s := range Catalog() {
+		key := fmt.Sprintf("%s.v%d", s.Type, s.Version)
+		if _, ok := golden[key]; !ok {
+			t.Errorf("%s has no fixture; add testdata/%s.json when publishing it", key, key)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	if err := CheckCompatibility(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// every field the queue needs must be carried by the payload, or a consumed transaction silently loses it
+func TestTransactionCreatedV2CarriesTransaction(t *testing.T) {
+	payload := jsonFields(reflect.TypeOf(TransactionCreatedV2{}))
+	for name, kind := range jsonFields(reflect.TypeOf(models.Transaction{})) {
+		got, ok := payload[name]
+		switch {
+		case !ok:
+			t.Errorf("models.Transaction field %q is missing from TransactionCreatedV2", name)
+		case got != kind:
+			t.Errorf("models.Transaction field %q is %s, TransactionCreatedV2 has %s", name, kind, got)
+		}
+	}
+}
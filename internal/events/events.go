@@ -0,0 +1,328 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/google/uuid"
+)
+
+// Type names an event in the catalog
+type Type string
+
+const (
+	// TransactionCreated is a transaction accepted by the API and queued for processing
+	TransactionCreated Type = "transaction.created"
+
+	// TransactionCompleted is a transaction applied to the balance
+	TransactionCompleted Type = "transaction.completed"
+
+	// TransactionFailed is a transaction that could not be applied
+	TransactionFailed Type = "transaction.failed"
+
+	// TransactionLargeWithdrawal is a completed withdrawal at or above the account's threshold
+	TransactionLargeWithdrawal Type = "transaction.large_withdrawal"
+
+	// AccountLowBalance is a balance that dropped below the account's threshold
+	AccountLowBalance Type = "account.low_balance"
+
+	// StatementReady is a periodic statement that has been issued
+	StatementReady Type = "statement.ready"
+
+	// AccountBalanceUpdated is an account balance moved by a completed transaction
+	AccountBalanceUpdated Type = "account.balance_updated"
+)
+
+// Envelope wraps every event delivered outside the service
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       Type            `json:"type"`
+	Version    int             `json:"version"`
+	TenantID   string          `json:"tenant_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// New wraps data as the latest version of an event type
+// data must be that version's payload type
+func New(t Type, id, tenantID string, occurredAt time.Time, data interface{}) (*Envelope, error) {
+	schema, ok := Latest(t)
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %s", t)
+	}
+	if got := payloadType(data); got != schema.payload {
+		return nil, fmt.Errorf("%s v%d expects %s, got %s", t, schema.Version, schema.payload, got)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", t, err)
+	}
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	return &Envelope{
+		ID:         id,
+		Type:       t,
+		Version:    schema.Version,
+		TenantID:   tenantID,
+		OccurredAt: occurredAt.UTC(),
+		Data:       raw,
+	}, nil
+}
+
+// TransactionCreatedV2 is the payload of transaction.created v2, the body of the transactions queue message
+// it is declared here rather than reusing models.Transaction so the wire shape only changes on purpose;
+// v1 messages still in the queue decode into it too, as v2 only adds fields
+type TransactionCreatedV2 struct {
+	ID                    string                  `json:"id"`
+	TenantID              string                  `json:"tenant_id,omitempty"`
+	AccountID             string                  `json:"account_id"`
+	Type                  string                  `json:"type"`
+	Amount                float64                 `json:"amount"`
+	Fee                   float64                 `json:"fee,omitempty"`
+	Status                string                  `json:"status"`
+	FailureReason         string                  `json:"failure_reason,omitempty"`
+	Reference             string                  `json:"reference"`
+	ReferenceNamespace    string                  `json:"reference_namespace,omitempty"`
+	CounterpartyAccountID string                  `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string                  `json:"counterparty_id,omitempty"`
+	Metadata              map[string]string       `json:"metadata,omitempty"`
+	DuplicateOf           string                  `json:"duplicate_of,omitempty"`
+	CreditExpiresAt       *time.Time              `json:"credit_expires_at,omitempty"`
+	ValueDate             *time.Time              `json:"value_date,omitempty"`
+	BackDated             bool                    `json:"back_dated,omitempty"`
+	QuoteID               string                  `json:"quote_id,omitempty"`
+	GroupID               string                  `json:"group_id,omitempty"`
+	Leg                   int                     `json:"leg,omitempty"`
+	LegRole               string                  `json:"leg_role,omitempty"`
+	RelatedLeg            int                     `json:"related_leg,omitempty"`
+	BalanceBefore         float64                 `json:"balance_before,omitempty"`
+	BalanceAfter          float64                 `json:"balance_after,omitempty"`
+	Enrichment            *models.Enrichment      `json:"enrichment,omitempty"`
+	Screening             *models.ScreeningResult `json:"screening,omitempty"`
+	ProcessingStartedAt   *time.Time              `json:"processing_started_at,omitempty"`
+	RequestID             string                  `json:"request_id,omitempty"`
+	CreatedAt             time.Time               `json:"created_at"`
+	UpdatedAt             time.Time               `json:"updated_at"`
+	CompletedAt           *time.Time              `json:"completed_at,omitempty"`
+	Attempts              int                     `json:"attempts,omitempty"`
+	LastError             string                  `json:"last_error,omitempty"`
+	LastAttemptAt         *time.Time              `json:"last_attempt_at,omitempty"`
+	NextRetryAt           *time.Time              `json:"next_retry_at,omitempty"`
+	FundingMode           string                  `json:"funding_mode,omitempty"`
+	FundingDeadline       *time.Time              `json:"funding_deadline,omitempty"`
+	RetryOnFunding        bool                    `json:"retry_on_funding,omitempty"`
+}
+
+// NewTransactionCreatedV2 converts a queued transaction to its v2 event payload
+func NewTransactionCreatedV2(tx *models.Transaction) *TransactionCreatedV2 {
+	return &TransactionCreatedV2{
+		ID:                    tx.ID,
+		TenantID:              tx.TenantID,
+		AccountID:             tx.AccountID,
+		Type:                  string(tx.Type),
+		Amount:                tx.Amount,
+		Fee:                   tx.Fee,
+		Status:                string(tx.Status),
+		FailureReason:         tx.FailureReason,
+		Reference:             tx.Reference,
+		ReferenceNamespace:    tx.ReferenceNamespace,
+		CounterpartyAccountID: tx.CounterpartyAccountID,
+		CounterpartyID:        tx.CounterpartyID,
+		Metadata:              tx.Metadata,
+		DuplicateOf:           tx.DuplicateOf,
+		CreditExpiresAt:       tx.CreditExpiresAt,
+		ValueDate:             tx.ValueDate,
+		BackDated:             tx.BackDated,
+		QuoteID:               tx.QuoteID,
+		GroupID:               tx.GroupID,
+		Leg:                   tx.Leg,
+		LegRole:               string(tx.LegRole),
+		RelatedLeg:            tx.RelatedLeg,
+		BalanceBefore:         tx.BalanceBefore,
+		BalanceAfter:          tx.BalanceAfter,
+		Enrichment:            tx.Enrichment,
+		Screening:             tx.Screening,
+		ProcessingStartedAt:   tx.ProcessingStartedAt,
+		RequestID:             tx.RequestID,
+		CreatedAt:             tx.CreatedAt,
+		UpdatedAt:             tx.UpdatedAt,
+		CompletedAt:           tx.CompletedAt,
+		Attempts:              tx.Attempts,
+		LastError:             tx.LastError,
+		LastAttemptAt:         tx.LastAttemptAt,
+		NextRetryAt:           tx.NextRetryAt,
+		FundingMode:           string(tx.FundingMode),
+		FundingDeadline:       tx.FundingDeadline,
+		RetryOnFunding:        tx.RetryOnFunding,
+	}
+}
+
+// Transaction converts a consumed payload back to the transaction it was queued from
+func (p *TransactionCreatedV2) Transaction() *models.Transaction {
+	return &models.Transaction{
+		ID:                    p.ID,
+		TenantID:              p.TenantID,
+		AccountID:             p.AccountID,
+		Type:                  models.TransactionType(p.Type),
+		Amount:                p.Amount,
+		Fee:                   p.Fee,
+		Status:                models.TransactionStatus(p.Status),
+		FailureReason:         p.FailureReason,
+		Reference:             p.Reference,
+		ReferenceNamespace:    p.ReferenceNamespace,
+		CounterpartyAccountID: p.CounterpartyAccountID,
+		CounterpartyID:        p.CounterpartyID,
+		Metadata:              p.Metadata,
+		DuplicateOf:           p.DuplicateOf,
+		CreditExpiresAt:       p.CreditExpiresAt,
+		ValueDate:             p.ValueDate,
+		BackDated:             p.BackDated,
+		QuoteID:               p.QuoteID,
+		GroupID:               p.GroupID,
+		Leg:                   p.Leg,
+		LegRole:               models.LegRole(p.LegRole),
+		RelatedLeg:            p.RelatedLeg,
+		BalanceBefore:         p.BalanceBefore,
+		BalanceAfter:          p.BalanceAfter,
+		Enrichment:            p.Enrichment,
+		Screening:             p.Screening,
+		ProcessingStartedAt:   p.ProcessingStartedAt,
+		RequestID:             p.RequestID,
+		CreatedAt:             p.CreatedAt,
+		UpdatedAt:             p.UpdatedAt,
+		CompletedAt:           p.CompletedAt,
+		Attempts:              p.Attempts,
+		LastError:             p.LastError,
+		LastAttemptAt:         p.LastAttemptAt,
+		NextRetryAt:           p.NextRetryAt,
+		FundingMode:           models.InsufficientFundsMode(p.FundingMode),
+		FundingDeadline:       p.FundingDeadline,
+		RetryOnFunding:        p.RetryOnFunding,
+	}
+}
+
+// TransactionV1 is the payload of transaction.completed v1
+type TransactionV1 struct {
+	ID                    string     `json:"id"`
+	AccountID             string     `json:"account_id"`
+	Type                  string     `json:"type"`
+	Amount                float64    `json:"amount"`
+	Fee                   float64    `json:"fee"`
+	Currency              string     `json:"currency,omitempty"`
+	Status                string     `json:"status"`
+	FailureReason         string     `json:"failure_reason,omitempty"`
+	Reference             string     `json:"reference"`
+	CounterpartyAccountID string     `json:"counterparty_account_id,omitempty"`
+	BalanceAfter          float64    `json:"balance_after"`
+	CreatedAt             time.Time  `json:"created_at"`
+	CompletedAt           *time.Time `json:"completed_at,omitempty"`
+}
+
+// NewTransactionV1 converts a transaction to its v1 event payload
+func NewTransactionV1(tx *models.Transaction, currency string) *TransactionV1 {
+	return &TransactionV1{
+		ID:                    tx.ID,
+		AccountID:             tx.AccountID,
+		Type:                  string(tx.Type),
+		Amount:                tx.Amount,
+		Fee:                   tx.Fee,
+		Currency:              currency,
+		Status:                string(tx.Status),
+		FailureReason:         tx.FailureReason,
+		Reference:             tx.Reference,
+		CounterpartyAccountID: tx.CounterpartyAccountID,
+		BalanceAfter:          tx.BalanceAfter,
+		CreatedAt:             tx.CreatedAt,
+		CompletedAt:           tx.CompletedAt,
+	}
+}
+
+// TransactionV2 is the payload of transaction.completed v2, which adds the counterparty and metadata
+type TransactionV2 struct {
+	ID                    string            `json:"id"`
+	AccountID             string            `json:"account_id"`
+	Type                  string            `json:"type"`
+	Amount                float64           `json:"amount"`
+	Fee                   float64           `json:"fee"`
+	Currency              string            `json:"currency,omitempty"`
+	Status                string            `json:"status"`
+	FailureReason         string            `json:"failure_reason,omitempty"`
+	Reference             string            `json:"reference"`
+	CounterpartyAccountID string            `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string            `json:"counterparty_id,omitempty"`
+	Metadata              map[string]string `json:"metadata,omitempty"`
+	BalanceAfter          float64           `json:"balance_after"`
+	CreatedAt             time.Time         `json:"created_at"`
+	CompletedAt           *time.Time        `json:"completed_at,omitempty"`
+}
+
+// NewTransactionV2 converts a transaction to its v2 event payload
+func NewTransactionV2(tx *models.Transaction, currency string) *TransactionV2 {
+	return &TransactionV2{
+		ID:                    tx.ID,
+		AccountID:             tx.AccountID,
+		Type:                  string(tx.Type),
+		Amount:                tx.Amount,
+		Fee:                   tx.Fee,
+		Currency:              currency,
+		Status:                string(tx.Status),
+		FailureReason:         tx.FailureReason,
+		Reference:             tx.Reference,
+		CounterpartyAccountID: tx.CounterpartyAccountID,
+		CounterpartyID:        tx.CounterpartyID,
+		Metadata:              tx.Metadata,
+		BalanceAfter:          tx.BalanceAfter,
+		CreatedAt:             tx.CreatedAt,
+		CompletedAt:           tx.CompletedAt,
+	}
+}
+
+// BalanceV1 is the payload of account.balance_updated v1
+type BalanceV1 struct {
+	AccountID     string    `json:"account_id"`
+	TransactionID string    `json:"transaction_id"`
+	Currency      string    `json:"currency"`
+	Balance       float64   `json:"balance"`
+	Change        float64   `json:"change"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NotificationV1 is the payload of the account notification events v1
+type NotificationV1 struct {
+	AccountID     string `json:"account_id"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	Subject       string `json:"subject"`
+	Message       string `json:"message"`
+}
+
+// FromNotification wraps an account notification as its catalog event
+func FromNotification(tenantID string, n *models.Notification) (*Envelope, error) {
+	t, ok := notificationTypes[n.Event]
+	if !ok {
+		return nil, fmt.Errorf("notification %s has no catalog event", n.Event)
+	}
+	return New(t, n.ID, tenantID, n.CreatedAt, &NotificationV1{
+		AccountID:     n.AccountID,
+		TransactionID: n.TransactionID,
+		Subject:       n.Subject,
+		Message:       n.Message,
+	})
+}
+
+// NotificationType returns the catalog event type an account notification is delivered as
+func NotificationType(event models.NotificationEvent) (Type, bool) {
+	t, ok := notificationTypes[event]
+	return t, ok
+}
+
+var notificationTypes = map[models.NotificationEvent]Type{
+	models.LargeWithdrawal:   TransactionLargeWithdrawal,
+	models.LowBalance:        AccountLowBalance,
+	models.TransactionFailed: TransactionFailed,
+	models.StatementReady:    StatementReady,
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// ErrUnsupportedFormat is returned for export formats there is no exporter for
+var ErrUnsupportedFormat = i18n.NewError("error.unsupported_export_format", "unsupported export format")
+
+// Format identifies a journal export format
+type Format string
+
+const (
+	// JSON writes the raw transaction list
+	JSON Format = "json"
+
+	// QuickBooks writes a QuickBooks Desktop IIF journal
+	QuickBooks Format = "quickbooks"
+
+	// Xero writes a Xero manual journal CSV import file
+	Xero Format = "xero"
+)
+
+// Accounts holds the chart-of-accounts names used on the two sides of every journal entry
+type Accounts struct {
+	// Cash is the bank/clearing account that receives deposits and pays withdrawals
+	Cash string
+
+	// CustomerBalances is the liability account holding customer funds
+	CustomerBalances string
+}
+
+// Exporter writes ledger activity in an accounting package's import format
+type Exporter interface {
+	ContentType() string
+	FileExtension() string
+	Write(w io.Writer, txs []*models.Transaction) error
+}
+
+// New returns the exporter for the given format
+func New(format Format) (Exporter, error) {
+	switch Format(strings.ToLower(string(format))) {
+	case "", JSON:
+		return &jsonExporter{}, nil
+	case QuickBooks, "iif":
+		return &iifExporter{accounts: Accounts{Cash: "Ledger Cash", CustomerBalances: "Customer Balances"}}, nil
+	case Xero:
+		return &xeroExporter{accounts: Accounts{Cash: "090", CustomerBalances: "800"}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// signedAmount returns the debit amount for the cash side of a transaction
+func signedAmount(tx *models.Transaction) float64 {
+	if tx.Type == models.Withdrawal {
+		return -tx.Amount
+	}
+	return tx.Amount
+}
+
+// debitAccount returns the account on the debit line; transfers move money between
+// customers so both lines hit the customer balances account
+func debitAccount(tx *models.Transaction, accounts Accounts) string {
+	if tx.Type == models.Transfer {
+		return accounts.CustomerBalances
+	}
+	return accounts.Cash
+}
+
+// memo builds the description line for a journal entry
+func memo(tx *models.Transaction) string {
+	if tx.Type == models.Transfer {
+		return fmt.Sprintf("%s %s account %s to %s", tx.Type, tx.Reference, tx.AccountID, tx.CounterpartyAccountID)
+	}
+	return fmt.Sprintf("%s %s account %s", tx.Type, tx.Reference, tx.AccountID)
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+type jsonExporter struct{}
+
+func (e *jsonExporter) ContentType() string   { return "application/json" }
+func (e *jsonExporter) FileExtension() string { return "json" }
+
+func (e *jsonExporter) Write(w io.Writer, txs []*models.Transaction) error {
+	if txs == nil {
+		txs = []*models.Transaction{}
+	}
+	return json.NewEncoder(w).Encode(txs)
+}
+
+// iifExporter writes QuickBooks IIF: one TRNS line per transaction balanced by one SPL line
+type iifExporter struct {
+	accounts Accounts
+}
+
+func (e *iifExporter) ContentType() string   { return "text/plain" }
+func (e *iifExporter) FileExtension() string { return "iif" }
+
+func (e *iifExporter) Write(w io.Writer, txs []*models.Transaction) error {
+	header := []string{
+		"!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO",
+		"!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO",
+		"!ENDTRNS",
+	}
+	if _, err := io.WriteString(w, strings.Join(header, "\n")+"\n"); err != nil {
+		return fmt.Errorf("failed to write IIF header: %w", err)
+	}
+
+	for _, tx := range txs {
+		trnsType := "DEPOSIT"
+		switch tx.Type {
+		case models.Withdrawal:
+			trnsType = "CHECK"
+		case models.Transfer:
+			trnsType = "GENERAL JOURNAL"
+		}
+		date := tx.CreatedAt.UTC().Format("01/02/2006")
+		amount := signedAmount(tx)
+		description := iifField(memo(tx))
+		docNum := iifField(tx.Reference)
+
+		lines := []string{
+			fmt.Sprintf("TRNS\t\t%s\t%s\t%s\t%.2f\t%s\t%s", trnsType, date, debitAccount(tx, e.accounts), amount, docNum, description),
+			fmt.Sprintf("SPL\t\t%s\t%s\t%s\t%.2f\t%s\t%s", trnsType, date, e.accounts.CustomerBalances, -amount, docNum, description),
+			"ENDTRNS",
+		}
+		if _, err := io.WriteString(w, strings.Join(lines, "\n")+"\n"); err != nil {
+			return fmt.Errorf("failed to write IIF entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// iifField strips characters that would break the tab-separated layout
+func iifField(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// xeroExporter writes a Xero manual journal CSV with one balanced pair of lines per transaction
+type xeroExporter struct {
+	accounts Accounts
+}
+
+func (e *xeroExporter) ContentType() string   { return "text/csv" }
+func (e *xeroExporter) FileExtension() string { return "csv" }
+
+func (e *xeroExporter) Write(w io.Writer, txs []*models.Transaction) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"*Narration", "*Date", "Description", "*AccountCode", "*TaxRate", "*Amount"}); err != nil {
+		return fmt.Errorf("failed to write Xero header: %w", err)
+	}
+
+	for _, tx := range txs {
+		narration := fmt.Sprintf("Ledger %s %s", tx.Type, tx.ID)
+		date := tx.CreatedAt.UTC().Format("02/01/2006")
+		description := memo(tx)
+		amount := signedAmount(tx)
+
+		rows := [][]string{
+			{narration, date, description, debitAccount(tx, e.accounts), "Tax Exempt", fmt.Sprintf("%.2f", amount)},
+			{narration, date, description, e.accounts.CustomerBalances, "Tax Exempt", fmt.Sprintf("%.2f", -amount)},
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write Xero entry: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
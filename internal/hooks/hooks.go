@@ -0,0 +1,70 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// PreProcessor runs a custom business rule before a transaction's balance is applied, e.g. a bank-specific
+// limit check; an error fails the transaction with it as the failure reason
+type PreProcessor interface {
+	PreProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error
+}
+
+// Simulator is a PreProcessor that can make its check without side effects, such as counting what it saw, for
+// simulated transactions; simulations skip pre-processors that aren't Simulators
+type Simulator interface {
+	SimulatePreProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error
+}
+
+// PostProcessor is told about every completed transaction; the balance has already moved, so an error is only logged
+type PostProcessor interface {
+	PostProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error
+}
+
+// Hook is a registered hook with the name it was registered under
+type Hook struct {
+	Name string
+	Pre  PreProcessor
+	Post PostProcessor
+}
+
+var (
+	mu         sync.Mutex
+	registered = map[string]Hook{}
+)
+
+// Register makes a hook available to the processor; hook implements PreProcessor, PostProcessor or both
+// intended to be called from the init function of the package that defines the hook; panics on a duplicate name
+// or a value that implements neither interface, as those are programming errors
+func Register(name string, hook interface{}) {
+	pre, isPre := hook.(PreProcessor)
+	post, isPost := hook.(PostProcessor)
+	if !isPre && !isPost {
+		panic(fmt.Sprintf("hooks: %s implements neither PreProcessor nor PostProcessor", name))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registered[name]; dup {
+		panic(fmt.Sprintf("hooks: %s registered twice", name))
+	}
+	registered[name] = Hook{Name: name, Pre: pre, Post: post}
+}
+
+// Registered returns every registered hook, ordered by name so every replica runs them in the same order
+func Registered() []Hook {
+	mu.Lock()
+	defer mu.Unlock()
+
+	all := make([]Hook, 0, len(registered))
+	for _, h := range registered {
+		all = append(all, h)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale every catalog falls back to; its texts are the ones the code is written in
+const Default = "en"
+
+//go:embed catalogs/*.json
+var files embed.FS
+
+// catalogs maps locale to message key to text
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	entries, err := files.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		raw, err := files.ReadFile(path.Join("catalogs", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			panic(fmt.Sprintf("invalid catalog %s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+}
+
+// Locales returns the locales that have a catalog
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported returns the catalog locale for a tag such as "de-AT", or "" when there is none
+func Supported(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	if base, _, ok := strings.Cut(tag, "-"); ok {
+		if _, ok := catalogs[base]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+// Negotiate picks the best supported locale from an Accept-Language header, or Default
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(params[len("q="):], 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= bestQ {
+			continue
+		}
+		if locale := Supported(tag); locale != "" {
+			best, bestQ = locale, q
+		}
+	}
+	return best
+}
+
+type localeKey struct{}
+
+// WithLocale returns a context carrying the locale responses should be written in
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// FromContext returns the locale carried by ctx, or Default
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return Default
+}
+
+// T returns the text of key in locale, formatted with args; missing translations fall back to English, then the key
+func T(locale, key string, args ...interface{}) string {
+	text, ok := catalogs[locale][key]
+	if !ok {
+		if text, ok = catalogs[Default][key]; !ok {
+			text = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Error is an error with a catalog key, so responses can carry its stable code and translated text; sentinels
+// are declared with NewError and wrapped as usual
+type Error struct {
+	key  string
+	text string
+}
+
+// NewError returns an error with the message key of the catalogs and the English text the code reports
+func NewError(key, text string) *Error {
+	return &Error{key: key, text: text}
+}
+
+func (e *Error) Error() string { return e.text }
+
+// Code is the machine-readable part of the error's key, e.g. "account_not_found" for "error.account_not_found"
+func (e *Error) Code() string {
+	return e.key[strings.Index(e.key, ".")+1:]
+}
+
+// Translate returns the code of the first Error in err's chain and err's message in locale
+// a message of the form "<error text>: <detail>" keeps its detail untranslated; one that wraps the error further
+// in, such as "payer account not found", keeps its English text
+// ok is false for errors without an Error, whose message is returned unchanged
+func Translate(locale string, err error) (code, text string, ok bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return "", err.Error(), false
+	}
+	message := err.Error()
+	switch {
+	case message == e.text:
+		return e.Code(), T(locale, e.key), true
+	case strings.HasPrefix(message, e.text+": "):
+		return e.Code(), T(locale, e.key) + message[len(e.text):], true
+	}
+	return e.Code(), message, true
+}
@@ -0,0 +1,39 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	notFound := NewError("error.account_not_found", "account not found")
+	tests := []struct {
+		name string
+		err  error
+		code string
+		text string
+		ok   bool
+	}{
+		{"sentinel", notFound, "account_not_found", "Konto nicht gefunden", true},
+		{"detail kept", fmt.Errorf("%w: acc-1", notFound), "account_not_found", "Konto nicht gefunden: acc-1", true},
+		{"wrapped further in", fmt.Errorf("payer %w", notFound), "account_not_found", "payer account not found", true},
+		{"behind a wrapping message", fmt.Errorf("failed to load: %w", notFound), "account_not_found", "failed to load: account not found", true},
+		{"not an Error", errors.New("account not found"), "", "account not found", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, text, ok := Translate("de", tt.err)
+			if code != tt.code || text != tt.text || ok != tt.ok {
+				t.Fatalf("got %q, %q, %v; want %q, %q, %v", code, text, ok, tt.code, tt.text, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTranslateFallsBackToEnglish(t *testing.T) {
+	err := NewError("error.account_not_found", "account not found")
+	if _, text, _ := Translate("xx", err); text != "Account not found" {
+		t.Fatalf("got %q, want the English catalog text", text)
+	}
+}
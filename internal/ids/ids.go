@@ -0,0 +1,43 @@
+package ids
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Generator hands out ids for new records
+type Generator interface {
+	NewID() string
+}
+
+// UUID generates random version 4 UUIDs
+var UUID Generator = uuidGenerator{}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string { return uuid.New().String() }
+
+// Sequence generates the same series of UUIDs for the same seed, for deterministic tests
+type Sequence struct {
+	seed string
+
+	mu sync.Mutex
+	n  int
+}
+
+// creates a new Sequence
+func NewSequence(seed string) *Sequence {
+	return &Sequence{seed: seed}
+}
+
+// NewID returns the next UUID of the series
+func (s *Sequence) NewID() string {
+	s.mu.Lock()
+	s.n++
+	n := s.n
+	s.mu.Unlock()
+
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(s.seed+"/"+strconv.Itoa(n))).String()
+}
@@ -0,0 +1,127 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parse returns the generator for an id strategy name: uuid (the default), ulid or ksuid
+func Parse(name string) (Generator, error) {
+	switch strings.ToLower(name) {
+	case "", "uuid":
+		return UUID, nil
+	case "ulid":
+		return NewULID(), nil
+	case "ksuid":
+		return NewKSUID(), nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy: %s", name)
+	}
+}
+
+// crockford is the ULID alphabet; it sorts the same as the bytes it encodes
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates 26-character ULIDs: a millisecond timestamp then 80 random bits, so ids sort by creation time
+// ids made within the same millisecond increment the random part and keep sorting in order
+type ULID struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	lastMs uint64
+	last   [10]byte
+}
+
+// creates a new ULID generator
+func NewULID() *ULID {
+	return &ULID{now: time.Now}
+}
+
+// NewID returns the next ULID
+func (g *ULID) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastMs {
+		// same millisecond, or the clock stepped back: stay monotonic on the last timestamp
+		ms = g.lastMs
+		if !increment(g.last[:]) {
+			ms++
+			randomFill(g.last[:])
+		}
+	} else {
+		randomFill(g.last[:])
+	}
+	g.lastMs = ms
+
+	var raw [16]byte
+	raw[0], raw[1], raw[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	raw[3], raw[4], raw[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+	copy(raw[6:], g.last[:])
+
+	// 128 bits in 26 base32 digits, most significant first; the top digit only carries 3 bits
+	n := new(big.Int).SetBytes(raw[:])
+	var out [26]byte
+	mask := big.NewInt(31)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(out[:])
+}
+
+// ksuidEpoch is the KSUID timestamp origin, 2014-05-13T16:53:20Z
+const ksuidEpoch = 1400000000
+
+// base62 is the KSUID alphabet, in sort order
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KSUID generates 27-character KSUIDs: a second timestamp then 128 random bits, so ids sort by creation second
+type KSUID struct {
+	now func() time.Time
+}
+
+// creates a new KSUID generator
+func NewKSUID() *KSUID {
+	return &KSUID{now: time.Now}
+}
+
+// NewID returns a new KSUID
+func (g *KSUID) NewID() string {
+	var raw [20]byte
+	binary.BigEndian.PutUint32(raw[:4], uint32(g.now().Unix()-ksuidEpoch))
+	randomFill(raw[4:])
+
+	n := new(big.Int).SetBytes(raw[:])
+	base := big.NewInt(62)
+	digit := new(big.Int)
+	out := []byte(strings.Repeat("0", 27))
+	for i := len(out) - 1; i >= 0 && n.Sign() > 0; i-- {
+		n.DivMod(n, base, digit)
+		out[i] = base62[digit.Int64()]
+	}
+	return string(out)
+}
+
+// increment adds one to a big-endian number, reporting false when it overflowed
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func randomFill(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+}
@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// component is recorded on the timeline of every imported transaction
+const component = "importer"
+
+// Importer migrates accounts and their history from a legacy system into one tenant
+// every step is keyed on the legacy ids and references, so an interrupted import can simply be run again
+type Importer struct {
+	postgres *db.Postgres
+	mongodb  *db.MongoDB
+	policy   money.Policy
+
+	// DryRun validates and replays everything without writing
+	DryRun bool
+}
+
+// BalanceMismatch is an account whose replayed history doesn't add up to the legacy closing balance
+type BalanceMismatch struct {
+	LegacyID string
+	Replayed float64
+	Legacy   float64
+}
+
+// Report summarises an import
+type Report struct {
+	AccountsCreated      int
+	AccountsExisting     int
+	TransactionsImported int
+	TransactionsSkipped  int
+	Mismatches           []BalanceMismatch
+}
+
+// creates a new Importer
+func New(postgres *db.Postgres, mongodb *db.MongoDB, policy money.Policy) *Importer {
+	return &Importer{postgres: postgres, mongodb: mongodb, policy: policy}
+}
+
+// ledger is the replayed state of one account
+type ledger struct {
+	record  *AccountRecord
+	id      string
+	balance float64
+	summary models.AccountSummary
+}
+
+// Run validates the whole input, creates the accounts, replays history oldest first and sets the final balances
+// ctx must carry the tenant being imported into
+func (im *Importer) Run(ctx context.Context, accounts []*AccountRecord, txs []*TransactionRecord) (*Report, error) {
+	ledgers, err := validate(accounts, txs)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+
+	for _, record := range accounts {
+		l := ledgers[record.LegacyID]
+		existing, err := im.postgres.GetAccountByExternalReference(ctx, record.LegacyID)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil && !im.DryRun {
+			existing, _, err = im.postgres.ImportAccount(ctx, record.LegacyID, record.Currency, record.Metadata, record.OpenedAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import account %s: %w", record.LegacyID, err)
+			}
+			report.AccountsCreated++
+		} else if existing == nil {
+			report.AccountsCreated++
+		} else {
+			if !strings.EqualFold(existing.Currency, record.Currency) {
+				return nil, fmt.Errorf("account %s already exists in %s, not %s", record.LegacyID, existing.Currency, record.Currency)
+			}
+			report.AccountsExisting++
+		}
+		if existing != nil {
+			l.id = existing.ID
+		}
+	}
+
+	// replay oldest first; the legacy file order breaks ties
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].CreatedAt.Before(txs[j].CreatedAt) })
+	for _, record := range txs {
+		tx := im.replay(ledgers, record)
+		if im.DryRun {
+			found, err := im.mongodb.GetTransactionByReference(ctx, "", tx.AccountID, record.Reference)
+			if err != nil {
+				return nil, err
+			}
+			if found != nil {
+				report.TransactionsSkipped++
+			} else {
+				report.TransactionsImported++
+			}
+			continue
+		}
+
+		inserted, err := im.mongodb.ImportTransaction(ctx, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import transaction %s: %w", record.Reference, err)
+		}
+		if inserted {
+			report.TransactionsImported++
+		} else {
+			report.TransactionsSkipped++
+		}
+	}
+
+	for _, record := range accounts {
+		l := ledgers[record.LegacyID]
+		final := l.balance
+		if record.Balance != nil {
+			if math.Abs(*record.Balance-l.balance) > 1e-9 {
+				report.Mismatches = append(report.Mismatches, BalanceMismatch{LegacyID: record.LegacyID, Replayed: l.balance, Legacy: *record.Balance})
+			}
+			// the legacy closing balance is authoritative; mismatches are reported for reconciliation
+			final = *record.Balance
+		}
+		if im.DryRun {
+			continue
+		}
+		if err := im.postgres.SetImportedBalance(ctx, l.id, final, l.summary); err != nil {
+			return nil, fmt.Errorf("failed to set balance of account %s: %w", record.LegacyID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// replay applies a record to the running balances and returns it as a completed ledger transaction
+func (im *Importer) replay(ledgers map[string]*ledger, record *TransactionRecord) *models.Transaction {
+	source := ledgers[record.AccountID]
+	at := record.CreatedAt
+	tx := &models.Transaction{
+		AccountID:     source.id,
+		Type:          record.Type,
+		Amount:        record.Amount,
+		Status:        models.Completed,
+		Reference:     record.Reference,
+		BalanceBefore: source.balance,
+		CreatedAt:     at,
+		UpdatedAt:     at,
+		CompletedAt:   &at,
+		Timeline: []models.TimelineEvent{{
+			Event:     models.TimelineCompleted,
+			Status:    models.Completed,
+			At:        at,
+			Component: component,
+			Detail:    "imported from legacy system",
+		}},
+	}
+
+	switch record.Type {
+	case models.Deposit:
+		source.credit(im.policy, record.Amount, at)
+	case models.Withdrawal:
+		source.debit(im.policy, record.Amount, at)
+	case models.Transfer:
+		counterparty := ledgers[record.CounterpartyAccountID]
+		tx.CounterpartyAccountID = counterparty.id
+		source.debit(im.policy, record.Amount, at)
+		counterparty.credit(im.policy, record.Amount, at)
+	}
+	tx.BalanceAfter = source.balance
+
+	return tx
+}
+
+func (l *ledger) credit(policy money.Policy, amount float64, at time.Time) {
+	l.balance = policy.Round(l.balance+amount, l.record.Currency)
+	l.summary.TotalDeposits = policy.Round(l.summary.TotalDeposits+amount, l.record.Currency)
+	l.touch(at)
+}
+
+func (l *ledger) debit(policy money.Policy, amount float64, at time.Time) {
+	l.balance = policy.Round(l.balance-amount, l.record.Currency)
+	l.summary.TotalWithdrawals = policy.Round(l.summary.TotalWithdrawals+amount, l.record.Currency)
+	l.touch(at)
+}
+
+func (l *ledger) touch(at time.Time) {
+	l.summary.TransactionCount++
+	if l.summary.LastTransactionAt == nil || at.After(*l.summary.LastTransactionAt) {
+		at := at
+		l.summary.LastTransactionAt = &at
+	}
+}
+
+// validate checks the whole input before anything is written, so a bad file never leaves a half import
+func validate(accounts []*AccountRecord, txs []*TransactionRecord) (map[string]*ledger, error) {
+	var problems []string
+	ledgers := make(map[string]*ledger, len(accounts))
+	for _, record := range accounts {
+		record.Currency = strings.ToUpper(record.Currency)
+		switch {
+		case record.LegacyID == "":
+			problems = append(problems, fmt.Sprintf("account line %d: legacy_id is required", record.line))
+		case ledgers[record.LegacyID] != nil:
+			problems = append(problems, fmt.Sprintf("account line %d: duplicate legacy_id %s", record.line, record.LegacyID))
+		default:
+			if _, ok := money.Lookup(record.Currency); !ok {
+				problems = append(problems, fmt.Sprintf("account line %d: invalid currency %q", record.line, record.Currency))
+			}
+			if record.OpenedAt.IsZero() {
+				problems = append(problems, fmt.Sprintf("account line %d: opened_at is required", record.line))
+			}
+			ledgers[record.LegacyID] = &ledger{record: record}
+		}
+	}
+
+	references := make(map[string]bool, len(txs))
+	for _, record := range txs {
+		where := fmt.Sprintf("transaction line %d", record.line)
+		if record.Reference == "" {
+			problems = append(problems, where+": reference is required")
+		} else if references[record.Reference] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate reference %s", where, record.Reference))
+		}
+		references[record.Reference] = true
+
+		source := ledgers[record.AccountID]
+		if source == nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown account %q", where, record.AccountID))
+		}
+		switch record.Type {
+		case models.Deposit, models.Withdrawal:
+			if record.CounterpartyAccountID != "" {
+				problems = append(problems, fmt.Sprintf("%s: only transfers have a counterparty", where))
+			}
+		case models.Transfer:
+			counterparty := ledgers[record.CounterpartyAccountID]
+			if counterparty == nil {
+				problems = append(problems, fmt.Sprintf("%s: unknown counterparty account %q", where, record.CounterpartyAccountID))
+			} else if source != nil && counterparty.record.Currency != source.record.Currency {
+				problems = append(problems, fmt.Sprintf("%s: transfer between %s and %s accounts", where, source.record.Currency, counterparty.record.Currency))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s: invalid type %q", where, record.Type))
+		}
+		if source != nil {
+			if err := money.Validate(record.Amount, source.record.Currency, money.Bounds{}); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+			}
+		}
+		if record.CreatedAt.IsZero() {
+			problems = append(problems, where+": created_at is required")
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid import:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return ledgers, nil
+}
@@ -0,0 +1,169 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// AccountRecord is an account exported from the legacy system
+type AccountRecord struct {
+	LegacyID string `json:"legacy_id"`
+	Currency string `json:"currency"`
+	// Balance is the legacy system's closing balance; when nil the replayed balance is used
+	Balance  *float64          `json:"balance,omitempty"`
+	OpenedAt time.Time         `json:"opened_at"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	line int
+}
+
+// TransactionRecord is a historical transaction exported from the legacy system
+// account ids are legacy ids of accounts in the same import
+type TransactionRecord struct {
+	Reference             string                 `json:"reference"`
+	AccountID             string                 `json:"account_id"`
+	CounterpartyAccountID string                 `json:"counterparty_account_id,omitempty"`
+	Type                  models.TransactionType `json:"type"`
+	Amount                float64                `json:"amount"`
+	CreatedAt             time.Time              `json:"created_at"`
+
+	line int
+}
+
+// accountColumns are the CSV columns read into AccountRecord fields; any other column becomes metadata
+var accountColumns = map[string]bool{"legacy_id": true, "currency": true, "balance": true, "opened_at": true}
+
+// ReadAccounts reads accounts from a .csv file with a header row or a .jsonl file with one object per line
+func ReadAccounts(path string) ([]*AccountRecord, error) {
+	var records []*AccountRecord
+	err := readFile(path, func(line int, fields map[string]string, raw []byte) error {
+		record := &AccountRecord{line: line}
+		if raw != nil {
+			if err := json.Unmarshal(raw, record); err != nil {
+				return err
+			}
+		} else {
+			record.LegacyID = fields["legacy_id"]
+			record.Currency = fields["currency"]
+			if v := fields["balance"]; v != "" {
+				balance, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return fmt.Errorf("invalid balance %q", v)
+				}
+				record.Balance = &balance
+			}
+			if v := fields["opened_at"]; v != "" {
+				openedAt, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return fmt.Errorf("invalid opened_at %q", v)
+				}
+				record.OpenedAt = openedAt
+			}
+			for key, value := range fields {
+				if !accountColumns[key] && value != "" {
+					if record.Metadata == nil {
+						record.Metadata = make(map[string]string)
+					}
+					record.Metadata[key] = value
+				}
+			}
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// ReadTransactions reads transactions from a .csv file with a header row or a .jsonl file with one object per line
+func ReadTransactions(path string) ([]*TransactionRecord, error) {
+	var records []*TransactionRecord
+	err := readFile(path, func(line int, fields map[string]string, raw []byte) error {
+		record := &TransactionRecord{line: line}
+		if raw != nil {
+			if err := json.Unmarshal(raw, record); err != nil {
+				return err
+			}
+		} else {
+			record.Reference = fields["reference"]
+			record.AccountID = fields["account_id"]
+			record.CounterpartyAccountID = fields["counterparty_account_id"]
+			record.Type = models.TransactionType(fields["type"])
+			amount, err := strconv.ParseFloat(fields["amount"], 64)
+			if err != nil {
+				return fmt.Errorf("invalid amount %q", fields["amount"])
+			}
+			record.Amount = amount
+			createdAt, err := time.Parse(time.RFC3339, fields["created_at"])
+			if err != nil {
+				return fmt.Errorf("invalid created_at %q", fields["created_at"])
+			}
+			record.CreatedAt = createdAt
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// readFile calls fn for every record of a CSV or JSONL file; CSV records come as fields keyed by header,
+// JSONL records as the raw line
+func readFile(path string, fn func(line int, fields map[string]string, raw []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		r := csv.NewReader(f)
+		header, err := r.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read header of %s: %w", path, err)
+		}
+		for line := 2; ; line++ {
+			row, err := r.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			fields := make(map[string]string, len(header))
+			for i, name := range header {
+				fields[strings.TrimSpace(name)] = strings.TrimSpace(row[i])
+			}
+			if err := fn(line, fields, nil); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+	case ".jsonl":
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			raw := []byte(strings.TrimSpace(scanner.Text()))
+			if len(raw) == 0 {
+				continue
+			}
+			if err := fn(line, nil, raw); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported file type %s: use .csv or .jsonl", path)
+	}
+}
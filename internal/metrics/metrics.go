@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LatencyBuckets are histogram upper bounds in seconds suited to queued transaction processing
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+// QueryBuckets are histogram upper bounds in seconds suited to single database operations
+var QueryBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// metric is anything that can render itself in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	mu         sync.Mutex
+	registered []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, m)
+}
+
+// Counter is a process-wide monotonically increasing value
+type Counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// creates and registers a new Counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(c)
+	return c
+}
+
+// increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	fmt.Fprintf(w, "%s %d\n", c.name, atomic.LoadUint64(&c.value))
+}
+
+// Gauge is a process-wide value that can go up and down
+type Gauge struct {
+	name string
+	help string
+	bits uint64
+}
+
+// creates and registers a new Gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	fmt.Fprintf(w, "%s %g\n", g.name, math.Float64frombits(atomic.LoadUint64(&g.bits)))
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// creates and registers a new Histogram with the given bucket upper bounds
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &Histogram{name: name, help: help, buckets: sorted, counts: make([]uint64, len(sorted))}
+	register(h)
+	return h
+}
+
+// records a single observation
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.writeSeries(w, "")
+}
+
+// writeSeries writes the histogram's samples; labels, when set, are rendered before le as `name="value",`
+func (h *Histogram) writeSeries(w io.Writer, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", h.name, labels, formatBound(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.name, labels, h.count)
+	if labels == "" {
+		fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+		fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+		return
+	}
+	labels = strings.TrimSuffix(labels, ",")
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", h.name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, h.count)
+}
+
+// HistogramVec is a histogram split by the value of one label, e.g. the operation being timed
+type HistogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*Histogram
+}
+
+// creates and registers a new HistogramVec with the given label name and bucket upper bounds
+func NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	v := &HistogramVec{name: name, help: help, label: label, buckets: sorted, series: make(map[string]*Histogram)}
+	register(v)
+	return v
+}
+
+// returns the histogram for a label value, creating it on first use; label values should be few and fixed
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.series[value]
+	if !ok {
+		h = &Histogram{name: v.name, buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+		v.series[value] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.series))
+	for value := range v.series {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+	sort.Strings(values)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, value := range values {
+		v.mu.Lock()
+		h := v.series[value]
+		v.mu.Unlock()
+		h.writeSeries(w, fmt.Sprintf("%s=%q,", v.label, value))
+	}
+}
+
+func formatBound(v float64) string {
+	s := fmt.Sprintf("%g", v)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// Handler serves every registered metric in the Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		mu.Lock()
+		metrics := append([]metric(nil), registered...)
+		mu.Unlock()
+
+		for _, m := range metrics {
+			m.write(w)
+		}
+	})
+}
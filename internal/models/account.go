@@ -4,19 +4,143 @@ import (
 	"time"
 )
 
+// AccountKind separates customer accounts from accounts the ledger operates itself
+type AccountKind string
+
+const (
+	// CustomerAccount is an ordinary account owned by a tenant's customer
+	CustomerAccount AccountKind = "customer"
+
+	// EscrowAccount holds escrowed funds until they are released or refunded; one per tenant and currency
+	EscrowAccount AccountKind = "escrow"
+
+	// CardHoldAccount holds funds reserved by card authorizations until they are captured or released
+	CardHoldAccount AccountKind = "card_holds"
+
+	// CardSettlementAccount collects captured card payments owed to the card processor
+	CardSettlementAccount AccountKind = "card_settlement"
+
+	// FeeIncomeAccount is credited with every fee charged to a customer
+	FeeIncomeAccount AccountKind = "fee_income"
+
+	// InterestExpenseAccount funds interest and promotional credit paid to customers; its balance runs negative
+	InterestExpenseAccount AccountKind = "interest_expense"
+
+	// SuspenseAccount holds money that couldn't be applied to the account it was meant for
+	SuspenseAccount AccountKind = "suspense"
+)
+
+// Contra reports whether the kind is only ever posted to as the other side of automated postings, with no
+// transaction history of its own
+func (k AccountKind) Contra() bool {
+	switch k {
+	case FeeIncomeAccount, InterestExpenseAccount, SuspenseAccount:
+		return true
+	}
+	return false
+}
+
 type Account struct {
-	ID        string    `json:"id" db:"id"`
-	Balance   float64   `json:"balance" db:"balance"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID           string      `json:"id" db:"id"`
+	TenantID     string      `json:"tenant_id" db:"tenant_id"`
+	Kind         AccountKind `json:"kind" db:"kind"`
+	Currency     string      `json:"currency" db:"currency"`
+	Balance      float64     `json:"balance" db:"balance"`
+	KYCStatus    KYCStatus   `json:"kyc_status" db:"kyc_status"`
+	KYCReference string      `json:"kyc_reference,omitempty" db:"kyc_reference"`
+	// ExternalReference is the tenant's own identifier for the account, unique within the tenant
+	ExternalReference string            `json:"external_reference,omitempty" db:"external_reference"`
+	Metadata          map[string]string `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt         time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+type KYCStatus string
+
+const (
+	// KYCUnverified is the status of an account that hasn't started verification
+	KYCUnverified KYCStatus = "unverified"
+
+	// KYCPending is verification in progress at the provider
+	KYCPending KYCStatus = "pending"
+
+	// KYCVerified is a customer the provider has verified
+	KYCVerified KYCStatus = "verified"
+
+	// KYCRejected is a customer the provider could not verify
+	KYCRejected KYCStatus = "rejected"
+)
+
+// Valid reports whether s is a known KYC status
+func (s KYCStatus) Valid() bool {
+	switch s {
+	case KYCUnverified, KYCPending, KYCVerified, KYCRejected:
+		return true
+	}
+	return false
+}
+
+// represents a KYC status update, from the tenant or the KYC provider's callback
+type KYCUpdateRequest struct {
+	// TenantID and AccountID are only read from provider callbacks; tenant requests use the route
+	TenantID  string    `json:"tenant_id,omitempty"`
+	AccountID string    `json:"account_id,omitempty"`
+	Status    KYCStatus `json:"status" validate:"required,oneof=unverified pending verified rejected"`
+	Reference string    `json:"reference,omitempty"`
 }
 
 type CreateAccountRequest struct {
-	InitialBalance float64 `json:"initial_balance" validate:"min=0"`
+	InitialBalance    float64           `json:"initial_balance" validate:"min=0"`
+	Currency          string            `json:"currency,omitempty" validate:"omitempty,len=3"`
+	ExternalReference string            `json:"external_reference,omitempty" validate:"omitempty,max=255"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
 }
 
 type AccountResponse struct {
-	ID        string    `json:"id"`
-	Balance   float64   `json:"balance"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string      `json:"id"`
+	Kind      AccountKind `json:"kind"`
+	Currency  string      `json:"currency"`
+	Balance   float64     `json:"balance"`
+	KYCStatus KYCStatus   `json:"kyc_status"`
+	CreatedAt time.Time   `json:"created_at"`
+
+	ExternalReference string            `json:"external_reference,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+
+	// BalanceBreakdown is only filled in when the account holds promotional credit
+	BalanceBreakdown *BalanceBreakdown `json:"balance_breakdown,omitempty"`
+
+	Activity *AccountSummary `json:"activity,omitempty"`
+
+	// Display formats the money fields above, keyed by field name, when the client asks with display=true
+	Display map[string]MoneyDisplay `json:"display,omitempty"`
+}
+
+// AccountSummary is the running activity of an account, maintained as transactions are applied
+// deposits include incoming transfers and withdrawals include outgoing transfers and fees
+type AccountSummary struct {
+	TotalDeposits     float64    `json:"total_deposits"`
+	TotalWithdrawals  float64    `json:"total_withdrawals"`
+	TransactionCount  int64      `json:"transaction_count"`
+	LastTransactionAt *time.Time `json:"last_transaction_at,omitempty"`
+}
+
+// AccountPause stops the processor from applying an account's transactions, e.g. during an investigation
+type AccountPause struct {
+	AccountID string    `json:"account_id" db:"account_id"`
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`
+	Reason    string    `json:"reason,omitempty" db:"reason"`
+	PausedBy  string    `json:"paused_by,omitempty" db:"paused_by"`
+	PausedAt  time.Time `json:"paused_at" db:"paused_at"`
+}
+
+// represents the request to pause an account's processing
+type PauseAccountRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// represents the result of resuming an account
+type ResumeAccountResponse struct {
+	AccountID string `json:"account_id"`
+	Released  int    `json:"released"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+type AuditKind string
+
+const (
+	// AuditAuthFailed is a request whose credentials were missing or didn't authenticate
+	AuditAuthFailed AuditKind = "auth_failed"
+
+	// AuditAccessDenied is an authenticated request refused with 403
+	AuditAccessDenied AuditKind = "access_denied"
+
+	// AuditAccountProbe is one credential reaching for many accounts it doesn't have in a short time
+	AuditAccountProbe AuditKind = "account_probe"
+
+	// AuditAlert is a rate of failures or denials past its alert threshold
+	AuditAlert AuditKind = "alert"
+)
+
+// Valid reports whether k is a recorded audit kind
+func (k AuditKind) Valid() bool {
+	return k == AuditAuthFailed || k == AuditAccessDenied || k == AuditAccountProbe || k == AuditAlert
+}
+
+// AuditEvent is a recorded authentication or authorization event; Credential is a fingerprint of the
+// credentials presented, never the credentials themselves
+type AuditEvent struct {
+	ID         string    `json:"id" db:"id"`
+	Kind       AuditKind `json:"kind" db:"kind"`
+	TenantID   string    `json:"tenant_id,omitempty" db:"tenant_id"`
+	Actor      string    `json:"actor,omitempty" db:"actor"`
+	Credential string    `json:"credential,omitempty" db:"credential"`
+	Source     string    `json:"source,omitempty" db:"source"`
+	Method     string    `json:"method,omitempty" db:"method"`
+	Route      string    `json:"route,omitempty" db:"route"`
+	Status     int       `json:"status,omitempty" db:"status"`
+	Reason     string    `json:"reason,omitempty" db:"reason"`
+	RequestID  string    `json:"request_id,omitempty" db:"request_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter narrows an audit listing; empty fields match everything
+type AuditFilter struct {
+	Kind       AuditKind
+	TenantID   string
+	Credential string
+	Source     string
+	Since      time.Time
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+)
+
+type AuthorizationStatus string
+
+const (
+	// AuthorizationPending means the hold is being placed
+	AuthorizationPending AuthorizationStatus = "pending"
+
+	// AuthorizationApproved means the funds are held in the card holds account
+	AuthorizationApproved AuthorizationStatus = "approved"
+
+	// AuthorizationDeclined means no funds were held
+	AuthorizationDeclined AuthorizationStatus = "declined"
+
+	// AuthorizationTimedOut means the hold wasn't placed within the latency budget; the processor was told
+	// it was declined and any funds the hold takes later are returned
+	AuthorizationTimedOut AuthorizationStatus = "timed_out"
+
+	// AuthorizationCaptured means the captured amount went to the card settlement account and the rest was returned
+	AuthorizationCaptured AuthorizationStatus = "captured"
+
+	// AuthorizationReleased means the held funds were returned before capture
+	AuthorizationReleased AuthorizationStatus = "released"
+
+	// AuthorizationExpired means the hold lapsed without a capture and its funds were returned
+	AuthorizationExpired AuthorizationStatus = "expired"
+)
+
+// Authorization is a card processor's hold on an account's funds, captured or released later
+type Authorization struct {
+	ID             string              `json:"id" db:"id"`
+	TenantID       string              `json:"-" db:"tenant_id"`
+	AccountID      string              `json:"account_id" db:"account_id"`
+	HoldAccountID  string              `json:"hold_account_id" db:"hold_account_id"`
+	AuthCode       string              `json:"auth_code" db:"auth_code"`
+	Merchant       string              `json:"merchant,omitempty" db:"merchant"`
+	Amount         float64             `json:"amount" db:"amount"`
+	CapturedAmount float64             `json:"captured_amount,omitempty" db:"captured_amount"`
+	Currency       string              `json:"currency" db:"currency"`
+	Status         AuthorizationStatus `json:"status" db:"status"`
+	DeclineReason  string              `json:"decline_reason,omitempty" db:"decline_reason"`
+	ExpiresAt      time.Time           `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+// represents a card processor's request to authorize a payment
+type AuthorizationRequest struct {
+	AccountID string     `json:"account_id" validate:"required"`
+	AuthCode  string     `json:"auth_code" validate:"required"`
+	Amount    float64    `json:"amount" validate:"required,gt=0"`
+	Merchant  string     `json:"merchant,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// represents the request to capture an authorization; without an amount the whole hold is captured
+type CaptureRequest struct {
+	Amount *float64 `json:"amount,omitempty"`
+}
+
+type SettlementOutcome string
+
+const (
+	// SettlementCaptured means an approved authorization was captured at the settled amount
+	SettlementCaptured SettlementOutcome = "captured"
+
+	// SettlementAdjusted means the settled amount differed from the hold or an earlier capture, such as a tip,
+	// and the difference was posted
+	SettlementAdjusted SettlementOutcome = "adjusted"
+
+	// SettlementAlreadySettled means the authorization was already captured at the settled amount
+	SettlementAlreadySettled SettlementOutcome = "already_settled"
+
+	// SettlementAdjustFailed means the authorization was captured but the difference to the settled amount
+	// couldn't be posted; sending the item again posts it
+	SettlementAdjustFailed SettlementOutcome = "adjust_failed"
+
+	// SettlementUnmatched means the item couldn't be matched to an authorization holding funds; nothing was posted
+	SettlementUnmatched SettlementOutcome = "unmatched"
+)
+
+// SettlementItem is one capture in a card processor's settlement file; the settled amount is Amount plus Tip
+type SettlementItem struct {
+	Line     int     `json:"-"`
+	AuthCode string  `json:"auth_code"`
+	Amount   float64 `json:"amount"`
+	Tip      float64 `json:"tip,omitempty"`
+}
+
+// SettlementResult is what happened to one settlement item
+type SettlementResult struct {
+	Line            int               `json:"line"`
+	AuthCode        string            `json:"auth_code"`
+	AuthorizationID string            `json:"authorization_id,omitempty"`
+	Amount          float64           `json:"amount"`
+	Outcome         SettlementOutcome `json:"outcome"`
+	Reason          string            `json:"reason,omitempty"`
+}
+
+// SettlementReport summarises an ingested settlement file; Settled totals the amounts of matched items, which
+// don't include the ones whose adjustment failed
+type SettlementReport struct {
+	Items        int                `json:"items"`
+	Matched      int                `json:"matched"`
+	AdjustFailed int                `json:"adjust_failed"`
+	Unmatched    int                `json:"unmatched"`
+	Settled      float64            `json:"settled"`
+	Results      []SettlementResult `json:"results"`
+}
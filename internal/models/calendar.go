@@ -0,0 +1,35 @@
+package models
+
+// Holiday is a day a business calendar closes, written YYYY-MM-DD
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name,omitempty"`
+}
+
+// BusinessCalendar lists the holidays of a currency or region, on top of weekends; Default is set when the code has
+// no holidays of its own and the deployment's HOLIDAYS are used instead
+type BusinessCalendar struct {
+	Code     string    `json:"code"`
+	Default  bool      `json:"default,omitempty"`
+	Holidays []Holiday `json:"holidays"`
+}
+
+// CalendarSummary is a stored calendar in the listing
+type CalendarSummary struct {
+	Code     string `json:"code"`
+	Holidays int    `json:"holidays"`
+}
+
+// represents the request to replace a calendar's holidays
+type CalendarRequest struct {
+	Holidays []Holiday `json:"holidays"`
+}
+
+// BusinessDay answers whether a date is a business day in a calendar, with the business days either side
+type BusinessDay struct {
+	Calendar    string `json:"calendar"`
+	Date        string `json:"date"`
+	BusinessDay bool   `json:"business_day"`
+	Previous    string `json:"previous"`
+	Next        string `json:"next"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// ComplianceFinding is one line of a regulatory reporting extract for a customer account on a single UTC day
+type ComplianceFinding struct {
+	// Kind is "ctr" for activity over the reporting threshold and "structuring" for repeated just-below-threshold amounts
+	Kind      string  `json:"kind"`
+	Date      string  `json:"date"`
+	AccountID string  `json:"account_id"`
+	Direction string  `json:"direction"`
+	Currency  string  `json:"currency"`
+	Threshold float64 `json:"threshold"`
+	Total     float64 `json:"total"`
+	Count     int     `json:"count"`
+
+	TransactionIDs []string `json:"transaction_ids"`
+}
+
+const (
+	// FindingCTR marks a day's activity in one direction that exceeds the reporting threshold
+	FindingCTR = "ctr"
+
+	// FindingStructuring marks several transactions in one day just below the reporting threshold
+	FindingStructuring = "structuring"
+)
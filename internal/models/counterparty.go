@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+type RiskRating string
+
+const (
+	// RiskLow is the rating of counterparties nothing is known against
+	RiskLow RiskRating = "low"
+
+	// RiskMedium marks counterparties whose activity deserves a closer look
+	RiskMedium RiskRating = "medium"
+
+	// RiskHigh marks counterparties fraud rules and reviewers should treat with suspicion
+	RiskHigh RiskRating = "high"
+)
+
+// Valid reports whether the risk rating is one the ledger knows
+func (r RiskRating) Valid() bool {
+	switch r {
+	case RiskLow, RiskMedium, RiskHigh:
+		return true
+	}
+	return false
+}
+
+// Counterparty is a merchant or other outside party the tenant's transactions are with
+// Identifiers hold the party's external keys, such as a merchant ID, MCC or IBAN
+type Counterparty struct {
+	ID          string            `json:"id" db:"id"`
+	TenantID    string            `json:"-" db:"tenant_id"`
+	Name        string            `json:"name" db:"name"`
+	Identifiers map[string]string `json:"identifiers" db:"identifiers"`
+	RiskRating  RiskRating        `json:"risk_rating" db:"risk_rating"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to add a counterparty, or to update one where empty fields are left unchanged
+type CounterpartyRequest struct {
+	Name        string            `json:"name"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	RiskRating  RiskRating        `json:"risk_rating,omitempty"`
+}
+
+// CounterpartyAccountTotal sums completed activity between one counterparty and one account
+type CounterpartyAccountTotal struct {
+	CounterpartyID string  `bson:"counterparty_id"`
+	AccountID      string  `bson:"account_id"`
+	Count          int64   `bson:"count"`
+	Incoming       float64 `bson:"incoming"`
+	Outgoing       float64 `bson:"outgoing"`
+}
+
+// CounterpartyActivity sums a counterparty's completed activity in one currency
+// incoming is money received from the counterparty, outgoing money paid to it
+type CounterpartyActivity struct {
+	CounterpartyID string     `json:"counterparty_id"`
+	Name           string     `json:"name"`
+	RiskRating     RiskRating `json:"risk_rating"`
+	Currency       string     `json:"currency"`
+	Accounts       int        `json:"accounts"`
+	Count          int64      `json:"count"`
+	Incoming       float64    `json:"incoming"`
+	Outgoing       float64    `json:"outgoing"`
+}
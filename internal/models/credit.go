@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// CreditBucket is a promotional credit granted to an account; it is part of the balance
+// until it is spent or expires, and withdrawals spend the soonest-expiring credit first
+type CreditBucket struct {
+	ID            string    `json:"id" db:"id"`
+	TenantID      string    `json:"-" db:"tenant_id"`
+	AccountID     string    `json:"account_id" db:"account_id"`
+	TransactionID string    `json:"transaction_id" db:"transaction_id"`
+	Amount        float64   `json:"amount" db:"amount"`
+	Remaining     float64   `json:"remaining" db:"remaining"`
+	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// represents the request to grant a promotional credit
+type CreditGrantRequest struct {
+	Amount    float64   `json:"amount" validate:"required,gt=0"`
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+	Reference string    `json:"reference,omitempty"`
+}
+
+// BalanceBreakdown splits an account balance into cash and unexpired promotional credit
+type BalanceBreakdown struct {
+	Cash    float64         `json:"cash"`
+	Credits float64         `json:"credits"`
+	Buckets []*CreditBucket `json:"buckets"`
+}
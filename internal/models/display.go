@@ -0,0 +1,10 @@
+package models
+
+// MoneyDisplay is an amount formatted for people in the request's locale
+type MoneyDisplay struct {
+	Formatted string `json:"formatted"`
+	Symbol    string `json:"symbol"`
+	Currency  string `json:"currency"`
+	// Exponent is the number of decimal places of the currency's minor unit
+	Exponent int `json:"exponent"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+type EscrowStatus string
+
+const (
+	// EscrowHeld means the payer's funds are in (or on their way to) the escrow account
+	EscrowHeld EscrowStatus = "held"
+
+	// EscrowReleased means the funds were paid out to the payee
+	EscrowReleased EscrowStatus = "released"
+
+	// EscrowRefunded means the funds were returned to the payer
+	EscrowRefunded EscrowStatus = "refunded"
+
+	// EscrowCancelled means the payer's funds never reached the escrow account
+	EscrowCancelled EscrowStatus = "cancelled"
+)
+
+// Escrow holds a payer's funds in the tenant's escrow account until they are released to the payee
+// by an API call or at ReleaseAt, or refunded to the payer once ExpiresAt passes
+type Escrow struct {
+	ID              string       `json:"id" db:"id"`
+	TenantID        string       `json:"-" db:"tenant_id"`
+	PayerAccountID  string       `json:"payer_account_id" db:"payer_account_id"`
+	PayeeAccountID  string       `json:"payee_account_id" db:"payee_account_id"`
+	EscrowAccountID string       `json:"escrow_account_id" db:"escrow_account_id"`
+	Amount          float64      `json:"amount" db:"amount"`
+	Currency        string       `json:"currency" db:"currency"`
+	Reference       string       `json:"reference,omitempty" db:"reference"`
+	Status          EscrowStatus `json:"status" db:"status"`
+	ReleaseAt       *time.Time   `json:"release_at,omitempty" db:"release_at"`
+	ExpiresAt       time.Time    `json:"expires_at" db:"expires_at"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to open an escrow
+type EscrowRequest struct {
+	PayerAccountID string     `json:"payer_account_id" validate:"required"`
+	PayeeAccountID string     `json:"payee_account_id" validate:"required"`
+	Amount         float64    `json:"amount" validate:"required,gt=0"`
+	Reference      string     `json:"reference,omitempty"`
+	ReleaseAt      *time.Time `json:"release_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+type ExceptionStatus string
+
+const (
+	// ExceptionOpen means the funds are waiting in the suspense account for an operator
+	ExceptionOpen ExceptionStatus = "open"
+
+	// ExceptionReassigned means the funds were credited to another account
+	ExceptionReassigned ExceptionStatus = "reassigned"
+
+	// ExceptionRefunded means the funds were paid back out to the sender
+	ExceptionRefunded ExceptionStatus = "refunded"
+)
+
+// TransactionException is a deposit the processor couldn't apply, e.g. because its account no longer exists or
+// needs KYC first. Its funds are posted to the tenant's suspense account until an operator reassigns or refunds
+// them; Currency is empty when the account was unknown, in which case nothing was posted
+type TransactionException struct {
+	ID                      string          `json:"id" db:"id"`
+	TenantID                string          `json:"-" db:"tenant_id"`
+	TransactionID           string          `json:"transaction_id" db:"transaction_id"`
+	AccountID               string          `json:"account_id" db:"account_id"`
+	Amount                  float64         `json:"amount" db:"amount"`
+	Currency                string          `json:"currency,omitempty" db:"currency"`
+	Reason                  string          `json:"reason" db:"reason"`
+	Status                  ExceptionStatus `json:"status" db:"status"`
+	ReassignedTo            string          `json:"reassigned_to,omitempty" db:"reassigned_to"`
+	ResolutionTransactionID string          `json:"resolution_transaction_id,omitempty" db:"resolution_transaction_id"`
+	ResolvedBy              string          `json:"resolved_by,omitempty" db:"resolved_by"`
+	CreatedAt               time.Time       `json:"created_at" db:"created_at"`
+	ResolvedAt              *time.Time      `json:"resolved_at,omitempty" db:"resolved_at"`
+}
+
+// represents the request to credit an exception's funds to another account
+type ReassignExceptionRequest struct {
+	AccountID string `json:"account_id" validate:"required"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+)
+
+type ExportKind string
+
+const (
+	// ExportJournal is the completed ledger activity in an accounting package's import format
+	ExportJournal ExportKind = "journal"
+
+	// ExportCompliance is the CTR/SAR support extract
+	ExportCompliance ExportKind = "compliance"
+)
+
+// Valid reports whether k is a supported export kind
+func (k ExportKind) Valid() bool {
+	return k == ExportJournal || k == ExportCompliance
+}
+
+type ExportStatus string
+
+const (
+	// ExportQueued means the export waits for a worker
+	ExportQueued ExportStatus = "queued"
+
+	// ExportRunning means a worker is building the artifact
+	ExportRunning ExportStatus = "running"
+
+	// ExportCompleted means the artifact can be downloaded until the export expires
+	ExportCompleted ExportStatus = "completed"
+
+	// ExportFailed means the export stopped with Error
+	ExportFailed ExportStatus = "failed"
+)
+
+// ExportJob is an export built in the background; Done and Total count the days of the period loaded so far.
+// Its artifact is kept apart from the job and dropped once ExpiresAt passes
+type ExportJob struct {
+	ID          string       `json:"id" db:"id"`
+	TenantID    string       `json:"-" db:"tenant_id"`
+	Kind        ExportKind   `json:"kind" db:"kind"`
+	Format      string       `json:"format" db:"format"`
+	AccountID   string       `json:"account_id,omitempty" db:"account_id"`
+	From        time.Time    `json:"from" db:"period_from"`
+	To          time.Time    `json:"to" db:"period_to"`
+	Status      ExportStatus `json:"status" db:"status"`
+	Done        int          `json:"done" db:"done"`
+	Total       int          `json:"total" db:"total"`
+	Error       string       `json:"error,omitempty" db:"error"`
+	Filename    string       `json:"filename,omitempty" db:"filename"`
+	ContentType string       `json:"content_type,omitempty" db:"content_type"`
+	Size        int64        `json:"size,omitempty" db:"size"`
+	Checksum    string       `json:"sha256,omitempty" db:"checksum"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// represents the request to start an export; From and To are inclusive dates in YYYY-MM-DD format
+type CreateExportRequest struct {
+	Kind      ExportKind `json:"kind" validate:"required"`
+	Format    string     `json:"format,omitempty"`
+	AccountID string     `json:"account_id,omitempty"`
+	From      string     `json:"from" validate:"required"`
+	To        string     `json:"to" validate:"required"`
+}
+
+// ExportArtifact is the finished file of an export; with object storage configured it is the blob stored under
+// Key, downloaded from a signed URL, instead of Content. Checksum is its hex SHA-256
+type ExportArtifact struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	Checksum    string
+	Key         string
+	URL         string
+}
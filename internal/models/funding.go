@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// InsufficientFundsMode is what the processor does with a debit the account's balance can't cover
+type InsufficientFundsMode string
+
+const (
+	// FailOnInsufficientFunds fails the debit straight away
+	FailOnInsufficientFunds InsufficientFundsMode = "fail"
+
+	// RetryOnInsufficientFunds parks the debit and tries it again every retry interval until the wait runs out
+	RetryOnInsufficientFunds InsufficientFundsMode = "retry"
+
+	// ProcessWhenFunded parks the debit until a credit to the account covers it, or the wait runs out
+	ProcessWhenFunded InsufficientFundsMode = "when_funded"
+)
+
+// InsufficientFundsPolicy is how withdrawals and transfers the balance can't cover are handled; the zero value
+// fails them
+type InsufficientFundsPolicy struct {
+	Mode InsufficientFundsMode `json:"mode"`
+
+	// WaitHours is how long a parked debit waits for funds before it fails
+	WaitHours int `json:"wait_hours,omitempty"`
+
+	// RetryIntervalMinutes is how often a debit parked in retry mode is tried again
+	RetryIntervalMinutes int `json:"retry_interval_minutes,omitempty"`
+}
+
+// Parks reports whether debits the balance can't cover wait for funds instead of failing
+func (p InsufficientFundsPolicy) Parks() bool {
+	return p.Mode == RetryOnInsufficientFunds || p.Mode == ProcessWhenFunded
+}
+
+// Wait returns how long a parked debit waits for funds
+func (p InsufficientFundsPolicy) Wait() time.Duration {
+	return time.Duration(p.WaitHours) * time.Hour
+}
+
+// RetryInterval returns how often a debit parked in retry mode is tried again
+func (p InsufficientFundsPolicy) RetryInterval() time.Duration {
+	return time.Duration(p.RetryIntervalMinutes) * time.Minute
+}
+
+// AccountFundingPolicy is the insufficient funds policy applied to an account's debits; Source is "account" for
+// a policy set on the account and "tenant" for the tenant's, which applies when the account has none
+type AccountFundingPolicy struct {
+	AccountID         string                  `json:"account_id" db:"account_id"`
+	InsufficientFunds InsufficientFundsPolicy `json:"insufficient_funds" db:"-"`
+	Source            string                  `json:"source" db:"-"`
+	TenantID          string                  `json:"-" db:"tenant_id"`
+	UpdatedAt         *time.Time              `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// sources of an account's insufficient funds policy
+const (
+	FundingPolicyFromAccount = "account"
+	FundingPolicyFromTenant  = "tenant"
+)
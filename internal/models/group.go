@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// LegRole is what a leg is for in its group
+type LegRole string
+
+const (
+	// LegOriginal is the money movement itself, and the role of legs that don't name one
+	LegOriginal LegRole = "original"
+
+	// LegFee is a fee charged on another leg
+	LegFee LegRole = "fee"
+
+	// LegTax is a tax charged on another leg
+	LegTax LegRole = "tax"
+
+	// LegReversal moves some or all of another leg's amount back the other way
+	LegReversal LegRole = "reversal"
+
+	// LegAdjustment corrects another leg
+	LegAdjustment LegRole = "adjustment"
+)
+
+// TransactionLeg is one part of a multi-leg transaction, such as the payment, its fee or the tax on it
+// every leg but an original names the earlier leg it belongs to in RelatedLeg, counting from 1
+type TransactionLeg struct {
+	AccountID             string            `json:"account_id"`
+	Type                  TransactionType   `json:"type"`
+	Amount                float64           `json:"amount"`
+	CounterpartyAccountID string            `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string            `json:"counterparty_id,omitempty"`
+	Metadata              map[string]string `json:"metadata,omitempty"`
+	Role                  LegRole           `json:"role,omitempty"`
+	RelatedLeg            int               `json:"related_leg,omitempty"`
+}
+
+// represents the request to create a multi-leg transaction; the legs are applied together or not at all
+type TransactionGroupRequest struct {
+	Reference string           `json:"reference,omitempty"`
+	Legs      []TransactionLeg `json:"legs"`
+}
+
+// TransactionGroup rolls up the legs of a multi-leg transaction. Status is completed once every leg is, failed
+// when any leg failed, and otherwise the status of the first leg, which carries the group through processing.
+// NetChanges is how much the group moves each account's balance, fees included, and Totals adds up the legs'
+// amounts by role. Relationships lists for each leg the legs that name it, so a leg's fees, taxes, reversals and
+// adjustments can be read off without walking the list
+type TransactionGroup struct {
+	ID            string                `json:"id"`
+	Reference     string                `json:"reference"`
+	Status        TransactionStatus     `json:"status"`
+	FailureReason string                `json:"failure_reason,omitempty"`
+	Fees          float64               `json:"fees"`
+	NetChanges    map[string]float64    `json:"net_changes"`
+	Totals        map[LegRole]float64   `json:"totals"`
+	Relationships []LegRelationship     `json:"relationships,omitempty"`
+	Legs          []TransactionResponse `json:"legs"`
+	CreatedAt     time.Time             `json:"created_at"`
+	CompletedAt   *time.Time            `json:"completed_at,omitempty"`
+}
+
+// LegRelationship is a leg of a group with the legs related to it, by role
+type LegRelationship struct {
+	Leg     int               `json:"leg"`
+	Related map[LegRole][]int `json:"related"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LiveTopic is what a live subscription streams
+type LiveTopic string
+
+const (
+	// LivePlatform streams platform throughput and queue depths; admin only
+	LivePlatform LiveTopic = "platform"
+
+	// LiveAccount streams an account's balance updates
+	LiveAccount LiveTopic = "account"
+)
+
+// LiveRequest is a message a dashboard sends over the live connection. Type is "auth", "subscribe" or
+// "unsubscribe"; ID names the subscription, chosen by the client, and tags every message sent for it
+type LiveRequest struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id,omitempty"`
+	Topic      LiveTopic `json:"topic,omitempty"`
+	AccountID  string    `json:"account_id,omitempty"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	AdminToken string    `json:"admin_token,omitempty"`
+	Token      string    `json:"token,omitempty"`
+}
+
+// LiveMessage is a message the server sends over the live connection. Type is "ready", "subscribed",
+// "unsubscribed", "event" or "error"
+type LiveMessage struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Topic LiveTopic       `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Code  string          `json:"code,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// PlatformSnapshot is the platform's activity over the interval ending At, and its queue depths at At
+type PlatformSnapshot struct {
+	At                    time.Time   `json:"at"`
+	IntervalSeconds       float64     `json:"interval_seconds"`
+	Created               int64       `json:"created"`
+	Completed             int64       `json:"completed"`
+	Failed                int64       `json:"failed"`
+	TransactionsPerSecond float64     `json:"transactions_per_second"`
+	FailuresPerSecond     float64     `json:"failures_per_second"`
+	AvgLatencyMs          float64     `json:"avg_latency_ms"`
+	Queues                QueueDepths `json:"queues"`
+}
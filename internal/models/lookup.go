@@ -0,0 +1,18 @@
+package models
+
+// LookupRequest asks for many accounts or transactions by id in one call
+type LookupRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// AccountLookupResponse lists the accounts found, in the order asked for, and the ids that matched none
+type AccountLookupResponse struct {
+	Accounts []AccountResponse `json:"accounts"`
+	NotFound []string          `json:"not_found"`
+}
+
+// TransactionLookupResponse lists the transactions found, in the order asked for, and the ids that matched none
+type TransactionLookupResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+	NotFound     []string              `json:"not_found"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// MaintenanceStatus is the system-wide maintenance switch
+// while enabled the API rejects writes and processors stop taking work
+type MaintenanceStatus struct {
+	Enabled   bool       `json:"enabled" db:"enabled"`
+	Message   string     `json:"message,omitempty" db:"message"`
+	StartedAt *time.Time `json:"started_at,omitempty" db:"started_at"`
+	UpdatedBy string     `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to toggle maintenance mode
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
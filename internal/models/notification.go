@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+)
+
+type NotificationEvent string
+
+const (
+	// LargeWithdrawal fires when a completed withdrawal meets the account's large withdrawal threshold
+	LargeWithdrawal NotificationEvent = "large_withdrawal"
+
+	// LowBalance fires when a completed transaction leaves the balance below the account's low balance threshold
+	LowBalance NotificationEvent = "low_balance"
+
+	// TransactionFailed fires when a transaction fails to process
+	TransactionFailed NotificationEvent = "transaction_failed"
+
+	// StatementReady carries a periodic account statement; it is sent per statement preferences, not subscribed to
+	StatementReady NotificationEvent = "statement"
+)
+
+// NotificationPreferences holds where and for which events an account wants to be notified
+type NotificationPreferences struct {
+	AccountID                string              `json:"account_id" db:"account_id"`
+	Email                    string              `json:"email,omitempty" db:"email"`
+	Phone                    string              `json:"phone,omitempty" db:"phone"`
+	WebhookURL               string              `json:"webhook_url,omitempty" db:"webhook_url"`
+	Events                   []NotificationEvent `json:"events" db:"events"`
+	LargeWithdrawalThreshold float64             `json:"large_withdrawal_threshold" db:"large_withdrawal_threshold"`
+	LowBalanceThreshold      float64             `json:"low_balance_threshold" db:"low_balance_threshold"`
+	UpdatedAt                time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+// Subscribed reports whether the account opted in to the event
+func (p *NotificationPreferences) Subscribed(event NotificationEvent) bool {
+	for _, e := range p.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// represents the request to update an account's notification preferences
+type NotificationPreferencesRequest struct {
+	Email                    string              `json:"email,omitempty"`
+	Phone                    string              `json:"phone,omitempty"`
+	WebhookURL               string              `json:"webhook_url,omitempty"`
+	Events                   []NotificationEvent `json:"events"`
+	LargeWithdrawalThreshold float64             `json:"large_withdrawal_threshold" validate:"min=0"`
+	LowBalanceThreshold      float64             `json:"low_balance_threshold" validate:"min=0"`
+}
+
+// Notification is a single message sent to an account holder
+type Notification struct {
+	ID            string            `json:"id"`
+	Event         NotificationEvent `json:"event"`
+	AccountID     string            `json:"account_id"`
+	TransactionID string            `json:"transaction_id,omitempty"`
+	Subject       string            `json:"subject"`
+	Message       string            `json:"message"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// WebhookSubscription sends notification events to a URL, for one account or, without an AccountID, every
+// account of the tenant; EventTypes narrows the catalog event types delivered, all of them when empty
+type WebhookSubscription struct {
+	ID         string    `json:"id" db:"id"`
+	TenantID   string    `json:"-" db:"tenant_id"`
+	AccountID  string    `json:"account_id,omitempty" db:"account_id"`
+	URL        string    `json:"url" db:"url"`
+	EventTypes []string  `json:"event_types" db:"event_types"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Wants reports whether the subscription takes events of the given catalog type
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// represents the request to subscribe a URL to the tenant's or an account's notification events
+type WebhookSubscriptionRequest struct {
+	AccountID  string   `json:"account_id,omitempty"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// Pagination describes where a page sits within a list
+type Pagination struct {
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	NextOffset *int `json:"next_offset,omitempty"`
+	// Total is only reported when the client asks for it with include_total=true
+	Total *int64 `json:"total,omitempty"`
+	// TotalEstimated marks Total as a lower bound because counting stopped early
+	TotalEstimated bool `json:"total_estimated,omitempty"`
+}
+
+// Page is the envelope every list endpoint responds with
+type Page struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// Count is the size of a list; Estimated is set when counting was capped
+type Count struct {
+	Total     int64
+	Estimated bool
+}
+
+// SetTotal records a list count on the pagination
+func (p *Pagination) SetTotal(c Count) {
+	total := c.Total
+	p.Total = &total
+	p.TotalEstimated = c.Estimated
+}
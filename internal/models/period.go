@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PeriodLayout is how accounting periods are written: a calendar month
+const PeriodLayout = "2006-01"
+
+// AccountingPeriod is a month of a tenant's books that has been closed; back-dated transactions can't be posted
+// into it until it is reopened. Months without a row are open
+type AccountingPeriod struct {
+	TenantID string    `json:"tenant_id" db:"tenant_id"`
+	Period   string    `json:"period" db:"period"`
+	ClosedBy string    `json:"closed_by,omitempty" db:"closed_by"`
+	ClosedAt time.Time `json:"closed_at" db:"closed_at"`
+}
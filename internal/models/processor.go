@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// ProcessorHeartbeat is the last report of a transaction processor replica
+type ProcessorHeartbeat struct {
+	ID         string     `json:"id" db:"id"`
+	Hostname   string     `json:"hostname" db:"hostname"`
+	PID        int        `json:"pid" db:"pid"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	InFlight   int        `json:"in_flight" db:"in_flight"`
+	Processed  int64      `json:"processed" db:"processed"`
+	StoppedAt  *time.Time `json:"stopped_at,omitempty" db:"stopped_at"`
+
+	// Status is "active", "stale" (missed its heartbeats) or "stopped" (shut down cleanly)
+	Status string `json:"status"`
+
+	// Stalled flags a stale replica that last reported messages it hadn't acknowledged yet
+	Stalled bool `json:"stalled"`
+}
+
+// processor statuses
+const (
+	ProcessorActive  = "active"
+	ProcessorStale   = "stale"
+	ProcessorStopped = "stopped"
+)
+
+// ConsumerCheckpoint is how far a consumer got through a queue, or through one partition of a Kafka topic. It is
+// saved with the consumer's heartbeat, so lag can be worked out from outside and a restarted consumer knows what
+// it resumes from
+type ConsumerCheckpoint struct {
+	Consumer  string `json:"consumer"`
+	Source    string `json:"source"`
+	Partition int    `json:"partition"`
+
+	// Kafka: the offset of the last message processed, and the partition's high watermark when it was read.
+	// RabbitMQ: the delivery tag of the last message acknowledged, which counts up per channel and starts over
+	// after a reconnect
+	Offset        int64 `json:"offset"`
+	HighWatermark int64 `json:"high_watermark,omitempty"`
+
+	// since the consumer started: messages delivered to it, processed, and delivered again after another
+	// consumer dropped them
+	Delivered   int64 `json:"delivered"`
+	Processed   int64 `json:"processed"`
+	Redelivered int64 `json:"redelivered"`
+
+	LastMessageID string     `json:"last_message_id,omitempty"`
+	LastQueuedAt  *time.Time `json:"last_queued_at,omitempty"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Lag is worked out when checkpoints are listed: for Kafka the messages up to the high watermark, for
+	// RabbitMQ those waiting in the queue, which its consumers share
+	Lag *ConsumerLag `json:"lag,omitempty"`
+}
+
+// ConsumerLag is how far behind a consumer is: messages it has yet to process, and how long the last one it
+// processed had waited
+type ConsumerLag struct {
+	Messages int64   `json:"messages"`
+	Seconds  float64 `json:"seconds"`
+}
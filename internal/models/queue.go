@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// QueueContents is what an operator sees of an inspected queue: its depth and the messages at its head
+type QueueContents struct {
+	Queue    string           `json:"queue"`
+	Depth    int              `json:"depth"`
+	Messages []*QueuedMessage `json:"messages"`
+}
+
+// QueuedMessage is a message waiting in a queue; Transaction is nil when the body doesn't decode as one, and
+// Body holds it instead
+type QueuedMessage struct {
+	MessageID     string       `json:"message_id,omitempty"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+	RoutingKey    string       `json:"routing_key,omitempty"`
+	Timestamp     *time.Time   `json:"timestamp,omitempty"`
+	Reason        string       `json:"reason,omitempty"`
+	From          string       `json:"from,omitempty"`
+	Transaction   *Transaction `json:"transaction,omitempty"`
+	Body          string       `json:"body,omitempty"`
+}
+
+// QueueDepths are the messages waiting in the transaction queue and the queues it sheds into
+type QueueDepths struct {
+	Transactions int `json:"transactions"`
+	DeadLetter   int `json:"dead_letter"`
+	Quarantine   int `json:"quarantine"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Quote is the fee a prospective transaction would be charged, locked until ExpiresAt; a transaction request
+// naming the quote with the same account, type, amount and counterparties is charged that fee. A quote is used by
+// one transaction, identified by its reference
+type Quote struct {
+	ID                    string          `json:"id" db:"id"`
+	TenantID              string          `json:"-" db:"tenant_id"`
+	AccountID             string          `json:"account_id" db:"account_id"`
+	Type                  TransactionType `json:"type" db:"type"`
+	Amount                float64         `json:"amount" db:"amount"`
+	CounterpartyAccountID string          `json:"counterparty_account_id,omitempty" db:"counterparty_account_id"`
+	CounterpartyID        string          `json:"counterparty_id,omitempty" db:"counterparty_id"`
+	Fee                   float64         `json:"fee" db:"fee"`
+	Currency              string          `json:"currency" db:"currency"`
+	UsedByReference       string          `json:"used_by_reference,omitempty" db:"used_by_reference"`
+	CreatedAt             time.Time       `json:"created_at" db:"created_at"`
+	ExpiresAt             time.Time       `json:"expires_at" db:"expires_at"`
+}
+
+// represents the request to quote a prospective transaction
+type QuoteRequest struct {
+	AccountID             string          `json:"account_id" validate:"required"`
+	Type                  TransactionType `json:"type" validate:"required,oneof=deposit withdrawal transfer"`
+	Amount                float64         `json:"amount" validate:"required,gt=0"`
+	CounterpartyAccountID string          `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string          `json:"counterparty_id,omitempty"`
+}
+
+// TransactionRequest returns the transaction request the quote is for
+func (r *QuoteRequest) TransactionRequest() *TransactionRequest {
+	return &TransactionRequest{
+		AccountID:             r.AccountID,
+		Type:                  r.Type,
+		Amount:                r.Amount,
+		CounterpartyAccountID: r.CounterpartyAccountID,
+		CounterpartyID:        r.CounterpartyID,
+	}
+}
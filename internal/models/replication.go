@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// ReplicationRole is what a region does in active-passive replication
+type ReplicationRole string
+
+const (
+	// the region taking writes, processing transactions and publishing its changes to the feed
+	RoleActive ReplicationRole = "active"
+
+	// a warm standby applying the active region's changes; it refuses writes and processes nothing
+	RolePassive ReplicationRole = "passive"
+
+	// a former active region that was superseded, or lost the feed for longer than its lease; like a passive
+	// one it takes no writes, but it doesn't apply changes either until an operator demotes or promotes it
+	RoleFenced ReplicationRole = "fenced"
+)
+
+// Valid reports whether r is a known role
+func (r ReplicationRole) Valid() bool {
+	switch r {
+	case RoleActive, RolePassive, RoleFenced:
+		return true
+	}
+	return false
+}
+
+// ReplicationStatus is a region's replication state; Epoch is the newest promotion it knows of, made by
+// ActiveRegion, and fences off every region promoted before it
+type ReplicationStatus struct {
+	Region       string          `json:"region"`
+	Role         ReplicationRole `json:"role"`
+	Epoch        int64           `json:"epoch"`
+	ActiveRegion string          `json:"active_region,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+
+	// when capture last published, the Postgres transaction id accounts are on the feed up to, and the MongoDB
+	// change stream token transactions are on it up to; only kept by the active region
+	CapturedThrough *time.Time `json:"captured_through,omitempty"`
+	CapturedTxID    *int64     `json:"captured_txid,omitempty"`
+	CaptureToken    []byte     `json:"-"`
+
+	// when the active region was last heard from, and when its last change was applied; only kept by passive ones
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at,omitempty"`
+	LastAppliedAt   *time.Time `json:"last_applied_at,omitempty"`
+
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type RuleKind string
+
+const (
+	// RuleLimit refuses a transaction request when its expression is true
+	RuleLimit RuleKind = "limit"
+
+	// RuleFraud fails a transaction at processing time when its expression is true
+	RuleFraud RuleKind = "fraud"
+
+	// RuleFee adds the number its expression yields to a transaction's fee
+	RuleFee RuleKind = "fee"
+)
+
+// Valid reports whether the rule kind is one the ledger knows
+func (k RuleKind) Valid() bool {
+	switch k {
+	case RuleLimit, RuleFraud, RuleFee:
+		return true
+	}
+	return false
+}
+
+// Rule is a tenant's limit, fraud or fee rule written in the rule expression language
+type Rule struct {
+	ID         string    `json:"id" db:"id"`
+	TenantID   string    `json:"-" db:"tenant_id"`
+	Name       string    `json:"name" db:"name"`
+	Kind       RuleKind  `json:"kind" db:"kind"`
+	Expression string    `json:"expression" db:"expression"`
+	Enabled    bool      `json:"enabled" db:"enabled"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RuleRequest creates a rule or, with empty fields left unchanged, updates one; new rules are enabled by default
+type RuleRequest struct {
+	Name       string   `json:"name"`
+	Kind       RuleKind `json:"kind"`
+	Expression string   `json:"expression"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SandboxClock is the simulated time a sandbox tenant's scheduled work runs on
+type SandboxClock struct {
+	TenantID      string    `json:"tenant_id"`
+	Now           time.Time `json:"now"`
+	OffsetSeconds int64     `json:"offset_seconds"`
+}
+
+// represents the request to move a sandbox clock forward, either by Duration ("36h") or to Until
+type AdvanceClockRequest struct {
+	Duration string     `json:"duration,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+)
+
+type StatementFrequency string
+
+const (
+	// Weekly statements cover Monday to Monday (UTC)
+	Weekly StatementFrequency = "weekly"
+
+	// Monthly statements cover calendar months (UTC)
+	Monthly StatementFrequency = "monthly"
+)
+
+type StatementDeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its first or next send attempt
+	DeliveryPending StatementDeliveryStatus = "pending"
+
+	// DeliverySent was accepted by the mail server
+	DeliverySent StatementDeliveryStatus = "sent"
+
+	// DeliveryFailed ran out of attempts
+	DeliveryFailed StatementDeliveryStatus = "failed"
+)
+
+// StatementPreferences controls whether and where an account's periodic statements are emailed
+type StatementPreferences struct {
+	AccountID string             `json:"account_id" db:"account_id"`
+	Enabled   bool               `json:"enabled" db:"enabled"`
+	Email     string             `json:"email,omitempty" db:"email"`
+	Frequency StatementFrequency `json:"frequency" db:"frequency"`
+	Locale    string             `json:"locale" db:"locale"`
+	NextRunAt *time.Time         `json:"next_run_at,omitempty" db:"next_run_at"`
+	TenantID  string             `json:"-" db:"tenant_id"`
+	UpdatedAt time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to update an account's statement preferences
+type StatementPreferencesRequest struct {
+	Enabled   bool               `json:"enabled"`
+	Email     string             `json:"email,omitempty"`
+	Frequency StatementFrequency `json:"frequency" validate:"omitempty,oneof=weekly monthly"`
+	// Locale is the language statements are written in; Accept-Language is used when it is empty
+	Locale string `json:"locale,omitempty"`
+}
+
+// StatementDelivery is one attempt-tracked statement email
+type StatementDelivery struct {
+	ID            string                  `json:"id" db:"id"`
+	TenantID      string                  `json:"-" db:"tenant_id"`
+	AccountID     string                  `json:"account_id" db:"account_id"`
+	Email         string                  `json:"email" db:"email"`
+	Locale        string                  `json:"locale" db:"locale"`
+	PeriodStart   time.Time               `json:"period_start" db:"period_start"`
+	PeriodEnd     time.Time               `json:"period_end" db:"period_end"`
+	Status        StatementDeliveryStatus `json:"status" db:"status"`
+	Attempts      int                     `json:"attempts" db:"attempts"`
+	LastError     string                  `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt time.Time               `json:"next_attempt_at" db:"next_attempt_at"`
+	SentAt        *time.Time              `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt     time.Time               `json:"created_at" db:"created_at"`
+	// DocumentKey is where the sent statement was archived in object storage, empty when it wasn't
+	DocumentKey string `json:"-" db:"document_key"`
+	Archived    bool   `json:"archived,omitempty" db:"-"`
+}
+
+// Statement is an account's activity over a period with its opening and closing balances
+type Statement struct {
+	AccountID      string           `json:"account_id"`
+	Currency       string           `json:"currency"`
+	PeriodStart    time.Time        `json:"period_start"`
+	PeriodEnd      time.Time        `json:"period_end"`
+	OpeningBalance float64          `json:"opening_balance"`
+	ClosingBalance float64          `json:"closing_balance"`
+	Entries        []StatementEntry `json:"entries"`
+}
+
+// StatementEntry is one line of a statement; Amount is signed from the account's point of view
+type StatementEntry struct {
+	TransactionID string          `json:"transaction_id"`
+	Date          time.Time       `json:"date"`
+	ValueDate     string          `json:"value_date"`
+	Type          TransactionType `json:"type"`
+	Reference     string          `json:"reference"`
+	Amount        float64         `json:"amount"`
+	Balance       float64         `json:"balance"`
+}
+
+// StatementDocument is an archived statement, downloaded from a signed URL or, when the archive is encrypted,
+// as Content; Checksum is its hex SHA-256
+type StatementDocument struct {
+	Filename string
+	URL      string
+	Content  []byte
+	Checksum string
+}
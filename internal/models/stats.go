@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// StatsBucket is how account activity is grouped
+type StatsBucket string
+
+const (
+	// BucketHour groups activity by hour of the day, 00 to 23
+	BucketHour StatsBucket = "hour"
+
+	// BucketDay groups activity by calendar day
+	BucketDay StatsBucket = "day"
+
+	// BucketWeekday groups activity by day of the week, monday to sunday
+	BucketWeekday StatsBucket = "weekday"
+)
+
+// Valid reports whether activity can be grouped by the bucket
+func (b StatsBucket) Valid() bool {
+	switch b {
+	case BucketHour, BucketDay, BucketWeekday:
+		return true
+	}
+	return false
+}
+
+// ActivityBucket is the completed activity of an account within one bucket
+// incoming covers deposits and transfers received; outgoing covers withdrawals, transfers sent and fees
+type ActivityBucket struct {
+	Key           string  `json:"key,omitempty" bson:"_id"`
+	Count         int64   `json:"count" bson:"count"`
+	IncomingCount int64   `json:"incoming_count" bson:"incoming_count"`
+	OutgoingCount int64   `json:"outgoing_count" bson:"outgoing_count"`
+	Incoming      float64 `json:"incoming" bson:"incoming"`
+	Outgoing      float64 `json:"outgoing" bson:"outgoing"`
+}
+
+// AccountStats is an account's activity over [From, To) grouped into buckets in Timezone
+// every bucket of the period is present, with zeros where there was no activity
+type AccountStats struct {
+	AccountID string           `json:"account_id"`
+	Currency  string           `json:"currency"`
+	Bucket    StatsBucket      `json:"bucket"`
+	Timezone  string           `json:"timezone"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Totals    ActivityBucket   `json:"totals"`
+	Buckets   []ActivityBucket `json:"buckets"`
+}
+
+// PlatformMinute is the platform-wide transaction throughput of one minute, kept for capacity planning
+// failures are counted in the minute the transaction was last updated
+type PlatformMinute struct {
+	Minute         time.Time `bson:"_id"`
+	Created        int64     `bson:"created"`
+	Completed      int64     `bson:"completed"`
+	Failed         int64     `bson:"failed"`
+	LatencyMsTotal int64     `bson:"latency_ms_total"`
+	RecordedAt     time.Time `bson:"recorded_at"`
+}
+
+// PlatformStatsPoint is the throughput over one step of the platform stats history
+// Minutes is how many recorded minutes the step holds, so gaps in recording show up
+type PlatformStatsPoint struct {
+	At             time.Time `json:"at" bson:"_id"`
+	Minutes        int64     `json:"minutes" bson:"minutes"`
+	Created        int64     `json:"created" bson:"created"`
+	Completed      int64     `json:"completed" bson:"completed"`
+	Failed         int64     `json:"failed" bson:"failed"`
+	AvgLatencyMs   float64   `json:"avg_latency_ms" bson:"-"`
+	LatencyMsTotal int64     `json:"-" bson:"latency_ms_total"`
+}
+
+// PlatformStatsHistory is the platform throughput over [From, To) in steps of Step
+type PlatformStatsHistory struct {
+	From   time.Time            `json:"from"`
+	To     time.Time            `json:"to"`
+	Step   string               `json:"step"`
+	Points []PlatformStatsPoint `json:"points"`
+}
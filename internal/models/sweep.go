@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// SweepRule keeps an account's balance between a floor and a target by moving money
+// to and from a designated account
+type SweepRule struct {
+	ID              string    `json:"id" db:"id"`
+	TenantID        string    `json:"-" db:"tenant_id"`
+	AccountID       string    `json:"account_id" db:"account_id"`
+	TargetAccountID string    `json:"target_account_id" db:"target_account_id"`
+	TargetBalance   float64   `json:"target_balance" db:"target_balance"`
+	FloorBalance    *float64  `json:"floor_balance,omitempty" db:"floor_balance"`
+	Enabled         bool      `json:"enabled" db:"enabled"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to create a sweep rule
+type SweepRuleRequest struct {
+	TargetAccountID string   `json:"target_account_id" validate:"required"`
+	TargetBalance   float64  `json:"target_balance" validate:"min=0"`
+	FloorBalance    *float64 `json:"floor_balance,omitempty" validate:"omitempty,min=0"`
+}
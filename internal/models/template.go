@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// TransactionTemplate is a saved transaction on an account that can be executed again in one call, for repeat
+// payments; the memo and category are sent as transaction metadata
+type TransactionTemplate struct {
+	ID                    string          `json:"id" db:"id"`
+	TenantID              string          `json:"-" db:"tenant_id"`
+	AccountID             string          `json:"account_id" db:"account_id"`
+	Name                  string          `json:"name" db:"name"`
+	Type                  TransactionType `json:"type" db:"type"`
+	Amount                float64         `json:"amount" db:"amount"`
+	Memo                  string          `json:"memo,omitempty" db:"memo"`
+	Category              string          `json:"category,omitempty" db:"category"`
+	CounterpartyAccountID string          `json:"counterparty_account_id,omitempty" db:"counterparty_account_id"`
+	CounterpartyID        string          `json:"counterparty_id,omitempty" db:"counterparty_id"`
+	CreatedAt             time.Time       `json:"created_at" db:"created_at"`
+}
+
+// represents the request to save a transaction template on an account
+type TransactionTemplateRequest struct {
+	Name                  string          `json:"name" validate:"required"`
+	Type                  TransactionType `json:"type" validate:"required,oneof=deposit withdrawal transfer"`
+	Amount                float64         `json:"amount" validate:"required,gt=0"`
+	Memo                  string          `json:"memo,omitempty"`
+	Category              string          `json:"category,omitempty"`
+	CounterpartyAccountID string          `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string          `json:"counterparty_id,omitempty"`
+}
+
+// represents the request to execute a template; Amount overrides the template's for this execution only
+type ExecuteTemplateRequest struct {
+	Amount    *float64 `json:"amount,omitempty" validate:"omitempty,gt=0"`
+	Reference string   `json:"reference,omitempty"`
+}
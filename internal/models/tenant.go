@@ -0,0 +1,175 @@
+package models
+
+import (
+	"net"
+	"time"
+)
+
+// APIKey authenticates an integration as one tenant; only the key's hash is stored
+// sandbox keys act on the tenant's isolated sandbox data instead of its real accounts
+// keys with a reference namespace only see the transaction references created under the same namespace
+// keys allowed to back-date may post transactions with a past posting_date
+// keys with amount limits can't move more than them, whatever the tenant's limits allow
+type APIKey struct {
+	KeyHash              string    `json:"-" db:"key_hash"`
+	TenantID             string    `json:"tenant_id" db:"tenant_id"`
+	Name                 string    `json:"name" db:"name"`
+	Sandbox              bool      `json:"sandbox" db:"sandbox"`
+	ReferenceNamespace   string    `json:"reference_namespace,omitempty" db:"reference_namespace"`
+	BackDating           bool      `json:"back_dating,omitempty" db:"back_dating"`
+	MaxTransactionAmount float64   `json:"max_transaction_amount,omitempty" db:"max_transaction_amount"`
+	MaxDailyAmount       float64   `json:"max_daily_amount,omitempty" db:"max_daily_amount"`
+	CreatedAt            time.Time `json:"created_at" db:"created_at"`
+}
+
+// represents the request to issue an API key for a tenant
+type CreateAPIKeyRequest struct {
+	Name               string `json:"name"`
+	Sandbox            bool   `json:"sandbox,omitempty"`
+	ReferenceNamespace string `json:"reference_namespace,omitempty"`
+	BackDating         bool   `json:"back_dating,omitempty"`
+
+	// MaxTransactionAmount bounds each transaction the key posts, MaxDailyAmount the total it posts out of
+	// accounts per UTC day; zero means no bound
+	MaxTransactionAmount float64 `json:"max_transaction_amount,omitempty"`
+	MaxDailyAmount       float64 `json:"max_daily_amount,omitempty"`
+}
+
+// represents the response to issuing an API key; Key is only ever shown once
+type APIKeyResponse struct {
+	Key                  string    `json:"key"`
+	TenantID             string    `json:"tenant_id"`
+	Name                 string    `json:"name"`
+	Sandbox              bool      `json:"sandbox"`
+	ReferenceNamespace   string    `json:"reference_namespace,omitempty"`
+	BackDating           bool      `json:"back_dating,omitempty"`
+	MaxTransactionAmount float64   `json:"max_transaction_amount,omitempty"`
+	MaxDailyAmount       float64   `json:"max_daily_amount,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// FeeRule is the fee charged for one transaction type: Flat plus Percent of the amount
+type FeeRule struct {
+	Flat    float64 `json:"flat"`
+	Percent float64 `json:"percent"`
+}
+
+// TenantSettings holds the per-tenant policy applied to accounts and transactions
+// zero values mean "no restriction"
+type TenantSettings struct {
+	TenantID             string                      `json:"tenant_id" db:"tenant_id"`
+	AllowedCurrencies    []string                    `json:"allowed_currencies" db:"allowed_currencies"`
+	MaxTransactionAmount float64                     `json:"max_transaction_amount" db:"max_transaction_amount"`
+	MaxDailyAmount       float64                     `json:"max_daily_amount" db:"max_daily_amount"`
+	Fees                 map[TransactionType]FeeRule `json:"fees" db:"fees"`
+	WebhookEndpoints     []string                    `json:"webhook_endpoints" db:"webhook_endpoints"`
+	KYCRequired          []TransactionType           `json:"kyc_required" db:"kyc_required"`
+	ValueDateCutoff      string                      `json:"value_date_cutoff,omitempty" db:"value_date_cutoff"`
+	Timezone             string                      `json:"timezone,omitempty" db:"timezone"`
+	IPAllowlist          []string                    `json:"ip_allowlist" db:"ip_allowlist"`
+	InsufficientFunds    InsufficientFundsPolicy     `json:"insufficient_funds" db:"insufficient_funds"`
+	UpdatedAt            time.Time                   `json:"updated_at" db:"updated_at"`
+}
+
+// AllowsCurrency reports whether accounts may be opened in the currency
+func (s *TenantSettings) AllowsCurrency(currency string) bool {
+	if len(s.AllowedCurrencies) == 0 {
+		return true
+	}
+	for _, c := range s.AllowedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAddress reports whether the tenant's credentials may be used from ip
+func (s *TenantSettings) AllowsAddress(ip string) bool {
+	if len(s.IPAllowlist) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range s.IPAllowlist {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresKYC reports whether transactions of the given type need a verified account
+func (s *TenantSettings) RequiresKYC(txType TransactionType) bool {
+	for _, t := range s.KYCRequired {
+		if t == txType {
+			return true
+		}
+	}
+	return false
+}
+
+// represents the request to replace a tenant's settings
+type TenantSettingsRequest struct {
+	AllowedCurrencies    []string                    `json:"allowed_currencies"`
+	MaxTransactionAmount float64                     `json:"max_transaction_amount" validate:"min=0"`
+	MaxDailyAmount       float64                     `json:"max_daily_amount" validate:"min=0"`
+	Fees                 map[TransactionType]FeeRule `json:"fees"`
+	WebhookEndpoints     []string                    `json:"webhook_endpoints"`
+
+	// KYCRequired lists the transaction types that are refused until the account is verified
+	KYCRequired []TransactionType `json:"kyc_required"`
+
+	// ValueDateCutoff is the time of day, HH:MM in Timezone, from which transactions take the next business day's
+	// value date; empty means none. Timezone is an IANA name and defaults to UTC
+	ValueDateCutoff string `json:"value_date_cutoff,omitempty"`
+	Timezone        string `json:"timezone,omitempty"`
+
+	// IPAllowlist lists the addresses and CIDR ranges the tenant's credentials may be used from; empty means any
+	IPAllowlist []string `json:"ip_allowlist"`
+
+	// InsufficientFunds is what happens to withdrawals and transfers the balance can't cover, unless the account
+	// has a policy of its own; the default fails them
+	InsufficientFunds InsufficientFundsPolicy `json:"insufficient_funds"`
+}
+
+// WebhookSecret signs the webhooks sent for a tenant; several may be active while a rotation is in progress
+// the secret itself is only returned when it is created
+type WebhookSecret struct {
+	ID        string     `json:"id" db:"id"`
+	TenantID  string     `json:"tenant_id" db:"tenant_id"`
+	Secret    string     `json:"secret,omitempty" db:"secret"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// represents the request to rotate a tenant's webhook secret
+type RotateWebhookSecretRequest struct {
+	// GracePeriod is how long the previous secrets keep signing, e.g. "24h"; defaults to 24h
+	GracePeriod string `json:"grace_period,omitempty"`
+}
+
+// TenantBranding customises the documents rendered for a tenant's accounts
+// empty templates fall back to the built-in ones
+type TenantBranding struct {
+	TenantID          string    `json:"tenant_id" db:"tenant_id"`
+	Name              string    `json:"name" db:"name"`
+	LogoURL           string    `json:"logo_url,omitempty" db:"logo_url"`
+	Color             string    `json:"color,omitempty" db:"color"`
+	Footer            string    `json:"footer,omitempty" db:"footer"`
+	StatementTemplate string    `json:"statement_template,omitempty" db:"statement_template"`
+	ReceiptTemplate   string    `json:"receipt_template,omitempty" db:"receipt_template"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// represents the request to replace a tenant's branding
+type TenantBrandingRequest struct {
+	Name              string `json:"name"`
+	LogoURL           string `json:"logo_url,omitempty"`
+	Color             string `json:"color,omitempty"`
+	Footer            string `json:"footer,omitempty"`
+	StatementTemplate string `json:"statement_template,omitempty"`
+	ReceiptTemplate   string `json:"receipt_template,omitempty"`
+}
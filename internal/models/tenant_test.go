@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestAllowsAddress(t *testing.T) {
+	settings := &TenantSettings{IPAllowlist: []string{"203.0.113.0/24", "198.51.100.7/32", "2001:db8:1::/48"}}
+	tests := []struct {
+		ip string
+		ok bool
+	}{
+		{"203.0.113.1", true},
+		{"203.0.113.255", true},
+		{"203.0.114.1", false},
+		{"198.51.100.7", true},
+		{"198.51.100.8", false},
+		{"2001:db8:1:ffff::1", true},
+		{"2001:db8:2::1", false},
+		// an IPv4 client reaching a dual-stack listener shows up IPv4-mapped
+		{"::ffff:203.0.113.9", true},
+		{"::ffff:10.0.0.1", false},
+		{"", false},
+		{"not an ip", false},
+		{"203.0.113.1:443", false},
+	}
+	for _, tt := range tests {
+		if got := settings.AllowsAddress(tt.ip); got != tt.ok {
+			t.Errorf("AllowsAddress(%q) = %v, want %v", tt.ip, got, tt.ok)
+		}
+	}
+
+	open := &TenantSettings{}
+	if !open.AllowsAddress("10.0.0.1") || !open.AllowsAddress("") {
+		t.Error("an empty allowlist must allow every address")
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// TimelineEvent is one recorded step in a transaction's lifecycle
+type TimelineEvent struct {
+	Event  string            `json:"event" bson:"event"`
+	Status TransactionStatus `json:"status" bson:"status"`
+	At     time.Time         `json:"at" bson:"at"`
+
+	// Component names the part of the ledger that recorded the step, e.g. "processor/ledger-7d9f"
+	Component string `json:"component,omitempty" bson:"component,omitempty"`
+
+	// Actor is the caller behind the step when it came from an API request
+	Actor  string `json:"actor,omitempty" bson:"actor,omitempty"`
+	Detail string `json:"detail,omitempty" bson:"detail,omitempty"`
+}
+
+// timeline events, roughly in the order a transaction goes through them
+const (
+	TimelineAccepted       = "accepted"
+	TimelineFlagged        = "flagged"
+	TimelineApproved       = "approved"
+	TimelineRejected       = "rejected"
+	TimelineQueued         = "queued"
+	TimelinePickedUp       = "picked_up"
+	TimelineAttemptFailed  = "attempt_failed"
+	TimelineRetried        = "retried"
+	TimelineHeld           = "held"
+	TimelineReleased       = "released"
+	TimelineInReview       = "in_review"
+	TimelineCleared        = "cleared"
+	TimelineBlocked        = "blocked"
+	TimelineAwaitingFunds  = "awaiting_funds"
+	TimelineBalanceApplied = "balance_applied"
+	TimelineCompleted      = "completed"
+	TimelineFailed         = "failed"
+	TimelineExpired        = "expired"
+	TimelineSuspended      = "suspended"
+	TimelineReassigned     = "reassigned"
+	TimelineRefunded       = "refunded"
+)
+
+// TransactionTimeline is the lifecycle of a transaction, oldest step first
+type TransactionTimeline struct {
+	TransactionID string            `json:"transaction_id"`
+	Status        TransactionStatus `json:"status"`
+	Events        []TimelineEvent   `json:"events"`
+}
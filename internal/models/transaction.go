@@ -12,8 +12,21 @@ const (
 
 	// Withdrawal represents a withdrawal transaction
 	Withdrawal TransactionType = "withdrawal"
+
+	// Transfer moves money from AccountID to CounterpartyAccountID atomically
+	Transfer TransactionType = "transfer"
+
+	// Opening records the initial balance an account was created with; it is written by the ledger, never submitted
+	Opening TransactionType = "opening"
 )
 
+// OpeningReference is the reference of an account's opening transaction, in LedgerNamespace
+const OpeningReference = "opening"
+
+// LedgerNamespace is the reference namespace of transactions the ledger writes itself; it can't be given to an API
+// key or token, so their references never collide with a caller's
+const LedgerNamespace = "_ledger"
+
 type TransactionStatus string
 
 const (
@@ -25,38 +38,269 @@ const (
 
 	// Failed indicates the transaction failed to process
 	Failed TransactionStatus = "failed"
+
+	// Flagged indicates a suspected duplicate held for review; it is not processed until approved
+	Flagged TransactionStatus = "flagged"
+
+	// Held indicates a transaction parked because its account is paused; it is queued again on resume
+	Held TransactionStatus = "held"
+
+	// InReview indicates a screening hit parked for the compliance team; it is not processed until cleared
+	InReview TransactionStatus = "in_review"
+
+	// Suspended indicates a deposit that couldn't be applied; its funds wait in the suspense account on an open exception
+	Suspended TransactionStatus = "suspended"
+
+	// AwaitingFunds indicates a debit the balance couldn't cover, parked by the account's insufficient funds policy
+	// until it is covered or its funding deadline passes
+	AwaitingFunds TransactionStatus = "awaiting_funds"
+)
+
+const (
+	// ReasonExpired is the failure reason of a transaction that wasn't processed within the processing SLA
+	ReasonExpired = "expired"
+
+	// ReasonDuplicate is the failure reason of a flagged transaction rejected as a duplicate
+	ReasonDuplicate = "duplicate"
+
+	// ReasonScreeningBlocked is the failure reason of a screened transaction blocked by compliance
+	ReasonScreeningBlocked = "blocked by compliance screening"
 )
 
+// TransactionSortField is a field transaction history can be ordered by
+type TransactionSortField string
+
+const (
+	// SortByCreatedAt orders transactions by when they were submitted
+	SortByCreatedAt TransactionSortField = "created_at"
+
+	// SortByAmount orders transactions by their amount
+	SortByAmount TransactionSortField = "amount"
+)
+
+// Valid reports whether transaction history can be sorted by the field
+func (f TransactionSortField) Valid() bool {
+	switch f {
+	case SortByCreatedAt, SortByAmount:
+		return true
+	}
+	return false
+}
+
+// TransactionSort orders transaction history; the zero value is newest first
+type TransactionSort struct {
+	Field     TransactionSortField
+	Ascending bool
+}
+
+// TransactionSearch filters transactions across accounts for support investigations; zero fields match everything
+type TransactionSearch struct {
+	TenantID string
+	// AccountID matches transactions on either side of the account
+	AccountID       string
+	CounterpartyID  string
+	Statuses        []TransactionStatus
+	Types           []TransactionType
+	MinAmount       *float64
+	MaxAmount       *float64
+	From            *time.Time
+	To              *time.Time
+	ReferencePrefix string
+	// BackDated only matches transactions posted with a past posting date
+	BackDated bool
+}
+
 // Transaction represents a financial transaction
 type Transaction struct {
-	ID            string            `json:"id" bson:"_id"`
-	AccountID     string            `json:"account_id" bson:"account_id"`
-	Type          TransactionType   `json:"type" bson:"type"`
-	Amount        float64           `json:"amount" bson:"amount"`
-	Status        TransactionStatus `json:"status" bson:"status"`
-	Reference     string            `json:"reference" bson:"reference"`
-	BalanceBefore float64           `json:"balance_before,omitempty" bson:"balance_before,omitempty"`
-	BalanceAfter  float64           `json:"balance_after,omitempty" bson:"balance_after,omitempty"`
-	CreatedAt     time.Time         `json:"created_at" bson:"created_at"`
-	UpdatedAt     time.Time         `json:"updated_at" bson:"updated_at"`
+	ID                    string            `json:"id" bson:"_id"`
+	TenantID              string            `json:"tenant_id,omitempty" bson:"tenant_id"`
+	AccountID             string            `json:"account_id" bson:"account_id"`
+	Type                  TransactionType   `json:"type" bson:"type"`
+	Amount                float64           `json:"amount" bson:"amount"`
+	Fee                   float64           `json:"fee,omitempty" bson:"fee,omitempty"`
+	Status                TransactionStatus `json:"status" bson:"status"`
+	FailureReason         string            `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	Reference             string            `json:"reference" bson:"reference"`
+	ReferenceNamespace    string            `json:"reference_namespace,omitempty" bson:"reference_namespace,omitempty"`
+	CounterpartyAccountID string            `json:"counterparty_account_id,omitempty" bson:"counterparty_account_id,omitempty"`
+	CounterpartyID        string            `json:"counterparty_id,omitempty" bson:"counterparty_id,omitempty"`
+	Metadata              map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	DuplicateOf           string            `json:"duplicate_of,omitempty" bson:"duplicate_of,omitempty"`
+	CreditExpiresAt       *time.Time        `json:"credit_expires_at,omitempty" bson:"credit_expires_at,omitempty"`
+	ValueDate             *time.Time        `json:"value_date,omitempty" bson:"value_date,omitempty"`
+	BackDated             bool              `json:"back_dated,omitempty" bson:"back_dated,omitempty"`
+	QuoteID               string            `json:"quote_id,omitempty" bson:"quote_id,omitempty"`
+	GroupID               string            `json:"group_id,omitempty" bson:"group_id,omitempty"`
+	Leg                   int               `json:"leg,omitempty" bson:"leg,omitempty"`
+	LegRole               LegRole           `json:"leg_role,omitempty" bson:"leg_role,omitempty"`
+	RelatedLeg            int               `json:"related_leg,omitempty" bson:"related_leg,omitempty"`
+	BalanceBefore         float64           `json:"balance_before,omitempty" bson:"balance_before,omitempty"`
+	BalanceAfter          float64           `json:"balance_after,omitempty" bson:"balance_after,omitempty"`
+	Enrichment            *Enrichment       `json:"enrichment,omitempty" bson:"enrichment,omitempty"`
+	Screening             *ScreeningResult  `json:"screening,omitempty" bson:"screening,omitempty"`
+	Timeline              []TimelineEvent   `json:"-" bson:"timeline,omitempty"`
+	ProcessingStartedAt   *time.Time        `json:"processing_started_at,omitempty" bson:"processing_started_at,omitempty"`
+	RequestID             string            `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	CreatedAt             time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at" bson:"updated_at"`
+	CompletedAt           *time.Time        `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+
+	// Attempts counts failed processing attempts; NextRetryAt is only set while another attempt is scheduled,
+	// so a pending transaction with attempts and no next_retry_at is stuck rather than retrying
+	Attempts      int        `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty" bson:"next_retry_at,omitempty"`
+
+	// FundingMode and FundingDeadline are set once a debit waits for funds: it fails with insufficient funds if
+	// it still can't be covered by the deadline. A debit retried on a schedule has NextRetryAt set while parked.
+	// A withdrawal with RetryOnFunding waits for a deposit whatever the policy, its deadline set when accepted
+	FundingMode     InsufficientFundsMode `json:"funding_mode,omitempty" bson:"funding_mode,omitempty"`
+	FundingDeadline *time.Time            `json:"funding_deadline,omitempty" bson:"funding_deadline,omitempty"`
+	RetryOnFunding  bool                  `json:"retry_on_funding,omitempty" bson:"retry_on_funding,omitempty"`
+}
+
+// Enrichment holds descriptive data attached to a completed transaction by an enrichment provider
+type Enrichment struct {
+	MerchantName string `json:"merchant_name,omitempty" bson:"merchant_name,omitempty"`
+	Category     string `json:"category,omitempty" bson:"category,omitempty"`
+	Location     string `json:"location,omitempty" bson:"location,omitempty"`
+}
+
+// ScreeningResult is the outcome of a sanctions/AML screening, kept on the transaction for the compliance team
+type ScreeningResult struct {
+	Hit       bool             `json:"hit" bson:"hit"`
+	Provider  string           `json:"provider,omitempty" bson:"provider,omitempty"`
+	Score     float64          `json:"score,omitempty" bson:"score,omitempty"`
+	Matches   []ScreeningMatch `json:"matches,omitempty" bson:"matches,omitempty"`
+	Error     string           `json:"error,omitempty" bson:"error,omitempty"`
+	CheckedAt time.Time        `json:"checked_at" bson:"checked_at"`
+
+	// set when compliance resolves the review
+	Decision   string     `json:"decision,omitempty" bson:"decision,omitempty"`
+	ReviewedBy string     `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	Note       string     `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+const (
+	// ScreeningCleared releases a reviewed transaction for processing
+	ScreeningCleared = "cleared"
+
+	// ScreeningBlocked fails a reviewed transaction
+	ScreeningBlocked = "blocked"
+)
+
+// ScreeningMatch is one watchlist entry a transaction matched
+type ScreeningMatch struct {
+	List  string  `json:"list" bson:"list"`
+	Name  string  `json:"name" bson:"name"`
+	Score float64 `json:"score,omitempty" bson:"score,omitempty"`
+}
+
+// represents a compliance decision on a transaction in review
+type ScreeningReviewRequest struct {
+	Note string `json:"note,omitempty"`
 }
 
 // represents the request to creation of a new transaction
 type TransactionRequest struct {
-	AccountID string          `json:"account_id" validate:"required"`
-	Type      TransactionType `json:"type" validate:"required,oneof=deposit withdrawal"`
-	Amount    float64         `json:"amount" validate:"required,gt=0"`
-	Reference string          `json:"reference,omitempty"`
+	AccountID             string            `json:"account_id" validate:"required"`
+	Type                  TransactionType   `json:"type" validate:"required,oneof=deposit withdrawal transfer"`
+	Amount                float64           `json:"amount" validate:"required,gt=0"`
+	Reference             string            `json:"reference,omitempty"`
+	CounterpartyAccountID string            `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string            `json:"counterparty_id,omitempty"`
+	Metadata              map[string]string `json:"metadata,omitempty"`
+	AllowDuplicate        bool              `json:"allow_duplicate,omitempty"`
+
+	// PostingDate, YYYY-MM-DD, sets the value date instead of the day the transaction is accepted. Past dates need
+	// a caller allowed to back-date and an open accounting period; future ones are limited to the posting horizon
+	PostingDate string `json:"posting_date,omitempty"`
+
+	// QuoteID charges the fee of an unexpired, unused quote for the same transaction instead of the current one
+	QuoteID string `json:"quote_id,omitempty"`
+
+	// RetryOnFunding makes a withdrawal the balance can't cover wait for a deposit to the account that covers it
+	// instead of failing, until FundingDeadline; the deadline defaults to 24 hours after the withdrawal is accepted
+	RetryOnFunding  bool       `json:"retry_on_funding,omitempty"`
+	FundingDeadline *time.Time `json:"funding_deadline,omitempty"`
+
+	// CreditExpiresAt makes a deposit a promotional credit; set by the credits endpoint
+	CreditExpiresAt *time.Time `json:"-"`
+
+	// System is set by ledger services moving money through system accounts;
+	// it skips tenant fees, limits and duplicate checks and can't be set over the API
+	System bool `json:"-"`
+}
+
+// TransactionSimulation is what a transaction request would do, worked out without storing or queueing anything
+// Status is the status the transaction would end in: completed, failed with FailureReason, flagged as a duplicate
+// of DuplicateOf, held because an account is paused, or awaiting funds under the insufficient funds policy.
+// ReplayOf is set when the reference was already used for the same transaction, which would be returned instead.
+// PendingDebits are the account's withdrawals and transfers queued or awaiting funds, which are applied first
+type TransactionSimulation struct {
+	Status                   TransactionStatus `json:"status"`
+	FailureReason            string            `json:"failure_reason,omitempty"`
+	DuplicateOf              string            `json:"duplicate_of,omitempty"`
+	ReplayOf                 string            `json:"replay_of,omitempty"`
+	Amount                   float64           `json:"amount"`
+	Fee                      float64           `json:"fee"`
+	ValueDate                string            `json:"value_date,omitempty"`
+	BackDated                bool              `json:"back_dated,omitempty"`
+	BalanceBefore            float64           `json:"balance_before"`
+	PendingDebits            float64           `json:"pending_debits,omitempty"`
+	BalanceAfter             float64           `json:"balance_after"`
+	CounterpartyBalanceAfter *float64          `json:"counterparty_balance_after,omitempty"`
 }
 
 // represents the API response for transaction data
 type TransactionResponse struct {
-	ID            string            `json:"id"`
-	AccountID     string            `json:"account_id"`
-	Type          TransactionType   `json:"type"`
-	Amount        float64           `json:"amount"`
-	Status        TransactionStatus `json:"status"`
-	BalanceBefore float64           `json:"balance_before,omitempty"`
-	BalanceAfter  float64           `json:"balance_after,omitempty"`
-	CreatedAt     time.Time         `json:"created_at"`
+	ID                    string            `json:"id"`
+	AccountID             string            `json:"account_id"`
+	Type                  TransactionType   `json:"type"`
+	Amount                float64           `json:"amount"`
+	Fee                   float64           `json:"fee,omitempty"`
+	Status                TransactionStatus `json:"status"`
+	FailureReason         string            `json:"failure_reason,omitempty"`
+	CounterpartyAccountID string            `json:"counterparty_account_id,omitempty"`
+	CounterpartyID        string            `json:"counterparty_id,omitempty"`
+	Metadata              map[string]string `json:"metadata,omitempty"`
+	DuplicateOf           string            `json:"duplicate_of,omitempty"`
+	CreditExpiresAt       *time.Time        `json:"credit_expires_at,omitempty"`
+	ValueDate             string            `json:"value_date,omitempty"`
+	BackDated             bool              `json:"back_dated,omitempty"`
+	QuoteID               string            `json:"quote_id,omitempty"`
+	GroupID               string            `json:"group_id,omitempty"`
+	Leg                   int               `json:"leg,omitempty"`
+	LegRole               LegRole           `json:"leg_role,omitempty"`
+	RelatedLeg            int               `json:"related_leg,omitempty"`
+	BalanceBefore         float64           `json:"balance_before,omitempty"`
+	BalanceAfter          float64           `json:"balance_after,omitempty"`
+	Enrichment            *Enrichment       `json:"enrichment,omitempty"`
+	CreatedAt             time.Time         `json:"created_at"`
+	CompletedAt           *time.Time        `json:"completed_at,omitempty"`
+
+	// FundingDeadline is when a transaction awaiting funds fails if they haven't arrived
+	FundingMode     InsufficientFundsMode `json:"funding_mode,omitempty"`
+	FundingDeadline *time.Time            `json:"funding_deadline,omitempty"`
+	RetryOnFunding  bool                  `json:"retry_on_funding,omitempty"`
+
+	// Display formats the money fields above, keyed by field name, when the client asks with display=true
+	Display map[string]MoneyDisplay `json:"display,omitempty"`
+}
+
+// SLOReport summarises end-to-end processing latency, from creation to completion, over a window
+type SLOReport struct {
+	TenantID    string  `json:"tenant_id,omitempty"`
+	Window      string  `json:"window"`
+	SLASeconds  float64 `json:"sla_seconds"`
+	Completed   int64   `json:"completed"`
+	P50Seconds  float64 `json:"p50_seconds"`
+	P95Seconds  float64 `json:"p95_seconds"`
+	P99Seconds  float64 `json:"p99_seconds"`
+	Late        int64   `json:"late"`
+	Expired     int64   `json:"expired"`
+	SLABreaches int64   `json:"sla_breaches"`
+	Attainment  float64 `json:"attainment"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// AccountVerification is the result of replaying an account's completed transactions against its stored balance
+type AccountVerification struct {
+	AccountID string `json:"account_id"`
+	Currency  string `json:"currency"`
+	Passed    bool   `json:"passed"`
+
+	// StoredBalance is the balance in Postgres; RecomputedBalance is OpeningBalance plus every completed transaction
+	StoredBalance     float64 `json:"stored_balance"`
+	RecomputedBalance float64 `json:"recomputed_balance"`
+
+	// OpeningBalance is taken from the first transaction that recorded its balance_before
+	// when no transaction did (Anchored is false) it is implied from the stored balance, so only the chain is checked
+	OpeningBalance float64 `json:"opening_balance"`
+	Anchored       bool    `json:"anchored"`
+
+	TransactionsChecked int            `json:"transactions_checked"`
+	FirstDivergence     *Divergence    `json:"first_divergence,omitempty"`
+	Activity            AccountSummary `json:"activity"`
+	CheckedAt           time.Time      `json:"checked_at"`
+}
+
+// Divergence is the first point where an account's transaction chain stops adding up
+// TransactionID is empty when the chain is intact but ends away from the stored balance
+type Divergence struct {
+	TransactionID string     `json:"transaction_id,omitempty"`
+	Reference     string     `json:"reference,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	Expected      float64    `json:"expected"`
+	Recorded      float64    `json:"recorded"`
+	Reason        string     `json:"reason"`
+}
+
+// AccountReference is an account id that transactions point at, with how many of them do
+type AccountReference struct {
+	TenantID     string `json:"tenant_id" bson:"tenant_id"`
+	AccountID    string `json:"account_id" bson:"account_id"`
+	Transactions int64  `json:"transactions" bson:"transactions"`
+	Pending      int64  `json:"pending" bson:"pending"`
+}
@@ -0,0 +1,87 @@
+package money
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// numberFormat is how a locale writes amounts
+type numberFormat struct {
+	decimal string
+	group   string
+	// symbolAfter puts the symbol after the number, separated by a no-break space
+	symbolAfter bool
+}
+
+// number formats keyed by locale; locales missing here are written the English way
+var numberFormats = map[string]numberFormat{
+	"en": {decimal: ".", group: ","},
+	"de": {decimal: ",", group: ".", symbolAfter: true},
+	"es": {decimal: ",", group: ".", symbolAfter: true},
+	// French groups thousands with a narrow no-break space
+	"fr": {decimal: ",", group: "\u202f", symbolAfter: true},
+}
+
+// symbols of the more common currencies; any other currency is shown by its code
+var symbols = map[string]string{
+	"AUD": "A$", "BRL": "R$", "CAD": "CA$", "CHF": "CHF", "CNY": "CN¥", "EUR": "€", "GBP": "£",
+	"HKD": "HK$", "ILS": "₪", "INR": "₹", "JPY": "¥", "KRW": "₩", "MXN": "MX$", "NGN": "₦",
+	"NZD": "NZ$", "PHP": "₱", "PLN": "zł", "THB": "฿", "TRY": "₺", "UAH": "₴", "USD": "$",
+	"VND": "₫", "ZAR": "R",
+}
+
+// Symbol returns the symbol a currency is shown with, or its code when it has none
+func Symbol(currency string) string {
+	currency = strings.ToUpper(currency)
+	if s, ok := symbols[currency]; ok {
+		return s
+	}
+	return currency
+}
+
+// Plain writes amount with the currency's number of decimals and no symbol or grouping, e.g. "1234.50"
+func Plain(amount float64, currency string) string {
+	return strconv.FormatFloat(amount, 'f', Exponent(currency), 64)
+}
+
+// Format writes amount the way locale writes money, with the currency's symbol and number of decimals,
+// e.g. "$1,234.50" in en and "1.234,50 €" in de
+func Format(amount float64, currency, locale string) string {
+	format, ok := numberFormats[locale]
+	if !ok {
+		format = numberFormats["en"]
+	}
+	exp := Exponent(currency)
+
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', exp, 64)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	if amount < 0 && strings.Trim(digits, "0.") != "" {
+		b.WriteString("-")
+	}
+	symbol := Symbol(currency)
+	if !format.symbolAfter {
+		b.WriteString(symbol)
+		// codes used as symbols read better apart from the number
+		if symbol == strings.ToUpper(currency) {
+			b.WriteString("\u00a0")
+		}
+	}
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(format.group)
+		}
+		b.WriteRune(d)
+	}
+	if fraction != "" {
+		b.WriteString(format.decimal)
+		b.WriteString(fraction)
+	}
+	if format.symbolAfter {
+		b.WriteString("\u00a0")
+		b.WriteString(symbol)
+	}
+	return b.String()
+}
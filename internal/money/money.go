@@ -0,0 +1,58 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+)
+
+// ErrInvalidAmount is returned for amounts that can't be represented in the ledger
+var ErrInvalidAmount = i18n.NewError("error.invalid_amount", "invalid amount")
+
+// Bounds limits the size of a single amount; a zero bound is not enforced
+type Bounds struct {
+	Min float64
+	Max float64
+}
+
+// CheckPrecision reports an error when amount has more decimal places than the currency allows, or is too large
+// to keep them
+func CheckPrecision(amount float64, currency string) error {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: amount must be a finite number", ErrInvalidAmount)
+	}
+
+	// the shortest representation is what the client actually sent
+	s := strconv.FormatFloat(math.Abs(amount), 'f', -1, 64)
+	decimals := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		decimals = len(s) - i - 1
+	}
+	if exp := Exponent(currency); decimals > exp {
+		return fmt.Errorf("%w: %s amounts allow at most %d decimal places", ErrInvalidAmount, strings.ToUpper(currency), exp)
+	}
+	if max := MaxExact(currency); math.Abs(amount) > max {
+		return fmt.Errorf("%w: %s amounts can't exceed %g", ErrInvalidAmount, strings.ToUpper(currency), max)
+	}
+	return nil
+}
+
+// Validate checks that amount is positive, correctly scaled for the currency and within bounds
+func Validate(amount float64, currency string, bounds Bounds) error {
+	if err := CheckPrecision(amount, currency); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidAmount)
+	}
+	if bounds.Min > 0 && amount < bounds.Min {
+		return fmt.Errorf("%w: amount is below the minimum of %g", ErrInvalidAmount, bounds.Min)
+	}
+	if bounds.Max > 0 && amount > bounds.Max {
+		return fmt.Errorf("%w: amount exceeds the maximum of %g", ErrInvalidAmount, bounds.Max)
+	}
+	return nil
+}
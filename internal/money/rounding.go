@@ -0,0 +1,122 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode decides how an amount between two minor units is resolved
+type RoundingMode string
+
+const (
+	// HalfEven rounds ties to the even neighbour (banker's rounding)
+	HalfEven RoundingMode = "half_even"
+
+	// HalfUp rounds ties away from zero
+	HalfUp RoundingMode = "half_up"
+
+	// HalfDown rounds ties towards zero
+	HalfDown RoundingMode = "half_down"
+
+	// Up always rounds away from zero
+	Up RoundingMode = "up"
+
+	// Down always rounds towards zero (truncation)
+	Down RoundingMode = "down"
+
+	// Ceiling always rounds towards positive infinity
+	Ceiling RoundingMode = "ceiling"
+
+	// Floor always rounds towards negative infinity
+	Floor RoundingMode = "floor"
+)
+
+// ParseRoundingMode validates a rounding mode name; an empty name selects HalfEven
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	mode := RoundingMode(strings.ToLower(name))
+	switch mode {
+	case "":
+		return HalfEven, nil
+	case HalfEven, HalfUp, HalfDown, Up, Down, Ceiling, Floor:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode: %s", name)
+	}
+}
+
+// Policy rounds derived amounts (fees, interest, conversions) to a currency's minor unit
+// the zero value rounds half-even
+type Policy struct {
+	Mode RoundingMode
+}
+
+// Round rounds amount to the minor unit of currency
+func (p Policy) Round(amount float64, currency string) float64 {
+	return p.round(decimal(amount), currency)
+}
+
+// Percentage returns percent% of amount, rounded to the minor unit of currency
+func (p Policy) Percentage(amount, percent float64, currency string) float64 {
+	r := new(big.Rat).Mul(decimal(amount), decimal(percent))
+	return p.round(r.Quo(r, big.NewRat(100, 1)), currency)
+}
+
+// Convert multiplies amount by an exchange rate and rounds to the minor unit of the target currency
+func (p Policy) Convert(amount, rate float64, toCurrency string) float64 {
+	return p.round(new(big.Rat).Mul(decimal(amount), decimal(rate)), toCurrency)
+}
+
+// round works on exact rationals so ties are detected on the decimal value, not its binary approximation
+func (p Policy) round(value *big.Rat, currency string) float64 {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Exponent(currency))), nil)
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(scale))
+
+	// truncated quotient and remainder of the scaled value
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		negative := scaled.Sign() < 0
+		// compare twice the remainder against the denominator to find which half we are in
+		half := new(big.Int).Abs(rem)
+		half.Mul(half, big.NewInt(2))
+		cmp := half.Cmp(scaled.Denom())
+
+		awayFromZero := false
+		switch p.Mode {
+		case HalfUp:
+			awayFromZero = cmp >= 0
+		case HalfDown:
+			awayFromZero = cmp > 0
+		case Up:
+			awayFromZero = true
+		case Down:
+			awayFromZero = false
+		case Ceiling:
+			awayFromZero = !negative
+		case Floor:
+			awayFromZero = negative
+		default:
+			awayFromZero = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+		}
+		if awayFromZero {
+			if negative {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+
+	result, _ := new(big.Rat).SetFrac(q, scale).Float64()
+	return result
+}
+
+// decimal converts a float to the exact decimal value it was written as
+func decimal(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
@@ -0,0 +1,225 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// SMTPChannel sends notifications as plain text email
+type SMTPChannel struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// creates a new SMTPChannel; username may be empty for relays that don't require auth
+func NewSMTPChannel(addr, from, username, password string) *SMTPChannel {
+	var auth smtp.Auth
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPChannel{addr: addr, from: from, auth: auth}
+}
+
+func (c *SMTPChannel) Name() string { return "email" }
+
+func (c *SMTPChannel) Send(ctx context.Context, to string, n *models.Notification) error {
+	// a line break in any header would let its value add headers or recipients of its own
+	recipient, err := parseEmail(to)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	if strings.ContainsAny(n.Subject, "\r\n") {
+		return retry.Permanent(fmt.Errorf("invalid email subject: contains a line break"))
+	}
+
+	msg := strings.Join([]string{
+		"From: " + c.from,
+		"To: " + recipient.String(),
+		"Subject: " + n.Subject,
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		n.Message,
+	}, "\r\n")
+
+	if err := smtp.SendMail(c.addr, c.auth, c.from, []string{recipient.Address}, []byte(msg)); err != nil {
+		// 5xx replies are the server refusing the message, not failing to take it
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return retry.Permanent(fmt.Errorf("failed to send email: %w", err))
+		}
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// CheckEmail rejects anything but a single plain email address, such as "owner@example.com"
+func CheckEmail(addr string) error {
+	_, err := parseEmail(addr)
+	return err
+}
+
+func parseEmail(addr string) (*mail.Address, error) {
+	if strings.ContainsAny(addr, "\r\n") {
+		return nil, fmt.Errorf("invalid email address: contains a line break")
+	}
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return nil, fmt.Errorf("invalid email address: %q", addr)
+	}
+	return parsed, nil
+}
+
+// phone numbers are E.164: a plus, a country code and at most 15 digits in all
+var phoneNumber = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// CheckPhone rejects phone numbers that aren't in E.164 form, such as "+441234567890"
+func CheckPhone(phone string) error {
+	if !phoneNumber.MatchString(phone) {
+		return fmt.Errorf("invalid phone number: want E.164, like +441234567890")
+	}
+	return nil
+}
+
+// SMSChannel sends notifications through a Twilio-style HTTP messaging API
+// (form-encoded To/From/Body with basic auth)
+type SMSChannel struct {
+	apiURL string
+	from   string
+	user   string
+	token  string
+	client *http.Client
+}
+
+// creates a new SMSChannel
+func NewSMSChannel(apiURL, from, user, token string) *SMSChannel {
+	return &SMSChannel{
+		apiURL: apiURL,
+		from:   from,
+		user:   user,
+		token:  token,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *SMSChannel) Name() string { return "sms" }
+
+func (c *SMSChannel) Send(ctx context.Context, to string, n *models.Notification) error {
+	form := url.Values{
+		"To":   {to},
+		"From": {c.from},
+		"Body": {n.Message},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.user, c.token)
+
+	return doRequest(c.client, req)
+}
+
+// WebhookChannel posts the notification as JSON to the account's webhook URL,
+// signed with the tenant's webhook secrets when a secret source is set
+// only destinations its egress policy allows are posted to
+type WebhookChannel struct {
+	client  *http.Client
+	policy  EgressPolicy
+	secrets SecretSource
+}
+
+// how long a webhook delivery may take
+const webhookTimeout = 5 * time.Second
+
+// creates a new WebhookChannel with the strict egress policy
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{client: EgressPolicy{}.Client(webhookTimeout)}
+}
+
+// sets where webhooks may be sent
+func (c *WebhookChannel) SetPolicy(policy EgressPolicy) {
+	c.policy = policy
+	c.client = policy.Client(webhookTimeout)
+}
+
+// sets where signing secrets are loaded from
+func (c *WebhookChannel) SetSecretSource(secrets SecretSource) {
+	c.secrets = secrets
+}
+
+func (c *WebhookChannel) Name() string { return "webhook" }
+
+// the body is the notification's catalog event envelope
+func (c *WebhookChannel) Send(ctx context.Context, to string, n *models.Notification) error {
+	// URLs stored before the policy was tightened are refused here rather than when they were saved
+	if err := c.policy.CheckURL(to); err != nil {
+		return fmt.Errorf("%w: %v", ErrEgressDenied, err)
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	event, err := events.FromNotification(tenantID, n)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, event.ID)
+
+	var secrets []string
+	if c.secrets != nil {
+		if secrets, err = c.secrets(ctx); err != nil {
+			return fmt.Errorf("failed to load webhook secrets: %w", err)
+		}
+	}
+	req.Header.Set(SignatureHeader, Sign(secrets, time.Now(), body))
+
+	return doRequest(c.client, req)
+}
+
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("unexpected status %d", resp.StatusCode)
+		// other client errors are the request's fault and would be refused again
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
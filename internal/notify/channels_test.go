@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/retry"
+)
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"owner@example.com", true},
+		{"first.last+ledger@sub.example.co.uk", true},
+		{"", false},
+		{"owner", false},
+		{"Owner <owner@example.com>", false},
+		{"owner@example.com, other@example.com", false},
+		{"owner@example.com\r\nBcc: victim@example.com", false},
+		{"owner@example.com\nSubject: hi", false},
+	}
+	for _, tt := range tests {
+		if err := CheckEmail(tt.addr); (err == nil) != tt.ok {
+			t.Errorf("CheckEmail(%q) = %v, want ok %v", tt.addr, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		ok    bool
+	}{
+		{"+441234567890", true},
+		{"+15551234567", true},
+		{"441234567890", false},
+		{"+0441234567", false},
+		{"+44 1234 567890", false},
+		{"+4412345678901234", false},
+		{"+44123\n4567890", false},
+	}
+	for _, tt := range tests {
+		if err := CheckPhone(tt.phone); (err == nil) != tt.ok {
+			t.Errorf("CheckPhone(%q) = %v, want ok %v", tt.phone, err, tt.ok)
+		}
+	}
+}
+
+// header injection is refused before any connection is made, and not retried
+func TestSMTPChannelRejectsHeaderInjection(t *testing.T) {
+	channel := NewSMTPChannel("127.0.0.1:1", "ledger@example.com", "", "")
+	tests := []struct {
+		name string
+		to   string
+		n    *models.Notification
+	}{
+		{"recipient", "owner@example.com\r\nBcc: victim@example.com", &models.Notification{Subject: "Low balance"}},
+		{"subject", "owner@example.com", &models.Notification{Subject: "Low balance\r\nBcc: victim@example.com"}},
+	}
+	for _, tt := range tests {
+		err := channel.Send(context.Background(), tt.to, tt.n)
+		if err == nil || retry.Retryable(err) {
+			t.Errorf("%s: got %v, want a permanent error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// most redirects a webhook delivery follows
+const maxWebhookRedirects = 3
+
+// EgressPolicy restricts where webhooks may be sent, so a tenant can't point one at the ledger's own network.
+// The zero policy only allows https URLs of public addresses
+type EgressPolicy struct {
+	// AllowHTTP permits plain http URLs, for local development
+	AllowHTTP bool
+
+	// AllowPrivate permits loopback, private, link-local and other non-public addresses, for local development
+	AllowPrivate bool
+}
+
+// ErrEgressDenied is returned for a webhook URL or address the policy doesn't allow
+var ErrEgressDenied = errors.New("webhook destination not allowed")
+
+// ranges that aren't covered by net.IP's own predicates but don't reach the public internet either
+var nonPublicRanges = func() []*net.IPNet {
+	var ranges []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"192.0.2.0/24",  // documentation
+		"198.18.0.0/15", // benchmarking
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"240.0.0.0/4",  // reserved, and broadcast
+		"64:ff9b::/96", // NAT64, which reaches any IPv4 address behind it
+		"2001:db8::/32",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		ranges = append(ranges, n)
+	}
+	return ranges
+}()
+
+// CheckURL reports whether webhooks may be sent to raw; a host name is only checked once it resolves, when
+// the delivery dials it
+func (p EgressPolicy) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("url must be an https URL")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && p.AllowHTTP:
+	case u.Scheme == "http":
+		return fmt.Errorf("url must use https")
+	default:
+		return fmt.Errorf("url must be an https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip)
+	}
+	if !p.AllowPrivate && (host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		return fmt.Errorf("url must not point at a private address")
+	}
+	return nil
+}
+
+// CheckIP reports whether webhooks may be sent to ip
+func (p EgressPolicy) CheckIP(ip net.IP) error {
+	if p.AllowPrivate || isPublic(ip) {
+		return nil
+	}
+	return fmt.Errorf("url must not point at a private address")
+}
+
+// Client is an HTTP client that only connects to addresses the policy allows, checked after name resolution
+// so a host name can't resolve its way past it, and re-checks every redirect. It ignores proxy settings, since
+// through a proxy the address dialed would be the proxy's
+func (p EgressPolicy) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", ErrEgressDenied, address)
+			}
+			if err := p.CheckIP(ip); err != nil {
+				return fmt.Errorf("%w: %s", ErrEgressDenied, address)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxWebhookRedirects {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			if err := p.CheckURL(req.URL.String()); err != nil {
+				return fmt.Errorf("%w: redirect to %s: %v", ErrEgressDenied, req.URL.Redacted(), err)
+			}
+			return nil
+		},
+	}
+}
+
+// isPublic reports whether ip is a unicast address on the public internet
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range nonPublicRanges {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
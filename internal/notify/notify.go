@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/retry"
+)
+
+// DefaultRetry is how a failed send is retried: briefly, since notifications go out while the event is fresh and
+// the sender waits. Refusals no retry gets past, such as a destination the egress policy denies, aren't retried
+var DefaultRetry = retry.Policy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Jitter:      0.5,
+	Retryable:   func(err error) bool { return !errors.Is(err, ErrEgressDenied) },
+}
+
+// Channel delivers a notification to a single recipient address
+// (an email address, a phone number or a URL depending on the channel)
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, to string, n *models.Notification) error
+}
+
+// Dispatcher fans a notification out to every channel the account has an address for
+type Dispatcher struct {
+	email   Channel
+	sms     Channel
+	webhook Channel
+	retry   retry.Policy
+}
+
+// creates a new Dispatcher; any channel may be nil when it isn't configured
+func NewDispatcher(email, sms, webhook Channel) *Dispatcher {
+	return &Dispatcher{
+		email:   email,
+		sms:     sms,
+		webhook: webhook,
+		retry:   DefaultRetry,
+	}
+}
+
+// sets how failed sends are retried
+func (d *Dispatcher) SetRetryPolicy(policy retry.Policy) {
+	d.retry = policy
+}
+
+// send delivers on one channel, retrying failures the policy allows
+func (d *Dispatcher) send(ctx context.Context, channel Channel, to string, n *models.Notification) error {
+	return d.retry.Do(ctx, func(ctx context.Context) error { return channel.Send(ctx, to, n) })
+}
+
+// DispatchWebhook posts the notification to a single webhook URL
+func (d *Dispatcher) DispatchWebhook(ctx context.Context, url string, n *models.Notification) error {
+	if d.webhook == nil {
+		return nil
+	}
+	return d.send(ctx, d.webhook, url, n)
+}
+
+// Dispatch sends the notification on every configured channel and returns the combined failures
+func (d *Dispatcher) Dispatch(ctx context.Context, prefs *models.NotificationPreferences, n *models.Notification) error {
+	targets := []struct {
+		channel Channel
+		to      string
+	}{
+		{d.email, prefs.Email},
+		{d.sms, prefs.Phone},
+		{d.webhook, prefs.WebhookURL},
+	}
+
+	var failures []string
+	for _, t := range targets {
+		if t.channel == nil || t.to == "" {
+			continue
+		}
+		if err := d.send(ctx, t.channel, t.to, n); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", t.channel.Name(), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deliver notification: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
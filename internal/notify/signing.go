@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the delivery timestamp and one v1 signature per active signing secret
+	SignatureHeader = "Ledger-Signature"
+
+	// WebhookIDHeader identifies the notification so consumers can drop replays they have already seen
+	WebhookIDHeader = "Ledger-Webhook-Id"
+
+	// DefaultTolerance is the replay window consumers are advised to enforce on the signature timestamp
+	DefaultTolerance = 5 * time.Minute
+)
+
+// ErrInvalidSignature is returned by VerifySignature for deliveries that fail verification
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// SecretSource returns the signing secrets active for the tenant ctx is scoped to
+type SecretSource func(ctx context.Context) ([]string, error)
+
+// Sign builds the signature header value: t=<unix seconds>,v1=<hex hmac>[,v1=...]
+// each v1 is HMAC-SHA256 over "<t>.<body>" with one secret, so any active secret verifies
+func Sign(secrets []string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	parts := []string{"t=" + t}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+signature(secret, t, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// VerifySignature checks a signature header against one secret and rejects timestamps outside tolerance of now
+func VerifySignature(header string, body []byte, secret string, tolerance time.Duration, now time.Time) error {
+	var t string
+	var candidates []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			candidates = append(candidates, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing timestamp", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside the replay window", ErrInvalidSignature)
+	}
+
+	expected := signature(secret, t, body)
+	for _, candidate := range candidates {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,156 @@
+package openbanking
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// Berlin Group NextGenPSD2 AIS v1 shapes (the subset the ledger can populate)
+
+type bgAmount struct {
+	Currency string `json:"currency"`
+	Amount   string `json:"amount"`
+}
+
+type bgHref struct {
+	Href string `json:"href"`
+}
+
+type bgAccount struct {
+	ResourceID      string            `json:"resourceId"`
+	Currency        string            `json:"currency"`
+	CashAccountType string            `json:"cashAccountType"`
+	Status          string            `json:"status"`
+	Links           map[string]bgHref `json:"_links,omitempty"`
+}
+
+type bgAccountReference struct {
+	ResourceID string `json:"resourceId"`
+	Currency   string `json:"currency"`
+}
+
+type bgBalance struct {
+	BalanceAmount      bgAmount  `json:"balanceAmount"`
+	BalanceType        string    `json:"balanceType"`
+	LastChangeDateTime time.Time `json:"lastChangeDateTime"`
+}
+
+type bgTransaction struct {
+	TransactionID     string   `json:"transactionId"`
+	EntryReference    string   `json:"entryReference,omitempty"`
+	BookingDate       string   `json:"bookingDate,omitempty"`
+	ValueDate         string   `json:"valueDate,omitempty"`
+	TransactionAmount bgAmount `json:"transactionAmount"`
+}
+
+type bgTransactionReport struct {
+	Booked  []bgTransaction   `json:"booked"`
+	Pending []bgTransaction   `json:"pending"`
+	Links   map[string]bgHref `json:"_links"`
+}
+
+type bgTppMessage struct {
+	Category string `json:"category"`
+	Code     string `json:"code"`
+	Text     string `json:"text"`
+}
+
+func bgError(w http.ResponseWriter, status int, code, text string) {
+	respondJSON(w, status, map[string][]bgTppMessage{
+		"tppMessages": {{Category: "ERROR", Code: code, Text: text}},
+	})
+}
+
+func bgReference(account *models.Account) bgAccountReference {
+	return bgAccountReference{ResourceID: account.ID, Currency: account.Currency}
+}
+
+// BerlinGroupAccount handles GET /accounts/{id}
+func (h *Handler) BerlinGroupAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		bgError(w, http.StatusNotFound, "RESOURCE_UNKNOWN", "Account not found")
+		return
+	}
+
+	base := BerlinGroupPrefix + "/accounts/" + account.ID
+	respondJSON(w, http.StatusOK, map[string]bgAccount{
+		"account": {
+			ResourceID:      account.ID,
+			Currency:        account.Currency,
+			CashAccountType: "CACC",
+			Status:          "enabled",
+			Links: map[string]bgHref{
+				"balances":     {Href: base + "/balances"},
+				"transactions": {Href: base + "/transactions"},
+			},
+		},
+	})
+}
+
+// BerlinGroupBalances handles GET /accounts/{id}/balances
+func (h *Handler) BerlinGroupBalances(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		bgError(w, http.StatusNotFound, "RESOURCE_UNKNOWN", "Account not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"account": bgReference(account),
+		"balances": []bgBalance{{
+			BalanceAmount:      bgAmount{Currency: account.Currency, Amount: formatAmount(account.Balance)},
+			BalanceType:        "interimAvailable",
+			LastChangeDateTime: account.UpdatedAt,
+		}},
+	})
+}
+
+// BerlinGroupTransactions handles GET /accounts/{id}/transactions
+func (h *Handler) BerlinGroupTransactions(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		bgError(w, http.StatusNotFound, "RESOURCE_UNKNOWN", "Account not found")
+		return
+	}
+
+	txs, err := h.loadTransactions(r, "size")
+	if err != nil {
+		log.Printf("%sFailed to load transactions of account %s: %v", reqctx.LogPrefix(r.Context()), account.ID, err)
+		bgError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "Failed to load transactions")
+		return
+	}
+
+	report := bgTransactionReport{
+		Booked:  []bgTransaction{},
+		Pending: []bgTransaction{},
+		Links:   map[string]bgHref{"account": {Href: BerlinGroupPrefix + "/accounts/" + account.ID}},
+	}
+	for _, tx := range txs {
+		amount := signedAmount(tx, account.ID)
+
+		item := bgTransaction{
+			TransactionID:     tx.ID,
+			EntryReference:    tx.Reference,
+			TransactionAmount: bgAmount{Currency: account.Currency, Amount: formatAmount(amount)},
+		}
+
+		switch tx.Status {
+		case models.Completed:
+			item.BookingDate = tx.UpdatedAt.Format("2006-01-02")
+			item.ValueDate = tx.UpdatedAt.Format("2006-01-02")
+			report.Booked = append(report.Booked, item)
+		case models.Pending:
+			report.Pending = append(report.Pending, item)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"account":      bgReference(account),
+		"transactions": report,
+	})
+}
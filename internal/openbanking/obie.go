@@ -0,0 +1,191 @@
+package openbanking
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// UK OBIE Account and Transaction API v3.1 shapes (the subset the ledger can populate)
+
+type obieAmount struct {
+	Amount   string `json:"Amount"`
+	Currency string `json:"Currency"`
+}
+
+type obieAccount struct {
+	AccountID      string `json:"AccountId"`
+	Status         string `json:"Status"`
+	Currency       string `json:"Currency"`
+	AccountType    string `json:"AccountType"`
+	AccountSubType string `json:"AccountSubType"`
+	OpeningDate    string `json:"OpeningDate"`
+}
+
+type obieBalance struct {
+	AccountID            string     `json:"AccountId"`
+	Amount               obieAmount `json:"Amount"`
+	CreditDebitIndicator string     `json:"CreditDebitIndicator"`
+	Type                 string     `json:"Type"`
+	DateTime             time.Time  `json:"DateTime"`
+}
+
+type obieTransaction struct {
+	AccountID            string      `json:"AccountId"`
+	TransactionID        string      `json:"TransactionId"`
+	TransactionReference string      `json:"TransactionReference,omitempty"`
+	Amount               obieAmount  `json:"Amount"`
+	CreditDebitIndicator string      `json:"CreditDebitIndicator"`
+	Status               string      `json:"Status"`
+	BookingDateTime      time.Time   `json:"BookingDateTime"`
+	Balance              *obieTxnBal `json:"Balance,omitempty"`
+}
+
+type obieTxnBal struct {
+	Amount               obieAmount `json:"Amount"`
+	CreditDebitIndicator string     `json:"CreditDebitIndicator"`
+	Type                 string     `json:"Type"`
+}
+
+type obieResponse struct {
+	Data  interface{}       `json:"Data"`
+	Links map[string]string `json:"Links"`
+	Meta  map[string]int    `json:"Meta"`
+}
+
+type obieError struct {
+	Code    string          `json:"Code"`
+	Message string          `json:"Message"`
+	Errors  []obieErrorItem `json:"Errors"`
+}
+
+type obieErrorItem struct {
+	ErrorCode string `json:"ErrorCode"`
+	Message   string `json:"Message"`
+}
+
+func (h *Handler) obieRespond(w http.ResponseWriter, r *http.Request, data interface{}) {
+	respondJSON(w, http.StatusOK, obieResponse{
+		Data:  data,
+		Links: map[string]string{"Self": r.URL.String()},
+		Meta:  map[string]int{"TotalPages": 1},
+	})
+}
+
+func obieNotFound(w http.ResponseWriter) {
+	respondJSON(w, http.StatusNotFound, obieError{
+		Code:    "404",
+		Message: "Account not found",
+		Errors:  []obieErrorItem{{ErrorCode: "UK.OBIE.Resource.NotFound", Message: "Account not found"}},
+	})
+}
+
+func obieIndicator(amount float64) string {
+	if amount < 0 {
+		return "Debit"
+	}
+	return "Credit"
+}
+
+func abs(amount float64) float64 {
+	if amount < 0 {
+		return -amount
+	}
+	return amount
+}
+
+// OBIEAccount handles GET /accounts/{id}
+func (h *Handler) OBIEAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		obieNotFound(w)
+		return
+	}
+
+	h.obieRespond(w, r, map[string][]obieAccount{
+		"Account": {{
+			AccountID:      account.ID,
+			Status:         "Enabled",
+			Currency:       account.Currency,
+			AccountType:    "Personal",
+			AccountSubType: "CurrentAccount",
+			OpeningDate:    account.CreatedAt.Format("2006-01-02"),
+		}},
+	})
+}
+
+// OBIEBalances handles GET /accounts/{id}/balances
+func (h *Handler) OBIEBalances(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		obieNotFound(w)
+		return
+	}
+
+	h.obieRespond(w, r, map[string][]obieBalance{
+		"Balance": {{
+			AccountID:            account.ID,
+			Amount:               obieAmount{Amount: formatAmount(abs(account.Balance)), Currency: account.Currency},
+			CreditDebitIndicator: obieIndicator(account.Balance),
+			Type:                 "InterimAvailable",
+			DateTime:             account.UpdatedAt,
+		}},
+	})
+}
+
+// OBIETransactions handles GET /accounts/{id}/transactions
+func (h *Handler) OBIETransactions(w http.ResponseWriter, r *http.Request) {
+	account, err := h.loadAccount(r)
+	if err != nil {
+		obieNotFound(w)
+		return
+	}
+
+	txs, err := h.loadTransactions(r, "pageSize")
+	if err != nil {
+		// the cause names storage internals, so it only goes to the log
+		log.Printf("%sFailed to load transactions of account %s: %v", reqctx.LogPrefix(r.Context()), account.ID, err)
+		respondJSON(w, http.StatusInternalServerError, obieError{
+			Code:    "500",
+			Message: "Failed to load transactions",
+			Errors:  []obieErrorItem{{ErrorCode: "UK.OBIE.UnexpectedError", Message: "Failed to load transactions"}},
+		})
+		return
+	}
+
+	items := make([]obieTransaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.Status == models.Failed {
+			continue
+		}
+
+		amount := signedAmount(tx, account.ID)
+
+		item := obieTransaction{
+			AccountID:            account.ID,
+			TransactionID:        tx.ID,
+			TransactionReference: tx.Reference,
+			Amount:               obieAmount{Amount: formatAmount(abs(amount)), Currency: account.Currency},
+			CreditDebitIndicator: obieIndicator(amount),
+			Status:               "Pending",
+			BookingDateTime:      tx.CreatedAt,
+		}
+		if tx.Status == models.Completed {
+			item.Status = "Booked"
+		}
+		// balances are recorded for the originating account only
+		if tx.Status == models.Completed && tx.AccountID == account.ID {
+			item.Balance = &obieTxnBal{
+				Amount:               obieAmount{Amount: formatAmount(abs(tx.BalanceAfter)), Currency: account.Currency},
+				CreditDebitIndicator: obieIndicator(tx.BalanceAfter),
+				Type:                 "InterimBooked",
+			}
+		}
+		items = append(items, item)
+	}
+
+	h.obieRespond(w, r, map[string][]obieTransaction{"Transaction": items})
+}
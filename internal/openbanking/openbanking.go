@@ -0,0 +1,95 @@
+package openbanking
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// OBIEPrefix is the mount point of the UK Open Banking AIS facade
+	OBIEPrefix = "/open-banking/v3.1/aisp"
+
+	// BerlinGroupPrefix is the mount point of the Berlin Group NextGenPSD2 AIS facade
+	BerlinGroupPrefix = "/psd2/v1"
+
+	// defaultTransactionLimit caps the history returned when the client doesn't ask for a size
+	defaultTransactionLimit = 100
+)
+
+// Handler serves read-only account information in Open Banking schemas
+type Handler struct {
+	accountService     *service.AccountService
+	transactionService *service.TransactionService
+	currency           string
+}
+
+// creates a new open banking Handler; currency is reported for accounts that don't record their own
+func NewHandler(accountService *service.AccountService, transactionService *service.TransactionService, currency string) *Handler {
+	return &Handler{
+		accountService:     accountService,
+		transactionService: transactionService,
+		currency:           currency,
+	}
+}
+
+// SetupRoutes mounts both AIS facades on the router
+func SetupRoutes(r *mux.Router, h *Handler) {
+	obie := r.PathPrefix(OBIEPrefix).Subrouter()
+	obie.HandleFunc("/accounts/{id}", h.OBIEAccount).Methods("GET")
+	obie.HandleFunc("/accounts/{id}/balances", h.OBIEBalances).Methods("GET")
+	obie.HandleFunc("/accounts/{id}/transactions", h.OBIETransactions).Methods("GET")
+
+	bg := r.PathPrefix(BerlinGroupPrefix).Subrouter()
+	bg.HandleFunc("/accounts/{id}", h.BerlinGroupAccount).Methods("GET")
+	bg.HandleFunc("/accounts/{id}/balances", h.BerlinGroupBalances).Methods("GET")
+	bg.HandleFunc("/accounts/{id}/transactions", h.BerlinGroupTransactions).Methods("GET")
+}
+
+// loadAccount fetches the account named in the route
+func (h *Handler) loadAccount(r *http.Request) (*models.Account, error) {
+	account, err := h.accountService.GetAccount(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	if account.Currency == "" {
+		account.Currency = h.currency
+	}
+	return account, nil
+}
+
+// loadTransactions fetches the most recent history for the account in the route
+func (h *Handler) loadTransactions(r *http.Request, sizeParam string) ([]*models.Transaction, error) {
+	limit := defaultTransactionLimit
+	if v := r.URL.Query().Get(sizeParam); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	return h.transactionService.GetTransactionsByAccountID(r.Context(), mux.Vars(r)["id"], models.TransactionSort{}, limit, 0)
+}
+
+// signedAmount returns the transaction amount from the point of view of accountID:
+// negative when money left the account
+func signedAmount(tx *models.Transaction, accountID string) float64 {
+	if tx.Type == models.Withdrawal || (tx.Type == models.Transfer && tx.AccountID == accountID) {
+		return -tx.Amount
+	}
+	return tx.Amount
+}
+
+// formatAmount renders an amount the way both standards expect: a decimal string
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,6 @@
+// deployment-specific processing hooks are compiled into the API and processor binaries by importing them here
+// each hook package calls hooks.Register from its init function and lives under this directory, since it uses
+// the internal models, e.g.
+//
+//	import _ "github.com/abkawan/banking-ledger/internal/plugins/banklimits"
+package plugins
@@ -0,0 +1,129 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/redis"
+)
+
+// Publisher fans messages out to whoever is subscribed to a channel; nothing is stored for absent subscribers
+type Publisher interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	Close() error
+}
+
+// how many messages wait for Redis before new ones are dropped
+const publishBufferSize = 1024
+
+// ErrBufferFull is returned when a message is dropped because Redis isn't keeping up
+var ErrBufferFull = errors.New("publish buffer is full")
+
+// RedisPublisher sends PUBLISH commands to a Redis server over a single connection, from a goroutine of its own:
+// Publish only queues the message, so a slow or unreachable Redis never holds up the caller. The connection is
+// opened on first use and again after any error, so a Redis restart only costs the messages sent while it was down
+type RedisPublisher struct {
+	client *redis.Client
+	queue  chan publication
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+type publication struct {
+	channel string
+	message []byte
+}
+
+// creates a new RedisPublisher from a redis://[user:password@]host:port URL
+func NewRedisPublisher(rawURL string, timeout time.Duration) (*RedisPublisher, error) {
+	client, err := redis.NewClient(rawURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	p := &RedisPublisher{
+		client: client,
+		queue:  make(chan publication, publishBufferSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// queues the message for publishing; fails with ErrBufferFull, dropping it, when Redis is behind
+func (p *RedisPublisher) Publish(ctx context.Context, channel string, message []byte) error {
+	select {
+	case <-p.stop:
+		return fmt.Errorf("failed to publish to %s: publisher is closed", channel)
+	default:
+	}
+	select {
+	case p.queue <- publication{channel: channel, message: message}:
+		return nil
+	default:
+		return fmt.Errorf("failed to publish to %s: %w", channel, ErrBufferFull)
+	}
+}
+
+// sends queued messages until closed, then whatever is still queued
+func (p *RedisPublisher) run() {
+	defer close(p.done)
+	for {
+		select {
+		case m := <-p.queue:
+			p.send(m)
+		case <-p.stop:
+			for {
+				select {
+				case m := <-p.queue:
+					p.send(m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *RedisPublisher) send(m publication) {
+	if _, err := p.client.Do(context.Background(), "PUBLISH", []byte(m.channel), m.message); err != nil {
+		log.Printf("Failed to publish to %s: %v", m.channel, err)
+	}
+}
+
+// sends what is still queued and closes the connection
+func (p *RedisPublisher) Close() error {
+	p.once.Do(func() { close(p.stop) })
+	<-p.done
+	return p.client.Close()
+}
+
+// Subscriber receives what is published to the channels matching a pattern while it is subscribed
+type Subscriber interface {
+	Subscribe(ctx context.Context, pattern string, receive func(channel string, message []byte)) error
+}
+
+// RedisSubscriber holds a PSUBSCRIBE open on a connection of its own for as long as Subscribe runs
+type RedisSubscriber struct {
+	client *redis.Client
+}
+
+// creates a new RedisSubscriber from a redis://[user:password@]host:port URL
+func NewRedisSubscriber(rawURL string, timeout time.Duration) (*RedisSubscriber, error) {
+	client, err := redis.NewClient(rawURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSubscriber{client: client}, nil
+}
+
+// calls receive with every message published to a channel matching pattern until ctx is done or the
+// connection fails, which is returned as an error
+func (s *RedisSubscriber) Subscribe(ctx context.Context, pattern string, receive func(channel string, message []byte)) error {
+	return s.client.PSubscribe(ctx, pattern, receive)
+}
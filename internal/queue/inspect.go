@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/streadway/amqp"
+)
+
+// Peek returns up to limit messages from the head of a queue without consuming them. The messages are read on
+// a channel of their own and go back to the queue when it closes; a queue that doesn't exist is empty
+func (r *RabbitMQ) Peek(ctx context.Context, name string, limit int) (*models.QueueContents, error) {
+	conn, err := r.currentConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inspection channel: %w", err)
+	}
+	// closing the channel hands every unacknowledged message back to the queue
+	defer ch.Close()
+
+	contents := &models.QueueContents{Queue: name, Messages: []*models.QueuedMessage{}}
+	q, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+	if err != nil {
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return contents, nil
+		}
+		return nil, fmt.Errorf("failed to inspect %s: %w", name, err)
+	}
+	contents.Depth = q.Messages
+
+	for len(contents.Messages) < limit && ctx.Err() == nil {
+		msg, ok, err := ch.Get(name, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if !ok {
+			break
+		}
+		contents.Messages = append(contents.Messages, queuedMessage(&msg))
+	}
+	return contents, nil
+}
+
+// Depth returns how many messages wait in a queue, inspected on a channel of its own so a queue that doesn't
+// exist, and counts as empty, can't close the channel publishing uses
+func (r *RabbitMQ) Depth(ctx context.Context, name string) (int, error) {
+	conn, err := r.currentConn()
+	if err != nil {
+		return 0, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open inspection channel: %w", err)
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+	if err != nil {
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to inspect %s: %w", name, err)
+	}
+	return q.Messages, nil
+}
+
+func queuedMessage(msg *amqp.Delivery) *models.QueuedMessage {
+	m := &models.QueuedMessage{
+		MessageID:     msg.MessageId,
+		CorrelationID: msg.CorrelationId,
+		RoutingKey:    msg.RoutingKey,
+	}
+	if !msg.Timestamp.IsZero() {
+		m.Timestamp = &msg.Timestamp
+	}
+
+	// quarantined messages say why in their own headers; dead-lettered ones in the broker's x-death record
+	if reason, ok := msg.Headers[headerQuarantineReason].(string); ok {
+		m.Reason = reason
+		m.From, _ = msg.Headers[headerQuarantinedFrom].(string)
+	} else if deaths, ok := msg.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			m.Reason, _ = death["reason"].(string)
+			m.From, _ = death["queue"].(string)
+		}
+	}
+
+	var payload events.TransactionCreatedV2
+	if err := json.Unmarshal(msg.Body, &payload); err == nil && payload.ID != "" {
+		m.Transaction = payload.Transaction()
+	} else {
+		m.Body = string(msg.Body)
+	}
+	return m
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// fanout exchange the transaction queue dead-letters into when it overflows or messages expire
+	DeadLetterExchange = "ledger.dead-letter"
+
+	// queue collecting dead-lettered transactions for inspection and replay
+	DeadLetterQueue = "transactions.dead-letter"
+
+	// queue getting a copy of every dead-lettered transaction, drained by the processors to count them
+	DroppedQueue = "transactions.dropped"
+
+	// how often queue depths are sampled for the metrics
+	queueSampleInterval = 15 * time.Second
+)
+
+var (
+	queuedMessages = metrics.NewGauge(
+		"ledger_queue_messages",
+		"Transaction messages waiting in the processors' queue.",
+	)
+	deadLetteredMessages = metrics.NewGauge(
+		"ledger_queue_dead_lettered_messages",
+		"Transaction messages dropped from the processors' queue by the length limit or TTL and waiting in the dead-letter queue.",
+	)
+	droppedMessages = metrics.NewCounter(
+		"ledger_queue_dropped_messages_total",
+		"Transaction messages dead-lettered from the processors' queue by the length limit, the TTL or a rejection.",
+	)
+)
+
+// QueueLimits bounds the transaction queue so a runaway producer can't exhaust broker memory
+// the zero value leaves the queue unbounded, as it was declared before limits existed
+type QueueLimits struct {
+	// most messages the queue holds; once full the oldest is dead-lettered to make room
+	MaxLength int
+
+	// how long a message may wait before it is dead-lettered
+	MessageTTL time.Duration
+}
+
+func (l QueueLimits) enabled() bool {
+	return l.MaxLength > 0 || l.MessageTTL > 0
+}
+
+// arguments are the x-arguments the transaction queue is declared with; nil without limits
+func (l QueueLimits) arguments() amqp.Table {
+	if !l.enabled() {
+		return nil
+	}
+	args := amqp.Table{
+		"x-overflow":             "drop-head",
+		"x-dead-letter-exchange": DeadLetterExchange,
+	}
+	if l.MaxLength > 0 {
+		args["x-max-length"] = int64(l.MaxLength)
+	}
+	if l.MessageTTL > 0 {
+		args["x-message-ttl"] = l.MessageTTL.Milliseconds()
+	}
+	return args
+}
+
+// declareDeadLetter declares the dead-letter exchange and queue; the queue keeps the same length limit,
+// beyond which the oldest dead letters are discarded
+func declareDeadLetter(ch *amqp.Channel, l QueueLimits) error {
+	if err := ch.ExchangeDeclare(DeadLetterExchange, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	var args amqp.Table
+	if l.MaxLength > 0 {
+		args = amqp.Table{"x-max-length": int64(l.MaxLength)}
+	}
+	if _, err := ch.QueueDeclare(DeadLetterQueue, true, false, false, false, args); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(DeadLetterQueue, "", DeadLetterExchange, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(DroppedQueue, true, false, false, false, args); err != nil {
+		return err
+	}
+	return ch.QueueBind(DroppedQueue, "", DeadLetterExchange, false, nil)
+}
+
+// counts the dead-lettered transactions copied to the dropped queue until ctx ends or the client is closed;
+// each copy is delivered to one processor, so every drop is counted once across them
+func (r *RabbitMQ) countDropped(ctx context.Context) {
+	for r.waitConnected(ctx) {
+		ch, err := r.current()
+		if err != nil {
+			continue
+		}
+		msgs, err := ch.Consume(DroppedQueue, "", true, false, false, false, nil)
+		if err != nil {
+			log.Printf("Failed to count dropped messages: %v", err)
+			// the failed consume closes the channel; wait for the reconnection
+			time.Sleep(reconnectRetry.BaseDelay)
+			continue
+		}
+		if !countDeliveries(ctx, msgs) {
+			return
+		}
+	}
+}
+
+// counts deliveries until the consumer closes, which a reconnection follows; false when ctx ended first
+func countDeliveries(ctx context.Context, msgs <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case _, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			droppedMessages.Inc()
+		}
+	}
+}
+
+// samples the queue depths into the metrics until the client is closed
+func (r *RabbitMQ) sampleQueues() {
+	ticker := time.NewTicker(queueSampleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.mu.RLock()
+		stopped := r.closed
+		r.mu.RUnlock()
+		if stopped {
+			return
+		}
+
+		ch, err := r.current()
+		if err != nil {
+			continue
+		}
+		if q, err := ch.QueueInspect(TransactionQueue); err == nil {
+			queuedMessages.Set(float64(q.Messages))
+		} else {
+			log.Printf("Failed to inspect %s: %v", TransactionQueue, err)
+		}
+		// the dead-letter queue only exists with limits; inspecting a missing queue would close the channel
+		if r.limits.enabled() {
+			if q, err := ch.QueueInspect(DeadLetterQueue); err == nil {
+				deadLetteredMessages.Set(float64(q.Messages))
+			}
+		}
+	}
+}
@@ -3,34 +3,263 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/i18n"
 	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/abkawan/banking-ledger/internal/tenant"
 	"github.com/streadway/amqp"
 )
 
 const (
-	// queue for transactions
+	// topic exchange every transaction is published to, under one of the routing keys below; other consumers
+	// (fraud scoring, notifications) bind their own queues to it
+	TransactionExchange = "ledger.transactions"
+
+	// routing keys transactions are published under, by type
+	RoutingKeyDeposit    = "transactions.deposit"
+	RoutingKeyWithdrawal = "transactions.withdrawal"
+	RoutingKeyTransfer   = "transfers.internal"
+
+	// queue for transactions, bound to every transaction routing key
 	TransactionQueue = "transactions"
+
+	// prefix of the per-account queues holding transactions of paused accounts
+	heldQueuePrefix = "transactions.held."
+
+	// message headers carrying the originating request's context
+	headerRequestID   = "x-request-id"
+	headerTenantID    = "x-tenant-id"
+	headerActor       = "x-actor"
+	headerTraceParent = "traceparent"
+
+	// message headers naming the catalog event the body conforms to
+	headerEventType    = "x-event-type"
+	headerEventVersion = "x-event-version"
+)
+
+// Delivery is a consumed transaction together with the context of the request that queued it
+type Delivery struct {
+	Transaction models.Transaction
+	Metadata    reqctx.Metadata
+
+	// msg is nil for deliveries that were already settled, e.g. released held transactions
+	msg *amqp.Delivery
+}
+
+// Ack acknowledges the delivery once the consumer is done with it; until then a crashed consumer's
+// message goes back to the queue
+func (d Delivery) Ack() error {
+	if d.msg == nil {
+		return nil
+	}
+	return d.msg.Ack(false)
+}
+
+// Tag returns the delivery tag, which counts the channel's deliveries; 0 for settled deliveries
+func (d Delivery) Tag() uint64 {
+	if d.msg == nil {
+		return 0
+	}
+	return d.msg.DeliveryTag
+}
+
+// Redelivered reports whether the broker delivered the message before, to a consumer that didn't acknowledge it
+func (d Delivery) Redelivered() bool {
+	return d.msg != nil && d.msg.Redelivered
+}
+
+// the bindings that route every transaction to the processors' queue
+var transactionBindings = []string{"transactions.*", "transfers.*"}
+
+// RoutingKey returns the routing key a transaction is published under
+func RoutingKey(tx *models.Transaction) string {
+	switch tx.Type {
+	case models.Deposit:
+		return RoutingKeyDeposit
+	case models.Withdrawal:
+		return RoutingKeyWithdrawal
+	default:
+		return RoutingKeyTransfer
+	}
+}
+
+// metadataHeaders copies the request context of ctx into AMQP headers
+func metadataHeaders(ctx context.Context) amqp.Table {
+	md := reqctx.FromContext(ctx)
+	headers := amqp.Table{}
+	if md.RequestID != "" {
+		headers[headerRequestID] = md.RequestID
+	}
+	if md.Actor != "" {
+		headers[headerActor] = md.Actor
+	}
+	if md.TraceParent != "" {
+		headers[headerTraceParent] = md.TraceParent
+	}
+	if id, ok := tenant.FromContext(ctx); ok {
+		headers[headerTenantID] = id
+	}
+	return headers
+}
+
+// metadataFromHeaders is the inverse of metadataHeaders
+func metadataFromHeaders(headers amqp.Table) reqctx.Metadata {
+	get := func(key string) string {
+		v, _ := headers[key].(string)
+		return v
+	}
+	return reqctx.Metadata{
+		RequestID:   get(headerRequestID),
+		Actor:       get(headerActor),
+		TraceParent: get(headerTraceParent),
+	}
+}
+
+// eventHeaders labels a transaction message as the current transaction.created version
+func eventHeaders(headers amqp.Table) amqp.Table {
+	schema, _ := events.Latest(events.TransactionCreated)
+	headers[headerEventType] = string(schema.Type)
+	headers[headerEventVersion] = int32(schema.Version)
+	return headers
+}
+
+// checkEvent refuses messages this consumer doesn't understand; unlabelled messages predate
+// the catalog and are treated as transaction.created v1
+func checkEvent(headers amqp.Table) error {
+	eventType, ok := headers[headerEventType].(string)
+	if !ok {
+		return nil
+	}
+	if events.Type(eventType) != events.TransactionCreated {
+		return fmt.Errorf("unexpected event type %s", eventType)
+	}
+
+	var version int
+	switch v := headers[headerEventVersion].(type) {
+	case int32:
+		version = int(v)
+	case int64:
+		version = int(v)
+	case int:
+		version = v
+	}
+	if _, ok := events.Lookup(events.TransactionCreated, version); !ok {
+		return fmt.Errorf("unsupported %s version %v", eventType, headers[headerEventVersion])
+	}
+	return nil
+}
+
+// ErrUnavailable is returned when a message can't be published: the broker is unreachable and the spool,
+// if there is one, is full
+var ErrUnavailable = i18n.NewError("error.ingestion_unavailable", "ingestion unavailable")
+
+// how long reconnection attempts wait between tries; the wait doubles up to the maximum, and they go on until
+// the client is closed
+var reconnectRetry = retry.Policy{
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+	Jitter:    0.2,
+	OnRetry: func(_ int, err error, wait time.Duration) {
+		log.Printf("Failed to reconnect to rabbitmq, retrying in %s: %v", wait.Round(time.Millisecond), err)
+	},
+}
+
+// a publish the open channel refused is tried again briefly before it is spooled or refused; once the
+// connection is known to be down, waiting a moment won't bring it back
+var publishRetry = retry.Policy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Jitter:      0.5,
+	Retryable:   func(err error) bool { return !errors.Is(err, errConnectionDown) },
+}
+
+var (
+	errConnectionDown = errors.New("rabbitmq connection is down")
+
+	// errClosed stops reconnection attempts once the client is closed
+	errClosed = errors.New("rabbitmq client closed")
 )
 
 // handles RabbitMQ operations
+// a dropped connection is re-established in the background; with a spool set, publishes made while the
+// broker is unreachable are written to disk and sent once it is back
 type RabbitMQ struct {
+	uri    string
+	limits QueueLimits
+
+	mu      sync.RWMutex
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	queue   amqp.Queue
+	// ready is closed while connected and replaced when the connection drops
+	ready  chan struct{}
+	closed bool
+
+	spool   *Spool
+	flushMu sync.Mutex
+}
+
+// creates a new RabbitMQ client, declaring the transaction queue with limits
+func NewRabbitMQ(uri string, limits QueueLimits) (*RabbitMQ, error) {
+	r := &RabbitMQ{uri: uri, limits: limits, ready: make(chan struct{})}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	go r.sampleQueues()
+	return r, nil
+}
+
+// sets the spool publishes fall back to while the broker is unreachable, and sends anything a previous run left in it
+func (r *RabbitMQ) SetSpool(spool *Spool) {
+	r.spool = spool
+	go r.flush()
 }
 
-func NewRabbitMQ(uri string) (*RabbitMQ, error) {
-	conn, err := amqp.Dial(uri)
+// dials the broker, declares the transaction exchange and queue and starts watching the connection
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.uri)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to rabbitmq: %w", err)
+		return fmt.Errorf("failed to connect to rabbitmq: %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open a channel: %w", err)
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	// closes what was opened and reports a failed declaration
+	fail := func(format string, err error) error {
+		ch.Close()
+		conn.Close()
+		return fmt.Errorf(format, err)
+	}
+
+	err = ch.ExchangeDeclare(
+		TransactionExchange, // name
+		"topic",             // type
+		true,                // durable
+		false,               // auto-deleted
+		false,               // internal
+		false,               // no-wait
+		nil,                 // arguments
+	)
+	if err != nil {
+		return fail("failed to declare an exchange: %w", err)
+	}
+	if r.limits.enabled() {
+		if err := declareDeadLetter(ch, r.limits); err != nil {
+			return fail("failed to declare the dead-letter queue: %w", err)
+		}
 	}
 	q, err := ch.QueueDeclare(
 		TransactionQueue, // name
@@ -38,45 +267,246 @@ func NewRabbitMQ(uri string) (*RabbitMQ, error) {
 		false,            // delete when unused
 		false,            // exclusive
 		false,            // no-wait
-		nil,              // arguments
+		r.limits.arguments(),
 	)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare a queue: %w", err)
+		return fail("failed to declare a queue: %w", err)
 	}
+	for _, key := range transactionBindings {
+		if err := ch.QueueBind(q.Name, key, TransactionExchange, false, nil); err != nil {
+			return fail("failed to bind the queue: %w", err)
+		}
+	}
+	if _, err := ch.QueueDeclare(QuarantineQueue, true, false, false, false, nil); err != nil {
+		return fail("failed to declare the quarantine queue: %w", err)
+	}
+
+	r.mu.Lock()
+	r.conn, r.channel, r.queue = conn, ch, q
+	close(r.ready)
+	r.mu.Unlock()
+
+	go r.watch(conn, ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+// waits for the channel to close and reconnects unless the close was ours
+func (r *RabbitMQ) watch(conn *amqp.Connection, closed <-chan *amqp.Error) {
+	err := <-closed
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.ready = make(chan struct{})
+	r.mu.Unlock()
+	// a closed channel can leave the connection up; reconnecting replaces both
+	conn.Close()
+	log.Printf("Lost connection to rabbitmq: %v", err)
+
+	time.Sleep(reconnectRetry.BaseDelay)
+	reconnect := func(context.Context) error {
+		r.mu.RLock()
+		stopped := r.closed
+		r.mu.RUnlock()
+		if stopped {
+			return retry.Permanent(errClosed)
+		}
+		return r.connect()
+	}
+	if err := reconnectRetry.Do(context.Background(), reconnect); err != nil {
+		return
+	}
+	log.Println("Reconnected to rabbitmq")
+	r.flush()
+}
 
-	return &RabbitMQ{
-		conn:    conn,
-		channel: ch,
-		queue:   q,
-	}, nil
+// current returns the open channel, or an error while the connection is down
+func (r *RabbitMQ) current() (*amqp.Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	select {
+	case <-r.ready:
+		return r.channel, nil
+	default:
+		return nil, errConnectionDown
+	}
+}
+
+// currentConn returns the connection while it is up, read together with its readiness so it is never one
+// that has since been replaced
+func (r *RabbitMQ) currentConn() (*amqp.Connection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	select {
+	case <-r.ready:
+		return r.conn, nil
+	default:
+		return nil, errConnectionDown
+	}
+}
+
+// Accepting reports whether a publish can be taken right now: the broker is connected or the spool has room
+func (r *RabbitMQ) Accepting() bool {
+	if _, err := r.current(); err == nil {
+		return true
+	}
+	return r.spool != nil && !r.spool.Full()
+}
+
+// waitConnected blocks until a connection is up; false when ctx ended or the client was closed first
+func (r *RabbitMQ) waitConnected(ctx context.Context) bool {
+	for {
+		r.mu.RLock()
+		ready, closed := r.ready, r.closed
+		r.mu.RUnlock()
+		if closed {
+			return false
+		}
+		select {
+		case <-ready:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-time.After(reconnectRetry.BaseDelay):
+			// the client may have been closed while down
+		}
+	}
 }
 
 func (r *RabbitMQ) Close() error {
-	if err := r.channel.Close(); err != nil {
+	r.mu.Lock()
+	r.closed = true
+	ch, conn := r.channel, r.conn
+	r.mu.Unlock()
+
+	if err := ch.Close(); err != nil && err != amqp.ErrClosed {
 		return err
 	}
-	return r.conn.Close()
+	if err := conn.Close(); err != nil && err != amqp.ErrClosed {
+		return err
+	}
+	return nil
 }
 
-// publishes a payment/transaction to the queue
+// publishes a payment/transaction to the exchange under its type's routing key
 func (r *RabbitMQ) PublishTransaction(ctx context.Context, tx *models.Transaction) error {
-	body, err := json.Marshal(tx)
+	return r.publish(ctx, TransactionExchange, RoutingKey(tx), tx)
+}
+
+// parks a transaction in its paused account's holding queue until the account is resumed
+func (r *RabbitMQ) HoldTransaction(ctx context.Context, accountID string, tx *models.Transaction) error {
+	ch, err := r.current()
+	if err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(heldQueuePrefix+accountID, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare holding queue: %w", err)
+	}
+	// held transactions go straight to their queue; nothing else should see them until they are released
+	return r.publish(ctx, "", heldQueuePrefix+accountID, tx)
+}
+
+// hands every transaction held for an account to release, acknowledging each one it accepts,
+// and removes the holding queue once it is empty; stops at the first release error, leaving
+// that message and the rest in the queue
+func (r *RabbitMQ) DrainHeld(ctx context.Context, accountID string, release func(Delivery) error) (int, error) {
+	ch, err := r.current()
+	if err != nil {
+		return 0, err
+	}
+	name := heldQueuePrefix + accountID
+	if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+		return 0, fmt.Errorf("failed to declare holding queue: %w", err)
+	}
+
+	released := 0
+	for ctx.Err() == nil {
+		msg, ok, err := ch.Get(name, false)
+		if err != nil {
+			return released, fmt.Errorf("failed to read holding queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		tx, err := decodeTransaction(&msg)
+		if err != nil {
+			// the holding queue has no dead-letter exchange, so a message that can't be moved aside stays in it
+			if qErr := quarantine(ch, name, &msg, err); qErr != nil {
+				msg.Nack(false, true)
+				return released, qErr
+			}
+			continue
+		}
+		if err := release(Delivery{Transaction: *tx, Metadata: metadataFromHeaders(msg.Headers)}); err != nil {
+			msg.Nack(false, true)
+			return released, err
+		}
+		msg.Ack(false)
+		released++
+	}
+
+	if _, err := ch.QueueDelete(name, false, true, false); err != nil {
+		return released, fmt.Errorf("failed to delete holding queue: %w", err)
+	}
+	return released, nil
+}
+
+func (r *RabbitMQ) publish(ctx context.Context, exchange, routingKey string, tx *models.Transaction) error {
+	body, err := json.Marshal(events.NewTransactionCreatedV2(tx))
 	if err != nil {
 		return fmt.Errorf("failed to marshal transaction: %w", err)
 	}
 
+	m := &spooledMessage{
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		Headers:       stringHeaders(metadataHeaders(ctx)),
+		CorrelationID: reqctx.FromContext(ctx).RequestID,
+		Body:          body,
+	}
+	err = publishRetry.Do(ctx, func(context.Context) error { return r.send(m) })
+	if err == nil {
+		return nil
+	}
+	if r.spool == nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	// the message is safe on disk and goes out once the broker is reachable again
+	if spoolErr := r.spool.put(m); spoolErr != nil {
+		return fmt.Errorf("%w: %v; %v", ErrUnavailable, err, spoolErr)
+	}
+	log.Printf("%sSpooled transaction %s while rabbitmq is unavailable: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+	return nil
+}
+
+// send publishes one message on the current channel
+func (r *RabbitMQ) send(m *spooledMessage) error {
+	ch, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
 	// Publish a message
-	err = r.channel.Publish(
-		"",               // exchange
-		TransactionQueue, // routing key
-		false,            // mandatory
-		false,            // immediate
+	err = ch.Publish(
+		m.Exchange,   // exchange
+		m.RoutingKey, // routing key
+		false,        // mandatory
+		false,        // immediate
 		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp.Persistent, // make message persistent
+			ContentType:   "application/json",
+			Headers:       eventHeaders(headers),
+			CorrelationId: m.CorrelationID,
+			Body:          m.Body,
+			DeliveryMode:  amqp.Persistent, // make message persistent
 		})
 	if err != nil {
 		return fmt.Errorf("failed to publish a message: %w", err)
@@ -85,23 +515,58 @@ func (r *RabbitMQ) PublishTransaction(ctx context.Context, tx *models.Transactio
 	return nil
 }
 
-// consumes transactions from the queue
-func (r *RabbitMQ) ConsumeTransactions(ctx context.Context) (<-chan models.Transaction, error) {
-	msgs, err := r.channel.Consume(
-		TransactionQueue, // queue
-		"",               // consumer
-		false,            // auto-ack
-		false,            // exclusive
-		false,            // no-local
-		false,            // no-wait
-		nil,              // args
-	)
+// sends what the spool holds; a message that still can't be sent stays spooled for the next reconnection
+func (r *RabbitMQ) flush() {
+	if r.spool == nil {
+		return
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	sent, err := r.spool.drain(func(m *spooledMessage) error {
+		if strings.HasPrefix(m.RoutingKey, heldQueuePrefix) {
+			ch, err := r.current()
+			if err != nil {
+				return err
+			}
+			if _, err := ch.QueueDeclare(m.RoutingKey, true, false, false, false, nil); err != nil {
+				return fmt.Errorf("failed to declare holding queue: %w", err)
+			}
+		}
+		return r.send(m)
+	})
+	if sent > 0 {
+		log.Printf("Sent %d spooled messages to rabbitmq", sent)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to register a consumer: %w", err)
+		log.Printf("Failed to send spooled messages, %d left: %v", r.spool.Len(), err)
+	}
+}
+
+// stringHeaders keeps the string values of AMQP headers, which is all the request context uses
+func stringHeaders(headers amqp.Table) map[string]string {
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+// consumes transactions from the queue; the consumer registers again after a reconnection, and the
+// returned channel closes when ctx ends or the client is closed
+func (r *RabbitMQ) ConsumeTransactions(ctx context.Context) (<-chan Delivery, error) {
+	msgs, err := r.consume()
+	if err != nil {
+		return nil, err
+	}
+	if r.limits.enabled() {
+		go r.countDropped(ctx)
 	}
 
 	// Create a channel for transactions
-	txChan := make(chan models.Transaction)
+	txChan := make(chan Delivery)
 
 	// Process messages in a goroutine
 	go func() {
@@ -113,25 +578,57 @@ func (r *RabbitMQ) ConsumeTransactions(ctx context.Context) (<-chan models.Trans
 				return
 			case msg, ok := <-msgs:
 				if !ok {
-					return
+					// the connection dropped; unacknowledged messages go back to the queue
+					for {
+						if !r.waitConnected(ctx) {
+							return
+						}
+						if msgs, err = r.consume(); err == nil {
+							break
+						}
+						log.Printf("Failed to register a consumer again: %v", err)
+					}
+					continue
 				}
 
-				var tx models.Transaction
-				if err := json.Unmarshal(msg.Body, &tx); err != nil {
-					// Log error and continue
-					fmt.Printf("failed to unmarshal transaction: %v\n", err)
-					msg.Reject(false) // Don't requeue
+				tx, err := decodeTransaction(&msg)
+				if err != nil {
+					// invalid messages are kept aside for inspection instead of reaching the processor
+					if ch, chErr := r.current(); chErr == nil {
+						if qErr := quarantine(ch, TransactionQueue, &msg, err); qErr != nil {
+							// rejecting dead-letters it when limits are set
+							log.Printf("%v, rejecting it", qErr)
+							msg.Reject(false)
+						}
+					}
 					continue
 				}
 
-				// Send to transaction channel
-				txChan <- tx
-
-				// Acknowledge message
-				msg.Ack(false)
+				// Send to transaction channel; the consumer acknowledges it after processing
+				txChan <- Delivery{Transaction: *tx, Metadata: metadataFromHeaders(msg.Headers), msg: &msg}
 			}
 		}
 	}()
 
 	return txChan, nil
 }
+
+func (r *RabbitMQ) consume() (<-chan amqp.Delivery, error) {
+	ch, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := ch.Consume(
+		TransactionQueue, // queue
+		"",               // consumer
+		false,            // auto-ack
+		false,            // exclusive
+		false,            // no-local
+		false,            // no-wait
+		nil,              // args
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+)
+
+// ErrSpoolFull is returned when the spool already holds its maximum number of messages
+var ErrSpoolFull = errors.New("publish spool is full")
+
+// suffix given to spooled files that can't be read back, so they are no longer sent but aren't lost
+const badSuffix = ".bad"
+
+var unreadableSpooled = metrics.NewCounter(
+	"ledger_queue_spool_unreadable_total",
+	"Spooled transaction messages that couldn't be read back and were set aside with a .bad suffix instead of sent.",
+)
+
+// spooledMessage is a publish that couldn't reach the broker, kept until it can be sent again
+// headers are the string request context headers; the event headers are added again when it is sent.
+// An empty exchange is the default one, which routes straight to the queue named by the routing key
+type spooledMessage struct {
+	Exchange      string            `json:"exchange,omitempty"`
+	RoutingKey    string            `json:"routing_key"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	Body          json.RawMessage   `json:"body"`
+}
+
+// Spool is a bounded on-disk buffer of messages, one file each, sent again oldest first
+// files are written to a temporary name and renamed, so a crash never leaves a half-written message behind
+type Spool struct {
+	dir string
+	max int
+
+	mu    sync.Mutex
+	count int
+	seq   int64
+}
+
+// creates a new Spool in dir holding at most max messages; messages left by a previous run are kept
+func NewSpool(dir string, max int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	s := &Spool{dir: dir, max: max}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	s.count = len(files)
+
+	// temporary files are writes a crash interrupted; they never made it into the spool
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	for _, name := range leftovers {
+		os.Remove(name)
+	}
+	return s, nil
+}
+
+// Len returns the number of messages waiting in the spool
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Full reports whether the spool has no room for another message
+func (s *Spool) Full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count >= s.max
+}
+
+// put adds a message to the spool
+func (s *Spool) put(m *spooledMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spooled message: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count >= s.max {
+		return ErrSpoolFull
+	}
+
+	// names sort in the order messages were spooled
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d-%06d.msg", time.Now().UnixNano(), s.seq%1000000))
+	tmp := name + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to spool message: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to spool message: %w", err)
+	}
+
+	s.count++
+	return nil
+}
+
+// drain hands the spooled messages to send oldest first, removing each one it accepts; stops at the first
+// send error, leaving that message and the rest spooled. Unreadable files are renamed with a .bad suffix, out of
+// the spool but still on disk. Returns how many were sent
+func (s *Spool) drain(send func(*spooledMessage) error) (int, error) {
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return sent, fmt.Errorf("failed to read spooled message: %w", err)
+		}
+
+		var m spooledMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			// its transaction is already stored as pending, so the file is kept for an operator to recover
+			log.Printf("Setting aside unreadable spooled message %s: %v", filepath.Base(name), err)
+			if err := os.Rename(name, name+badSuffix); err != nil {
+				return sent, fmt.Errorf("failed to set aside spooled message: %w", err)
+			}
+			unreadableSpooled.Inc()
+		} else if err := send(&m); err != nil {
+			return sent, err
+		} else if err := os.Remove(name); err != nil {
+			return sent + 1, fmt.Errorf("failed to remove spooled message: %w", err)
+		} else {
+			sent++
+		}
+
+		s.mu.Lock()
+		s.count--
+		s.mu.Unlock()
+	}
+	return sent, nil
+}
+
+// files lists the spooled message files, oldest first
+func (s *Spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".msg") {
+			files = append(files, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// queue holding consumed messages that failed validation, with the reason in their headers
+	QuarantineQueue = "transactions.quarantine"
+
+	// headers added to quarantined messages
+	headerQuarantineReason = "x-quarantine-reason"
+	headerQuarantinedFrom  = "x-quarantined-from"
+)
+
+// the message carries no currency, so amounts are bounded by the loosest currency; processing checks the
+// account's own
+var maxMessageAmount = money.MaxExactAny()
+
+var quarantinedMessages = metrics.NewCounter(
+	"ledger_queue_quarantined_messages_total",
+	"Consumed transaction messages that failed validation and were moved to the quarantine queue.",
+)
+
+// decodeTransaction checks a consumed message's event labels and decodes its body as a valid transaction
+func decodeTransaction(msg *amqp.Delivery) (*models.Transaction, error) {
+	if err := checkEvent(msg.Headers); err != nil {
+		return nil, err
+	}
+
+	var payload events.TransactionCreatedV2
+	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+		return nil, fmt.Errorf("malformed transaction: %v", err)
+	}
+	tx := payload.Transaction()
+	if err := validateTransaction(tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	return tx, nil
+}
+
+// validateTransaction checks the fields processing relies on; messages are produced by this service, so a
+// failure means a bug or a foreign producer rather than bad client input
+func validateTransaction(tx *models.Transaction) error {
+	if tx.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if tx.AccountID == "" {
+		return fmt.Errorf("account_id is required")
+	}
+
+	switch tx.Type {
+	case models.Deposit, models.Withdrawal:
+	case models.Transfer:
+		if tx.CounterpartyAccountID == "" {
+			return fmt.Errorf("counterparty_account_id is required for transfers")
+		}
+		if tx.CounterpartyAccountID == tx.AccountID {
+			return fmt.Errorf("counterparty_account_id must differ from account_id")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", tx.Type)
+	}
+
+	switch tx.Status {
+	case models.Pending, models.Completed, models.Failed, models.Flagged, models.Held, models.InReview, models.Suspended, models.AwaitingFunds:
+	default:
+		return fmt.Errorf("unknown status %q", tx.Status)
+	}
+
+	if math.IsNaN(tx.Amount) || math.IsInf(tx.Amount, 0) || tx.Amount <= 0 || tx.Amount > maxMessageAmount {
+		return fmt.Errorf("amount %v is out of bounds", tx.Amount)
+	}
+	if math.IsNaN(tx.Fee) || math.IsInf(tx.Fee, 0) || tx.Fee < 0 || tx.Fee > maxMessageAmount {
+		return fmt.Errorf("fee %v is out of bounds", tx.Fee)
+	}
+	if tx.CreatedAt.IsZero() {
+		return fmt.Errorf("created_at is required")
+	}
+	return nil
+}
+
+// quarantine moves a message that failed validation to the quarantine queue with the reason attached, then
+// acknowledges it; if the move fails the message is left unacknowledged for the caller, and the error returned
+func quarantine(ch *amqp.Channel, queue string, msg *amqp.Delivery, reason error) error {
+	log.Printf("Quarantining message %s from %s: %v", msg.MessageId, queue, reason)
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[headerQuarantineReason] = reason.Error()
+	headers[headerQuarantinedFrom] = queue
+
+	err := ch.Publish("", QuarantineQueue, false, false, amqp.Publishing{
+		ContentType:   msg.ContentType,
+		Headers:       headers,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Body:          msg.Body,
+		DeliveryMode:  amqp.Persistent,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message %s: %w", msg.MessageId, err)
+	}
+	quarantinedMessages.Inc()
+	msg.Ack(false)
+	return nil
+}
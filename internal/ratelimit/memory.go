@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// past this many counters, ended windows are swept on the next hit
+const memorySweepSize = 10000
+
+type window struct {
+	count    int64
+	resetsAt time.Time
+}
+
+// MemoryStore keeps counters in the process: limits apply per replica and start again on restart
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*window
+}
+
+// creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*window)}
+}
+
+func (m *MemoryStore) Hit(_ context.Context, bucket string, length time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.counters) > memorySweepSize {
+		for name, w := range m.counters {
+			if !now.Before(w.resetsAt) {
+				delete(m.counters, name)
+			}
+		}
+	}
+
+	w, ok := m.counters[bucket]
+	if !ok || !now.Before(w.resetsAt) {
+		w = &window{resetsAt: now.Add(length)}
+		m.counters[bucket] = w
+	}
+	w.count++
+	return w.count, w.resetsAt, nil
+}
+
+func (m *MemoryStore) Counters(_ context.Context, prefix string, limit int) ([]Counter, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var counters []Counter
+	for name, w := range m.counters {
+		if strings.HasPrefix(name, prefix) && now.Before(w.resetsAt) {
+			counters = append(counters, Counter{Bucket: name, Count: w.count, ResetsAt: w.resetsAt})
+		}
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Bucket < counters[j].Bucket })
+	if len(counters) > limit {
+		counters = counters[:limit]
+	}
+	return counters, nil
+}
+
+func (m *MemoryStore) Reset(_ context.Context, bucket string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.counters[bucket]
+	delete(m.counters, bucket)
+	return ok && time.Now().Before(w.resetsAt), nil
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// DefaultWindow is how long a bucket counts requests before it starts again
+const DefaultWindow = time.Minute
+
+// Limits are how many requests each kind of bucket allows per window; zero turns that kind off
+type Limits struct {
+	Window time.Duration
+
+	// PerKey is shared by everything one API key or token subject of a tenant calls
+	PerKey int
+
+	// PerEndpoint is for one API key or token subject calling one route
+	PerEndpoint int
+
+	// PerTenant is shared by every caller of a tenant
+	PerTenant int
+}
+
+// Enabled reports whether any bucket is limited
+func (l Limits) Enabled() bool {
+	return l.PerKey > 0 || l.PerEndpoint > 0 || l.PerTenant > 0
+}
+
+// bucket kinds, the first part of a bucket's name
+const (
+	kindKey      = "key"
+	kindEndpoint = "endpoint"
+	kindTenant   = "tenant"
+)
+
+// limit returns the limit of a bucket by its kind
+func (l Limits) limit(bucket string) int {
+	switch kind, _, _ := strings.Cut(bucket, ":"); kind {
+	case kindKey:
+		return l.PerKey
+	case kindEndpoint:
+		return l.PerEndpoint
+	case kindTenant:
+		return l.PerTenant
+	}
+	return 0
+}
+
+// Counter is a bucket's count in its current window
+type Counter struct {
+	Bucket   string    `json:"bucket"`
+	Count    int64     `json:"count"`
+	Limit    int       `json:"limit"`
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// Store keeps the bucket counters
+type Store interface {
+	// Hit counts a request against bucket, starting a window when none is running, and returns the count so far
+	// and when the window ends
+	Hit(ctx context.Context, bucket string, window time.Duration) (int64, time.Time, error)
+
+	// Counters lists the buckets whose names start with prefix that are in a window, at most limit of them
+	Counters(ctx context.Context, prefix string, limit int) ([]Counter, error)
+
+	// Reset drops a bucket's counter so its next request starts a new window; reports whether there was one
+	Reset(ctx context.Context, bucket string) (bool, error)
+}
+
+// Decision is the outcome of a request against its buckets, described by the bucket closest to its limit
+type Decision struct {
+	Allowed   bool
+	Bucket    string
+	Limit     int
+	Remaining int64
+	ResetsAt  time.Time
+}
+
+// Limiter counts requests against the per-key, per-endpoint and per-tenant buckets they fall in
+type Limiter struct {
+	store  Store
+	limits Limits
+}
+
+// creates a new Limiter; a zero window is DefaultWindow
+func NewLimiter(store Store, limits Limits) *Limiter {
+	if limits.Window <= 0 {
+		limits.Window = DefaultWindow
+	}
+	return &Limiter{store: store, limits: limits}
+}
+
+// Limits returns the limiter's limits
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+// Allow counts a request by actor of tenantID to endpoint, such as "POST /transactions", against every limited
+// bucket and reports whether it may go ahead. Refused requests are counted too, so a caller retrying in a tight
+// loop stays refused until the window ends
+func (l *Limiter) Allow(ctx context.Context, tenantID, actor, endpoint string) (Decision, error) {
+	buckets := make([]string, 0, 3)
+	if l.limits.PerKey > 0 {
+		buckets = append(buckets, kindKey+":"+tenantID+":"+actor)
+	}
+	if l.limits.PerEndpoint > 0 {
+		buckets = append(buckets, kindEndpoint+":"+tenantID+":"+actor+":"+endpoint)
+	}
+	if l.limits.PerTenant > 0 {
+		buckets = append(buckets, kindTenant+":"+tenantID)
+	}
+
+	var decision Decision
+	for i, bucket := range buckets {
+		count, resetsAt, err := l.store.Hit(ctx, bucket, l.limits.Window)
+		if err != nil {
+			return Decision{Allowed: true}, err
+		}
+
+		limit := l.limits.limit(bucket)
+		allowed := count <= int64(limit)
+		remaining := int64(limit) - count
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		// a refusing bucket describes the decision over one that still has room
+		if i == 0 || (!allowed && decision.Allowed) || (allowed == decision.Allowed && remaining < decision.Remaining) {
+			decision = Decision{Allowed: allowed, Bucket: bucket, Limit: limit, Remaining: remaining, ResetsAt: resetsAt}
+		}
+	}
+	if len(buckets) == 0 {
+		decision.Allowed = true
+	}
+	return decision, nil
+}
+
+// Counters lists the buckets whose names start with prefix that are in a window, at most limit of them
+func (l *Limiter) Counters(ctx context.Context, prefix string, limit int) ([]Counter, error) {
+	counters, err := l.store.Counters(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range counters {
+		counters[i].Limit = l.limits.limit(counters[i].Bucket)
+	}
+	return counters, nil
+}
+
+// Reset drops a bucket's counter; reports whether there was one
+func (l *Limiter) Reset(ctx context.Context, bucket string) (bool, error) {
+	return l.store.Reset(ctx, bucket)
+}
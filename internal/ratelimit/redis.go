@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/redis"
+)
+
+// DefaultKeyPrefix namespaces the counters in a Redis server shared with other uses
+const DefaultKeyPrefix = "ledger:ratelimit:"
+
+// counts a hit and starts the window on the first one, in one step so a crash between the two can't leave a
+// counter that never expires; returns the count and the milliseconds left in the window
+const hitScript = `
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}`
+
+// RedisStore keeps counters in Redis, so every replica shares them and they survive restarts
+// keys expire with their window, so nothing needs cleaning up
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// creates a new RedisStore
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, prefix: DefaultKeyPrefix}
+}
+
+// sets the prefix of the store's keys, so counters kept for another purpose stay apart from the rate limits
+func (s *RedisStore) SetKeyPrefix(prefix string) {
+	s.prefix = prefix
+}
+
+func (s *RedisStore) Hit(ctx context.Context, bucket string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	reply, err := s.client.Do(ctx, "EVAL", []byte(hitScript), []byte("1"), []byte(s.prefix+bucket),
+		[]byte(strconv.FormatInt(window.Milliseconds(), 10)))
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count request: %w", err)
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, time.Time{}, fmt.Errorf("failed to count request: unexpected reply %v", reply)
+	}
+	count, _ := values[0].(int64)
+	ttl, _ := values[1].(int64)
+	if ttl < 0 {
+		ttl = window.Milliseconds()
+	}
+	return count, now.Add(time.Duration(ttl) * time.Millisecond), nil
+}
+
+func (s *RedisStore) Counters(ctx context.Context, prefix string, limit int) ([]Counter, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := s.client.Do(ctx, "SCAN", []byte(cursor), []byte("MATCH"), []byte(s.prefix+globEscape(prefix)+"*"), []byte("COUNT"), []byte("500"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list counters: %w", err)
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, fmt.Errorf("failed to list counters: unexpected reply %v", reply)
+		}
+		cursor, _ = page[0].(string)
+		found, _ := page[1].([]interface{})
+		for _, key := range found {
+			if name, ok := key.(string); ok {
+				keys = append(keys, name)
+			}
+		}
+		if cursor == "0" || cursor == "" || len(keys) >= limit {
+			break
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	now := time.Now()
+	counters := make([]Counter, 0, len(keys))
+	for _, key := range keys {
+		value, err := s.client.Do(ctx, "GET", []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read counter: %w", err)
+		}
+		ttl, err := s.client.Do(ctx, "PTTL", []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read counter: %w", err)
+		}
+		// expired between the scan and the read
+		text, ok := value.(string)
+		ms, _ := ttl.(int64)
+		if !ok || ms < 0 {
+			continue
+		}
+		count, _ := strconv.ParseInt(text, 10, 64)
+		counters = append(counters, Counter{
+			Bucket:   strings.TrimPrefix(key, s.prefix),
+			Count:    count,
+			ResetsAt: now.Add(time.Duration(ms) * time.Millisecond),
+		})
+	}
+	return counters, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, bucket string) (bool, error) {
+	reply, err := s.client.Do(ctx, "DEL", []byte(s.prefix+bucket))
+	if err != nil {
+		return false, fmt.Errorf("failed to reset counter: %w", err)
+	}
+	deleted, _ := reply.(int64)
+	return deleted > 0, nil
+}
+
+// globEscape escapes the characters SCAN MATCH treats as patterns
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,254 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the server; the connection is still usable after one
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Client sends commands to a Redis server over a single connection, one at a time
+// the connection is opened on first use and again after any network error, so a Redis restart only fails the
+// commands sent while it was down
+type Client struct {
+	addr     string
+	username string
+	password string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// creates a new Client from a redis://[user:password@]host:port URL
+func NewClient(rawURL string, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid redis url: expected redis://host:port")
+	}
+
+	c := &Client{addr: u.Host, timeout: timeout}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		if c.password != "" {
+			c.username = u.User.Username()
+		} else {
+			// redis://secret@host is the legacy password-only form
+			c.password = u.User.Username()
+		}
+	}
+	return c, nil
+}
+
+// Do sends one command and returns its reply: a string for simple and bulk strings, an int64 for integers,
+// nil for a nil reply and []interface{} for arrays. Error replies are returned as Error
+func (c *Client) Do(ctx context.Context, command string, args ...[]byte) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(ctx, command, args...)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		c.reset()
+	}
+	return reply, err
+}
+
+// closes the connection; the next command opens a new one
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reset()
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+
+	if c.password != "" {
+		args := [][]byte{[]byte(c.password)}
+		if c.username != "" {
+			args = append([][]byte{[]byte(c.username)}, args...)
+		}
+		if _, err := c.do(ctx, "AUTH", args...); err != nil {
+			c.reset()
+			return fmt.Errorf("failed to authenticate with redis: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) reset() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.reader = nil, nil
+	return err
+}
+
+func (c *Client) do(ctx context.Context, command string, args ...[]byte) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(command), command)
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return c.read()
+}
+
+// read reads one reply, recursing into arrays
+func (c *Client) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply from redis")
+	}
+
+	switch line[0] {
+	case '-':
+		return nil, Error(line[1:])
+	case '+':
+		return line[1:], nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer reply from redis: %s", strconv.Quote(line))
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk reply from redis: %s", strconv.Quote(line))
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array reply from redis: %s", strconv.Quote(line))
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := c.read()
+			var replyErr Error
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply from redis: %s", strconv.Quote(line))
+	}
+}
+
+// how often a subscription pings the server, so a connection that died silently is noticed
+const subscriptionPing = 30 * time.Second
+
+// PSubscribe subscribes to the channels matching pattern on a connection of its own and calls receive with
+// every message published to them, until ctx is done or the connection fails; it then returns the error, and
+// whatever is published before the caller subscribes again is missed
+func (c *Client) PSubscribe(ctx context.Context, pattern string, receive func(channel string, message []byte)) error {
+	sub := &Client{addr: c.addr, username: c.username, password: c.password, timeout: c.timeout}
+	if err := sub.connect(ctx); err != nil {
+		return err
+	}
+	defer sub.reset()
+	if _, err := sub.do(ctx, "PSUBSCRIBE", []byte(pattern)); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", pattern, err)
+	}
+
+	// the connection only writes pings from here on, and is closed to stop the read below when ctx is done
+	conn := sub.conn
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(subscriptionPing)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(c.timeout))
+				conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(subscriptionPing + c.timeout))
+		reply, err := sub.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("subscription to %s failed: %w", pattern, err)
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 4 || items[0] != "pmessage" {
+			continue
+		}
+		channel, _ := items[2].(string)
+		message, _ := items[3].(string)
+		receive(channel, []byte(message))
+	}
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// largest PDF accepted from the converter
+const maxPDFSize = 20 << 20
+
+// HTTPConverter posts HTML to a Gotenberg-compatible conversion endpoint
+// (multipart form with the document as index.html, PDF in the response body)
+type HTTPConverter struct {
+	url    string
+	client *http.Client
+}
+
+// creates a new HTTPConverter for e.g. http://gotenberg:3000/forms/chromium/convert/html
+func NewHTTPConverter(url string, timeout time.Duration) *HTTPConverter {
+	return &HTTPConverter{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *HTTPConverter) Convert(ctx context.Context, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(html); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("converter returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	pdf, err := io.ReadAll(io.LimitReader(resp.Body, maxPDFSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(pdf) > maxPDFSize {
+		return nil, fmt.Errorf("converter returned more than %d bytes", maxPDFSize)
+	}
+	return pdf, nil
+}
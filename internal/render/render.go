@@ -0,0 +1,117 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// ErrUnavailable is returned for PDF requests when no converter is configured
+var ErrUnavailable = i18n.NewError("error.render_unavailable", "pdf rendering is not configured")
+
+// Kind identifies a rendered document
+type Kind string
+
+const (
+	// Statement renders a models.Statement
+	Statement Kind = "statement"
+
+	// Receipt renders a single models.Transaction
+	Receipt Kind = "receipt"
+)
+
+// Converter turns a self-contained HTML document into a PDF
+type Converter interface {
+	Convert(ctx context.Context, html []byte) ([]byte, error)
+}
+
+// StatementData is what statement templates are executed with
+type StatementData struct {
+	Brand     *models.TenantBranding
+	Statement *models.Statement
+	// Locale is the language of the statement's labels, used as {{t $.Locale "statement.title"}}
+	Locale string
+}
+
+// ReceiptData is what receipt templates are executed with
+type ReceiptData struct {
+	Brand       *models.TenantBranding
+	Transaction *models.Transaction
+	Currency    string
+}
+
+var funcs = template.FuncMap{
+	// written to the minor unit of the currency when one is given, e.g. {{amount .Amount "JPY"}}
+	"amount": func(v float64, currency ...string) string {
+		var code string
+		if len(currency) > 0 {
+			code = currency[0]
+		}
+		return money.Plain(v, code)
+	},
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"datetime": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 MST")
+	},
+	"t": i18n.T,
+}
+
+// Renderer executes document templates and converts the result to PDF
+type Renderer struct {
+	converter Converter
+}
+
+// creates a new Renderer; converter may be nil, in which case only HTML can be produced
+func NewRenderer(converter Converter) *Renderer {
+	return &Renderer{converter: converter}
+}
+
+// Parse compiles a template so it can be validated before it is stored
+func Parse(kind Kind, source string) (*template.Template, error) {
+	if source == "" {
+		source = defaultTemplates[kind]
+	}
+	tmpl, err := template.New(string(kind)).Funcs(funcs).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", kind, err)
+	}
+	return tmpl, nil
+}
+
+// HTML executes the template source, or the built-in template for kind when source is empty
+func (r *Renderer) HTML(kind Kind, source string, data interface{}) ([]byte, error) {
+	tmpl, err := Parse(kind, source)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", kind, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF renders the document as HTML and converts it
+func (r *Renderer) PDF(ctx context.Context, kind Kind, source string, data interface{}) ([]byte, error) {
+	if r.converter == nil {
+		return nil, ErrUnavailable
+	}
+
+	html, err := r.HTML(kind, source, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pdf, err := r.converter.Convert(ctx, html)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to pdf: %w", kind, err)
+	}
+	return pdf, nil
+}
@@ -0,0 +1,52 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+func TestAmountsUseTheMinorUnit(t *testing.T) {
+	r := NewRenderer(nil)
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	statement := &StatementData{
+		Brand: &models.TenantBranding{},
+		Statement: &models.Statement{
+			AccountID: "acc-1", Currency: "JPY", PeriodStart: day, PeriodEnd: day,
+			OpeningBalance: 1000, ClosingBalance: 1500,
+			Entries: []models.StatementEntry{{Date: day, Amount: 500, Balance: 1500}},
+		},
+	}
+	html, err := r.HTML(Statement, "", statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), ">1500<") || strings.Contains(string(html), "1500.00") {
+		t.Errorf("yen statement not written in whole yen:\n%s", html)
+	}
+
+	receipt := &ReceiptData{
+		Brand:       &models.TenantBranding{},
+		Transaction: &models.Transaction{ID: "tx-1", Amount: 12.345, Fee: 0.5, CreatedAt: day},
+		Currency:    "KWD",
+	}
+	html, err = r.HTML(Receipt, "", receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "12.345 KWD") || !strings.Contains(string(html), "0.500 KWD") {
+		t.Errorf("dinar receipt not written to the fils:\n%s", html)
+	}
+
+	// templates stored before the currency argument keep two decimals
+	html, err = r.HTML(Receipt, `{{amount .Transaction.Fee}}`, receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(html) != "0.50" {
+		t.Errorf("got %s without a currency, want two decimals", html)
+	}
+}
@@ -0,0 +1,69 @@
+package render
+
+// built-in templates used when a tenant has not configured its own
+var defaultTemplates = map[Kind]string{
+	Statement: statementTemplate,
+	Receipt:   receiptTemplate,
+}
+
+const styles = `
+<style>
+	body { font-family: Helvetica, Arial, sans-serif; font-size: 12px; color: #222; margin: 32px; }
+	header { border-bottom: 3px solid {{with .Brand.Color}}{{.}}{{else}}#1f4e79{{end}}; padding-bottom: 12px; margin-bottom: 24px; }
+	header img { max-height: 48px; }
+	h1 { font-size: 20px; margin: 8px 0 0; }
+	table { width: 100%; border-collapse: collapse; }
+	th, td { text-align: left; padding: 6px 4px; border-bottom: 1px solid #ddd; }
+	td.num, th.num { text-align: right; }
+	footer { margin-top: 32px; color: #777; font-size: 10px; }
+</style>`
+
+const statementTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{t .Locale "statement.title"}}</title>` + styles + `</head>
+<body>
+<header>
+	{{with .Brand.LogoURL}}<img src="{{.}}" alt="">{{end}}
+	<h1>{{with .Brand.Name}}{{.}} {{end}}{{t .Locale "statement.title"}}</h1>
+</header>
+{{with .Statement}}
+<p>{{t $.Locale "statement.account"}} <strong>{{.AccountID}}</strong> ({{.Currency}})<br>
+{{t $.Locale "statement.period" (date .PeriodStart) (date .PeriodEnd)}}</p>
+<table>
+	<tr><th>{{t $.Locale "statement.date"}}</th><th>{{t $.Locale "statement.value_date"}}</th><th>{{t $.Locale "statement.type"}}</th><th>{{t $.Locale "statement.reference"}}</th><th class="num">{{t $.Locale "statement.amount"}}</th><th class="num">{{t $.Locale "statement.balance"}}</th></tr>
+	<tr><td>{{date .PeriodStart}}</td><td colspan="4">{{t $.Locale "statement.opening_balance"}}</td><td class="num">{{amount .OpeningBalance .Currency}}</td></tr>
+	{{range .Entries}}
+	<tr><td>{{date .Date}}</td><td>{{.ValueDate}}</td><td>{{.Type}}</td><td>{{.Reference}}</td><td class="num">{{amount .Amount $.Statement.Currency}}</td><td class="num">{{amount .Balance $.Statement.Currency}}</td></tr>
+	{{end}}
+	<tr><td>{{date .PeriodEnd}}</td><td colspan="4"><strong>{{t $.Locale "statement.closing_balance"}}</strong></td><td class="num"><strong>{{amount .ClosingBalance .Currency}}</strong></td></tr>
+</table>
+{{end}}
+<footer>{{.Brand.Footer}}</footer>
+</body>
+</html>`
+
+const receiptTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Receipt</title>` + styles + `</head>
+<body>
+<header>
+	{{with .Brand.LogoURL}}<img src="{{.}}" alt="">{{end}}
+	<h1>{{with .Brand.Name}}{{.}} {{end}}Transaction Receipt</h1>
+</header>
+{{$currency := .Currency}}
+{{with .Transaction}}
+<table>
+	<tr><th>Transaction</th><td>{{.ID}}</td></tr>
+	<tr><th>Date</th><td>{{datetime .CreatedAt}}</td></tr>
+	<tr><th>Account</th><td>{{.AccountID}}</td></tr>
+	{{with .CounterpartyAccountID}}<tr><th>Counterparty</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Type</th><td>{{.Type}}</td></tr>
+	<tr><th>Amount</th><td>{{amount .Amount $currency}} {{$currency}}</td></tr>
+	{{if .Fee}}<tr><th>Fee</th><td>{{amount .Fee $currency}} {{$currency}}</td></tr>{{end}}
+	<tr><th>Status</th><td>{{.Status}}{{with .FailureReason}} ({{.}}){{end}}</td></tr>
+	{{with .Reference}}<tr><th>Reference</th><td>{{.}}</td></tr>{{end}}
+</table>
+{{end}}
+<footer>{{.Brand.Footer}}</footer>
+</body>
+</html>`
@@ -0,0 +1,206 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// record kinds: changed state, which a passive region applies, and the control records fencing relies on
+const (
+	KindAccount     = "account"
+	KindTransaction = "transaction"
+
+	// the active region is alive and still holds its epoch
+	KindHeartbeat = "heartbeat"
+
+	// a region was promoted to Epoch; every region promoted before it is superseded
+	KindFence = "fence"
+)
+
+// controlKey keeps heartbeats and fences in order with each other on one partition
+const controlKey = "replication:control"
+
+// Record is one entry of the change feed, published by Region while it was active at Epoch. State records carry
+// the whole current account or transaction rather than a delta, so applying one twice, or a later one over an
+// earlier one, leaves the same result
+type Record struct {
+	Kind    string                 `json:"kind"`
+	Region  string                 `json:"region"`
+	Epoch   int64                  `json:"epoch"`
+	At      time.Time              `json:"at"`
+	Account *models.Account        `json:"account,omitempty"`
+	Summary *models.AccountSummary `json:"summary,omitempty"`
+	// Transaction is MongoDB extended JSON so every stored field, including the timeline, survives, as in backups
+	Transaction json.RawMessage `json:"transaction,omitempty"`
+
+	// key selects the partition, so the records of one account or transaction stay in order
+	key string
+
+	// where on the feed the record was read from
+	position Position
+}
+
+// Position is where a record was read from: its partition and offset, and the partition's high watermark, the
+// offset the next record published to it gets
+type Position struct {
+	Topic         string
+	Partition     int
+	Offset        int64
+	HighWatermark int64
+}
+
+// Position returns where the record was read from; zero for records that weren't read from a feed
+func (r *Record) Position() Position {
+	return r.position
+}
+
+// NewAccountRecord puts an account and its activity summary on the feed
+func NewAccountRecord(account *models.Account, summary *models.AccountSummary) *Record {
+	return &Record{Kind: KindAccount, Account: account, Summary: summary, key: "account:" + account.ID}
+}
+
+// NewTransactionRecord encodes a transaction for the feed
+func NewTransactionRecord(tx *models.Transaction) (*Record, error) {
+	raw, err := bson.MarshalExtJSON(tx, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction %s: %w", tx.ID, err)
+	}
+	return &Record{Kind: KindTransaction, Transaction: raw, key: "transaction:" + tx.ID}, nil
+}
+
+// DecodeTransaction returns the transaction a transaction record carries
+func (r *Record) DecodeTransaction() (*models.Transaction, error) {
+	var tx models.Transaction
+	if err := bson.UnmarshalExtJSON(r.Transaction, true, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	return &tx, nil
+}
+
+// Feed carries changes from the active region to the passive ones
+type Feed interface {
+	// Publish returns once every record is durably on the feed
+	Publish(ctx context.Context, records ...*Record) error
+
+	// Read calls fn for every record from where this region left off until ctx is done or fn fails; a record
+	// only counts as read once fn returned nil for it, and after a crash some records may be read again
+	Read(ctx context.Context, fn func(*Record) error) error
+
+	Close() error
+}
+
+// KafkaFeed is a Feed on a Kafka topic; each region reads it as a consumer group of its own
+type KafkaFeed struct {
+	writer *kafka.Writer
+
+	// the reader joins the region's consumer group, so it is only created once something reads
+	config kafka.ReaderConfig
+	reader *kafka.Reader
+}
+
+// creates a new KafkaFeed for the given brokers and topic, read by region
+func NewKafkaFeed(brokers []string, topic, region string) *KafkaFeed {
+	return &KafkaFeed{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		config: kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: "ledger-replication-" + region,
+			MaxWait: time.Second,
+			// offsets are committed in the background; records since the last commit are read again after a crash
+			CommitInterval: time.Second,
+		},
+	}
+}
+
+func (f *KafkaFeed) Publish(ctx context.Context, records ...*Record) error {
+	messages := make([]kafka.Message, 0, len(records))
+	for _, r := range records {
+		message, err := encodeMessage(r)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	if err := f.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to publish replication records: %w", err)
+	}
+	return nil
+}
+
+func (f *KafkaFeed) Read(ctx context.Context, fn func(*Record) error) error {
+	if f.reader == nil {
+		f.reader = kafka.NewReader(f.config)
+	}
+	for {
+		message, err := f.reader.FetchMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read replication feed: %w", err)
+		}
+		r, err := decodeMessage(message)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+		if err := f.reader.CommitMessages(ctx, message); err != nil {
+			return fmt.Errorf("failed to commit replication feed offset: %w", err)
+		}
+	}
+}
+
+// encodeMessage puts a record in a Kafka message keyed by what it carries; heartbeats and fences share one key
+func encodeMessage(r *Record) (kafka.Message, error) {
+	key := r.key
+	if key == "" {
+		key = controlKey
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to marshal replication record: %w", err)
+	}
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "record-kind", Value: []byte(r.Kind)}},
+	}, nil
+}
+
+// decodeMessage reads the record a Kafka message carries, with where it was read from
+func decodeMessage(message kafka.Message) (*Record, error) {
+	var r Record
+	if err := json.Unmarshal(message.Value, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode replication record at offset %d: %w", message.Offset, err)
+	}
+	r.position = Position{
+		Topic:         message.Topic,
+		Partition:     message.Partition,
+		Offset:        message.Offset,
+		HighWatermark: message.HighWaterMark,
+	}
+	return &r, nil
+}
+
+// flushes pending writes and leaves the consumer group
+func (f *KafkaFeed) Close() error {
+	err := f.writer.Close()
+	if f.reader != nil {
+		if rerr := f.reader.Close(); rerr != nil {
+			return rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaMessageKeys(t *testing.T) {
+	tx, err := NewTransactionRecord(&models.Transaction{ID: "tx-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		record *Record
+		key    string
+	}{
+		{"account", NewAccountRecord(&models.Account{ID: "acc-1"}, nil), "account:acc-1"},
+		{"transaction", tx, "transaction:tx-1"},
+		// heartbeats and fences must stay in order with each other, so they share a partition
+		{"heartbeat", &Record{Kind: KindHeartbeat}, controlKey},
+		{"fence", &Record{Kind: KindFence}, controlKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := encodeMessage(tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(message.Key) != tt.key {
+				t.Errorf("key = %q, want %q", message.Key, tt.key)
+			}
+			if len(message.Headers) != 1 || message.Headers[0].Key != "record-kind" || string(message.Headers[0].Value) != tt.record.Kind {
+				t.Errorf("headers = %v, want record-kind %s", message.Headers, tt.record.Kind)
+			}
+		})
+	}
+}
+
+func TestKafkaMessageRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	completed := at.Add(time.Second)
+	tx := &models.Transaction{
+		ID:          "tx-1",
+		TenantID:    "acme",
+		AccountID:   "acc-1",
+		Type:        models.Deposit,
+		Amount:      12.345,
+		Status:      models.Completed,
+		Metadata:    map[string]string{"source": "test"},
+		CreatedAt:   at,
+		UpdatedAt:   completed,
+		CompletedAt: &completed,
+	}
+	record, err := NewTransactionRecord(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Region, record.Epoch, record.At = "eu-west", 3, at
+
+	message, err := encodeMessage(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Topic, message.Partition, message.Offset, message.HighWaterMark = "ledger.replication", 2, 41, 42
+
+	got, err := decodeMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != KindTransaction || got.Region != "eu-west" || got.Epoch != 3 || !got.At.Equal(at) {
+		t.Errorf("record = %+v", got)
+	}
+	want := Position{Topic: "ledger.replication", Partition: 2, Offset: 41, HighWatermark: 42}
+	if got.Position() != want {
+		t.Errorf("position = %+v, want %+v", got.Position(), want)
+	}
+
+	decoded, err := got.DecodeTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != tx.ID || decoded.TenantID != tx.TenantID || decoded.Amount != tx.Amount ||
+		decoded.Metadata["source"] != "test" || decoded.CompletedAt == nil || !decoded.CompletedAt.Equal(completed) {
+		t.Errorf("transaction = %+v, want %+v", decoded, tx)
+	}
+}
+
+func TestDecodeMessageRejectsGarbage(t *testing.T) {
+	if _, err := decodeMessage(kafka.Message{Value: []byte("not json"), Offset: 7}); err == nil {
+		t.Error("expected an error for a message that isn't a record")
+	}
+}
@@ -0,0 +1,94 @@
+package reqctx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// Metadata identifies the API call an operation originated from
+type Metadata struct {
+	RequestID   string
+	Actor       string
+	TraceParent string
+
+	// ReferenceNamespace keeps the caller's transaction references apart from other integrations of the same tenant
+	ReferenceNamespace string
+
+	// BackDating is set for callers allowed to post transactions with a past posting date
+	BackDating bool
+
+	// Limits bound the transactions the caller's credential may post
+	Limits Limits
+}
+
+// Limits are the amounts one credential may move, on top of its tenant's limits; zero means no bound
+type Limits struct {
+	// Key identifies the credential the daily volume is counted for
+	Key string
+
+	MaxTransactionAmount float64
+	MaxDailyAmount       float64
+}
+
+type contextKey struct{}
+
+// WithMetadata returns a copy of ctx carrying md
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, contextKey{}, md)
+}
+
+// FromContext returns the metadata carried by ctx, zero when there is none
+func FromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(contextKey{}).(Metadata)
+	return md
+}
+
+// WithActor returns a copy of ctx with the actor set on its metadata
+func WithActor(ctx context.Context, actor string) context.Context {
+	md := FromContext(ctx)
+	md.Actor = actor
+	return WithMetadata(ctx, md)
+}
+
+// WithReferenceNamespace returns a copy of ctx with the reference namespace set on its metadata
+func WithReferenceNamespace(ctx context.Context, namespace string) context.Context {
+	md := FromContext(ctx)
+	md.ReferenceNamespace = namespace
+	return WithMetadata(ctx, md)
+}
+
+// WithBackDating returns a copy of ctx with back-dating allowed or not on its metadata
+func WithBackDating(ctx context.Context, allowed bool) context.Context {
+	md := FromContext(ctx)
+	md.BackDating = allowed
+	return WithMetadata(ctx, md)
+}
+
+// WithLimits returns a copy of ctx with the credential's limits set on its metadata
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	md := FromContext(ctx)
+	md.Limits = limits
+	return WithMetadata(ctx, md)
+}
+
+// LogPrefix renders the request metadata and tenant of ctx for log lines
+func LogPrefix(ctx context.Context) string {
+	md := FromContext(ctx)
+	var parts []string
+	if md.RequestID != "" {
+		parts = append(parts, "request_id="+md.RequestID)
+	}
+	if id, ok := tenant.FromContext(ctx); ok {
+		parts = append(parts, "tenant="+id)
+	}
+	if md.Actor != "" {
+		parts = append(parts, "actor="+md.Actor)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", strings.Join(parts, " "))
+}
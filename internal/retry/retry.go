@@ -0,0 +1,131 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Policy is how an operation is retried: how often, how long to wait in between and which errors are worth
+// another attempt. The wait doubles with every failed attempt, from BaseDelay up to MaxDelay
+type Policy struct {
+	// MaxAttempts counts the first attempt too; zero keeps trying until the context is done
+	MaxAttempts int
+
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction of each wait that is random, from 0 to 1, so callers that failed together don't
+	// all come back at once
+	Jitter float64
+
+	// Retryable reports whether an error is worth another attempt; nil retries every error but the ones never
+	// retried, see Retryable
+	Retryable func(error) bool
+
+	// OnRetry, if set, is called before waiting to try again
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// Backoff returns the wait after the given number of failed attempts, without jitter
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay > 0; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		if delay > math.MaxInt64/2 {
+			return math.MaxInt64
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// Delay returns the wait after the given number of failed attempts, jittered; never more than Backoff
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.Backoff(attempt)
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	return delay - time.Duration(jitter*random()*float64(delay))
+}
+
+// ShouldRetry reports whether an error is worth another attempt by the policy
+func (p Policy) ShouldRetry(err error) bool {
+	if !Retryable(err) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable, runs out of attempts or ctx is
+// done, and returns its last error as it was, so a Permanent one still reports not Retryable
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !p.ShouldRetry(err) || ctx.Err() != nil || (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+			return err
+		}
+
+		wait := p.Delay(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentError marks an error no attempt would get past
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; nil stays nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retryable reports whether err may be retried at all: errors marked Permanent never are. Do also stops once its
+// context is done, whatever the error; a timeout of the attempt's own, such as an HTTP client's, is retried
+func Retryable(err error) bool {
+	var permanent *permanentError
+	return !errors.As(err, &permanent)
+}
+
+// jitter comes from a source of its own, seeded once, so waits differ between processes
+var (
+	randomMu sync.Mutex
+	source   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func random() float64 {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+	return source.Float64()
+}
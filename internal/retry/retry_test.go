@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{1000, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("attempt %d: got %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	if got := (Policy{BaseDelay: time.Hour}).Backoff(100); got != math.MaxInt64 {
+		t.Errorf("uncapped backoff overflowed to %s", got)
+	}
+	if got := (Policy{}).Backoff(5); got != 0 {
+		t.Errorf("no base delay waits %s", got)
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: time.Second, Jitter: 0.25}
+	for i := 0; i < 1000; i++ {
+		if got := p.Delay(3); got < 750*time.Millisecond || got > time.Second {
+			t.Fatalf("delay %s outside [750ms, 1s]", got)
+		}
+	}
+
+	// a jitter beyond 1 is the whole wait, never a negative one
+	p.Jitter = 3
+	for i := 0; i < 1000; i++ {
+		if got := p.Delay(1); got < 0 || got > time.Second {
+			t.Fatalf("delay %s outside [0, 1s]", got)
+		}
+	}
+
+	p.Jitter = 0
+	if got := p.Delay(1); got != time.Second {
+		t.Fatalf("unjittered delay %s", got)
+	}
+}
+
+func TestDoStopsAfterMaxAttempts(t *testing.T) {
+	failure := errors.New("unavailable")
+	var calls, retries int
+	p := Policy{
+		MaxAttempts: 3,
+		OnRetry:     func(int, error, time.Duration) { retries++ },
+	}
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("got %v, want the last error", err)
+	}
+	if calls != 3 || retries != 2 {
+		t.Fatalf("%d calls and %d retries, want 3 and 2", calls, retries)
+	}
+}
+
+func TestDoReturnsOnSuccess(t *testing.T) {
+	calls := 0
+	err := Policy{MaxAttempts: 5}.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestDoStopsOnPermanent(t *testing.T) {
+	failure := errors.New("rejected")
+	calls := 0
+	err := Policy{MaxAttempts: 5}.Do(context.Background(), func(context.Context) error {
+		calls++
+		return Permanent(failure)
+	})
+	if calls != 1 {
+		t.Fatalf("%d calls, want 1", calls)
+	}
+	if !errors.Is(err, failure) || err.Error() != failure.Error() {
+		t.Fatalf("got %v, want %v", err, failure)
+	}
+	if Retryable(err) {
+		t.Fatal("the returned error no longer reports as permanent")
+	}
+	if Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) isn't nil")
+	}
+}
+
+func TestDoStopsOnPolicyRefusal(t *testing.T) {
+	refused := errors.New("denied")
+	calls := 0
+	p := Policy{MaxAttempts: 5, Retryable: func(err error) bool { return !errors.Is(err, refused) }}
+	if err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return refused
+	}); err != refused || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestDoStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	p := Policy{BaseDelay: time.Hour}
+	err := p.Do(ctx, func(context.Context) error {
+		calls++
+		cancel()
+		return errors.New("unavailable")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
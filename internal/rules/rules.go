@@ -0,0 +1,425 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidExpression is returned for expressions that don't parse or use something the language doesn't have
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// longest expression accepted; rules are one-liners, not programs
+const maxExpressionLength = 2000
+
+// Env holds the values an expression can refer to by name: float64, string, bool or map[string]string
+type Env map[string]interface{}
+
+// Program is a compiled expression
+// expressions use Go syntax restricted to literals, variables, arithmetic, comparisons, logic, map indexing and
+// the built-in functions; there are no loops, assignments or access to anything outside the Env, so evaluation is
+// bounded by the size of the expression
+type Program struct {
+	source string
+	expr   ast.Expr
+}
+
+// a built-in function; the arity is checked when compiling
+type function struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"contains":   {2, stringFunc2(strings.Contains)},
+	"startsWith": {2, stringFunc2(strings.HasPrefix)},
+	"endsWith":   {2, stringFunc2(strings.HasSuffix)},
+	"lower": {1, func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("lower expects a string")
+		}
+		return strings.ToLower(s), nil
+	}},
+	"upper": {1, func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("upper expects a string")
+		}
+		return strings.ToUpper(s), nil
+	}},
+	"abs": {1, func(args []interface{}) (interface{}, error) {
+		n, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("abs expects a number")
+		}
+		return math.Abs(n), nil
+	}},
+	"min": {2, numberFunc2(math.Min)},
+	"max": {2, numberFunc2(math.Max)},
+	"has": {2, func(args []interface{}) (interface{}, error) {
+		m, ok := args[0].(map[string]string)
+		key, isString := args[1].(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("has expects a map and a string key")
+		}
+		_, found := m[key]
+		return found, nil
+	}},
+}
+
+func stringFunc2(f func(string, string) bool) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		a, ok := args[0].(string)
+		b, isString := args[1].(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("expected two strings")
+		}
+		return f(a, b), nil
+	}
+}
+
+func numberFunc2(f func(float64, float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		a, ok := args[0].(float64)
+		b, isNumber := args[1].(float64)
+		if !ok || !isNumber {
+			return nil, fmt.Errorf("expected two numbers")
+		}
+		return f(a, b), nil
+	}
+}
+
+// Compile parses an expression and checks it only uses the given variables and the built-in functions
+func Compile(source string, variables []string) (*Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("%w: expression is empty", ErrInvalidExpression)
+	}
+	if len(source) > maxExpressionLength {
+		return nil, fmt.Errorf("%w: expression is longer than %d characters", ErrInvalidExpression, maxExpressionLength)
+	}
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+
+	known := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		known[v] = true
+	}
+	if err := check(expr, known); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	return &Program{source: source, expr: expr}, nil
+}
+
+// check walks the syntax tree, refusing anything the evaluator doesn't support
+func check(expr ast.Expr, known map[string]bool) error {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return check(e.X, known)
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT && e.Kind != token.STRING {
+			return fmt.Errorf("unsupported literal %s", e.Value)
+		}
+		return nil
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" || known[e.Name] {
+			return nil
+		}
+		return fmt.Errorf("unknown variable %s", e.Name)
+	case *ast.UnaryExpr:
+		if e.Op != token.NOT && e.Op != token.SUB && e.Op != token.ADD {
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		return check(e.X, known)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+			token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.LAND, token.LOR:
+		default:
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		if err := check(e.X, known); err != nil {
+			return err
+		}
+		return check(e.Y, known)
+	case *ast.IndexExpr:
+		if err := check(e.X, known); err != nil {
+			return err
+		}
+		return check(e.Index, known)
+	case *ast.CallExpr:
+		name, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("only built-in functions can be called")
+		}
+		f, ok := functions[name.Name]
+		if !ok {
+			return fmt.Errorf("unknown function %s", name.Name)
+		}
+		if len(e.Args) != f.arity || e.Ellipsis.IsValid() {
+			return fmt.Errorf("%s takes %d arguments", name.Name, f.arity)
+		}
+		for _, arg := range e.Args {
+			if err := check(arg, known); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+// String returns the expression's source
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the expression against env
+func (p *Program) Eval(env Env) (interface{}, error) {
+	return eval(p.expr, env)
+}
+
+// Bool evaluates an expression that must yield true or false
+func (p *Program) Bool(env Env) (bool, error) {
+	v, err := p.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression yields %s, not a boolean", typeName(v))
+	}
+	return b, nil
+}
+
+// Number evaluates an expression that must yield a finite number
+func (p *Program) Number(env Env) (float64, error) {
+	v, err := p.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expression yields %s, not a number", typeName(v))
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("expression yields %v", n)
+	}
+	return n, nil
+}
+
+func eval(expr ast.Expr, env Env) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return eval(e.X, env)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.STRING:
+			return strconv.Unquote(e.Value)
+		case token.INT:
+			n, err := strconv.ParseInt(e.Value, 0, 64)
+			return float64(n), err
+		}
+		return strconv.ParseFloat(e.Value, 64)
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		v, ok := env[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", e.Name)
+		}
+		return v, nil
+	case *ast.UnaryExpr:
+		x, err := eval(e.X, env)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == token.NOT {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("! expects a boolean")
+			}
+			return !b, nil
+		}
+		n, ok := x.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a number", e.Op)
+		}
+		if e.Op == token.SUB {
+			return -n, nil
+		}
+		return n, nil
+	case *ast.BinaryExpr:
+		return evalBinary(e, env)
+	case *ast.IndexExpr:
+		x, err := eval(e.X, env)
+		if err != nil {
+			return nil, err
+		}
+		index, err := eval(e.Index, env)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := x.(map[string]string)
+		key, isString := index.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("only maps can be indexed, by string keys")
+		}
+		// a missing key reads as an empty string, so rules needn't check has() first
+		return m[key], nil
+	case *ast.CallExpr:
+		f := functions[e.Fun.(*ast.Ident).Name]
+		args := make([]interface{}, len(e.Args))
+		for i, arg := range e.Args {
+			v, err := eval(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return f.call(args)
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+func evalBinary(e *ast.BinaryExpr, env Env) (interface{}, error) {
+	x, err := eval(e.X, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate the right side when it decides the result
+	if e.Op == token.LAND || e.Op == token.LOR {
+		left, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans", e.Op)
+		}
+		if (e.Op == token.LAND && !left) || (e.Op == token.LOR && left) {
+			return left, nil
+		}
+		y, err := eval(e.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		right, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans", e.Op)
+		}
+		return right, nil
+	}
+
+	y, err := eval(e.Y, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case token.EQL:
+		return equal(x, y)
+	case token.NEQ:
+		eq, err := equal(x, y)
+		if err != nil {
+			return nil, err
+		}
+		return !eq, nil
+	}
+
+	if a, ok := x.(string); ok {
+		b, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to a string and %s", e.Op, typeName(y))
+		}
+		switch e.Op {
+		case token.ADD:
+			return a + b, nil
+		case token.LSS:
+			return a < b, nil
+		case token.LEQ:
+			return a <= b, nil
+		case token.GTR:
+			return a > b, nil
+		case token.GEQ:
+			return a >= b, nil
+		}
+		return nil, fmt.Errorf("can't apply %s to strings", e.Op)
+	}
+
+	a, ok := x.(float64)
+	b, isNumber := y.(float64)
+	if !ok || !isNumber {
+		return nil, fmt.Errorf("can't apply %s to %s and %s", e.Op, typeName(x), typeName(y))
+	}
+	switch e.Op {
+	case token.ADD:
+		return a + b, nil
+	case token.SUB:
+		return a - b, nil
+	case token.MUL:
+		return a * b, nil
+	case token.QUO, token.REM:
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if e.Op == token.QUO {
+			return a / b, nil
+		}
+		return math.Mod(a, b), nil
+	case token.LSS:
+		return a < b, nil
+	case token.LEQ:
+		return a <= b, nil
+	case token.GTR:
+		return a > b, nil
+	case token.GEQ:
+		return a >= b, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// equal compares two values of the same type; maps can't be compared
+func equal(x, y interface{}) (bool, error) {
+	switch a := x.(type) {
+	case float64:
+		if b, ok := y.(float64); ok {
+			return a == b, nil
+		}
+	case string:
+		if b, ok := y.(string); ok {
+			return a == b, nil
+		}
+	case bool:
+		if b, ok := y.(bool); ok {
+			return a == b, nil
+		}
+	}
+	return false, fmt.Errorf("can't compare %s and %s", typeName(x), typeName(y))
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case map[string]string:
+		return "a map"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,164 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testVariables = []string{"amount", "tx_type", "flagged", "metadata", "unset"}
+
+func testEnv() Env {
+	return Env{
+		"amount":   250.0,
+		"tx_type":  "withdrawal",
+		"flagged":  false,
+		"metadata": map[string]string{"channel": "card"},
+	}
+}
+
+func TestCompileRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"empty", "  "},
+		{"too long", strings.Repeat("1+", maxExpressionLength) + "1"},
+		{"syntax error", "amount >"},
+		{"unknown field", "balance > 10"},
+		{"unknown field in a call", "lower(currency) == \"gbp\""},
+		{"unknown function", "round(amount) > 10"},
+		{"wrong arity", "contains(tx_type)"},
+		{"variadic call", "max(amount...)"},
+		{"method call", "tx_type.ToLower()"},
+		{"selector", "metadata.channel == \"card\""},
+		{"bitwise operator", "amount & 1 == 0"},
+		{"shift operator", "amount << 1 > 10"},
+		{"char literal", "tx_type == 'w'"},
+		{"function literal", "func() bool { return true }()"},
+		{"slice", "tx_type[1:] == \"ithdrawal\""},
+		{"composite literal", "metadata == map[string]string{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.source, testVariables); !errors.Is(err, ErrInvalidExpression) {
+				t.Fatalf("got %v, want ErrInvalidExpression", err)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// precedence and associativity follow Go
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"12 / 2 / 3", 2.0},
+		{"-2 * 3", -6.0},
+		{"7 % 4 + 1", 4.0},
+		{"1 + 2 > 2 && 3 < 2 * 2", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!flagged && amount > 100", true},
+		{"!(flagged || amount > 100)", false},
+		{"amount >= 250 == true", true},
+
+		// values and built-in functions
+		{"0x10 + 1.5", 17.5},
+		{"tx_type + \"-\" + metadata[\"channel\"]", "withdrawal-card"},
+		{"metadata[\"missing\"] == \"\"", true},
+		{"has(metadata, \"channel\") && !has(metadata, \"missing\")", true},
+		{"startsWith(upper(tx_type), \"WITH\")", true},
+		{"contains(tx_type, \"draw\") && endsWith(tx_type, \"al\")", true},
+		{"lower(\"GBP\")", "gbp"},
+		{"max(amount, 300) - min(amount, 300)", 50.0},
+		{"abs(-amount)", 250.0},
+		{"\"a\" < \"b\"", true},
+		{"tx_type != \"deposit\"", true},
+
+		// the right side of && and || only runs when it decides the result
+		{"flagged && unset > 1", false},
+		{"!flagged || unset > 1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			p, err := Compile(tt.source, testVariables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Eval(testEnv())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalTypeErrors(t *testing.T) {
+	tests := []string{
+		"amount + tx_type",
+		"tx_type - \"w\"",
+		"tx_type < 1",
+		"-tx_type",
+		"!amount",
+		"amount && true",
+		"flagged || amount",
+		"amount == tx_type",
+		"metadata == metadata",
+		"tx_type[\"x\"] == \"\"",
+		"metadata[1] == \"\"",
+		"lower(amount) == \"\"",
+		"abs(tx_type) > 1",
+		"max(amount, tx_type) > 1",
+		"contains(tx_type, 1)",
+		"has(tx_type, \"x\")",
+		"amount / 0 > 1",
+		"amount % 0 > 1",
+		"unset > 1",
+	}
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			p, err := Compile(source, testVariables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := p.Eval(testEnv()); err == nil {
+				t.Fatalf("got %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestBoolAndNumber(t *testing.T) {
+	compile := func(source string) *Program {
+		t.Helper()
+		p, err := Compile(source, testVariables)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if ok, err := compile("amount > 100").Bool(testEnv()); err != nil || !ok {
+		t.Fatalf("Bool: got %v, %v", ok, err)
+	}
+	if _, err := compile("amount * 2").Bool(testEnv()); err == nil {
+		t.Fatal("Bool accepted a number")
+	}
+	if n, err := compile("amount * 0.01").Number(testEnv()); err != nil || n != 2.5 {
+		t.Fatalf("Number: got %v, %v", n, err)
+	}
+	if _, err := compile("tx_type").Number(testEnv()); err == nil {
+		t.Fatal("Number accepted a string")
+	}
+	if _, err := compile("amount * 1e308").Number(testEnv()); err == nil {
+		t.Fatal("Number accepted an infinite result")
+	}
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Locker gives a job exclusive execution across replicas; ran is false when
+// another replica already holds the lock
+type Locker interface {
+	RunExclusive(ctx context.Context, key string, fn func(ctx context.Context) error) (ran bool, err error)
+}
+
+// Job is a named unit of periodic work
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs on their intervals until the context is cancelled
+type Scheduler struct {
+	locker Locker
+	jobs   []Job
+	paused func(ctx context.Context) bool
+}
+
+// creates a new Scheduler; every job run is guarded by the locker so only one
+// processor replica executes a given job at a time
+func New(locker Locker) *Scheduler {
+	return &Scheduler{locker: locker}
+}
+
+// sets a check that skips job runs while it reports true, e.g. during maintenance
+func (s *Scheduler) SetPaused(paused func(ctx context.Context) bool) {
+	s.paused = paused
+}
+
+// Register adds a job; jobs must be registered before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches one goroutine per job
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.paused != nil && s.paused(ctx) {
+				continue
+			}
+			ran, err := s.locker.RunExclusive(ctx, "job:"+job.Name, job.Run)
+			if err != nil {
+				log.Printf("Scheduled job %s failed: %v", job.Name, err)
+			} else if ran {
+				log.Printf("Scheduled job %s completed", job.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package screening
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// Screener checks a transaction against sanctions and AML watchlists before it is applied
+// a result with Hit set parks the transaction in review
+type Screener interface {
+	Screen(ctx context.Context, tx *models.Transaction) (*models.ScreeningResult, error)
+}
+
+// ScreenerFunc adapts an in-process function to the Screener interface
+type ScreenerFunc func(ctx context.Context, tx *models.Transaction) (*models.ScreeningResult, error)
+
+// Screen calls f(ctx, tx)
+func (f ScreenerFunc) Screen(ctx context.Context, tx *models.Transaction) (*models.ScreeningResult, error) {
+	return f(ctx, tx)
+}
+
+// HTTPScreener posts the transaction to an external screening endpoint
+// and expects a ScreeningResult JSON document back
+type HTTPScreener struct {
+	url    string
+	client *http.Client
+}
+
+// creates a new HTTPScreener with a bounded per-call timeout
+func NewHTTPScreener(url string, timeout time.Duration) *HTTPScreener {
+	return &HTTPScreener{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Screen sends the transaction to the screening provider
+func (s *HTTPScreener) Screen(ctx context.Context, tx *models.Transaction) (*models.ScreeningResult, error) {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build screening request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call screening provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("screening provider returned status %d", resp.StatusCode)
+	}
+
+	var result models.ScreeningResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode screening response: %w", err)
+	}
+
+	return &result, nil
+}
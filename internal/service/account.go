@@ -2,40 +2,192 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	"github.com/abkawan/banking-ledger/internal/clock"
 	"github.com/abkawan/banking-ledger/internal/db"
 	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// currency used for accounts when neither the request nor the tenant names one
+const defaultCurrency = "USD"
+
+const (
+	// how long an opening transaction may stay pending before reconciliation settles it; account creation
+	// finishes well within it
+	openingReconcileAfter = time.Minute
+
+	openingBatchSize = 100
 )
 
 // handles account operations
 type AccountService struct {
 	postgres *db.Postgres
+	mongodb  *db.MongoDB
+	tenants  *TenantService
+	clock    clock.Clock
 }
 
 // creates a new Account Service
-func NewAccountService(postgres *db.Postgres) *AccountService {
+func NewAccountService(postgres *db.Postgres, mongodb *db.MongoDB, tenants *TenantService) *AccountService {
 	return &AccountService{
 		postgres: postgres,
+		mongodb:  mongodb,
+		tenants:  tenants,
+		clock:    clock.System,
 	}
 }
 
+// sets the clock opening transactions are dated and reconciled by
+func (s *AccountService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
 // creates a new account
-func (s *AccountService) CreateAccount(ctx context.Context, initialBalance float64) (*models.Account, error) {
+func (s *AccountService) CreateAccount(ctx context.Context, req models.CreateAccountRequest) (*models.Account, error) {
+	initialBalance, currency := req.InitialBalance, req.Currency
+
 	// Validate initial balance
 	if initialBalance < 0 {
-		return nil, fmt.Errorf("initial balance cannot be negative")
+		return nil, fmt.Errorf("%w: initial balance cannot be negative", ErrInvalidAmount)
+	}
+
+	// Resolve and check the currency against the tenant's allowed list
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = defaultCurrency
+		if len(settings.AllowedCurrencies) > 0 {
+			currency = settings.AllowedCurrencies[0]
+		}
+	}
+	if _, ok := money.Lookup(currency); !ok {
+		return nil, fmt.Errorf("invalid currency code: %s", currency)
+	}
+	if !settings.AllowsCurrency(currency) {
+		return nil, fmt.Errorf("%w: currency %s is not enabled for this tenant", ErrNotAllowed, currency)
+	}
+
+	if err := money.CheckPrecision(initialBalance, currency); err != nil {
+		return nil, err
+	}
+
+	if len(req.ExternalReference) > 255 {
+		return nil, fmt.Errorf("external reference is longer than 255 characters")
+	}
+	for key := range req.Metadata {
+		if key == "" {
+			return nil, fmt.Errorf("metadata keys cannot be empty")
+		}
+	}
+
+	// the opening transaction is written pending before the balance exists, so an account never has a balance its
+	// history doesn't explain; reconciliation settles one left pending by a creation that stopped part-way
+	id := s.postgres.NewAccountID()
+	var opening *models.Transaction
+	if initialBalance > 0 {
+		if opening, err = s.recordOpening(ctx, id, initialBalance); err != nil {
+			return nil, fmt.Errorf("failed to record opening balance: %w", err)
+		}
 	}
 
 	// Create account
-	account, err := s.postgres.CreateAccount(ctx, initialBalance)
+	account, err := s.postgres.CreateAccount(ctx, id, initialBalance, currency, req.ExternalReference, req.Metadata)
 	if err != nil {
+		if opening != nil {
+			if failErr := s.mongodb.FailTransaction(ctx, opening.ID, "the account was not created"); failErr != nil {
+				log.Printf("%sFailed to fail opening transaction %s: %v", reqctx.LogPrefix(ctx), opening.ID, failErr)
+			}
+		}
 		return nil, fmt.Errorf("failed to create account: %w", err)
 	}
 
+	if opening != nil {
+		if err := s.mongodb.CompleteTransaction(ctx, opening.ID, 0, account.Balance, account.CreatedAt, 0); err != nil {
+			log.Printf("%sOpening transaction %s of account %s is left for reconciliation: %v", reqctx.LogPrefix(ctx), opening.ID, account.ID, err)
+		}
+	}
+
 	return account, nil
 }
 
+// writes the pending opening transaction that explains where a new account's initial balance came from
+func (s *AccountService) recordOpening(ctx context.Context, accountID string, amount float64) (*models.Transaction, error) {
+	openedAt := s.clock.Now(ctx)
+	opening := &models.Transaction{
+		AccountID:          accountID,
+		Type:               models.Opening,
+		Amount:             amount,
+		Status:             models.Pending,
+		ReferenceNamespace: models.LedgerNamespace,
+		Reference:          models.OpeningReference,
+		ValueDate:          &openedAt,
+		RequestID:          reqctx.FromContext(ctx).RequestID,
+	}
+	if err := s.mongodb.CreateTransaction(ctx, opening); err != nil {
+		return nil, err
+	}
+	return opening, nil
+}
+
+// settles the opening transactions account creations left pending: completed when the account exists, failed
+// when it was never created
+// intended to be run by the scheduler
+func (s *AccountService) ReconcileOpenings(ctx context.Context) error {
+	txs, err := s.mongodb.GetPendingOpeningsBefore(ctx, s.clock.Now(ctx).Add(-openingReconcileAfter), openingBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+		if err := s.reconcileOpening(txCtx, tx); err != nil {
+			log.Printf("Failed to reconcile opening transaction %s: %v", tx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *AccountService) reconcileOpening(ctx context.Context, tx *models.Transaction) error {
+	account, err := s.postgres.GetAccount(ctx, tx.AccountID)
+	if errors.Is(err, db.ErrAccountNotFound) {
+		log.Printf("Failed opening transaction %s, whose account was never created", tx.ID)
+		return s.mongodb.FailTransaction(ctx, tx.ID, "the account was not created")
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Completed opening transaction %s of account %s", tx.ID, account.ID)
+	return s.mongodb.CompleteTransaction(ctx, tx.ID, 0, tx.Amount, account.CreatedAt, 0)
+}
+
+// finds accounts by the tenant's external reference and/or metadata
+func (s *AccountService) FindAccounts(ctx context.Context, externalReference string, metadata map[string]string, limit, offset int) ([]*models.Account, error) {
+	accounts, err := s.postgres.FindAccounts(ctx, externalReference, metadata, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// lists the tenant's system accounts with their balances, for the finance team
+func (s *AccountService) GetSystemAccounts(ctx context.Context) ([]*models.Account, error) {
+	return s.postgres.GetSystemAccounts(ctx)
+}
+
 // retrieves an account by ID
 func (s *AccountService) GetAccount(ctx context.Context, id string) (*models.Account, error) {
 	account, err := s.postgres.GetAccount(ctx, id)
@@ -45,3 +197,22 @@ func (s *AccountService) GetAccount(ctx context.Context, id string) (*models.Acc
 
 	return account, nil
 }
+
+// retrieves an account's activity summary
+func (s *AccountService) GetSummary(ctx context.Context, id string) (*models.AccountSummary, error) {
+	return s.postgres.GetAccountSummary(ctx, id)
+}
+
+// sets an account's KYC status, as reported by the KYC provider
+func (s *AccountService) UpdateKYC(ctx context.Context, id string, req *models.KYCUpdateRequest) (*models.Account, error) {
+	if !req.Status.Valid() {
+		return nil, fmt.Errorf("invalid kyc status: %s", req.Status)
+	}
+
+	account, err := s.postgres.UpdateKYCStatus(ctx, id, req.Status, req.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update kyc status: %w", err)
+	}
+
+	return account, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/ratelimit"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// DefaultAuditRetention is how long audit events are kept unless configured otherwise
+const DefaultAuditRetention = 180 * 24 * time.Hour
+
+// AuditThresholds are the counts within Window past which failures raise an alert; a zero threshold never
+// alerts, and records every event it counts
+type AuditThresholds struct {
+	Window time.Duration
+
+	// authentication failures from one source address, or with one credential
+	AuthFailures int
+
+	// 403s to one credential
+	Denials int
+
+	// different accounts one credential reached for and didn't have
+	AccountProbes int
+}
+
+// DefaultAuditThresholds apply unless configured otherwise
+var DefaultAuditThresholds = AuditThresholds{Window: 5 * time.Minute, AuthFailures: 20, Denials: 20, AccountProbes: 10}
+
+var (
+	authFailures = metrics.NewCounter(
+		"ledger_auth_failures_total",
+		"Requests refused because their credentials were missing or didn't authenticate.",
+	)
+	accessDenials = metrics.NewCounter(
+		"ledger_access_denied_total",
+		"Authenticated requests refused with 403.",
+	)
+	accountProbes = metrics.NewCounter(
+		"ledger_account_probes_total",
+		"Credentials that reached for more accounts they don't have than the probe threshold allows.",
+	)
+	auditAlerts = metrics.NewCounter(
+		"ledger_audit_alerts_total",
+		"Authentication failure, denial and account probe rates that crossed their alert threshold.",
+	)
+	auditErrors = metrics.NewCounter(
+		"ledger_audit_errors_total",
+		"Audit events that couldn't be counted or recorded.",
+	)
+)
+
+// records authentication failures, authorization denials and account probing, and raises an alert when one
+// source or credential produces them faster than its threshold allows. Events past a threshold are only
+// counted, so a flood of failures can't flood the audit log too
+type AuditService struct {
+	postgres   *db.Postgres
+	counters   ratelimit.Store
+	thresholds AuditThresholds
+	retention  time.Duration
+}
+
+// creates a new AuditService counting rates in the process
+func NewAuditService(postgres *db.Postgres) *AuditService {
+	return &AuditService{
+		postgres:   postgres,
+		counters:   ratelimit.NewMemoryStore(),
+		thresholds: DefaultAuditThresholds,
+		retention:  DefaultAuditRetention,
+	}
+}
+
+// sets where rates are counted; a store the replicas share catches abuse spread across them
+func (s *AuditService) SetCounters(store ratelimit.Store) {
+	s.counters = store
+}
+
+// sets the alert thresholds
+func (s *AuditService) SetThresholds(t AuditThresholds) {
+	s.thresholds = t
+}
+
+// sets how long audit events are kept
+func (s *AuditService) SetRetention(d time.Duration) {
+	s.retention = d
+}
+
+// records a request whose credentials didn't authenticate, counted against its source and the credential it
+// presented
+func (s *AuditService) AuthFailed(ctx context.Context, event *models.AuditEvent) {
+	authFailures.Inc()
+	event.Kind = models.AuditAuthFailed
+	buckets := []string{"auth:source:" + event.Source}
+	if event.Credential != "" {
+		buckets = append(buckets, "auth:credential:"+event.Credential)
+	}
+	s.count(ctx, event, s.thresholds.AuthFailures, buckets...)
+}
+
+// records an authenticated request refused with 403, counted against its credential
+func (s *AuditService) Denied(ctx context.Context, event *models.AuditEvent) {
+	accessDenials.Inc()
+	event.Kind = models.AuditAccessDenied
+	s.count(ctx, event, s.thresholds.Denials, "denied:credential:"+event.Credential)
+}
+
+// MissedAccount counts a credential reaching for an account it doesn't have. Single misses are routine and not
+// recorded; reaching for AccountProbes different accounts within the window records a probe and alerts
+func (s *AuditService) MissedAccount(ctx context.Context, event *models.AuditEvent, accountID string) {
+	if s.thresholds.AccountProbes <= 0 {
+		return
+	}
+	window := s.thresholds.Window
+	// the first miss of an account in the window is what makes it one more different account
+	misses, _, err := s.counters.Hit(ctx, "probe:"+event.Credential+":"+accountID, window)
+	if err != nil {
+		s.failed(ctx, "count account miss", err)
+		return
+	}
+	if misses != 1 {
+		return
+	}
+	accounts, _, err := s.counters.Hit(ctx, "probes:"+event.Credential, window)
+	if err != nil {
+		s.failed(ctx, "count account probes", err)
+		return
+	}
+	if accounts != int64(s.thresholds.AccountProbes) {
+		return
+	}
+
+	accountProbes.Inc()
+	event.Kind = models.AuditAccountProbe
+	event.Reason = fmt.Sprintf("reached for %d accounts it doesn't have within %s", accounts, window)
+	s.save(ctx, event)
+	s.alert(ctx, event, fmt.Sprintf("credential %s %s", event.Credential, event.Reason))
+}
+
+// returns the audit events matching filter, most recent first
+func (s *AuditService) List(ctx context.Context, filter models.AuditFilter, limit, offset int) ([]*models.AuditEvent, error) {
+	return s.postgres.GetAuditEvents(ctx, filter, limit, offset)
+}
+
+// deletes the audit events past retention; intended to run from the scheduler
+func (s *AuditService) Prune(ctx context.Context) error {
+	n, err := s.postgres.DeleteAuditEventsBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Pruned %d audit events older than %s", n, s.retention)
+	}
+	return nil
+}
+
+// count hits the event's buckets and records it while the busiest is within threshold, alerting as it reaches it
+func (s *AuditService) count(ctx context.Context, event *models.AuditEvent, threshold int, buckets ...string) {
+	var busiest int64
+	var bucket string
+	for _, b := range buckets {
+		n, _, err := s.counters.Hit(ctx, b, s.thresholds.Window)
+		if err != nil {
+			s.failed(ctx, "count audit event", err)
+			continue
+		}
+		if n > busiest {
+			busiest, bucket = n, b
+		}
+	}
+	if threshold > 0 && busiest > int64(threshold) {
+		return
+	}
+
+	s.save(ctx, event)
+	if threshold > 0 && busiest == int64(threshold) {
+		s.alert(ctx, event, fmt.Sprintf("%d %s events for %s within %s", busiest, event.Kind, bucket, s.thresholds.Window))
+	}
+}
+
+// alert records an alert about event and logs it, for log-based alerting; the alerts counter is there for metrics
+func (s *AuditService) alert(ctx context.Context, event *models.AuditEvent, reason string) {
+	auditAlerts.Inc()
+	log.Printf("%sALERT: %s", reqctx.LogPrefix(ctx), reason)
+
+	alert := *event
+	alert.Kind = models.AuditAlert
+	alert.Reason = reason
+	s.save(ctx, &alert)
+}
+
+func (s *AuditService) save(ctx context.Context, event *models.AuditEvent) {
+	if err := s.postgres.CreateAuditEvent(ctx, event); err != nil {
+		s.failed(ctx, "record audit event", err)
+	}
+}
+
+func (s *AuditService) failed(ctx context.Context, action string, err error) {
+	auditErrors.Inc()
+	log.Printf("%sFailed to %s: %v", reqctx.LogPrefix(ctx), action, err)
+}
@@ -0,0 +1,498 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// DefaultAuthorizationBudget is how long an authorization waits for its hold unless configured otherwise
+	DefaultAuthorizationBudget = 1500 * time.Millisecond
+
+	// how long an approved authorization holds funds before it lapses when the request doesn't say
+	defaultAuthorizationExpiry = 7 * 24 * time.Hour
+
+	// auth codes are the card processor's key for an authorization
+	maxAuthCodeLength = 64
+
+	// the decline reason of authorizations whose hold outlived the budget
+	authorizationTimedOut = "authorization timed out"
+)
+
+// handles card authorizations: holds placed synchronously for card processors, then captured or released
+type AuthorizationService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+	clock              clock.Clock
+	budget             time.Duration
+}
+
+// creates a new AuthorizationService
+func NewAuthorizationService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService) *AuthorizationService {
+	return &AuthorizationService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+		clock:              clock.System,
+		budget:             DefaultAuthorizationBudget,
+	}
+}
+
+// sets the clock expiries are judged by
+func (s *AuthorizationService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets how long an authorization waits for the processor to place its hold before it is declined
+func (s *AuthorizationService) SetBudget(budget time.Duration) {
+	s.budget = budget
+}
+
+// references of the transfers that move an authorization's funds
+func authorizationHoldReference(id string) string    { return "auth-" + id + "-hold" }
+func authorizationCaptureReference(id string) string { return "auth-" + id + "-capture" }
+func authorizationReturnReference(id string) string  { return "auth-" + id + "-return" }
+
+// authorizes a card payment by holding the amount in the card holds account; the result is approved or declined
+// within the budget. Retries with the same auth code return the original authorization
+func (s *AuthorizationService) Authorize(ctx context.Context, req *models.AuthorizationRequest) (*models.Authorization, error) {
+	if req.AuthCode == "" || len(req.AuthCode) > maxAuthCodeLength {
+		return nil, fmt.Errorf("%w: auth_code is required and at most %d characters", ErrInvalidAuthorization, maxAuthCodeLength)
+	}
+	existing, err := s.postgres.GetAuthorizationByAuthCode(ctx, req.AuthCode)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return retriedAuthorization(existing, req)
+	}
+
+	account, err := s.postgres.GetAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Kind != models.CustomerAccount {
+		return nil, fmt.Errorf("%w: only customer accounts can be authorized against", ErrNotAllowed)
+	}
+	if err := money.Validate(req.Amount, account.Currency, s.transactionService.bounds); err != nil {
+		return nil, err
+	}
+	if err := CheckKeyLimit(ctx, req.Amount); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now(ctx)
+	expiresAt := now.Add(defaultAuthorizationExpiry)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAuthorization)
+	}
+
+	holdAccount, err := s.postgres.GetOrCreateSystemAccount(ctx, models.CardHoldAccount, account.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &models.Authorization{
+		AccountID:     account.ID,
+		HoldAccountID: holdAccount.ID,
+		AuthCode:      req.AuthCode,
+		Merchant:      req.Merchant,
+		Amount:        req.Amount,
+		Currency:      account.Currency,
+		ExpiresAt:     expiresAt,
+	}
+	if err := s.postgres.CreateAuthorization(ctx, a); err != nil {
+		if errors.Is(err, db.ErrDuplicateAuthCode) {
+			// a concurrent retry got there first
+			if existing, getErr := s.postgres.GetAuthorizationByAuthCode(ctx, req.AuthCode); getErr == nil && existing != nil {
+				return retriedAuthorization(existing, req)
+			}
+		}
+		return nil, err
+	}
+
+	// only the processor lowers balances, so a short balance can be declined without queueing the hold; debits
+	// already queued will take their share of it first
+	pending, err := s.mongodb.SumPendingDebits(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Balance-pending < a.Amount {
+		return s.decline(ctx, a, "insufficient funds")
+	}
+
+	tx, err := s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:             a.AccountID,
+		CounterpartyAccountID: a.HoldAccountID,
+		Type:                  models.Transfer,
+		Amount:                a.Amount,
+		Reference:             authorizationHoldReference(a.ID),
+		System:                true,
+	})
+	if err != nil {
+		return s.decline(ctx, a, err.Error())
+	}
+
+	tx, err = s.transactionService.WaitForTransaction(ctx, tx.ID, s.budget)
+	if err != nil {
+		// the caller gave up; whatever the hold does now is cleaned up by RunDue
+		s.timeOut(ctx, a)
+		return nil, err
+	}
+	switch tx.Status {
+	case models.Completed:
+		approved, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationPending, models.AuthorizationApproved, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			return nil, fmt.Errorf("%w: authorization was resolved concurrently", ErrAuthorizationClosed)
+		}
+		a.Status = models.AuthorizationApproved
+		return a, nil
+	case models.Failed:
+		return s.decline(ctx, a, tx.FailureReason)
+	default:
+		return s.timeOut(ctx, a), nil
+	}
+}
+
+// an auth code may only be retried for the same account and amount
+func retriedAuthorization(existing *models.Authorization, req *models.AuthorizationRequest) (*models.Authorization, error) {
+	if existing.AccountID != req.AccountID || existing.Amount != req.Amount {
+		return nil, fmt.Errorf("%w: auth code %s", ErrReferenceConflict, req.AuthCode)
+	}
+	return existing, nil
+}
+
+func (s *AuthorizationService) decline(ctx context.Context, a *models.Authorization, reason string) (*models.Authorization, error) {
+	if _, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationPending, models.AuthorizationDeclined, reason, 0); err != nil {
+		return nil, err
+	}
+	a.Status = models.AuthorizationDeclined
+	a.DeclineReason = reason
+	return a, nil
+}
+
+// marks an authorization whose hold is still outstanding as timed out, so RunDue returns the funds if it lands
+func (s *AuthorizationService) timeOut(ctx context.Context, a *models.Authorization) *models.Authorization {
+	ctx, cancel := commitContext(ctx)
+	defer cancel()
+
+	if _, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationPending, models.AuthorizationTimedOut, authorizationTimedOut, 0); err != nil {
+		log.Printf("Failed to time out authorization %s: %v", a.ID, err)
+	}
+	a.Status = models.AuthorizationTimedOut
+	a.DeclineReason = authorizationTimedOut
+	return a
+}
+
+// retrieves an authorization by ID
+func (s *AuthorizationService) GetAuthorization(ctx context.Context, id string) (*models.Authorization, error) {
+	return s.postgres.GetAuthorization(ctx, id)
+}
+
+// captures an approved authorization: the captured amount goes to the card settlement account and the
+// rest of the hold back to the account. Without an amount the whole hold is captured
+func (s *AuthorizationService) Capture(ctx context.Context, id string, req *models.CaptureRequest) (*models.Authorization, error) {
+	a, err := s.postgres.GetAuthorization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := a.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	retried := a.Status == models.AuthorizationCaptured && a.CapturedAmount == amount
+	if a.Status != models.AuthorizationApproved && !retried {
+		return nil, fmt.Errorf("%w: authorization is %s", ErrAuthorizationClosed, a.Status)
+	}
+	if amount <= 0 || amount > a.Amount {
+		return nil, fmt.Errorf("%w: capture must be above zero and at most the authorized %g", ErrInvalidAmount, a.Amount)
+	}
+	if err := money.CheckPrecision(amount, a.Currency); err != nil {
+		return nil, err
+	}
+
+	settlement, err := s.postgres.GetOrCreateSystemAccount(ctx, models.CardSettlementAccount, a.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// a retried capture replays its transfers by their references, finishing one that failed part-way
+	if retried {
+		if err := s.queueCapture(ctx, a, settlement, amount); err != nil {
+			return nil, err
+		}
+		if err := s.returnRest(ctx, a, amount); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	// claim the authorization before moving money so a concurrent capture and release can't both pay out
+	claimed, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationApproved, models.AuthorizationCaptured, "", amount)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, fmt.Errorf("%w: authorization was resolved concurrently", ErrAuthorizationClosed)
+	}
+
+	if err := s.queueCapture(ctx, a, settlement, amount); err != nil {
+		// put the authorization back so the capture can be retried
+		if _, updateErr := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationCaptured, models.AuthorizationApproved, "", 0); updateErr != nil {
+			log.Printf("Failed to reopen authorization %s: %v", a.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	a.Status = models.AuthorizationCaptured
+	a.CapturedAmount = amount
+	if err := s.returnRest(ctx, a, amount); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// moves the captured amount out of the hold to the card settlement account
+func (s *AuthorizationService) queueCapture(ctx context.Context, a *models.Authorization, settlement *models.Account, amount float64) error {
+	_, err := s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:             a.HoldAccountID,
+		CounterpartyAccountID: settlement.ID,
+		Type:                  models.Transfer,
+		Amount:                amount,
+		Reference:             authorizationCaptureReference(a.ID),
+		System:                true,
+	})
+	return err
+}
+
+// returns what a partial capture didn't take; its reference makes it safe to retry
+func (s *AuthorizationService) returnRest(ctx context.Context, a *models.Authorization, captured float64) error {
+	rest := s.transactionService.rounding.Round(a.Amount-captured, a.Currency)
+	if rest <= 0 {
+		return nil
+	}
+	if err := s.returnFunds(ctx, a, rest); err != nil {
+		return fmt.Errorf("failed to return %g of captured authorization %s, retry the capture: %w", rest, a.ID, err)
+	}
+	return nil
+}
+
+// releases an approved authorization before capture and returns the held funds
+func (s *AuthorizationService) Release(ctx context.Context, id string) (*models.Authorization, error) {
+	a, err := s.postgres.GetAuthorization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a.Status != models.AuthorizationApproved {
+		return nil, fmt.Errorf("%w: authorization is %s", ErrAuthorizationClosed, a.Status)
+	}
+	return s.returnHold(ctx, a, models.AuthorizationReleased)
+}
+
+// moves an authorization holding funds to a closing status and returns the whole hold to the account
+func (s *AuthorizationService) returnHold(ctx context.Context, a *models.Authorization, to models.AuthorizationStatus) (*models.Authorization, error) {
+	from := a.Status
+	claimed, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, from, to, a.DeclineReason, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, fmt.Errorf("%w: authorization was resolved concurrently", ErrAuthorizationClosed)
+	}
+
+	if err := s.returnFunds(ctx, a, a.Amount); err != nil {
+		// put the authorization back so the release can be retried
+		if _, updateErr := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, to, from, a.DeclineReason, 0); updateErr != nil {
+			log.Printf("Failed to reopen authorization %s: %v", a.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	a.Status = to
+	return a, nil
+}
+
+func (s *AuthorizationService) returnFunds(ctx context.Context, a *models.Authorization, amount float64) error {
+	_, err := s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:             a.HoldAccountID,
+		CounterpartyAccountID: a.AccountID,
+		Type:                  models.Transfer,
+		Amount:                amount,
+		Reference:             authorizationReturnReference(a.ID),
+		System:                true,
+	})
+	return err
+}
+
+// returns the funds of approved authorizations past their expiry, and of timed-out ones whose hold landed
+// after the processor was told they were declined. Intended to be run by the scheduler
+func (s *AuthorizationService) RunDue(ctx context.Context) error {
+	for _, pass := range duePasses(ctx, s.clock) {
+		authorizations, err := s.postgres.GetDueAuthorizations(ctx, pass.tenantID, pass.now)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range authorizations {
+			authCtx := tenant.WithTenant(ctx, a.TenantID)
+			if a.Status == models.AuthorizationApproved {
+				if _, err := s.returnHold(authCtx, a, models.AuthorizationExpired); err != nil {
+					log.Printf("Failed to expire authorization %s: %v", a.ID, err)
+				}
+				continue
+			}
+			if err := s.cleanUpTimedOut(authCtx, a); err != nil {
+				log.Printf("Failed to clean up timed out authorization %s: %v", a.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// settles a timed-out authorization once its hold has an outcome: a failed hold took nothing, a completed one is returned
+func (s *AuthorizationService) cleanUpTimedOut(ctx context.Context, a *models.Authorization) error {
+	hold, err := s.mongodb.GetTransactionByReference(ctx, "", a.AccountID, authorizationHoldReference(a.ID))
+	if err != nil {
+		return err
+	}
+	switch {
+	case hold == nil || hold.Status == models.Failed:
+		_, err = s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationTimedOut, models.AuthorizationDeclined, a.DeclineReason, 0)
+		return err
+	case hold.Status == models.Completed:
+		_, err = s.returnHold(ctx, a, models.AuthorizationReleased)
+		return err
+	default:
+		// still on its way; try again next run
+		return nil
+	}
+}
+
+// adjustments are keyed by the settled amount, so a resent item reuses its adjustment and a corrected one posts anew
+func authorizationAdjustReference(id string, settled float64) string {
+	return "auth-" + id + "-adjust-" + strconv.FormatFloat(settled, 'f', -1, 64)
+}
+
+// matches a card processor's settlement items to authorizations by auth code and posts the settled amounts:
+// approved authorizations are captured, and a settled amount above the hold or away from an earlier capture,
+// such as a tip, is posted as an adjustment between the account and the card settlement account.
+// Items that can't be matched are reported and leave the ledger untouched
+func (s *AuthorizationService) Settle(ctx context.Context, items []models.SettlementItem) (*models.SettlementReport, error) {
+	report := &models.SettlementReport{Items: len(items), Results: []models.SettlementResult{}}
+	for _, item := range items {
+		result := s.settleItem(ctx, item)
+		switch result.Outcome {
+		case models.SettlementUnmatched:
+			report.Unmatched++
+		case models.SettlementAdjustFailed:
+			report.AdjustFailed++
+		default:
+			report.Matched++
+			report.Settled += result.Amount
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func (s *AuthorizationService) settleItem(ctx context.Context, item models.SettlementItem) models.SettlementResult {
+	result := models.SettlementResult{Line: item.Line, AuthCode: item.AuthCode, Amount: item.Amount + item.Tip}
+	unmatched := func(reason string) models.SettlementResult {
+		result.Outcome = models.SettlementUnmatched
+		result.Reason = reason
+		return result
+	}
+
+	if item.AuthCode == "" || item.Amount <= 0 || item.Tip < 0 {
+		return unmatched("items need an auth_code, a positive amount and a tip of zero or more")
+	}
+	a, err := s.postgres.GetAuthorizationByAuthCode(ctx, item.AuthCode)
+	if err != nil {
+		return unmatched(err.Error())
+	}
+	if a == nil {
+		return unmatched("no authorization with this auth code")
+	}
+	result.AuthorizationID = a.ID
+	result.Amount = s.transactionService.rounding.Round(result.Amount, a.Currency)
+	if err := money.CheckPrecision(result.Amount, a.Currency); err != nil {
+		return unmatched(err.Error())
+	}
+
+	switch a.Status {
+	case models.AuthorizationApproved:
+		capture := result.Amount
+		if capture > a.Amount {
+			capture = a.Amount
+		}
+		if a, err = s.Capture(ctx, a.ID, &models.CaptureRequest{Amount: &capture}); err != nil {
+			return unmatched(err.Error())
+		}
+		result.Outcome = models.SettlementCaptured
+	case models.AuthorizationCaptured:
+		result.Outcome = models.SettlementAlreadySettled
+	default:
+		return unmatched(fmt.Sprintf("authorization is %s", a.Status))
+	}
+
+	if result.Amount != a.CapturedAmount {
+		if err := s.adjust(ctx, a, result.Amount); err != nil {
+			// the capture stands; the item can be sent again once the adjustment can be posted
+			result.Outcome = models.SettlementAdjustFailed
+			result.Reason = fmt.Sprintf("captured %g but failed to adjust to %g: %v", a.CapturedAmount, result.Amount, err)
+			return result
+		}
+		result.Outcome = models.SettlementAdjusted
+	}
+	return result
+}
+
+// posts the difference between a captured authorization and its settled amount and records the settled amount
+func (s *AuthorizationService) adjust(ctx context.Context, a *models.Authorization, settled float64) error {
+	settlement, err := s.postgres.GetOrCreateSystemAccount(ctx, models.CardSettlementAccount, a.Currency)
+	if err != nil {
+		return err
+	}
+
+	// a settled amount above the capture is taken from the account, one below it is refunded to the account
+	req := &models.TransactionRequest{
+		AccountID:             a.AccountID,
+		CounterpartyAccountID: settlement.ID,
+		Type:                  models.Transfer,
+		Amount:                s.transactionService.rounding.Round(settled-a.CapturedAmount, a.Currency),
+		Reference:             authorizationAdjustReference(a.ID, settled),
+		System:                true,
+	}
+	if req.Amount < 0 {
+		req.AccountID, req.CounterpartyAccountID = settlement.ID, a.AccountID
+		req.Amount = -req.Amount
+	}
+	if _, err := s.transactionService.CreateTransaction(ctx, req); err != nil {
+		return err
+	}
+
+	if _, err := s.postgres.UpdateAuthorizationStatus(ctx, a.ID, models.AuthorizationCaptured, models.AuthorizationCaptured, "", settled); err != nil {
+		return err
+	}
+	a.CapturedAmount = settled
+	return nil
+}
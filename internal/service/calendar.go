@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const (
+	// how long a replica keeps using a calendar it loaded before reading it again
+	DefaultCalendarRefresh = 5 * time.Minute
+
+	// holiday names show up in the admin listing only
+	maxHolidayNameLength = 255
+)
+
+// calendar codes are currencies (GBP) or regions (TARGET2, US-NY)
+var calendarCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{0,15}$`)
+
+type loadedCalendar struct {
+	calendar *calendar.Calendar
+	loadedAt time.Time
+}
+
+// manages the business calendars of currencies and regions used for value dating, scheduling and settlement
+// a code without holidays of its own uses the deployment's default calendar; loaded calendars are cached and
+// read again after the refresh interval, so edits reach every replica without a restart
+type CalendarService struct {
+	postgres *db.Postgres
+	defaults *calendar.Calendar
+	clock    clock.Clock
+	refresh  time.Duration
+
+	mu     sync.Mutex
+	loaded map[string]loadedCalendar
+}
+
+// creates a new CalendarService falling back to defaults
+func NewCalendarService(postgres *db.Postgres, defaults *calendar.Calendar) *CalendarService {
+	return &CalendarService{
+		postgres: postgres,
+		defaults: defaults,
+		clock:    clock.System,
+		refresh:  DefaultCalendarRefresh,
+		loaded:   make(map[string]loadedCalendar),
+	}
+}
+
+// sets how long loaded calendars are used before they are read again
+func (s *CalendarService) SetRefreshInterval(refresh time.Duration) {
+	s.refresh = refresh
+}
+
+// returns the calendar of a currency or region
+func (s *CalendarService) For(ctx context.Context, code string) (*calendar.Calendar, error) {
+	loaded, err := s.load(ctx, strings.ToUpper(code))
+	if err != nil {
+		return nil, err
+	}
+	return loaded.calendar, nil
+}
+
+// lists the calendars with holidays of their own
+func (s *CalendarService) GetCalendars(ctx context.Context) ([]*models.CalendarSummary, error) {
+	return s.postgres.GetCalendars(ctx)
+}
+
+// retrieves a calendar's holidays, or the default ones when it has none
+func (s *CalendarService) GetCalendar(ctx context.Context, code string) (*models.BusinessCalendar, error) {
+	code, err := checkCalendarCode(code)
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := s.postgres.GetHolidays(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.BusinessCalendar{Code: code, Holidays: holidays}
+	if len(holidays) == 0 {
+		result.Default = true
+		for _, day := range s.defaults.Holidays() {
+			result.Holidays = append(result.Holidays, models.Holiday{Date: day})
+		}
+	}
+	return result, nil
+}
+
+// replaces a calendar's holidays; an empty list returns the code to the default calendar
+func (s *CalendarService) ReplaceCalendar(ctx context.Context, code string, req *models.CalendarRequest) (*models.BusinessCalendar, error) {
+	code, err := checkCalendarCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(req.Holidays))
+	for _, h := range req.Holidays {
+		if _, err := time.Parse(calendar.DateLayout, h.Date); err != nil {
+			return nil, fmt.Errorf("%w: invalid holiday %q, dates are YYYY-MM-DD", ErrInvalidCalendar, h.Date)
+		}
+		if seen[h.Date] {
+			return nil, fmt.Errorf("%w: %s is listed twice", ErrInvalidCalendar, h.Date)
+		}
+		if len(h.Name) > maxHolidayNameLength {
+			return nil, fmt.Errorf("%w: holiday names are at most %d characters", ErrInvalidCalendar, maxHolidayNameLength)
+		}
+		seen[h.Date] = true
+	}
+
+	if err := s.postgres.ReplaceHolidays(ctx, code, req.Holidays); err != nil {
+		return nil, err
+	}
+	s.invalidate(code)
+	return s.GetCalendar(ctx, code)
+}
+
+// reports whether date (YYYY-MM-DD) is a business day in a calendar, with the business days either side
+func (s *CalendarService) CheckDay(ctx context.Context, code, date string) (*models.BusinessDay, error) {
+	code, err := checkCalendarCode(code)
+	if err != nil {
+		return nil, err
+	}
+	day, err := time.Parse(calendar.DateLayout, date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidCalendar)
+	}
+	c, err := s.For(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BusinessDay{
+		Calendar:    code,
+		Date:        date,
+		BusinessDay: c.IsBusinessDay(day),
+		Previous:    c.PreviousBusinessDay(day).Format(calendar.DateLayout),
+		Next:        c.NextBusinessDay(day).Format(calendar.DateLayout),
+	}, nil
+}
+
+func checkCalendarCode(code string) (string, error) {
+	code = strings.ToUpper(code)
+	if !calendarCodePattern.MatchString(code) {
+		return "", fmt.Errorf("%w: codes are 1 to 16 letters, digits, '_' or '-'", ErrInvalidCalendar)
+	}
+	return code, nil
+}
+
+// returns a cached calendar, reading it again once it is older than the refresh interval
+func (s *CalendarService) load(ctx context.Context, code string) (loadedCalendar, error) {
+	now := s.clock.Now(ctx)
+
+	s.mu.Lock()
+	cached, ok := s.loaded[code]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < s.refresh {
+		return cached, nil
+	}
+
+	holidays, err := s.postgres.GetHolidays(ctx, code)
+	if err != nil {
+		return loadedCalendar{}, err
+	}
+	loaded := loadedCalendar{calendar: s.defaults, loadedAt: now}
+	if len(holidays) > 0 {
+		days := make([]time.Time, 0, len(holidays))
+		for _, h := range holidays {
+			// dates were checked when they were saved
+			day, _ := time.Parse(calendar.DateLayout, h.Date)
+			days = append(days, day)
+		}
+		loaded.calendar = calendar.New(days...)
+	}
+
+	s.mu.Lock()
+	s.loaded[code] = loaded
+	s.mu.Unlock()
+	return loaded, nil
+}
+
+// drops a cached calendar after a change, so this replica uses it straight away
+func (s *CalendarService) invalidate(code string) {
+	s.mu.Lock()
+	delete(s.loaded, code)
+	s.mu.Unlock()
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/queue"
+)
+
+var queueLag = metrics.NewGauge(
+	"ledger_processor_queue_lag_seconds",
+	"Seconds the transaction this processor replica processed last had waited in the queue.",
+)
+
+// tracks a consumer's checkpoint between saves; deliveries are recorded by the consuming goroutine and
+// snapshots taken by the one saving them
+type consumerProgress struct {
+	mu sync.Mutex
+	cp models.ConsumerCheckpoint
+}
+
+// creates a new consumerProgress for the consumer of a source's partition
+func newConsumerProgress(consumer, source string, partition int, startedAt time.Time) *consumerProgress {
+	return &consumerProgress{cp: models.ConsumerCheckpoint{
+		Consumer:  consumer,
+		Source:    source,
+		Partition: partition,
+		StartedAt: startedAt,
+	}}
+}
+
+// counts a message delivered to the consumer
+func (p *consumerProgress) delivered(redelivered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cp.Delivered++
+	if redelivered {
+		p.cp.Redelivered++
+	}
+}
+
+// moves the checkpoint past a processed message, queued at queuedAt
+func (p *consumerProgress) processed(id string, offset, highWatermark int64, queuedAt, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cp.Processed++
+	p.cp.Offset = offset
+	p.cp.HighWatermark = highWatermark
+	p.cp.LastMessageID = id
+	p.cp.LastQueuedAt = &queuedAt
+	p.cp.ProcessedAt = &at
+}
+
+// returns a copy of the checkpoint to save
+func (p *consumerProgress) snapshot() *models.ConsumerCheckpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cp := p.cp
+	return &cp
+}
+
+// where consumer checkpoints are saved; a *db.Postgres
+type checkpointStore interface {
+	UpsertConsumerCheckpoint(ctx context.Context, cp *models.ConsumerCheckpoint) error
+}
+
+// saves the checkpoint; failures are logged, the next save catches up
+func (p *consumerProgress) save(ctx context.Context, postgres checkpointStore) {
+	if err := postgres.UpsertConsumerCheckpoint(ctx, p.snapshot()); err != nil {
+		log.Printf("Failed to save consumer checkpoint: %v", err)
+	}
+}
+
+// lists the checkpoints of the consumers that saved one in the last day, with their lag
+func (s *TransactionService) GetConsumerCheckpoints(ctx context.Context) ([]*models.ConsumerCheckpoint, error) {
+	checkpoints, err := s.postgres.GetConsumerCheckpoints(ctx, s.clock.Now(ctx).Add(-heartbeatRetention))
+	if err != nil {
+		return nil, err
+	}
+
+	// the queue's depth is the same for every consumer sharing it, so it's only asked for once
+	depths := map[string]int{}
+	for _, cp := range checkpoints {
+		lag := &models.ConsumerLag{}
+		if cp.HighWatermark > 0 {
+			lag.Messages = cp.HighWatermark - cp.Offset - 1
+		} else if cp.Source == queue.TransactionQueue {
+			depth, ok := depths[cp.Source]
+			if !ok {
+				if depth, err = s.rabbitmq.Depth(ctx, cp.Source); err != nil {
+					log.Printf("Failed to read the depth of queue %s: %v", cp.Source, err)
+				}
+				depths[cp.Source] = depth
+			}
+			lag.Messages = int64(depth)
+		}
+		if cp.LastQueuedAt != nil && cp.ProcessedAt != nil {
+			lag.Seconds = cp.ProcessedAt.Sub(*cp.LastQueuedAt).Seconds()
+		}
+		cp.Lag = lag
+	}
+
+	return checkpoints, nil
+}
+
+// logs how far behind the processor starts out: the messages waiting, and how long ago the last one any
+// replica processed had been queued
+func (s *TransactionService) reportBacklog(ctx context.Context) {
+	depth, err := s.rabbitmq.Depth(ctx, queue.TransactionQueue)
+	if err != nil {
+		log.Printf("Failed to read the depth of queue %s: %v", queue.TransactionQueue, err)
+		return
+	}
+
+	checkpoints, err := s.postgres.GetConsumerCheckpoints(ctx, time.Time{})
+	if err != nil {
+		log.Printf("Failed to read consumer checkpoints: %v", err)
+		return
+	}
+	var last *models.ConsumerCheckpoint
+	for _, cp := range checkpoints {
+		if cp.Source != queue.TransactionQueue || cp.ProcessedAt == nil {
+			continue
+		}
+		if last == nil || cp.ProcessedAt.After(*last.ProcessedAt) {
+			last = cp
+		}
+	}
+	if last == nil || depth == 0 {
+		log.Printf("Processor starting with %d transactions waiting", depth)
+		return
+	}
+	log.Printf("Processor starting with %d transactions waiting, behind by up to %s: %s last processed %s, queued at %s",
+		depth, s.clock.Now(ctx).Sub(*last.LastQueuedAt).Round(time.Second), last.Consumer, last.LastMessageID,
+		last.LastQueuedAt.Format(time.RFC3339))
+}
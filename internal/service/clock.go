@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+)
+
+// duePass is one sweep of a scheduled job over due work; an empty tenantID covers every tenant
+type duePass struct {
+	tenantID string
+	now      time.Time
+}
+
+// duePasses lists the sweeps a scheduled job makes: every tenant at the clock's time, then each
+// sandbox whose clock has been advanced at its own time, so simulated days pass without waiting for them
+func duePasses(ctx context.Context, c clock.Clock) []duePass {
+	passes := []duePass{{now: c.Now(ctx)}}
+	for tenantID, now := range clock.Ahead(ctx, c) {
+		passes = append(passes, duePass{tenantID: tenantID, now: now})
+	}
+	return passes
+}
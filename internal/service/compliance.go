@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/compliance"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// builds regulatory reporting extracts (CTR and SAR support data) over completed activity
+type ComplianceService struct {
+	postgres *db.Postgres
+	mongodb  *db.MongoDB
+	rules    compliance.Rules
+}
+
+// creates a new ComplianceService
+func NewComplianceService(postgres *db.Postgres, mongodb *db.MongoDB, rules compliance.Rules) *ComplianceService {
+	return &ComplianceService{
+		postgres: postgres,
+		mongodb:  mongodb,
+		rules:    rules,
+	}
+}
+
+// returns the over-threshold and structuring findings for completed activity in [from, to)
+func (s *ComplianceService) GetFindings(ctx context.Context, from, to time.Time) ([]models.ComplianceFinding, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("report start must be before end")
+	}
+
+	txs, err := s.mongodb.GetCompletedTransactionsInRange(ctx, "", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ledger activity: %w", err)
+	}
+
+	return s.Analyze(ctx, txs)
+}
+
+// returns the over-threshold and structuring findings for already loaded completed activity
+func (s *ComplianceService) Analyze(ctx context.Context, txs []*models.Transaction) ([]models.ComplianceFinding, error) {
+	// thresholds depend on the account currency, which only Postgres knows
+	seen := map[string]bool{}
+	var ids []string
+	for _, tx := range txs {
+		for _, id := range []string{tx.AccountID, tx.CounterpartyAccountID} {
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	currencies, err := s.postgres.GetAccountCurrencies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return compliance.Analyze(txs, func(accountID string) string { return currencies[accountID] }, s.rules), nil
+}
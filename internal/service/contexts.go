@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// how long a started sequence of ledger writes may take once it no longer follows its caller's context
+const commitTimeout = 30 * time.Second
+
+// detachedContext carries its parent's values, such as the tenant and request metadata,
+// but none of its cancellation or deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// commitContext scopes a sequence of writes that must not be split: the balance update in Postgres and
+// the status update in MongoDB either both run or neither does. It keeps ctx's values but not its
+// cancellation, so a shutdown can't cancel one write and not the other, and is bounded by commitTimeout
+func commitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{parent: ctx}, commitTimeout)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+const (
+	// counterparty names are what reports and reviewers see
+	maxCounterpartyNameLength = 255
+
+	// identifiers are lookup keys, such as a merchant ID or IBAN, not a place for documents
+	maxCounterpartyIdentifiers = 20
+)
+
+// manages the tenant's counterparty directory and reports activity grouped by counterparty
+type CounterpartyService struct {
+	postgres *db.Postgres
+	mongodb  *db.MongoDB
+}
+
+// creates a new CounterpartyService
+func NewCounterpartyService(postgres *db.Postgres, mongodb *db.MongoDB) *CounterpartyService {
+	return &CounterpartyService{
+		postgres: postgres,
+		mongodb:  mongodb,
+	}
+}
+
+// adds a counterparty to the directory; the risk rating defaults to low
+func (s *CounterpartyService) CreateCounterparty(ctx context.Context, req *models.CounterpartyRequest) (*models.Counterparty, error) {
+	c := &models.Counterparty{Name: req.Name, Identifiers: req.Identifiers, RiskRating: req.RiskRating}
+	if c.RiskRating == "" {
+		c.RiskRating = models.RiskLow
+	}
+	if err := validateCounterparty(c); err != nil {
+		return nil, err
+	}
+	if err := s.postgres.CreateCounterparty(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// retrieves a counterparty by ID
+func (s *CounterpartyService) GetCounterparty(ctx context.Context, id string) (*models.Counterparty, error) {
+	return s.postgres.GetCounterparty(ctx, id)
+}
+
+// lists the directory by name, optionally only counterparties with every given identifier
+func (s *CounterpartyService) FindCounterparties(ctx context.Context, identifiers map[string]string, limit, offset int) ([]*models.Counterparty, error) {
+	return s.postgres.FindCounterparties(ctx, identifiers, limit, offset)
+}
+
+// updates a counterparty; empty fields are left unchanged and identifiers replace the existing set
+func (s *CounterpartyService) UpdateCounterparty(ctx context.Context, id string, req *models.CounterpartyRequest) (*models.Counterparty, error) {
+	c, err := s.postgres.GetCounterparty(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" {
+		c.Name = req.Name
+	}
+	if req.Identifiers != nil {
+		c.Identifiers = req.Identifiers
+	}
+	if req.RiskRating != "" {
+		c.RiskRating = req.RiskRating
+	}
+	if err := validateCounterparty(c); err != nil {
+		return nil, err
+	}
+	if err := s.postgres.UpdateCounterparty(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func validateCounterparty(c *models.Counterparty) error {
+	if c.Name == "" || len(c.Name) > maxCounterpartyNameLength {
+		return fmt.Errorf("%w: name is required and at most %d characters", ErrInvalidCounterparty, maxCounterpartyNameLength)
+	}
+	if !c.RiskRating.Valid() {
+		return fmt.Errorf("%w: risk_rating must be low, medium or high", ErrInvalidCounterparty)
+	}
+	if len(c.Identifiers) > maxCounterpartyIdentifiers {
+		return fmt.Errorf("%w: at most %d identifiers", ErrInvalidCounterparty, maxCounterpartyIdentifiers)
+	}
+	for key, value := range c.Identifiers {
+		if key == "" || value == "" {
+			return fmt.Errorf("%w: identifiers need a non-empty key and value", ErrInvalidCounterparty)
+		}
+	}
+	return nil
+}
+
+// sums completed activity created within [from, to) per counterparty and currency, largest total first
+// an empty counterpartyID covers every counterparty
+func (s *CounterpartyService) GetActivity(ctx context.Context, counterpartyID string, from, to time.Time) ([]models.CounterpartyActivity, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: report start must be before end", ErrInvalidReport)
+	}
+
+	totals, err := s.mongodb.GetCounterpartyTotals(ctx, counterpartyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var accountIDs, counterpartyIDs []string
+	seen := map[string]bool{}
+	for _, t := range totals {
+		if !seen["a:"+t.AccountID] {
+			seen["a:"+t.AccountID] = true
+			accountIDs = append(accountIDs, t.AccountID)
+		}
+		if !seen["c:"+t.CounterpartyID] {
+			seen["c:"+t.CounterpartyID] = true
+			counterpartyIDs = append(counterpartyIDs, t.CounterpartyID)
+		}
+	}
+
+	// amounts only add up within a currency, which only Postgres knows
+	currencies, err := s.postgres.GetAccountCurrencies(ctx, accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	counterparties, err := s.postgres.GetCounterparties(ctx, counterpartyIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ counterpartyID, currency string }
+	grouped := map[key]*models.CounterpartyActivity{}
+	for _, t := range totals {
+		k := key{t.CounterpartyID, currencies[t.AccountID]}
+		activity, ok := grouped[k]
+		if !ok {
+			activity = &models.CounterpartyActivity{CounterpartyID: k.counterpartyID, Currency: k.currency}
+			if c, ok := counterparties[k.counterpartyID]; ok {
+				activity.Name, activity.RiskRating = c.Name, c.RiskRating
+			}
+			grouped[k] = activity
+		}
+		activity.Accounts++
+		activity.Count += t.Count
+		activity.Incoming += t.Incoming
+		activity.Outgoing += t.Outgoing
+	}
+
+	// sums of floats drift, so report totals at the currency's precision
+	var rounding money.Policy
+	report := make([]models.CounterpartyActivity, 0, len(grouped))
+	for _, activity := range grouped {
+		activity.Incoming = rounding.Round(activity.Incoming, activity.Currency)
+		activity.Outgoing = rounding.Round(activity.Outgoing, activity.Currency)
+		report = append(report, *activity)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.Incoming+a.Outgoing != b.Incoming+b.Outgoing {
+			return a.Incoming+a.Outgoing > b.Incoming+b.Outgoing
+		}
+		if a.CounterpartyID != b.CounterpartyID {
+			return a.CounterpartyID < b.CounterpartyID
+		}
+		return a.Currency < b.Currency
+	})
+	return report, nil
+}
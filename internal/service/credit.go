@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// number of expired credits the expiry job reclaims per run
+const creditExpiryBatchSize = 500
+
+// handles promotional credits
+type CreditService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+	clock              clock.Clock
+}
+
+// creates a new CreditService
+func NewCreditService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService) *CreditService {
+	return &CreditService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+		clock:              clock.System,
+	}
+}
+
+// sets the clock credit expiry is judged by
+func (s *CreditService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// queues a promotional credit deposit that expires at req.ExpiresAt; it is the caller's deposit, so the tenant's
+// limits, fees and rules apply to it like to any other
+func (s *CreditService) GrantCredit(ctx context.Context, accountID string, req *models.CreditGrantRequest) (*models.Transaction, error) {
+	if !req.ExpiresAt.After(s.clock.Now(ctx)) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidCreditGrant)
+	}
+
+	expiresAt := req.ExpiresAt.UTC()
+	return s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:       accountID,
+		Type:            models.Deposit,
+		Amount:          req.Amount,
+		Reference:       req.Reference,
+		CreditExpiresAt: &expiresAt,
+	})
+}
+
+// splits an account's balance into cash and unexpired promotional credit
+func (s *CreditService) GetBreakdown(ctx context.Context, account *models.Account) (*models.BalanceBreakdown, error) {
+	buckets, err := s.postgres.GetCreditBuckets(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.breakdown(account, buckets), nil
+}
+
+// splits an account's balance into cash and the remaining amounts of its credit buckets
+func (s *CreditService) breakdown(account *models.Account, buckets []*models.CreditBucket) *models.BalanceBreakdown {
+	breakdown := &models.BalanceBreakdown{Buckets: buckets}
+	for _, bucket := range buckets {
+		breakdown.Credits += bucket.Remaining
+	}
+	breakdown.Credits = s.transactionService.rounding.Round(breakdown.Credits, account.Currency)
+	breakdown.Cash = s.transactionService.rounding.Round(account.Balance-breakdown.Credits, account.Currency)
+	return breakdown
+}
+
+// removes the unspent part of expired credits from their accounts and records it in the history
+// intended to be run by the scheduler
+func (s *CreditService) RunExpiry(ctx context.Context) error {
+	for _, pass := range duePasses(ctx, s.clock) {
+		buckets, err := s.postgres.GetExpiredCreditBuckets(ctx, pass.tenantID, pass.now, creditExpiryBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range buckets {
+			if err := s.reclaim(tenant.WithTenant(ctx, bucket.TenantID), bucket, pass.now); err != nil {
+				log.Printf("Failed to reclaim credit %s: %v", bucket.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *CreditService) reclaim(ctx context.Context, bucket *models.CreditBucket, now time.Time) error {
+	reclaimed, balanceBefore, balanceAfter, err := s.postgres.ReclaimCredit(ctx, bucket, now)
+	if err != nil {
+		return err
+	}
+	if reclaimed <= 0 {
+		return nil
+	}
+
+	// the balance has already moved, so the history entry is written as completed
+	// history is stamped on the ledger's clock, not the one expiry is judged by
+	completedAt := s.transactionService.clock.Now(ctx)
+	tx := &models.Transaction{
+		ID:            s.transactionService.ids.NewID(),
+		AccountID:     bucket.AccountID,
+		Type:          models.Withdrawal,
+		Amount:        reclaimed,
+		Status:        models.Completed,
+		Reference:     "credit-expiry-" + bucket.ID,
+		BalanceBefore: balanceBefore,
+		BalanceAfter:  balanceAfter,
+		CompletedAt:   &completedAt,
+	}
+	if err := s.mongodb.CreateTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("reclaimed %.2f but failed to record it: %w", reclaimed, err)
+	}
+
+	return nil
+}
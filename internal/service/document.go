@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/render"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
+
+// renders branded statements and receipts
+type DocumentService struct {
+	postgres         *db.Postgres
+	statementService *StatementService
+	renderer         *render.Renderer
+}
+
+// creates a new DocumentService
+func NewDocumentService(postgres *db.Postgres, statementService *StatementService, renderer *render.Renderer) *DocumentService {
+	return &DocumentService{
+		postgres:         postgres,
+		statementService: statementService,
+		renderer:         renderer,
+	}
+}
+
+// retrieves a tenant's branding, returning unbranded defaults when none is set
+func (s *DocumentService) GetBranding(ctx context.Context, tenantID string) (*models.TenantBranding, error) {
+	branding, err := s.postgres.GetTenantBranding(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if branding == nil {
+		branding = &models.TenantBranding{TenantID: tenantID}
+	}
+	return branding, nil
+}
+
+// replaces a tenant's branding after checking that its templates compile
+func (s *DocumentService) UpdateBranding(ctx context.Context, tenantID string, req *models.TenantBrandingRequest) (*models.TenantBranding, error) {
+	if !tenantIDPattern.MatchString(tenantID) {
+		return nil, fmt.Errorf("invalid tenant id")
+	}
+	if req.Color != "" && !colorPattern.MatchString(req.Color) {
+		return nil, fmt.Errorf("color must be a hex colour such as #1f4e79")
+	}
+	if req.LogoURL != "" {
+		u, err := url.Parse(req.LogoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("logo_url must be an http(s) URL")
+		}
+	}
+	if _, err := render.Parse(render.Statement, req.StatementTemplate); err != nil {
+		return nil, err
+	}
+	if _, err := render.Parse(render.Receipt, req.ReceiptTemplate); err != nil {
+		return nil, err
+	}
+
+	branding := &models.TenantBranding{
+		TenantID:          tenantID,
+		Name:              req.Name,
+		LogoURL:           req.LogoURL,
+		Color:             req.Color,
+		Footer:            req.Footer,
+		StatementTemplate: req.StatementTemplate,
+		ReceiptTemplate:   req.ReceiptTemplate,
+	}
+	if err := s.postgres.UpsertTenantBranding(ctx, branding); err != nil {
+		return nil, err
+	}
+
+	return branding, nil
+}
+
+// renders an account's statement for [from, to) as a PDF in the caller tenant's branding and the request locale
+func (s *DocumentService) StatementPDF(ctx context.Context, account *models.Account, from, to time.Time) ([]byte, error) {
+	statement, err := s.statementService.BuildStatement(ctx, account, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	branding, err := s.branding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.renderer.PDF(ctx, render.Statement, branding.StatementTemplate, render.StatementData{
+		Brand:     branding,
+		Statement: statement,
+		Locale:    i18n.FromContext(ctx),
+	})
+}
+
+// renders a transaction receipt as a PDF in the caller tenant's branding
+func (s *DocumentService) ReceiptPDF(ctx context.Context, tx *models.Transaction) ([]byte, error) {
+	account, err := s.postgres.GetAccount(ctx, tx.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	branding, err := s.branding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.renderer.PDF(ctx, render.Receipt, branding.ReceiptTemplate, render.ReceiptData{
+		Brand:       branding,
+		Transaction: tx,
+		Currency:    account.Currency,
+	})
+}
+
+func (s *DocumentService) branding(ctx context.Context) (*models.TenantBranding, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenant
+	}
+	return s.GetBranding(ctx, tenantID)
+}
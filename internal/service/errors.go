@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/queue"
+	"github.com/abkawan/banking-ledger/internal/render"
+)
+
+var (
+	// ErrLimitExceeded is returned when a transaction breaks a configured limit
+	ErrLimitExceeded = i18n.NewError("error.limit_exceeded", "transaction limit exceeded")
+
+	// ErrNotAllowed is returned when tenant policy forbids the operation
+	ErrNotAllowed = i18n.NewError("error.not_allowed", "operation not allowed")
+
+	// ErrExpired is returned when a transaction outlived the processing SLA before it could be applied
+	ErrExpired = i18n.NewError("error.expired", "transaction expired")
+
+	// ErrNotPending is returned when a delivered transaction was already claimed or resolved
+	ErrNotPending = i18n.NewError("error.not_pending", "transaction is no longer pending")
+
+	// ErrTransient is returned for processing attempts given up over an outage, such as a database that can't be
+	// reached, rather than over the transaction; it stays pending and is retried
+	ErrTransient = errors.New("temporarily unable to process transaction")
+
+	// ErrOutcomeUnknown is returned when the connection failed while a balance change committed, so it may or
+	// may not have been applied; the transaction stays claimed for an operator
+	ErrOutcomeUnknown = db.ErrCommitUnknown
+
+	// ErrNotFlagged is returned when reviewing a transaction that isn't awaiting review
+	ErrNotFlagged = i18n.NewError("error.not_flagged", "transaction is not awaiting review")
+
+	// ErrNotInReview is returned when resolving a transaction that isn't awaiting compliance review
+	ErrNotInReview = i18n.NewError("error.not_in_review", "transaction is not awaiting compliance review")
+
+	// ErrInvalidEscrow is returned for escrows without distinct parties in one currency, or whose dates don't work
+	ErrInvalidEscrow = errors.New("invalid escrow")
+
+	// ErrEscrowNotFunded is returned when settling an escrow whose funds haven't reached the escrow account yet
+	ErrEscrowNotFunded = i18n.NewError("error.escrow_not_funded", "escrow is not funded yet")
+
+	// ErrEscrowClosed is returned when settling an escrow that is no longer held
+	ErrEscrowClosed = i18n.NewError("error.escrow_closed", "escrow is closed")
+
+	// ErrAuthorizationClosed is returned when capturing or releasing an authorization that no longer holds funds
+	ErrAuthorizationClosed = i18n.NewError("error.authorization_closed", "authorization is closed")
+
+	// ErrAuthorizationNotFound is returned for authorizations the tenant doesn't have
+	ErrAuthorizationNotFound = db.ErrAuthorizationNotFound
+
+	// ErrInvalidAuthorization is returned for authorization requests without a usable auth code or expiry
+	ErrInvalidAuthorization = errors.New("invalid authorization")
+
+	// ErrRuleNotFound is returned for rules the tenant doesn't have
+	ErrRuleNotFound = db.ErrRuleNotFound
+
+	// ErrInvalidRule is returned for rules with a bad name or kind or an expression that doesn't compile
+	ErrInvalidRule = i18n.NewError("error.invalid_rule", "invalid rule")
+
+	// ErrInvalidCalendar is returned for calendar codes, holidays or dates that can't be used
+	ErrInvalidCalendar = i18n.NewError("error.invalid_calendar", "invalid calendar")
+
+	// ErrInvalidCreditGrant is returned for promotional credits that have already expired
+	ErrInvalidCreditGrant = errors.New("invalid credit grant")
+
+	// ErrInvalidClockAdvance is returned for sandbox clock moves that don't go forward or go too far at once
+	ErrInvalidClockAdvance = errors.New("invalid clock advance")
+
+	// ErrInvalidStatementPreferences is returned for statement preferences with an unknown frequency or locale,
+	// or a bad or missing email
+	ErrInvalidStatementPreferences = errors.New("invalid statement preferences")
+
+	// ErrInvalidPostingDate is returned for posting dates that aren't dates or are too far ahead
+	ErrInvalidPostingDate = i18n.NewError("error.invalid_posting_date", "invalid posting date")
+
+	// ErrInvalidFundingDeadline is returned for funding deadlines that have passed or are too far ahead, or that
+	// are set without retry_on_funding
+	ErrInvalidFundingDeadline = i18n.NewError("error.invalid_funding_deadline", "invalid funding deadline")
+
+	// ErrInvalidPeriod is returned for accounting periods that aren't months or haven't ended
+	ErrInvalidPeriod = i18n.NewError("error.invalid_period", "invalid accounting period")
+
+	// ErrPeriodClosed is returned when posting into an accounting period that has been closed
+	ErrPeriodClosed = i18n.NewError("error.period_closed", "accounting period is closed")
+
+	// ErrTemplateNotFound is returned for transaction templates the tenant doesn't have
+	ErrTemplateNotFound = db.ErrTemplateNotFound
+
+	// ErrInvalidTemplate is returned for transaction templates that couldn't be executed as saved
+	ErrInvalidTemplate = i18n.NewError("error.invalid_template", "invalid transaction template")
+
+	// ErrQuoteNotFound is returned for quotes the tenant doesn't have
+	ErrQuoteNotFound = db.ErrQuoteNotFound
+
+	// ErrInvalidQuote is returned when a transaction names a quote for a different transaction
+	ErrInvalidQuote = i18n.NewError("error.invalid_quote", "quote does not match the transaction")
+
+	// ErrQuoteExpired is returned when a transaction names a quote whose lock has run out
+	ErrQuoteExpired = i18n.NewError("error.quote_expired", "quote has expired")
+
+	// ErrQuoteUsed is returned when a transaction names a quote another transaction has used
+	ErrQuoteUsed = i18n.NewError("error.quote_used", "quote has already been used")
+
+	// ErrTransactionGroupNotFound is returned for multi-leg transactions the tenant doesn't have
+	ErrTransactionGroupNotFound = i18n.NewError("error.transaction_group_not_found", "transaction group not found")
+
+	// ErrInvalidTransactionGroup is returned for multi-leg transactions whose legs can't be applied together
+	ErrInvalidTransactionGroup = i18n.NewError("error.invalid_transaction_group", "invalid transaction group")
+
+	// ErrInvalidReport is returned for reports and statements with an unknown bucket or a bad date range
+	ErrInvalidReport = errors.New("invalid report")
+
+	// ErrInvalidLookup is returned for bulk lookups without ids or with more than MaxLookupIDs
+	ErrInvalidLookup = i18n.NewError("error.invalid_lookup", "invalid lookup")
+
+	// ErrInvalidExport is returned for export requests with an unknown kind or format, or a bad period
+	ErrInvalidExport = i18n.NewError("error.invalid_export", "invalid export")
+
+	// ErrExportNotFound is returned for exports the tenant doesn't have, including expired ones
+	ErrExportNotFound = db.ErrExportNotFound
+
+	// ErrExportNotReady is returned when downloading an export that hasn't completed
+	ErrExportNotReady = i18n.NewError("error.export_not_ready", "export is not ready")
+
+	// ErrStatementNotArchived is returned for statement deliveries without an archived statement
+	ErrStatementNotArchived = i18n.NewError("error.statement_not_archived", "statement is not archived")
+
+	// ErrQueueNotFound is returned for queues operators can't inspect
+	ErrQueueNotFound = i18n.NewError("error.queue_not_found", "queue not found")
+
+	// ErrInvalidSubscription is returned for live subscriptions without an id or to an unknown topic
+	ErrInvalidSubscription = i18n.NewError("error.invalid_subscription", "invalid subscription")
+
+	// ErrSubscriptionExists is returned for live subscriptions reusing the id of one still open
+	ErrSubscriptionExists = i18n.NewError("error.subscription_exists", "subscription id already in use")
+
+	// ErrSubscriptionNotFound is returned for unsubscribing from a live subscription that isn't open
+	ErrSubscriptionNotFound = i18n.NewError("error.subscription_not_found", "subscription not found")
+
+	// ErrTooManySubscriptions is returned once a live connection holds the most subscriptions it may
+	ErrTooManySubscriptions = i18n.NewError("error.too_many_subscriptions", "too many subscriptions")
+
+	// ErrAccountUpdatesUnavailable is returned for account subscriptions on an API without Redis to receive them from
+	ErrAccountUpdatesUnavailable = i18n.NewError("error.account_updates_unavailable", "account updates are unavailable")
+
+	// ErrModified is returned by conditional updates when the resource changed after the version they were based on
+	ErrModified = db.ErrModified
+
+	// ErrAccountNotFound is returned for accounts the tenant doesn't have
+	ErrAccountNotFound = db.ErrAccountNotFound
+
+	// ErrExceptionNotFound is returned for exceptions the tenant doesn't have
+	ErrExceptionNotFound = db.ErrExceptionNotFound
+
+	// ErrExceptionResolved is returned when reassigning or refunding an exception that is no longer open
+	ErrExceptionResolved = i18n.NewError("error.exception_resolved", "exception is already resolved")
+
+	// ErrResolutionPending is returned when the transaction resolving an exception is still being processed; the
+	// exception stays open, and retrying the resolution waits for the same transaction
+	ErrResolutionPending = errors.New("the transaction resolving the exception is still processing")
+
+	// ErrResolutionFailed is returned when the transaction resolving an exception failed; the exception stays open
+	ErrResolutionFailed = errors.New("the transaction resolving the exception failed")
+
+	// ErrInvalidCounterparty is returned for counterparties without a usable name, risk rating or identifiers
+	ErrInvalidCounterparty = errors.New("invalid counterparty")
+
+	// ErrCounterpartyNotFound is returned for counterparties the tenant doesn't have
+	ErrCounterpartyNotFound = db.ErrCounterpartyNotFound
+
+	// ErrWebhookSubscriptionNotFound is returned for webhook subscriptions the tenant doesn't have
+	ErrWebhookSubscriptionNotFound = db.ErrWebhookSubscriptionNotFound
+
+	// ErrKYCRequired is returned when tenant policy needs a verified account for the transaction type
+	ErrKYCRequired = i18n.NewError("error.kyc_required", "kyc verification required")
+
+	// ErrDuplicateReference is returned when creating an account with an external reference the tenant already uses
+	ErrDuplicateReference = db.ErrDuplicateReference
+
+	// ErrInvalidReferenceNamespace is returned for API key reference namespaces that aren't lowercase slugs
+	ErrInvalidReferenceNamespace = i18n.NewError("error.invalid_reference_namespace", "invalid reference namespace")
+
+	// ErrInvalidAPIKey is returned for API keys the ledger didn't issue
+	ErrInvalidAPIKey = i18n.NewError("error.invalid_api_key", "invalid api key")
+
+	// ErrUnknownTimezone is returned for tenant timezones that aren't IANA zone names
+	ErrUnknownTimezone = i18n.NewError("error.unknown_timezone", "unknown timezone")
+
+	// ErrInvalidReference is returned for transaction references that are too long or use unsupported characters
+	ErrInvalidReference = i18n.NewError("error.invalid_reference", "invalid reference")
+
+	// ErrInvalidMetadata is returned for transaction metadata over the size limits
+	ErrInvalidMetadata = i18n.NewError("error.invalid_metadata", "invalid metadata")
+
+	// ErrReferenceConflict is returned when a reference the account already used arrives with a different type, amount or counterparty
+	ErrReferenceConflict = i18n.NewError("error.reference_conflict", "reference already used for a different transaction")
+
+	// ErrInvalidAmount is returned for amounts with too many decimal places or outside the configured bounds
+	ErrInvalidAmount = money.ErrInvalidAmount
+
+	// ErrIngestionUnavailable is returned when new transactions can't be queued: the broker is down and the spool is full
+	ErrIngestionUnavailable = queue.ErrUnavailable
+
+	// ErrRenderUnavailable is returned for PDF documents when no converter is configured
+	ErrRenderUnavailable = render.ErrUnavailable
+
+	// ErrMaintenance refuses writes while an operator has maintenance mode on
+	ErrMaintenance = i18n.NewError("error.maintenance", "service is under maintenance")
+
+	// ErrRegionNotActive refuses writes in a region whose replication role isn't active
+	ErrRegionNotActive = i18n.NewError("error.region_not_active", "region is not active")
+
+	// ErrActiveRegionAlive is returned when promoting a region while the active one is still heard from
+	ErrActiveRegionAlive = errors.New("active region is still publishing")
+
+	// ErrReplicationConflict is returned when the region's role changed while it was being promoted or demoted
+	ErrReplicationConflict = errors.New("replication role changed concurrently")
+)
+
+// ReferenceConflictError is the ErrReferenceConflict returned for a mismatched retry; the digests let a client
+// see which side differs without the ledger echoing the stored transaction to whoever sent the reference
+type ReferenceConflictError struct {
+	Reference     string
+	StoredDigest  string
+	RequestDigest string
+}
+
+func (e *ReferenceConflictError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrReferenceConflict, e.Reference)
+}
+
+func (e *ReferenceConflictError) Unwrap() error {
+	return ErrReferenceConflict
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// how long an escrow waits for release before it is refunded when the request doesn't say
+const defaultEscrowExpiry = 7 * 24 * time.Hour
+
+// handles escrowed payments
+type EscrowService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+	clock              clock.Clock
+}
+
+// creates a new EscrowService
+func NewEscrowService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService) *EscrowService {
+	return &EscrowService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+		clock:              clock.System,
+	}
+}
+
+// sets the clock release times and expiries are judged by
+func (s *EscrowService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// references of the transfers that move an escrow's funds
+func escrowHoldReference(id string) string   { return "escrow-" + id + "-hold" }
+func escrowSettleReference(id string) string { return "escrow-" + id + "-settle" }
+
+// returns when an escrow opened at now expires when the request doesn't say: after the default expiry, moved on to
+// the next business day of the currency so the refund isn't made when nobody is around to query it
+func (s *EscrowService) defaultExpiry(ctx context.Context, now time.Time, currency string) (time.Time, error) {
+	expiresAt := now.Add(defaultEscrowExpiry)
+	c, err := s.transactionService.calendarFor(ctx, currency)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for !c.IsBusinessDay(expiresAt.UTC()) {
+		expiresAt = expiresAt.AddDate(0, 0, 1)
+	}
+	return expiresAt, nil
+}
+
+// opens an escrow and queues the transfer of the payer's funds into the escrow account
+func (s *EscrowService) CreateEscrow(ctx context.Context, req *models.EscrowRequest) (*models.Escrow, error) {
+	if req.PayerAccountID == "" || req.PayeeAccountID == "" || req.PayerAccountID == req.PayeeAccountID {
+		return nil, fmt.Errorf("%w: escrow requires distinct payer and payee accounts", ErrInvalidEscrow)
+	}
+
+	payer, err := s.postgres.GetAccount(ctx, req.PayerAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("payer %w", ErrAccountNotFound)
+	}
+	payee, err := s.postgres.GetAccount(ctx, req.PayeeAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("payee %w", ErrAccountNotFound)
+	}
+	if payer.Kind != models.CustomerAccount || payee.Kind != models.CustomerAccount {
+		return nil, fmt.Errorf("%w: escrow parties must be customer accounts", ErrNotAllowed)
+	}
+	if payer.Currency != payee.Currency {
+		return nil, fmt.Errorf("%w: escrow accounts must share a currency", ErrInvalidEscrow)
+	}
+	if err := money.Validate(req.Amount, payer.Currency, s.transactionService.bounds); err != nil {
+		return nil, err
+	}
+	// the hold is a system transfer, so the caller's own cap is checked here
+	if err := CheckKeyLimit(ctx, req.Amount); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now(ctx)
+	expiresAt, err := s.defaultExpiry(ctx, now, payer.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidEscrow)
+	}
+	if req.ReleaseAt != nil && !req.ReleaseAt.Before(expiresAt) {
+		return nil, fmt.Errorf("%w: release_at must be before expires_at", ErrInvalidEscrow)
+	}
+
+	escrowAccount, err := s.postgres.GetOrCreateSystemAccount(ctx, models.EscrowAccount, payer.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	escrow := &models.Escrow{
+		PayerAccountID:  payer.ID,
+		PayeeAccountID:  payee.ID,
+		EscrowAccountID: escrowAccount.ID,
+		Amount:          req.Amount,
+		Currency:        payer.Currency,
+		Reference:       req.Reference,
+		ReleaseAt:       req.ReleaseAt,
+		ExpiresAt:       expiresAt,
+	}
+	if err := s.postgres.CreateEscrow(ctx, escrow); err != nil {
+		return nil, err
+	}
+
+	_, err = s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:             payer.ID,
+		CounterpartyAccountID: escrowAccount.ID,
+		Type:                  models.Transfer,
+		Amount:                req.Amount,
+		Reference:             escrowHoldReference(escrow.ID),
+		System:                true,
+	})
+	if err != nil {
+		if _, updateErr := s.postgres.UpdateEscrowStatus(ctx, escrow.ID, models.EscrowHeld, models.EscrowCancelled); updateErr != nil {
+			log.Printf("Failed to cancel escrow %s: %v", escrow.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	return escrow, nil
+}
+
+// retrieves an escrow by ID
+func (s *EscrowService) GetEscrow(ctx context.Context, id string) (*models.Escrow, error) {
+	return s.postgres.GetEscrow(ctx, id)
+}
+
+// pays the escrowed funds out to the payee
+func (s *EscrowService) Release(ctx context.Context, id string) (*models.Escrow, error) {
+	return s.settle(ctx, id, models.EscrowReleased)
+}
+
+// returns the escrowed funds to the payer
+func (s *EscrowService) Refund(ctx context.Context, id string) (*models.Escrow, error) {
+	return s.settle(ctx, id, models.EscrowRefunded)
+}
+
+func (s *EscrowService) settle(ctx context.Context, id string, outcome models.EscrowStatus) (*models.Escrow, error) {
+	escrow, err := s.postgres.GetEscrow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.Status != models.EscrowHeld {
+		return nil, fmt.Errorf("%w: escrow is %s", ErrEscrowClosed, escrow.Status)
+	}
+
+	// the escrow account pools every open escrow, so only funds that actually arrived may leave
+	hold, err := s.mongodb.GetTransactionByReference(ctx, "", escrow.PayerAccountID, escrowHoldReference(escrow.ID))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case hold == nil || hold.Status == models.Failed:
+		if _, err := s.postgres.UpdateEscrowStatus(ctx, escrow.ID, models.EscrowHeld, models.EscrowCancelled); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: the payer's funds never reached escrow", ErrEscrowClosed)
+	case hold.Status != models.Completed:
+		return nil, ErrEscrowNotFunded
+	}
+
+	// an escrow has one settlement reference, so a concurrent or earlier release and refund can't both pay out:
+	// the second is refused as a conflicting retry, and a retried settlement replays the first
+	recipient := escrow.PayeeAccountID
+	if outcome == models.EscrowRefunded {
+		recipient = escrow.PayerAccountID
+	}
+	_, err = s.transactionService.CreateTransaction(ctx, &models.TransactionRequest{
+		AccountID:             escrow.EscrowAccountID,
+		CounterpartyAccountID: recipient,
+		Type:                  models.Transfer,
+		Amount:                escrow.Amount,
+		Reference:             escrowSettleReference(escrow.ID),
+		System:                true,
+	})
+	if errors.Is(err, ErrReferenceConflict) {
+		s.recordSettlement(ctx, escrow)
+		return nil, fmt.Errorf("%w: escrow was settled concurrently", ErrEscrowClosed)
+	}
+	if err != nil {
+		// the escrow is still held, so the settlement can be retried
+		return nil, err
+	}
+
+	// the status only moves once the payout is queued
+	settled, err := s.postgres.UpdateEscrowStatus(ctx, escrow.ID, models.EscrowHeld, outcome)
+	if err != nil {
+		return nil, err
+	}
+	if !settled {
+		current, err := s.postgres.GetEscrow(ctx, escrow.ID)
+		if err != nil {
+			return nil, err
+		}
+		if current.Status != outcome {
+			return nil, fmt.Errorf("%w: escrow was settled concurrently", ErrEscrowClosed)
+		}
+	}
+
+	escrow.Status = outcome
+	return escrow, nil
+}
+
+// moves a held escrow to the outcome of the settlement already queued for it, for a settlement that lost to it
+func (s *EscrowService) recordSettlement(ctx context.Context, escrow *models.Escrow) {
+	payout, err := s.mongodb.GetTransactionByReference(ctx, "", escrow.EscrowAccountID, escrowSettleReference(escrow.ID))
+	if err != nil || payout == nil {
+		log.Printf("Failed to find the settlement of escrow %s: %v", escrow.ID, err)
+		return
+	}
+	outcome := models.EscrowReleased
+	if payout.CounterpartyAccountID == escrow.PayerAccountID {
+		outcome = models.EscrowRefunded
+	}
+	if _, err := s.postgres.UpdateEscrowStatus(ctx, escrow.ID, models.EscrowHeld, outcome); err != nil {
+		log.Printf("Failed to settle escrow %s: %v", escrow.ID, err)
+	}
+}
+
+// releases escrows whose release time has passed and refunds expired ones
+// intended to be run by the scheduler
+func (s *EscrowService) RunDue(ctx context.Context) error {
+	for _, pass := range duePasses(ctx, s.clock) {
+		escrows, err := s.postgres.GetDueEscrows(ctx, pass.tenantID, pass.now)
+		if err != nil {
+			return err
+		}
+
+		for _, escrow := range escrows {
+			// release_at always precedes expires_at, so a passed release time wins
+			outcome := models.EscrowRefunded
+			if escrow.ReleaseAt != nil && !escrow.ReleaseAt.After(pass.now) {
+				outcome = models.EscrowReleased
+			}
+
+			escrowCtx := tenant.WithTenant(ctx, escrow.TenantID)
+			if _, err := s.settle(escrowCtx, escrow.ID, outcome); err != nil && err != ErrEscrowNotFunded {
+				log.Printf("Failed to settle escrow %s: %v", escrow.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+var openedExceptions = metrics.NewCounter(
+	"ledger_exceptions_opened_total",
+	"Deposits that couldn't be applied and were posted to the suspense account for an operator.",
+)
+
+// suspends a deposit that can't be applied: its funds have already arrived, so they go to the suspense account on
+// an open exception instead of being failed and forgotten. Other transactions fail as before, since their funds
+// never left the customer. account is nil when it couldn't be loaded
+func (s *TransactionService) suspendOrFail(ctx context.Context, tx *models.Transaction, account *models.Account, err error) error {
+	if !suspends(tx) {
+		return s.markTransactionFailed(ctx, tx, err)
+	}
+
+	exception := &models.TransactionException{
+		TransactionID: tx.ID,
+		AccountID:     tx.AccountID,
+		Amount:        tx.Amount,
+		Reason:        err.Error(),
+	}
+	if account != nil {
+		exception.Currency = account.Currency
+	}
+	// left pending, so the attempt is recorded; the claim is released and the attempt retried when the
+	// database was only out of reach
+	if openErr := s.postgres.OpenException(ctx, exception); openErr != nil {
+		openErr = fmt.Errorf("failed to open exception for %v: %w", err, openErr)
+		if db.IsTransient(openErr) {
+			return s.retryLater(ctx, openErr, tx)
+		}
+		return openErr
+	}
+
+	tx.Status = models.Suspended
+	tx.FailureReason = err.Error()
+	if updateErr := s.mongodb.SuspendTransaction(ctx, tx.ID, tx.FailureReason); updateErr != nil {
+		log.Printf("%sFailed to mark transaction %s as suspended: %v", reqctx.LogPrefix(ctx), tx.ID, updateErr)
+	} else {
+		s.record(ctx, tx, models.TimelineSuspended, tx.FailureReason)
+	}
+	openedExceptions.Inc()
+	return err
+}
+
+// reports whether a transaction that can't be applied is suspended rather than failed: deposits, except
+// promotional credit, which is the ledger's own money and has nothing to hold
+func suspends(tx *models.Transaction) bool {
+	return tx.Type == models.Deposit && tx.CreditExpiresAt == nil
+}
+
+// handles the exceptions workflow: deposits parked in the suspense account are reassigned to another account or
+// refunded by an operator
+type ExceptionService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+}
+
+// creates a new ExceptionService
+func NewExceptionService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService) *ExceptionService {
+	return &ExceptionService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+	}
+}
+
+// how long resolving an exception waits for the transaction moving its funds
+const resolutionBudget = 10 * time.Second
+
+// reference of the transaction that resolves an exception; the same for reassigning and refunding, so only one
+// of them can ever move the funds out of suspense. Each attempt after a failed one gets the next reference
+func exceptionReference(id string, attempt int) string {
+	if attempt <= 1 {
+		return "exception-" + id
+	}
+	return fmt.Sprintf("exception-%s-%d", id, attempt)
+}
+
+// retrieves an exception by ID
+func (s *ExceptionService) GetException(ctx context.Context, id string) (*models.TransactionException, error) {
+	return s.postgres.GetException(ctx, id)
+}
+
+// lists the tenant's exceptions, oldest first; an empty status lists them all
+func (s *ExceptionService) GetExceptions(ctx context.Context, status models.ExceptionStatus, limit, offset int) ([]*models.TransactionException, error) {
+	return s.postgres.GetExceptions(ctx, status, limit, offset)
+}
+
+// credits an open exception's funds to a customer account in its currency, moving them out of suspense
+func (s *ExceptionService) Reassign(ctx context.Context, id string, req *models.ReassignExceptionRequest) (*models.TransactionException, error) {
+	exception, err := s.open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.postgres.GetAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	if target.Kind != models.CustomerAccount {
+		return nil, fmt.Errorf("%w: exceptions can only be reassigned to customer accounts", ErrNotAllowed)
+	}
+	if exception.Currency != "" && target.Currency != exception.Currency {
+		return nil, fmt.Errorf("%w: account %s is in %s, the exception is in %s", ErrNotAllowed, target.ID, target.Currency, exception.Currency)
+	}
+
+	// funds that never reached suspense arrive straight in the target account
+	txReq := &models.TransactionRequest{
+		AccountID: target.ID,
+		Type:      models.Deposit,
+		Amount:    exception.Amount,
+		System:    true,
+	}
+	if exception.Currency != "" {
+		suspense, err := s.postgres.GetOrCreateSystemAccount(ctx, models.SuspenseAccount, exception.Currency)
+		if err != nil {
+			return nil, err
+		}
+		txReq.AccountID = suspense.ID
+		txReq.CounterpartyAccountID = target.ID
+		txReq.Type = models.Transfer
+	}
+
+	exception.Status = models.ExceptionReassigned
+	exception.ReassignedTo = target.ID
+	return s.resolve(ctx, exception, txReq, "reassigned to account "+target.ID)
+}
+
+// pays an open exception's funds back out of suspense to the sender
+func (s *ExceptionService) Refund(ctx context.Context, id string) (*models.TransactionException, error) {
+	exception, err := s.open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing reached suspense when the currency wasn't known, so there is nothing to pay out
+	var txReq *models.TransactionRequest
+	if exception.Currency != "" {
+		suspense, err := s.postgres.GetOrCreateSystemAccount(ctx, models.SuspenseAccount, exception.Currency)
+		if err != nil {
+			return nil, err
+		}
+		txReq = &models.TransactionRequest{
+			AccountID: suspense.ID,
+			Type:      models.Withdrawal,
+			Amount:    exception.Amount,
+			System:    true,
+		}
+	}
+
+	exception.Status = models.ExceptionRefunded
+	return s.resolve(ctx, exception, txReq, "refunded")
+}
+
+// retrieves an exception that is still open
+func (s *ExceptionService) open(ctx context.Context, id string) (*models.TransactionException, error) {
+	exception, err := s.postgres.GetException(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if exception.Status != models.ExceptionOpen {
+		return nil, fmt.Errorf("%w: %s", ErrExceptionResolved, exception.Status)
+	}
+	return exception, nil
+}
+
+// moves the funds, if any, then records the resolution on the exception and the suspended transaction; the
+// exception is only closed once the funds have moved, and a retry after a failure part-way finds the same
+// transaction by its reference
+func (s *ExceptionService) resolve(ctx context.Context, exception *models.TransactionException, txReq *models.TransactionRequest, outcome string) (*models.TransactionException, error) {
+	if txReq != nil {
+		tx, err := s.moveFunds(ctx, exception, txReq)
+		if err != nil {
+			return nil, err
+		}
+		exception.ResolutionTransactionID = tx.ID
+	}
+
+	exception.ResolvedBy = reqctx.FromContext(ctx).Actor
+	resolved, err := s.postgres.ResolveException(ctx, exception)
+	if err != nil {
+		return nil, err
+	}
+	if !resolved {
+		return nil, ErrExceptionResolved
+	}
+
+	event := models.TimelineReassigned
+	if exception.Status == models.ExceptionRefunded {
+		event = models.TimelineRefunded
+	}
+	tx, err := s.mongodb.ResolveSuspendedTransaction(ctx, exception.TransactionID, outcome)
+	if err != nil {
+		log.Printf("%sFailed to resolve suspended transaction %s: %v", reqctx.LogPrefix(ctx), exception.TransactionID, err)
+	} else if tx != nil {
+		s.transactionService.record(ctx, tx, event, exception.ResolutionTransactionID)
+	}
+
+	return exception, nil
+}
+
+// queues the transaction resolving an exception, under the reference of the first attempt that hasn't failed, and
+// waits for it to complete
+func (s *ExceptionService) moveFunds(ctx context.Context, exception *models.TransactionException, txReq *models.TransactionRequest) (*models.Transaction, error) {
+	for attempt := 1; ; attempt++ {
+		txReq.Reference = exceptionReference(exception.ID, attempt)
+		previous, err := s.mongodb.GetTransactionByReference(ctx, "", txReq.AccountID, txReq.Reference)
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil || previous.Status != models.Failed {
+			break
+		}
+	}
+
+	tx, err := s.transactionService.CreateTransaction(ctx, txReq)
+	if err != nil {
+		return nil, err
+	}
+	tx, err = s.transactionService.WaitForTransaction(ctx, tx.ID, resolutionBudget)
+	if err != nil {
+		return nil, err
+	}
+	switch tx.Status {
+	case models.Completed:
+		return tx, nil
+	case models.Failed:
+		return nil, fmt.Errorf("%w: %s", ErrResolutionFailed, tx.FailureReason)
+	default:
+		return nil, ErrResolutionPending
+	}
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/compliance"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/export"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/storage"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// DefaultExportWorkers is how many exports each replica builds at once
+	DefaultExportWorkers = 2
+
+	// DefaultExportRetention is how long finished exports can be downloaded
+	DefaultExportRetention = 7 * 24 * time.Hour
+
+	// how often idle workers look for queued exports
+	exportPollInterval = 2 * time.Second
+
+	// a running export that reported no progress for this long is taken over by another worker
+	exportStaleAfter = 5 * time.Minute
+
+	// how often expired exports are deleted
+	exportSweepInterval = 10 * time.Minute
+
+	// how long the signed URL a download redirects to stays valid
+	exportDownloadTTL = 15 * time.Minute
+)
+
+// builds large exports in the background, so callers poll a job instead of holding a request open for minutes
+// jobs are queued in Postgres and claimed by the workers of any replica
+type ExportService struct {
+	postgres   *db.Postgres
+	reports    *ReportService
+	compliance *ComplianceService
+
+	maintenance *MaintenanceService
+	store       storage.Store
+	clock       clock.Clock
+	workers     int
+	retention   time.Duration
+}
+
+// creates a new ExportService
+func NewExportService(postgres *db.Postgres, reports *ReportService, compliance *ComplianceService) *ExportService {
+	return &ExportService{
+		postgres:   postgres,
+		reports:    reports,
+		compliance: compliance,
+		clock:      clock.System,
+		workers:    DefaultExportWorkers,
+		retention:  DefaultExportRetention,
+	}
+}
+
+// sets the switch that pauses claiming new exports during maintenance windows
+func (s *ExportService) SetMaintenance(maintenance *MaintenanceService) {
+	s.maintenance = maintenance
+}
+
+// sets the clock finished exports expire by
+func (s *ExportService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the object storage finished exports are kept in instead of Postgres
+func (s *ExportService) SetStorage(store storage.Store) {
+	s.store = store
+}
+
+// sets how many exports this replica builds at once
+func (s *ExportService) SetWorkers(workers int) {
+	s.workers = workers
+}
+
+// sets how long finished exports, and the reasons of failed ones, are kept
+func (s *ExportService) SetRetention(retention time.Duration) {
+	s.retention = retention
+}
+
+// validates an export request and queues it
+func (s *ExportService) CreateExport(ctx context.Context, req *models.CreateExportRequest) (*models.ExportJob, error) {
+	if !req.Kind.Valid() {
+		return nil, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidExport, models.ExportJournal, models.ExportCompliance)
+	}
+	from, err := time.Parse("2006-01-02", req.From)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from must be a date in YYYY-MM-DD format", ErrInvalidExport)
+	}
+	to, err := time.Parse("2006-01-02", req.To)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to must be a date in YYYY-MM-DD format", ErrInvalidExport)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidExport)
+	}
+
+	format := strings.ToLower(req.Format)
+	switch req.Kind {
+	case models.ExportJournal:
+		if _, err := export.New(export.Format(format)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+	case models.ExportCompliance:
+		if format != "" && format != "json" && format != "csv" {
+			return nil, fmt.Errorf("%w: unsupported export format: %s", ErrInvalidExport, req.Format)
+		}
+		if req.AccountID != "" {
+			return nil, fmt.Errorf("%w: account_id only applies to journal exports", ErrInvalidExport)
+		}
+	}
+	if format == "" {
+		format = "json"
+	}
+
+	job := &models.ExportJob{
+		Kind:      req.Kind,
+		Format:    format,
+		AccountID: req.AccountID,
+		From:      from,
+		To:        to,
+		Total:     int(to.Sub(from)/(24*time.Hour)) + 1,
+	}
+	if err := s.postgres.CreateExportJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// retrieves an export and its progress
+func (s *ExportService) GetExport(ctx context.Context, id string) (*models.ExportJob, error) {
+	return s.postgres.GetExportJob(ctx, id)
+}
+
+// retrieves the finished file of an export; ErrExportNotReady until it completed
+func (s *ExportService) GetArtifact(ctx context.Context, id string) (*models.ExportArtifact, error) {
+	artifact, err := s.postgres.GetExportArtifact(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if artifact == nil {
+		return nil, ErrExportNotReady
+	}
+	if artifact.Key != "" {
+		if s.store == nil {
+			return nil, fmt.Errorf("export %s is in object storage, which isn't configured", id)
+		}
+		artifact.URL, err = s.store.SignedURL(ctx, artifact.Key, artifact.Filename, exportDownloadTTL)
+		if errors.Is(err, storage.ErrNotSignable) {
+			// encrypted blobs are decrypted, and checked against their manifest, on the way through
+			artifact.Content, err = s.store.Get(ctx, artifact.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to download export: %w", err)
+		}
+	}
+	return artifact, nil
+}
+
+// starts the export workers and the sweep of expired exports; they stop with ctx
+// an export in progress at shutdown goes back to the queue for the next worker
+func (s *ExportService) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		go s.work(ctx)
+	}
+	go s.sweep(ctx)
+}
+
+func (s *ExportService) work(ctx context.Context) {
+	for {
+		if s.maintenance != nil && !s.maintenance.Wait(ctx) {
+			return
+		}
+		job, err := s.postgres.ClaimExportJob(ctx, exportStaleAfter)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim export: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(exportPollInterval):
+			}
+			continue
+		}
+		s.run(ctx, job)
+	}
+}
+
+// builds a claimed export and records its outcome
+func (s *ExportService) run(ctx context.Context, job *models.ExportJob) {
+	jobCtx := tenant.WithTenant(ctx, job.TenantID)
+	artifact, err := s.build(jobCtx, job)
+	if err == nil {
+		job.Size = int64(len(artifact.Content))
+		sum := sha256.Sum256(artifact.Content)
+		job.Checksum = hex.EncodeToString(sum[:])
+		artifact.Checksum = job.Checksum
+		err = s.upload(jobCtx, job, artifact)
+	}
+
+	// the outcome is recorded even when shutdown started while the export was built
+	doneCtx, cancel := commitContext(jobCtx)
+	defer cancel()
+	switch {
+	case errors.Is(err, db.ErrExportLost):
+		log.Printf("Export %s was taken over by another worker", job.ID)
+	case err != nil && ctx.Err() != nil:
+		if err := s.postgres.RequeueExportJob(doneCtx, job); err != nil {
+			log.Printf("Failed to requeue export %s: %v", job.ID, err)
+		}
+	case err != nil:
+		log.Printf("Export %s failed: %v", job.ID, err)
+		if err := s.postgres.FailExportJob(doneCtx, job, err.Error(), s.clock.Now(doneCtx).Add(s.retention)); err != nil {
+			log.Printf("Failed to record failure of export %s: %v", job.ID, err)
+		}
+	default:
+		if err := s.postgres.CompleteExportJob(doneCtx, job, artifact, s.clock.Now(doneCtx).Add(s.retention)); err != nil {
+			log.Printf("Failed to store export %s: %v", job.ID, err)
+		}
+	}
+}
+
+// stores a finished artifact in object storage, when there is one, leaving its key in place of the content
+func (s *ExportService) upload(ctx context.Context, job *models.ExportJob, artifact *models.ExportArtifact) error {
+	if s.store == nil {
+		return nil
+	}
+	key := "exports/" + job.TenantID + "/" + job.ID + "/" + artifact.Filename
+	if err := s.store.Put(ctx, key, artifact.ContentType, artifact.Content); err != nil {
+		return fmt.Errorf("failed to store export: %w", err)
+	}
+	artifact.Key = key
+	return nil
+}
+
+// loads the export's period a day at a time, reporting each day as progress, then renders the artifact
+func (s *ExportService) build(ctx context.Context, job *models.ExportJob) (*models.ExportArtifact, error) {
+	var txs []*models.Transaction
+	end := job.To.AddDate(0, 0, 1)
+	for day := job.From; day.Before(end); day = day.AddDate(0, 0, 1) {
+		found, err := s.reports.GetJournalEntries(ctx, job.AccountID, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, found...)
+
+		job.Done++
+		if err := s.postgres.UpdateExportProgress(ctx, job); err != nil {
+			return nil, err
+		}
+	}
+
+	period := job.From.Format("2006-01-02") + "-" + job.To.Format("2006-01-02")
+	var buf bytes.Buffer
+	switch job.Kind {
+	case models.ExportCompliance:
+		findings, err := s.compliance.Analyze(ctx, txs)
+		if err != nil {
+			return nil, err
+		}
+		if job.Format == "csv" {
+			if err := compliance.WriteCSV(&buf, findings); err != nil {
+				return nil, fmt.Errorf("failed to write compliance extract: %w", err)
+			}
+			return &models.ExportArtifact{Filename: "compliance-" + period + ".csv", ContentType: "text/csv", Content: buf.Bytes()}, nil
+		}
+		if findings == nil {
+			findings = []models.ComplianceFinding{}
+		}
+		if err := json.NewEncoder(&buf).Encode(findings); err != nil {
+			return nil, fmt.Errorf("failed to write compliance extract: %w", err)
+		}
+		return &models.ExportArtifact{Filename: "compliance-" + period + ".json", ContentType: "application/json", Content: buf.Bytes()}, nil
+	default:
+		exporter, err := export.New(export.Format(job.Format))
+		if err != nil {
+			return nil, err
+		}
+		if err := exporter.Write(&buf, txs); err != nil {
+			return nil, fmt.Errorf("failed to write journal: %w", err)
+		}
+		return &models.ExportArtifact{
+			Filename:    "journal-" + period + "." + exporter.FileExtension(),
+			ContentType: exporter.ContentType(),
+			Content:     buf.Bytes(),
+		}, nil
+	}
+}
+
+// deletes expired exports until ctx ends
+func (s *ExportService) sweep(ctx context.Context) {
+	ticker := time.NewTicker(exportSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			keys, err := s.postgres.DeleteExpiredExports(ctx, s.clock.Now(ctx))
+			if err != nil {
+				log.Printf("Failed to delete expired exports: %v", err)
+				continue
+			}
+			if s.store == nil {
+				continue
+			}
+			for _, key := range keys {
+				if err := s.store.Delete(ctx, key); err != nil {
+					log.Printf("Failed to delete expired export %s: %v", key, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// how long a parked debit waits for funds when the policy doesn't say, and the longest it may
+	defaultFundingWaitHours = 24
+	maxFundingWaitHours     = 30 * 24
+
+	// how often a debit parked in retry mode is tried again when the policy doesn't say
+	defaultFundingRetryMinutes = 60
+
+	// the most transactions a credit to one account releases at once
+	awaitingFundsBatchSize = 100
+)
+
+var awaitingFunds = metrics.NewCounter(
+	"ledger_transactions_awaiting_funds_total",
+	"Withdrawals and transfers parked by an insufficient funds policy instead of failed.",
+)
+
+// validates an insufficient funds policy and fills in its defaults; an empty mode fails debits as before
+func checkFundingPolicy(p models.InsufficientFundsPolicy) (models.InsufficientFundsPolicy, error) {
+	switch p.Mode {
+	case "", models.FailOnInsufficientFunds:
+		return models.InsufficientFundsPolicy{Mode: models.FailOnInsufficientFunds}, nil
+	case models.RetryOnInsufficientFunds, models.ProcessWhenFunded:
+	default:
+		return p, fmt.Errorf("unknown insufficient funds mode: %s", p.Mode)
+	}
+
+	if p.WaitHours < 0 || p.WaitHours > maxFundingWaitHours {
+		return p, fmt.Errorf("wait_hours must be between 0 and %d, 0 meaning %d", maxFundingWaitHours, defaultFundingWaitHours)
+	}
+	if p.WaitHours == 0 {
+		p.WaitHours = defaultFundingWaitHours
+	}
+
+	if p.Mode == models.ProcessWhenFunded {
+		p.RetryIntervalMinutes = 0
+		return p, nil
+	}
+	if p.RetryIntervalMinutes < 0 {
+		return p, fmt.Errorf("retry_interval_minutes cannot be negative")
+	}
+	if p.RetryIntervalMinutes == 0 {
+		p.RetryIntervalMinutes = defaultFundingRetryMinutes
+	}
+	if p.RetryInterval() > p.Wait() {
+		return p, fmt.Errorf("retry_interval_minutes cannot be longer than wait_hours")
+	}
+	return p, nil
+}
+
+// retrieves the insufficient funds policy applied to an account's debits: its own, or else the tenant's
+func (s *TransactionService) GetFundingPolicy(ctx context.Context, accountID string) (*models.AccountFundingPolicy, error) {
+	account, err := s.postgres.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	return s.fundingPolicy(ctx, account)
+}
+
+// sets an account's own insufficient funds policy, overriding the tenant's
+func (s *TransactionService) UpdateFundingPolicy(ctx context.Context, accountID string, req *models.InsufficientFundsPolicy) (*models.AccountFundingPolicy, error) {
+	checked, err := checkFundingPolicy(*req)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &models.AccountFundingPolicy{
+		AccountID:         accountID,
+		InsufficientFunds: checked,
+		Source:            models.FundingPolicyFromAccount,
+	}
+	if err := s.postgres.UpsertAccountFundingPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// removes an account's own insufficient funds policy and returns the tenant's, which applies from now on
+// transactions already awaiting funds keep their deadline
+func (s *TransactionService) DeleteFundingPolicy(ctx context.Context, accountID string) (*models.AccountFundingPolicy, error) {
+	if err := s.postgres.DeleteAccountFundingPolicy(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return s.GetFundingPolicy(ctx, accountID)
+}
+
+// resolves the insufficient funds policy of an account
+func (s *TransactionService) fundingPolicy(ctx context.Context, account *models.Account) (*models.AccountFundingPolicy, error) {
+	policy, err := s.postgres.GetAccountFundingPolicy(ctx, account.ID)
+	if err != nil || policy != nil {
+		return policy, err
+	}
+
+	settings, err := s.tenants.GetSettings(ctx, account.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	insufficientFunds := settings.InsufficientFunds
+	if insufficientFunds.Mode == "" {
+		insufficientFunds.Mode = models.FailOnInsufficientFunds
+	}
+	return &models.AccountFundingPolicy{
+		AccountID:         account.ID,
+		InsufficientFunds: insufficientFunds,
+		Source:            models.FundingPolicyFromTenant,
+	}, nil
+}
+
+// checks a withdrawal's opt-in to wait for funds and returns its funding deadline; nil when it didn't opt in
+func (s *TransactionService) fundingDeadline(ctx context.Context, req *models.TransactionRequest) (*time.Time, error) {
+	if !req.RetryOnFunding {
+		if req.FundingDeadline != nil {
+			return nil, fmt.Errorf("%w: funding_deadline needs retry_on_funding", ErrInvalidFundingDeadline)
+		}
+		return nil, nil
+	}
+	if req.Type != models.Withdrawal {
+		return nil, fmt.Errorf("%w: retry_on_funding is only available for withdrawals", ErrInvalidFundingDeadline)
+	}
+
+	now := s.clock.Now(ctx)
+	if req.FundingDeadline == nil {
+		deadline := now.Add(defaultFundingWaitHours * time.Hour)
+		return &deadline, nil
+	}
+	if !req.FundingDeadline.After(now) {
+		return nil, fmt.Errorf("%w: funding_deadline must be in the future", ErrInvalidFundingDeadline)
+	}
+	if req.FundingDeadline.After(now.Add(maxFundingWaitHours * time.Hour)) {
+		return nil, fmt.Errorf("%w: funding_deadline is more than %d days ahead", ErrInvalidFundingDeadline, maxFundingWaitHours/24)
+	}
+	deadline := req.FundingDeadline.UTC()
+	return &deadline, nil
+}
+
+// handles a claimed withdrawal or transfer the balance couldn't cover: it fails, or is parked awaiting funds
+// under the account's policy until its deadline, which is kept from the first time it was parked
+func (s *TransactionService) insufficientFunds(ctx context.Context, tx *models.Transaction, account *models.Account, cause error) error {
+	if tx.Type == models.Deposit || account.Kind != models.CustomerAccount {
+		return s.markTransactionFailed(ctx, tx, cause)
+	}
+
+	// a withdrawal that opted in waits for a deposit, whatever the account's policy
+	policy := models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, WaitHours: defaultFundingWaitHours}
+	if !tx.RetryOnFunding {
+		resolved, err := s.fundingPolicy(ctx, account)
+		if db.IsTransient(err) {
+			return s.retryLater(ctx, err, tx)
+		}
+		if err != nil {
+			return s.markTransactionFailed(ctx, tx, cause)
+		}
+		policy = resolved.InsufficientFunds
+	}
+	if !policy.Parks() {
+		return s.markTransactionFailed(ctx, tx, cause)
+	}
+
+	now := s.clock.Now(ctx)
+	deadline, next := parkSchedule(policy, tx, now)
+	if !now.Before(deadline) {
+		return s.markTransactionFailed(ctx, tx, fmt.Errorf("%w; no funds arrived by %s", cause, deadline.UTC().Format(time.RFC3339)))
+	}
+
+	mode := policy.Mode
+	detail := "waiting for a credit until " + deadline.UTC().Format(time.RFC3339)
+	if next != nil {
+		detail = fmt.Sprintf("retrying at %s until %s", next.UTC().Format(time.RFC3339), deadline.UTC().Format(time.RFC3339))
+	}
+
+	parked, err := s.mongodb.AwaitFunds(ctx, tx.ID, mode, deadline, next)
+	if db.IsTransient(err) {
+		return s.retryLater(ctx, err, tx)
+	}
+	if err != nil {
+		return s.markTransactionFailed(ctx, tx, cause)
+	}
+	if !parked {
+		return fmt.Errorf("%w: %s", ErrNotPending, tx.ID)
+	}
+
+	tx.Status = models.AwaitingFunds
+	tx.FundingMode = mode
+	tx.FundingDeadline = &deadline
+	tx.NextRetryAt = next
+	s.record(ctx, tx, models.TimelineAwaitingFunds, detail)
+	awaitingFunds.Inc()
+
+	log.Printf("%sTransaction %s is awaiting funds on account %s: %s", reqctx.LogPrefix(ctx), tx.ID, tx.AccountID, detail)
+	return nil
+}
+
+// returns when a debit parked now under the policy stops waiting, kept from the first time it was parked, and
+// when it is next retried, never after the deadline; nil unless the policy retries
+func parkSchedule(policy models.InsufficientFundsPolicy, tx *models.Transaction, now time.Time) (time.Time, *time.Time) {
+	deadline := now.Add(policy.Wait())
+	if tx.FundingDeadline != nil {
+		deadline = *tx.FundingDeadline
+	}
+	if policy.Mode != models.RetryOnInsufficientFunds {
+		return deadline, nil
+	}
+	next := now.Add(policy.RetryInterval())
+	if next.After(deadline) {
+		next = deadline
+	}
+	return deadline, &next
+}
+
+// releases the debits parked awaiting funds that a completed deposit or transfer, or group leg, may now cover
+func (s *TransactionService) creditApplied(ctx context.Context, tx *models.Transaction) {
+	switch tx.Type {
+	case models.Deposit:
+		s.fundsArrived(ctx, tx.AccountID, tx.Type)
+	case models.Transfer:
+		s.fundsArrived(ctx, tx.CounterpartyAccountID, tx.Type)
+	}
+}
+
+// queues again the account's transactions waiting for a credit once its balance covers them, oldest first;
+// one too large to cover doesn't hold back smaller ones behind it. Called after a credit of the given type to the
+// account; withdrawals that opted in with retry_on_funding only qualify for deposits
+func (s *TransactionService) fundsArrived(ctx context.Context, accountID string, credit models.TransactionType) {
+	waiting, err := s.mongodb.GetAwaitingFunds(ctx, accountID, awaitingFundsBatchSize)
+	if err != nil {
+		log.Printf("%sFailed to find transactions awaiting funds on account %s: %v", reqctx.LogPrefix(ctx), accountID, err)
+		return
+	}
+	if len(waiting) == 0 {
+		return
+	}
+
+	account, err := s.postgres.GetAccount(ctx, accountID)
+	if err != nil {
+		log.Printf("%sFailed to get account %s to release transactions awaiting funds: %v", reqctx.LogPrefix(ctx), accountID, err)
+		return
+	}
+
+	for _, tx := range releasable(waiting, account.Balance, credit) {
+		if err := s.releaseAwaitingFunds(ctx, tx, fmt.Sprintf("balance %g covers it", account.Balance)); err != nil {
+			log.Printf("%sFailed to release transaction %s awaiting funds: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		}
+	}
+}
+
+// picks the transactions waiting for a credit of the given type that the balance covers, taking them oldest
+// first and skipping any too large to cover
+func releasable(waiting []*models.Transaction, balance float64, credit models.TransactionType) []*models.Transaction {
+	var released []*models.Transaction
+	available := balance
+	for _, tx := range waiting {
+		debit := tx.Amount + tx.Fee
+		if debit > available || (tx.RetryOnFunding && credit != models.Deposit) {
+			continue
+		}
+		available -= debit
+		released = append(released, tx)
+	}
+	return released
+}
+
+// returns a transaction awaiting funds to pending and queues it again
+func (s *TransactionService) releaseAwaitingFunds(ctx context.Context, tx *models.Transaction, detail string) error {
+	released, err := s.mongodb.ReleaseAwaitingFunds(ctx, tx.ID)
+	if err != nil {
+		return err
+	}
+	if released == nil {
+		// released or failed some other way in the meantime
+		return nil
+	}
+	s.record(ctx, released, models.TimelineReleased, detail)
+
+	ctx = reqctx.WithMetadata(ctx, reqctx.Metadata{RequestID: released.RequestID})
+	if err := s.rabbitmq.PublishTransaction(ctx, released); err != nil {
+		// park it again, due straight away, so the funding job tries again and the deadline still applies
+		now := s.clock.Now(ctx)
+		if _, parkErr := s.mongodb.AwaitFunds(ctx, tx.ID, released.FundingMode, *released.FundingDeadline, &now); parkErr != nil {
+			log.Printf("%sFailed to park transaction %s again after queueing failed: %v", reqctx.LogPrefix(ctx), tx.ID, parkErr)
+		}
+		return fmt.Errorf("failed to requeue transaction: %w", err)
+	}
+	s.record(ctx, released, models.TimelineQueued, "")
+	return nil
+}
+
+// fails a transaction that waited for funds past its deadline and notifies the account holder
+func (s *TransactionService) failAwaitingFunds(ctx context.Context, tx *models.Transaction) {
+	cause := fmt.Errorf("failed to update balance: %w; no funds arrived by %s", db.ErrInsufficientFunds,
+		tx.FundingDeadline.UTC().Format(time.RFC3339))
+	failed, err := s.mongodb.FailAwaitingFunds(ctx, tx.ID, cause.Error())
+	if err != nil {
+		log.Printf("Failed to fail transaction %s awaiting funds: %v", tx.ID, err)
+		return
+	}
+	if !failed {
+		return
+	}
+
+	tx.Status = models.Failed
+	tx.FailureReason = cause.Error()
+	s.record(ctx, tx, models.TimelineFailed, tx.FailureReason)
+	if s.notifier != nil {
+		s.notifier.TransactionFailed(tx, cause)
+	}
+	log.Printf("Failed transaction %s: no funds arrived by its deadline", tx.ID)
+}
+
+// queues again transactions awaiting funds whose retry is due and fails the ones whose deadline has passed
+// intended to be run by the scheduler
+func (s *TransactionService) RunAwaitingFunds(ctx context.Context) error {
+	now := s.clock.Now(ctx)
+	txs, err := s.mongodb.GetDueAwaitingFunds(ctx, now, retryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	ctx = withComponent(ctx, "scheduler")
+	for _, tx := range txs {
+		txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+
+		if retryDue(tx, now) {
+			if err := s.releaseAwaitingFunds(txCtx, tx, "retrying"); err != nil {
+				log.Printf("Failed to retry transaction %s awaiting funds: %v", tx.ID, err)
+			}
+			continue
+		}
+		s.failAwaitingFunds(txCtx, tx)
+	}
+
+	return nil
+}
+
+// reports whether a due transaction awaiting funds is retried rather than failed; a retry due at the deadline
+// still gets its last attempt, which fails the transaction if it comes short
+func retryDue(tx *models.Transaction, now time.Time) bool {
+	return tx.NextRetryAt != nil && !tx.NextRetryAt.After(now)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+func TestCheckFundingPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy models.InsufficientFundsPolicy
+		want   models.InsufficientFundsPolicy
+		ok     bool
+	}{
+		{"empty mode fails", models.InsufficientFundsPolicy{WaitHours: 5},
+			models.InsufficientFundsPolicy{Mode: models.FailOnInsufficientFunds}, true},
+		{"fail drops the rest", models.InsufficientFundsPolicy{Mode: models.FailOnInsufficientFunds, WaitHours: 5, RetryIntervalMinutes: 10},
+			models.InsufficientFundsPolicy{Mode: models.FailOnInsufficientFunds}, true},
+		{"retry defaults", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds},
+			models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: defaultFundingWaitHours, RetryIntervalMinutes: defaultFundingRetryMinutes}, true},
+		{"retry kept", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 2, RetryIntervalMinutes: 15},
+			models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 2, RetryIntervalMinutes: 15}, true},
+		{"retry every wait", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 1, RetryIntervalMinutes: 60},
+			models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 1, RetryIntervalMinutes: 60}, true},
+		{"longest wait", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: maxFundingWaitHours},
+			models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: maxFundingWaitHours, RetryIntervalMinutes: defaultFundingRetryMinutes}, true},
+		{"process when funded drops the interval", models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, RetryIntervalMinutes: 10},
+			models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, WaitHours: defaultFundingWaitHours}, true},
+
+		{"unknown mode", models.InsufficientFundsPolicy{Mode: "queue"}, models.InsufficientFundsPolicy{}, false},
+		{"negative wait", models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, WaitHours: -1}, models.InsufficientFundsPolicy{}, false},
+		{"wait too long", models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, WaitHours: maxFundingWaitHours + 1}, models.InsufficientFundsPolicy{}, false},
+		{"negative interval", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, RetryIntervalMinutes: -5}, models.InsufficientFundsPolicy{}, false},
+		{"interval past the wait", models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 1, RetryIntervalMinutes: 61}, models.InsufficientFundsPolicy{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkFundingPolicy(tt.policy)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("accepted %+v", tt.policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParkSchedule(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	retry := models.InsufficientFundsPolicy{Mode: models.RetryOnInsufficientFunds, WaitHours: 24, RetryIntervalMinutes: 60}
+	funded := models.InsufficientFundsPolicy{Mode: models.ProcessWhenFunded, WaitHours: 24}
+
+	t.Run("first park", func(t *testing.T) {
+		deadline, next := parkSchedule(retry, &models.Transaction{}, now)
+		if !deadline.Equal(now.Add(24 * time.Hour)) {
+			t.Fatalf("deadline %s", deadline)
+		}
+		if next == nil || !next.Equal(now.Add(time.Hour)) {
+			t.Fatalf("next retry %v", next)
+		}
+	})
+
+	t.Run("process when funded isn't retried", func(t *testing.T) {
+		if _, next := parkSchedule(funded, &models.Transaction{}, now); next != nil {
+			t.Fatalf("next retry %s", next)
+		}
+	})
+
+	t.Run("re-park keeps the deadline", func(t *testing.T) {
+		// first parked 20 hours ago with a day to wait
+		first := now.Add(4 * time.Hour)
+		deadline, next := parkSchedule(retry, &models.Transaction{FundingDeadline: &first}, now)
+		if !deadline.Equal(first) {
+			t.Fatalf("deadline moved to %s, want %s", deadline, first)
+		}
+		if next == nil || !next.Equal(now.Add(time.Hour)) {
+			t.Fatalf("next retry %v", next)
+		}
+	})
+
+	t.Run("retry clamped to the deadline", func(t *testing.T) {
+		first := now.Add(20 * time.Minute)
+		deadline, next := parkSchedule(retry, &models.Transaction{FundingDeadline: &first}, now)
+		if next == nil || !next.Equal(deadline) {
+			t.Fatalf("next retry %v, want the deadline %s", next, deadline)
+		}
+	})
+}
+
+func TestReleasable(t *testing.T) {
+	waiting := []*models.Transaction{
+		{ID: "oldest", Type: models.Withdrawal, Amount: 60, Fee: 1},
+		{ID: "too-large", Type: models.Withdrawal, Amount: 500},
+		{ID: "opted-in", Type: models.Withdrawal, Amount: 10, RetryOnFunding: true},
+		{ID: "transfer", Type: models.Transfer, Amount: 30},
+		{ID: "newest", Type: models.Withdrawal, Amount: 20},
+	}
+	ids := func(txs []*models.Transaction) []string {
+		var out []string
+		for _, tx := range txs {
+			out = append(out, tx.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		balance float64
+		credit  models.TransactionType
+		want    []string
+	}{
+		{"oldest first, skipping what doesn't fit", 100, models.Deposit, []string{"oldest", "opted-in", "newest"}},
+		{"smaller ones behind a large one", 40, models.Deposit, []string{"opted-in", "transfer"}},
+		{"transfer doesn't release an opted-in withdrawal", 100, models.Transfer, []string{"oldest", "transfer"}},
+		{"everything", 1000, models.Deposit, []string{"oldest", "too-large", "opted-in", "transfer", "newest"}},
+		{"nothing", 5, models.Deposit, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(releasable(waiting, tt.balance, tt.credit))
+			if len(got) != len(tt.want) {
+				t.Fatalf("released %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("released %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDue(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name string
+		tx   *models.Transaction
+		want bool
+	}{
+		{"retry due", &models.Transaction{NextRetryAt: at(-time.Minute), FundingDeadline: at(time.Hour)}, true},
+		{"retry due at the deadline", &models.Transaction{NextRetryAt: at(0), FundingDeadline: at(0)}, true},
+		{"deadline passed before the retry", &models.Transaction{NextRetryAt: at(time.Minute), FundingDeadline: at(0)}, false},
+		{"process when funded past the deadline", &models.Transaction{FundingDeadline: at(-time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		if got := retryDue(tt.tx, now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFundingDeadline(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	s := &TransactionService{clock: clock.NewManual(now)}
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name string
+		req  models.TransactionRequest
+		want *time.Time
+		ok   bool
+	}{
+		{"not opted in", models.TransactionRequest{Type: models.Withdrawal}, nil, true},
+		{"defaults to a day", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true}, at(24 * time.Hour), true},
+		{"given deadline", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true, FundingDeadline: at(2 * time.Hour)}, at(2 * time.Hour), true},
+		{"thirty days ahead", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true, FundingDeadline: at(maxFundingWaitHours * time.Hour)}, at(maxFundingWaitHours * time.Hour), true},
+
+		{"deadline without the flag", models.TransactionRequest{Type: models.Withdrawal, FundingDeadline: at(time.Hour)}, nil, false},
+		{"not a withdrawal", models.TransactionRequest{Type: models.Transfer, RetryOnFunding: true}, nil, false},
+		{"deadline now", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true, FundingDeadline: at(0)}, nil, false},
+		{"deadline passed", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true, FundingDeadline: at(-time.Minute)}, nil, false},
+		{"more than thirty days ahead", models.TransactionRequest{Type: models.Withdrawal, RetryOnFunding: true, FundingDeadline: at(maxFundingWaitHours*time.Hour + time.Second)}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.fundingDeadline(context.Background(), &tt.req)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidFundingDeadline) {
+					t.Fatalf("got %v, want ErrInvalidFundingDeadline", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Fatalf("deadline %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptedInWithdrawalsWaitForDeposits(t *testing.T) {
+	waiting := []*models.Transaction{
+		{ID: "opted-in", Type: models.Withdrawal, Amount: 10, RetryOnFunding: true},
+	}
+	if got := releasable(waiting, 100, models.Transfer); len(got) != 0 {
+		t.Fatal("a transfer released a withdrawal that opted in to wait for a deposit")
+	}
+	if got := releasable(waiting, 100, models.Deposit); len(got) != 1 {
+		t.Fatal("a deposit didn't release a withdrawal that opted in")
+	}
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// a group is at least a payment and something on top of it
+const (
+	minGroupLegs = 2
+	maxGroupLegs = 20
+)
+
+// creates a multi-leg transaction: each leg is checked like a transaction of its own, then all of them are stored
+// under one group ID and the first leg is queued to carry the group through processing. Legs are referenced
+// <reference>.<leg>, and a retry with the group's reference returns the stored legs
+func (s *TransactionService) CreateTransactionGroup(ctx context.Context, req *models.TransactionGroupRequest) ([]*models.Transaction, error) {
+	if len(req.Legs) < minGroupLegs || len(req.Legs) > maxGroupLegs {
+		return nil, fmt.Errorf("%w: a group has %d to %d legs", ErrInvalidTransactionGroup, minGroupLegs, maxGroupLegs)
+	}
+	if err := validateReference(req.Reference); err != nil {
+		return nil, err
+	}
+	reference := req.Reference
+	if reference == "" {
+		reference = s.ids.NewID()
+	}
+
+	for i := range req.Legs {
+		if req.Legs[i].Role == "" {
+			req.Legs[i].Role = models.LegOriginal
+		}
+	}
+
+	// the first leg's reference stands for the group
+	namespace := reqctx.FromContext(ctx).ReferenceNamespace
+	existing, err := s.mongodb.GetTransactionByReference(ctx, namespace, req.Legs[0].AccountID, legReference(reference, 1))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check for existing transaction: %w", err)
+	}
+	if existing != nil {
+		return s.replayGroup(ctx, req, reference, existing)
+	}
+
+	if err := checkLegRelations(req.Legs); err != nil {
+		return nil, err
+	}
+
+	groupID := s.ids.NewID()
+	legs := make([]*models.Transaction, 0, len(req.Legs))
+	for i, leg := range req.Legs {
+		if err := s.checkLeg(ctx, &leg); err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i+1, err)
+		}
+
+		// legs alike are expected in a group, so they aren't flagged as duplicates of each other
+		tx, _, replay, err := s.draftTransaction(ctx, &models.TransactionRequest{
+			AccountID:             leg.AccountID,
+			Type:                  leg.Type,
+			Amount:                leg.Amount,
+			Reference:             legReference(reference, i+1),
+			CounterpartyAccountID: leg.CounterpartyAccountID,
+			CounterpartyID:        leg.CounterpartyID,
+			Metadata:              leg.Metadata,
+			AllowDuplicate:        true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i+1, err)
+		}
+		if replay {
+			return nil, fmt.Errorf("%w: leg %d reference %s is already used", ErrReferenceConflict, i+1, tx.Reference)
+		}
+		tx.GroupID = groupID
+		tx.Leg = i + 1
+		tx.LegRole = leg.Role
+		tx.RelatedLeg = leg.RelatedLeg
+		legs = append(legs, tx)
+	}
+
+	// nothing is stored for a group that couldn't be queued anyway
+	if !s.rabbitmq.Accepting() {
+		return nil, ErrIngestionUnavailable
+	}
+
+	release, err := s.reserveVolume(ctx, false, legs...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range legs {
+		accepted := s.timelineEvent(ctx, tx, models.TimelineAccepted, "leg of group "+groupID)
+		accepted.Status = models.Pending
+		tx.Timeline = []models.TimelineEvent{accepted}
+	}
+	if err := s.mongodb.CreateTransactions(ctx, legs); err != nil {
+		release()
+		return nil, fmt.Errorf("Failed to create transaction group: %w", err)
+	}
+
+	if err := s.rabbitmq.PublishTransaction(ctx, legs[0]); err != nil {
+		return nil, fmt.Errorf("failed to queue transaction: %w", err)
+	}
+	s.record(ctx, legs[0], models.TimelineQueued, "")
+
+	return legs, nil
+}
+
+// retrieves the legs of a multi-leg transaction in order
+func (s *TransactionService) GetTransactionGroup(ctx context.Context, id string) ([]*models.Transaction, error) {
+	legs, err := s.mongodb.GetTransactionsByGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(legs) == 0 {
+		return nil, ErrTransactionGroupNotFound
+	}
+	return legs, nil
+}
+
+// checks the parts of a leg the transaction checks don't cover
+func (s *TransactionService) checkLeg(ctx context.Context, leg *models.TransactionLeg) error {
+	switch leg.Type {
+	case models.Deposit, models.Withdrawal, models.Transfer:
+	default:
+		return fmt.Errorf("%w: legs are deposits, withdrawals or transfers", ErrInvalidTransactionGroup)
+	}
+	if leg.Amount <= 0 {
+		return fmt.Errorf("%w: amounts must be positive", ErrInvalidAmount)
+	}
+
+	// a screening hit parks a single transaction for review; a group can't be held back a leg at a time
+	tenantID, _ := tenant.FromContext(ctx)
+	if s.screener != nil && leg.Type != models.Deposit && leg.Amount >= s.screeningThreshold && !tenant.IsSandbox(tenantID) {
+		return fmt.Errorf("%w: payments of %g or more are screened and must be sent on their own", ErrInvalidTransactionGroup, s.screeningThreshold)
+	}
+	return nil
+}
+
+// checks how the legs of a group relate: originals stand alone, every other leg names an earlier leg it belongs
+// to, and a reversal moves no more than that leg did, between the same accounts the other way
+func checkLegRelations(legs []models.TransactionLeg) error {
+	for i, leg := range legs {
+		n := i + 1
+		switch leg.Role {
+		case models.LegOriginal:
+			if leg.RelatedLeg != 0 {
+				return fmt.Errorf("%w: leg %d is an original and can't relate to another leg", ErrInvalidTransactionGroup, n)
+			}
+			continue
+		case models.LegFee, models.LegTax, models.LegReversal, models.LegAdjustment:
+		default:
+			return fmt.Errorf("%w: leg %d has unknown role %q", ErrInvalidTransactionGroup, n, leg.Role)
+		}
+		if leg.RelatedLeg < 1 || leg.RelatedLeg >= n {
+			return fmt.Errorf("%w: leg %d must relate to an earlier leg", ErrInvalidTransactionGroup, n)
+		}
+
+		related := legs[leg.RelatedLeg-1]
+		if leg.Role != models.LegReversal {
+			continue
+		}
+		if related.Role == models.LegReversal {
+			return fmt.Errorf("%w: leg %d reverses a reversal", ErrInvalidTransactionGroup, n)
+		}
+		if leg.Amount > related.Amount {
+			return fmt.Errorf("%w: leg %d reverses more than leg %d moved", ErrInvalidTransactionGroup, n, leg.RelatedLeg)
+		}
+		if !reverses(leg, related) {
+			return fmt.Errorf("%w: leg %d doesn't move leg %d's money back", ErrInvalidTransactionGroup, n, leg.RelatedLeg)
+		}
+	}
+	return nil
+}
+
+// reports whether leg moves money the opposite way to related, between the same accounts
+func reverses(leg, related models.TransactionLeg) bool {
+	switch related.Type {
+	case models.Transfer:
+		return leg.Type == models.Transfer && leg.AccountID == related.CounterpartyAccountID && leg.CounterpartyAccountID == related.AccountID
+	case models.Deposit:
+		return leg.Type == models.Withdrawal && leg.AccountID == related.AccountID
+	case models.Withdrawal:
+		return leg.Type == models.Deposit && leg.AccountID == related.AccountID
+	}
+	return false
+}
+
+// returns the stored legs of a group whose reference was used before, if the retry asks for the same legs
+func (s *TransactionService) replayGroup(ctx context.Context, req *models.TransactionGroupRequest, reference string, first *models.Transaction) ([]*models.Transaction, error) {
+	var legs []*models.Transaction
+	if first.GroupID != "" {
+		var err error
+		if legs, err = s.mongodb.GetTransactionsByGroup(ctx, first.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	stored := make([]models.TransactionLeg, 0, len(legs))
+	for _, tx := range legs {
+		stored = append(stored, models.TransactionLeg{
+			AccountID:             tx.AccountID,
+			Type:                  tx.Type,
+			Amount:                tx.Amount,
+			CounterpartyAccountID: tx.CounterpartyAccountID,
+			Role:                  tx.LegRole,
+			RelatedLeg:            tx.RelatedLeg,
+		})
+	}
+	storedDigest, requestDigest := groupDigest(stored), groupDigest(req.Legs)
+	if len(legs) == 0 || storedDigest != requestDigest {
+		return nil, &ReferenceConflictError{Reference: reference, StoredDigest: storedDigest, RequestDigest: requestDigest}
+	}
+	return legs, nil
+}
+
+// reference of a group's leg, counting from 1
+func legReference(reference string, leg int) string {
+	return fmt.Sprintf("%s.%d", reference, leg)
+}
+
+// groupDigest fingerprints the legs a retry must repeat, in order: their accounts, roles and what requestDigest covers
+func groupDigest(legs []models.TransactionLeg) string {
+	parts := make([]string, 0, len(legs))
+	for _, leg := range legs {
+		parts = append(parts, fmt.Sprintf("%s|%s|%d|%s", leg.AccountID, leg.Role, leg.RelatedLeg,
+			requestDigest(leg.Type, leg.Amount, leg.CounterpartyAccountID)))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// processes a multi-leg transaction, delivered as its first leg: every leg is claimed and checked, then the
+// balances move in one database transaction, so the whole group completes or all of it fails. Refused deposits
+// fail with the rest instead of being suspended, since none of the group's money has moved
+func (s *TransactionService) processGroup(ctx context.Context, head *models.Transaction) error {
+	legs, err := s.mongodb.GetTransactionsByGroup(ctx, head.GroupID)
+	if err != nil {
+		return err
+	}
+	if len(legs) == 0 || legs[0].ID != head.ID {
+		return fmt.Errorf("%w: %s is not the first leg of group %s", ErrNotPending, head.ID, head.GroupID)
+	}
+
+	// the first leg waits in the holding queue for the whole group while any of its accounts is paused
+	var accountIDs []string
+	for _, leg := range legs {
+		accountIDs = append(accountIDs, leg.AccountID)
+		if leg.CounterpartyAccountID != "" {
+			accountIDs = append(accountIDs, leg.CounterpartyAccountID)
+		}
+	}
+	paused, err := s.postgres.FindPausedAccount(ctx, accountIDs...)
+	if err != nil {
+		return err
+	}
+	if paused != "" {
+		return s.hold(ctx, head, paused)
+	}
+
+	// the processing SLA runs on the first leg; the others wait on it
+	var queuedAfter time.Time
+	if s.sla > 0 {
+		queuedAfter = s.clock.Now(ctx).Add(-s.sla)
+	}
+	claimed, err := s.mongodb.ClaimTransaction(ctx, head.ID, queuedAfter)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		if s.sla > 0 && head.UpdatedAt.Before(queuedAfter) {
+			return s.expire(ctx, head, queuedAfter)
+		}
+		return fmt.Errorf("%w: %s", ErrNotPending, head.ID)
+	}
+	for i, leg := range legs[1:] {
+		claimed, err := s.mongodb.ClaimTransaction(ctx, leg.ID, time.Time{})
+		if db.IsTransient(err) {
+			return s.retryLater(ctx, err, legs[:i+1]...)
+		}
+		if err == nil && !claimed {
+			err = fmt.Errorf("%w: leg %d", ErrNotPending, leg.Leg)
+		}
+		if err != nil {
+			return s.failLegs(ctx, legs, err)
+		}
+	}
+	for _, leg := range legs {
+		s.record(ctx, leg, models.TimelinePickedUp, "")
+	}
+
+	// every leg is checked as a single transaction would be before any balance moves
+	accounts := make([]*models.Account, len(legs))
+	for i, leg := range legs {
+		account, err := s.postgres.GetAccount(ctx, leg.AccountID)
+		if db.IsTransient(err) {
+			return s.retryLater(ctx, err, legs...)
+		}
+		if err != nil {
+			return s.failLegs(ctx, legs, fmt.Errorf("leg %d: account not found: %w", leg.Leg, err))
+		}
+		if err := money.Validate(leg.Amount, account.Currency, s.bounds); err != nil {
+			return s.failLegs(ctx, legs, fmt.Errorf("leg %d: %w", leg.Leg, err))
+		}
+		if err := money.CheckPrecision(leg.Fee, account.Currency); err != nil || leg.Fee < 0 {
+			return s.failLegs(ctx, legs, fmt.Errorf("leg %d: %w: invalid fee", leg.Leg, ErrInvalidAmount))
+		}
+		if err := s.checkKYC(ctx, leg, account); db.IsTransient(err) {
+			return s.retryLater(ctx, err, legs...)
+		} else if err != nil {
+			return s.failLegs(ctx, legs, fmt.Errorf("leg %d: %w", leg.Leg, err))
+		}
+		if err := s.preProcess(ctx, leg, account); db.IsTransient(err) {
+			return s.retryLater(ctx, err, legs...)
+		} else if err != nil {
+			return s.failLegs(ctx, legs, fmt.Errorf("leg %d: %w", leg.Leg, err))
+		}
+		accounts[i] = account
+	}
+
+	balances, err := s.postgres.ApplyLegs(ctx, legs)
+	switch {
+	case errors.Is(err, ErrOutcomeUnknown):
+		log.Printf("%sALERT: balance updates of group %s may or may not have been applied: %v", reqctx.LogPrefix(ctx), head.GroupID, err)
+		return fmt.Errorf("failed to update balances: %w", err)
+	case db.IsTransient(err):
+		return s.retryLater(ctx, fmt.Errorf("failed to update balances: %w", err), legs...)
+	case err != nil:
+		return s.failLegs(ctx, legs, fmt.Errorf("failed to update balances: %w", err))
+	}
+
+	completedAt := s.clock.Now(ctx)
+	latency := latencyOf(head, completedAt)
+	for i, leg := range legs {
+		balance := balances[i]
+		s.record(ctx, leg, models.TimelineBalanceApplied, fmt.Sprintf("balance %g -> %g", balance.Before, balance.After))
+
+		if err := s.mongodb.CompleteTransaction(ctx, leg.ID, balance.Before, balance.After, completedAt, latency); err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+		s.observeCompletion(latency)
+
+		leg.Status = models.Completed
+		leg.BalanceBefore, leg.BalanceAfter = balance.Before, balance.After
+		leg.CompletedAt = &completedAt
+		s.record(ctx, leg, models.TimelineCompleted, "")
+		s.enrichLater(ctx, leg)
+		s.publishCompleted(ctx, leg, accounts[i].Currency)
+		s.publishBalances(ctx, leg, accounts[i].Currency)
+
+		if s.notifier != nil {
+			s.notifier.TransactionCompleted(leg, balance.After)
+		}
+		s.postProcess(ctx, leg, accounts[i])
+	}
+	// once every leg is applied, so the balances checked are the group's final ones
+	for _, leg := range legs {
+		s.creditApplied(ctx, leg)
+	}
+
+	return nil
+}
+
+// fails the legs of a group that are still pending with the same error
+func (s *TransactionService) failLegs(ctx context.Context, legs []*models.Transaction, err error) error {
+	for _, leg := range legs {
+		if leg.Status == models.Pending {
+			_ = s.markTransactionFailed(ctx, leg, err)
+		}
+	}
+	return err
+}
+
+// fails the legs waiting on a group's first leg, which failed before it claimed them
+func (s *TransactionService) failFollowingLegs(ctx context.Context, head *models.Transaction, err error) {
+	legs, loadErr := s.mongodb.GetTransactionsByGroup(ctx, head.GroupID)
+	if loadErr != nil {
+		log.Printf("%sFailed to load the legs of group %s: %v", reqctx.LogPrefix(ctx), head.GroupID, loadErr)
+		return
+	}
+	if len(legs) > 0 && legs[0].ID == head.ID {
+		_ = s.failLegs(ctx, legs[1:], err)
+	}
+}
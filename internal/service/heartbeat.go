@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const (
+	heartbeatInterval = 10 * time.Second
+
+	// a replica that missed this many heartbeats is reported as stale
+	heartbeatMisses = 3
+
+	// how far back the processor list reaches
+	heartbeatRetention = 24 * time.Hour
+)
+
+// reports this replica's processor until ctx is cancelled, then marks it stopped
+func (s *TransactionService) heartbeat(ctx context.Context) {
+	hb := &models.ProcessorHeartbeat{
+		ID:        s.ids.NewID(),
+		Hostname:  instance,
+		PID:       os.Getpid(),
+		StartedAt: s.clock.Now(ctx),
+	}
+	beat := func(ctx context.Context) {
+		hb.LastSeenAt = s.clock.Now(ctx)
+		hb.InFlight = int(atomic.LoadInt64(&s.inFlight))
+		hb.Processed = atomic.LoadInt64(&s.processed)
+		if err := s.postgres.UpsertProcessorHeartbeat(ctx, hb); err != nil {
+			log.Printf("Failed to record processor heartbeat: %v", err)
+		}
+		if s.progress != nil {
+			s.progress.save(ctx, s.postgres)
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	beat(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is gone, give the final heartbeat its own deadline
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			stoppedAt := s.clock.Now(ctx)
+			hb.StoppedAt = &stoppedAt
+			beat(stopCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			beat(ctx)
+		}
+	}
+}
+
+// lists the processor replicas that reported in the last day, flagging the ones that went quiet
+// while holding unacknowledged messages
+func (s *TransactionService) GetProcessors(ctx context.Context) ([]*models.ProcessorHeartbeat, error) {
+	now := s.clock.Now(ctx)
+	heartbeats, err := s.postgres.GetProcessorHeartbeats(ctx, now.Add(-heartbeatRetention))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hb := range heartbeats {
+		switch {
+		case hb.StoppedAt != nil:
+			hb.Status = models.ProcessorStopped
+		case now.Sub(hb.LastSeenAt) > heartbeatMisses*heartbeatInterval:
+			hb.Status = models.ProcessorStale
+			hb.Stalled = hb.InFlight > 0
+		default:
+			hb.Status = models.ProcessorActive
+		}
+	}
+
+	return heartbeats, nil
+}
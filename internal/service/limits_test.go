@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+func TestCheckKeyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits reqctx.Limits
+		amount float64
+		ok     bool
+	}{
+		{"no key", reqctx.Limits{}, 1e9, true},
+		{"key without a cap", reqctx.Limits{Key: "k", MaxDailyAmount: 10}, 500, true},
+		{"below the cap", reqctx.Limits{Key: "k", MaxTransactionAmount: 100}, 99.99, true},
+		{"at the cap", reqctx.Limits{Key: "k", MaxTransactionAmount: 100}, 100, true},
+		{"above the cap", reqctx.Limits{Key: "k", MaxTransactionAmount: 100}, 100.01, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := reqctx.WithLimits(context.Background(), tt.limits)
+			err := CheckKeyLimit(ctx, tt.amount)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("got %v, want ErrLimitExceeded", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/pubsub"
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// DefaultLiveInterval is how often platform snapshots are sampled unless configured otherwise
+	DefaultLiveInterval = 5 * time.Second
+
+	// messages queued for a live client before it counts as too slow and is disconnected
+	liveClientBuffer = 64
+
+	// most subscriptions one live client may hold
+	maxLiveSubscriptions = 50
+
+	// longest subscription id a client may choose
+	maxSubscriptionID = 64
+)
+
+// how long to wait before receiving balance updates again after Redis failed; a subscription that lasted
+// longer than the longest wait starts over from the shortest
+var resubscribeRetry = retry.Policy{
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+	Jitter:    0.2,
+}
+
+// streams platform snapshots and account balance updates to live dashboard clients, each over subscriptions
+// of its own; snapshots are only sampled while someone watches the platform, and balance updates only
+// received from Redis while someone watches an account
+type LiveService struct {
+	postgres      *db.Postgres
+	mongodb       *db.MongoDB
+	transactions  *TransactionService
+	subscriber    pubsub.Subscriber
+	channelPrefix string
+	interval      time.Duration
+
+	mu              sync.Mutex
+	ctx             context.Context
+	clients         map[*LiveClient]struct{}
+	platformWatches int
+	accountWatches  int
+	stopFollowing   context.CancelFunc
+	latest          json.RawMessage
+}
+
+// LiveClient is one live connection: its subscriptions and the messages queued for it
+type LiveClient struct {
+	messages      chan []byte
+	done          chan struct{}
+	subscriptions map[string]liveSubscription
+}
+
+type liveSubscription struct {
+	topic     models.LiveTopic
+	tenantID  string
+	accountID string
+}
+
+// creates a new LiveService; it streams nothing until Start is called
+func NewLiveService(postgres *db.Postgres, mongodb *db.MongoDB, transactions *TransactionService) *LiveService {
+	return &LiveService{
+		postgres:     postgres,
+		mongodb:      mongodb,
+		transactions: transactions,
+		interval:     DefaultLiveInterval,
+		clients:      map[*LiveClient]struct{}{},
+	}
+}
+
+// sets where balance updates are received from: the channels the transaction service publishes them to
+// without one, account subscriptions are refused
+func (s *LiveService) SetSubscriber(subscriber pubsub.Subscriber, channelPrefix string) {
+	s.subscriber = subscriber
+	s.channelPrefix = channelPrefix
+}
+
+// sets how often platform snapshots are sampled, and so the interval their rates are over
+func (s *LiveService) SetInterval(d time.Duration) {
+	s.interval = d
+}
+
+// starts sampling platform snapshots for whoever subscribes; clients are disconnected when ctx is done
+func (s *LiveService) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	go s.sample(ctx)
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for c := range s.clients {
+			s.drop(c)
+		}
+	}()
+}
+
+// Connect registers a new client; it is dropped again by Disconnect, when it falls behind or when the service
+// stops, which closes its Done channel
+func (s *LiveService) Connect() *LiveClient {
+	c := &LiveClient{
+		messages:      make(chan []byte, liveClientBuffer),
+		done:          make(chan struct{}),
+		subscriptions: map[string]liveSubscription{},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil || s.ctx.Err() != nil {
+		close(c.done)
+		return c
+	}
+	s.clients[c] = struct{}{}
+	return c
+}
+
+// drops a client and all of its subscriptions
+func (s *LiveService) Disconnect(c *LiveClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop(c)
+}
+
+// Messages are the encoded messages queued for the client, in order
+func (c *LiveClient) Messages() <-chan []byte {
+	return c.messages
+}
+
+// Done is closed once the client was dropped; nothing more is queued for it
+func (c *LiveClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// queues a message for the client
+func (s *LiveService) Send(c *LiveClient, message *models.LiveMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send(c, message)
+}
+
+// Subscribe opens the subscription id of the client to topic; account subscriptions are to an account of the
+// tenant in ctx. It is acknowledged with a "subscribed" message, followed by the latest platform snapshot
+func (s *LiveService) Subscribe(ctx context.Context, c *LiveClient, id string, topic models.LiveTopic, accountID string) error {
+	if id == "" || len(id) > maxSubscriptionID {
+		return ErrInvalidSubscription
+	}
+	subscription := liveSubscription{topic: topic}
+	switch topic {
+	case models.LivePlatform:
+	case models.LiveAccount:
+		if accountID == "" {
+			return ErrInvalidSubscription
+		}
+		if s.subscriber == nil {
+			return ErrAccountUpdatesUnavailable
+		}
+		if _, err := s.postgres.GetAccount(ctx, accountID); err != nil {
+			return err
+		}
+		subscription.tenantID, _ = tenant.FromContext(ctx)
+		subscription.accountID = accountID
+	default:
+		return ErrInvalidSubscription
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; !ok {
+		return nil
+	}
+	if _, ok := c.subscriptions[id]; ok {
+		return ErrSubscriptionExists
+	}
+	if len(c.subscriptions) >= maxLiveSubscriptions {
+		return ErrTooManySubscriptions
+	}
+	c.subscriptions[id] = subscription
+	s.watch(subscription.topic, 1)
+
+	s.send(c, &models.LiveMessage{Type: "subscribed", ID: id, Topic: topic})
+	if topic == models.LivePlatform && s.latest != nil {
+		s.send(c, &models.LiveMessage{Type: "event", ID: id, Topic: topic, Data: s.latest})
+	}
+	return nil
+}
+
+// closes the subscription id of the client, acknowledged with an "unsubscribed" message
+func (s *LiveService) Unsubscribe(c *LiveClient, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription, ok := c.subscriptions[id]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(c.subscriptions, id)
+	s.watch(subscription.topic, -1)
+
+	s.send(c, &models.LiveMessage{Type: "unsubscribed", ID: id, Topic: subscription.topic})
+	return nil
+}
+
+// send queues message for c, dropping a client whose queue is full; the caller holds mu
+func (s *LiveService) send(c *LiveClient, message *models.LiveMessage) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to encode live message: %v", err)
+		return
+	}
+	select {
+	case c.messages <- encoded:
+	default:
+		// a dashboard this far behind is better off reconnecting than seeing stale numbers
+		s.drop(c)
+	}
+}
+
+// drop unregisters c and closes its subscriptions; the caller holds mu
+func (s *LiveService) drop(c *LiveClient) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	for id, subscription := range c.subscriptions {
+		delete(c.subscriptions, id)
+		s.watch(subscription.topic, -1)
+	}
+	delete(s.clients, c)
+	close(c.done)
+}
+
+// watch counts a subscription to topic opening or closing, and starts or stops receiving balance updates
+// with the first and last account subscription; the caller holds mu
+func (s *LiveService) watch(topic models.LiveTopic, delta int) {
+	switch topic {
+	case models.LivePlatform:
+		s.platformWatches += delta
+		if s.platformWatches == 0 {
+			s.latest = nil
+		}
+	case models.LiveAccount:
+		s.accountWatches += delta
+		switch {
+		case s.accountWatches == 1 && delta > 0:
+			ctx, cancel := context.WithCancel(s.ctx)
+			s.stopFollowing = cancel
+			go s.follow(ctx)
+		case s.accountWatches == 0 && s.stopFollowing != nil:
+			s.stopFollowing()
+			s.stopFollowing = nil
+		}
+	}
+}
+
+// publish queues data for every subscription to topic, or to the tenant's account; the caller holds mu
+func (s *LiveService) publish(topic models.LiveTopic, tenantID, accountID string, data json.RawMessage) {
+	for c := range s.clients {
+		for id, subscription := range c.subscriptions {
+			if subscription.topic != topic || subscription.tenantID != tenantID || subscription.accountID != accountID {
+				continue
+			}
+			s.send(c, &models.LiveMessage{Type: "event", ID: id, Topic: topic, Data: data})
+		}
+	}
+}
+
+// samples a platform snapshot every interval while the platform is watched, until ctx is done
+func (s *LiveService) sample(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		watched := s.platformWatches > 0
+		s.mu.Unlock()
+		if !watched {
+			continue
+		}
+
+		snapshot, err := s.snapshot(ctx)
+		if err != nil {
+			// a failing database would otherwise log every few seconds
+			if !failing && ctx.Err() == nil {
+				log.Printf("Failed to sample live platform snapshot: %v", err)
+			}
+			failing = true
+			continue
+		}
+		failing = false
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			log.Printf("Failed to encode live platform snapshot: %v", err)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.platformWatches > 0 {
+			s.latest = data
+			s.publish(models.LivePlatform, "", "", data)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// counts the transactions of the interval just ended and reads the queue depths
+func (s *LiveService) snapshot(ctx context.Context) (*models.PlatformSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+
+	now := time.Now().UTC()
+	counts, err := s.mongodb.CountPlatformWindow(ctx, now.Add(-s.interval), now)
+	if err != nil {
+		return nil, err
+	}
+	depths, err := s.transactions.QueueDepths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue depths: %w", err)
+	}
+
+	seconds := s.interval.Seconds()
+	snapshot := &models.PlatformSnapshot{
+		At:                    now,
+		IntervalSeconds:       seconds,
+		Created:               counts.Created,
+		Completed:             counts.Completed,
+		Failed:                counts.Failed,
+		TransactionsPerSecond: float64(counts.Completed) / seconds,
+		FailuresPerSecond:     float64(counts.Failed) / seconds,
+		Queues:                *depths,
+	}
+	if counts.Completed > 0 {
+		snapshot.AvgLatencyMs = float64(counts.LatencyMsTotal) / float64(counts.Completed)
+	}
+	return snapshot, nil
+}
+
+// receives balance updates until ctx is done, subscribing again whenever Redis fails; updates published while
+// the subscription is down are missed, as they are for any other subscriber
+func (s *LiveService) follow(ctx context.Context) {
+	pattern := globEscaper.Replace(s.channelPrefix) + "*"
+	failures := 0
+	for {
+		subscribed := time.Now()
+		err := s.subscriber.Subscribe(ctx, pattern, s.dispatch)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(subscribed) > resubscribeRetry.MaxDelay {
+			failures = 0
+		}
+		failures++
+		wait := resubscribeRetry.Delay(failures)
+		log.Printf("Balance updates for live clients stopped, subscribing again in %s: %v", wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dispatch hands a balance update to the subscriptions to its account
+func (s *LiveService) dispatch(channel string, message []byte) {
+	var envelope struct {
+		TenantID string `json:"tenant_id"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return
+	}
+	accountID := strings.TrimPrefix(channel, s.channelPrefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publish(models.LiveAccount, envelope.TenantID, accountID, message)
+}
+
+// globEscaper escapes the characters PSUBSCRIBE patterns give a meaning to
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
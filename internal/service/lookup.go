@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// MaxLookupIDs is the most ids a single bulk lookup may ask for
+const MaxLookupIDs = 500
+
+// lookupIDs drops repeated and empty ids, keeping the order they were asked for in
+func lookupIDs(ids []string) ([]string, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("%w: ids is required", ErrInvalidLookup)
+	}
+	if len(unique) > MaxLookupIDs {
+		return nil, fmt.Errorf("%w: at most %d ids can be looked up at once", ErrInvalidLookup, MaxLookupIDs)
+	}
+	return unique, nil
+}
+
+// retrieves the tenant's accounts among ids with their activity summaries, in the order asked for, and the ids it
+// has no account for
+func (s *AccountService) LookupAccounts(ctx context.Context, ids []string) ([]*models.Account, map[string]*models.AccountSummary, []string, error) {
+	ids, err := lookupIDs(ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	byID, err := s.postgres.GetAccounts(ctx, ids)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to look up accounts: %w", err)
+	}
+	accounts := make([]*models.Account, 0, len(byID))
+	found := make([]string, 0, len(byID))
+	notFound := []string{}
+	for _, id := range ids {
+		if account, ok := byID[id]; ok {
+			accounts = append(accounts, account)
+			found = append(found, id)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+	if len(found) == 0 {
+		return accounts, map[string]*models.AccountSummary{}, notFound, nil
+	}
+
+	summaries, err := s.postgres.GetAccountSummaries(ctx, found)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to look up account summaries: %w", err)
+	}
+	return accounts, summaries, notFound, nil
+}
+
+// returns the balance breakdown of each of the given accounts holding promotional credit, keyed by account id
+func (s *CreditService) GetBreakdowns(ctx context.Context, accounts []*models.Account) (map[string]*models.BalanceBreakdown, error) {
+	ids := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+	breakdowns := make(map[string]*models.BalanceBreakdown)
+	if len(ids) == 0 {
+		return breakdowns, nil
+	}
+
+	byAccount, err := s.postgres.GetCreditBucketsByAccounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		if buckets, ok := byAccount[account.ID]; ok {
+			breakdowns[account.ID] = s.breakdown(account, buckets)
+		}
+	}
+	return breakdowns, nil
+}
+
+// retrieves the tenant's transactions among ids, in the order asked for, and the ids it has no transaction for
+func (s *TransactionService) LookupTransactions(ctx context.Context, ids []string) ([]*models.Transaction, []string, error) {
+	ids, err := lookupIDs(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID, err := s.mongodb.GetTransactionsByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up transactions: %w", err)
+	}
+	txs := make([]*models.Transaction, 0, len(byID))
+	notFound := []string{}
+	for _, id := range ids {
+		if tx, ok := byID[id]; ok {
+			txs = append(txs, tx)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+	return txs, notFound, nil
+}
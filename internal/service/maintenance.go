@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// how long the maintenance switch is served from memory before it is read again
+const maintenanceCheckInterval = 2 * time.Second
+
+// handles the system-wide maintenance switch shared by every API and processor replica
+type MaintenanceService struct {
+	postgres    *db.Postgres
+	clock       clock.Clock
+	replication *ReplicationService
+
+	mu        sync.Mutex
+	status    *models.MaintenanceStatus
+	checkedAt time.Time
+}
+
+// creates a new MaintenanceService
+func NewMaintenanceService(postgres *db.Postgres) *MaintenanceService {
+	return &MaintenanceService{
+		postgres: postgres,
+		clock:    clock.System,
+		status:   &models.MaintenanceStatus{},
+	}
+}
+
+// sets the clock the switch is re-read by
+func (s *MaintenanceService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the region's replication role, which counts as maintenance while the region isn't active: it takes no
+// writes and processes nothing
+func (s *MaintenanceService) SetReplication(r *ReplicationService) {
+	s.replication = r
+}
+
+// returns the current switch position, re-reading it at most every maintenanceCheckInterval
+// when the read fails (the database may be the thing under maintenance) the last known position is kept
+func (s *MaintenanceService) Status(ctx context.Context) *models.MaintenanceStatus {
+	status := s.switchStatus(ctx)
+	if s.replication == nil {
+		return status
+	}
+	region := s.replication.Status(ctx)
+	if region.Role == models.RoleActive || status.Enabled {
+		return status
+	}
+	return &models.MaintenanceStatus{Enabled: true, Message: regionRefusal(region).Error(), UpdatedBy: region.UpdatedBy, UpdatedAt: region.UpdatedAt}
+}
+
+// returns why writes are refused, or nil while they are taken: the operator's message, ErrMaintenance when they
+// gave none, or ErrRegionNotActive
+func (s *MaintenanceService) Refusal(ctx context.Context) error {
+	if status := s.switchStatus(ctx); status.Enabled {
+		if status.Message == "" {
+			return ErrMaintenance
+		}
+		return errors.New(status.Message)
+	}
+	if s.replication == nil {
+		return nil
+	}
+	if region := s.replication.Status(ctx); region.Role != models.RoleActive {
+		return regionRefusal(region)
+	}
+	return nil
+}
+
+// the refusal of a region that isn't active, naming the one writes go to
+func regionRefusal(region *models.ReplicationStatus) error {
+	if region.ActiveRegion != "" && region.ActiveRegion != region.Region {
+		return fmt.Errorf("%w: %s is %s; writes go to %s", ErrRegionNotActive, region.Region, region.Role, region.ActiveRegion)
+	}
+	return fmt.Errorf("%w: %s is %s", ErrRegionNotActive, region.Region, region.Role)
+}
+
+// returns the switch itself, leaving replication out
+func (s *MaintenanceService) switchStatus(ctx context.Context) *models.MaintenanceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now(ctx)
+	if now.Sub(s.checkedAt) < maintenanceCheckInterval {
+		return s.status
+	}
+	s.checkedAt = now
+
+	status, err := s.postgres.GetMaintenanceStatus(ctx)
+	if err != nil {
+		log.Printf("Failed to read maintenance status, keeping enabled=%t: %v", s.status.Enabled, err)
+		return s.status
+	}
+	s.status = status
+	return s.status
+}
+
+// reports whether maintenance mode is on
+func (s *MaintenanceService) Enabled(ctx context.Context) bool {
+	return s.Status(ctx).Enabled
+}
+
+// turns maintenance mode on or off
+func (s *MaintenanceService) Set(ctx context.Context, req *models.MaintenanceRequest) (*models.MaintenanceStatus, error) {
+	status := &models.MaintenanceStatus{
+		Enabled:   req.Enabled,
+		Message:   req.Message,
+		UpdatedBy: reqctx.FromContext(ctx).Actor,
+	}
+	if err := s.postgres.SetMaintenanceStatus(ctx, status); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.status = status
+	s.checkedAt = s.clock.Now(ctx)
+	s.mu.Unlock()
+
+	return status, nil
+}
+
+// blocks while maintenance mode is on; returns false when ctx ends first
+func (s *MaintenanceService) Wait(ctx context.Context) bool {
+	logged := false
+	for s.Enabled(ctx) {
+		if !logged {
+			log.Println("Maintenance mode is on, pausing work")
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(maintenanceCheckInterval):
+		}
+	}
+	if logged {
+		log.Println("Maintenance mode is off, resuming work")
+	}
+	return ctx.Err() == nil
+}
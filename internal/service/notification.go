@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/ids"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/notify"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// bounds how long a single notification delivery may take
+const notificationTimeout = 10 * time.Second
+
+// handles account notification preferences and event delivery
+type NotificationService struct {
+	postgres   *db.Postgres
+	dispatcher *notify.Dispatcher
+	tenants    *TenantService
+	clock      clock.Clock
+	ids        ids.Generator
+	webhooks   notify.EgressPolicy
+}
+
+// creates a new NotificationService
+func NewNotificationService(postgres *db.Postgres, dispatcher *notify.Dispatcher, tenants *TenantService) *NotificationService {
+	return &NotificationService{
+		postgres:   postgres,
+		dispatcher: dispatcher,
+		tenants:    tenants,
+		clock:      clock.System,
+		ids:        ids.UUID,
+	}
+}
+
+// sets the clock notifications are stamped with
+func (s *NotificationService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the generator notification ids come from
+func (s *NotificationService) SetIDGenerator(g ids.Generator) {
+	s.ids = g
+}
+
+// sets the policy webhook URLs are checked against when they are saved
+func (s *NotificationService) SetWebhookPolicy(policy notify.EgressPolicy) {
+	s.webhooks = policy
+}
+
+// retrieves an account's notification preferences, returning empty preferences when none are set
+func (s *NotificationService) GetPreferences(ctx context.Context, accountID string) (*models.NotificationPreferences, error) {
+	if _, err := s.postgres.GetAccount(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	prefs, err := s.postgres.GetNotificationPreferences(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		prefs = &models.NotificationPreferences{AccountID: accountID, Events: []models.NotificationEvent{}}
+	}
+
+	return prefs, nil
+}
+
+// replaces an account's notification preferences
+func (s *NotificationService) UpdatePreferences(ctx context.Context, accountID string, req *models.NotificationPreferencesRequest) (*models.NotificationPreferences, error) {
+	for _, e := range req.Events {
+		switch e {
+		case models.LargeWithdrawal, models.LowBalance, models.TransactionFailed:
+		default:
+			return nil, fmt.Errorf("unknown notification event: %s", e)
+		}
+	}
+	if req.LargeWithdrawalThreshold < 0 || req.LowBalanceThreshold < 0 {
+		return nil, fmt.Errorf("notification thresholds cannot be negative")
+	}
+	if req.Email != "" {
+		if err := notify.CheckEmail(req.Email); err != nil {
+			return nil, err
+		}
+	}
+	if req.Phone != "" {
+		if err := notify.CheckPhone(req.Phone); err != nil {
+			return nil, err
+		}
+	}
+	if req.WebhookURL != "" {
+		if err := s.webhooks.CheckURL(req.WebhookURL); err != nil {
+			return nil, err
+		}
+	}
+
+	events := req.Events
+	if events == nil {
+		events = []models.NotificationEvent{}
+	}
+
+	prefs := &models.NotificationPreferences{
+		AccountID:                accountID,
+		Email:                    req.Email,
+		Phone:                    req.Phone,
+		WebhookURL:               req.WebhookURL,
+		Events:                   events,
+		LargeWithdrawalThreshold: req.LargeWithdrawalThreshold,
+		LowBalanceThreshold:      req.LowBalanceThreshold,
+	}
+	if err := s.postgres.UpsertNotificationPreferences(ctx, prefs); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// the catalog event types webhook subscriptions can filter on
+var subscribableEventTypes = map[string]bool{
+	string(events.TransactionLargeWithdrawal): true,
+	string(events.AccountLowBalance):          true,
+	string(events.TransactionFailed):          true,
+}
+
+// subscribes a URL to the notification events of one account, or of every account when the request names none
+func (s *NotificationService) CreateSubscription(ctx context.Context, req *models.WebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	if err := s.webhooks.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+	for _, t := range req.EventTypes {
+		if !subscribableEventTypes[t] {
+			return nil, fmt.Errorf("unknown event type: %s", t)
+		}
+	}
+	if req.AccountID != "" {
+		if _, err := s.postgres.GetAccount(ctx, req.AccountID); err != nil {
+			return nil, fmt.Errorf("failed to get account: %w", err)
+		}
+	}
+
+	sub := &models.WebhookSubscription{AccountID: req.AccountID, URL: req.URL, EventTypes: req.EventTypes}
+	if err := s.postgres.CreateWebhookSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// lists the tenant's webhook subscriptions, or only one account's when accountID is set
+func (s *NotificationService) GetSubscriptions(ctx context.Context, accountID string) ([]*models.WebhookSubscription, error) {
+	return s.postgres.GetWebhookSubscriptions(ctx, accountID)
+}
+
+// removes a webhook subscription
+func (s *NotificationService) DeleteSubscription(ctx context.Context, id string) error {
+	return s.postgres.DeleteWebhookSubscription(ctx, id)
+}
+
+// raises large withdrawal and low balance events for a completed transaction
+func (s *NotificationService) TransactionCompleted(tx *models.Transaction, balanceAfter float64) {
+	go s.deliver(tx.TenantID, tx.AccountID, func(prefs *models.NotificationPreferences) []*models.Notification {
+		var out []*models.Notification
+		if tx.Type == models.Withdrawal && prefs.Subscribed(models.LargeWithdrawal) &&
+			prefs.LargeWithdrawalThreshold > 0 && tx.Amount >= prefs.LargeWithdrawalThreshold {
+			out = append(out, &models.Notification{
+				Event:         models.LargeWithdrawal,
+				AccountID:     tx.AccountID,
+				TransactionID: tx.ID,
+				Subject:       "Large withdrawal on your account",
+				Message:       fmt.Sprintf("A withdrawal of %.2f was made from account %s.", tx.Amount, tx.AccountID),
+			})
+		}
+		if prefs.Subscribed(models.LowBalance) && balanceAfter < prefs.LowBalanceThreshold {
+			out = append(out, &models.Notification{
+				Event:         models.LowBalance,
+				AccountID:     tx.AccountID,
+				TransactionID: tx.ID,
+				Subject:       "Low balance on your account",
+				Message:       fmt.Sprintf("The balance of account %s is now %.2f.", tx.AccountID, balanceAfter),
+			})
+		}
+		return out
+	})
+}
+
+// raises the failed transaction event
+func (s *NotificationService) TransactionFailed(tx *models.Transaction, reason error) {
+	go s.deliver(tx.TenantID, tx.AccountID, func(prefs *models.NotificationPreferences) []*models.Notification {
+		if !prefs.Subscribed(models.TransactionFailed) {
+			return nil
+		}
+		return []*models.Notification{{
+			Event:         models.TransactionFailed,
+			AccountID:     tx.AccountID,
+			TransactionID: tx.ID,
+			Subject:       "A transaction on your account failed",
+			Message:       fmt.Sprintf("Your %s of %.2f could not be processed: %v", tx.Type, tx.Amount, reason),
+		}}
+	})
+}
+
+// loads preferences and sends whatever notifications build returns to the account's channels, the tenant's
+// webhook endpoints and the webhook subscriptions that want them; runs detached from the processing context so a slow
+// channel never delays balance updates
+func (s *NotificationService) deliver(tenantID, accountID string, build func(*models.NotificationPreferences) []*models.Notification) {
+	tenantID = tenant.OrDefault(tenantID)
+	ctx, cancel := context.WithTimeout(tenant.WithTenant(context.Background(), tenantID), notificationTimeout)
+	defer cancel()
+
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		log.Printf("Failed to load tenant settings for %s: %v", tenantID, err)
+		return
+	}
+
+	prefs, err := s.postgres.GetNotificationPreferences(ctx, accountID)
+	if err != nil {
+		log.Printf("Failed to load notification preferences for account %s: %v", accountID, err)
+		return
+	}
+	if prefs == nil {
+		return
+	}
+	// sandbox customers are test fixtures; only webhooks go out so integrators can still see the events
+	if tenant.IsSandbox(tenantID) {
+		prefs.Email, prefs.Phone = "", ""
+	}
+
+	subs, err := s.postgres.GetWebhookSubscriptionsForAccount(ctx, accountID)
+	if err != nil {
+		// the account's own channels and the tenant endpoints still get the notification
+		log.Printf("Failed to load webhook subscriptions for account %s: %v", accountID, err)
+	}
+
+	for _, n := range build(prefs) {
+		n.ID = s.ids.NewID()
+		n.CreatedAt = s.clock.Now(ctx)
+		if err := s.dispatcher.Dispatch(ctx, prefs, n); err != nil {
+			log.Printf("Failed to send %s notification for account %s: %v", n.Event, accountID, err)
+		}
+		for _, endpoint := range settings.WebhookEndpoints {
+			if err := s.dispatcher.DispatchWebhook(ctx, endpoint, n); err != nil {
+				log.Printf("Failed to send %s notification to tenant endpoint %s: %v", n.Event, endpoint, err)
+			}
+		}
+		eventType, _ := events.NotificationType(n.Event)
+		for _, sub := range subs {
+			if !sub.Wants(string(eventType)) {
+				continue
+			}
+			if err := s.dispatcher.DispatchWebhook(ctx, sub.URL, n); err != nil {
+				log.Printf("Failed to send %s notification to webhook subscription %s: %v", n.Event, sub.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// manages a tenant's accounting periods: months are open until they are closed, and back-dated transactions can
+// only be posted into open ones
+type PeriodService struct {
+	postgres *db.Postgres
+	clock    clock.Clock
+}
+
+// creates a new PeriodService
+func NewPeriodService(postgres *db.Postgres) *PeriodService {
+	return &PeriodService{postgres: postgres, clock: clock.System}
+}
+
+// lists the tenant's closed accounting periods, latest first
+func (s *PeriodService) GetClosedPeriods(ctx context.Context) ([]*models.AccountingPeriod, error) {
+	return s.postgres.GetClosedPeriods(ctx)
+}
+
+// closes an accounting period (YYYY-MM) that has ended
+func (s *PeriodService) ClosePeriod(ctx context.Context, period string) (*models.AccountingPeriod, error) {
+	start, err := time.Parse(models.PeriodLayout, period)
+	if err != nil {
+		return nil, fmt.Errorf("%w: periods are YYYY-MM", ErrInvalidPeriod)
+	}
+	// the current month is still being posted into
+	if !start.AddDate(0, 1, 0).Before(s.clock.Now(ctx)) {
+		return nil, fmt.Errorf("%w: %s hasn't ended", ErrInvalidPeriod, period)
+	}
+
+	closed := &models.AccountingPeriod{Period: period, ClosedBy: reqctx.FromContext(ctx).Actor}
+	if err := s.postgres.ClosePeriod(ctx, closed); err != nil {
+		return nil, err
+	}
+	return closed, nil
+}
+
+// reopens a closed accounting period (YYYY-MM) so back-dated transactions can be posted into it again
+func (s *PeriodService) ReopenPeriod(ctx context.Context, period string) error {
+	if _, err := time.Parse(models.PeriodLayout, period); err != nil {
+		return fmt.Errorf("%w: periods are YYYY-MM", ErrInvalidPeriod)
+	}
+	return s.postgres.ReopenPeriod(ctx, period)
+}
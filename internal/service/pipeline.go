@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/hooks"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+var (
+	processingDuration = metrics.NewHistogram(
+		"ledger_processing_duration_seconds",
+		"Time the processor spends on one consumed transaction.",
+		metrics.LatencyBuckets,
+	)
+	processingFailures = metrics.NewCounter(
+		"ledger_processing_failures_total",
+		"Consumed transactions whose processing returned an error.",
+	)
+)
+
+// ProcessFunc processes one consumed transaction
+type ProcessFunc func(ctx context.Context, tx *models.Transaction) error
+
+// ProcessMiddleware wraps transaction processing with a concern of its own, such as logging or metrics. It runs
+// before the transaction is claimed, so checks that need the account are hooks instead. It calls next to go on;
+// returning an error without calling next leaves the transaction pending and records a failed attempt, so it is
+// retried like any other processing error
+type ProcessMiddleware func(next ProcessFunc) ProcessFunc
+
+// adds middleware around ProcessTransaction for the processor; the first added runs outermost
+// must be called before StartProcessor
+func (s *TransactionService) Use(middleware ...ProcessMiddleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// pipeline is ProcessTransaction wrapped in the registered middleware
+func (s *TransactionService) pipeline() ProcessFunc {
+	process := ProcessFunc(s.ProcessTransaction)
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		process = s.middleware[i](process)
+	}
+	return process
+}
+
+// sets the hooks run around the balance update; pre-processors in order after the account checks, post-processors
+// after completion
+func (s *TransactionService) SetHooks(registered []hooks.Hook) {
+	s.hooks = registered
+}
+
+// runs the pre-processors; the first refusal stops the rest and becomes the failure reason
+func (s *TransactionService) preProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	for _, h := range s.hooks {
+		if h.Pre == nil {
+			continue
+		}
+		if err := h.Pre.PreProcess(ctx, tx, account); err != nil {
+			return fmt.Errorf("rejected by %s: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// runs the pre-processors that can check a simulated transaction without side effects, as preProcess would
+func (s *TransactionService) simulatePreProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	for _, h := range s.hooks {
+		simulator, ok := h.Pre.(hooks.Simulator)
+		if !ok {
+			continue
+		}
+		if err := simulator.SimulatePreProcess(ctx, tx, account); err != nil {
+			return fmt.Errorf("rejected by %s: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// runs the post-processors; the transaction is already complete, so errors are only logged
+func (s *TransactionService) postProcess(ctx context.Context, tx *models.Transaction, account *models.Account) {
+	for _, h := range s.hooks {
+		if h.Post == nil {
+			continue
+		}
+		if err := h.Post.PostProcess(ctx, tx, account); err != nil {
+			log.Printf("%sHook %s failed for transaction %s: %v", reqctx.LogPrefix(ctx), h.Name, tx.ID, err)
+		}
+	}
+}
+
+// LogProcessing logs the outcome of every processed transaction
+func LogProcessing(next ProcessFunc) ProcessFunc {
+	return func(ctx context.Context, tx *models.Transaction) error {
+		err := next(ctx, tx)
+		if err != nil {
+			log.Printf("%sFailed to process transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		} else {
+			log.Printf("%sSuccessfully processed transaction %s", reqctx.LogPrefix(ctx), tx.ID)
+		}
+		return err
+	}
+}
+
+// MeasureProcessing records how long processing takes and how often it fails
+func MeasureProcessing(next ProcessFunc) ProcessFunc {
+	return func(ctx context.Context, tx *models.Transaction) error {
+		started := time.Now()
+		err := next(ctx, tx)
+		processingDuration.Observe(time.Since(started).Seconds())
+		if err != nil {
+			processingFailures.Inc()
+		}
+		return err
+	}
+}
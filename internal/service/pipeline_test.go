@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abkawan/banking-ledger/internal/hooks"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// counts what it sees, so it can't be simulated
+type countingHook struct{ seen int }
+
+func (h *countingHook) PreProcess(context.Context, *models.Transaction, *models.Account) error {
+	h.seen++
+	return errors.New("refused")
+}
+
+type refusingSimulator struct{ countingHook }
+
+func (h *refusingSimulator) SimulatePreProcess(context.Context, *models.Transaction, *models.Account) error {
+	return errors.New("refused")
+}
+
+func TestSimulatePreProcess(t *testing.T) {
+	counting := &countingHook{}
+	simulator := &refusingSimulator{}
+	s := &TransactionService{}
+	s.SetHooks([]hooks.Hook{{Name: "count", Pre: counting}, {Name: "post-only"}})
+
+	tx, account := &models.Transaction{}, &models.Account{}
+	if err := s.simulatePreProcess(context.Background(), tx, account); err != nil {
+		t.Fatalf("a pre-processor that can't be simulated refused: %v", err)
+	}
+	if counting.seen != 0 {
+		t.Fatal("the simulation ran a pre-processor with side effects")
+	}
+
+	s.SetHooks([]hooks.Hook{{Name: "count", Pre: counting}, {Name: "rules", Pre: simulator}})
+	err := s.simulatePreProcess(context.Background(), tx, account)
+	if err == nil || err.Error() != "rejected by rules: refused" {
+		t.Fatalf("got %v, want the simulator's refusal", err)
+	}
+	if counting.seen != 0 || simulator.seen != 0 {
+		t.Fatal("the simulation ran PreProcess")
+	}
+}
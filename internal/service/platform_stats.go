@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+const (
+	// DefaultStatsRetention is how long per-minute platform stats are kept unless configured otherwise
+	DefaultStatsRetention = 90 * 24 * time.Hour
+
+	// recent minutes are counted again on every run so late completions land in the right minute
+	statsSettleMinutes = 5
+
+	// most minutes a run catches up on after the job was down; older gaps stay gaps
+	statsBackfillMinutes = 60
+
+	// most points a history request returns
+	maxStatsPoints = 5000
+)
+
+// records per-minute platform throughput and serves its history for capacity planning
+type PlatformStatsService struct {
+	mongodb   *db.MongoDB
+	clock     clock.Clock
+	retention time.Duration
+}
+
+// creates a new PlatformStatsService
+func NewPlatformStatsService(mongodb *db.MongoDB) *PlatformStatsService {
+	return &PlatformStatsService{
+		mongodb:   mongodb,
+		clock:     clock.System,
+		retention: DefaultStatsRetention,
+	}
+}
+
+// sets the clock minutes are closed by
+func (s *PlatformStatsService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets how long recorded minutes are kept
+func (s *PlatformStatsService) SetRetention(d time.Duration) {
+	s.retention = d
+}
+
+// records every closed minute since the last run, recounts the last few and prunes minutes past retention
+// intended to run every minute from the scheduler
+func (s *PlatformStatsService) RecordMinutes(ctx context.Context) error {
+	current := s.clock.Now(ctx).UTC().Truncate(time.Minute)
+
+	start := current.Add(-statsSettleMinutes * time.Minute)
+	last, err := s.mongodb.GetLastPlatformMinute(ctx)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.Before(start) {
+		start = last.Add(time.Minute)
+		if oldest := current.Add(-statsBackfillMinutes * time.Minute); start.Before(oldest) {
+			start = oldest
+		}
+	}
+
+	for minute := start; minute.Before(current); minute = minute.Add(time.Minute) {
+		counts, err := s.mongodb.CountPlatformMinute(ctx, minute)
+		if err != nil {
+			return err
+		}
+		if err := s.mongodb.SavePlatformMinute(ctx, counts); err != nil {
+			return err
+		}
+	}
+
+	pruned, err := s.mongodb.DeletePlatformMinutesBefore(ctx, current.Add(-s.retention))
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d minutes of platform stats past retention", pruned)
+	}
+	return nil
+}
+
+// returns platform throughput over [from, to) rolled up into steps of at least a minute
+func (s *PlatformStatsService) GetHistory(ctx context.Context, from, to time.Time, step time.Duration) (*models.PlatformStatsHistory, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("history start must be before end")
+	}
+	if step < time.Minute || step%time.Minute != 0 {
+		return nil, fmt.Errorf("step must be a whole number of minutes")
+	}
+	if to.Sub(from)/step > maxStatsPoints {
+		return nil, fmt.Errorf("history covers at most %d steps; use a longer step", maxStatsPoints)
+	}
+
+	points, err := s.mongodb.GetPlatformStatsHistory(ctx, from, to, step)
+	if err != nil {
+		return nil, err
+	}
+	for i := range points {
+		if points[i].Completed > 0 {
+			points[i].AvgLatencyMs = float64(points[i].LatencyMsTotal) / float64(points[i].Completed)
+		}
+	}
+
+	return &models.PlatformStatsHistory{
+		From:   from,
+		To:     to,
+		Step:   step.String(),
+		Points: points,
+	}, nil
+}
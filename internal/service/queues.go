@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/queue"
+)
+
+// the queues operators can inspect, by the name the admin API uses for them
+var inspectableQueues = map[string]string{
+	"dead-letter": queue.DeadLetterQueue,
+	"quarantine":  queue.QuarantineQueue,
+}
+
+// returns up to limit messages waiting in the dead-letter or quarantine queue, leaving them in place
+func (s *TransactionService) PeekQueue(ctx context.Context, name string, limit int) (*models.QueueContents, error) {
+	queueName, ok := inspectableQueues[name]
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+	return s.rabbitmq.Peek(ctx, queueName, limit)
+}
+
+// returns how many messages wait in the transaction queue and in the dead-letter and quarantine queues
+func (s *TransactionService) QueueDepths(ctx context.Context) (*models.QueueDepths, error) {
+	depths := &models.QueueDepths{}
+	var err error
+	if depths.Transactions, err = s.rabbitmq.Depth(ctx, queue.TransactionQueue); err != nil {
+		return nil, err
+	}
+	if depths.DeadLetter, err = s.rabbitmq.Depth(ctx, queue.DeadLetterQueue); err != nil {
+		return nil, err
+	}
+	if depths.Quarantine, err = s.rabbitmq.Depth(ctx, queue.QuarantineQueue); err != nil {
+		return nil, err
+	}
+	return depths, nil
+}
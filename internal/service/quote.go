@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// DefaultQuoteTTL is how long a quote's fee is locked unless configured otherwise
+const DefaultQuoteTTL = 5 * time.Minute
+
+// sets how long quotes lock the fee they were given
+func (s *TransactionService) SetQuoteTTL(ttl time.Duration) {
+	s.quoteTTL = ttl
+}
+
+// quotes the fee a prospective transaction would be charged, after the same limit checks, and locks it for the
+// quote TTL
+func (s *TransactionService) CreateQuote(ctx context.Context, req *models.QuoteRequest) (*models.Quote, error) {
+	account, err := s.postgres.GetAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	if err := money.Validate(req.Amount, account.Currency, s.bounds); err != nil {
+		return nil, err
+	}
+	if req.CounterpartyID != "" {
+		if _, err := s.postgres.GetCounterparty(ctx, req.CounterpartyID); err != nil {
+			return nil, err
+		}
+	}
+
+	fee, err := s.applyTenantPolicy(ctx, req.TransactionRequest(), account)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now(ctx)
+	quote := &models.Quote{
+		AccountID:             req.AccountID,
+		Type:                  req.Type,
+		Amount:                req.Amount,
+		CounterpartyAccountID: req.CounterpartyAccountID,
+		CounterpartyID:        req.CounterpartyID,
+		Fee:                   fee,
+		Currency:              account.Currency,
+		CreatedAt:             now,
+		ExpiresAt:             now.Add(s.quoteTTL),
+	}
+	if err := s.postgres.CreateQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+// retrieves a quote by ID
+func (s *TransactionService) GetQuote(ctx context.Context, id string) (*models.Quote, error) {
+	return s.postgres.GetQuote(ctx, id)
+}
+
+// returns the fee a request's quote locked, checking the quote is for the same transaction and can still be used
+// by the request's reference
+func (s *TransactionService) quotedFee(ctx context.Context, req *models.TransactionRequest, reference string) (float64, error) {
+	quote, err := s.postgres.GetQuote(ctx, req.QuoteID)
+	if err != nil {
+		return 0, err
+	}
+	if quote.AccountID != req.AccountID || quote.Type != req.Type || quote.Amount != req.Amount ||
+		quote.CounterpartyAccountID != req.CounterpartyAccountID || quote.CounterpartyID != req.CounterpartyID {
+		return 0, fmt.Errorf("%w: quote %s is for a different transaction", ErrInvalidQuote, quote.ID)
+	}
+	if quote.UsedByReference != "" && quote.UsedByReference != reference {
+		return 0, fmt.Errorf("%w: %s", ErrQuoteUsed, quote.ID)
+	}
+	if !s.clock.Now(ctx).Before(quote.ExpiresAt) {
+		return 0, fmt.Errorf("%w: %s expired at %s", ErrQuoteExpired, quote.ID, quote.ExpiresAt.Format(time.RFC3339))
+	}
+	return quote.Fee, nil
+}
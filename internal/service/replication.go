@@ -0,0 +1,603 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/replication"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// DefaultReplicationLease is how long a passive region waits without hearing from the active one before
+	// it may be promoted, unless configured otherwise
+	DefaultReplicationLease = 30 * time.Second
+
+	// how long the region's role is served from memory before it is read again
+	replicationCheckInterval = 2 * time.Second
+
+	// how often the active region captures its changes and publishes a heartbeat
+	captureInterval = time.Second
+
+	// records published to the feed at once
+	captureBatchSize = 500
+
+	// transaction changes read from the change stream in one capture, so a busy region still heartbeats
+	captureChangeLimit = 10 * captureBatchSize
+
+	// the advisory lock the replicating processor replica holds
+	replicationLock = "ledger:replication"
+)
+
+var (
+	replicationPublished = metrics.NewCounter(
+		"ledger_replication_published_total",
+		"Account and transaction changes the active region published to the replication feed.",
+	)
+	replicationApplied = metrics.NewCounter(
+		"ledger_replication_applied_total",
+		"Account and transaction changes a passive region applied from the replication feed.",
+	)
+	replicationStale = metrics.NewCounter(
+		"ledger_replication_stale_total",
+		"Replication records dropped because a region promoted since had fenced their publisher off.",
+	)
+	replicationLag = metrics.NewGauge(
+		"ledger_replication_lag_seconds",
+		"Seconds since a passive region last heard from the active one.",
+	)
+)
+
+// the Postgres side of replication; a *db.Postgres
+type replicationStore interface {
+	checkpointStore
+	GetReplicationState(ctx context.Context) (*models.ReplicationStatus, error)
+	InitReplicationState(ctx context.Context, status *models.ReplicationStatus) error
+	SetReplicationRole(ctx context.Context, status *models.ReplicationStatus, expectEpoch int64) (bool, error)
+	ObserveReplicationEpoch(ctx context.Context, epoch int64, activeRegion string) (bool, error)
+	SaveReplicationProgress(ctx context.Context, capturedThrough *time.Time, capturedTxID *int64, captureToken []byte, lastHeartbeatAt, lastAppliedAt *time.Time) error
+	AccountChangesHead(ctx context.Context) (int64, error)
+	ExportAccountChanges(ctx context.Context, after int64, fn func(*models.Account, *models.AccountSummary) error) (int64, error)
+	PruneAccountChanges(ctx context.Context, before int64) error
+	DiscardAccountChanges(ctx context.Context) error
+	RestoreAccount(ctx context.Context, account *models.Account, summary *models.AccountSummary) error
+	RunExclusive(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error)
+}
+
+// the MongoDB side of replication; a *db.MongoDB
+type replicatedTransactions interface {
+	TransactionChangesHead(ctx context.Context) ([]byte, error)
+	ExportTransactionChanges(ctx context.Context, resumeAfter []byte, limit int, fn func(*models.Transaction) error) ([]byte, error)
+	RestoreTransaction(ctx context.Context, tx *models.Transaction) error
+	RequeuePending(ctx context.Context, at time.Time) (int64, error)
+}
+
+// handles a region's part in active-passive replication. The active region captures its account and transaction
+// changes onto a feed, with heartbeats, and passive regions apply them to stay warm. Every promotion raises the
+// epoch and puts a fence on the feed: a region that sees a newer epoch than its own stops being active, records
+// from an older epoch are dropped, and an active region that can't reach the feed for half its lease fences
+// itself, before a passive region that stopped hearing from it may be promoted
+type ReplicationService struct {
+	postgres replicationStore
+	mongodb  replicatedTransactions
+	feed     replication.Feed
+	region   string
+	lease    time.Duration
+	clock    clock.Clock
+
+	mu        sync.Mutex
+	status    *models.ReplicationStatus
+	checkedAt time.Time
+
+	// what the replicating replica has done since it last saved its progress
+	heardAt   *time.Time
+	appliedAt *time.Time
+
+	// the epoch the region captures its changes at, how far it got and when it last reached the feed; kept
+	// across restarts of replication, so a feed that keeps failing still runs out the lease
+	capturing    int64
+	capturedTxID int64
+	captureToken []byte
+	publishedAt  time.Time
+
+	// the replica's checkpoint on each partition of the feed, saved every heartbeatInterval
+	progress       map[int]*consumerProgress
+	checkpointedAt time.Time
+}
+
+// creates a new ReplicationService for region, replicating over feed
+func NewReplicationService(postgres *db.Postgres, mongodb *db.MongoDB, feed replication.Feed, region string) *ReplicationService {
+	return &ReplicationService{
+		postgres: postgres,
+		mongodb:  mongodb,
+		feed:     feed,
+		region:   region,
+		lease:    DefaultReplicationLease,
+		clock:    clock.System,
+		status:   &models.ReplicationStatus{Region: region, Role: models.RolePassive},
+		progress: map[int]*consumerProgress{},
+	}
+}
+
+// sets how long the active region may go unheard before a passive one may be promoted
+func (s *ReplicationService) SetLease(d time.Duration) {
+	s.lease = d
+}
+
+// Init records the role the region starts out in the first time it runs; afterwards the stored role wins, so
+// only promotion and demotion change it. It refuses a database another region's state is in
+func (s *ReplicationService) Init(ctx context.Context, role models.ReplicationRole) error {
+	if role != models.RoleActive && role != models.RolePassive {
+		return fmt.Errorf("invalid replication role %q", role)
+	}
+	initial := &models.ReplicationStatus{Region: s.region, Role: role, UpdatedBy: reqctx.FromContext(ctx).Actor}
+	if role == models.RoleActive {
+		initial.Epoch, initial.ActiveRegion = 1, s.region
+	}
+	if err := s.postgres.InitReplicationState(ctx, initial); err != nil {
+		return err
+	}
+	status, err := s.refresh(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Region != s.region {
+		return fmt.Errorf("database holds the replication state of region %s, not %s", status.Region, s.region)
+	}
+	if status.Role != role {
+		log.Printf("Region %s is %s at epoch %d, ignoring the configured %s role", s.region, status.Role, status.Epoch, role)
+	}
+	return nil
+}
+
+// returns the region's replication state, re-reading it at most every replicationCheckInterval
+// when the read fails the last known state is kept
+func (s *ReplicationService) Status(ctx context.Context) *models.ReplicationStatus {
+	s.mu.Lock()
+	now := s.clock.Now(ctx)
+	if now.Sub(s.checkedAt) < replicationCheckInterval {
+		defer s.mu.Unlock()
+		return s.status
+	}
+	s.checkedAt = now
+	s.mu.Unlock()
+
+	status, err := s.refresh(ctx)
+	if err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		log.Printf("Failed to read replication state, keeping role=%s: %v", s.status.Role, err)
+		return s.status
+	}
+	return status
+}
+
+// reports whether the region takes writes and processes transactions
+func (s *ReplicationService) Active(ctx context.Context) bool {
+	return s.Status(ctx).Role == models.RoleActive
+}
+
+// reads the state now
+func (s *ReplicationService) refresh(ctx context.Context) (*models.ReplicationStatus, error) {
+	status, err := s.postgres.GetReplicationState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.status = status
+	s.checkedAt = s.clock.Now(ctx)
+	s.mu.Unlock()
+	return status, nil
+}
+
+// Promote makes the region active under a new epoch and fences off the region active before it. Unless force is
+// set it refuses while the active region was heard from within the lease, and when the fence can't be published;
+// forcing is for a feed that is down along with the active region, which fenced itself once it lost the feed.
+// Transactions queued in the region that was active are queued again here. Returns the new state and how many
+// transactions were requeued
+func (s *ReplicationService) Promote(ctx context.Context, force bool) (*models.ReplicationStatus, int64, error) {
+	status, err := s.refresh(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if status.Role == models.RoleActive {
+		return status, 0, nil
+	}
+	now := s.clock.Now(ctx)
+	if !force && status.LastHeartbeatAt != nil && now.Sub(*status.LastHeartbeatAt) < s.lease {
+		return nil, 0, fmt.Errorf("%w: %s was heard from %s ago, within the %s lease",
+			ErrActiveRegionAlive, status.ActiveRegion, now.Sub(*status.LastHeartbeatAt).Round(time.Second), s.lease)
+	}
+
+	epoch := status.Epoch + 1
+	fence := &replication.Record{Kind: replication.KindFence, Region: s.region, Epoch: epoch, At: now}
+	if err := s.feed.Publish(ctx, fence); err != nil {
+		if !force {
+			return nil, 0, fmt.Errorf("failed to publish fence: %w", err)
+		}
+		log.Printf("Failed to publish fence for epoch %d, promoting anyway: %v", epoch, err)
+	}
+
+	promoted := &models.ReplicationStatus{
+		Region:       s.region,
+		Role:         models.RoleActive,
+		Epoch:        epoch,
+		ActiveRegion: s.region,
+		Reason:       "promoted",
+		UpdatedBy:    reqctx.FromContext(ctx).Actor,
+	}
+	ok, err := s.postgres.SetReplicationRole(ctx, promoted, status.Epoch)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, ErrReplicationConflict
+	}
+	// what the region holds so far came from the feed; capturing starts with its own changes
+	head, err := s.postgres.AccountChangesHead(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	token, err := s.mongodb.TransactionChangesHead(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.postgres.SaveReplicationProgress(ctx, &now, &head, token, nil, nil); err != nil {
+		return nil, 0, err
+	}
+	requeued, err := s.mongodb.RequeuePending(ctx, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	status, err = s.refresh(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return status, requeued, nil
+}
+
+// Demote makes the region passive, applying the active region's changes again: for a fenced region rejoining,
+// or an active one handing over before another is promoted
+func (s *ReplicationService) Demote(ctx context.Context) (*models.ReplicationStatus, error) {
+	status, err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Role == models.RolePassive {
+		return status, nil
+	}
+
+	demoted := &models.ReplicationStatus{
+		Region:       s.region,
+		Role:         models.RolePassive,
+		Epoch:        status.Epoch,
+		ActiveRegion: status.ActiveRegion,
+		Reason:       "demoted",
+		UpdatedBy:    reqctx.FromContext(ctx).Actor,
+	}
+	ok, err := s.postgres.SetReplicationRole(ctx, demoted, status.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrReplicationConflict
+	}
+	return s.refresh(ctx)
+}
+
+// Run replicates until ctx is done, on whichever processor replica holds the replication lock; the others
+// stand by to take over
+func (s *ReplicationService) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		ran, err := s.postgres.RunExclusive(ctx, replicationLock, s.replicate)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Replication stopped, restarting: %v", err)
+		}
+		if !ran || err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * captureInterval):
+			}
+		}
+	}
+}
+
+// replicate follows the feed and, while the region is active, captures its changes, until either fails
+func (s *ReplicationService) replicate(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- s.feed.Read(ctx, func(r *replication.Record) error {
+			if err := s.apply(ctx, r); err != nil {
+				return err
+			}
+			s.checkpoint(ctx, r)
+			return nil
+		})
+	}()
+	go func() { errs <- s.capture(ctx) }()
+	err := <-errs
+	cancel()
+	<-errs
+	return err
+}
+
+// apply handles one record from the feed: a newer epoch is recorded, fencing the region if it was active, and
+// a passive region applies the changes of the epoch it knows of
+func (s *ReplicationService) apply(ctx context.Context, r *replication.Record) error {
+	if r.Region == s.region {
+		return nil
+	}
+	status := s.Status(ctx)
+	if r.Epoch > status.Epoch {
+		advanced, err := s.postgres.ObserveReplicationEpoch(ctx, r.Epoch, r.Region)
+		if err != nil {
+			return err
+		}
+		if advanced {
+			if status.Role == models.RoleActive {
+				log.Printf("ALERT: region %s was promoted to epoch %d, fencing region %s", r.Region, r.Epoch, s.region)
+			} else {
+				log.Printf("Region %s is active at epoch %d", r.Region, r.Epoch)
+			}
+		}
+		if status, err = s.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	if r.Epoch < status.Epoch {
+		replicationStale.Inc()
+		return nil
+	}
+
+	now := s.clock.Now(ctx)
+	s.mu.Lock()
+	s.heardAt = &now
+	s.mu.Unlock()
+
+	if status.Role != models.RolePassive {
+		return nil
+	}
+	switch r.Kind {
+	case replication.KindAccount:
+		if err := s.postgres.RestoreAccount(ctx, r.Account, r.Summary); err != nil {
+			return fmt.Errorf("failed to apply account %s: %w", r.Account.ID, err)
+		}
+	case replication.KindTransaction:
+		tx, err := r.DecodeTransaction()
+		if err != nil {
+			return err
+		}
+		if err := s.mongodb.RestoreTransaction(ctx, tx); err != nil {
+			return fmt.Errorf("failed to apply transaction %s: %w", tx.ID, err)
+		}
+	default:
+		return nil
+	}
+	replicationApplied.Inc()
+	s.mu.Lock()
+	s.appliedAt = &now
+	s.mu.Unlock()
+	return nil
+}
+
+// capture publishes the region's changes and a heartbeat every captureInterval while it is active, and saves
+// what replication did otherwise, until ctx is done or the replication state can't be read
+func (s *ReplicationService) capture(ctx context.Context) error {
+	ticker := time.NewTicker(captureInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := s.captureOnce(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// captureOnce is one round of capture. An active region that goes half its lease without publishing fences itself
+func (s *ReplicationService) captureOnce(ctx context.Context) error {
+	if s.clock.Now(ctx).Sub(s.checkpointedAt) >= heartbeatInterval {
+		s.saveCheckpoints(ctx)
+	}
+
+	status := s.Status(ctx)
+	if status.Role != models.RoleActive {
+		s.capturing = 0
+		s.saveProgress(ctx, status)
+		// its accounts only change by applying the feed, and promotion captures from the head on
+		if err := s.postgres.DiscardAccountChanges(ctx); err != nil {
+			log.Printf("Failed to prune account changes: %v", err)
+		}
+		return nil
+	}
+	if s.capturing != status.Epoch {
+		// newly active, or another replica was replicating: pick up where the region's capture left off
+		fresh, err := s.refresh(ctx)
+		if err != nil {
+			return err
+		}
+		if fresh.Role != models.RoleActive {
+			return nil
+		}
+		s.capturing, s.publishedAt = fresh.Epoch, s.clock.Now(ctx)
+		if fresh.CapturedTxID != nil {
+			s.capturedTxID = *fresh.CapturedTxID
+		} else if s.capturedTxID, err = s.postgres.AccountChangesHead(ctx); err != nil {
+			return err
+		}
+		if fresh.CaptureToken != nil {
+			s.captureToken = fresh.CaptureToken
+		} else if s.captureToken, err = s.mongodb.TransactionChangesHead(ctx); err != nil {
+			return err
+		}
+	}
+
+	now := s.clock.Now(ctx)
+	throughTxID, token, err := s.publishChanges(ctx, s.capturing, s.capturedTxID, s.captureToken)
+	if err != nil {
+		log.Printf("Failed to publish changes to the replication feed: %v", err)
+		if now.Sub(s.publishedAt) > s.lease/2 {
+			s.fence(ctx, s.capturing, fmt.Sprintf("lost the replication feed for %s", now.Sub(s.publishedAt).Round(time.Second)))
+			s.capturing = 0
+		}
+		return nil
+	}
+	s.capturedTxID, s.captureToken, s.publishedAt = throughTxID, token, now
+	if err := s.postgres.SaveReplicationProgress(ctx, &now, &throughTxID, token, nil, nil); err != nil {
+		log.Printf("Failed to save replication progress: %v", err)
+		return nil
+	}
+	if err := s.postgres.PruneAccountChanges(ctx, throughTxID); err != nil {
+		log.Printf("Failed to prune account changes: %v", err)
+	}
+	return nil
+}
+
+// publishChanges puts the accounts changed by Postgres transactions from afterTxID on, and the transactions
+// changed after the change stream token resumeAfter, on the feed in batches, followed by a heartbeat. Both are
+// read in commit order, so a write that commits late is still published. Returns where account and transaction
+// capture got up to. Sandboxes aren't replicated: their simulated clocks stamp changes at times nothing else
+// follows
+func (s *ReplicationService) publishChanges(ctx context.Context, epoch, afterTxID int64, resumeAfter []byte) (int64, []byte, error) {
+	at := s.clock.Now(ctx)
+	var batch []*replication.Record
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.feed.Publish(ctx, batch...); err != nil {
+			return err
+		}
+		for _, r := range batch {
+			if r.Kind != replication.KindHeartbeat {
+				replicationPublished.Inc()
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	add := func(r *replication.Record) error {
+		r.Region, r.Epoch, r.At = s.region, epoch, at
+		batch = append(batch, r)
+		if len(batch) < captureBatchSize {
+			return nil
+		}
+		return flush()
+	}
+
+	throughTxID, err := s.postgres.ExportAccountChanges(ctx, afterTxID, func(account *models.Account, summary *models.AccountSummary) error {
+		if tenant.IsSandbox(account.TenantID) {
+			return nil
+		}
+		return add(replication.NewAccountRecord(account, summary))
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	token, err := s.mongodb.ExportTransactionChanges(ctx, resumeAfter, captureChangeLimit, func(tx *models.Transaction) error {
+		if tenant.IsSandbox(tx.TenantID) {
+			return nil
+		}
+		r, err := replication.NewTransactionRecord(tx)
+		if err != nil {
+			return err
+		}
+		return add(r)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := add(&replication.Record{Kind: replication.KindHeartbeat}); err != nil {
+		return 0, nil, err
+	}
+	return throughTxID, token, flush()
+}
+
+// fence stops the region being active at epoch, unless a promotion already changed it
+func (s *ReplicationService) fence(ctx context.Context, epoch int64, reason string) {
+	status := s.Status(ctx)
+	fenced := &models.ReplicationStatus{
+		Region:       s.region,
+		Role:         models.RoleFenced,
+		Epoch:        epoch,
+		ActiveRegion: status.ActiveRegion,
+		Reason:       reason,
+		UpdatedBy:    "replication",
+	}
+	if _, err := s.postgres.SetReplicationRole(ctx, fenced, epoch); err != nil {
+		log.Printf("ALERT: region %s %s but failed to fence itself: %v", s.region, reason, err)
+		return
+	}
+	log.Printf("ALERT: region %s %s, fenced itself", s.region, reason)
+	if _, err := s.refresh(ctx); err != nil {
+		log.Printf("Failed to read replication state: %v", err)
+	}
+}
+
+// saveProgress records when a region that isn't active last heard from the active one and applied a change
+func (s *ReplicationService) saveProgress(ctx context.Context, status *models.ReplicationStatus) {
+	s.mu.Lock()
+	heardAt, appliedAt := s.heardAt, s.appliedAt
+	s.heardAt, s.appliedAt = nil, nil
+	s.mu.Unlock()
+
+	last := status.LastHeartbeatAt
+	if heardAt != nil {
+		last = heardAt
+	}
+	if last != nil {
+		replicationLag.Set(s.clock.Now(ctx).Sub(*last).Seconds())
+	}
+	if heardAt == nil && appliedAt == nil {
+		return
+	}
+	if err := s.postgres.SaveReplicationProgress(ctx, nil, nil, nil, heardAt, appliedAt); err != nil {
+		log.Printf("Failed to save replication progress: %v", err)
+	}
+}
+
+// checkpoint moves the replica's checkpoint on the record's partition past it
+func (s *ReplicationService) checkpoint(ctx context.Context, r *replication.Record) {
+	pos := r.Position()
+	s.mu.Lock()
+	progress, ok := s.progress[pos.Partition]
+	if !ok {
+		progress = newConsumerProgress(instance, pos.Topic, pos.Partition, s.clock.Now(ctx))
+		s.progress[pos.Partition] = progress
+	}
+	s.mu.Unlock()
+
+	progress.delivered(false)
+	progress.processed("", pos.Offset, pos.HighWatermark, r.At, s.clock.Now(ctx))
+}
+
+// saveCheckpoints saves the replica's checkpoint on every partition it read from
+func (s *ReplicationService) saveCheckpoints(ctx context.Context) {
+	s.mu.Lock()
+	progress := make([]*consumerProgress, 0, len(s.progress))
+	for _, p := range s.progress {
+		progress = append(progress, p)
+	}
+	s.mu.Unlock()
+
+	for _, p := range progress {
+		p.save(ctx, s.postgres)
+	}
+	s.checkpointedAt = s.clock.Now(ctx)
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/replication"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// fakeReplicationStore keeps the replication state in memory with the same conditional updates as Postgres
+type fakeReplicationStore struct {
+	state    *models.ReplicationStatus
+	restored []string
+	headTxID int64
+	changed  []*models.Account
+}
+
+func (f *fakeReplicationStore) GetReplicationState(ctx context.Context) (*models.ReplicationStatus, error) {
+	status := *f.state
+	return &status, nil
+}
+
+func (f *fakeReplicationStore) InitReplicationState(ctx context.Context, status *models.ReplicationStatus) error {
+	if f.state == nil {
+		f.state = status
+	}
+	return nil
+}
+
+func (f *fakeReplicationStore) SetReplicationRole(ctx context.Context, status *models.ReplicationStatus, expectEpoch int64) (bool, error) {
+	if f.state.Epoch != expectEpoch {
+		return false, nil
+	}
+	f.state.Role, f.state.Epoch, f.state.ActiveRegion, f.state.Reason = status.Role, status.Epoch, status.ActiveRegion, status.Reason
+	return true, nil
+}
+
+func (f *fakeReplicationStore) ObserveReplicationEpoch(ctx context.Context, epoch int64, activeRegion string) (bool, error) {
+	if f.state.Epoch >= epoch {
+		return false, nil
+	}
+	f.state.Epoch, f.state.ActiveRegion = epoch, activeRegion
+	if f.state.Role == models.RoleActive {
+		f.state.Role, f.state.Reason = models.RoleFenced, "superseded by "+activeRegion
+	}
+	return true, nil
+}
+
+func (f *fakeReplicationStore) SaveReplicationProgress(ctx context.Context, capturedThrough *time.Time, capturedTxID *int64, captureToken []byte, lastHeartbeatAt, lastAppliedAt *time.Time) error {
+	if capturedThrough != nil {
+		f.state.CapturedThrough = capturedThrough
+	}
+	if capturedTxID != nil {
+		f.state.CapturedTxID = capturedTxID
+	}
+	if captureToken != nil {
+		f.state.CaptureToken = captureToken
+	}
+	if lastHeartbeatAt != nil {
+		f.state.LastHeartbeatAt = lastHeartbeatAt
+	}
+	if lastAppliedAt != nil {
+		f.state.LastAppliedAt = lastAppliedAt
+	}
+	return nil
+}
+
+func (f *fakeReplicationStore) AccountChangesHead(ctx context.Context) (int64, error) {
+	return f.headTxID, nil
+}
+
+func (f *fakeReplicationStore) ExportAccountChanges(ctx context.Context, after int64, fn func(*models.Account, *models.AccountSummary) error) (int64, error) {
+	for _, account := range f.changed {
+		if err := fn(account, nil); err != nil {
+			return 0, err
+		}
+	}
+	return f.headTxID, nil
+}
+
+func (f *fakeReplicationStore) PruneAccountChanges(ctx context.Context, before int64) error {
+	return nil
+}
+
+func (f *fakeReplicationStore) DiscardAccountChanges(ctx context.Context) error { return nil }
+
+func (f *fakeReplicationStore) RestoreAccount(ctx context.Context, account *models.Account, summary *models.AccountSummary) error {
+	f.restored = append(f.restored, account.ID)
+	return nil
+}
+
+func (f *fakeReplicationStore) RunExclusive(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error) {
+	return true, fn(ctx)
+}
+
+func (f *fakeReplicationStore) UpsertConsumerCheckpoint(ctx context.Context, cp *models.ConsumerCheckpoint) error {
+	return nil
+}
+
+// fakeTransactions hands out change stream tokens as the number of changes read so far
+type fakeTransactions struct {
+	changed []*models.Transaction
+}
+
+func (f *fakeTransactions) TransactionChangesHead(ctx context.Context) ([]byte, error) {
+	return []byte("head"), nil
+}
+
+func (f *fakeTransactions) ExportTransactionChanges(ctx context.Context, resumeAfter []byte, limit int, fn func(*models.Transaction) error) ([]byte, error) {
+	for _, tx := range f.changed {
+		if err := fn(tx); err != nil {
+			return nil, err
+		}
+	}
+	return append(resumeAfter, '+'), nil
+}
+
+func (f *fakeTransactions) RestoreTransaction(ctx context.Context, tx *models.Transaction) error {
+	return nil
+}
+
+func (f *fakeTransactions) RequeuePending(ctx context.Context, at time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeFeed records what is published, or refuses it while err is set
+type fakeFeed struct {
+	published []*replication.Record
+	err       error
+}
+
+func (f *fakeFeed) Publish(ctx context.Context, records ...*replication.Record) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, records...)
+	return nil
+}
+
+func (f *fakeFeed) Read(ctx context.Context, fn func(*replication.Record) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *fakeFeed) Close() error { return nil }
+
+var replicationStart = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestReplication(t *testing.T, region string, state models.ReplicationStatus) (*ReplicationService, *fakeReplicationStore, *fakeTransactions, *fakeFeed, *clock.Manual) {
+	t.Helper()
+	store := &fakeReplicationStore{state: &state, headTxID: 100}
+	transactions := &fakeTransactions{}
+	feed := &fakeFeed{}
+	c := clock.NewManual(replicationStart)
+	s := &ReplicationService{
+		postgres: store,
+		mongodb:  transactions,
+		feed:     feed,
+		region:   region,
+		lease:    DefaultReplicationLease,
+		clock:    c,
+		status:   &models.ReplicationStatus{Region: region, Role: models.RolePassive},
+		progress: map[int]*consumerProgress{},
+	}
+	if _, err := s.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s, store, transactions, feed, c
+}
+
+func accountRecord(region string, epoch int64, id string) *replication.Record {
+	r := replication.NewAccountRecord(&models.Account{ID: id}, nil)
+	r.Region, r.Epoch = region, epoch
+	return r
+}
+
+func TestApplyFencesSupersededActiveRegion(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _, _ := newTestReplication(t, "us-east", models.ReplicationStatus{
+		Region: "us-east", Role: models.RoleActive, Epoch: 2, ActiveRegion: "us-east",
+	})
+
+	fence := &replication.Record{Kind: replication.KindFence, Region: "eu-west", Epoch: 3}
+	if err := s.apply(ctx, fence); err != nil {
+		t.Fatal(err)
+	}
+	if store.state.Role != models.RoleFenced || store.state.Epoch != 3 || store.state.ActiveRegion != "eu-west" {
+		t.Fatalf("state = %+v, want fenced at epoch 3 behind eu-west", store.state)
+	}
+	if s.Active(ctx) {
+		t.Error("a superseded region must stop being active")
+	}
+
+	// a fenced region applies nothing until an operator demotes it
+	if err := s.apply(ctx, accountRecord("eu-west", 3, "acc-1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.restored) != 0 {
+		t.Errorf("fenced region restored %v", store.restored)
+	}
+}
+
+func TestApplyFollowsEpochs(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _, _ := newTestReplication(t, "eu-west", models.ReplicationStatus{
+		Region: "eu-west", Role: models.RolePassive, Epoch: 3, ActiveRegion: "us-east",
+	})
+
+	records := []*replication.Record{
+		accountRecord("us-east", 2, "stale"),   // from before the last promotion
+		accountRecord("eu-west", 3, "own"),     // the region's own records come back on the feed
+		accountRecord("us-east", 3, "current"), // the active region's
+		accountRecord("ap-south", 4, "newer"),  // a later promotion, which the region now follows
+		accountRecord("us-east", 3, "fenced"),  // the region it superseded
+	}
+	for _, r := range records {
+		if err := s.apply(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"current", "newer"}
+	if len(store.restored) != len(want) || store.restored[0] != want[0] || store.restored[1] != want[1] {
+		t.Errorf("restored %v, want %v", store.restored, want)
+	}
+	if store.state.Epoch != 4 || store.state.ActiveRegion != "ap-south" || store.state.Role != models.RolePassive {
+		t.Errorf("state = %+v, want passive at epoch 4 behind ap-south", store.state)
+	}
+}
+
+func TestPromoteWaitsOutTheLease(t *testing.T) {
+	ctx := context.Background()
+	heard := replicationStart.Add(-10 * time.Second)
+	s, store, _, feed, c := newTestReplication(t, "eu-west", models.ReplicationStatus{
+		Region: "eu-west", Role: models.RolePassive, Epoch: 2, ActiveRegion: "us-east", LastHeartbeatAt: &heard,
+	})
+
+	if _, _, err := s.Promote(ctx, false); !errors.Is(err, ErrActiveRegionAlive) {
+		t.Fatalf("expected ErrActiveRegionAlive within the lease, got %v", err)
+	}
+	if len(feed.published) != 0 || store.state.Role != models.RolePassive {
+		t.Fatal("a refused promotion must change nothing")
+	}
+
+	c.Advance(DefaultReplicationLease)
+	status, _, err := s.Promote(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Role != models.RoleActive || status.Epoch != 3 || status.ActiveRegion != "eu-west" {
+		t.Errorf("status = %+v, want active at epoch 3", status)
+	}
+	if len(feed.published) != 1 || feed.published[0].Kind != replication.KindFence || feed.published[0].Epoch != 3 {
+		t.Errorf("published %+v, want a fence for epoch 3", feed.published)
+	}
+	// capture starts from the heads, not from changes the region applied from the feed
+	if store.state.CapturedTxID == nil || *store.state.CapturedTxID != 100 || string(store.state.CaptureToken) != "head" {
+		t.Errorf("capture starts at %v/%q, want the heads", store.state.CapturedTxID, store.state.CaptureToken)
+	}
+}
+
+func TestPromoteNeedsTheFeedUnlessForced(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, feed, _ := newTestReplication(t, "eu-west", models.ReplicationStatus{
+		Region: "eu-west", Role: models.RolePassive, Epoch: 2, ActiveRegion: "us-east",
+	})
+	feed.err = errors.New("brokers unreachable")
+
+	if _, _, err := s.Promote(ctx, false); err == nil {
+		t.Fatal("expected promotion to fail without a fence on the feed")
+	}
+	if store.state.Role != models.RolePassive || store.state.Epoch != 2 {
+		t.Fatalf("state = %+v, want unchanged", store.state)
+	}
+
+	status, _, err := s.Promote(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Role != models.RoleActive || status.Epoch != 3 {
+		t.Errorf("status = %+v, want active at epoch 3", status)
+	}
+}
+
+func TestPromoteLosesToAConcurrentPromotion(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _, _ := newTestReplication(t, "eu-west", models.ReplicationStatus{
+		Region: "eu-west", Role: models.RolePassive, Epoch: 2, ActiveRegion: "us-east",
+	})
+	// another promotion lands between reading the state and changing it
+	s.postgres = &racingStore{fakeReplicationStore: store}
+
+	if _, _, err := s.Promote(ctx, false); !errors.Is(err, ErrReplicationConflict) {
+		t.Fatalf("expected ErrReplicationConflict, got %v", err)
+	}
+	if store.state.Role == models.RoleActive {
+		t.Error("the region must not turn active at an epoch it didn't win")
+	}
+}
+
+// racingStore has another region promoted just before the role changes
+type racingStore struct {
+	*fakeReplicationStore
+}
+
+func (r *racingStore) SetReplicationRole(ctx context.Context, status *models.ReplicationStatus, expectEpoch int64) (bool, error) {
+	r.state.Epoch++
+	return r.fakeReplicationStore.SetReplicationRole(ctx, status, expectEpoch)
+}
+
+func TestCapturePublishesInOrderWithHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	s, store, transactions, feed, _ := newTestReplication(t, "us-east", models.ReplicationStatus{
+		Region: "us-east", Role: models.RoleActive, Epoch: 4, ActiveRegion: "us-east",
+	})
+	store.changed = []*models.Account{{ID: "acc-1", TenantID: "acme"}, {ID: "acc-2", TenantID: tenant.Sandbox("acme")}}
+	transactions.changed = []*models.Transaction{{ID: "tx-1", TenantID: "acme"}}
+
+	if err := s.captureOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := []string{replication.KindAccount, replication.KindTransaction, replication.KindHeartbeat}
+	if len(feed.published) != len(kinds) {
+		t.Fatalf("published %d records, want %d (sandboxes left out)", len(feed.published), len(kinds))
+	}
+	for i, r := range feed.published {
+		if r.Kind != kinds[i] || r.Region != "us-east" || r.Epoch != 4 {
+			t.Errorf("record %d = %s from %s at epoch %d, want %s from us-east at epoch 4", i, r.Kind, r.Region, r.Epoch, kinds[i])
+		}
+	}
+	// with no saved progress capture starts at the heads, and saves where it got to
+	if string(store.state.CaptureToken) != "head+" || store.state.CapturedTxID == nil || *store.state.CapturedTxID != 100 {
+		t.Errorf("progress = %v/%q", store.state.CapturedTxID, store.state.CaptureToken)
+	}
+
+	if err := s.captureOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if string(store.state.CaptureToken) != "head++" {
+		t.Errorf("capture resumed from %q, want where the last one left off", store.state.CaptureToken)
+	}
+}
+
+func TestCaptureFencesAfterLosingTheFeed(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, feed, c := newTestReplication(t, "us-east", models.ReplicationStatus{
+		Region: "us-east", Role: models.RoleActive, Epoch: 4, ActiveRegion: "us-east",
+	})
+	feed.err = errors.New("brokers unreachable")
+
+	if err := s.captureOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.Advance(s.lease / 2)
+	if err := s.captureOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store.state.Role != models.RoleActive {
+		t.Fatalf("fenced after %s, before half the lease had passed", s.lease/2)
+	}
+
+	c.Advance(time.Second)
+	if err := s.captureOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store.state.Role != models.RoleFenced || store.state.Epoch != 4 {
+		t.Errorf("state = %+v, want fenced at epoch 4", store.state)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// handles reporting over ledger activity
+type ReportService struct {
+	mongodb *db.MongoDB
+}
+
+// creates a new ReportService
+func NewReportService(mongodb *db.MongoDB) *ReportService {
+	return &ReportService{
+		mongodb: mongodb,
+	}
+}
+
+// retrieves the completed ledger activity for [from, to), optionally for a single account
+func (s *ReportService) GetJournalEntries(ctx context.Context, accountID string, from, to time.Time) ([]*models.Transaction, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: report start must be before end", ErrInvalidReport)
+	}
+
+	txs, err := s.mongodb.GetCompletedTransactionsInRange(ctx, accountID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ledger activity: %w", err)
+	}
+
+	return txs, nil
+}
+
+// longest period account statistics cover
+const maxStatsPeriod = 366 * 24 * time.Hour
+
+// weekdays in ISO order, as keyed by the activity aggregation from 1
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// summarises an account's completed activity over [from, to) in buckets of the given timezone
+func (s *ReportService) GetAccountStats(ctx context.Context, account *models.Account, from, to time.Time, bucket models.StatsBucket, location *time.Location) (*models.AccountStats, error) {
+	if !bucket.Valid() {
+		return nil, fmt.Errorf("%w: bucket must be %s, %s or %s", ErrInvalidReport, models.BucketHour, models.BucketDay, models.BucketWeekday)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: report start must be before end", ErrInvalidReport)
+	}
+	if to.Sub(from) > maxStatsPeriod {
+		return nil, fmt.Errorf("%w: statistics cover at most 366 days", ErrInvalidReport)
+	}
+	found, err := s.mongodb.GetAccountActivityBuckets(ctx, account.ID, from, to, bucket, location.String())
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.ActivityBucket, len(found))
+	for _, b := range found {
+		byKey[b.Key] = b
+	}
+
+	stats := &models.AccountStats{
+		AccountID: account.ID,
+		Currency:  account.Currency,
+		Bucket:    bucket,
+		Timezone:  location.String(),
+		From:      from,
+		To:        to,
+		Buckets:   []models.ActivityBucket{},
+	}
+	var policy money.Policy
+	for _, key := range bucketKeys(bucket, from, to, location) {
+		b := byKey[key]
+		b.Key = key
+		if bucket == models.BucketWeekday {
+			n, _ := strconv.Atoi(key)
+			b.Key = weekdays[n-1]
+		}
+		b.Incoming = policy.Round(b.Incoming, account.Currency)
+		b.Outgoing = policy.Round(b.Outgoing, account.Currency)
+		stats.Buckets = append(stats.Buckets, b)
+
+		stats.Totals.Count += b.Count
+		stats.Totals.IncomingCount += b.IncomingCount
+		stats.Totals.OutgoingCount += b.OutgoingCount
+		stats.Totals.Incoming = policy.Round(stats.Totals.Incoming+b.Incoming, account.Currency)
+		stats.Totals.Outgoing = policy.Round(stats.Totals.Outgoing+b.Outgoing, account.Currency)
+	}
+
+	return stats, nil
+}
+
+// lists every bucket key of a period as the activity aggregation writes them, in order
+func bucketKeys(bucket models.StatsBucket, from, to time.Time, location *time.Location) []string {
+	var keys []string
+	switch bucket {
+	case models.BucketHour:
+		for h := 0; h < 24; h++ {
+			keys = append(keys, fmt.Sprintf("%02d", h))
+		}
+	case models.BucketWeekday:
+		for d := 1; d <= 7; d++ {
+			keys = append(keys, strconv.Itoa(d))
+		}
+	case models.BucketDay:
+		start := from.In(location)
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, location)
+		for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+			keys = append(keys, day.Format("2006-01-02"))
+		}
+	}
+	return keys
+}
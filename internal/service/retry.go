@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// failed attempts after which a transaction is left for an operator instead of retried
+	maxProcessingAttempts = 5
+
+	retryBatchSize = 500
+
+	// how long a claim may stand before the processor holding it is taken to have stopped; an attempt gives up
+	// after commitTimeout, so by then its balance change has committed or never will
+	claimLease = 5 * time.Minute
+)
+
+// when failed processing attempts are retried; the jitter spreads out transactions failed by the same outage
+var processingRetry = retry.Policy{
+	MaxAttempts: maxProcessingAttempts,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    10 * time.Minute,
+	Jitter:      0.2,
+}
+
+var transientFailures = metrics.NewCounter(
+	"ledger_processing_transient_failures_total",
+	"Processing attempts given up over an unreachable or overloaded database; their transactions are retried.",
+)
+
+var reclaimedClaims = metrics.NewCounter(
+	"ledger_processing_reclaimed_total",
+	"Claims held by a processor that stopped part-way and taken back by the reclaim job.",
+)
+
+// gives up claimed transactions over a transient error before their balances moved: the claims are released, so
+// the failed attempt is retried with backoff instead of failing transactions that did nothing wrong
+func (s *TransactionService) retryLater(ctx context.Context, err error, txs ...*models.Transaction) error {
+	for _, tx := range txs {
+		if _, releaseErr := s.mongodb.ReleaseClaim(ctx, tx.ID); releaseErr != nil {
+			log.Printf("%sFailed to release transaction %s for a retry: %v", reqctx.LogPrefix(ctx), tx.ID, releaseErr)
+		}
+	}
+	transientFailures.Inc()
+	return fmt.Errorf("%w: %v", ErrTransient, err)
+}
+
+// records a processing attempt that ended in an error while the transaction is still pending
+// unclaimed transactions are retried with backoff; claimed ones stopped part-way and need an operator
+func (s *TransactionService) recordAttemptFailure(ctx context.Context, tx *models.Transaction, err error) {
+	if errors.Is(err, ErrNotPending) {
+		return
+	}
+
+	updated, recordErr := s.mongodb.RecordProcessingError(ctx, tx.ID, err.Error())
+	if recordErr != nil {
+		log.Printf("%sFailed to record processing error for transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, recordErr)
+		return
+	}
+	if updated == nil {
+		// failed, completed or parked; the error is already on the transaction
+		return
+	}
+
+	s.retryAttempt(ctx, updated, err.Error())
+}
+
+// schedules another attempt of a pending transaction whose attempt failed, unless it is claimed or out of attempts
+func (s *TransactionService) retryAttempt(ctx context.Context, tx *models.Transaction, detail string) {
+	if tx.ProcessingStartedAt == nil && tx.Attempts < processingRetry.MaxAttempts {
+		next := s.clock.Now(ctx).Add(processingRetry.Delay(tx.Attempts))
+		if scheduleErr := s.mongodb.ScheduleRetry(ctx, tx.ID, next); scheduleErr != nil {
+			log.Printf("%sFailed to schedule retry for transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, scheduleErr)
+		} else {
+			detail = fmt.Sprintf("%s; retrying at %s", detail, next.UTC().Format(time.RFC3339))
+		}
+	}
+	s.record(ctx, tx, models.TimelineAttemptFailed, detail)
+}
+
+// queues again every transaction whose retry is due
+// intended to be run by the scheduler
+func (s *TransactionService) RetryDue(ctx context.Context) error {
+	now := s.clock.Now(ctx)
+	txs, err := s.mongodb.GetDueRetries(ctx, now, retryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	ctx = withComponent(ctx, "scheduler")
+	for _, tx := range txs {
+		txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+		claimed, err := s.mongodb.ClaimRetry(txCtx, tx.ID, now)
+		if err != nil {
+			log.Printf("Failed to claim retry of transaction %s: %v", tx.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		txCtx = reqctx.WithMetadata(txCtx, reqctx.Metadata{RequestID: tx.RequestID})
+		if err := s.rabbitmq.PublishTransaction(txCtx, tx); err != nil {
+			// put it back so the next run tries again
+			log.Printf("Failed to requeue transaction %s: %v", tx.ID, err)
+			if scheduleErr := s.mongodb.ScheduleRetry(txCtx, tx.ID, now); scheduleErr != nil {
+				log.Printf("Failed to reschedule transaction %s: %v", tx.ID, scheduleErr)
+			}
+			continue
+		}
+		s.record(txCtx, tx, models.TimelineRetried, fmt.Sprintf("attempt %d", tx.Attempts+1))
+	}
+
+	return nil
+}
+
+// takes back the claims of processors that stopped part-way: a transaction whose balance moved is completed with
+// the balances recorded then, any other counts the abandoned attempt and is retried like a failed one
+// intended to be run by the scheduler
+func (s *TransactionService) ReclaimStale(ctx context.Context) error {
+	claimedBefore := s.clock.Now(ctx).Add(-claimLease)
+	txs, err := s.mongodb.GetStaleClaims(ctx, claimedBefore, retryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	ctx = withComponent(ctx, "scheduler")
+	for _, tx := range txs {
+		txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+		txCtx = reqctx.WithMetadata(txCtx, reqctx.Metadata{RequestID: tx.RequestID})
+		if err := s.reclaim(txCtx, tx, claimedBefore); err != nil {
+			log.Printf("Failed to reclaim transaction %s: %v", tx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *TransactionService) reclaim(ctx context.Context, tx *models.Transaction, claimedBefore time.Time) error {
+	before, after, applied, err := s.postgres.GetAppliedBalance(ctx, tx.ID)
+	if err != nil {
+		return err
+	}
+	if applied {
+		account, err := s.postgres.GetAccount(ctx, tx.AccountID)
+		if err != nil {
+			return err
+		}
+		if err := s.complete(ctx, tx, account, before, after); err != nil {
+			return err
+		}
+		reclaimedClaims.Inc()
+		log.Printf("Completed transaction %s, whose processor stopped after its balance moved", tx.ID)
+		s.creditApplied(ctx, tx)
+		return nil
+	}
+
+	lastError := fmt.Sprintf("processing stopped part-way; claimed at %s", tx.ProcessingStartedAt.UTC().Format(time.RFC3339))
+	updated, err := s.mongodb.ReclaimTransaction(ctx, tx.ID, claimedBefore, lastError)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		// finished or claimed again in the meantime
+		return nil
+	}
+	reclaimedClaims.Inc()
+	log.Printf("Released transaction %s, whose processor stopped before its balance moved", tx.ID)
+
+	// the later legs of a group wait on its first one, whose retry applies them all
+	if updated.Leg > 1 {
+		return nil
+	}
+	s.retryAttempt(ctx, updated, lastError)
+	return nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/rules"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// rule names are what failure reasons and the risk team's listings show
+	maxRuleNameLength = 255
+
+	// how long a replica keeps using the rules it loaded before reading them again
+	DefaultRuleRefresh = 30 * time.Second
+)
+
+// the variables rule expressions can use; see ruleEnv
+var ruleVariables = []string{
+	"amount", "fee", "tx_type", "currency", "account_id", "counterparty_account_id", "counterparty_id",
+	"balance", "kyc_status", "hour", "weekday", "metadata", "account_metadata",
+}
+
+type compiledRule struct {
+	rule    *models.Rule
+	program *rules.Program
+}
+
+type loadedRules struct {
+	rules    []compiledRule
+	loadedAt time.Time
+}
+
+// manages the tenant's scripted limit, fraud and fee rules and evaluates them
+// enabled rules are cached per tenant and read again after the refresh interval, so edits reach every replica
+// without a restart
+type RuleService struct {
+	postgres *db.Postgres
+	clock    clock.Clock
+	refresh  time.Duration
+
+	mu     sync.Mutex
+	loaded map[string]loadedRules
+}
+
+// creates a new RuleService
+func NewRuleService(postgres *db.Postgres) *RuleService {
+	return &RuleService{
+		postgres: postgres,
+		clock:    clock.System,
+		refresh:  DefaultRuleRefresh,
+		loaded:   make(map[string]loadedRules),
+	}
+}
+
+// sets how long loaded rules are used before they are read again
+func (s *RuleService) SetRefreshInterval(refresh time.Duration) {
+	s.refresh = refresh
+}
+
+// adds a rule; it is enabled unless the request says otherwise
+func (s *RuleService) CreateRule(ctx context.Context, req *models.RuleRequest) (*models.Rule, error) {
+	rule := &models.Rule{Name: req.Name, Kind: req.Kind, Expression: req.Expression, Enabled: true}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := validateRule(rule); err != nil {
+		return nil, err
+	}
+	if err := s.postgres.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return rule, nil
+}
+
+// retrieves a rule by ID
+func (s *RuleService) GetRule(ctx context.Context, id string) (*models.Rule, error) {
+	return s.postgres.GetRule(ctx, id)
+}
+
+// lists the tenant's rules by name
+func (s *RuleService) GetRules(ctx context.Context, limit, offset int) ([]*models.Rule, error) {
+	return s.postgres.GetRules(ctx, limit, offset)
+}
+
+// updates a rule; empty fields are left unchanged
+func (s *RuleService) UpdateRule(ctx context.Context, id string, req *models.RuleRequest) (*models.Rule, error) {
+	rule, err := s.postgres.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" {
+		rule.Name = req.Name
+	}
+	if req.Kind != "" {
+		rule.Kind = req.Kind
+	}
+	if req.Expression != "" {
+		rule.Expression = req.Expression
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := validateRule(rule); err != nil {
+		return nil, err
+	}
+	if err := s.postgres.UpdateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return rule, nil
+}
+
+// deletes a rule
+func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
+	if err := s.postgres.DeleteRule(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+// checks a rule's name and kind and that its expression compiles
+func validateRule(rule *models.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" || len(rule.Name) > maxRuleNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidRule, maxRuleNameLength)
+	}
+	if !rule.Kind.Valid() {
+		return fmt.Errorf("%w: kind must be limit, fraud or fee", ErrInvalidRule)
+	}
+	if _, err := rules.Compile(rule.Expression, ruleVariables); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return nil
+}
+
+// refuses a transaction request a limit rule matches
+func (s *RuleService) CheckLimits(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	matched, err := s.match(ctx, models.RuleLimit, tx, account)
+	if err != nil || matched == nil {
+		return err
+	}
+	return fmt.Errorf("%w: rule %s", ErrLimitExceeded, matched.Name)
+}
+
+// returns the fee the fee rules add to a transaction, with fee in the environment being the scheduled fee
+func (s *RuleService) Fee(ctx context.Context, tx *models.Transaction, account *models.Account) (float64, error) {
+	loaded, err := s.rulesFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	env := ruleEnv(tx, account, s.clock.Now(ctx))
+	var fee float64
+	for _, r := range loaded {
+		if r.rule.Kind != models.RuleFee {
+			continue
+		}
+		n, err := r.program.Number(env)
+		if err != nil {
+			log.Printf("%sSkipping fee rule %s for transaction %s: %v", reqctx.LogPrefix(ctx), r.rule.Name, tx.ID, err)
+			continue
+		}
+		fee += n
+	}
+	return fee, nil
+}
+
+// PreProcess fails a transaction a fraud rule matches; the service is registered as a processing hook
+func (s *RuleService) PreProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	matched, err := s.match(ctx, models.RuleFraud, tx, account)
+	if err != nil {
+		return fmt.Errorf("failed to load rules: %w", err)
+	}
+	if matched != nil {
+		return fmt.Errorf("fraud rule %s matched", matched.Name)
+	}
+	return nil
+}
+
+// SimulatePreProcess is PreProcess, which only reads the rules, for simulated transactions
+func (s *RuleService) SimulatePreProcess(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	return s.PreProcess(ctx, tx, account)
+}
+
+// returns the first rule of the kind whose expression is true; a rule that fails to evaluate is logged
+// and skipped, so one broken rule can't stop all traffic
+func (s *RuleService) match(ctx context.Context, kind models.RuleKind, tx *models.Transaction, account *models.Account) (*models.Rule, error) {
+	loaded, err := s.rulesFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	env := ruleEnv(tx, account, s.clock.Now(ctx))
+	for _, r := range loaded {
+		if r.rule.Kind != kind {
+			continue
+		}
+		matched, err := r.program.Bool(env)
+		if err != nil {
+			log.Printf("%sSkipping %s rule %s for transaction %s: %v", reqctx.LogPrefix(ctx), kind, r.rule.Name, tx.ID, err)
+			continue
+		}
+		if matched {
+			return r.rule, nil
+		}
+	}
+	return nil, nil
+}
+
+// ruleEnv is what rule expressions see of a transaction and its account
+func ruleEnv(tx *models.Transaction, account *models.Account, now time.Time) rules.Env {
+	metadata := tx.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	accountMetadata := account.Metadata
+	if accountMetadata == nil {
+		accountMetadata = map[string]string{}
+	}
+	return rules.Env{
+		"amount":                  tx.Amount,
+		"fee":                     tx.Fee,
+		"tx_type":                 string(tx.Type),
+		"currency":                account.Currency,
+		"account_id":              tx.AccountID,
+		"counterparty_account_id": tx.CounterpartyAccountID,
+		"counterparty_id":         tx.CounterpartyID,
+		"balance":                 account.Balance,
+		"kyc_status":              string(account.KYCStatus),
+		"hour":                    float64(now.UTC().Hour()),
+		"weekday":                 now.UTC().Weekday().String(),
+		"metadata":                metadata,
+		"account_metadata":        accountMetadata,
+	}
+}
+
+// returns the tenant's enabled rules, reading them again once the cached set is older than the refresh interval
+// rules that no longer compile, e.g. after a variable was removed, are logged and left out
+func (s *RuleService) rulesFor(ctx context.Context) ([]compiledRule, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	now := s.clock.Now(ctx)
+
+	s.mu.Lock()
+	cached, ok := s.loaded[tenantID]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < s.refresh {
+		return cached.rules, nil
+	}
+
+	stored, err := s.postgres.GetEnabledRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]compiledRule, 0, len(stored))
+	for _, rule := range stored {
+		program, err := rules.Compile(rule.Expression, ruleVariables)
+		if err != nil {
+			log.Printf("%sSkipping rule %s: %v", reqctx.LogPrefix(ctx), rule.Name, err)
+			continue
+		}
+		compiled = append(compiled, compiledRule{rule: rule, program: program})
+	}
+
+	s.mu.Lock()
+	s.loaded[tenantID] = loadedRules{rules: compiled, loadedAt: now}
+	s.mu.Unlock()
+	return compiled, nil
+}
+
+// drops the caller's tenant's cached rules after a change, so this replica uses it straight away
+func (s *RuleService) invalidate(ctx context.Context) {
+	tenantID, _ := tenant.FromContext(ctx)
+	s.mu.Lock()
+	delete(s.loaded, tenantID)
+	s.mu.Unlock()
+}
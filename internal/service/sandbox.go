@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// the furthest a sandbox clock moves in one step
+const maxClockAdvance = 10 * 366 * 24 * time.Hour
+
+// handles the simulated clocks sandbox tenants use to test time-dependent behaviour without waiting
+type SandboxService struct {
+	postgres *db.Postgres
+	clock    *clock.Simulated
+}
+
+// creates a new SandboxService
+func NewSandboxService(postgres *db.Postgres, c *clock.Simulated) *SandboxService {
+	return &SandboxService{postgres: postgres, clock: c}
+}
+
+// returns the sandbox tenant's simulated time
+func (s *SandboxService) GetClock(ctx context.Context) (*models.SandboxClock, error) {
+	tenantID, err := sandboxTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := s.postgres.GetSandboxClockOffset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.newSandboxClock(ctx, tenantID, offset), nil
+}
+
+// moves the sandbox tenant's clock forward; clocks never go back, so nothing that fell due is undone
+func (s *SandboxService) AdvanceClock(ctx context.Context, req *models.AdvanceClockRequest) (*models.SandboxClock, error) {
+	tenantID, err := sandboxTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var by time.Duration
+	switch {
+	case req.Duration != "" && req.Until != nil:
+		return nil, fmt.Errorf("%w: give either duration or until, not both", ErrInvalidClockAdvance)
+	case req.Duration != "":
+		by, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid duration: %s", ErrInvalidClockAdvance, req.Duration)
+		}
+	case req.Until != nil:
+		by = req.Until.Sub(s.clock.Now(ctx))
+	default:
+		return nil, fmt.Errorf("%w: duration or until is required", ErrInvalidClockAdvance)
+	}
+	if by < time.Second {
+		return nil, fmt.Errorf("%w: the clock can only move forward, by at least a second", ErrInvalidClockAdvance)
+	}
+	if by > maxClockAdvance {
+		return nil, fmt.Errorf("%w: the clock can move at most %s at a time", ErrInvalidClockAdvance, maxClockAdvance)
+	}
+
+	offset, err := s.postgres.AdvanceSandboxClock(ctx, by)
+	if err != nil {
+		return nil, err
+	}
+	s.clock.Set(tenantID, offset)
+
+	return s.newSandboxClock(ctx, tenantID, offset), nil
+}
+
+// sandboxTenant returns the tenant in ctx, refusing live tenants
+func sandboxTenant(ctx context.Context) (string, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	if !tenant.IsSandbox(tenantID) {
+		return "", fmt.Errorf("%w: sandbox clocks are only available in sandbox mode", ErrNotAllowed)
+	}
+	return tenantID, nil
+}
+
+func (s *SandboxService) newSandboxClock(ctx context.Context, tenantID string, offset time.Duration) *models.SandboxClock {
+	return &models.SandboxClock{
+		TenantID:      tenantID,
+		Now:           s.clock.Now(ctx),
+		OffsetSeconds: int64(offset / time.Second),
+	}
+}
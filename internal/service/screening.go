@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/screening"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// sets the screener run before withdrawals and transfers of at least threshold are applied
+func (s *TransactionService) SetScreener(screener screening.Screener, threshold float64) {
+	s.screener = screener
+	s.screeningThreshold = threshold
+}
+
+// screens the transaction when it is in scope and parks it for review on a hit; reports whether it was parked
+// screening errors park the transaction too, so nothing unscreened gets through while the provider is down
+// sandbox transactions move no real money and are never sent to the provider
+func (s *TransactionService) screen(ctx context.Context, tx *models.Transaction) (bool, error) {
+	if s.screener == nil || tx.Type == models.Deposit || tx.Amount < s.screeningThreshold || tenant.IsSandbox(tx.TenantID) {
+		return false, nil
+	}
+	if tx.Screening != nil && tx.Screening.Decision == models.ScreeningCleared {
+		return false, nil
+	}
+
+	result, err := s.screener.Screen(ctx, tx)
+	if err != nil {
+		log.Printf("%sFailed to screen transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		result = &models.ScreeningResult{Error: err.Error()}
+	}
+	if result == nil || (!result.Hit && result.Error == "") {
+		return false, nil
+	}
+	result.CheckedAt = s.clock.Now(ctx)
+
+	parked, err := s.mongodb.ReviewTransaction(ctx, tx.ID, result)
+	if err != nil {
+		return true, err
+	}
+	if !parked {
+		return true, fmt.Errorf("%w: %s", ErrNotPending, tx.ID)
+	}
+
+	tx.Status = models.InReview
+	tx.Screening = result
+	detail := "screening hit"
+	if result.Error != "" {
+		detail = "screening failed: " + result.Error
+	}
+	s.record(ctx, tx, models.TimelineInReview, detail)
+	log.Printf("%sParked transaction %s for compliance review", reqctx.LogPrefix(ctx), tx.ID)
+	return true, nil
+}
+
+// lists transactions parked by screening; an empty tenantID covers the whole platform
+func (s *TransactionService) GetReviewTransactions(ctx context.Context, tenantID string, limit, offset int) ([]*models.Transaction, error) {
+	return s.mongodb.GetReviewTransactions(ctx, tenantID, limit, offset)
+}
+
+// counts transactions waiting for a compliance decision
+func (s *TransactionService) CountReviewTransactions(ctx context.Context, tenantID string) (models.Count, error) {
+	return s.mongodb.CountReviewTransactions(ctx, tenantID)
+}
+
+// releases a transaction in review for processing; it isn't screened again
+func (s *TransactionService) ClearTransaction(ctx context.Context, id string, req *models.ScreeningReviewRequest) (*models.Transaction, error) {
+	tx, err := s.mongodb.ResolveReview(ctx, id, models.ScreeningCleared, reqctx.FromContext(ctx).Actor, req.Note)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, ErrNotInReview
+	}
+	s.record(ctx, tx, models.TimelineCleared, req.Note)
+
+	if err := s.rabbitmq.PublishTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to queue transaction: %w", err)
+	}
+	s.record(ctx, tx, models.TimelineQueued, "")
+
+	return tx, nil
+}
+
+// fails a transaction in review without processing it
+func (s *TransactionService) BlockTransaction(ctx context.Context, id string, req *models.ScreeningReviewRequest) (*models.Transaction, error) {
+	tx, err := s.mongodb.ResolveReview(ctx, id, models.ScreeningBlocked, reqctx.FromContext(ctx).Actor, req.Note)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, ErrNotInReview
+	}
+	s.record(ctx, tx, models.TimelineBlocked, req.Note)
+
+	return tx, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+// works out what a transaction request would do: the checks CreateTransaction makes are returned as errors just
+// the same, and the processor's checks and balance update are applied to the current balances less the debits
+// queued ahead of it. Nothing is stored, reserved, queued or screened, so a later request can still come out
+// differently
+func (s *TransactionService) SimulateTransaction(ctx context.Context, req *models.TransactionRequest) (*models.TransactionSimulation, error) {
+	tx, account, replay, err := s.draftTransaction(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if replay {
+		return &models.TransactionSimulation{
+			Status:        tx.Status,
+			FailureReason: tx.FailureReason,
+			ReplayOf:      tx.ID,
+			Amount:        tx.Amount,
+			Fee:           tx.Fee,
+			BalanceBefore: tx.BalanceBefore,
+			BalanceAfter:  tx.BalanceAfter,
+		}, nil
+	}
+
+	if err := s.checkVolume(ctx, req.System, tx); err != nil {
+		return nil, err
+	}
+
+	// debits already queued or awaiting funds take their share of the balance first
+	pending, err := s.mongodb.SumPendingDebits(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.TransactionSimulation{
+		Status:        models.Completed,
+		DuplicateOf:   tx.DuplicateOf,
+		Amount:        tx.Amount,
+		Fee:           tx.Fee,
+		ValueDate:     tx.ValueDate.Format(calendar.DateLayout),
+		BackDated:     tx.BackDated,
+		BalanceBefore: account.Balance,
+		PendingDebits: pending,
+	}
+
+	var counterparty *models.Account
+	if tx.CounterpartyAccountID != "" {
+		if counterparty, err = s.postgres.GetAccount(ctx, tx.CounterpartyAccountID); err != nil {
+			return nil, fmt.Errorf("failed to get counterparty account: %w", err)
+		}
+	}
+
+	// the same steps as ProcessTransaction, in the same order, stopping where it would
+	if err := s.simulateProcessing(ctx, tx, account, counterparty, result); err != nil {
+		return nil, err
+	}
+	if tx.Status == models.Flagged && result.Status == models.Completed {
+		result.Status = models.Flagged
+	}
+	return result, nil
+}
+
+// applies the processor's checks and balance update to result; a refusal is reported on result, not returned
+func (s *TransactionService) simulateProcessing(ctx context.Context, tx *models.Transaction, account, counterparty *models.Account, result *models.TransactionSimulation) error {
+	accountIDs := []string{tx.AccountID}
+	if counterparty != nil {
+		accountIDs = append(accountIDs, counterparty.ID)
+	}
+	paused, err := s.postgres.FindPausedAccount(ctx, accountIDs...)
+	if err != nil {
+		return err
+	}
+	if paused != "" {
+		result.Status = models.Held
+		result.BalanceAfter = account.Balance
+		return nil
+	}
+
+	// refused deposits are suspended, as ProcessTransaction does
+	fail := func(reason error) error {
+		result.Status = models.Failed
+		if suspends(tx) {
+			result.Status = models.Suspended
+		}
+		result.FailureReason = reason.Error()
+		result.BalanceAfter = account.Balance
+		return nil
+	}
+	if err := s.checkKYC(ctx, tx, account); err != nil {
+		return fail(err)
+	}
+	if err := s.simulatePreProcess(ctx, tx, account); err != nil {
+		return fail(err)
+	}
+
+	// fees always reduce the balance, as in the balance update
+	balanceAfter := account.Balance - result.PendingDebits - tx.Fee
+	switch tx.Type {
+	case models.Deposit:
+		balanceAfter += tx.Amount
+	default:
+		balanceAfter -= tx.Amount
+	}
+	if balanceAfter < 0 {
+		result.Status = models.Failed
+		result.FailureReason = "failed to update balance: insufficient funds"
+		result.BalanceAfter = account.Balance
+		if tx.Type != models.Deposit && account.Kind == models.CustomerAccount {
+			policy, err := s.fundingPolicy(ctx, account)
+			if err != nil {
+				return err
+			}
+			if tx.RetryOnFunding || policy.InsufficientFunds.Parks() {
+				result.Status = models.AwaitingFunds
+			}
+		}
+		return nil
+	}
+
+	result.BalanceAfter = balanceAfter
+	if counterparty != nil {
+		credited := counterparty.Balance + tx.Amount
+		result.CounterpartyBalanceAfter = &credited
+	}
+	return nil
+}
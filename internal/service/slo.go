@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/metrics"
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+var (
+	processingLatency = metrics.NewHistogram(
+		"ledger_transaction_latency_seconds",
+		"Time from a transaction being queued to its completion.",
+		metrics.LatencyBuckets,
+	)
+	slaBreaches = metrics.NewCounter(
+		"ledger_transaction_sla_breaches_total",
+		"Transactions that completed after the processing SLA or expired before completing.",
+	)
+	expiredTransactions = metrics.NewCounter(
+		"ledger_transactions_expired_total",
+		"Transactions failed because they were not processed within the processing SLA.",
+	)
+)
+
+// latencyOf measures a transaction completing at completedAt from when it was last queued, the clock expiry
+// uses too: a pending transaction's updated_at. Time parked awaiting funds, held on a paused account or waiting
+// for review isn't processing time
+func latencyOf(tx *models.Transaction, completedAt time.Time) time.Duration {
+	return completedAt.Sub(tx.UpdatedAt)
+}
+
+// records the latency of a completed transaction
+func (s *TransactionService) observeCompletion(latency time.Duration) {
+	processingLatency.Observe(latency.Seconds())
+	if s.sla > 0 && latency > s.sla {
+		slaBreaches.Inc()
+	}
+}
+
+// builds the latency SLO report for the given window; an empty tenantID covers every tenant
+func (s *TransactionService) GetSLOReport(ctx context.Context, tenantID string, window time.Duration) (*models.SLOReport, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+	since := s.clock.Now(ctx).Add(-window)
+
+	completed, quantiles, err := s.mongodb.GetLatencyQuantiles(ctx, tenantID, since, []float64{0.50, 0.95, 0.99})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.SLOReport{
+		TenantID:   tenantID,
+		Window:     window.String(),
+		SLASeconds: s.sla.Seconds(),
+		Completed:  completed,
+		P50Seconds: quantiles[0].Seconds(),
+		P95Seconds: quantiles[1].Seconds(),
+		P99Seconds: quantiles[2].Seconds(),
+		Attainment: 1,
+	}
+
+	if s.sla > 0 {
+		report.Late, report.Expired, err = s.mongodb.CountSLABreaches(ctx, tenantID, since, s.sla)
+		if err != nil {
+			return nil, err
+		}
+		report.SLABreaches = report.Late + report.Expired
+		if total := completed + report.Expired; total > 0 {
+			report.Attainment = float64(total-report.SLABreaches) / float64(total)
+		}
+	}
+
+	return report, nil
+}
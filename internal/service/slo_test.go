@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+func TestLatencyOfExcludesParkedTime(t *testing.T) {
+	created := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		queuedAt time.Time
+		want     time.Duration
+	}{
+		{"queued when created", created, 3 * time.Second},
+		// parked awaiting funds for a day, then released
+		{"released after waiting", created.Add(24 * time.Hour), 3 * time.Second},
+	}
+	for _, tt := range tests {
+		tx := &models.Transaction{CreatedAt: created, UpdatedAt: tt.queuedAt}
+		if got := latencyOf(tx, tt.queuedAt.Add(3*time.Second)); got != tt.want {
+			t.Errorf("%s: latency %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/i18n"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/notify"
+	"github.com/abkawan/banking-ledger/internal/retry"
+	"github.com/abkawan/banking-ledger/internal/storage"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+const (
+	// number of statement emails the statement job attempts per run
+	statementBatchSize = 100
+
+	// how long the signed URL of an archived statement stays valid
+	statementDocumentTTL = 15 * time.Minute
+)
+
+// when failed statement emails are sent again: 5 minutes after the first failure, doubling with every further
+// one, until the delivery is given up on
+var statementRetry = retry.Policy{
+	MaxAttempts: 5,
+	BaseDelay:   5 * time.Minute,
+	Jitter:      0.2,
+}
+
+// handles periodic account statements and their email delivery
+type StatementService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+	email              notify.Channel
+	store              storage.Store
+	clock              clock.Clock
+}
+
+// creates a new StatementService; email may be nil, in which case statements are scheduled but not sent
+func NewStatementService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService, email notify.Channel) *StatementService {
+	return &StatementService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+		email:              email,
+		clock:              clock.System,
+	}
+}
+
+// sets the clock statement periods and retries are scheduled by
+func (s *StatementService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the object storage sent statements are archived in
+func (s *StatementService) SetStorage(store storage.Store) {
+	s.store = store
+}
+
+// retrieves an account's statement preferences, returning disabled monthly statements when none are set
+func (s *StatementService) GetPreferences(ctx context.Context, accountID string) (*models.StatementPreferences, error) {
+	if _, err := s.postgres.GetAccount(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	prefs, err := s.postgres.GetStatementPreferences(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		prefs = &models.StatementPreferences{AccountID: accountID, Frequency: models.Monthly, Locale: i18n.Default}
+	}
+
+	return prefs, nil
+}
+
+// replaces an account's statement preferences; enabling statements schedules the first one
+// for the end of the current period
+func (s *StatementService) UpdatePreferences(ctx context.Context, accountID string, req *models.StatementPreferencesRequest) (*models.StatementPreferences, error) {
+	frequency := req.Frequency
+	if frequency == "" {
+		frequency = models.Monthly
+	}
+	if frequency != models.Weekly && frequency != models.Monthly {
+		return nil, fmt.Errorf("%w: unknown statement frequency: %s", ErrInvalidStatementPreferences, frequency)
+	}
+	if req.Email != "" {
+		if err := notify.CheckEmail(req.Email); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStatementPreferences, err)
+		}
+	}
+	if req.Enabled && req.Email == "" {
+		return nil, fmt.Errorf("%w: email is required to enable statements", ErrInvalidStatementPreferences)
+	}
+	locale := i18n.FromContext(ctx)
+	if req.Locale != "" {
+		if locale = i18n.Supported(req.Locale); locale == "" {
+			return nil, fmt.Errorf("%w: unsupported locale %s, expected one of %s", ErrInvalidStatementPreferences, req.Locale, strings.Join(i18n.Locales(), ", "))
+		}
+	}
+
+	prefs := &models.StatementPreferences{
+		AccountID: accountID,
+		Enabled:   req.Enabled,
+		Email:     req.Email,
+		Frequency: frequency,
+		Locale:    locale,
+	}
+	if req.Enabled {
+		next := nextPeriodStart(frequency, s.clock.Now(ctx))
+		prefs.NextRunAt = &next
+	}
+	if err := s.postgres.UpsertStatementPreferences(ctx, prefs); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// retrieves an account's most recent statement deliveries
+func (s *StatementService) GetDeliveries(ctx context.Context, accountID string, limit, offset int) ([]*models.StatementDelivery, error) {
+	if _, err := s.postgres.GetAccount(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	return s.postgres.GetStatementDeliveries(ctx, accountID, limit, offset)
+}
+
+// counts an account's statement deliveries
+func (s *StatementService) CountDeliveries(ctx context.Context, accountID string) (models.Count, error) {
+	return s.postgres.CountStatementDeliveries(ctx, accountID)
+}
+
+// builds the statement of an account for the value dates in [from, to)
+// the closing balance is derived from the current balance by undoing everything value dated from to on
+func (s *StatementService) BuildStatement(ctx context.Context, account *models.Account, from, to time.Time) (*models.Statement, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: statement start must be before end", ErrInvalidReport)
+	}
+
+	// value dates run ahead of the clock, so everything from to onwards is undone
+	later, err := s.mongodb.GetAccountActivityInRange(ctx, account.ID, to, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account activity: %w", err)
+	}
+	period, err := s.mongodb.GetAccountActivityInRange(ctx, account.ID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account activity: %w", err)
+	}
+
+	round := func(v float64) float64 { return s.transactionService.rounding.Round(v, account.Currency) }
+
+	closing := account.Balance
+	for _, tx := range later {
+		closing -= balanceEffect(tx, account.ID)
+	}
+	opening := closing
+	for _, tx := range period {
+		opening -= balanceEffect(tx, account.ID)
+	}
+
+	statement := &models.Statement{
+		AccountID:      account.ID,
+		Currency:       account.Currency,
+		PeriodStart:    from,
+		PeriodEnd:      to,
+		OpeningBalance: round(opening),
+		ClosingBalance: round(closing),
+		Entries:        []models.StatementEntry{},
+	}
+	running := opening
+	for _, tx := range period {
+		effect := balanceEffect(tx, account.ID)
+		running += effect
+		// transactions from before value dating took effect the day they were created
+		valueDate := tx.CreatedAt.UTC()
+		if tx.ValueDate != nil {
+			valueDate = *tx.ValueDate
+		}
+		statement.Entries = append(statement.Entries, models.StatementEntry{
+			TransactionID: tx.ID,
+			Date:          tx.CreatedAt,
+			ValueDate:     valueDate.Format(calendar.DateLayout),
+			Type:          tx.Type,
+			Reference:     tx.Reference,
+			Amount:        round(effect),
+			Balance:       round(running),
+		})
+	}
+
+	return statement, nil
+}
+
+// schedules statements whose period has ended and sends pending statement emails, retrying failures
+// intended to be run by the scheduler
+func (s *StatementService) RunStatements(ctx context.Context) error {
+	for _, pass := range duePasses(ctx, s.clock) {
+		if err := s.runStatements(ctx, pass); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StatementService) runStatements(ctx context.Context, pass duePass) error {
+	due, err := s.postgres.GetDueStatementPreferences(ctx, pass.tenantID, pass.now)
+	if err != nil {
+		return err
+	}
+	for _, prefs := range due {
+		if err := s.schedule(tenant.WithTenant(ctx, prefs.TenantID), prefs, pass.now); err != nil {
+			log.Printf("Failed to schedule statement for account %s: %v", prefs.AccountID, err)
+		}
+	}
+
+	if s.email == nil {
+		return nil
+	}
+
+	deliveries, err := s.postgres.GetReadyStatementDeliveries(ctx, pass.tenantID, pass.now, statementBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if err := s.send(tenant.WithTenant(ctx, delivery.TenantID), delivery); err != nil {
+			log.Printf("Failed to record statement delivery %s: %v", delivery.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// records a delivery for the period ending at the preference's next run and moves the schedule on
+func (s *StatementService) schedule(ctx context.Context, prefs *models.StatementPreferences, now time.Time) error {
+	end := *prefs.NextRunAt
+	start := previousPeriodStart(prefs.Frequency, end)
+
+	// a schedule that fell behind skips straight to the next period after now
+	next := nextPeriodStart(prefs.Frequency, end)
+	if next.Before(now) {
+		next = nextPeriodStart(prefs.Frequency, now)
+	}
+
+	return s.postgres.ScheduleStatementDelivery(ctx, &models.StatementDelivery{
+		AccountID:   prefs.AccountID,
+		Email:       prefs.Email,
+		Locale:      prefs.Locale,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}, next)
+}
+
+// makes one attempt at emailing a statement and records the outcome
+func (s *StatementService) send(ctx context.Context, delivery *models.StatementDelivery) error {
+	delivery.Attempts++
+
+	err := s.deliver(ctx, delivery)
+	if err == nil {
+		now := s.clock.Now(ctx)
+		delivery.Status = models.DeliverySent
+		delivery.LastError = ""
+		delivery.SentAt = &now
+		return s.postgres.UpdateStatementDelivery(ctx, delivery)
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= statementRetry.MaxAttempts || !statementRetry.ShouldRetry(err) {
+		delivery.Status = models.DeliveryFailed
+		log.Printf("Giving up on statement delivery %s after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+	} else {
+		delivery.NextAttemptAt = s.clock.Now(ctx).Add(statementRetry.Delay(delivery.Attempts))
+	}
+	return s.postgres.UpdateStatementDelivery(ctx, delivery)
+}
+
+func (s *StatementService) deliver(ctx context.Context, delivery *models.StatementDelivery) error {
+	account, err := s.postgres.GetAccount(ctx, delivery.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+
+	statement, err := s.BuildStatement(ctx, account, delivery.PeriodStart, delivery.PeriodEnd)
+	if err != nil {
+		return err
+	}
+	if err := s.archive(ctx, delivery, statement); err != nil {
+		return err
+	}
+
+	// sandbox statements are built and recorded as sent but never emailed
+	if tenant.InSandbox(ctx) {
+		return nil
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+
+	return s.email.Send(sendCtx, delivery.Email, &models.Notification{
+		ID:        delivery.ID,
+		Event:     models.StatementReady,
+		AccountID: account.ID,
+		Subject:   i18n.T(delivery.Locale, "statement.subject", delivery.PeriodStart.Format("2006-01-02"), delivery.PeriodEnd.Format("2006-01-02")),
+		Message:   renderStatementText(statement, delivery.Locale),
+		CreatedAt: s.clock.Now(ctx),
+	})
+}
+
+// keeps the statement a delivery sends in object storage, once per delivery, when there is one
+func (s *StatementService) archive(ctx context.Context, delivery *models.StatementDelivery, statement *models.Statement) error {
+	if s.store == nil || delivery.DocumentKey != "" {
+		return nil
+	}
+	document, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to encode statement: %w", err)
+	}
+	key := fmt.Sprintf("statements/%s/%s/%s_%s.json", delivery.TenantID, delivery.AccountID,
+		delivery.PeriodStart.Format("2006-01-02"), delivery.PeriodEnd.Format("2006-01-02"))
+	if err := s.store.Put(ctx, key, "application/json", document); err != nil {
+		return fmt.Errorf("failed to archive statement: %w", err)
+	}
+	delivery.DocumentKey = key
+	return nil
+}
+
+// returns the archived statement of one of an account's deliveries as a signed URL, or its content when the
+// archive is encrypted
+func (s *StatementService) Document(ctx context.Context, accountID, deliveryID string) (*models.StatementDocument, error) {
+	delivery, err := s.postgres.GetStatementDelivery(ctx, accountID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil || delivery.DocumentKey == "" || s.store == nil {
+		return nil, ErrStatementNotArchived
+	}
+	document := &models.StatementDocument{
+		Filename: fmt.Sprintf("statement-%s-%s-%s.json", delivery.AccountID,
+			delivery.PeriodStart.Format("2006-01-02"), delivery.PeriodEnd.Format("2006-01-02")),
+	}
+	document.URL, err = s.store.SignedURL(ctx, delivery.DocumentKey, document.Filename, statementDocumentTTL)
+	if errors.Is(err, storage.ErrNotSignable) {
+		document.Content, err = s.store.Get(ctx, delivery.DocumentKey)
+		sum := sha256.Sum256(document.Content)
+		document.Checksum = hex.EncodeToString(sum[:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download statement: %w", err)
+	}
+	return document, nil
+}
+
+// renders a statement as a plain text email body in locale
+func renderStatementText(statement *models.Statement, locale string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", i18n.T(locale, "statement.heading", statement.AccountID, statement.Currency))
+	fmt.Fprintf(&b, "%s\n\n", i18n.T(locale, "statement.period", statement.PeriodStart.Format("2006-01-02"), statement.PeriodEnd.Format("2006-01-02")))
+	fmt.Fprintf(&b, "%s: %s\n\n", i18n.T(locale, "statement.opening_balance"), money.Plain(statement.OpeningBalance, statement.Currency))
+	if len(statement.Entries) == 0 {
+		fmt.Fprintf(&b, "%s\n", i18n.T(locale, "statement.no_activity"))
+	}
+	for _, e := range statement.Entries {
+		fmt.Fprintf(&b, "%s  %s  %-10s  %12s  %12s  %s\n", e.Date.Format("2006-01-02"), e.ValueDate, e.Type,
+			money.Plain(e.Amount, statement.Currency), money.Plain(e.Balance, statement.Currency), e.Reference)
+	}
+	fmt.Fprintf(&b, "\n%s: %s\n", i18n.T(locale, "statement.closing_balance"), money.Plain(statement.ClosingBalance, statement.Currency))
+	return b.String()
+}
+
+// returns the signed change a completed transaction made to accountID's balance
+func balanceEffect(tx *models.Transaction, accountID string) float64 {
+	switch {
+	case tx.Type == models.Transfer && tx.CounterpartyAccountID == accountID:
+		return tx.Amount
+	case tx.Type == models.Transfer, tx.Type == models.Withdrawal:
+		return -(tx.Amount + tx.Fee)
+	default:
+		return tx.Amount - tx.Fee
+	}
+}
+
+// returns the start of the first statement period beginning after t (UTC)
+func nextPeriodStart(frequency models.StatementFrequency, t time.Time) time.Time {
+	t = t.UTC()
+	if frequency == models.Weekly {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		daysToMonday := (8 - int(day.Weekday())) % 7
+		if daysToMonday == 0 {
+			daysToMonday = 7
+		}
+		return day.AddDate(0, 0, daysToMonday)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+}
+
+// returns the start of the statement period that ends at periodEnd
+func previousPeriodStart(frequency models.StatementFrequency, periodEnd time.Time) time.Time {
+	if frequency == models.Weekly {
+		return periodEnd.AddDate(0, 0, -7)
+	}
+	return periodEnd.AddDate(0, -1, 0)
+}
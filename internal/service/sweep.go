@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// handles balance sweep rules
+type SweepService struct {
+	postgres           *db.Postgres
+	mongodb            *db.MongoDB
+	transactionService *TransactionService
+}
+
+// creates a new SweepService
+func NewSweepService(postgres *db.Postgres, mongodb *db.MongoDB, transactionService *TransactionService) *SweepService {
+	return &SweepService{
+		postgres:           postgres,
+		mongodb:            mongodb,
+		transactionService: transactionService,
+	}
+}
+
+// creates a sweep rule on an account
+func (s *SweepService) CreateRule(ctx context.Context, accountID string, req *models.SweepRuleRequest) (*models.SweepRule, error) {
+	if req.TargetAccountID == "" || req.TargetAccountID == accountID {
+		return nil, fmt.Errorf("sweep target must be a different account")
+	}
+	if req.TargetBalance < 0 {
+		return nil, fmt.Errorf("target balance cannot be negative")
+	}
+	if req.FloorBalance != nil && (*req.FloorBalance < 0 || *req.FloorBalance > req.TargetBalance) {
+		return nil, fmt.Errorf("floor balance must be between 0 and the target balance")
+	}
+	target, err := s.postgres.GetAccount(ctx, req.TargetAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("sweep target account not found")
+	}
+	if target.Kind != models.CustomerAccount {
+		return nil, fmt.Errorf("sweep target must be a customer account")
+	}
+
+	rule := &models.SweepRule{
+		AccountID:       accountID,
+		TargetAccountID: req.TargetAccountID,
+		TargetBalance:   req.TargetBalance,
+		FloorBalance:    req.FloorBalance,
+	}
+	if err := s.postgres.CreateSweepRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// retrieves the sweep rules configured on an account
+func (s *SweepService) GetRules(ctx context.Context, accountID string) ([]*models.SweepRule, error) {
+	return s.postgres.GetSweepRulesByAccountID(ctx, accountID)
+}
+
+// deletes a sweep rule
+func (s *SweepService) DeleteRule(ctx context.Context, id string) error {
+	return s.postgres.DeleteSweepRule(ctx, id)
+}
+
+// evaluates every enabled rule and queues the transfers needed to bring balances back in range
+// intended to be run by the scheduler
+func (s *SweepService) RunSweeps(ctx context.Context) error {
+	rules, err := s.postgres.GetEnabledSweepRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := s.sweep(tenant.WithTenant(ctx, rule.TenantID), rule); err != nil {
+			log.Printf("Failed to run sweep rule %s: %v", rule.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SweepService) sweep(ctx context.Context, rule *models.SweepRule) error {
+	// a sweep still waiting in the queue hasn't moved the balance yet; sweeping again would double it
+	prefix := fmt.Sprintf("sweep-%s-", rule.ID)
+	pending, err := s.mongodb.HasPendingWithReferencePrefix(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return nil
+	}
+
+	account, err := s.postgres.GetAccount(ctx, rule.AccountID)
+	if err != nil {
+		return err
+	}
+
+	req := &models.TransactionRequest{
+		Type:      models.Transfer,
+		Reference: fmt.Sprintf("%s%d", prefix, s.transactionService.clock.Now(ctx).UnixNano()),
+		// repeated sweeps of the same amount are expected
+		AllowDuplicate: true,
+		// sweeps are the tenant's own standing instruction, so they aren't charged or held to its limits
+		System: true,
+	}
+	switch {
+	case account.Balance > rule.TargetBalance:
+		req.AccountID = rule.AccountID
+		req.CounterpartyAccountID = rule.TargetAccountID
+		req.Amount = s.transactionService.rounding.Round(account.Balance-rule.TargetBalance, account.Currency)
+	case rule.FloorBalance != nil && account.Balance < *rule.FloorBalance:
+		req.AccountID = rule.TargetAccountID
+		req.CounterpartyAccountID = rule.AccountID
+		req.Amount = s.transactionService.rounding.Round(*rule.FloorBalance-account.Balance, account.Currency)
+	default:
+		return nil
+	}
+	if req.Amount <= 0 {
+		return nil
+	}
+
+	if _, err := s.transactionService.CreateTransaction(ctx, req); err != nil {
+		return fmt.Errorf("failed to queue sweep transfer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+const (
+	maxTemplateNameLength     = 255
+	maxTemplateCategoryLength = 64
+)
+
+// handles transaction templates: saved transactions clients execute again for repeat payments
+type TemplateService struct {
+	postgres           *db.Postgres
+	transactionService *TransactionService
+}
+
+// creates a new TemplateService
+func NewTemplateService(postgres *db.Postgres, transactionService *TransactionService) *TemplateService {
+	return &TemplateService{
+		postgres:           postgres,
+		transactionService: transactionService,
+	}
+}
+
+// saves a transaction template on an account, checked like the transaction it creates
+func (s *TemplateService) CreateTemplate(ctx context.Context, accountID string, req *models.TransactionTemplateRequest) (*models.TransactionTemplate, error) {
+	if req.Name == "" || len(req.Name) > maxTemplateNameLength {
+		return nil, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidTemplate, maxTemplateNameLength)
+	}
+	switch req.Type {
+	case models.Deposit, models.Withdrawal, models.Transfer:
+	default:
+		return nil, fmt.Errorf("%w: type must be deposit, withdrawal or transfer", ErrInvalidTemplate)
+	}
+	if len(req.Memo) > maxMetadataValueLength {
+		return nil, fmt.Errorf("%w: memo is longer than %d characters", ErrInvalidTemplate, maxMetadataValueLength)
+	}
+	if len(req.Category) > maxTemplateCategoryLength {
+		return nil, fmt.Errorf("%w: category is longer than %d characters", ErrInvalidTemplate, maxTemplateCategoryLength)
+	}
+
+	account, err := s.postgres.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	if account.Kind != models.CustomerAccount {
+		return nil, fmt.Errorf("%w: templates can only be saved on customer accounts", ErrNotAllowed)
+	}
+	if err := money.Validate(req.Amount, account.Currency, s.transactionService.bounds); err != nil {
+		return nil, err
+	}
+
+	if req.Type == models.Transfer {
+		if req.CounterpartyAccountID == "" || req.CounterpartyAccountID == accountID {
+			return nil, fmt.Errorf("%w: transfer requires a different counterparty_account_id", ErrInvalidTemplate)
+		}
+		counterparty, err := s.postgres.GetAccount(ctx, req.CounterpartyAccountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get counterparty account: %w", err)
+		}
+		if counterparty.Kind != models.CustomerAccount {
+			return nil, fmt.Errorf("%w: system accounts cannot be used directly", ErrNotAllowed)
+		}
+		if counterparty.Currency != account.Currency {
+			return nil, fmt.Errorf("%w: transfer accounts must share a currency", ErrInvalidTemplate)
+		}
+	} else if req.CounterpartyAccountID != "" {
+		return nil, fmt.Errorf("%w: only transfers have a counterparty_account_id", ErrInvalidTemplate)
+	}
+	if req.CounterpartyID != "" {
+		if _, err := s.postgres.GetCounterparty(ctx, req.CounterpartyID); err != nil {
+			return nil, err
+		}
+	}
+
+	template := &models.TransactionTemplate{
+		AccountID:             accountID,
+		Name:                  req.Name,
+		Type:                  req.Type,
+		Amount:                req.Amount,
+		Memo:                  req.Memo,
+		Category:              req.Category,
+		CounterpartyAccountID: req.CounterpartyAccountID,
+		CounterpartyID:        req.CounterpartyID,
+	}
+	if err := s.postgres.CreateTemplate(ctx, template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// retrieves a transaction template by ID
+func (s *TemplateService) GetTemplate(ctx context.Context, id string) (*models.TransactionTemplate, error) {
+	return s.postgres.GetTemplate(ctx, id)
+}
+
+// lists an account's transaction templates
+func (s *TemplateService) GetTemplates(ctx context.Context, accountID string) ([]*models.TransactionTemplate, error) {
+	return s.postgres.GetTemplatesByAccountID(ctx, accountID)
+}
+
+// deletes a transaction template; transactions it created are kept
+func (s *TemplateService) DeleteTemplate(ctx context.Context, id string) error {
+	return s.postgres.DeleteTemplate(ctx, id)
+}
+
+// builds the transaction request executing a template; the memo, category and template ID go in its metadata
+func (s *TemplateService) TransactionRequest(ctx context.Context, id string, req *models.ExecuteTemplateRequest) (*models.TransactionRequest, error) {
+	template, err := s.postgres.GetTemplate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := template.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	metadata := map[string]string{"template_id": template.ID}
+	if template.Memo != "" {
+		metadata["memo"] = template.Memo
+	}
+	if template.Category != "" {
+		metadata["category"] = template.Category
+	}
+
+	return &models.TransactionRequest{
+		AccountID:             template.AccountID,
+		Type:                  template.Type,
+		Amount:                amount,
+		Reference:             req.Reference,
+		CounterpartyAccountID: template.CounterpartyAccountID,
+		CounterpartyID:        template.CounterpartyID,
+		Metadata:              metadata,
+	}, nil
+}
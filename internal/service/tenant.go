@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/auth"
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/clock"
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/notify"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+var (
+	// tenant ids end up in URLs, logs and queue messages so keep them boring
+	tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// how long tenant settings are served from memory before being re-read;
+// bounds how stale another replica's view can be after an admin update
+const tenantSettingsTTL = 30 * time.Second
+
+// most entries a tenant's IP allowlist may hold
+const maxAllowlistEntries = 100
+
+type cachedSettings struct {
+	settings  *models.TenantSettings
+	expiresAt time.Time
+}
+
+// handles tenants, their API credentials and their settings
+type TenantService struct {
+	postgres *db.Postgres
+	clock    clock.Clock
+	webhooks notify.EgressPolicy
+
+	mu    sync.RWMutex
+	cache map[string]cachedSettings
+}
+
+// creates a new TenantService
+func NewTenantService(postgres *db.Postgres) *TenantService {
+	return &TenantService{
+		postgres: postgres,
+		clock:    clock.System,
+		cache:    make(map[string]cachedSettings),
+	}
+}
+
+// sets the clock cached settings expire by
+func (s *TenantService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the policy webhook endpoints are checked against when they are saved
+func (s *TenantService) SetWebhookPolicy(policy notify.EgressPolicy) {
+	s.webhooks = policy
+}
+
+// retrieves a tenant's settings, served from memory when fresh
+// tenants without stored settings get unrestricted defaults
+func (s *TenantService) GetSettings(ctx context.Context, tenantID string) (*models.TenantSettings, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[tenantID]
+	s.mu.RUnlock()
+	if ok && s.clock.Now(ctx).Before(cached.expiresAt) {
+		return cached.settings, nil
+	}
+
+	settings, err := s.postgres.GetTenantSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil && tenant.IsSandbox(tenantID) {
+		settings, err = s.sandboxSettings(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if settings == nil {
+		settings = &models.TenantSettings{
+			TenantID:          tenantID,
+			AllowedCurrencies: []string{},
+			Fees:              map[models.TransactionType]models.FeeRule{},
+			WebhookEndpoints:  []string{},
+			KYCRequired:       []models.TransactionType{},
+			IPAllowlist:       []string{},
+			InsufficientFunds: models.InsufficientFundsPolicy{Mode: models.FailOnInsufficientFunds},
+		}
+	}
+
+	s.store(ctx, settings)
+	return settings, nil
+}
+
+// re-reads a tenant's settings from the database, skipping and refreshing the cached copy; for checking an
+// update's precondition against the version actually stored
+func (s *TenantService) ReloadSettings(ctx context.Context, tenantID string) (*models.TenantSettings, error) {
+	s.mu.Lock()
+	delete(s.cache, tenantID)
+	s.mu.Unlock()
+	return s.GetSettings(ctx, tenantID)
+}
+
+// sandboxSettings copies the live tenant's policy into a sandbox until the sandbox is given settings of its own
+// live webhook endpoints are left out so sandbox events never reach production consumers
+func (s *TenantService) sandboxSettings(ctx context.Context, tenantID string) (*models.TenantSettings, error) {
+	live, err := s.postgres.GetTenantSettings(ctx, tenant.Live(tenantID))
+	if err != nil || live == nil {
+		return nil, err
+	}
+
+	settings := *live
+	settings.TenantID = tenantID
+	settings.WebhookEndpoints = []string{}
+	return &settings, nil
+}
+
+// replaces a tenant's settings; a sandbox id (see tenant.Sandbox) sets the sandbox's own settings
+// with IfVersion in ctx, fails with ErrModified once the stored settings changed since
+func (s *TenantService) UpdateSettings(ctx context.Context, tenantID string, req *models.TenantSettingsRequest) (*models.TenantSettings, error) {
+	if !tenantIDPattern.MatchString(tenant.Live(tenantID)) {
+		return nil, fmt.Errorf("invalid tenant id")
+	}
+	if req.MaxTransactionAmount < 0 || req.MaxDailyAmount < 0 {
+		return nil, fmt.Errorf("limits cannot be negative")
+	}
+
+	currencies := make([]string, 0, len(req.AllowedCurrencies))
+	for _, c := range req.AllowedCurrencies {
+		c = strings.ToUpper(c)
+		if _, ok := money.Lookup(c); !ok {
+			return nil, fmt.Errorf("invalid currency code: %s", c)
+		}
+		currencies = append(currencies, c)
+	}
+
+	fees := req.Fees
+	if fees == nil {
+		fees = map[models.TransactionType]models.FeeRule{}
+	}
+	for txType, rule := range fees {
+		if rule.Flat < 0 || rule.Percent < 0 || rule.Percent > 100 {
+			return nil, fmt.Errorf("invalid fee for %s", txType)
+		}
+	}
+
+	endpoints := req.WebhookEndpoints
+	if endpoints == nil {
+		endpoints = []string{}
+	}
+	for _, endpoint := range endpoints {
+		if err := s.webhooks.CheckURL(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid webhook endpoint %s: %w", endpoint, err)
+		}
+	}
+
+	kycRequired := make([]models.TransactionType, 0, len(req.KYCRequired))
+	for _, t := range req.KYCRequired {
+		switch t {
+		case models.Deposit, models.Withdrawal, models.Transfer:
+			kycRequired = append(kycRequired, t)
+		default:
+			return nil, fmt.Errorf("invalid transaction type in kyc_required: %s", t)
+		}
+	}
+
+	allowlist, err := parseAllowlist(req.IPAllowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	insufficientFunds, err := checkFundingPolicy(req.InsufficientFunds)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := calendar.ParseCutoff(req.ValueDateCutoff); err != nil {
+		return nil, err
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTimezone, req.Timezone)
+	}
+
+	settings := &models.TenantSettings{
+		TenantID:             tenantID,
+		AllowedCurrencies:    currencies,
+		MaxTransactionAmount: req.MaxTransactionAmount,
+		MaxDailyAmount:       req.MaxDailyAmount,
+		Fees:                 fees,
+		WebhookEndpoints:     endpoints,
+		KYCRequired:          kycRequired,
+		ValueDateCutoff:      req.ValueDateCutoff,
+		Timezone:             req.Timezone,
+		IPAllowlist:          allowlist,
+		InsufficientFunds:    insufficientFunds,
+	}
+	if err := s.postgres.UpsertTenantSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	s.store(ctx, settings)
+	return settings, nil
+}
+
+// parseAllowlist normalises an IP allowlist to CIDR ranges, a single address becoming a range of one
+func parseAllowlist(entries []string) ([]string, error) {
+	if len(entries) > maxAllowlistEntries {
+		return nil, fmt.Errorf("ip_allowlist may hold at most %d entries", maxAllowlistEntries)
+	}
+	allowlist := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			entry = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip_allowlist entry: %s", entry)
+		}
+		allowlist = append(allowlist, n.String())
+	}
+	return allowlist, nil
+}
+
+func (s *TenantService) store(ctx context.Context, settings *models.TenantSettings) {
+	s.mu.Lock()
+	s.cache[settings.TenantID] = cachedSettings{settings: settings, expiresAt: s.clock.Now(ctx).Add(tenantSettingsTTL)}
+	s.mu.Unlock()
+}
+
+// issues a new API key for a tenant; the raw key is returned once and never stored
+func (s *TenantService) CreateAPIKey(ctx context.Context, tenantID string, req *models.CreateAPIKeyRequest) (*models.APIKeyResponse, error) {
+	if !tenantIDPattern.MatchString(tenantID) {
+		return nil, fmt.Errorf("invalid tenant id")
+	}
+	if req.Sandbox && len(tenantID) > tenant.MaxSandboxable {
+		return nil, fmt.Errorf("tenant ids longer than %d characters can't have a sandbox", tenant.MaxSandboxable)
+	}
+	if req.ReferenceNamespace != "" && !auth.ValidReferenceNamespace(req.ReferenceNamespace) {
+		return nil, ErrInvalidReferenceNamespace
+	}
+	if req.MaxTransactionAmount < 0 || req.MaxDailyAmount < 0 {
+		return nil, fmt.Errorf("limits cannot be negative")
+	}
+
+	raw, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		KeyHash:              auth.HashAPIKey(raw),
+		TenantID:             tenantID,
+		Name:                 req.Name,
+		Sandbox:              req.Sandbox,
+		ReferenceNamespace:   req.ReferenceNamespace,
+		BackDating:           req.BackDating,
+		MaxTransactionAmount: req.MaxTransactionAmount,
+		MaxDailyAmount:       req.MaxDailyAmount,
+	}
+	if err := s.postgres.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &models.APIKeyResponse{
+		Key:                  raw,
+		TenantID:             key.TenantID,
+		Name:                 key.Name,
+		Sandbox:              key.Sandbox,
+		ReferenceNamespace:   key.ReferenceNamespace,
+		BackDating:           key.BackDating,
+		MaxTransactionAmount: key.MaxTransactionAmount,
+		MaxDailyAmount:       key.MaxDailyAmount,
+		CreatedAt:            key.CreatedAt,
+	}, nil
+}
+
+// deletes the daily volumes counted for API keys before yesterday; intended to run from the scheduler
+func (s *TenantService) PruneKeyVolume(ctx context.Context) error {
+	yesterday := s.clock.Now(ctx).UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	_, err := s.postgres.DeleteAPIKeyVolumeBefore(ctx, yesterday)
+	return err
+}
+
+// deletes the daily volumes counted against tenant limits before yesterday; intended to run from the scheduler
+func (s *TenantService) PruneAccountVolume(ctx context.Context) error {
+	yesterday := s.clock.Now(ctx).UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	_, err := s.postgres.DeleteAccountVolumeBefore(ctx, yesterday)
+	return err
+}
+
+// resolves the tenant an API key belongs to
+func (s *TenantService) Authenticate(ctx context.Context, rawKey string) (*models.APIKey, error) {
+	key, err := s.postgres.GetAPIKeyByHash(ctx, auth.HashAPIKey(rawKey))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// issues a new webhook signing secret for a tenant; existing secrets keep signing for the grace period
+// so consumers can switch over without missing deliveries. The secret is returned only once
+func (s *TenantService) RotateWebhookSecret(ctx context.Context, tenantID string, grace time.Duration) (*models.WebhookSecret, error) {
+	if !tenantIDPattern.MatchString(tenant.Live(tenantID)) {
+		return nil, fmt.Errorf("invalid tenant id")
+	}
+	if grace < 0 {
+		return nil, fmt.Errorf("grace period cannot be negative")
+	}
+
+	raw, err := auth.GenerateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &models.WebhookSecret{TenantID: tenantID, Secret: raw}
+	if err := s.postgres.RotateWebhookSecret(ctx, secret, grace); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// retrieves a tenant's active webhook secrets, without their values
+func (s *TenantService) GetWebhookSecrets(ctx context.Context, tenantID string) ([]*models.WebhookSecret, error) {
+	return s.postgres.GetWebhookSecrets(ctx, tenantID)
+}
+
+// stops a webhook secret from signing immediately, e.g. when it has leaked
+func (s *TenantService) RevokeWebhookSecret(ctx context.Context, tenantID, id string) error {
+	return s.postgres.RevokeWebhookSecret(ctx, tenantID, id)
+}
+
+// returns the secrets webhooks for the scoped tenant are signed with; satisfies notify.SecretSource
+func (s *TenantService) ActiveWebhookSecrets(ctx context.Context) ([]string, error) {
+	return s.postgres.GetActiveWebhookSecretValues(ctx)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+)
+
+// instance identifies this replica on timeline entries
+var instance = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}()
+
+type componentKey struct{}
+
+// returns a copy of ctx whose timeline entries are attributed to component on this replica
+func withComponent(ctx context.Context, component string) context.Context {
+	return context.WithValue(ctx, componentKey{}, component+"/"+instance)
+}
+
+// returns the component work in ctx is attributed to; API requests are the default
+func componentFrom(ctx context.Context) string {
+	if component, ok := ctx.Value(componentKey{}).(string); ok {
+		return component
+	}
+	return "api/" + instance
+}
+
+// builds a timeline entry for the transaction's current status
+func (s *TransactionService) timelineEvent(ctx context.Context, tx *models.Transaction, event, detail string) models.TimelineEvent {
+	return models.TimelineEvent{
+		Event:     event,
+		Status:    tx.Status,
+		At:        s.clock.Now(ctx),
+		Component: componentFrom(ctx),
+		Actor:     reqctx.FromContext(ctx).Actor,
+		Detail:    detail,
+	}
+}
+
+// records a lifecycle step; the timeline is for investigations and never fails processing
+func (s *TransactionService) record(ctx context.Context, tx *models.Transaction, event, detail string) {
+	if err := s.mongodb.AppendTimeline(ctx, tx.ID, s.timelineEvent(ctx, tx, event, detail)); err != nil {
+		log.Printf("%sFailed to record %s for transaction %s: %v", reqctx.LogPrefix(ctx), event, tx.ID, err)
+	}
+}
+
+// returns the recorded lifecycle of a transaction
+// transactions created before timelines were recorded get one assembled from their timestamps
+func (s *TransactionService) GetTimeline(ctx context.Context, id string) (*models.TransactionTimeline, error) {
+	tx, err := s.GetTransaction(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := tx.Timeline
+	if len(events) == 0 {
+		events = []models.TimelineEvent{{Event: models.TimelineAccepted, Status: models.Pending, At: tx.CreatedAt}}
+		switch {
+		case tx.CompletedAt != nil:
+			events = append(events, models.TimelineEvent{Event: models.TimelineCompleted, Status: tx.Status, At: *tx.CompletedAt})
+		case tx.Status != models.Pending:
+			events = append(events, models.TimelineEvent{Event: string(tx.Status), Status: tx.Status, At: tx.UpdatedAt, Detail: tx.FailureReason})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+
+	return &models.TransactionTimeline{TransactionID: tx.ID, Status: tx.Status, Events: events}, nil
+}
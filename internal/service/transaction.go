@@ -2,68 +2,739 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/abkawan/banking-ledger/internal/analytics"
+	"github.com/abkawan/banking-ledger/internal/calendar"
+	"github.com/abkawan/banking-ledger/internal/clock"
 	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/enrichment"
+	"github.com/abkawan/banking-ledger/internal/events"
+	"github.com/abkawan/banking-ledger/internal/hooks"
+	"github.com/abkawan/banking-ledger/internal/ids"
+	"github.com/abkawan/banking-ledger/internal/metrics"
 	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+	"github.com/abkawan/banking-ledger/internal/pubsub"
 	"github.com/abkawan/banking-ledger/internal/queue"
-	"github.com/google/uuid"
+	"github.com/abkawan/banking-ledger/internal/reqctx"
+	"github.com/abkawan/banking-ledger/internal/screening"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// number of stale transactions the expiry job handles per run
+const expiryBatchSize = 500
+
+// number of stranded held transactions a resume looks up at a time
+const heldBatchSize = 100
+
+// DefaultPostingHorizon is how far ahead a posting date may be unless configured otherwise
+const DefaultPostingHorizon = 30 * 24 * time.Hour
+
+var backDatedTransactions = metrics.NewCounter(
+	"ledger_back_dated_transactions_total",
+	"Transactions accepted with a posting date before the day they were accepted.",
+)
+
+// maxReferenceLength is the longest transaction reference a client may send
+const maxReferenceLength = 128
+
+// references travel through URLs, exports and statements, so they stick to a safe character set
+var referencePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]*$`)
+
+// transaction metadata is for correlating with the client's own records, such as order or invoice IDs
+const (
+	maxMetadataKeys        = 20
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 500
 )
 
 // handles transaction operations
 type TransactionService struct {
-	postgres *db.Postgres
-	mongodb  *db.MongoDB
-	rabbitmq *queue.RabbitMQ
+	postgres    *db.Postgres
+	mongodb     *db.MongoDB
+	rabbitmq    *queue.RabbitMQ
+	tenants     *TenantService
+	enricher    enrichment.Provider
+	screener    screening.Screener
+	notifier    *NotificationService
+	rules       *RuleService
+	analytics   analytics.Publisher
+	balances    pubsub.Publisher
+	maintenance *MaintenanceService
+	clock       clock.Clock
+	ids         ids.Generator
+	sla         time.Duration
+	bounds      money.Bounds
+	rounding    money.Policy
+	calendars   *CalendarService
+
+	// how far ahead a posting date may be; zero allows none in the future
+	postingHorizon time.Duration
+
+	// how long quotes lock their fee
+	quoteTTL time.Duration
+
+	// withdrawals and transfers of at least this amount are screened when a screener is set
+	screeningThreshold float64
+
+	// similar transactions inside this window are held for review; zero disables detection
+	duplicateWindow time.Duration
+
+	// balance updates are published on this prefix followed by the account id
+	balanceChannelPrefix string
+
+	// wrapped around ProcessTransaction by the processor, outermost first
+	middleware []ProcessMiddleware
+
+	// custom business rules run around the balance update, in order
+	hooks []hooks.Hook
+
+	// deliveries received but not yet acknowledged, and deliveries finished, reported in heartbeats
+	inFlight  int64
+	processed int64
+
+	// the processor's checkpoint on the transactions queue, saved with its heartbeats
+	progress *consumerProgress
 }
 
 // creates a new TransactionService
-func NewTransactionService(postgres *db.Postgres, mongodb *db.MongoDB, rabbitmq *queue.RabbitMQ) *TransactionService {
+func NewTransactionService(postgres *db.Postgres, mongodb *db.MongoDB, rabbitmq *queue.RabbitMQ, tenants *TenantService) *TransactionService {
 	return &TransactionService{
 		postgres: postgres,
 		mongodb:  mongodb,
 		rabbitmq: rabbitmq,
+		tenants:  tenants,
+		clock:    clock.System,
+		ids:      ids.UUID,
+
+		postingHorizon: DefaultPostingHorizon,
+		quoteTTL:       DefaultQuoteTTL,
 	}
 }
 
+// sets the scripted rules applied to transaction requests: limit rules refuse them and fee rules add to the fee
+func (s *TransactionService) SetRules(rules *RuleService) {
+	s.rules = rules
+}
+
+// sets the clock limits, windows and expiry are judged by
+func (s *TransactionService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// sets the business calendars value dates fall on; without them every weekday is a business day
+func (s *TransactionService) SetCalendars(calendars *CalendarService) {
+	s.calendars = calendars
+}
+
+// sets the generator default references come from
+func (s *TransactionService) SetIDGenerator(g ids.Generator) {
+	s.ids = g
+}
+
+// sets the provider used to annotate transactions as they complete
+func (s *TransactionService) SetEnricher(enricher enrichment.Provider) {
+	s.enricher = enricher
+}
+
+// sets the service notified about completed and failed transactions
+func (s *TransactionService) SetNotifier(notifier *NotificationService) {
+	s.notifier = notifier
+}
+
+// sets where completed transactions are published for analytics
+func (s *TransactionService) SetAnalytics(publisher analytics.Publisher) {
+	s.analytics = publisher
+}
+
+// sets where balance changes are published, one channel per account named channelPrefix + account id
+func (s *TransactionService) SetBalancePublisher(publisher pubsub.Publisher, channelPrefix string) {
+	s.balances = publisher
+	s.balanceChannelPrefix = channelPrefix
+}
+
+// sets the switch that pauses the processor during maintenance windows
+func (s *TransactionService) SetMaintenance(maintenance *MaintenanceService) {
+	s.maintenance = maintenance
+}
+
+// sets how long a transaction may wait to be processed before it expires; zero disables expiry
+func (s *TransactionService) SetProcessingSLA(sla time.Duration) {
+	s.sla = sla
+}
+
+// sets the smallest and largest amount a single transaction may move
+func (s *TransactionService) SetAmountBounds(bounds money.Bounds) {
+	s.bounds = bounds
+}
+
+// sets how fees and other derived amounts are rounded to a currency's minor unit
+func (s *TransactionService) SetRoundingPolicy(policy money.Policy) {
+	s.rounding = policy
+}
+
+// sets the window in which a transaction matching a recent one is flagged as a suspected duplicate
+func (s *TransactionService) SetDuplicateWindow(window time.Duration) {
+	s.duplicateWindow = window
+}
+
+// sets how far ahead a posting date may be
+func (s *TransactionService) SetPostingHorizon(horizon time.Duration) {
+	s.postingHorizon = horizon
+}
+
 // creates a new transaction
 func (s *TransactionService) CreateTransaction(ctx context.Context, req *models.TransactionRequest) (*models.Transaction, error) {
+	tx, _, replay, err := s.draftTransaction(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if replay {
+		return tx, nil
+	}
+
+	// nothing is stored for a transaction that couldn't be queued anyway
+	if !s.rabbitmq.Accepting() {
+		return nil, ErrIngestionUnavailable
+	}
+
+	release, err := s.reserveVolume(ctx, req.System, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// a quote is used once; a retry with the same reference may use it again
+	if tx.QuoteID != "" {
+		used, err := s.postgres.UseQuote(ctx, tx.QuoteID, tx.Reference, s.clock.Now(ctx))
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if !used {
+			release()
+			return nil, fmt.Errorf("%w: %s", ErrQuoteUsed, tx.QuoteID)
+		}
+	}
+
+	// the first steps are stored with the transaction itself
+	accepted := s.timelineEvent(ctx, tx, models.TimelineAccepted, "")
+	accepted.Status = models.Pending
+	tx.Timeline = []models.TimelineEvent{accepted}
+	if tx.Status == models.Flagged {
+		tx.Timeline = append(tx.Timeline, s.timelineEvent(ctx, tx, models.TimelineFlagged, "suspected duplicate of "+tx.DuplicateOf))
+	}
+
+	// saving transaction to MongoDB
+	if err := s.mongodb.CreateTransaction(ctx, tx); err != nil {
+		release()
+		return nil, fmt.Errorf("Failed to create transaction: %w", err)
+	}
+	if tx.BackDated {
+		backDatedTransactions.Inc()
+	}
+
+	// flagged transactions wait for review before they are queued
+	if tx.Status == models.Flagged {
+		return tx, nil
+	}
+
+	// sending transaction to RabbitMQ
+	if err := s.rabbitmq.PublishTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to queue transaction: %w", err)
+	}
+	s.record(ctx, tx, models.TimelineQueued, "")
+
+	return tx, nil
+}
+
+// checks a transaction request and builds the transaction it would create, with its account; replay is set
+// instead when the reference was already used for the same transaction, which is returned
+func (s *TransactionService) draftTransaction(ctx context.Context, req *models.TransactionRequest) (tx *models.Transaction, account *models.Account, replay bool, err error) {
 	// Use provided reference or generate a new one
 	reference := req.Reference
+	if err := validateReference(reference); err != nil {
+		return nil, nil, false, err
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return nil, nil, false, err
+	}
 	if reference == "" {
-		reference = uuid.New().String()
+		reference = s.ids.NewID()
+	}
+
+	// references are looked up in the caller's namespace so integrations sharing a tenant can't collide;
+	// system transactions keep the shared namespace so they can be found again from any context
+	namespace := ""
+	if !req.System {
+		namespace = reqctx.FromContext(ctx).ReferenceNamespace
 	}
 
 	// Check for existing transaction with same reference (idempotency)
-	existingTx, err := s.mongodb.GetTransactionByReference(ctx, reference)
+	existingTx, err := s.mongodb.GetTransactionByReference(ctx, namespace, req.AccountID, reference)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to check for existing transaction: %w", err)
+		return nil, nil, false, fmt.Errorf("Failed to check for existing transaction: %w", err)
 	}
 
-	// If transaction already exists, return it
+	// If transaction already exists, return it; a retry has to ask for the same thing
 	if existingTx != nil {
-		return existingTx, nil
+		stored := requestDigest(existingTx.Type, existingTx.Amount, existingTx.CounterpartyAccountID)
+		requested := requestDigest(req.Type, req.Amount, req.CounterpartyAccountID)
+		if stored != requested {
+			return nil, nil, false, &ReferenceConflictError{Reference: reference, StoredDigest: stored, RequestDigest: requested}
+		}
+		return existingTx, nil, true, nil
+	}
+
+	// Amounts must fit the account currency's minor unit and the configured bounds
+	account, err = s.postgres.GetAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to get account: %w", err)
+	}
+	if err := money.Validate(req.Amount, account.Currency, s.bounds); err != nil {
+		return nil, nil, false, err
+	}
+
+	// counterparties are the tenant's own directory entries
+	if req.CounterpartyID != "" {
+		if _, err := s.postgres.GetCounterparty(ctx, req.CounterpartyID); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	// Apply the tenant's limits and fee schedule
+	var fee float64
+	if !req.System {
+		fee, err = s.applyTenantPolicy(ctx, req, account)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		// limits still apply, but a quote locks the fee
+		if req.QuoteID != "" {
+			if fee, err = s.quotedFee(ctx, req, reference); err != nil {
+				return nil, nil, false, err
+			}
+		}
+	}
+
+	valueDate, backDated, err := s.postingDate(ctx, req, account.Currency)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	fundingDeadline, err := s.fundingDeadline(ctx, req)
+	if err != nil {
+		return nil, nil, false, err
 	}
 
 	// Create new transaction
-	tx := &models.Transaction{
-		AccountID: req.AccountID,
-		Type:      req.Type,
-		Amount:    req.Amount,
-		Status:    models.Pending,
-		Reference: reference,
+	tx = &models.Transaction{
+		AccountID:             req.AccountID,
+		Type:                  req.Type,
+		Amount:                req.Amount,
+		Fee:                   fee,
+		Status:                models.Pending,
+		Reference:             reference,
+		ReferenceNamespace:    namespace,
+		CounterpartyAccountID: req.CounterpartyAccountID,
+		CounterpartyID:        req.CounterpartyID,
+		Metadata:              req.Metadata,
+		CreditExpiresAt:       req.CreditExpiresAt,
+		ValueDate:             &valueDate,
+		BackDated:             backDated,
+		QuoteID:               req.QuoteID,
+		RequestID:             reqctx.FromContext(ctx).RequestID,
+		RetryOnFunding:        req.RetryOnFunding,
+		FundingDeadline:       fundingDeadline,
 	}
 
-	// saving transaction to MongoDB
-	if err := s.mongodb.CreateTransaction(ctx, tx); err != nil {
-		return nil, fmt.Errorf("Failed to create transaction: %w", err)
+	// A different reference doesn't rule out an accidental double submission
+	if s.duplicateWindow > 0 && !req.AllowDuplicate && !req.System {
+		similar, err := s.mongodb.FindSimilarTransaction(ctx, req, reference, s.clock.Now(ctx).Add(-s.duplicateWindow))
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to check for duplicate transactions: %w", err)
+		}
+		if similar != nil {
+			tx.Status = models.Flagged
+			tx.DuplicateOf = similar.ID
+		}
 	}
 
-	// sending transaction to RabbitMQ
+	return tx, account, false, nil
+}
+
+// requestDigest fingerprints the parts of a transaction a retry must repeat: type, amount and counterparty
+func requestDigest(kind models.TransactionType, amount float64, counterpartyAccountID string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", kind, strconv.FormatFloat(amount, 'f', -1, 64), counterpartyAccountID)))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// checks a client-supplied reference; an empty one is generated instead
+func validateReference(reference string) error {
+	if reference == "" {
+		return nil
+	}
+	if len(reference) > maxReferenceLength {
+		return fmt.Errorf("%w: reference is longer than %d characters", ErrInvalidReference, maxReferenceLength)
+	}
+	if !referencePattern.MatchString(reference) {
+		return fmt.Errorf("%w: reference may only contain letters, digits, '.', '_', ':' and '-' and must start with a letter or digit", ErrInvalidReference)
+	}
+	return nil
+}
+
+// checks client metadata against the size limits; values are stored and returned as sent
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("%w: at most %d keys", ErrInvalidMetadata, maxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > maxMetadataKeyLength {
+			return fmt.Errorf("%w: keys must be 1 to %d characters", ErrInvalidMetadata, maxMetadataKeyLength)
+		}
+		if len(value) > maxMetadataValueLength {
+			return fmt.Errorf("%w: value of %s is longer than %d characters", ErrInvalidMetadata, key, maxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+// returns the business calendar of a currency
+func (s *TransactionService) calendarFor(ctx context.Context, currency string) (*calendar.Calendar, error) {
+	if s.calendars == nil {
+		return calendar.New(), nil
+	}
+	c, err := s.calendars.For(ctx, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s calendar: %w", currency, err)
+	}
+	return c, nil
+}
+
+// returns the value date of a transaction in currency booked now, under the currency's calendar and the tenant's
+// cut-off and timezone
+func (s *TransactionService) valueDate(ctx context.Context, currency string) (time.Time, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+
+	// checked when the settings were saved
+	cutoff, _ := calendar.ParseCutoff(settings.ValueDateCutoff)
+	c, err := s.calendarFor(ctx, currency)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.ValueDate(s.clock.Now(ctx), timezone(settings), cutoff), nil
+}
+
+// returns the value date of a transaction request and whether it is back-dated: its posting date when it has one,
+// otherwise the value date of a transaction booked now
+func (s *TransactionService) postingDate(ctx context.Context, req *models.TransactionRequest, currency string) (time.Time, bool, error) {
+	if req.PostingDate == "" {
+		valueDate, err := s.valueDate(ctx, currency)
+		return valueDate, false, err
+	}
+
+	date, err := time.Parse(calendar.DateLayout, req.PostingDate)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: posting_date must be YYYY-MM-DD", ErrInvalidPostingDate)
+	}
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	local := s.clock.Now(ctx).In(timezone(settings))
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	backDated := date.Before(today)
+	if backDated && !req.System && !reqctx.FromContext(ctx).BackDating {
+		return time.Time{}, false, fmt.Errorf("%w: back-dated transactions need credentials allowed to back-date", ErrNotAllowed)
+	}
+	if date.After(today.Add(s.postingHorizon)) {
+		return time.Time{}, false, fmt.Errorf("%w: posting_date is more than %d days ahead", ErrInvalidPostingDate, int(s.postingHorizon.Hours()/24))
+	}
+
+	period := date.Format(models.PeriodLayout)
+	closed, err := s.postgres.IsPeriodClosed(ctx, period)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if closed {
+		return time.Time{}, false, fmt.Errorf("%w: %s", ErrPeriodClosed, period)
+	}
+
+	return date, backDated, nil
+}
+
+// reserveVolume counts the outgoing transactions against the daily limits of the API key posting them and, unless
+// they are system transactions, of the tenant; the returned release gives both back
+func (s *TransactionService) reserveVolume(ctx context.Context, system bool, txs ...*models.Transaction) (release func(), err error) {
+	releaseKey, err := s.reserveKeyVolume(ctx, txs...)
+	if err != nil {
+		return nil, err
+	}
+	if system {
+		return releaseKey, nil
+	}
+	releaseAccounts, err := s.reserveAccountVolume(ctx, txs...)
+	if err != nil {
+		releaseKey()
+		return nil, err
+	}
+	return func() {
+		releaseAccounts()
+		releaseKey()
+	}, nil
+}
+
+// checkVolume makes the daily limit checks of reserveVolume for a transaction without reserving anything
+func (s *TransactionService) checkVolume(ctx context.Context, system bool, tx *models.Transaction) error {
+	if tx.Type == models.Deposit {
+		return nil
+	}
+	day := s.clock.Now(ctx).UTC().Truncate(24 * time.Hour)
+
+	if limits := reqctx.FromContext(ctx).Limits; limits.Key != "" && limits.MaxDailyAmount > 0 {
+		used, err := s.postgres.GetAPIKeyVolume(ctx, limits.Key, day)
+		if err != nil {
+			return fmt.Errorf("failed to check the api key's daily limit: %w", err)
+		}
+		if used+tx.Amount > limits.MaxDailyAmount {
+			return fmt.Errorf("%w: the api key's daily limit of %.2f reached", ErrLimitExceeded, limits.MaxDailyAmount)
+		}
+	}
+	if system {
+		return nil
+	}
+
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	if settings.MaxDailyAmount <= 0 {
+		return nil
+	}
+	used, err := s.postgres.GetAccountVolume(ctx, tx.AccountID, day)
+	if err != nil {
+		return fmt.Errorf("failed to check daily limit: %w", err)
+	}
+	if used+tx.Amount > settings.MaxDailyAmount {
+		return fmt.Errorf("%w: daily outgoing limit of %.2f reached", ErrLimitExceeded, settings.MaxDailyAmount)
+	}
+	return nil
+}
+
+// reserveAccountVolume counts the outgoing transactions against the tenant's daily limit of each account sending
+// them, and refuses them all when one account would exceed it
+func (s *TransactionService) reserveAccountVolume(ctx context.Context, txs ...*models.Transaction) (release func(), err error) {
+	release = func() {}
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	if settings.MaxDailyAmount <= 0 {
+		return release, nil
+	}
+
+	var accounts []string
+	amounts := map[string]float64{}
+	for _, tx := range txs {
+		if tx.Type == models.Deposit {
+			continue
+		}
+		if _, ok := amounts[tx.AccountID]; !ok {
+			accounts = append(accounts, tx.AccountID)
+		}
+		amounts[tx.AccountID] += tx.Amount
+	}
+
+	day := s.clock.Now(ctx).UTC().Truncate(24 * time.Hour)
+	var reserved []string
+	release = func() {
+		for _, accountID := range reserved {
+			if err := s.postgres.ReleaseAccountVolume(ctx, accountID, day, amounts[accountID]); err != nil {
+				log.Printf("%sFailed to release account volume: %v", reqctx.LogPrefix(ctx), err)
+			}
+		}
+	}
+	for _, accountID := range accounts {
+		ok, err := s.postgres.ReserveAccountVolume(ctx, accountID, day, amounts[accountID], settings.MaxDailyAmount)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to check daily limit: %w", err)
+		}
+		if !ok {
+			release()
+			return nil, fmt.Errorf("%w: daily outgoing limit of %.2f reached", ErrLimitExceeded, settings.MaxDailyAmount)
+		}
+		reserved = append(reserved, accountID)
+	}
+	return release, nil
+}
+
+// reserveKeyVolume counts the outgoing transactions against the daily limit of the API key posting them, and
+// refuses them when it would be exceeded. The returned release gives the volume back, for transactions that end
+// up not being stored
+func (s *TransactionService) reserveKeyVolume(ctx context.Context, txs ...*models.Transaction) (release func(), err error) {
+	release = func() {}
+	limits := reqctx.FromContext(ctx).Limits
+	if limits.Key == "" || limits.MaxDailyAmount <= 0 {
+		return release, nil
+	}
+	var amount float64
+	for _, tx := range txs {
+		if tx.Type != models.Deposit {
+			amount += tx.Amount
+		}
+	}
+	if amount == 0 {
+		return release, nil
+	}
+
+	day := s.clock.Now(ctx).UTC().Truncate(24 * time.Hour)
+	reserved, err := s.postgres.ReserveAPIKeyVolume(ctx, limits.Key, day, amount, limits.MaxDailyAmount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the api key's daily limit: %w", err)
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: the api key's daily limit of %.2f reached", ErrLimitExceeded, limits.MaxDailyAmount)
+	}
+	return func() {
+		if err := s.postgres.ReleaseAPIKeyVolume(ctx, limits.Key, day, amount); err != nil {
+			log.Printf("%sFailed to release api key volume: %v", reqctx.LogPrefix(ctx), err)
+		}
+	}, nil
+}
+
+// CheckKeyLimit refuses an amount above the per-transaction maximum of the API key in ctx; escrows and
+// authorization holds move money as system transactions, which skip the tenant policy, so they check it themselves
+func CheckKeyLimit(ctx context.Context, amount float64) error {
+	if limits := reqctx.FromContext(ctx).Limits; limits.MaxTransactionAmount > 0 && amount > limits.MaxTransactionAmount {
+		return fmt.Errorf("%w: amount exceeds the api key's maximum of %.2f", ErrLimitExceeded, limits.MaxTransactionAmount)
+	}
+	return nil
+}
+
+// returns the tenant's timezone; it was checked when the settings were saved
+func timezone(settings *models.TenantSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// checks the request against the tenant's and the caller's transaction limits and returns the fee it incurs
+func (s *TransactionService) applyTenantPolicy(ctx context.Context, req *models.TransactionRequest, account *models.Account) (float64, error) {
+	currency := account.Currency
+	tenantID, _ := tenant.FromContext(ctx)
+	settings, err := s.tenants.GetSettings(ctx, tenantID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+
+	if settings.MaxTransactionAmount > 0 && req.Amount > settings.MaxTransactionAmount {
+		return 0, fmt.Errorf("%w: amount exceeds the maximum of %.2f", ErrLimitExceeded, settings.MaxTransactionAmount)
+	}
+
+	// the credential's own limits are tighter still; its daily volume is counted as its transactions are stored
+	if err := CheckKeyLimit(ctx, req.Amount); err != nil {
+		return 0, err
+	}
+
+	// the tenant's daily limit is counted as the transaction is stored, see reserveVolume
+
+	rule := settings.Fees[req.Type]
+	fee := rule.Flat + s.rounding.Percentage(req.Amount, rule.Percent, currency)
+
+	// the tenant's scripted rules see the request as the transaction it would become
+	if s.rules != nil {
+		candidate := &models.Transaction{
+			AccountID:             req.AccountID,
+			Type:                  req.Type,
+			Amount:                req.Amount,
+			Fee:                   fee,
+			CounterpartyAccountID: req.CounterpartyAccountID,
+			CounterpartyID:        req.CounterpartyID,
+			Metadata:              req.Metadata,
+		}
+		if err := s.rules.CheckLimits(ctx, candidate, account); err != nil {
+			return 0, err
+		}
+		extra, err := s.rules.Fee(ctx, candidate, account)
+		if err != nil {
+			return 0, err
+		}
+		if fee += extra; fee < 0 {
+			fee = 0
+		}
+	}
+	return s.rounding.Round(fee, currency), nil
+}
+
+// lists transactions held for duplicate review
+func (s *TransactionService) GetFlaggedTransactions(ctx context.Context, limit, offset int) ([]*models.Transaction, error) {
+	return s.mongodb.GetFlaggedTransactions(ctx, limit, offset)
+}
+
+// counts transactions held as suspected duplicates
+func (s *TransactionService) CountFlaggedTransactions(ctx context.Context) (models.Count, error) {
+	return s.mongodb.CountFlaggedTransactions(ctx)
+}
+
+// searches transactions across accounts, and across tenants unless search.TenantID is set
+func (s *TransactionService) SearchTransactions(ctx context.Context, search *models.TransactionSearch, limit, offset int) ([]*models.Transaction, error) {
+	return s.mongodb.SearchTransactions(ctx, search, limit, offset)
+}
+
+// counts transactions matching a search
+func (s *TransactionService) CountSearchTransactions(ctx context.Context, search *models.TransactionSearch) (models.Count, error) {
+	return s.mongodb.CountSearchTransactions(ctx, search)
+}
+
+// releases a flagged transaction for processing
+func (s *TransactionService) ApproveTransaction(ctx context.Context, id string) (*models.Transaction, error) {
+	tx, err := s.mongodb.ResolveFlaggedTransaction(ctx, id, models.Pending, "")
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, ErrNotFlagged
+	}
+	s.record(ctx, tx, models.TimelineApproved, "")
+
 	if err := s.rabbitmq.PublishTransaction(ctx, tx); err != nil {
 		return nil, fmt.Errorf("failed to queue transaction: %w", err)
 	}
+	s.record(ctx, tx, models.TimelineQueued, "")
+
+	return tx, nil
+}
+
+// rejects a flagged transaction as a duplicate without processing it
+func (s *TransactionService) RejectTransaction(ctx context.Context, id string) (*models.Transaction, error) {
+	tx, err := s.mongodb.ResolveFlaggedTransaction(ctx, id, models.Failed, models.ReasonDuplicate)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, ErrNotFlagged
+	}
+	s.record(ctx, tx, models.TimelineRejected, models.ReasonDuplicate)
 
 	return tx, nil
 }
@@ -78,9 +749,38 @@ func (s *TransactionService) GetTransaction(ctx context.Context, id string) (*mo
 	return tx, nil
 }
 
+// polls a transaction until the processor has finished with it or timeout elapses,
+// returning its latest state either way
+func (s *TransactionService) WaitForTransaction(ctx context.Context, id string, timeout time.Duration) (*models.Transaction, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	delay := 20 * time.Millisecond
+	for {
+		tx, err := s.GetTransaction(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if tx.Status != models.Pending {
+			return tx, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return tx, nil
+		case <-time.After(delay):
+		}
+		if delay < 250*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
 // retrieves transactions for an account
-func (s *TransactionService) GetTransactionsByAccountID(ctx context.Context, accountID string, limit, offset int) ([]*models.Transaction, error) {
-	txs, err := s.mongodb.GetTransactionsByAccountID(ctx, accountID, limit, offset)
+func (s *TransactionService) GetTransactionsByAccountID(ctx context.Context, accountID string, sort models.TransactionSort, limit, offset int) ([]*models.Transaction, error) {
+	txs, err := s.mongodb.GetTransactionsByAccountID(ctx, accountID, sort, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get transactions: %w", err)
 	}
@@ -88,39 +788,438 @@ func (s *TransactionService) GetTransactionsByAccountID(ctx context.Context, acc
 	return txs, nil
 }
 
+// counts the transactions involving an account
+func (s *TransactionService) CountTransactionsByAccountID(ctx context.Context, accountID string) (models.Count, error) {
+	return s.mongodb.CountTransactionsByAccountID(ctx, accountID)
+}
+
 // processes a transaction
 func (s *TransactionService) ProcessTransaction(ctx context.Context, tx *models.Transaction) error {
-	// Validate account exists
-	_, err := s.postgres.GetAccount(ctx, tx.AccountID)
+	// A cancelled ctx stops a transaction from starting; once started it runs to the end on its own context,
+	// so the claim, the balance update and the status update are never split by a shutdown
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := commitContext(ctx)
+	defer cancel()
+
+	// the legs of a multi-leg transaction are applied together
+	if tx.GroupID != "" {
+		return s.processGroup(ctx, tx)
+	}
+
+	// Paused accounts' transactions wait in a holding queue until the account is resumed
+	accountIDs := []string{tx.AccountID}
+	if tx.CounterpartyAccountID != "" {
+		accountIDs = append(accountIDs, tx.CounterpartyAccountID)
+	}
+	paused, err := s.postgres.FindPausedAccount(ctx, accountIDs...)
 	if err != nil {
-		return s.markTransactionFailed(ctx, tx.ID, fmt.Errorf("account not found: %w", err))
+		return err
+	}
+	if paused != "" {
+		return s.hold(ctx, tx, paused)
 	}
 
-	// check amount (positive for deposit, negative for withdrawal)
-	amount := tx.Amount
-	if tx.Type == models.Withdrawal {
-		amount = -amount
+	// Claim the transaction first so expiry and duplicate deliveries can't race the balance update
+	var queuedAfter time.Time
+	if s.sla > 0 {
+		queuedAfter = s.clock.Now(ctx).Add(-s.sla)
 	}
+	claimed, err := s.mongodb.ClaimTransaction(ctx, tx.ID, queuedAfter)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		if s.sla > 0 && tx.UpdatedAt.Before(queuedAfter) {
+			return s.expire(ctx, tx, queuedAfter)
+		}
+		return fmt.Errorf("%w: %s", ErrNotPending, tx.ID)
+	}
+	s.record(ctx, tx, models.TimelinePickedUp, "")
 
-	balanceBefore, balanceAfter, err := s.postgres.UpdateAccountBalance(ctx, tx.AccountID, amount)
+	// Validate account exists; an outage is no reason to fail the transaction, only to try it again later
+	account, err := s.postgres.GetAccount(ctx, tx.AccountID)
+	if db.IsTransient(err) {
+		return s.retryLater(ctx, err, tx)
+	}
 	if err != nil {
-		return s.markTransactionFailed(ctx, tx.ID, fmt.Errorf("failed to update balance: %w", err))
+		return s.suspendOrFail(ctx, tx, nil, fmt.Errorf("account not found: %w", err))
+	}
+
+	// Re-check the amount; messages can be queued by older or misbehaving producers
+	if err := money.Validate(tx.Amount, account.Currency, s.bounds); err != nil {
+		return s.markTransactionFailed(ctx, tx, err)
+	}
+	if err := money.CheckPrecision(tx.Fee, account.Currency); err != nil || tx.Fee < 0 {
+		return s.markTransactionFailed(ctx, tx, fmt.Errorf("%w: invalid fee", ErrInvalidAmount))
+	}
+
+	// Tenants can refuse some transaction types until the customer has passed KYC
+	if err := s.checkKYC(ctx, tx, account); db.IsTransient(err) {
+		return s.retryLater(ctx, err, tx)
+	} else if err != nil {
+		return s.suspendOrFail(ctx, tx, account, err)
+	}
+
+	// Deployment-specific rules can refuse the transaction before its balance moves
+	if err := s.preProcess(ctx, tx, account); db.IsTransient(err) {
+		return s.retryLater(ctx, err, tx)
+	} else if err != nil {
+		return s.suspendOrFail(ctx, tx, account, err)
 	}
 
-	if err := s.mongodb.UpdateTransactionStatus(ctx, tx.ID, models.Completed, balanceBefore, balanceAfter); err != nil {
+	// Large outgoing payments are screened against sanctions and AML lists first
+	if parked, err := s.screen(ctx, tx); parked || err != nil {
+		return err
+	}
+
+	var balanceBefore, balanceAfter float64
+	switch {
+	case tx.Type == models.Transfer:
+		balanceBefore, balanceAfter, err = s.postgres.TransferBalance(ctx, tx.AccountID, tx.CounterpartyAccountID, tx.ID, tx.Amount, tx.Fee)
+	case tx.Type == models.Deposit && tx.CreditExpiresAt != nil:
+		balanceBefore, balanceAfter, err = s.postgres.GrantCredit(ctx, tx.AccountID, tx.ID, tx.Amount, tx.Fee, *tx.CreditExpiresAt)
+	default:
+		// check amount (positive for deposit, negative for withdrawal), fees always reduce the balance
+		amount := tx.Amount
+		if tx.Type == models.Withdrawal {
+			amount = -tx.Amount
+		}
+		balanceBefore, balanceAfter, err = s.postgres.UpdateAccountBalance(ctx, tx.AccountID, tx.ID, amount, tx.Fee)
+	}
+	switch {
+	case errors.Is(err, ErrOutcomeUnknown):
+		log.Printf("%sALERT: balance update of transaction %s may or may not have been applied: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		return fmt.Errorf("failed to update balance: %w", err)
+	case db.IsTransient(err):
+		return s.retryLater(ctx, fmt.Errorf("failed to update balance: %w", err), tx)
+	case errors.Is(err, db.ErrInsufficientFunds):
+		// the account's policy decides whether it fails now or waits for funds
+		return s.insufficientFunds(ctx, tx, account, fmt.Errorf("failed to update balance: %w", err))
+	case err != nil:
+		// the transaction itself can't be applied, e.g. a missing counterparty
+		return s.markTransactionFailed(ctx, tx, fmt.Errorf("failed to update balance: %w", err))
+	}
+	if err := s.complete(ctx, tx, account, balanceBefore, balanceAfter); err != nil {
+		return err
+	}
+	s.creditApplied(ctx, tx)
+
+	return nil
+}
+
+// marks a transaction whose balance moved completed and publishes it
+func (s *TransactionService) complete(ctx context.Context, tx *models.Transaction, account *models.Account, balanceBefore, balanceAfter float64) error {
+	s.record(ctx, tx, models.TimelineBalanceApplied, fmt.Sprintf("balance %g -> %g", balanceBefore, balanceAfter))
+
+	completedAt := s.clock.Now(ctx)
+	latency := latencyOf(tx, completedAt)
+	if err := s.mongodb.CompleteTransaction(ctx, tx.ID, balanceBefore, balanceAfter, completedAt, latency); err != nil {
 		return fmt.Errorf("failed to update transaction status: %w", err)
 	}
+	s.observeCompletion(latency)
+
+	tx.Status = models.Completed
+	tx.BalanceBefore, tx.BalanceAfter = balanceBefore, balanceAfter
+	tx.CompletedAt = &completedAt
+	s.record(ctx, tx, models.TimelineCompleted, "")
+	s.enrichLater(ctx, tx)
+	s.publishCompleted(ctx, tx, account.Currency)
+	s.publishBalances(ctx, tx, account.Currency)
+
+	if s.notifier != nil {
+		s.notifier.TransactionCompleted(tx, balanceAfter)
+	}
+	s.postProcess(ctx, tx, account)
+	return nil
+}
+
+// refuses the transaction when the tenant requires a verified account for its type
+// system accounts aren't customers and are never verified, so they are exempt
+func (s *TransactionService) checkKYC(ctx context.Context, tx *models.Transaction, account *models.Account) error {
+	if account.Kind != models.CustomerAccount {
+		return nil
+	}
+	settings, err := s.tenants.GetSettings(ctx, account.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+	if settings.RequiresKYC(tx.Type) && account.KYCStatus != models.KYCVerified {
+		return fmt.Errorf("%w: %ss need a verified account, account %s is %s", ErrKYCRequired, tx.Type, account.ID, account.KYCStatus)
+	}
+	return nil
+}
+
+// parks a transaction of a paused account
+func (s *TransactionService) hold(ctx context.Context, tx *models.Transaction, pausedAccountID string) error {
+	held, err := s.mongodb.HoldTransaction(ctx, tx.ID)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return fmt.Errorf("%w: %s", ErrNotPending, tx.ID)
+	}
 
+	tx.Status = models.Held
+	s.record(ctx, tx, models.TimelineHeld, "account "+pausedAccountID+" is paused")
+	if err := s.rabbitmq.HoldTransaction(ctx, pausedAccountID, tx); err != nil {
+		// nothing will release it, so put it back where the expiry job can see it
+		if _, releaseErr := s.mongodb.ReleaseHeldTransaction(ctx, tx.ID); releaseErr != nil {
+			log.Printf("%sFailed to release transaction %s after parking failed: %v", reqctx.LogPrefix(ctx), tx.ID, releaseErr)
+		}
+		return fmt.Errorf("failed to park transaction: %w", err)
+	}
+
+	log.Printf("%sHeld transaction %s while account %s is paused", reqctx.LogPrefix(ctx), tx.ID, pausedAccountID)
 	return nil
 }
 
-func (s *TransactionService) markTransactionFailed(ctx context.Context, id string, err error) error {
-	if updateErr := s.mongodb.UpdateTransactionStatus(ctx, id, models.Failed, 0, 0); updateErr != nil {
-		log.Printf("Failed to mark transaction %s as failed: %v", id, updateErr)
+// stops the processor from applying an account's transactions; new ones are parked until resumed
+// returns the pause and the account's updated_at after it; with IfVersion in ctx, fails with ErrModified once
+// the account changed since
+func (s *TransactionService) PauseAccount(ctx context.Context, accountID string, req *models.PauseAccountRequest) (*models.AccountPause, time.Time, error) {
+	version, err := s.postgres.PauseAccount(ctx, &models.AccountPause{
+		AccountID: accountID,
+		Reason:    req.Reason,
+		PausedBy:  reqctx.FromContext(ctx).Actor,
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	pause, err := s.postgres.GetAccountPause(ctx, accountID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return pause, version, nil
+}
+
+// retrieves an account's pause, nil when it isn't paused
+func (s *TransactionService) GetAccountPause(ctx context.Context, accountID string) (*models.AccountPause, error) {
+	return s.postgres.GetAccountPause(ctx, accountID)
+}
+
+// lifts an account's pause and queues its parked transactions again, in the order they were parked
+// also returns the account's updated_at after the pause is lifted; with IfVersion in ctx, fails with ErrModified
+// once the account changed since
+func (s *TransactionService) ResumeAccount(ctx context.Context, accountID string) (*models.ResumeAccountResponse, time.Time, error) {
+	version, err := s.postgres.ResumeAccount(ctx, accountID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	released, err := s.rabbitmq.DrainHeld(ctx, accountID, func(d queue.Delivery) error {
+		_, err := s.releaseHeld(reqctx.WithMetadata(ctx, d.Metadata), accountID, d.Transaction.ID)
+		return err
+	})
+	if err != nil {
+		return nil, version, fmt.Errorf("released %d transactions before failing: %w", released, err)
+	}
+
+	// transactions whose held message was quarantined or lost are still held, and are queued from their record
+	for {
+		stranded, err := s.mongodb.GetHeldTransactions(ctx, accountID, heldBatchSize)
+		if err != nil {
+			return nil, version, fmt.Errorf("released %d transactions before failing: %w", released, err)
+		}
+		for _, tx := range stranded {
+			ok, err := s.releaseHeld(ctx, accountID, tx.ID)
+			if err != nil {
+				return nil, version, fmt.Errorf("released %d transactions before failing: %w", released, err)
+			}
+			if ok {
+				released++
+			}
+		}
+		if len(stranded) < heldBatchSize {
+			break
+		}
+	}
+
+	return &models.ResumeAccountResponse{AccountID: accountID, Released: released}, version, nil
+}
+
+// returns a held transaction to pending and queues it again; false when it was resolved some other way while
+// parked. A transaction that can't be queued is put back on hold, so resuming again retries it
+func (s *TransactionService) releaseHeld(ctx context.Context, accountID, id string) (bool, error) {
+	tx, err := s.mongodb.ReleaseHeldTransaction(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if tx == nil {
+		return false, nil
+	}
+	s.record(ctx, tx, models.TimelineReleased, "account "+accountID+" resumed")
+	if err := s.rabbitmq.PublishTransaction(ctx, tx); err != nil {
+		if _, holdErr := s.mongodb.HoldTransaction(ctx, tx.ID); holdErr != nil {
+			log.Printf("%sFailed to put transaction %s back on hold: %v", reqctx.LogPrefix(ctx), tx.ID, holdErr)
+		}
+		return false, err
+	}
+	s.record(ctx, tx, models.TimelineQueued, "")
+	return true, nil
+}
+
+// publishes the transaction.completed event; analytics is best effort and never fails processing
+// sandbox activity is kept out of the analytics stream
+func (s *TransactionService) publishCompleted(ctx context.Context, tx *models.Transaction, currency string) {
+	if s.analytics == nil || tenant.IsSandbox(tx.TenantID) {
+		return
+	}
+
+	event, err := events.New(events.TransactionCompleted, tx.ID, tenant.OrDefault(tx.TenantID), *tx.CompletedAt, events.NewTransactionV2(tx, currency))
+	if err == nil {
+		err = s.analytics.Publish(ctx, tx.AccountID, event)
+	}
+	if err != nil {
+		log.Printf("%sFailed to publish analytics event for transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+	}
+}
+
+// publishes account.balance_updated for every account the transaction moved; like analytics it is best effort,
+// so subscribers that can't afford a missed message should re-read the balance from the API now and then
+func (s *TransactionService) publishBalances(ctx context.Context, tx *models.Transaction, currency string) {
+	if s.balances == nil {
+		return
+	}
+
+	updates := []*events.BalanceV1{{
+		AccountID:     tx.AccountID,
+		TransactionID: tx.ID,
+		Currency:      currency,
+		Balance:       tx.BalanceAfter,
+		Change:        s.rounding.Round(tx.BalanceAfter-tx.BalanceBefore, currency),
+		UpdatedAt:     *tx.CompletedAt,
+	}}
+	if tx.Type == models.Transfer {
+		// the transfer only reports the sender's balance; the receiver's is read back right after
+		counterparty, err := s.postgres.GetAccount(ctx, tx.CounterpartyAccountID)
+		if err != nil {
+			log.Printf("%sFailed to read counterparty balance for transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		} else {
+			updates = append(updates, &events.BalanceV1{
+				AccountID:     counterparty.ID,
+				TransactionID: tx.ID,
+				Currency:      counterparty.Currency,
+				Balance:       counterparty.Balance,
+				Change:        tx.Amount,
+				UpdatedAt:     *tx.CompletedAt,
+			})
+		}
+	}
+
+	for _, update := range updates {
+		event, err := events.New(events.AccountBalanceUpdated, "", tenant.OrDefault(tx.TenantID), update.UpdatedAt, update)
+		var message []byte
+		if err == nil {
+			message, err = json.Marshal(event)
+		}
+		if err == nil {
+			err = s.balances.Publish(ctx, s.balanceChannelPrefix+update.AccountID, message)
+		}
+		if err != nil {
+			log.Printf("%sFailed to publish balance update for account %s: %v", reqctx.LogPrefix(ctx), update.AccountID, err)
+		}
+	}
+}
+
+// enriches a completed transaction in the background, so completion never waits on the provider; the result is
+// saved on the stored transaction once it arrives, after the completed event went out without it
+func (s *TransactionService) enrichLater(ctx context.Context, tx *models.Transaction) {
+	if s.enricher == nil || tenant.IsSandbox(tx.TenantID) {
+		return
+	}
+
+	completed := *tx
+	ctx = reqctx.WithMetadata(tenant.WithTenant(context.Background(), tenant.OrDefault(tx.TenantID)), reqctx.FromContext(ctx))
+	go s.enrich(ctx, &completed)
+}
+
+func (s *TransactionService) enrich(ctx context.Context, tx *models.Transaction) {
+	result, err := s.enricher.Enrich(ctx, tx)
+	if err != nil {
+		log.Printf("%sFailed to enrich transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+		return
+	}
+	if result == nil {
+		return
+	}
+
+	if err := s.mongodb.UpdateTransactionEnrichment(ctx, tx.ID, result); err != nil {
+		log.Printf("%sFailed to save enrichment for transaction %s: %v", reqctx.LogPrefix(ctx), tx.ID, err)
+	}
+}
+
+func (s *TransactionService) markTransactionFailed(ctx context.Context, tx *models.Transaction, err error) error {
+	tx.Status = models.Failed
+	tx.FailureReason = err.Error()
+	if updateErr := s.mongodb.FailTransaction(ctx, tx.ID, tx.FailureReason); updateErr != nil {
+		log.Printf("%sFailed to mark transaction %s as failed: %v", reqctx.LogPrefix(ctx), tx.ID, updateErr)
+	} else {
+		s.record(ctx, tx, models.TimelineFailed, tx.FailureReason)
+	}
+	if s.notifier != nil {
+		s.notifier.TransactionFailed(tx, err)
 	}
 	return err
 }
 
+// fails a transaction that outlived the processing SLA and notifies the account holder
+func (s *TransactionService) expire(ctx context.Context, tx *models.Transaction, cutoff time.Time) error {
+	expired, err := s.mongodb.ExpireTransaction(ctx, tx.ID, cutoff)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return nil
+	}
+
+	tx.Status = models.Failed
+	tx.FailureReason = models.ReasonExpired
+	s.record(ctx, tx, models.TimelineExpired, "pending since "+tx.UpdatedAt.Format(time.RFC3339))
+	expiredTransactions.Inc()
+	slaBreaches.Inc()
+	if s.notifier != nil {
+		s.notifier.TransactionFailed(tx, ErrExpired)
+	}
+	if tx.GroupID != "" {
+		s.failFollowingLegs(ctx, tx, ErrExpired)
+	}
+	return ErrExpired
+}
+
+// fails every pending transaction that has waited longer than the processing SLA
+// intended to be run by the scheduler
+func (s *TransactionService) ExpireStale(ctx context.Context) error {
+	if s.sla <= 0 {
+		return nil
+	}
+
+	cutoff := s.clock.Now(ctx).Add(-s.sla)
+	txs, err := s.mongodb.GetUnclaimedPendingBefore(ctx, cutoff, expiryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	ctx = withComponent(ctx, "scheduler")
+	for _, tx := range txs {
+		txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+		if err := s.expire(txCtx, tx, cutoff); err != nil && !errors.Is(err, ErrExpired) {
+			log.Printf("Failed to expire transaction %s: %v", tx.ID, err)
+		} else if err != nil {
+			log.Printf("Expired transaction %s pending since %s", tx.ID, tx.UpdatedAt.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// reports whether new transactions can be queued; reads don't depend on it
+func (s *TransactionService) IngestionAvailable() bool {
+	return s.rabbitmq.Accepting()
+}
+
 // starts a transaction processor
 func (s *TransactionService) StartProcessor(ctx context.Context) error {
 	txChan, err := s.rabbitmq.ConsumeTransactions(ctx)
@@ -129,25 +1228,71 @@ func (s *TransactionService) StartProcessor(ctx context.Context) error {
 	}
 
 	// proccessing transactions in a goroutine
+	ctx = withComponent(ctx, "processor")
+	process := s.pipeline()
+	s.reportBacklog(ctx)
+	s.progress = newConsumerProgress(instance, queue.TransactionQueue, 0, s.clock.Now(ctx))
+	go s.heartbeat(ctx)
 	go func() {
 		for {
+			// during maintenance messages stay unacknowledged in the queue until it ends
+			if s.maintenance != nil && !s.maintenance.Wait(ctx) {
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				return
-			case tx, ok := <-txChan:
+			case delivery, ok := <-txChan:
 				if !ok {
 					return
 				}
+				// shutting down: leave the message unacknowledged so the broker redelivers it
+				if ctx.Err() != nil {
+					return
+				}
+				atomic.AddInt64(&s.inFlight, 1)
+				s.progress.delivered(delivery.Redelivered())
+				tx := delivery.Transaction
+				queuedAt := tx.UpdatedAt
+
+				// Process the transaction on behalf of the tenant and request that created it
+				txCtx := tenant.WithTenant(ctx, tenant.OrDefault(tx.TenantID))
+				txCtx = reqctx.WithMetadata(txCtx, delivery.Metadata)
+				err := process(txCtx, &tx)
+
+				// the outcome is recorded even when shutdown started while the transaction was applied
+				doneCtx, cancel := commitContext(txCtx)
+				if err != nil {
+					s.recordAttemptFailure(doneCtx, &tx, err)
+				}
+				cancel()
 
-				// Process the transaction
-				if err := s.ProcessTransaction(ctx, &tx); err != nil {
-					log.Printf("Failed to process transaction %s: %v", tx.ID, err)
-				} else {
-					log.Printf("Successfully processed transaction %s", tx.ID)
+				// failures are recorded on the transaction, so the message is done with either way
+				if err := delivery.Ack(); err != nil {
+					log.Printf("%sFailed to acknowledge transaction %s: %v", reqctx.LogPrefix(txCtx), tx.ID, err)
 				}
+				processedAt := s.clock.Now(txCtx)
+				s.progress.processed(tx.ID, int64(delivery.Tag()), 0, queuedAt, processedAt)
+				queueLag.Set(processedAt.Sub(queuedAt).Seconds())
+				atomic.AddInt64(&s.inFlight, -1)
+				atomic.AddInt64(&s.processed, 1)
 			}
 		}
 	}()
 
 	return nil
 }
+
+// blocks until the processor has no transaction in hand; returns false when ctx ends first
+// called on shutdown after the processor's context is cancelled, so started transactions can finish
+func (s *TransactionService) WaitIdle(ctx context.Context) bool {
+	for atomic.LoadInt64(&s.inFlight) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/verify"
+)
+
+// recomputes an account's balance from its completed transactions and compares it with the stored balance
+func (s *TransactionService) VerifyAccount(ctx context.Context, accountID string) (*models.AccountVerification, error) {
+	account, err := s.postgres.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	txs, err := s.mongodb.GetCompletedTransactionsByAccountID(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+
+	return verify.Account(account, txs), nil
+}
+
+// runs the cross-store consistency check over a tenant's accounts without repairing anything
+func (s *TransactionService) Reconcile(ctx context.Context, tenantID string) (*verify.Report, error) {
+	return verify.NewChecker(s.postgres, s.mongodb).Run(ctx, tenantID, false)
+}
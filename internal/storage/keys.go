@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KeyWrapper protects the data keys blobs are encrypted with, so only the wrapped form is ever stored
+type KeyWrapper interface {
+	// Wrap encrypts a data key, returning it with the ID of the key it was wrapped under
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error)
+
+	// Unwrap decrypts a data key wrapped under keyID
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeys wraps data keys with AES-256-GCM under keys held in configuration. The first key wraps new data
+// keys; the others are kept to unwrap blobs sealed before a rotation
+type LocalKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// creates new LocalKeys from a list like "2025=<base64>,2024=<base64>" of IDs and 32-byte keys, newest first
+func NewLocalKeys(spec string) (*LocalKeys, error) {
+	l := &LocalKeys{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid encryption key %q: want id=base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes of base64", id)
+		}
+		if _, dup := l.keys[id]; dup {
+			return nil, fmt.Errorf("encryption key %s is listed twice", id)
+		}
+		if l.current == "" {
+			l.current = id
+		}
+		l.keys[id] = key
+	}
+	return l, nil
+}
+
+func (l *LocalKeys) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	wrapped, err := seal(l.keys[l.current], dataKey, []byte(l.current))
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, l.current, nil
+}
+
+func (l *LocalKeys) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := l.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
+
+// KMS wraps data keys with an AWS KMS key, which never leaves KMS; rotating it there needs no configuration
+type KMS struct {
+	client   *http.Client
+	now      func() time.Time
+	endpoint string
+	keyID    string
+	signer   signer
+}
+
+// creates a new KMS wrapper for keyID (an ID, ARN or alias) using the S3 credentials and region of config
+func NewKMS(keyID string, config Config) (*KMS, error) {
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("kms needs an access key id and secret access key")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &KMS{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+		endpoint: "https://kms." + region + ".amazonaws.com/",
+		keyID:    keyID,
+		signer: signer{
+			service:         "kms",
+			region:          region,
+			accessKeyID:     config.AccessKeyID,
+			secretAccessKey: config.SecretAccessKey,
+			sessionToken:    config.SessionToken,
+		},
+	}, nil
+}
+
+func (k *KMS) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	var out struct {
+		CiphertextBlob []byte
+		KeyId          string
+	}
+	if err := k.call(ctx, "Encrypt", map[string]interface{}{"KeyId": k.keyID, "Plaintext": dataKey}, &out); err != nil {
+		return nil, "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return out.CiphertextBlob, out.KeyId, nil
+}
+
+func (k *KMS) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	if err := k.call(ctx, "Decrypt", map[string]interface{}{"KeyId": keyID, "CiphertextBlob": wrapped}, &out); err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+// calls a KMS action; byte slices travel as base64, which encoding/json does by itself
+func (k *KMS) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	k.signer.sign(req, body, k.now().UTC(), "Content-Type", "X-Amz-Target")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kms responded %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// seal encrypts plaintext with AES-256-GCM, prefixing the random nonce
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open decrypts what seal encrypted, failing when it or the additional data was altered
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrIntegrity
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
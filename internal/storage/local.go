@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadPath is where the API serves the signed download URLs of a local store
+const DownloadPath = "/downloads/"
+
+// Local keeps blobs as files under a directory; its signed URLs are served by the API itself, so every replica
+// needs the same directory (e.g. a shared volume) and signing key
+type Local struct {
+	dir        string
+	signingKey []byte
+	publicURL  string
+}
+
+// creates a new Local store in dir, creating the directory when it doesn't exist
+func NewLocal(dir string, signingKey []byte, publicURL string) (*Local, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local storage needs a directory")
+	}
+	if len(signingKey) == 0 {
+		return nil, fmt.Errorf("local storage needs a signing key for its download urls")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Local{dir: dir, signingKey: signingKey, publicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+// writes a blob through a temporary file, so readers never see it half written; the content type is derived
+// from the key's extension when the blob is served
+func (l *Local) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	target := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(l.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// returns a DownloadPath URL carrying its expiry and an HMAC over key, filename and expiry
+func (l *Local) SignedURL(ctx context.Context, key, filename string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := checkTTL(ttl); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"filename":  {filename},
+		"signature": {l.sign(key, filename, expires)},
+	}
+	return l.publicURL + DownloadPath + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+// ServeHTTP serves the blobs of unexpired signed URLs; the signature is the only credential
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, DownloadPath)
+	query := r.URL.Query()
+	expires, filename := query.Get("expires"), query.Get("filename")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	valid := err == nil && checkKey(key) == nil &&
+		hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(key, filename, expires)))
+	if !valid || time.Now().Unix() > expiresAt {
+		http.Error(w, "invalid or expired download link", http.StatusForbidden)
+		return
+	}
+
+	data, err := l.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to read download", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (l *Local) sign(key, filename, expires string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte(key + "\x00" + filename + "\x00" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
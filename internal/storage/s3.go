@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 keeps blobs in an S3 bucket, or any service speaking the S3 API with Signature Version 4
+type S3 struct {
+	client *http.Client
+	now    func() time.Time
+
+	// base is the bucket's URL; with pathStyle the bucket is the first path segment instead of part of the host
+	base      *url.URL
+	pathStyle bool
+	bucket    string
+	prefix    string
+
+	signer signer
+}
+
+// creates a new S3 store for bucket, keeping blobs under prefix; without an endpoint it talks to AWS
+func NewS3(bucket, prefix string, config Config) (*S3, error) {
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 storage needs an access key id and secret access key")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	base := &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com"}
+	pathStyle := false
+	if config.Endpoint != "" {
+		endpoint, err := url.Parse(config.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint: %q", config.Endpoint)
+		}
+		base, pathStyle = endpoint, true
+	}
+
+	return newS3(bucket, prefix, base, pathStyle, region, config.AccessKeyID, config.SecretAccessKey, config.SessionToken)
+}
+
+// creates a new S3 store for a Google Cloud Storage bucket, which accepts S3 requests signed with an HMAC key
+func NewGCS(bucket, prefix string, config Config) (*S3, error) {
+	if config.GCSAccessID == "" || config.GCSSecret == "" {
+		return nil, fmt.Errorf("gcs storage needs an hmac access id and secret")
+	}
+	base := &url.URL{Scheme: "https", Host: "storage.googleapis.com"}
+	return newS3(bucket, prefix, base, true, "auto", config.GCSAccessID, config.GCSSecret, "")
+}
+
+func newS3(bucket, prefix string, base *url.URL, pathStyle bool, region, accessKeyID, secret, token string) (*S3, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("storage url needs a bucket")
+	}
+	return &S3{
+		client:    &http.Client{Timeout: 60 * time.Second},
+		now:       time.Now,
+		base:      base,
+		pathStyle: pathStyle,
+		bucket:    bucket,
+		prefix:    prefix,
+		signer: signer{
+			service:         "s3",
+			region:          region,
+			accessKeyID:     accessKeyID,
+			secretAccessKey: secret,
+			sessionToken:    token,
+		},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// returns a presigned GET URL that also makes the download save as filename
+func (s *S3) SignedURL(ctx context.Context, key, filename string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := checkTTL(ttl); err != nil {
+		return "", err
+	}
+
+	now := s.now().UTC()
+	u := s.objectURL(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {sigV4Algorithm},
+		"X-Amz-Credential":    {s.signer.accessKeyID + "/" + s.signer.scope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.signer.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.signer.sessionToken)
+	}
+	if filename != "" {
+		query.Set("response-content-disposition", contentDisposition(filename))
+	}
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signer.signature(now, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), nil
+}
+
+// builds a request to an object signed in the Authorization header
+func (s *S3) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build storage request: %w", err)
+	}
+
+	s.signer.sign(req, body, s.now().UTC())
+	return req, nil
+}
+
+// sends a request, turning error responses into errors; a missing object is ErrNotFound
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("storage responded %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	u := *s.base
+	p := strings.TrimSuffix(u.Path, "/") + "/"
+	if s.pathStyle {
+		p += escapeKey(s.bucket) + "/"
+	}
+	u.RawPath = p + escapeKey(key)
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	return &u
+}
+
+// escapeKey percent-encodes each segment of a key, keeping its slashes
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
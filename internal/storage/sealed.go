@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ManifestSuffix is appended to a blob's key to get the key of its manifest
+const ManifestSuffix = ".manifest.json"
+
+// EncryptionAlgorithm is how sealed blobs are encrypted, each with a data key of its own
+const EncryptionAlgorithm = "AES-256-GCM"
+
+// ErrIntegrity is returned for blobs that don't match their manifest, or fail to decrypt
+var ErrIntegrity = errors.New("blob failed its integrity check")
+
+// ErrNotSignable is returned for signed URLs to encrypted blobs, which would download ciphertext
+var ErrNotSignable = errors.New("encrypted blobs have no signed urls")
+
+// Manifest describes a sealed blob; it is stored as JSON beside it, so the blob can be checked with nothing but
+// sha256sum, and SHA256 and Size are those of the content before encryption
+type Manifest struct {
+	Key          string      `json:"key"`
+	ContentType  string      `json:"content_type,omitempty"`
+	Size         int64       `json:"size"`
+	SHA256       string      `json:"sha256"`
+	CreatedAt    time.Time   `json:"created_at"`
+	Encryption   *Encryption `json:"encryption,omitempty"`
+	StoredSize   int64       `json:"stored_size,omitempty"`
+	StoredSHA256 string      `json:"stored_sha256,omitempty"`
+}
+
+// Encryption is how an encrypted blob can be decrypted: its data key, wrapped under KeyID. The blob is the GCM
+// nonce followed by the ciphertext, with the manifest's Key as additional data
+type Encryption struct {
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// Sealed keeps a manifest beside every blob of another store and checks blobs against it when they are read
+// back; with keys it also encrypts them before they leave the process
+type Sealed struct {
+	store         Store
+	keys          KeyWrapper
+	allowUnsealed bool
+	now           func() time.Time
+}
+
+// creates a new Sealed store over store; keys may be nil to only record checksums
+func NewSealed(store Store, keys KeyWrapper) *Sealed {
+	return &Sealed{store: store, keys: keys, now: time.Now}
+}
+
+// sets whether blobs without a manifest are read, unchecked, instead of failing their integrity check
+func (s *Sealed) SetAllowUnsealed(allow bool) {
+	s.allowUnsealed = allow
+}
+
+// Encrypted reports whether blobs are encrypted before they are stored
+func (s *Sealed) Encrypted() bool {
+	return s.keys != nil
+}
+
+// stores the blob first and its manifest second, so a manifest always describes a complete blob
+func (s *Sealed) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, ManifestSuffix) {
+		return fmt.Errorf("invalid blob key: %q is reserved for manifests", key)
+	}
+
+	manifest := &Manifest{
+		Key:         key,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      checksum(data),
+		CreatedAt:   s.now().UTC(),
+	}
+	stored := data
+	if s.keys != nil {
+		dataKey := make([]byte, 32)
+		if _, err := rand.Read(dataKey); err != nil {
+			return fmt.Errorf("failed to generate data key: %w", err)
+		}
+		wrapped, keyID, err := s.keys.Wrap(ctx, dataKey)
+		if err != nil {
+			return err
+		}
+		if stored, err = seal(dataKey, data, []byte(key)); err != nil {
+			return fmt.Errorf("failed to encrypt blob: %w", err)
+		}
+		manifest.Encryption = &Encryption{Algorithm: EncryptionAlgorithm, KeyID: keyID, WrappedKey: wrapped}
+		manifest.StoredSize = int64(len(stored))
+		manifest.StoredSHA256 = checksum(stored)
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := s.store.Put(ctx, key, contentType, stored); err != nil {
+		return err
+	}
+	return s.store.Put(ctx, key+ManifestSuffix, "application/json", encoded)
+}
+
+func (s *Sealed) Get(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := s.Verify(ctx, key)
+	return data, err
+}
+
+// Verify reads a blob back, decrypting it when it is encrypted, and checks it against its manifest, which must be
+// the one written for key. A blob without a manifest fails the check, unless unsealed blobs are allowed; it is then
+// returned with a nil manifest, unchecked
+func (s *Sealed) Verify(ctx context.Context, key string) ([]byte, *Manifest, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	data, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := s.store.Get(ctx, key+ManifestSuffix)
+	if errors.Is(err, ErrNotFound) {
+		if s.allowUnsealed {
+			return data, nil, nil
+		}
+		return nil, nil, fmt.Errorf("%w: %s has no manifest", ErrIntegrity, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(encoded, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode manifest of %s: %w", key, err)
+	}
+	// a manifest copied from another blob would otherwise vouch for that blob's content under this key
+	if manifest.Key != key {
+		return nil, &manifest, fmt.Errorf("%w: the manifest of %s was written for %s", ErrIntegrity, key, manifest.Key)
+	}
+
+	if manifest.Encryption != nil {
+		if checksum(data) != manifest.StoredSHA256 {
+			return nil, &manifest, fmt.Errorf("%w: %s does not match its stored checksum", ErrIntegrity, key)
+		}
+		if s.keys == nil {
+			return nil, &manifest, fmt.Errorf("%s is encrypted, and no encryption keys are configured", key)
+		}
+		if manifest.Encryption.Algorithm != EncryptionAlgorithm {
+			return nil, &manifest, fmt.Errorf("%s is encrypted with unsupported %s", key, manifest.Encryption.Algorithm)
+		}
+		dataKey, err := s.keys.Unwrap(ctx, manifest.Encryption.KeyID, manifest.Encryption.WrappedKey)
+		if err != nil {
+			return nil, &manifest, err
+		}
+		if data, err = open(dataKey, data, []byte(key)); err != nil {
+			return nil, &manifest, fmt.Errorf("%w: %s failed to decrypt", ErrIntegrity, key)
+		}
+	}
+	if int64(len(data)) != manifest.Size || checksum(data) != manifest.SHA256 {
+		return nil, &manifest, fmt.Errorf("%w: %s does not match its checksum", ErrIntegrity, key)
+	}
+	return data, &manifest, nil
+}
+
+func (s *Sealed) Delete(ctx context.Context, key string) error {
+	if err := s.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, key+ManifestSuffix)
+}
+
+// signs a URL to the stored blob, which only works while blobs aren't encrypted
+func (s *Sealed) SignedURL(ctx context.Context, key, filename string, ttl time.Duration) (string, error) {
+	if s.keys != nil {
+		return "", ErrNotSignable
+	}
+	return s.store.SignedURL(ctx, key, filename, ttl)
+}
+
+// Downloads returns the handler serving the signed URLs of a local store, nil for stores whose URLs point elsewhere
+func Downloads(store Store) http.Handler {
+	if sealed, ok := store.(*Sealed); ok {
+		store = sealed.store
+	}
+	if local, ok := store.(*Local); ok {
+		return local
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
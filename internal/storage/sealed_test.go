@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// a sealed store over a fresh local directory, encrypting when encrypt is set
+func testSealed(t *testing.T, encrypt bool) (*Sealed, *Local) {
+	t.Helper()
+
+	local, err := NewLocal(t.TempDir(), []byte("signing key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys KeyWrapper
+	if encrypt {
+		if keys, err = NewLocalKeys("test=" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewSealed(local, keys), local
+}
+
+func TestSealedRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		sealed, local := testSealed(t, encrypt)
+		ctx := context.Background()
+		content := []byte("date,amount\n2025-03-01,12.50\n")
+
+		if err := sealed.Put(ctx, "exports/acme/1/journal.csv", "text/csv", content); err != nil {
+			t.Fatal(err)
+		}
+		data, manifest, err := sealed.Verify(ctx, "exports/acme/1/journal.csv")
+		if err != nil {
+			t.Fatalf("encrypt=%v: %v", encrypt, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Fatalf("encrypt=%v: got %q, want %q", encrypt, data, content)
+		}
+		if manifest.Key != "exports/acme/1/journal.csv" || manifest.Size != int64(len(content)) || manifest.SHA256 != checksum(content) {
+			t.Fatalf("encrypt=%v: unexpected manifest %+v", encrypt, manifest)
+		}
+		if (manifest.Encryption != nil) != encrypt {
+			t.Fatalf("encrypt=%v: manifest encryption is %+v", encrypt, manifest.Encryption)
+		}
+
+		stored, err := local.Get(ctx, "exports/acme/1/journal.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encrypt && bytes.Contains(stored, content) {
+			t.Fatal("the stored blob holds the plaintext")
+		}
+	}
+}
+
+func TestSealedRejectsTampering(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("statement for march")
+
+	tests := []struct {
+		name    string
+		encrypt bool
+		tamper  func(t *testing.T, local *Local)
+	}{
+		{"changed blob", false, func(t *testing.T, local *Local) {
+			put(t, local, "a/blob", []byte("statement for april"))
+		}},
+		{"changed ciphertext", true, func(t *testing.T, local *Local) {
+			stored := get(t, local, "a/blob")
+			stored[len(stored)-1] ^= 1
+			put(t, local, "a/blob", stored)
+		}},
+		{"ciphertext and checksum changed together", true, func(t *testing.T, local *Local) {
+			stored := get(t, local, "a/blob")
+			stored[len(stored)-1] ^= 1
+			put(t, local, "a/blob", stored)
+			editManifest(t, local, "a/blob", func(m *Manifest) {
+				m.StoredSHA256 = checksum(stored)
+			})
+		}},
+		{"missing manifest", false, func(t *testing.T, local *Local) {
+			if err := local.Delete(context.Background(), "a/blob"+ManifestSuffix); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"missing manifest of an encrypted blob", true, func(t *testing.T, local *Local) {
+			if err := local.Delete(context.Background(), "a/blob"+ManifestSuffix); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"manifest of another blob", false, func(t *testing.T, local *Local) {
+			put(t, local, "a/blob", get(t, local, "b/blob"))
+			put(t, local, "a/blob"+ManifestSuffix, get(t, local, "b/blob"+ManifestSuffix))
+		}},
+		{"manifest of another encrypted blob", true, func(t *testing.T, local *Local) {
+			put(t, local, "a/blob", get(t, local, "b/blob"))
+			put(t, local, "a/blob"+ManifestSuffix, get(t, local, "b/blob"+ManifestSuffix))
+		}},
+		{"ciphertext moved from another key", true, func(t *testing.T, local *Local) {
+			put(t, local, "a/blob", get(t, local, "b/blob"))
+			manifest := get(t, local, "b/blob"+ManifestSuffix)
+			put(t, local, "a/blob"+ManifestSuffix, manifest)
+			editManifest(t, local, "a/blob", func(m *Manifest) {
+				m.Key = "a/blob"
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, local := testSealed(t, tt.encrypt)
+			if err := sealed.Put(ctx, "a/blob", "text/plain", content); err != nil {
+				t.Fatal(err)
+			}
+			if err := sealed.Put(ctx, "b/blob", "text/plain", []byte("someone else's statement")); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(t, local)
+
+			if _, _, err := sealed.Verify(ctx, "a/blob"); !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("got %v, want ErrIntegrity", err)
+			}
+		})
+	}
+}
+
+func TestSealedAllowUnsealed(t *testing.T) {
+	sealed, local := testSealed(t, false)
+	sealed.SetAllowUnsealed(true)
+	ctx := context.Background()
+	put(t, local, "legacy/blob", []byte("stored before manifests"))
+
+	data, manifest, err := sealed.Verify(ctx, "legacy/blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest != nil || string(data) != "stored before manifests" {
+		t.Fatalf("got %q with manifest %+v", data, manifest)
+	}
+}
+
+func put(t *testing.T, local *Local, key string, data []byte) {
+	t.Helper()
+	if err := local.Put(context.Background(), key, "application/octet-stream", data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, local *Local, key string) []byte {
+	t.Helper()
+	data, err := local.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func editManifest(t *testing.T, local *Local, key string, edit func(*Manifest)) {
+	t.Helper()
+	var m Manifest
+	if err := json.Unmarshal(get(t, local, key+ManifestSuffix), &m); err != nil {
+		t.Fatal(err)
+	}
+	edit(&m)
+	encoded, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(t, local, key+ManifestSuffix, encoded)
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for keys the store holds nothing under
+var ErrNotFound = errors.New("blob not found")
+
+// MaxSignedURLTTL is the longest a signed URL can stay valid, the S3 limit
+const MaxSignedURLTTL = 7 * 24 * time.Hour
+
+// Store keeps generated artifacts (exports, statements, archives) under slash-separated keys
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Delete removes a blob; deleting a key that holds nothing is not an error
+	Delete(ctx context.Context, key string) error
+
+	// SignedURL returns a URL that downloads key as filename without credentials until ttl has passed
+	SignedURL(ctx context.Context, key, filename string, ttl time.Duration) (string, error)
+}
+
+// Config holds the credentials and endpoints of the backends; only those of the opened backend are used
+type Config struct {
+	// SigningKey signs the download URLs of local stores, which the API verifies
+	SigningKey []byte
+
+	// PublicURL is prefixed to local download URLs, e.g. "https://ledger.example.com"; they are relative without it
+	PublicURL string
+
+	// S3 credentials; Endpoint points the client at an S3-compatible service such as MinIO instead of AWS
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Endpoint        string
+
+	// GCS HMAC key, used through the Cloud Storage XML API
+	GCSAccessID string
+	GCSSecret   string
+
+	// EncryptionKeys ("id=base64key,...", see NewLocalKeys) or KMSKeyID turn on encryption of stored blobs
+	EncryptionKeys string
+	KMSKeyID       string
+
+	// AllowUnsealed reads blobs that have no manifest, unchecked, for stores holding blobs from before manifests
+	AllowUnsealed bool
+}
+
+// Open returns the store a URL names, sealed (see Sealed) with the keys config has, if any:
+//   - file:///var/lib/ledger/artifacts keeps blobs on local disk
+//   - s3://bucket/prefix keeps them in an S3 (or S3-compatible) bucket
+//   - gs://bucket/prefix keeps them in a Google Cloud Storage bucket
+func Open(rawURL string, config Config) (*Sealed, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage url: %w", err)
+	}
+
+	var store Store
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "file":
+		store, err = NewLocal(u.Path, config.SigningKey, config.PublicURL)
+	case "s3":
+		store, err = NewS3(u.Host, prefix, config)
+	case "gs":
+		store, err = NewGCS(u.Host, prefix, config)
+	default:
+		return nil, fmt.Errorf("unsupported storage url scheme: %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys KeyWrapper
+	switch {
+	case config.EncryptionKeys != "" && config.KMSKeyID != "":
+		return nil, fmt.Errorf("configure either encryption keys or a kms key, not both")
+	case config.EncryptionKeys != "":
+		if keys, err = NewLocalKeys(config.EncryptionKeys); err != nil {
+			return nil, err
+		}
+	case config.KMSKeyID != "":
+		if keys, err = NewKMS(config.KMSKeyID, config); err != nil {
+			return nil, err
+		}
+	}
+	sealed := NewSealed(store, keys)
+	sealed.SetAllowUnsealed(config.AllowUnsealed)
+	return sealed, nil
+}
+
+// checkKey rejects keys that are empty or could step outside the store
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key: %q", key)
+		}
+	}
+	return nil
+}
+
+// checkTTL rejects signed URL lifetimes the backends can't honor
+func checkTTL(ttl time.Duration) error {
+	if ttl <= 0 || ttl > MaxSignedURLTTL {
+		return fmt.Errorf("signed url ttl must be between 1s and %s", MaxSignedURLTTL)
+	}
+	return nil
+}
+
+// contentDisposition names the file a download is saved as
+func contentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=%q", filename)
+}
@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+)
+
+// sandboxSuffix marks the test-mode twin of a tenant; live tenant ids can't contain '~', so the two never collide
+const sandboxSuffix = "~sandbox"
+
+// MaxSandboxable is the longest live tenant id that still fits the tenant_id columns once it has a sandbox
+const MaxSandboxable = 64 - len(sandboxSuffix)
+
+// Sandbox returns the id of a tenant's sandbox twin, whose accounts and transactions live apart from the real ones
+func Sandbox(id string) string {
+	if IsSandbox(id) {
+		return id
+	}
+	return id + sandboxSuffix
+}
+
+// IsSandbox reports whether id is a sandbox tenant
+func IsSandbox(id string) bool {
+	return strings.HasSuffix(id, sandboxSuffix)
+}
+
+// Live returns the live tenant behind a sandbox id; live ids are returned unchanged
+func Live(id string) string {
+	return strings.TrimSuffix(id, sandboxSuffix)
+}
+
+// InSandbox reports whether ctx is scoped to a sandbox tenant
+func InSandbox(ctx context.Context) bool {
+	id, _ := FromContext(ctx)
+	return IsSandbox(id)
+}
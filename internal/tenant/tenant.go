@@ -0,0 +1,29 @@
+package tenant
+
+import (
+	"context"
+)
+
+// Default is the tenant that owns data created before multi-tenancy was introduced
+const Default = "default"
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx scoped to the given tenant
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// OrDefault maps the empty tenant of pre-tenancy records to Default
+func OrDefault(id string) string {
+	if id == "" {
+		return Default
+	}
+	return id
+}
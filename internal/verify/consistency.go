@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/db"
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/tenant"
+)
+
+// finding kinds
+const (
+	FindingOrphan       = "orphaned_transactions"
+	FindingDivergence   = "balance_divergence"
+	FindingSummaryDrift = "summary_drift"
+)
+
+// repair actions; only the safe ones are ever applied automatically
+const (
+	RepairFailPending      = "fail_pending_transactions"
+	RepairRecomputeSummary = "recompute_summary"
+	RepairInvestigate      = "investigate"
+)
+
+// ReasonOrphaned is the failure reason given to pending transactions of accounts that don't exist
+const ReasonOrphaned = "account not found"
+
+// Repair is a suggested fix for a finding
+type Repair struct {
+	Action  string `json:"action"`
+	Detail  string `json:"detail"`
+	Safe    bool   `json:"safe"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Finding is one inconsistency between Postgres and MongoDB
+type Finding struct {
+	Kind      string `json:"kind"`
+	TenantID  string `json:"tenant_id"`
+	AccountID string `json:"account_id"`
+	Detail    string `json:"detail"`
+
+	Verification *models.AccountVerification `json:"verification,omitempty"`
+	Repairs      []Repair                    `json:"repairs"`
+}
+
+// Report is the outcome of a consistency check and its repair plan
+type Report struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	AccountsChecked  int       `json:"accounts_checked"`
+	AccountsFailed   int       `json:"accounts_failed"`
+	OrphanedAccounts int       `json:"orphaned_accounts"`
+	Findings         []Finding `json:"findings"`
+}
+
+// Checker cross-checks the balances in Postgres against the transaction history in MongoDB
+type Checker struct {
+	postgres *db.Postgres
+	mongodb  *db.MongoDB
+}
+
+// creates a new Checker
+func NewChecker(postgres *db.Postgres, mongodb *db.MongoDB) *Checker {
+	return &Checker{postgres: postgres, mongodb: mongodb}
+}
+
+// Run checks every account, or one tenant's when tenantID is set, and plans repairs; apply carries out the safe ones
+// results are only exact while no transactions are being processed
+func (c *Checker) Run(ctx context.Context, tenantID string, apply bool) (*Report, error) {
+	report := &Report{CheckedAt: time.Now(), Findings: []Finding{}}
+
+	type stored struct {
+		account *models.Account
+		summary *models.AccountSummary
+	}
+	var accounts []stored
+	known := make(map[string]bool)
+	_, err := c.postgres.ExportAccounts(ctx, tenantID, func(account *models.Account, summary *models.AccountSummary) error {
+		accounts = append(accounts, stored{account, summary})
+		known[account.TenantID+"/"+account.ID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// transactions pointing at accounts their tenant doesn't have
+	refs, err := c.mongodb.GetAccountReferences(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if known[ref.TenantID+"/"+ref.AccountID] {
+			continue
+		}
+		report.OrphanedAccounts++
+		finding := Finding{
+			Kind:      FindingOrphan,
+			TenantID:  ref.TenantID,
+			AccountID: ref.AccountID,
+			Detail:    fmt.Sprintf("%d transactions reference an account that does not exist in Postgres", ref.Transactions),
+		}
+		if ref.Pending > 0 {
+			repair := Repair{
+				Action: RepairFailPending,
+				Detail: fmt.Sprintf("fail %d pending transactions with reason %q", ref.Pending, ReasonOrphaned),
+				Safe:   true,
+			}
+			if apply {
+				txCtx := tenant.WithTenant(ctx, ref.TenantID)
+				if _, err := c.mongodb.FailOrphanedTransactions(txCtx, ref.AccountID, ReasonOrphaned); err != nil {
+					repair.Error = err.Error()
+				} else {
+					repair.Applied = true
+				}
+			}
+			finding.Repairs = append(finding.Repairs, repair)
+		}
+		if ref.Transactions > ref.Pending {
+			finding.Repairs = append(finding.Repairs, Repair{
+				Action: RepairInvestigate,
+				Detail: "restore the account from a backup or move its settled transactions to the right account",
+			})
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+
+	for _, a := range accounts {
+		// contra accounts are only posted to alongside other accounts and have no history of their own to check
+		if a.account.Kind.Contra() {
+			continue
+		}
+		accountCtx := tenant.WithTenant(ctx, a.account.TenantID)
+		txs, err := c.mongodb.GetCompletedTransactionsByAccountID(accountCtx, a.account.ID)
+		if err != nil {
+			return nil, err
+		}
+		result := Account(a.account, txs)
+		report.AccountsChecked++
+
+		if !result.Passed {
+			report.AccountsFailed++
+			report.Findings = append(report.Findings, Finding{
+				Kind:         FindingDivergence,
+				TenantID:     a.account.TenantID,
+				AccountID:    a.account.ID,
+				Detail:       result.FirstDivergence.Reason,
+				Verification: result,
+				Repairs: []Repair{{
+					Action: RepairInvestigate,
+					Detail: fmt.Sprintf("stored balance %g, transaction chain gives %g; correct it with an adjusting transaction once the cause is known",
+						result.StoredBalance, result.RecomputedBalance),
+				}},
+			})
+		}
+
+		if drifted(a.summary, &result.Activity, a.account.Currency) {
+			repair := Repair{
+				Action: RepairRecomputeSummary,
+				Detail: fmt.Sprintf("set the activity summary to %d transactions, %g in and %g out",
+					result.Activity.TransactionCount, result.Activity.TotalDeposits, result.Activity.TotalWithdrawals),
+				Safe: true,
+			}
+			if apply {
+				if err := c.postgres.SetAccountSummary(accountCtx, a.account.ID, &result.Activity); err != nil {
+					repair.Error = err.Error()
+				} else {
+					repair.Applied = true
+				}
+			}
+			report.Findings = append(report.Findings, Finding{
+				Kind:      FindingSummaryDrift,
+				TenantID:  a.account.TenantID,
+				AccountID: a.account.ID,
+				Detail:    "the activity summary does not match the completed transactions",
+				Repairs:   []Repair{repair},
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// drifted reports whether a stored activity summary disagrees with one recomputed from history
+func drifted(stored, recomputed *models.AccountSummary, currency string) bool {
+	if stored == nil {
+		return recomputed.TransactionCount > 0
+	}
+	return stored.TransactionCount != recomputed.TransactionCount ||
+		!sameAmount(stored.TotalDeposits, recomputed.TotalDeposits, currency) ||
+		!sameAmount(stored.TotalWithdrawals, recomputed.TotalWithdrawals, currency)
+}
@@ -0,0 +1,35 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+)
+
+func TestDriftedByMinorUnit(t *testing.T) {
+	recomputed := &models.AccountSummary{TransactionCount: 2, TotalDeposits: 100, TotalWithdrawals: 40}
+	tests := []struct {
+		name     string
+		deposits float64
+		currency string
+		want     bool
+	}{
+		{"same", 100, "USD", false},
+		{"under half a cent", 100.004, "USD", false},
+		{"a cent", 100.01, "USD", true},
+		{"a fraction of a yen", 100.4, "JPY", false},
+		{"a yen", 101, "JPY", true},
+		{"a fils", 100.001, "KWD", true},
+	}
+	for _, tt := range tests {
+		stored := *recomputed
+		stored.TotalDeposits = tt.deposits
+		if got := drifted(&stored, recomputed, tt.currency); got != tt.want {
+			t.Errorf("%s: drifted %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !drifted(nil, recomputed, "USD") {
+		t.Error("a missing summary of an account with transactions did not drift")
+	}
+}
@@ -0,0 +1,132 @@
+package verify
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/abkawan/banking-ledger/internal/models"
+	"github.com/abkawan/banking-ledger/internal/money"
+)
+
+// Account replays an account's completed transactions, from either side, in completion order
+// and checks that balance_before/after chain from one to the next and end at the stored balance
+func Account(account *models.Account, txs []*models.Transaction) *models.AccountVerification {
+	sorted := append([]*models.Transaction(nil), txs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := completedAt(sorted[i]), completedAt(sorted[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var policy money.Policy
+	round := func(v float64) float64 { return policy.Round(v, account.Currency) }
+	same := func(a, b float64) bool { return sameAmount(a, b, account.Currency) }
+
+	report := &models.AccountVerification{
+		AccountID:     account.ID,
+		Currency:      account.Currency,
+		StoredBalance: account.Balance,
+		CheckedAt:     time.Now(),
+	}
+
+	// expected follows the recorded chain so only the first divergence is reported, even if later links are fine
+	var expected, moved, beforeAnchor float64
+	for _, tx := range sorted {
+		if tx.Status != models.Completed {
+			continue
+		}
+		own := tx.AccountID == account.ID
+		var credited, debited float64
+		switch {
+		case own && (tx.Type == models.Deposit || tx.Type == models.Opening):
+			credited = tx.Amount - tx.Fee
+		case own && (tx.Type == models.Withdrawal || tx.Type == models.Transfer):
+			debited = tx.Amount + tx.Fee
+		case tx.Type == models.Transfer && tx.CounterpartyAccountID == account.ID:
+			credited = tx.Amount
+		default:
+			continue
+		}
+		delta := credited - debited
+
+		report.TransactionsChecked++
+		// the opening balance is part of the chain but not of the account's activity summary
+		if tx.Type != models.Opening {
+			report.Activity.TotalDeposits = round(report.Activity.TotalDeposits + credited)
+			report.Activity.TotalWithdrawals = round(report.Activity.TotalWithdrawals + debited)
+			report.Activity.TransactionCount++
+			if at := completedAt(tx); report.Activity.LastTransactionAt == nil || at.After(*report.Activity.LastTransactionAt) {
+				report.Activity.LastTransactionAt = &at
+			}
+		}
+		moved = round(moved + delta)
+
+		// incoming transfers don't record the receiving side's balance, so they only move the expectation
+		if !own {
+			if report.Anchored {
+				expected = round(expected + delta)
+			} else {
+				beforeAnchor = round(beforeAnchor + delta)
+			}
+			continue
+		}
+
+		if !report.Anchored {
+			report.Anchored = true
+			report.OpeningBalance = round(tx.BalanceBefore - beforeAnchor)
+			expected = tx.BalanceBefore
+		}
+		if report.FirstDivergence == nil {
+			switch {
+			case !same(tx.BalanceBefore, expected):
+				report.FirstDivergence = divergence(tx, expected, tx.BalanceBefore, "balance_before does not follow from the previous transaction")
+			case !same(tx.BalanceAfter, tx.BalanceBefore+delta):
+				report.FirstDivergence = divergence(tx, round(tx.BalanceBefore+delta), tx.BalanceAfter, "balance_after is not balance_before plus the transaction")
+			}
+		}
+		expected = tx.BalanceAfter
+	}
+
+	if !report.Anchored {
+		report.OpeningBalance = round(account.Balance - moved)
+	}
+	report.RecomputedBalance = round(report.OpeningBalance + moved)
+
+	if report.FirstDivergence == nil && !same(report.RecomputedBalance, account.Balance) {
+		report.FirstDivergence = &models.Divergence{
+			Expected: report.RecomputedBalance,
+			Recorded: account.Balance,
+			Reason:   "the stored balance does not match the transaction chain",
+		}
+	}
+	report.Passed = report.FirstDivergence == nil
+
+	return report
+}
+
+func divergence(tx *models.Transaction, expected, recorded float64, reason string) *models.Divergence {
+	return &models.Divergence{
+		TransactionID: tx.ID,
+		Reference:     tx.Reference,
+		CompletedAt:   tx.CompletedAt,
+		Expected:      expected,
+		Recorded:      recorded,
+		Reason:        reason,
+	}
+}
+
+// completedAt orders transactions without a completion time by when they were created
+func completedAt(tx *models.Transaction) time.Time {
+	if tx.CompletedAt != nil {
+		return *tx.CompletedAt
+	}
+	return tx.CreatedAt
+}
+
+// amounts within half a minor unit of the currency are the same amount
+func sameAmount(a, b float64, currency string) bool {
+	return math.Abs(a-b) < math.Pow10(-money.Exponent(currency))/2
+}
@@ -0,0 +1,409 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type frame struct {
+	fin     bool
+	opcode  int
+	masked  bool
+	payload []byte
+}
+
+// a server Conn over one end of a pipe; the frames it writes arrive on the channel, which closes with the pipe
+func testConn(t *testing.T) (*Conn, net.Conn, <-chan frame) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	frames := make(chan frame, 16)
+	go func() {
+		defer close(frames)
+		reader := bufio.NewReader(client)
+		for {
+			f, err := readFrame(reader)
+			if err != nil {
+				return
+			}
+			frames <- f
+		}
+	}()
+	return &Conn{conn: server, reader: bufio.NewReader(server), readLimit: DefaultReadLimit}, client, frames
+}
+
+// encodes a client frame, masked with a fixed key unless told otherwise
+func clientFrame(fin bool, opcode int, payload []byte, masked bool) []byte {
+	b := []byte{byte(opcode)}
+	if fin {
+		b[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126, byte(n>>8), byte(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !masked {
+		return append(b, payload...)
+	}
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	b = append(b, key[:]...)
+	for i, c := range payload {
+		b = append(b, c^key[i%4])
+	}
+	return b
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return append(payload, reason...)
+}
+
+// decodes one frame as a client sees it
+func readFrame(r *bufio.Reader) (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, opcode: int(header[0] & 0x0f), masked: header[1]&0x80 != 0}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	f.payload = make([]byte, length)
+	_, err := io.ReadFull(r, f.payload)
+	return f, err
+}
+
+func send(client net.Conn, frames ...[]byte) {
+	go client.Write(bytes.Join(frames, nil))
+}
+
+func next(t *testing.T, frames <-chan frame) frame {
+	t.Helper()
+	select {
+	case f, ok := <-frames:
+		if !ok {
+			t.Fatal("connection closed without a frame")
+		}
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame written")
+	}
+	return frame{}
+}
+
+func TestUpgrade(t *testing.T) {
+	upgraded := make(chan *Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		upgraded <- conn
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// the sample handshake of RFC 6455, section 1.3
+	request := "GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept is %q", got)
+	}
+
+	// the upgraded connection speaks frames both ways
+	ws := <-upgraded
+	defer ws.Close(CloseNormal, "")
+	if _, err := conn.Write(clientFrame(true, TextMessage, []byte("hello"), true)); err != nil {
+		t.Fatal(err)
+	}
+	op, data, err := ws.ReadMessage()
+	if err != nil || op != TextMessage || string(data) != "hello" {
+		t.Fatalf("read %d %q %v", op, data, err)
+	}
+	if err := ws.WriteMessage(TextMessage, []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readFrame(reader)
+	if err != nil || f.masked || f.opcode != TextMessage || string(f.payload) != "world" {
+		t.Fatalf("wrote %+v %v", f, err)
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	valid := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		return r
+	}
+	tests := map[string]func(r *http.Request){
+		"post":          func(r *http.Request) { r.Method = http.MethodPost },
+		"no upgrade":    func(r *http.Request) { r.Header.Del("Upgrade") },
+		"no connection": func(r *http.Request) { r.Header.Set("Connection", "keep-alive") },
+		"old version":   func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") },
+		"short key":     func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") },
+		"invalid key":   func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "not base64!") },
+	}
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := valid()
+			edit(r)
+			w := httptest.NewRecorder()
+			if _, err := Upgrade(w, r); err == nil {
+				t.Fatal("upgraded")
+			}
+			if w.Body.Len() != 0 {
+				t.Fatal("wrote a response")
+			}
+		})
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), 300)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		op     int
+		want   []byte
+	}{
+		{"text", [][]byte{clientFrame(true, TextMessage, []byte("hello"), true)}, TextMessage, []byte("hello")},
+		{"binary", [][]byte{clientFrame(true, BinaryMessage, []byte{0, 1, 2, 255}, true)}, BinaryMessage, []byte{0, 1, 2, 255}},
+		{"empty", [][]byte{clientFrame(true, TextMessage, nil, true)}, TextMessage, nil},
+		{"16-bit length", [][]byte{clientFrame(true, TextMessage, long, true)}, TextMessage, long},
+		{"fragmented", [][]byte{
+			clientFrame(false, TextMessage, []byte("hel"), true),
+			clientFrame(false, opContinuation, []byte("l"), true),
+			clientFrame(true, opContinuation, []byte("o"), true),
+		}, TextMessage, []byte("hello")},
+		{"pong between fragments", [][]byte{
+			clientFrame(false, TextMessage, []byte("hel"), true),
+			clientFrame(true, opPong, nil, true),
+			clientFrame(true, opContinuation, []byte("lo"), true),
+		}, TextMessage, []byte("hello")},
+		{"utf-8 split across fragments", [][]byte{
+			clientFrame(false, TextMessage, []byte("\xe2\x82"), true),
+			clientFrame(true, opContinuation, []byte("\xac"), true),
+		}, TextMessage, []byte("€")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client, _ := testConn(t)
+			send(client, tt.frames...)
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op != tt.op || !bytes.Equal(data, tt.want) {
+				t.Fatalf("got %d %q, want %d %q", op, data, tt.op, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageAnswersPings(t *testing.T) {
+	conn, client, frames := testConn(t)
+	send(client,
+		clientFrame(false, TextMessage, []byte("hel"), true),
+		clientFrame(true, opPing, []byte("are you there"), true),
+		clientFrame(true, opContinuation, []byte("lo"), true),
+	)
+
+	read := make(chan string, 1)
+	go func() {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			read <- err.Error()
+			return
+		}
+		read <- string(data)
+	}()
+
+	pong := next(t, frames)
+	if pong.opcode != opPong || string(pong.payload) != "are you there" || pong.masked || !pong.fin {
+		t.Fatalf("answered %+v", pong)
+	}
+	if got := <-read; got != "hello" {
+		t.Fatalf("read %q", got)
+	}
+}
+
+func TestReadMessageFailsProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		limit  int64
+		code   int
+	}{
+		{"unmasked frame", [][]byte{clientFrame(true, TextMessage, []byte("hi"), false)}, 0, CloseProtocolError},
+		{"reserved bits", [][]byte{func() []byte {
+			f := clientFrame(true, TextMessage, []byte("hi"), true)
+			f[0] |= 0x40
+			return f
+		}()}, 0, CloseProtocolError},
+		{"unknown opcode", [][]byte{clientFrame(true, 3, []byte("hi"), true)}, 0, CloseProtocolError},
+		{"continuation first", [][]byte{clientFrame(true, opContinuation, []byte("hi"), true)}, 0, CloseProtocolError},
+		{"new message inside a fragmented one", [][]byte{
+			clientFrame(false, TextMessage, []byte("a"), true),
+			clientFrame(true, TextMessage, []byte("b"), true),
+		}, 0, CloseProtocolError},
+		{"fragmented ping", [][]byte{clientFrame(false, opPing, nil, true)}, 0, CloseProtocolError},
+		{"long ping", [][]byte{clientFrame(true, opPing, bytes.Repeat([]byte("p"), 126), true)}, 0, CloseProtocolError},
+		{"invalid utf-8", [][]byte{clientFrame(true, TextMessage, []byte{0xff, 0xfe}, true)}, 0, CloseInvalidData},
+		{"frame over the limit", [][]byte{clientFrame(true, BinaryMessage, make([]byte, 11), true)}, 10, CloseTooBig},
+		{"fragments over the limit", [][]byte{
+			clientFrame(false, BinaryMessage, make([]byte, 6), true),
+			clientFrame(true, opContinuation, make([]byte, 6), true),
+		}, 10, CloseTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client, frames := testConn(t)
+			if tt.limit > 0 {
+				conn.SetReadLimit(tt.limit)
+			}
+			send(client, tt.frames...)
+
+			_, _, err := conn.ReadMessage()
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tt.code {
+				t.Fatalf("got %v, want close code %d", err, tt.code)
+			}
+			f := next(t, frames)
+			if f.opcode != opClose || int(binary.BigEndian.Uint16(f.payload)) != tt.code {
+				t.Fatalf("closed with %+v", f)
+			}
+			if err := conn.WriteMessage(TextMessage, []byte("late")); err != ErrClosed {
+				t.Fatalf("write after failure: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		code    int
+		reason  string
+		echoed  int
+	}{
+		{"with a code", closePayload(CloseGoingAway, "tab closed"), CloseGoingAway, "tab closed", CloseGoingAway},
+		{"without a code", nil, closeNoStatus, "", CloseNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client, frames := testConn(t)
+			send(client, clientFrame(true, opClose, tt.payload, true))
+
+			_, _, err := conn.ReadMessage()
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tt.code || closeErr.Reason != tt.reason {
+				t.Fatalf("got %v", err)
+			}
+			f := next(t, frames)
+			if f.opcode != opClose || !f.fin || int(binary.BigEndian.Uint16(f.payload)) != tt.echoed {
+				t.Fatalf("answered %+v", f)
+			}
+			if _, ok := <-frames; ok {
+				t.Fatal("wrote after the close frame")
+			}
+			if err := conn.WriteMessage(TextMessage, []byte("late")); err != ErrClosed {
+				t.Fatalf("write after close: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloseSendsOnce(t *testing.T) {
+	conn, _, frames := testConn(t)
+	reason := strings.Repeat("r", 200)
+	if err := conn.Close(ClosePolicyViolation, reason); err != nil {
+		t.Fatal(err)
+	}
+	f := next(t, frames)
+	if f.opcode != opClose || int(binary.BigEndian.Uint16(f.payload)) != ClosePolicyViolation || len(f.payload) != 125 {
+		t.Fatalf("closed with opcode %d and %d bytes", f.opcode, len(f.payload))
+	}
+	if err := conn.Close(CloseNormal, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-frames; ok {
+		t.Fatal("closed twice")
+	}
+}
+
+func TestWriteMessageFraming(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		conn, _, frames := testConn(t)
+		data := bytes.Repeat([]byte{'x'}, size)
+		go conn.WriteMessage(BinaryMessage, data)
+
+		f := next(t, frames)
+		if !f.fin || f.masked || f.opcode != BinaryMessage || !bytes.Equal(f.payload, data) {
+			t.Fatalf("size %d: wrote fin=%v masked=%v opcode=%d with %d bytes", size, f.fin, f.masked, f.opcode, len(f.payload))
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	conn, _, frames := testConn(t)
+	go conn.WriteJSON(map[string]string{"type": "balance"})
+
+	f := next(t, frames)
+	if f.opcode != TextMessage || string(f.payload) != `{"type":"balance"}` {
+		t.Fatalf("wrote %d %q", f.opcode, f.payload)
+	}
+}
@@ -60,7 +60,7 @@ func main() {
 	var successMutex sync.Mutex
 
 	// Launch transactions
-	fmt.Printf("% launching %d transactions with max concurrency of %d%s\n",
+	fmt.Printf("%slaunching %d transactions with max concurrency of %d%s\n",
 		infoColor, numTransactions, maxConcurrency, resetColor)
 
 	for i := 0; i < numTransactions; i++ {
@@ -242,12 +242,14 @@ func getTransactions(accountID string) ([]Transaction, error) {
 		return nil, fmt.Errorf("failed to get transactions, status: %d, body: %s", resp.StatusCode, string(body))
 	}
 
-	var transactions []Transaction
-	if err := json.NewDecoder(resp.Body).Decode(&transactions); err != nil {
+	var page struct {
+		Data []Transaction `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	return transactions, nil
+	return page.Data, nil
 }
 
 // checkAccountsAndTransactions checks the final state of accounts and their transactions